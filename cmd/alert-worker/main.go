@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/alert"
+	"github.com/aak1247/logtap/internal/channel"
+	"github.com/aak1247/logtap/internal/channel/builtin"
 	"github.com/aak1247/logtap/internal/config"
 	"github.com/aak1247/logtap/internal/db"
 	"gorm.io/gorm"
@@ -40,7 +42,19 @@ func main() {
 	}
 	defer sqlDB.Close()
 
+	// The same channels as the gateway's embedded worker, so deliveries
+	// queued with a JSON channel config (quota notices among them) are sent
+	// the same way wherever the worker runs.
+	channelReg, channelSvc, err := channel.Bootstrap(cfg)
+	if err != nil {
+		log.Fatalf("channel bootstrap: %v", err)
+	}
+	if err := builtin.RegisterAll(channelReg, cfg); err != nil {
+		log.Fatalf("channel register builtins: %v", err)
+	}
+
 	w := alert.NewWorker(gdb, cfg)
+	w.ChannelSvc = channelSvc
 	log.Printf("alert-worker started")
 	err = w.Run(ctx)
 	if err != nil && !errors.Is(err, context.Canceled) {
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/alert"
+	"github.com/aak1247/logtap/internal/archive"
 	"github.com/aak1247/logtap/internal/channel"
 	"github.com/aak1247/logtap/internal/channel/builtin"
 	"github.com/aak1247/logtap/internal/cleanup"
@@ -29,17 +31,31 @@ import (
 	"github.com/aak1247/logtap/internal/detector/plugins/tcpcheck"
 	"github.com/aak1247/logtap/internal/enrich"
 	"github.com/aak1247/logtap/internal/httpserver"
+	"github.com/aak1247/logtap/internal/logmetric"
 	"github.com/aak1247/logtap/internal/metrics"
 	"github.com/aak1247/logtap/internal/migrate"
+	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/monitor"
 	"github.com/aak1247/logtap/internal/obs"
+	"github.com/aak1247/logtap/internal/partition"
+	"github.com/aak1247/logtap/internal/pipeline"
 	"github.com/aak1247/logtap/internal/queue"
+	"github.com/aak1247/logtap/internal/quota"
+	"github.com/aak1247/logtap/internal/savedsearch"
 	"github.com/aak1247/logtap/internal/selflog"
+	"github.com/aak1247/logtap/internal/tail"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 func main() {
+	sqlitePath := flag.String("sqlite", "", "run on an embedded SQLite database file instead of Postgres (same as DB_DRIVER=sqlite SQLITE_PATH=<path>)")
+	flag.Parse()
+	if *sqlitePath != "" {
+		_ = os.Setenv("DB_DRIVER", "sqlite")
+		_ = os.Setenv("SQLITE_PATH", *sqlitePath)
+	}
+
 	cfg, err := config.FromEnv()
 	if err != nil {
 		log.Fatalf("config: %v", err)
@@ -63,13 +79,19 @@ func main() {
 	}
 
 	var gdb *gorm.DB
-	if cfg.PostgresURL != "" {
-		readyCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-		d, err := waitForPostgres(readyCtx, cfg.PostgresURL, db.Options{
+	if cfg.DatabaseConfigured() {
+		dbOpts := db.Options{
 			MaxOpenConns: cfg.DBMaxOpenConns,
 			MaxIdleConns: cfg.DBMaxIdleConns,
-		})
-		cancel()
+		}
+		var d *gorm.DB
+		if cfg.UseSQLite() {
+			d, err = db.NewSQLite(ctx, cfg.SQLitePath, dbOpts)
+		} else {
+			readyCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+			d, err = waitForPostgres(readyCtx, cfg.PostgresURL, dbOpts)
+			cancel()
+		}
 		if err != nil {
 			log.Fatalf("db: %v", err)
 		}
@@ -80,8 +102,17 @@ func main() {
 		}
 		defer sqlDB.Close()
 
-		migCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-		if err := migrate.AutoMigrate(migCtx, gdb, migrate.Options{RequireTimescale: cfg.DBRequireTimescale}); err != nil {
+		migCtx, cancel := context.WithTimeout(ctx, cfg.DBMigrateTimeout)
+		if err := migrate.AutoMigrate(migCtx, gdb, migrate.Options{
+			RequireTimescale: cfg.DBRequireTimescale,
+			Partitioning:     cfg.PGPartitioning,
+			PartitionPremake: cfg.PGPartitionPremake,
+			Timescale: model.TimescaleSettings{
+				CompressAfterDays:    cfg.TimescaleCompressAfterDays,
+				RetentionEnabled:     cfg.TimescaleRetention,
+				ContinuousAggregates: cfg.TimescaleContinuousAggregates,
+			},
+		}); err != nil {
 			cancel()
 			log.Fatalf("db migrate: %v", err)
 		}
@@ -95,7 +126,8 @@ func main() {
 	}
 
 	var recorder *metrics.RedisRecorder
-	if cfg.EnableMetrics {
+	tails := tail.NewHub()
+	if cfg.RedisAddr != "" {
 		readyCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 		rdb, err := waitForRedis(readyCtx, cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
 		cancel()
@@ -103,8 +135,13 @@ func main() {
 			log.Fatalf("redis: %v", err)
 		}
 		defer rdb.Close()
-		recorder = metrics.NewRedisRecorder(rdb, metrics.WithTTLs(cfg.MetricsDayTTL, cfg.MetricsDistTTL, cfg.MetricsMonthTTL))
+		if cfg.EnableMetrics {
+			recorder = metrics.NewRedisRecorder(rdb, metrics.WithTTLs(cfg.MetricsDayTTL, cfg.MetricsDistTTL, cfg.MetricsMonthTTL))
+		}
+		tails = tail.NewRedisHub(ctx, rdb)
 	}
+	tails.MaxStreams = cfg.TailMaxStreams
+	tails.MaxRate = cfg.TailMaxRate
 
 	geoip, err := enrich.NewGeoIP(cfg.GeoIPCityMMDB, cfg.GeoIPASNMMDB)
 	if err != nil {
@@ -138,7 +175,12 @@ func main() {
 	if err := detectorRegistry.RegisterStatic(tcpcheck.New()); err != nil {
 		log.Printf("detector register static tcp_check: %v", err)
 	}
-	if err := detectorRegistry.RegisterStatic(metricthreshold.New()); err != nil {
+	thresholdPlugin := metricthreshold.New()
+	if gdb != nil {
+		thresholdPlugin = metricthreshold.NewWithMetrics(logmetric.NewReader(gdb))
+		thresholdPlugin.Queries = pipeline.NewReader(gdb)
+	}
+	if err := detectorRegistry.RegisterStatic(thresholdPlugin); err != nil {
 		log.Printf("detector register static metric_threshold: %v", err)
 	}
 	if err := detectorRegistry.RegisterStatic(dnscheck.New()); err != nil {
@@ -174,24 +216,32 @@ func main() {
 	log.Printf("detector registry initialized: total=%d dynamic_loaded=%d dynamic_failed=%d", len(detectorRegistry.List()), dynamicLoaded, dynamicFailed)
 	detectorService := detector.NewService(detectorRegistry, detectorStore)
 
-	srv := httpserver.New(cfg, publisher, gdb, recorder, stats, detectorService, detectorStore)
+	srv := httpserver.New(cfg, publisher, gdb, recorder, stats, detectorService, detectorStore, tails)
 
 	var eventConsumer *consumer.NSQConsumer
 	var logConsumer *consumer.NSQConsumer
 	if cfg.RunConsumers {
 		if gdb == nil {
-			log.Fatalf("POSTGRES_URL required when RUN_CONSUMERS=true")
+			log.Fatalf("POSTGRES_URL (or DB_DRIVER=sqlite) required when RUN_CONSUMERS=true")
 		}
 		eventConsumer, err = consumer.NewNSQEventConsumer(ctx, cfg, gdb, recorder, geoip, stats)
 		if err != nil {
 			log.Fatalf("event consumer: %v", err)
 		}
-		logConsumer, err = consumer.NewNSQLogConsumer(ctx, cfg, gdb, recorder, geoip, stats)
+		logConsumer, err = consumer.NewNSQLogConsumer(ctx, cfg, gdb, recorder, geoip, stats, tails)
 		if err != nil {
 			log.Fatalf("log consumer: %v", err)
 		}
 	}
 
+	var partitions *partition.Manager
+	if period, ok := partition.ParsePeriod(cfg.PGPartitioning); ok && gdb != nil && !cfg.UseSQLite() {
+		partitions = partition.NewManager(gdb, period)
+		partitions.Premake = cfg.PGPartitionPremake
+		go partitions.Run(ctx)
+		log.Printf("partition manager enabled (period=%s premake=%d)", period, partitions.Premake)
+	}
+
 	if gdb != nil {
 		w := cleanup.NewWorker(gdb)
 		w.Interval = cfg.CleanupInterval
@@ -200,8 +250,35 @@ func main() {
 		w.MaxBatches = cfg.CleanupMaxBatches
 		w.BatchSleep = cfg.CleanupBatchSleep
 		w.Stats = stats
+		w.Partitions = partitions
+		archiveStore, err := archive.NewStore(cfg)
+		if err != nil {
+			log.Fatalf("archive store: %v", err)
+		}
+		if archiveStore != nil {
+			w.Archiver = archive.NewArchiver(gdb, archiveStore)
+			log.Printf("archive tier enabled (store=%s)", archiveStore.Name())
+		}
 		go w.Run(ctx)
 		log.Printf("cleanup worker enabled")
+
+		qw := quota.NewWorker(gdb)
+		qw.Interval = cfg.QuotaCheckInterval
+		qw.DeleteBatchSize = cfg.CleanupDeleteBatchSize
+		qw.MaxBatches = cfg.CleanupMaxBatches
+		go qw.Run(ctx)
+		log.Printf("quota worker enabled")
+
+		lw := logmetric.NewWorker(gdb)
+		lw.Interval = cfg.LogMetricInterval
+		lw.Delay = cfg.LogMetricDelay
+		go lw.Run(ctx)
+		log.Printf("log metric worker enabled")
+
+		sw := savedsearch.NewWorker(gdb)
+		sw.Interval = cfg.SavedSearchInterval
+		go sw.Run(ctx)
+		log.Printf("saved search worker enabled")
 	}
 
 	if gdb != nil && cfg.RunAlertWorker {
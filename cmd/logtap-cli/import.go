@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// importJob is the part of the server's import job the CLI reports.
+type importJob struct {
+	ID         int    `json:"id"`
+	Status     string `json:"status"`
+	Bytes      int64  `json:"bytes"`
+	Lines      int64  `json:"lines"`
+	Imported   int64  `json:"imported"`
+	Duplicates int64  `json:"duplicates"`
+	Failed     int64  `json:"failed"`
+	Error      string `json:"error"`
+	Errors     []struct {
+		Part  int    `json:"part"`
+		Line  int64  `json:"line"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+func (j importJob) progress() string {
+	return fmt.Sprintf("%d lines, %d imported, %d duplicates, %d failed", j.Lines, j.Imported, j.Duplicates, j.Failed)
+}
+
+// importFiles creates an import and uploads each file to it as one part,
+// printing its progress while the server imports it.
+func importFiles(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	baseURL := flags.String("url", os.Getenv("LOGTAP_URL"), "logtap server URL (LOGTAP_URL)")
+	token := flags.String("token", os.Getenv("LOGTAP_TOKEN"), "API token (LOGTAP_TOKEN)")
+	projectID := flags.Int("project", 0, "project id")
+	kind := flags.String("kind", "logs", "what the files hold: logs, track or events (Sentry event JSON)")
+	compress := flags.Bool("gzip", false, "gzip the files on the way up (*.gz files are sent as they are)")
+	resume := flags.Int("import", 0, "add the files to this existing import instead of creating one")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: logtap-cli import [flags] <file.ndjson[.gz]>...")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if strings.TrimSpace(*baseURL) == "" || *projectID <= 0 || flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("-url, -project and at least one file are required")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/%d/imports", strings.TrimRight(*baseURL, "/"), *projectID)
+	// Uploads run as long as the import; only the other calls time out.
+	client := &http.Client{Timeout: 30 * time.Second}
+	uploads := &http.Client{}
+
+	job := importJob{ID: *resume}
+	if job.ID <= 0 {
+		body, _ := json.Marshal(map[string]string{"kind": *kind})
+		if err := callJSON(ctx, client, http.MethodPost, endpoint, *token, body, &job); err != nil {
+			return fmt.Errorf("create import: %w", err)
+		}
+		fmt.Printf("import %d created\n", job.ID)
+	}
+	jobURL := fmt.Sprintf("%s/%d", endpoint, job.ID)
+
+	for _, file := range flags.Args() {
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(2 * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					var cur importJob
+					if err := callJSON(ctx, client, http.MethodGet, jobURL, *token, nil, &cur); err == nil {
+						fmt.Printf("  %s: %s\n", file, cur.progress())
+					}
+				}
+			}
+		}()
+		var err error
+		job, err = importFile(ctx, uploads, jobURL+"/data", *token, file, *compress)
+		close(done)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		fmt.Printf("imported %s\n", file)
+	}
+
+	fmt.Printf("import %d %s: %s\n", job.ID, job.Status, job.progress())
+	for _, e := range job.Errors {
+		fmt.Printf("  part %d line %d: %s\n", e.Part, e.Line, e.Error)
+	}
+	if job.Failed > 0 {
+		return fmt.Errorf("%d lines were not imported", job.Failed)
+	}
+	return nil
+}
+
+func importFile(ctx context.Context, client *http.Client, endpoint, token, file string, compress bool) (importJob, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return importJob{}, err
+	}
+	defer f.Close()
+
+	var body io.Reader = f
+	gzipped := strings.HasSuffix(file, ".gz")
+	if compress && !gzipped {
+		pr, pw := io.Pipe()
+		go func() {
+			zw := gzip.NewWriter(pw)
+			_, err := io.Copy(zw, f)
+			if err == nil {
+				err = zw.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		body, gzipped = pr, true
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return importJob{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	var job importJob
+	err = doJSON(client, req, &job)
+	return job, err
+}
+
+func callJSON(ctx context.Context, client *http.Client, method, endpoint, token string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return doJSON(client, req, out)
+}
+
+// doJSON sends req and decodes the data of its response into out.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return apiError(resp)
+	}
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return err
+	}
+	return json.Unmarshal(env.Data, out)
+}
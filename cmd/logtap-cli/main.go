@@ -0,0 +1,240 @@
+// Command logtap-cli talks to a logtap server from scripts and CI.
+//
+//	logtap-cli sourcemaps upload -url https://logtap.example.com -project 1 \
+//	    -release web@1.4.2 -url-prefix '~/static/js' ./build/static/js
+//	logtap-cli proguard upload -project 1 -release app@1.4.2 \
+//	    app/build/outputs/mapping/release/mapping.txt
+//	logtap-cli dart-symbols upload -project 1 -release app@1.4.2 ./debug-info
+//	logtap-cli import -project 1 -kind logs -gzip ./logs-2023.ndjson
+//
+// The server URL and token default to LOGTAP_URL and LOGTAP_TOKEN.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `usage: logtap-cli <command> [flags]
+
+commands:
+  sourcemaps upload     upload JavaScript bundles, source maps and sources for a release
+  proguard upload       upload ProGuard/R8 mapping.txt files for a release
+  dart-symbols upload   upload the *.symbols files written by flutter build --split-debug-info
+  import                backfill logs, track events or Sentry events from NDJSON files
+`
+
+// uploadKind describes one "<kind> upload" command.
+type uploadKind struct {
+	// typ is sent as the artifact type; empty lets the server derive it.
+	typ    string
+	prefix string
+	exts   string
+}
+
+var uploadKinds = map[string]uploadKind{
+	"sourcemaps":   {prefix: "~/", exts: ".js,.mjs,.cjs,.map"},
+	"proguard":     {typ: "proguard", exts: "mapping.txt"},
+	"dart-symbols": {typ: "dart_symbols", exts: ".symbols"},
+}
+
+func main() {
+	kind, ok := uploadKinds[arg(1)]
+	if arg(1) != "import" && (!ok || arg(2) != "upload") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var err error
+	if arg(1) == "import" {
+		err = importFiles(ctx, os.Args[2:])
+	} else {
+		err = upload(ctx, os.Args[1], kind, os.Args[3:])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logtap-cli: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func arg(i int) string {
+	if i < len(os.Args) {
+		return os.Args[i]
+	}
+	return ""
+}
+
+func upload(ctx context.Context, command string, kind uploadKind, args []string) error {
+	flags := flag.NewFlagSet(command+" upload", flag.ExitOnError)
+	baseURL := flags.String("url", os.Getenv("LOGTAP_URL"), "logtap server URL (LOGTAP_URL)")
+	token := flags.String("token", os.Getenv("LOGTAP_TOKEN"), "API token (LOGTAP_TOKEN)")
+	projectID := flags.Int("project", 0, "project id")
+	release := flags.String("release", "", "release the files belong to, as sent by the SDK")
+	prefix := flags.String("url-prefix", kind.prefix, "URL prefix the files are served under, e.g. ~/static/js")
+	exts := flags.String("ext", kind.exts, "comma-separated extensions to upload from directories")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: logtap-cli %s upload [flags] <file|dir>...\n", command)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if strings.TrimSpace(*baseURL) == "" || *projectID <= 0 || strings.TrimSpace(*release) == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("-url, -project, -release and at least one path are required")
+	}
+
+	files, err := collectFiles(flags.Args(), strings.Split(*exts, ","))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no files to upload")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/%d/releases/%s/artifacts",
+		strings.TrimRight(*baseURL, "/"), *projectID, url.PathEscape(*release))
+	client := &http.Client{Timeout: 2 * time.Minute}
+	for _, f := range files {
+		name := artifactName(*prefix, f.rel)
+		if err := uploadFile(ctx, client, endpoint, *token, name, kind.typ, f.path); err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		fmt.Printf("uploaded %s\n", name)
+	}
+	fmt.Printf("%d files uploaded for release %s\n", len(files), *release)
+	return nil
+}
+
+type localFile struct {
+	path string
+	// rel is the slash-separated path below the argument it was found in.
+	rel string
+}
+
+// collectFiles expands directories into their files with one of exts; files
+// named explicitly are always included.
+func collectFiles(paths, exts []string) ([]localFile, error) {
+	var out []localFile
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			out = append(out, localFile{path: p, rel: filepath.Base(p)})
+			continue
+		}
+		err = filepath.WalkDir(p, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !hasExt(file, exts) {
+				return err
+			}
+			rel, err := filepath.Rel(p, file)
+			if err != nil {
+				return err
+			}
+			out = append(out, localFile{path: file, rel: filepath.ToSlash(rel)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func hasExt(file string, exts []string) bool {
+	for _, e := range exts {
+		if e = strings.TrimSpace(e); e != "" && strings.HasSuffix(file, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func artifactName(prefix, rel string) string {
+	if prefix == "" {
+		return rel
+	}
+	if strings.HasSuffix(prefix, "/") {
+		return prefix + rel
+	}
+	// path.Join would collapse the "//" of an absolute URL prefix.
+	return prefix + "/" + path.Clean(rel)
+}
+
+func uploadFile(ctx context.Context, client *http.Client, endpoint, token, name, typ, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("name", name); err != nil {
+		return err
+	}
+	if typ != "" {
+		if err := mw.WriteField("type", typ); err != nil {
+			return err
+		}
+	}
+	part, err := mw.CreateFormFile("file", filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return apiError(resp)
+}
+
+// apiError reads the error of a failed API response.
+func apiError(resp *http.Response) error {
+	var apiErr struct {
+		Err string `json:"err"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(raw, &apiErr) == nil && apiErr.Err != "" {
+		return fmt.Errorf("%s: %s", resp.Status, apiErr.Err)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(raw)))
+}
@@ -2,6 +2,7 @@ package alert
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/aak1247/logtap/internal/model"
 )
@@ -29,6 +30,9 @@ func InputFromLog(row model.Log) Input {
 	if row.SpanID != "" {
 		fields["span_id"] = row.SpanID
 	}
+	if row.PatternID != "" {
+		fields["pattern_id"] = row.PatternID
+	}
 
 	return Input{
 		ProjectID: row.ProjectID,
@@ -81,3 +85,43 @@ func InputFromEvent(row model.Event) Input {
 		Fields:    fields,
 	}
 }
+
+// InputFromIssue is the input for an issue lifecycle trigger (new_issue or
+// regression); ev is the event that caused it.
+func InputFromIssue(issue model.Issue, trigger string, ev model.Event) Input {
+	in := InputFromEvent(ev)
+	in.Source = SourceIssues
+	in.Trigger = trigger
+	in.Level = issue.Level
+	in.Message = issue.Title
+	in.Fields["issue_id"] = issue.ID
+	in.Fields["fingerprint"] = issue.Fingerprint
+	in.Fields["culprit"] = issue.Culprit
+	in.Fields["trigger"] = trigger
+	in.Fields["count"] = issue.TimesSeen
+	in.Fields["users"] = issue.UserCount
+	return in
+}
+
+// InputFromMetricPoint is the input for a rolled-up point of a log-derived
+// metric; rules compare fields.value, optionally by fields.labels.
+func InputFromMetricPoint(m model.LogMetric, p model.MetricPoint) Input {
+	fields := map[string]any{
+		"metric":      m.Name,
+		"metric_id":   m.ID,
+		"aggregation": m.Aggregation,
+		"value":       p.Value,
+		"count":       p.Count,
+		"bucket":      p.Bucket.UTC().Format(time.RFC3339),
+	}
+	if labels := parseJSONMap(p.Labels); len(labels) > 0 {
+		fields["labels"] = labels
+	}
+	return Input{
+		ProjectID: m.ProjectID,
+		Source:    SourceMetrics,
+		Timestamp: p.Bucket.UTC(),
+		Message:   m.Name,
+		Fields:    fields,
+	}
+}
@@ -41,6 +41,8 @@ func (e *Engine) Evaluate(ctx context.Context, in Input) error {
 		q = q.Where("source IN ?", []string{string(SourceLogs), string(SourceBoth)})
 	case SourceEvents:
 		q = q.Where("source IN ?", []string{string(SourceEvents), string(SourceBoth)})
+	case SourceIssues, SourceMetrics:
+		q = q.Where("source = ?", string(in.Source))
 	default:
 		q = q.Where("source IN ?", []string{string(SourceBoth), string(SourceLogs), string(SourceEvents)})
 	}
@@ -118,6 +120,9 @@ func computeDedupeKeyHash(ruleID int, in Input, rep RuleRepeat) string {
 		fmt.Sprintf("src=%s", in.Source),
 		fmt.Sprintf("lvl=%s", strings.TrimSpace(in.Level)),
 	}
+	if in.Trigger != "" {
+		parts = append(parts, "trigger="+in.Trigger)
+	}
 	if rep.DedupeByMessage == nil || *rep.DedupeByMessage {
 		parts = append(parts, "msg="+normalizeLower(in.Message))
 	}
@@ -219,6 +224,9 @@ func formatNotification(rule model.AlertRule, in Input) (title string, content s
 		strings.TrimSpace(in.Level),
 		strings.TrimSpace(in.Message),
 	)
+	if in.Trigger != "" {
+		content += " trigger=" + in.Trigger
+	}
 	if len(in.Fields) > 0 {
 		if b, err := json.Marshal(in.Fields); err == nil {
 			content += "\nfields=" + string(b)
@@ -113,11 +113,55 @@ func matchField(f FieldMatch, fields map[string]any) bool {
 			}
 		}
 		return false
+	case OpGT, OpGTE, OpLT, OpLTE:
+		v, ok := getByPath(fields, f.Path)
+		if !ok {
+			return false
+		}
+		x, ok := toFloat(v)
+		if !ok {
+			return false
+		}
+		y, ok := toFloat(f.Value)
+		if !ok {
+			return false
+		}
+		switch f.Op {
+		case OpGT:
+			return x > y
+		case OpGTE:
+			return x >= y
+		case OpLT:
+			return x < y
+		default:
+			return x <= y
+		}
 	default:
 		return false
 	}
 }
 
+func toFloat(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
 func toString(v any) string {
 	switch t := v.(type) {
 	case nil:
@@ -147,6 +191,17 @@ func matchRule(m RuleMatch, in Input) bool {
 		}
 	}
 
+	if len(m.IssueTriggers) > 0 && !stringInList(in.Trigger, m.IssueTriggers) {
+		return false
+	}
+
+	if len(m.PatternIDs) > 0 {
+		id, _ := in.Fields["pattern_id"].(string)
+		if !stringInList(id, m.PatternIDs) {
+			return false
+		}
+	}
+
 	if len(m.MessageKeywords) > 0 && !containsAny(in.Message, m.MessageKeywords) {
 		return false
 	}
@@ -40,3 +40,40 @@ func TestMatchRule_EventNameAndFields(t *testing.T) {
 		t.Fatalf("expected match")
 	}
 }
+
+func TestMatchRule_IssueTriggers(t *testing.T) {
+	m := RuleMatch{IssueTriggers: []string{"regression"}}
+	if !matchRule(m, Input{Source: SourceIssues, Trigger: "regression"}) {
+		t.Fatalf("expected regression to match")
+	}
+	if matchRule(m, Input{Source: SourceIssues, Trigger: "new_issue"}) {
+		t.Fatalf("expected new_issue not to match")
+	}
+}
+
+func TestMatchRule_NumericOps(t *testing.T) {
+	in := Input{Source: SourceMetrics, Message: "checkout_errors", Fields: map[string]any{"metric": "checkout_errors", "value": 12.0}}
+	for op, want := range map[MatchOp]bool{OpGT: true, OpGTE: true, OpLT: false, OpLTE: false} {
+		m := RuleMatch{FieldsAll: []FieldMatch{{Path: "value", Op: op, Value: 10}}}
+		if got := matchRule(m, in); got != want {
+			t.Fatalf("%s 10: got %v, want %v", op, got, want)
+		}
+	}
+	m := RuleMatch{FieldsAll: []FieldMatch{{Path: "metric", Op: OpGT, Value: 10}}}
+	if matchRule(m, in) {
+		t.Fatalf("expected a non-numeric field not to match")
+	}
+}
+
+func TestMatchRule_PatternIDs(t *testing.T) {
+	m := RuleMatch{PatternIDs: []string{"0a1b2c3d4e5f6071"}}
+	if !matchRule(m, Input{Source: SourceLogs, Fields: map[string]any{"pattern_id": "0a1b2c3d4e5f6071"}}) {
+		t.Fatalf("expected the pattern to match")
+	}
+	if matchRule(m, Input{Source: SourceLogs, Fields: map[string]any{"pattern_id": "ffffffffffffffff"}}) {
+		t.Fatalf("expected another pattern not to match")
+	}
+	if matchRule(m, Input{Source: SourceLogs, Fields: map[string]any{}}) {
+		t.Fatalf("expected a log without pattern not to match")
+	}
+}
@@ -61,6 +61,8 @@ func (e *Engine) EvaluatePreview(ctx context.Context, in Input) ([]RulePreview,
 		q = q.Where("source IN ?", []string{string(SourceLogs), string(SourceBoth)})
 	case SourceEvents:
 		q = q.Where("source IN ?", []string{string(SourceEvents), string(SourceBoth)})
+	case SourceIssues, SourceMetrics:
+		q = q.Where("source = ?", string(in.Source))
 	default:
 		q = q.Where("source IN ?", []string{string(SourceBoth), string(SourceLogs), string(SourceEvents)})
 	}
@@ -8,6 +8,12 @@ const (
 	SourceLogs   Source = "logs"
 	SourceEvents Source = "events"
 	SourceBoth   Source = "both"
+	// SourceIssues rules match issue lifecycle triggers (see IssueTriggers)
+	// rather than individual rows; "both" does not include them.
+	SourceIssues Source = "issues"
+	// SourceMetrics rules match the points of log-derived metrics as they are
+	// rolled up; fields carry metric, value, count and labels.
+	SourceMetrics Source = "metrics"
 )
 
 type MatchOp string
@@ -17,6 +23,11 @@ const (
 	OpContains MatchOp = "contains"
 	OpExists   MatchOp = "exists"
 	OpIn       MatchOp = "in"
+	// Numeric comparisons, for metric values and numeric fields.
+	OpGT  MatchOp = "gt"
+	OpGTE MatchOp = "gte"
+	OpLT  MatchOp = "lt"
+	OpLTE MatchOp = "lte"
 )
 
 type FieldMatch struct {
@@ -32,6 +43,8 @@ type RuleMatch struct {
 	EventNames      []string     `json:"eventNames,omitempty"`      // for track: log.level=event + log.message in names
 	MessageKeywords []string     `json:"messageKeywords,omitempty"` // substring match on message/title
 	FieldsAll       []FieldMatch `json:"fieldsAll,omitempty"`       // all must match
+	IssueTriggers   []string     `json:"issueTriggers,omitempty"`   // for issues: new_issue/regression
+	PatternIDs      []string     `json:"patternIds,omitempty"`      // for logs: message template ids (see /patterns)
 }
 
 // RuleRepeat describes dedupe/backoff behavior.
@@ -60,4 +73,6 @@ type Input struct {
 	Level     string
 	Message   string
 	Fields    map[string]any
+	// Trigger is set for SourceIssues inputs (new_issue or regression).
+	Trigger string
 }
@@ -0,0 +1,267 @@
+// Package archive implements the cold storage tier: before retention deletes
+// a project's rows, they are exported as gzip-compressed NDJSON to an object
+// store and recorded in archive_manifests, from where they can be restored
+// into the rehydrated_* tables for querying.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/retention"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const Format = "ndjson.gz"
+
+// Kind is an archivable table.
+type Kind string
+
+const (
+	KindLogs        Kind = "logs"
+	KindEvents      Kind = "events"
+	KindTrackEvents Kind = "track_events"
+)
+
+var Kinds = []Kind{KindLogs, KindEvents, KindTrackEvents}
+
+func ParseKind(s string) (Kind, bool) {
+	for _, k := range Kinds {
+		if string(k) == s {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// RehydratedTable is the table archived rows of this kind are restored into.
+func (k Kind) RehydratedTable() string { return "rehydrated_" + string(k) }
+
+// ErrNoStore is returned when a project asks for archiving but no object
+// store is configured; nothing is deleted in that case.
+var ErrNoStore = errors.New("archive enabled but ARCHIVE_STORE is not configured")
+
+// Archiver exports expiring rows ahead of the retention deletes.
+type Archiver struct {
+	DB    *gorm.DB
+	Store ObjectStore
+	// MaxChunks bounds the day-sized objects written per call so one project
+	// with a long backlog cannot monopolise a cleanup pass.
+	MaxChunks int
+}
+
+func NewArchiver(db *gorm.DB, objects ObjectStore) *Archiver {
+	return &Archiver{DB: db, Store: objects, MaxChunks: 7}
+}
+
+// Archive exports the project's rows of kind that the retention buckets
+// expire and returns the bound up to which all of them are archived, i.e. the
+// time the caller may delete up to. On error the bound still covers the
+// chunks written so far. It starts at the oldest expired row rather than the
+// last manifest, so rows that arrived late, survived an interrupted delete or
+// were kept longer by a retention rule are archived once they expire instead
+// of being dropped unseen.
+func (a *Archiver) Archive(ctx context.Context, projectID int, kind Kind, buckets []retention.Bucket) (time.Time, error) {
+	if a == nil || a.Store == nil {
+		return time.Time{}, ErrNoStore
+	}
+	before := retention.Latest(buckets).UTC()
+	if before.IsZero() {
+		return before, nil
+	}
+	expired, args := retention.Expired(buckets)
+	f := filter{where: expired, args: args}
+	maxChunks := a.MaxChunks
+	if maxChunks <= 0 {
+		maxChunks = 1
+	}
+
+	from, ok, err := oldest(ctx, a.DB, kind, projectID, f, time.Time{}, before)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return before, nil
+	}
+	from = dayStart(from)
+	for i := 0; i < maxChunks; i++ {
+		to := from.Add(24 * time.Hour)
+		if to.After(before) {
+			to = before
+		}
+		if _, err := a.exportChunk(ctx, projectID, kind, f, from, to); err != nil {
+			return from, err
+		}
+		if !to.Before(before) {
+			return before, nil
+		}
+		// Skip empty days instead of spending chunks on them.
+		next, ok, err := oldest(ctx, a.DB, kind, projectID, f, to, before)
+		if err != nil {
+			return to, err
+		}
+		if !ok {
+			return before, nil
+		}
+		from = dayStart(next)
+		if from.Before(to) {
+			from = to
+		}
+	}
+	return from, nil
+}
+
+// filter restricts archiving to expired rows.
+type filter struct {
+	where string
+	args  []any
+}
+
+// exportChunk writes the expired rows in [from, to) to one object and
+// records its manifest. It returns a nil manifest when there are none.
+func (a *Archiver) exportChunk(ctx context.Context, projectID int, kind Kind, f filter, from, to time.Time) (*model.ArchiveManifest, error) {
+	tmp, err := os.CreateTemp("", "logtap-archive-*.ndjson.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, sum)}
+	gz := gzip.NewWriter(counter)
+	rows, err := exportRows(ctx, a.DB, kind, projectID, f, from, to, gz)
+	if err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, nil
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key := objectKey(projectID, kind, from, to, time.Now())
+	if err := a.Store.Put(ctx, key, tmp); err != nil {
+		return nil, fmt.Errorf("put %s: %w", key, err)
+	}
+	m := &model.ArchiveManifest{
+		ProjectID:  projectID,
+		Kind:       string(kind),
+		RangeStart: from,
+		RangeEnd:   to,
+		Rows:       rows,
+		Bytes:      counter.n,
+		SHA256:     hex.EncodeToString(sum.Sum(nil)),
+		Format:     Format,
+		Store:      a.Store.Name(),
+		ObjectKey:  key,
+	}
+	if err := store.CreateArchiveManifest(ctx, a.DB, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// objectKey names an object by its range and export time: rows a retention
+// rule kept longer are archived later under the same range.
+func objectKey(projectID int, kind Kind, from, to, exported time.Time) string {
+	return fmt.Sprintf("%d/%s/%s/%s-%s-%d.%s",
+		projectID, kind, from.Format("2006/01/02"),
+		from.Format("20060102T150405Z"), to.Format("20060102T150405Z"), exported.UnixNano(), Format)
+}
+
+func dayStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// oldest returns the earliest expired timestamp in [from, before); a zero
+// from leaves the lower side open.
+func oldest(ctx context.Context, db *gorm.DB, kind Kind, projectID int, f filter, from, before time.Time) (time.Time, bool, error) {
+	q := db.WithContext(ctx).Table(string(kind)).
+		Where("project_id = ? AND timestamp < ?", projectID, before).
+		Where(f.where, f.args...)
+	if !from.IsZero() {
+		q = q.Where("timestamp >= ?", from)
+	}
+	var ts time.Time
+	res := q.Select("timestamp").Order("timestamp ASC").Limit(1).Scan(&ts)
+	if res.Error != nil {
+		return time.Time{}, false, res.Error
+	}
+	return ts.UTC(), res.RowsAffected > 0, nil
+}
+
+func exportRows(ctx context.Context, db *gorm.DB, kind Kind, projectID int, f filter, from, to time.Time, w io.Writer) (int64, error) {
+	switch kind {
+	case KindLogs:
+		return streamRows[model.RehydratedLog](ctx, db, kind, projectID, f, from, to, w)
+	case KindEvents:
+		return streamRows[model.RehydratedEvent](ctx, db, kind, projectID, f, from, to, w)
+	case KindTrackEvents:
+		return streamRows[model.RehydratedTrackEvent](ctx, db, kind, projectID, f, from, to, w)
+	default:
+		return 0, fmt.Errorf("unknown archive kind %q", kind)
+	}
+}
+
+// streamRows scans the source table into T (whose columns mirror it) and
+// writes one JSON object per line.
+func streamRows[T any](ctx context.Context, db *gorm.DB, kind Kind, projectID int, f filter, from, to time.Time, w io.Writer) (int64, error) {
+	rows, err := db.WithContext(ctx).
+		Table(string(kind)).
+		Where("project_id = ? AND timestamp >= ? AND timestamp < ?", projectID, from, to).
+		Where(f.where, f.args...).
+		Order("timestamp ASC").
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	var n int64
+	for rows.Next() {
+		var row T
+		if err := db.ScanRows(rows, &row); err != nil {
+			return n, err
+		}
+		if err := enc.Encode(&row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// insertIgnore makes rehydrate idempotent: re-loading an archive must not
+// fail on the (archive_id, id) primary key.
+func insertIgnore(tx *gorm.DB, rows any) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error
+}
@@ -0,0 +1,120 @@
+package archive_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/retention"
+	"github.com/aak1247/logtap/internal/testkit"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+func TestArchiveAndRehydrate(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	if err := db.AutoMigrate(&model.ArchiveManifest{}, &model.RehydratedLog{}, &model.RehydratedEvent{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	ctx := context.Background()
+	day := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	// Two rows on day 0, none on day 1, one on day 2, one not yet expired.
+	for i, ts := range []time.Time{day.Add(time.Hour), day.Add(2 * time.Hour), day.Add(49 * time.Hour), day.Add(80 * time.Hour)} {
+		if err := db.Create(&model.Log{
+			ProjectID: 1, Timestamp: ts, Level: "info", Message: "m" + string(rune('a'+i)),
+			Fields: datatypes.JSON(`{"k":1}`),
+		}).Error; err != nil {
+			t.Fatalf("insert log: %v", err)
+		}
+	}
+	if err := db.Create(&model.Event{ID: uuid.New(), ProjectID: 1, Timestamp: day.Add(time.Hour), Title: "boom", Data: datatypes.JSON(`{"x":"y"}`)}).Error; err != nil {
+		t.Fatalf("insert event: %v", err)
+	}
+
+	objects, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	a := archive.NewArchiver(db, objects)
+	before := day.Add(72 * time.Hour)
+	until, err := a.Archive(ctx, 1, archive.KindLogs, []retention.Bucket{{Before: before}})
+	if err != nil {
+		t.Fatalf("Archive logs: %v", err)
+	}
+	if !until.Equal(before) {
+		t.Fatalf("expected archive to reach %v, got %v", before, until)
+	}
+	if _, err := a.Archive(ctx, 1, archive.KindEvents, []retention.Bucket{{Before: before}}); err != nil {
+		t.Fatalf("Archive events: %v", err)
+	}
+
+	var manifests []model.ArchiveManifest
+	if err := db.Where("kind = ?", "logs").Order("range_start").Find(&manifests).Error; err != nil {
+		t.Fatalf("list manifests: %v", err)
+	}
+	if len(manifests) != 2 || manifests[0].Rows != 2 || manifests[1].Rows != 1 {
+		t.Fatalf("expected day 0 (2 rows) and day 2 (1 row), got %+v", manifests)
+	}
+	if !manifests[1].RangeStart.Equal(day.Add(48*time.Hour)) || manifests[1].SHA256 == "" || manifests[1].Bytes == 0 {
+		t.Fatalf("unexpected manifest: %+v", manifests[1])
+	}
+
+	res, err := archive.Rehydrate(ctx, db, objects, 1, archive.KindLogs, day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Rehydrate: %v", err)
+	}
+	if res.Archives != 1 || res.Rows != 2 {
+		t.Fatalf("unexpected rehydrate result: %+v", res)
+	}
+	var restored []model.RehydratedLog
+	if err := db.Where("project_id = ?", 1).Order("timestamp").Find(&restored).Error; err != nil {
+		t.Fatalf("list rehydrated: %v", err)
+	}
+	if len(restored) != 2 || restored[0].Message != "ma" || string(restored[0].Fields) != `{"k":1}` || restored[0].ArchiveID != manifests[0].ID {
+		t.Fatalf("unexpected rehydrated rows: %+v", restored)
+	}
+	if res, err := archive.Rehydrate(ctx, db, objects, 1, archive.KindLogs, day, day.Add(24*time.Hour)); err != nil || res.Skipped != 1 || res.Rows != 0 {
+		t.Fatalf("expected second rehydrate to skip, got %+v err=%v", res, err)
+	}
+	if res, err := archive.Rehydrate(ctx, db, objects, 1, archive.KindEvents, time.Time{}, time.Time{}); err != nil || res.Rows != 1 {
+		t.Fatalf("rehydrate events: %+v err=%v", res, err)
+	}
+
+	// A corrupted object must not be loaded.
+	path := filepath.Join(objects.Dir, filepath.FromSlash(manifests[1].ObjectKey))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read object: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, 0), 0o644); err != nil {
+		t.Fatalf("write object: %v", err)
+	}
+	if _, err := archive.Rehydrate(ctx, db, objects, 1, archive.KindLogs, time.Time{}, time.Time{}); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	var n int64
+	db.Model(&model.RehydratedLog{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("expected corrupted archive rolled back, got %d rows", n)
+	}
+
+	if n, err := archive.DropRehydrated(ctx, db, 1, archive.KindLogs); err != nil || n != 2 {
+		t.Fatalf("DropRehydrated: n=%d err=%v", n, err)
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	s, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	if _, err := s.Get(context.Background(), "../etc/passwd"); err == nil {
+		t.Fatalf("expected error for key outside the archive dir")
+	}
+}
@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+const rehydrateBatchSize = 500
+
+// RehydrateResult summarises one Rehydrate call.
+type RehydrateResult struct {
+	Archives int   `json:"archives"`
+	Skipped  int   `json:"skipped"`
+	Rows     int64 `json:"rows"`
+}
+
+// Rehydrate loads every archive of kind overlapping [start, end) into the
+// kind's rehydrated_* table. Whole archives are restored so each manifest is
+// either loaded or not; archives already rehydrated are skipped. Objects are
+// checksummed before loading and a mismatch aborts that archive untouched.
+func Rehydrate(ctx context.Context, db *gorm.DB, objects ObjectStore, projectID int, kind Kind, start, end time.Time) (RehydrateResult, error) {
+	var out RehydrateResult
+	if objects == nil {
+		return out, ErrNoStore
+	}
+	manifests, err := store.ListArchiveManifests(ctx, db, projectID, string(kind), start, end, 1000)
+	if err != nil {
+		return out, err
+	}
+	for _, m := range manifests {
+		if m.RehydratedAt != nil {
+			out.Skipped++
+			continue
+		}
+		if m.Store != objects.Name() {
+			return out, fmt.Errorf("archive %d is in store %q but %q is configured", m.ID, m.Store, objects.Name())
+		}
+		n, err := rehydrateOne(ctx, db, objects, m)
+		if err != nil {
+			return out, fmt.Errorf("archive %d: %w", m.ID, err)
+		}
+		out.Archives++
+		out.Rows += n
+	}
+	return out, nil
+}
+
+func rehydrateOne(ctx context.Context, db *gorm.DB, objects ObjectStore, m model.ArchiveManifest) (int64, error) {
+	body, err := objects.Get(ctx, m.ObjectKey)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	// Verify the whole object before touching the database.
+	tmp, err := os.CreateTemp("", "logtap-rehydrate-*.ndjson.gz")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, sum), readerWithContext(ctx, body)); err != nil {
+		return 0, err
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); got != m.SHA256 {
+		return 0, fmt.Errorf("checksum mismatch (manifest %s, object %s)", m.SHA256, got)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	gz, err := gzip.NewReader(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		switch Kind(m.Kind) {
+		case KindLogs:
+			n, err = loadRows(tx, gz, func(r *model.RehydratedLog) { r.ArchiveID = m.ID })
+		case KindEvents:
+			n, err = loadRows(tx, gz, func(r *model.RehydratedEvent) { r.ArchiveID = m.ID })
+		case KindTrackEvents:
+			n, err = loadRows(tx, gz, func(r *model.RehydratedTrackEvent) { r.ArchiveID = m.ID })
+		default:
+			err = fmt.Errorf("unknown archive kind %q", m.Kind)
+		}
+		if err != nil {
+			return err
+		}
+		if n != m.Rows {
+			return fmt.Errorf("row count mismatch (manifest %d, object %d)", m.Rows, n)
+		}
+		now := time.Now().UTC()
+		return store.MarkArchiveRehydrated(ctx, tx, m.ID, &now)
+	})
+	return n, err
+}
+
+func loadRows[T any](tx *gorm.DB, r io.Reader, setArchive func(*T)) (int64, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	batch := make([]T, 0, rehydrateBatchSize)
+	var n int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := insertIgnore(tx, &batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		var row T
+		if err := dec.Decode(&row); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return n, fmt.Errorf("decode row %d: %w", n+1, err)
+		}
+		setArchive(&row)
+		batch = append(batch, row)
+		n++
+		if len(batch) == rehydrateBatchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, flush()
+}
+
+// DropRehydrated removes restored rows of kind for a project and marks their
+// archives as not rehydrated, so they can be loaded again later.
+func DropRehydrated(ctx context.Context, db *gorm.DB, projectID int, kind Kind) (int64, error) {
+	var deleted int64
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE project_id = ?`, kind.RehydratedTable()), projectID)
+		if res.Error != nil {
+			return res.Error
+		}
+		deleted = res.RowsAffected
+		return tx.Model(&model.ArchiveManifest{}).
+			Where("project_id = ? AND kind = ? AND rehydrated_at IS NOT NULL", projectID, string(kind)).
+			Update("rehydrated_at", nil).Error
+	})
+	return deleted, err
+}
@@ -0,0 +1,136 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aak1247/logtap/internal/config"
+)
+
+// ObjectStore holds archived objects under slash-separated keys.
+type ObjectStore interface {
+	// Name identifies the backend in manifests ("local", "s3").
+	Name() string
+	// Put stores body under key. The body is seekable so backends that need
+	// the payload hash or length up front can read it twice.
+	Put(ctx context.Context, key string, body io.ReadSeeker) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStore builds the object store selected by ARCHIVE_STORE. It returns
+// nil when archiving is off.
+func NewStore(cfg config.Config) (ObjectStore, error) {
+	switch cfg.ArchiveStore {
+	case "", "off":
+		return nil, nil
+	case "local":
+		return NewLocalStore(cfg.ArchiveDir)
+	case "s3":
+		return &S3Store{
+			Endpoint:        cfg.ArchiveS3Endpoint,
+			Bucket:          cfg.ArchiveS3Bucket,
+			Region:          cfg.ArchiveS3Region,
+			AccessKeyID:     cfg.ArchiveS3AccessKeyID,
+			SecretAccessKey: cfg.ArchiveS3SecretAccessKey,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive store %q", cfg.ArchiveStore)
+	}
+}
+
+// LocalStore keeps objects as files below Dir.
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, errors.New("archive dir is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+func (s *LocalStore) Name() string { return "local" }
+
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+// Put writes to a temporary file and renames it, so a crash never leaves a
+// truncated object behind a manifest.
+func (s *LocalStore) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, readerWithContext(ctx, body)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func readerWithContext(ctx context.Context, r io.Reader) io.Reader {
+	return ctxReader{ctx: ctx, r: r}
+}
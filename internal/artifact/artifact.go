@@ -0,0 +1,190 @@
+// Package artifact keeps the files uploaded for a release (minified bundles,
+// source maps, original sources, ProGuard mappings and Dart symbol files) in
+// an object store and uses them to symbolicate stack traces.
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/config"
+	"github.com/aak1247/logtap/internal/dartsym"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/proguard"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// MaxSize caps one artifact.
+const MaxSize = 64 << 20
+
+// Artifact types, derived from the name on upload.
+const (
+	TypeSource      = "source"
+	TypeSourceMap   = "sourcemap"
+	TypeProguard    = "proguard"
+	TypeDartSymbols = "dart_symbols"
+)
+
+var (
+	ErrTooLarge = fmt.Errorf("artifact exceeds %d bytes", MaxSize)
+	ErrInvalid  = errors.New("invalid artifact")
+)
+
+// NewStore builds the object store selected by ARTIFACT_STORE. It returns nil
+// when artifacts are off.
+func NewStore(cfg config.Config) (archive.ObjectStore, error) {
+	switch cfg.ArtifactStore {
+	case "", "off":
+		return nil, nil
+	case "local":
+		s, err := archive.NewLocalStore(cfg.ArtifactDir)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "s3":
+		return &archive.S3Store{
+			Endpoint:        cfg.ArchiveS3Endpoint,
+			Bucket:          cfg.ArchiveS3Bucket,
+			Region:          cfg.ArchiveS3Region,
+			AccessKeyID:     cfg.ArchiveS3AccessKeyID,
+			SecretAccessKey: cfg.ArchiveS3SecretAccessKey,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported artifact store %q", cfg.ArtifactStore)
+	}
+}
+
+// TypeOf classifies an artifact by its name.
+func TypeOf(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".map"):
+		return TypeSourceMap
+	case strings.HasSuffix(lower, ".symbols"):
+		return TypeDartSymbols
+	case strings.HasSuffix(lower, "mapping.txt"):
+		return TypeProguard
+	}
+	return TypeSource
+}
+
+// debugIDOf returns the id traces refer to the artifact by: a Dart symbol
+// file's build id (which must be present) or a mapping's pg_map_id.
+func debugIDOf(typ string, body []byte) (string, error) {
+	switch typ {
+	case TypeDartSymbols:
+		id, err := dartsym.BuildID(body)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		return id, nil
+	case TypeProguard:
+		id := proguard.MapID(bytes.NewReader(body))
+		if len(id) > 64 {
+			id = ""
+		}
+		return id, nil
+	}
+	return "", nil
+}
+
+// NormalizeName validates an artifact name.
+func NormalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if len(name) > 1000 {
+		return "", errors.New("name too long (max 1000)")
+	}
+	return name, nil
+}
+
+// objectKey stores identical content once per project.
+func objectKey(projectID int, sum string) string {
+	return fmt.Sprintf("artifacts/%d/%s", projectID, sum)
+}
+
+// Upload stores body as the release's artifact name, replacing an earlier
+// upload of the same name.
+func Upload(ctx context.Context, db *gorm.DB, objects archive.ObjectStore, projectID int, release, name, typ string, body []byte) (model.ReleaseArtifact, error) {
+	if len(body) > MaxSize {
+		return model.ReleaseArtifact{}, ErrTooLarge
+	}
+	if typ == "" {
+		typ = TypeOf(name)
+	}
+	debugID, err := debugIDOf(typ, body)
+	if err != nil {
+		return model.ReleaseArtifact{}, err
+	}
+	h := sha1.Sum(body)
+	sum := hex.EncodeToString(h[:])
+	key := objectKey(projectID, sum)
+	if err := objects.Put(ctx, key, bytes.NewReader(body)); err != nil {
+		return model.ReleaseArtifact{}, err
+	}
+	row, prevKey, err := store.UpsertReleaseArtifact(ctx, db, model.ReleaseArtifact{
+		ProjectID: projectID,
+		Release:   release,
+		Name:      name,
+		Type:      typ,
+		DebugID:   debugID,
+		Size:      int64(len(body)),
+		SHA1:      sum,
+		ObjectKey: key,
+	})
+	if err != nil {
+		return model.ReleaseArtifact{}, err
+	}
+	if prevKey != "" {
+		if err := dropUnused(ctx, db, objects, prevKey); err != nil {
+			return row, err
+		}
+	}
+	return row, nil
+}
+
+// Delete removes the artifact and, unless other artifacts share its content,
+// its object.
+func Delete(ctx context.Context, db *gorm.DB, objects archive.ObjectStore, row model.ReleaseArtifact) error {
+	inUse, err := store.DeleteReleaseArtifact(ctx, db, row)
+	if err != nil || inUse || objects == nil {
+		return err
+	}
+	return objects.Delete(ctx, row.ObjectKey)
+}
+
+func dropUnused(ctx context.Context, db *gorm.DB, objects archive.ObjectStore, key string) error {
+	inUse, err := store.ArtifactObjectInUse(ctx, db, key)
+	if err != nil || inUse {
+		return err
+	}
+	return objects.Delete(ctx, key)
+}
+
+// Read returns the artifact's content.
+func Read(ctx context.Context, objects archive.ObjectStore, row model.ReleaseArtifact) ([]byte, error) {
+	rc, err := objects.Get(ctx, row.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	return b, nil
+}
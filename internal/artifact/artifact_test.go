@@ -0,0 +1,192 @@
+package artifact_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/artifact"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+const (
+	bundle = "function a(b){throw new Error(b)}\n//# sourceMappingURL=maps/app.min.js.map\n"
+	// No sourcesContent: context comes from the uploaded source.
+	bundleMap = `{"version":3,"sourceRoot":"","sources":["../src/app.js"],"names":["greet"],"mappings":"AAAA,SAASA,KACP"}`
+	source    = "function greet(name) {\n  throw new Error(name);\n}\n"
+)
+
+func TestSymbolicate(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	objects, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	ctx := context.Background()
+	for name, body := range map[string]string{
+		"~/static/app.min.js":          bundle,
+		"~/static/maps/app.min.js.map": bundleMap,
+		"~/static/src/app.js":          source,
+	} {
+		if _, err := artifact.Upload(ctx, db, objects, 1, "web@1.0.0", name, "", []byte(body)); err != nil {
+			t.Fatalf("Upload %s: %v", name, err)
+		}
+	}
+
+	frame := map[string]any{
+		"abs_path": "https://example.com/static/app.min.js?v=3",
+		"function": "a",
+		"lineno":   float64(1),
+		"colno":    float64(21),
+	}
+	event := map[string]any{
+		"release": "web@1.0.0",
+		"exception": map[string]any{"values": []any{
+			map[string]any{"type": "Error", "stacktrace": map[string]any{"frames": []any{frame}}},
+		}},
+	}
+	sym := artifact.NewSymbolicator(db, objects)
+	changed, err := sym.Symbolicate(ctx, 1, event)
+	if err != nil || !changed {
+		t.Fatalf("Symbolicate: changed=%v err=%v", changed, err)
+	}
+	if frame["abs_path"] != "https://example.com/static/src/app.js" || frame["filename"] != "../src/app.js" ||
+		frame["lineno"] != 2 || frame["colno"] != 3 || frame["function"] != "a" {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+	if frame["context_line"] != "  throw new Error(name);" {
+		t.Fatalf("unexpected context %+v", frame)
+	}
+	data := frame["data"].(map[string]any)
+	if data["sourcemap"] != "~/static/maps/app.min.js.map" || data["minified"].(map[string]any)["colno"] != 21 {
+		t.Fatalf("unexpected frame data %+v", data)
+	}
+	if changed, _ := sym.Symbolicate(ctx, 1, event); changed {
+		t.Fatalf("expected symbolicated frames to be left alone")
+	}
+
+	// Another release has no artifacts.
+	event["release"] = "web@2.0.0"
+	frame["data"] = nil
+	if changed, err := sym.Symbolicate(ctx, 1, event); changed || err != nil {
+		t.Fatalf("unexpected symbolication for other release: changed=%v err=%v", changed, err)
+	}
+}
+
+const mapping = `# compiler: R8
+# pg_map_id: 5b46fdc
+com.example.app.MainActivity -> a.a:
+    2:3:void com.example.app.Util.check(int):40:41 -> b
+    2:3:void handle(int):20 -> b
+    4:4:void handle(int):22:22 -> b
+com.example.app.BadState -> a.c:
+`
+
+func TestDeobfuscate(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	objects, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	ctx := context.Background()
+	row, err := artifact.Upload(ctx, db, objects, 1, "app@1.0", "~/mapping.txt", "", []byte(mapping))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if row.Type != artifact.TypeProguard || row.DebugID != "5b46fdc" {
+		t.Fatalf("unexpected artifact %+v", row)
+	}
+	if _, err := artifact.Upload(ctx, db, objects, 1, "app@1.0", "app.android-arm64.symbols", "", []byte("not elf")); !errors.Is(err, artifact.ErrInvalid) {
+		t.Fatalf("Upload invalid symbols err=%v", err)
+	}
+
+	exception := map[string]any{
+		"type":   "c",
+		"module": "a",
+		"stacktrace": map[string]any{"frames": []any{
+			map[string]any{"module": "a.a", "function": "b", "filename": "SourceFile", "lineno": float64(3), "in_app": true},
+		}},
+	}
+	event := map[string]any{
+		"platform":  "java",
+		"release":   "app@1.0",
+		"exception": map[string]any{"values": []any{exception}},
+	}
+	deob := artifact.NewDeobfuscator(db, objects)
+	changed, err := deob.Event(ctx, 1, event)
+	if err != nil || !changed {
+		t.Fatalf("Event: changed=%v err=%v", changed, err)
+	}
+	if exception["module"] != "com.example.app" || exception["type"] != "BadState" ||
+		exception["obfuscated"].(map[string]any)["type"] != "c" {
+		t.Fatalf("unexpected exception %+v", exception)
+	}
+	frames := exception["stacktrace"].(map[string]any)["frames"].([]any)
+	if len(frames) != 2 {
+		t.Fatalf("expected the inlined frame to expand, got %+v", frames)
+	}
+	outer, inner := frames[0].(map[string]any), frames[1].(map[string]any)
+	if outer["module"] != "com.example.app.MainActivity" || outer["function"] != "handle" || outer["lineno"] != 20 || outer["in_app"] != true {
+		t.Fatalf("unexpected outer frame %+v", outer)
+	}
+	if inner["module"] != "com.example.app.Util" || inner["function"] != "check" || inner["lineno"] != 41 {
+		t.Fatalf("unexpected inner frame %+v", inner)
+	}
+	if orig := inner["data"].(map[string]any)["obfuscated"].(map[string]any); orig["module"] != "a.a" || orig["lineno"] != 3 {
+		t.Fatalf("unexpected original frame %+v", orig)
+	}
+	if changed, _ := deob.Event(ctx, 1, event); changed {
+		t.Fatalf("expected deobfuscated frames to be left alone")
+	}
+
+	trace := "a.c: boom\n\tat a.a.b(SourceFile:4)"
+	fields := map[string]any{"stack": trace, "count": float64(1)}
+	changed, err = deob.Fields(ctx, 1, "app@1.0", fields)
+	if err != nil || !changed {
+		t.Fatalf("Fields: changed=%v err=%v", changed, err)
+	}
+	if fields["stack"] != "com.example.app.BadState: boom\n\tat com.example.app.MainActivity.handle(MainActivity.java:22)" ||
+		fields["stack_obfuscated"] != trace {
+		t.Fatalf("unexpected fields %+v", fields)
+	}
+
+	// Without an upload for the release nothing changes.
+	fields = map[string]any{"stack": trace}
+	if changed, err := deob.Fields(ctx, 1, "app@2.0", fields); changed || err != nil {
+		t.Fatalf("unexpected rewrite for other release: changed=%v err=%v", changed, err)
+	}
+}
+
+func TestUploadReplaceAndDelete(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	objects, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	ctx := context.Background()
+
+	first, err := artifact.Upload(ctx, db, objects, 1, "1.0", "~/a.js.map", "", []byte("v1"))
+	if err != nil || first.Type != artifact.TypeSourceMap || first.Size != 2 {
+		t.Fatalf("Upload: %+v err=%v", first, err)
+	}
+	second, err := artifact.Upload(ctx, db, objects, 1, "1.0", "~/a.js.map", "", []byte("v2"))
+	if err != nil || second.ID != first.ID || second.SHA1 == first.SHA1 {
+		t.Fatalf("re-Upload: %+v err=%v", second, err)
+	}
+	if _, err := objects.Get(ctx, "artifacts/1/"+first.SHA1); err == nil {
+		t.Fatalf("expected replaced object to be deleted")
+	}
+
+	rows, err := store.ListReleaseArtifacts(ctx, db, 1, "1.0")
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("ListReleaseArtifacts: %+v err=%v", rows, err)
+	}
+	if err := artifact.Delete(ctx, db, objects, rows[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := objects.Get(ctx, "artifacts/1/"+second.SHA1); err == nil {
+		t.Fatalf("expected object to be deleted")
+	}
+}
@@ -0,0 +1,492 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/dartsym"
+	"github.com/aak1247/logtap/internal/proguard"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+const (
+	// Mappings and symbol files are large; only a few are kept parsed.
+	maxCachedMappings = 8
+	maxCachedSymbols  = 4
+	// missingTTL is how long a lookup that found no artifact is remembered,
+	// so apps without uploads cost one query a minute rather than one per
+	// message. An upload takes effect after at most this long.
+	missingTTL = time.Minute
+)
+
+// Deobfuscator maps obfuscated Android (ProGuard/R8) and Flutter
+// (--split-debug-info) stack traces back to their original names with the
+// mappings and symbol files uploaded for a project. It is applied on ingest,
+// so the stored event or log carries the readable trace and the original is
+// kept next to it.
+type Deobfuscator struct {
+	DB      *gorm.DB
+	Objects archive.ObjectStore
+
+	mu       sync.Mutex
+	mappings map[string]*proguard.Mapping // by object key; content-addressed
+	symbols  map[string]*dartsym.File     // by object key
+	missing  map[string]time.Time         // lookup -> expiry
+}
+
+func NewDeobfuscator(db *gorm.DB, objects archive.ObjectStore) *Deobfuscator {
+	return &Deobfuscator{DB: db, Objects: objects}
+}
+
+// Event rewrites event in place. Java frames (module and function) are
+// retraced with the ProGuard mapping uploaded for the event's release, frames
+// R8 inlined expanding into several; native frames of a Flutter app
+// (instruction_addr in an image of debug_meta) are symbolized with the Dart
+// symbol file whose build id is the image's code_id. Each rewritten frame
+// keeps the original under data.obfuscated, and exception types map back to
+// their original class with the obfuscated one under "obfuscated". It
+// reports whether anything changed; err is the first failure to load an
+// artifact.
+func (d *Deobfuscator) Event(ctx context.Context, projectID int, event map[string]any) (bool, error) {
+	if d == nil || d.DB == nil || d.Objects == nil || event == nil {
+		return false, nil
+	}
+	release, _ := event["release"].(string)
+	platform, _ := event["platform"].(string)
+	r := &deobRun{d: d, ctx: ctx, projectID: projectID, release: strings.TrimSpace(release), files: map[string]*dartsym.File{}}
+	images := debugImages(event)
+	java := platform == "java" || platform == "android"
+
+	changed := false
+	for _, st := range stacktraces(event) {
+		raw, _ := st["frames"].([]any)
+		out := make([]any, 0, len(raw))
+		stChanged := false
+		for _, f := range raw {
+			fm, ok := f.(map[string]any)
+			if data, _ := fm["data"].(map[string]any); !ok || data["obfuscated"] != nil {
+				out = append(out, f)
+				continue
+			}
+			var expanded []map[string]any
+			if fp, _ := fm["platform"].(string); fp == "java" || fp == "" && java {
+				expanded = r.javaFrame(fm)
+			} else if fm["instruction_addr"] != nil {
+				expanded = r.nativeFrame(fm, images)
+			}
+			if expanded == nil {
+				out = append(out, f)
+				continue
+			}
+			for _, e := range expanded {
+				out = append(out, e)
+			}
+			stChanged = true
+		}
+		if stChanged {
+			st["frames"] = out
+			changed = true
+		}
+	}
+	if java && r.exceptionTypes(event) {
+		changed = true
+	}
+	return changed, r.err
+}
+
+// Fields rewrites the top-level string fields of a log that hold a Java or
+// non-symbolic Dart stack trace, keeping the original under "<key>_obfuscated".
+// Java traces need the log's release to find the mapping; Dart traces carry
+// the build id of their symbol file.
+func (d *Deobfuscator) Fields(ctx context.Context, projectID int, release string, fields map[string]any) (bool, error) {
+	if d == nil || d.DB == nil || d.Objects == nil || len(fields) == 0 {
+		return false, nil
+	}
+	r := &deobRun{d: d, ctx: ctx, projectID: projectID, release: strings.TrimSpace(release), files: map[string]*dartsym.File{}}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	changed := false
+	for _, k := range keys {
+		s, ok := fields[k].(string)
+		if !ok || strings.HasSuffix(k, "_obfuscated") {
+			continue
+		}
+		if _, done := fields[k+"_obfuscated"]; done {
+			continue
+		}
+		out, ok := r.text(s)
+		if !ok {
+			continue
+		}
+		fields[k+"_obfuscated"] = s
+		fields[k] = out
+		changed = true
+	}
+	return changed, r.err
+}
+
+// deobRun caches lookups for one event or log.
+type deobRun struct {
+	d         *Deobfuscator
+	ctx       context.Context
+	projectID int
+	release   string
+
+	mapping       *proguard.Mapping
+	mappingLoaded bool
+	files         map[string]*dartsym.File // by build id
+	err           error
+}
+
+func (r *deobRun) fail(err error) {
+	if r.err == nil && err != nil {
+		r.err = err
+	}
+}
+
+func (r *deobRun) javaMapping() *proguard.Mapping {
+	if !r.mappingLoaded {
+		r.mappingLoaded = true
+		if r.release != "" {
+			m, err := r.d.loadMapping(r.ctx, r.projectID, r.release)
+			r.fail(err)
+			r.mapping = m
+		}
+	}
+	return r.mapping
+}
+
+func (r *deobRun) dart(buildID string) *dartsym.File {
+	f, ok := r.files[buildID]
+	if !ok {
+		var err error
+		f, err = r.d.loadSymbols(r.ctx, r.projectID, buildID)
+		r.fail(err)
+		r.files[buildID] = f
+	}
+	return f
+}
+
+func (r *deobRun) text(s string) (string, bool) {
+	if id, ok := dartsym.TraceBuildID(s); ok {
+		if f := r.dart(id); f != nil {
+			return f.Rewrite(s)
+		}
+		return s, false
+	}
+	if proguard.LooksLikeTrace(s) {
+		if m := r.javaMapping(); m != nil {
+			return m.RetraceText(s)
+		}
+	}
+	return s, false
+}
+
+// javaFrame retraces a frame; the result is outermost first, the order of
+// frames in a stack trace.
+func (r *deobRun) javaFrame(fm map[string]any) []map[string]any {
+	module, _ := fm["module"].(string)
+	function, _ := fm["function"].(string)
+	if module == "" || function == "" {
+		return nil
+	}
+	m := r.javaMapping()
+	if m == nil {
+		return nil
+	}
+	filename, _ := fm["filename"].(string)
+	line, _ := toInt(fm["lineno"])
+	frames, ok := m.Retrace(proguard.Frame{Class: module, Method: function, File: filename, Line: line})
+	if !ok {
+		return nil
+	}
+	orig := map[string]any{"module": module, "function": function}
+	if filename != "" {
+		orig["filename"] = filename
+	}
+	if line > 0 {
+		orig["lineno"] = line
+	}
+	out := make([]map[string]any, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		nf := rewrittenFrame(fm, orig)
+		nf["module"] = f.Class
+		nf["function"] = f.Method
+		nf["filename"] = f.File
+		if f.Line > 0 {
+			nf["lineno"] = f.Line
+		} else {
+			delete(nf, "lineno")
+		}
+		out = append(out, nf)
+	}
+	return out
+}
+
+type debugImage struct {
+	codeID string
+	addr   uint64
+	size   uint64
+}
+
+// nativeFrame symbolizes a frame of a Dart AOT snapshot.
+func (r *deobRun) nativeFrame(fm map[string]any, images []debugImage) []map[string]any {
+	addr, ok := parseAddr(fm["instruction_addr"])
+	if !ok {
+		return nil
+	}
+	var img *debugImage
+	for i := range images {
+		im := &images[i]
+		if im.addr <= addr && (im.size == 0 || addr < im.addr+im.size) && (img == nil || im.addr > img.addr) {
+			img = im
+		}
+	}
+	if img == nil || img.codeID == "" {
+		return nil
+	}
+	f := r.dart(img.codeID)
+	if f == nil {
+		return nil
+	}
+	frames := f.Symbolize(addr - img.addr)
+	if len(frames) == 0 {
+		return nil
+	}
+	orig := map[string]any{"instruction_addr": fm["instruction_addr"]}
+	if fn, _ := fm["function"].(string); fn != "" {
+		orig["function"] = fn
+	}
+	out := make([]map[string]any, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		nf := rewrittenFrame(fm, orig)
+		nf["function"] = f.Function
+		if f.File != "" {
+			nf["abs_path"] = f.File
+			nf["filename"] = dartFileName(f.File)
+			nf["in_app"] = !strings.HasPrefix(f.File, "dart:") && !strings.HasPrefix(f.File, "org-dartlang-sdk:") && !strings.HasPrefix(f.File, "package:flutter/")
+		}
+		if f.Line > 0 {
+			nf["lineno"] = f.Line
+		}
+		out = append(out, nf)
+	}
+	return out
+}
+
+// exceptionTypes maps obfuscated exception classes back to their names.
+func (r *deobRun) exceptionTypes(event map[string]any) bool {
+	container, _ := event["exception"].(map[string]any)
+	values, _ := container["values"].([]any)
+	changed := false
+	for _, v := range values {
+		vm, _ := v.(map[string]any)
+		typ, _ := vm["type"].(string)
+		if typ == "" || vm["obfuscated"] != nil {
+			continue
+		}
+		m := r.javaMapping()
+		if m == nil {
+			return changed
+		}
+		module, _ := vm["module"].(string)
+		cls := typ
+		if module != "" {
+			cls = module + "." + typ
+		}
+		name, ok := m.Class(cls)
+		if !ok {
+			continue
+		}
+		vm["obfuscated"] = map[string]any{"module": module, "type": typ}
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			vm["module"], vm["type"] = name[:i], name[i+1:]
+		} else {
+			delete(vm, "module")
+			vm["type"] = name
+		}
+		changed = true
+	}
+	return changed
+}
+
+// rewrittenFrame copies fm without what described the obfuscated location,
+// recording orig under data.obfuscated.
+func rewrittenFrame(fm, orig map[string]any) map[string]any {
+	nf := make(map[string]any, len(fm)+1)
+	for k, v := range fm {
+		switch k {
+		case "pre_context", "context_line", "post_context", "colno", "symbol":
+			continue
+		}
+		nf[k] = v
+	}
+	data := map[string]any{}
+	if old, ok := fm["data"].(map[string]any); ok {
+		for k, v := range old {
+			data[k] = v
+		}
+	}
+	data["obfuscated"] = orig
+	nf["data"] = data
+	return nf
+}
+
+// stacktraces returns the exception, thread and top-level stack traces.
+func stacktraces(event map[string]any) []map[string]any {
+	var out []map[string]any
+	for _, key := range []string{"exception", "threads"} {
+		container, _ := event[key].(map[string]any)
+		values, _ := container["values"].([]any)
+		for _, v := range values {
+			vm, _ := v.(map[string]any)
+			if st, ok := vm["stacktrace"].(map[string]any); ok {
+				out = append(out, st)
+			}
+		}
+	}
+	if st, ok := event["stacktrace"].(map[string]any); ok {
+		out = append(out, st)
+	}
+	return out
+}
+
+func debugImages(event map[string]any) []debugImage {
+	meta, _ := event["debug_meta"].(map[string]any)
+	raw, _ := meta["images"].([]any)
+	var out []debugImage
+	for _, v := range raw {
+		im, _ := v.(map[string]any)
+		codeID, _ := im["code_id"].(string)
+		addr, ok := parseAddr(im["image_addr"])
+		if !ok {
+			continue
+		}
+		size, _ := toInt(im["image_size"])
+		out = append(out, debugImage{codeID: strings.ToLower(codeID), addr: addr, size: uint64(max(size, 0))})
+	}
+	return out
+}
+
+// parseAddr reads an address sent as "0x..." or as a number.
+func parseAddr(v any) (uint64, bool) {
+	switch a := v.(type) {
+	case string:
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(a), "0x"), 16, 64)
+		return n, err == nil
+	case float64:
+		return uint64(a), a >= 0
+	}
+	return 0, false
+}
+
+func dartFileName(file string) string {
+	if i := strings.LastIndexByte(file, '/'); i >= 0 {
+		return file[i+1:]
+	}
+	return file
+}
+
+func (d *Deobfuscator) loadMapping(ctx context.Context, projectID int, release string) (*proguard.Mapping, error) {
+	key := fmt.Sprintf("proguard/%d/%s", projectID, release)
+	if d.isMissing(key) {
+		return nil, nil
+	}
+	art, found, err := store.GetLatestReleaseArtifactOfType(ctx, d.DB, projectID, release, TypeProguard)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		d.setMissing(key)
+		return nil, nil
+	}
+	d.mu.Lock()
+	m, ok := d.mappings[art.ObjectKey]
+	d.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+	body, err := Read(ctx, d.Objects, art)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", art.Name, err)
+	}
+	if m, err = proguard.Parse(bytes.NewReader(body)); err != nil {
+		return nil, fmt.Errorf("%s: %w", art.Name, err)
+	}
+	d.mu.Lock()
+	if d.mappings == nil || len(d.mappings) >= maxCachedMappings {
+		d.mappings = map[string]*proguard.Mapping{}
+	}
+	d.mappings[art.ObjectKey] = m
+	d.mu.Unlock()
+	return m, nil
+}
+
+func (d *Deobfuscator) loadSymbols(ctx context.Context, projectID int, buildID string) (*dartsym.File, error) {
+	key := fmt.Sprintf("dart/%d/%s", projectID, buildID)
+	if d.isMissing(key) {
+		return nil, nil
+	}
+	art, found, err := store.GetArtifactByDebugID(ctx, d.DB, projectID, TypeDartSymbols, buildID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		d.setMissing(key)
+		return nil, nil
+	}
+	d.mu.Lock()
+	f, ok := d.symbols[art.ObjectKey]
+	d.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+	body, err := Read(ctx, d.Objects, art)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", art.Name, err)
+	}
+	if f, err = dartsym.Open(body); err != nil {
+		return nil, fmt.Errorf("%s: %w", art.Name, err)
+	}
+	d.mu.Lock()
+	if d.symbols == nil || len(d.symbols) >= maxCachedSymbols {
+		d.symbols = map[string]*dartsym.File{}
+	}
+	d.symbols[art.ObjectKey] = f
+	d.mu.Unlock()
+	return f, nil
+}
+
+func (d *Deobfuscator) isMissing(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.missing[key]
+	if ok && time.Now().After(until) {
+		delete(d.missing, key)
+		return false
+	}
+	return ok
+}
+
+func (d *Deobfuscator) setMissing(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.missing == nil || len(d.missing) >= 10000 {
+		d.missing = map[string]time.Time{}
+	}
+	d.missing[key] = time.Now().Add(missingTTL)
+}
@@ -0,0 +1,354 @@
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/sourcemap"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// maxCachedMaps bounds the parsed source maps kept in memory.
+const maxCachedMaps = 64
+
+// Symbolicator resolves minified JavaScript frames with the source maps
+// uploaded for the event's release.
+type Symbolicator struct {
+	DB      *gorm.DB
+	Objects archive.ObjectStore
+	// ContextLines is how many lines around each frame are attached.
+	ContextLines int
+
+	mu    sync.Mutex
+	cache map[string]*sourcemap.Map // by object key; content-addressed
+}
+
+func NewSymbolicator(db *gorm.DB, objects archive.ObjectStore) *Symbolicator {
+	return &Symbolicator{DB: db, Objects: objects, ContextLines: 5}
+}
+
+// Symbolicate rewrites the frames of event's stack traces in place: file,
+// line, column and (when the map names it) function are replaced by their
+// original values, context lines are attached, and the minified location is
+// kept under frame.data.minified. It reports whether a frame changed; err is
+// the first failure to load an artifact, other frames are still resolved.
+func (s *Symbolicator) Symbolicate(ctx context.Context, projectID int, event map[string]any) (bool, error) {
+	if s == nil || s.DB == nil || s.Objects == nil {
+		return false, nil
+	}
+	release, _ := event["release"].(string)
+	if strings.TrimSpace(release) == "" {
+		return false, nil
+	}
+	run := &run{s: s, projectID: projectID, release: release, maps: map[string]*resolved{}, sources: map[string]*string{}}
+	changed := false
+	for _, frame := range eventFrames(event) {
+		if run.frame(ctx, frame) {
+			changed = true
+		}
+	}
+	return changed, run.err
+}
+
+// eventFrames returns the frames of the exception, thread and top-level
+// stack traces.
+func eventFrames(event map[string]any) []map[string]any {
+	var out []map[string]any
+	add := func(st any) {
+		m, _ := st.(map[string]any)
+		raw, _ := m["frames"].([]any)
+		for _, f := range raw {
+			if fm, ok := f.(map[string]any); ok {
+				out = append(out, fm)
+			}
+		}
+	}
+	for _, key := range []string{"exception", "threads"} {
+		container, _ := event[key].(map[string]any)
+		values, _ := container["values"].([]any)
+		for _, v := range values {
+			vm, _ := v.(map[string]any)
+			add(vm["stacktrace"])
+		}
+	}
+	add(event["stacktrace"])
+	return out
+}
+
+// run caches lookups for one event.
+type run struct {
+	s         *Symbolicator
+	projectID int
+	release   string
+	maps      map[string]*resolved
+	sources   map[string]*string
+	err       error
+}
+
+type resolved struct {
+	m *sourcemap.Map
+	// url is where the map lives; sources resolve relative to it.
+	url  string
+	name string
+}
+
+func (r *run) fail(err error) {
+	if r.err == nil && err != nil {
+		r.err = err
+	}
+}
+
+func (r *run) frame(ctx context.Context, frame map[string]any) bool {
+	if data, _ := frame["data"].(map[string]any); data["symbolicated"] == true {
+		return false
+	}
+	absPath, _ := frame["abs_path"].(string)
+	if absPath == "" {
+		absPath, _ = frame["filename"].(string)
+	}
+	line, okLine := toInt(frame["lineno"])
+	col, okCol := toInt(frame["colno"])
+	if absPath == "" || !okLine || !okCol || line <= 0 || col <= 0 {
+		return false
+	}
+
+	res, ok := r.maps[absPath]
+	if !ok {
+		var err error
+		res, err = r.resolve(ctx, absPath)
+		r.fail(err)
+		r.maps[absPath] = res
+	}
+	if res == nil {
+		return false
+	}
+	pos, ok := res.m.Lookup(line-1, col-1)
+	if !ok {
+		return false
+	}
+
+	minified := map[string]any{"abs_path": absPath, "lineno": line, "colno": col}
+	if fn, _ := frame["function"].(string); fn != "" {
+		minified["function"] = fn
+	}
+	sourceURL := resolveRef(res.url, pos.Source)
+	frame["abs_path"] = sourceURL
+	frame["filename"] = displayName(pos.Source)
+	frame["lineno"] = pos.Line + 1
+	frame["colno"] = pos.Column + 1
+	if pos.Name != "" {
+		frame["function"] = pos.Name
+	}
+	if strings.Contains(pos.Source, "/node_modules/") {
+		frame["in_app"] = false
+	}
+
+	content := pos.Content
+	if content == nil {
+		content = r.source(ctx, sourceURL)
+	}
+	if content != nil {
+		if pre, cur, post, ok := sourcemap.ContextLines(*content, pos.Line, r.s.ContextLines); ok {
+			frame["pre_context"] = pre
+			frame["context_line"] = cur
+			frame["post_context"] = post
+		}
+	}
+
+	data, _ := frame["data"].(map[string]any)
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["symbolicated"] = true
+	data["sourcemap"] = res.name
+	data["minified"] = minified
+	frame["data"] = data
+	return true
+}
+
+// resolve finds the source map for a minified file: the one its
+// sourceMappingURL comment names (inline data URLs included) when the file
+// was uploaded, otherwise "<file>.map".
+func (r *run) resolve(ctx context.Context, absPath string) (*resolved, error) {
+	mapURL := stripQuery(absPath) + ".map"
+	bundle, found, err := store.GetReleaseArtifactByNames(ctx, r.s.DB, r.projectID, r.release, CandidateNames(absPath))
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		body, err := Read(ctx, r.s.Objects, bundle)
+		if err != nil {
+			return nil, err
+		}
+		if ref := sourceMappingURL(body); ref != "" {
+			if strings.HasPrefix(ref, "data:") {
+				m, err := r.s.parseCached(bundle.ObjectKey+"#inline", func() ([]byte, error) { return decodeDataURL(ref) })
+				if err != nil {
+					return nil, err
+				}
+				return &resolved{m: m, url: absPath, name: bundle.Name}, nil
+			}
+			mapURL = resolveRef(absPath, ref)
+		}
+	}
+
+	art, found, err := store.GetReleaseArtifactByNames(ctx, r.s.DB, r.projectID, r.release, CandidateNames(mapURL))
+	if err != nil || !found {
+		return nil, err
+	}
+	m, err := r.s.parseCached(art.ObjectKey, func() ([]byte, error) { return Read(ctx, r.s.Objects, art) })
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", art.Name, err)
+	}
+	return &resolved{m: m, url: mapURL, name: art.Name}, nil
+}
+
+// source loads an uploaded original source for maps without sourcesContent.
+func (r *run) source(ctx context.Context, sourceURL string) *string {
+	if c, ok := r.sources[sourceURL]; ok {
+		return c
+	}
+	var out *string
+	art, found, err := store.GetReleaseArtifactByNames(ctx, r.s.DB, r.projectID, r.release, CandidateNames(sourceURL))
+	r.fail(err)
+	if found {
+		body, err := Read(ctx, r.s.Objects, art)
+		r.fail(err)
+		if err == nil {
+			text := string(body)
+			out = &text
+		}
+	}
+	r.sources[sourceURL] = out
+	return out
+}
+
+func (s *Symbolicator) parseCached(key string, load func() ([]byte, error)) (*sourcemap.Map, error) {
+	s.mu.Lock()
+	m, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+	body, err := load()
+	if err != nil {
+		return nil, err
+	}
+	m, err = sourcemap.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.cache == nil || len(s.cache) >= maxCachedMaps {
+		s.cache = map[string]*sourcemap.Map{}
+	}
+	s.cache[key] = m
+	s.mu.Unlock()
+	return m, nil
+}
+
+// CandidateNames lists the artifact names a file URL may have been uploaded
+// under: the URL itself, without query and fragment, and as "~/path".
+func CandidateNames(fileURL string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(s string) {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	add(fileURL)
+	clean := stripQuery(fileURL)
+	add(clean)
+	if u, err := url.Parse(clean); err == nil && u.Path != "" {
+		p := u.Path
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		add("~" + p)
+	}
+	return out
+}
+
+func stripQuery(s string) string {
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// resolveRef resolves ref against base like a browser would.
+func resolveRef(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// displayName turns "webpack://app/./src/a.js" into "./src/a.js".
+func displayName(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || u.Scheme == "" {
+		return source
+	}
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// sourceMappingURL returns the last sourceMappingURL comment in a generated
+// file, looking only at its tail.
+func sourceMappingURL(body []byte) string {
+	const tail = 64 << 10
+	if len(body) > tail {
+		body = body[len(body)-tail:]
+	}
+	lines := bytes.Split(body, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := strings.TrimSpace(string(lines[i]))
+		for _, prefix := range []string{"//# sourceMappingURL=", "//@ sourceMappingURL="} {
+			if strings.HasPrefix(l, prefix) {
+				return strings.TrimSpace(strings.TrimPrefix(l, prefix))
+			}
+		}
+	}
+	return ""
+}
+
+func decodeDataURL(ref string) ([]byte, error) {
+	comma := strings.IndexByte(ref, ',')
+	if comma < 0 {
+		return nil, errors.New("invalid data url")
+	}
+	meta, payload := ref[len("data:"):comma], ref[comma+1:]
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(payload)
+	}
+	s, err := url.PathUnescape(payload)
+	return []byte(s), err
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
@@ -2,11 +2,17 @@ package cleanup
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/obs"
+	"github.com/aak1247/logtap/internal/partition"
+	"github.com/aak1247/logtap/internal/retention"
 	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/timescale"
 	"gorm.io/gorm"
 )
 
@@ -18,6 +24,12 @@ type Worker struct {
 	MaxBatches      int
 	BatchSleep      time.Duration
 	Stats           *obs.Stats
+	// Partitions, when set, drops whole expired partitions before the
+	// per-project batched deletes run.
+	Partitions *partition.Manager
+	// Archiver exports expiring rows of archive-enabled projects before they
+	// are deleted. Such projects are skipped while it is nil.
+	Archiver *archive.Archiver
 }
 
 func NewWorker(db *gorm.DB) *Worker {
@@ -55,6 +67,22 @@ func (w *Worker) runOnce(ctx context.Context) error {
 	runCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
+	if w.Partitions != nil {
+		dropped, err := w.Partitions.DropExpired(runCtx, now)
+		for _, name := range dropped {
+			log.Printf("cleanup: dropped expired partition %s", name)
+		}
+		if err != nil {
+			log.Printf("cleanup: drop partitions: %v", err)
+		}
+	}
+
+	// Keep native Timescale retention aligned with policies and projects
+	// (a new project without a policy must switch chunk drops off).
+	if err := timescale.SyncRetention(runCtx, w.DB); err != nil {
+		log.Printf("cleanup: sync timescale retention: %v", err)
+	}
+
 	policies, err := store.ListCleanupPoliciesDue(runCtx, w.DB, now, w.Limit)
 	if err != nil {
 		log.Printf("cleanup: list due policies: %v", err)
@@ -64,102 +92,62 @@ func (w *Worker) runOnce(ctx context.Context) error {
 		if !p.Enabled {
 			continue
 		}
-		projectID := p.ProjectID
 		projectCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-		err := w.runPolicy(projectCtx, projectID, p.LogsRetentionDays, p.EventsRetentionDays, p.TrackEventsRetentionDays, p.ScheduleHourUTC, p.ScheduleMinuteUTC)
+		err := w.runPolicy(projectCtx, p)
 		cancel()
 		if err != nil {
-			log.Printf("cleanup: project=%d: %v", projectID, err)
+			log.Printf("cleanup: project=%d: %v", p.ProjectID, err)
 		}
 	}
 	return nil
 }
 
-func (w *Worker) runPolicy(ctx context.Context, projectID int, logsDays int, eventsDays int, trackEventsDays int, hourUTC int, minuteUTC int) error {
+func (w *Worker) runPolicy(ctx context.Context, p model.CleanupPolicy) error {
+	projectID := p.ProjectID
 	now := time.Now().UTC()
-	maxBatches := w.MaxBatches
-	if maxBatches <= 0 {
-		maxBatches = 1
-	}
-	batchSize := w.DeleteBatchSize
-	if batchSize <= 0 {
-		batchSize = 5000
-	}
 
 	incomplete := false
-	if logsDays > 0 {
-		before := now.Add(-time.Duration(logsDays) * 24 * time.Hour)
-		var last int64
-		for i := 0; i < maxBatches; i++ {
-			n, err := store.DeleteLogsBeforeBatched(ctx, w.DB, projectID, before, batchSize)
-			if err != nil {
-				return err
-			}
-			if w.Stats != nil && n > 0 {
-				w.Stats.ObserveCleanupDeleted(n, 0)
-			}
-			last = n
-			if n == 0 {
-				break
-			}
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
-			if w.BatchSleep > 0 {
-				time.Sleep(w.BatchSleep)
-			}
+	var deleted int64
+	for _, t := range tables {
+		buckets, err := retention.Buckets(w.DB, p, t.name, now)
+		if err != nil {
+			return err
 		}
-		if last > 0 {
-			incomplete = true
+		if len(buckets) == 0 {
+			continue
 		}
-	}
-	if eventsDays > 0 {
-		before := now.Add(-time.Duration(eventsDays) * 24 * time.Hour)
-		var last int64
-		for i := 0; i < maxBatches; i++ {
-			n, err := store.DeleteEventsBeforeBatched(ctx, w.DB, projectID, before, batchSize)
-			if err != nil {
-				return err
-			}
-			if w.Stats != nil && n > 0 {
-				w.Stats.ObserveCleanupDeleted(0, n)
-			}
-			last = n
-			if n == 0 {
-				break
-			}
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
-			if w.BatchSleep > 0 {
-				time.Sleep(w.BatchSleep)
-			}
+		until, archived, err := w.archiveBefore(ctx, p, archive.Kind(t.name), buckets)
+		if err != nil {
+			return err
 		}
-		if last > 0 {
+		if !archived {
 			incomplete = true
 		}
-	}
-	if trackEventsDays > 0 {
-		before := now.Add(-time.Duration(trackEventsDays) * 24 * time.Hour)
-		var last int64
-		for i := 0; i < maxBatches; i++ {
-			n, err := store.DeleteTrackEventsBeforeBatched(ctx, w.DB, projectID, before, batchSize)
+		for _, b := range buckets {
+			before := b.Before
+			if until.Before(before) {
+				before = until
+			}
+			n, done, err := w.deleteBucket(ctx, projectID, t, b, before)
+			deleted += n
 			if err != nil {
 				return err
 			}
-			last = n
-			if n == 0 {
-				break
-			}
-			if ctx.Err() != nil {
-				return ctx.Err()
+			if !done {
+				incomplete = true
+				continue
 			}
-			if w.BatchSleep > 0 {
-				time.Sleep(w.BatchSleep)
+			if t.name == retention.TableTrackEvents {
+				if err := store.PruneAndRebuildTrackEventDailyForRetention(ctx, w.DB, projectID, before, b.Where, b.Args); err != nil {
+					return err
+				}
 			}
 		}
-		if last > 0 {
-			incomplete = true
+	}
+	if deleted > 0 {
+		// SQLite installs: hand freed pages back and keep the WAL small.
+		if err := store.CompactSQLite(ctx, w.DB); err != nil {
+			log.Printf("cleanup: project=%d: sqlite compact: %v", projectID, err)
 		}
 	}
 	if incomplete {
@@ -169,5 +157,76 @@ func (w *Worker) runPolicy(ctx context.Context, projectID int, logsDays int, eve
 		}
 		return store.MarkCleanupPolicyInProgress(ctx, w.DB, projectID, now, next)
 	}
-	return store.MarkCleanupPolicyRun(ctx, w.DB, projectID, now, hourUTC, minuteUTC)
+	return store.MarkCleanupPolicyRun(ctx, w.DB, projectID, now, p.ScheduleHourUTC, p.ScheduleMinuteUTC)
+}
+
+// table is a table the worker applies retention to.
+type table struct {
+	name string
+	// observe reports deleted rows to Stats (nil: not tracked).
+	observe func(s *obs.Stats, n int64)
+}
+
+var tables = []table{
+	{name: retention.TableLogs, observe: func(s *obs.Stats, n int64) { s.ObserveCleanupDeleted(n, 0) }},
+	{name: retention.TableEvents, observe: func(s *obs.Stats, n int64) { s.ObserveCleanupDeleted(0, n) }},
+	{name: retention.TableTrackEvents},
+}
+
+// deleteBucket deletes the bucket's rows older than before in at most
+// MaxBatches batches; done reports whether none are left.
+func (w *Worker) deleteBucket(ctx context.Context, projectID int, t table, b retention.Bucket, before time.Time) (int64, bool, error) {
+	maxBatches := w.MaxBatches
+	if maxBatches <= 0 {
+		maxBatches = 1
+	}
+	batchSize := w.DeleteBatchSize
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	var deleted int64
+	for i := 0; i < maxBatches; i++ {
+		n, err := store.DeleteRowsBeforeBatched(ctx, w.DB, t.name, projectID, before, b.Where, b.Args, batchSize)
+		if err != nil {
+			return deleted, false, err
+		}
+		if w.Stats != nil && t.observe != nil && n > 0 {
+			t.observe(w.Stats, n)
+		}
+		deleted += n
+		if n == 0 {
+			return deleted, true, nil
+		}
+		if ctx.Err() != nil {
+			return deleted, false, ctx.Err()
+		}
+		if w.BatchSleep > 0 {
+			time.Sleep(w.BatchSleep)
+		}
+	}
+	return deleted, false, nil
+}
+
+// archiveBefore returns the bound expired rows of kind may be deleted below.
+// For archive-enabled projects that is as far as the archiver got, which may
+// be short of the buckets' latest bound; archived reports whether it got all
+// the way.
+func (w *Worker) archiveBefore(ctx context.Context, p model.CleanupPolicy, kind archive.Kind, buckets []retention.Bucket) (time.Time, bool, error) {
+	latest := retention.Latest(buckets)
+	if !p.ArchiveEnabled {
+		return latest, true, nil
+	}
+	if w.Archiver == nil {
+		return time.Time{}, false, archive.ErrNoStore
+	}
+	until, err := w.Archiver.Archive(ctx, p.ProjectID, kind, buckets)
+	if err != nil {
+		if until.IsZero() {
+			return time.Time{}, false, fmt.Errorf("archive %s: %w", kind, err)
+		}
+		// Keep what was archived; the rest is retried on the next pass.
+		log.Printf("cleanup: project=%d: archive %s: %v", p.ProjectID, kind, err)
+	}
+	return until, !until.Before(latest), nil
 }
@@ -2,11 +2,15 @@ package cleanup
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/aak1247/logtap/internal/archive"
 	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/retention"
 	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/datatypes"
 )
 
 func TestWorkerRunPolicy_DoesNotDeleteTrackEventsWithLogsRetention(t *testing.T) {
@@ -40,7 +44,7 @@ func TestWorkerRunPolicy_DoesNotDeleteTrackEventsWithLogsRetention(t *testing.T)
 	w.MaxBatches = 5
 	w.DeleteBatchSize = 1000
 
-	if err := w.runPolicy(context.Background(), 1, 30, 0, 0, 3, 0); err != nil {
+	if err := w.runPolicy(context.Background(), model.CleanupPolicy{ProjectID: 1, Enabled: true, LogsRetentionDays: 30, ScheduleHourUTC: 3}); err != nil {
 		t.Fatalf("runPolicy: %v", err)
 	}
 
@@ -60,3 +64,97 @@ func TestWorkerRunPolicy_DoesNotDeleteTrackEventsWithLogsRetention(t *testing.T)
 		t.Fatalf("expected track_events kept, got %d", trackEvents)
 	}
 }
+
+func TestWorkerRunPolicy_ArchivesBeforeDeleting(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	if err := db.AutoMigrate(&model.CleanupPolicy{}, &model.ArchiveManifest{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+
+	old := time.Now().UTC().Add(-40 * 24 * time.Hour)
+	if err := db.Create(&model.Log{ProjectID: 1, Timestamp: old, Level: "info", Message: "old"}).Error; err != nil {
+		t.Fatalf("insert log: %v", err)
+	}
+	policy := model.CleanupPolicy{ProjectID: 1, Enabled: true, LogsRetentionDays: 30, ArchiveEnabled: true}
+
+	w := NewWorker(db)
+	if err := w.runPolicy(context.Background(), policy); err == nil {
+		t.Fatalf("expected error without an archive store")
+	}
+	var logs int64
+	db.Model(&model.Log{}).Where("project_id = ?", 1).Count(&logs)
+	if logs != 1 {
+		t.Fatalf("expected log kept while archiving is unavailable, got %d", logs)
+	}
+
+	objects, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	w.Archiver = archive.NewArchiver(db, objects)
+	if err := w.runPolicy(context.Background(), policy); err != nil {
+		t.Fatalf("runPolicy: %v", err)
+	}
+	db.Model(&model.Log{}).Where("project_id = ?", 1).Count(&logs)
+	if logs != 0 {
+		t.Fatalf("expected archived log deleted, got %d", logs)
+	}
+	var manifests []model.ArchiveManifest
+	if err := db.Find(&manifests).Error; err != nil {
+		t.Fatalf("list manifests: %v", err)
+	}
+	if len(manifests) != 1 || manifests[0].Kind != "logs" || manifests[0].Rows != 1 {
+		t.Fatalf("unexpected manifests: %+v", manifests)
+	}
+}
+
+func TestWorkerRunPolicy_RetentionRules(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	if err := db.AutoMigrate(&model.CleanupPolicy{}); err != nil {
+		t.Fatalf("AutoMigrate(CleanupPolicy): %v", err)
+	}
+	rules, err := retention.Encode([]model.RetentionRule{
+		{Field: "service", Value: "payments", Days: 365},
+		{Levels: []string{"error", "fatal"}, Days: 90},
+		{Levels: []string{"debug"}, Days: 2},
+	})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	now := time.Now().UTC()
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	seed := []model.Log{
+		{Message: "error-40", Level: "error", Timestamp: days(40)},
+		{Message: "error-100", Level: "ERROR", Timestamp: days(100)},
+		{Message: "info-10", Level: "info", Timestamp: days(10)},
+		{Message: "info-20", Level: "info", Timestamp: days(20)},
+		{Message: "debug-3", Level: "debug", Timestamp: days(3)},
+		{Message: "payments-debug-200", Level: "debug", Timestamp: days(200), Fields: datatypes.JSON(`{"service":"payments"}`)},
+		{Message: "other-debug-1", Level: "debug", Timestamp: days(1), Fields: datatypes.JSON(`{"service":"web"}`)},
+	}
+	for _, l := range seed {
+		l.ProjectID = 1
+		if l.Fields == nil {
+			l.Fields = datatypes.JSON(`{}`)
+		}
+		if err := db.Create(&l).Error; err != nil {
+			t.Fatalf("insert log: %v", err)
+		}
+	}
+
+	w := NewWorker(db)
+	policy := model.CleanupPolicy{ProjectID: 1, Enabled: true, LogsRetentionDays: 14, RetentionRules: rules}
+	if err := w.runPolicy(context.Background(), policy); err != nil {
+		t.Fatalf("runPolicy: %v", err)
+	}
+
+	var kept []string
+	if err := db.Model(&model.Log{}).Where("project_id = ?", 1).Order("message").Pluck("message", &kept).Error; err != nil {
+		t.Fatalf("list logs: %v", err)
+	}
+	want := []string{"error-40", "info-10", "other-debug-1", "payments-debug-200"}
+	if strings.Join(kept, ",") != strings.Join(want, ",") {
+		t.Fatalf("kept %v, want %v", kept, want)
+	}
+}
@@ -18,6 +18,8 @@ type Config struct {
 	NSQDAddress            string
 	NSQDHTTPAddress        string
 	PostgresURL            string
+	DBDriver               string
+	SQLitePath             string
 	RunConsumers           bool
 	RunAlertWorker         bool
 	NSQEventChannel        string
@@ -36,6 +38,19 @@ type Config struct {
 	CleanupDeleteBatchSize int
 	CleanupMaxBatches      int
 	CleanupBatchSleep      time.Duration
+	QuotaCheckInterval     time.Duration
+	LogMetricInterval      time.Duration
+	LogMetricDelay         time.Duration
+	SavedSearchInterval    time.Duration
+	ExportMaxBytes         int64
+	TailMaxStreams         int
+	TailMaxRate            int
+	LogPatterns            bool
+	LogPatternMax          int
+	QueryJobWorkers        int
+	QueryJobPerProject     int
+	QueryJobTimeout        time.Duration
+	QueryJobCacheTTL       time.Duration
 	RedisAddr              string
 	RedisPassword          string
 	RedisDB                int
@@ -51,6 +66,9 @@ type Config struct {
 	LogtapProxySecret      string
 	EnableDebugEndpoints   bool
 	DBRequireTimescale     bool
+	DBMigrateTimeout       time.Duration
+	PGPartitioning         string
+	PGPartitionPremake     int
 	DetectorPluginDirs     []string
 	RunMonitorWorker       bool
 	MonitorTickInterval    time.Duration
@@ -67,6 +85,26 @@ type Config struct {
 	AlertDeliveriesRetentionDays int
 	AlertStatesRetentionDays     int
 
+	// TimescaleDB policy defaults (seeded once, then managed via /api/admin/timescale).
+	TimescaleCompressAfterDays    int
+	TimescaleRetention            bool
+	TimescaleContinuousAggregates bool
+
+	// Cold archive tier (optional). Projects with archive_enabled export
+	// expiring rows here before retention deletes them.
+	ArchiveStore             string
+	ArchiveDir               string
+	ArchiveS3Endpoint        string
+	ArchiveS3Bucket          string
+	ArchiveS3Region          string
+	ArchiveS3AccessKeyID     string
+	ArchiveS3SecretAccessKey string
+
+	// Release artifacts (source maps and sources) used to symbolicate
+	// events. "s3" shares the ARCHIVE_S3_* endpoint and credentials.
+	ArtifactStore string
+	ArtifactDir   string
+
 	// Alerting / notifications (optional).
 	SMTPHost     string
 	SMTPPort     int
@@ -128,6 +166,8 @@ Optional: set AUTH_SECRET_FILE=/path/to/secret (file contains the base64 secret)
 		NSQDAddress:                  getenvDefault("NSQD_ADDRESS", "127.0.0.1:4150"),
 		NSQDHTTPAddress:              strings.TrimSpace(os.Getenv("NSQD_HTTP_ADDRESS")),
 		PostgresURL:                  strings.TrimSpace(os.Getenv("POSTGRES_URL")),
+		DBDriver:                     strings.ToLower(getenvDefault("DB_DRIVER", "postgres")),
+		SQLitePath:                   getenvDefault("SQLITE_PATH", "logtap.db"),
 		NSQEventChannel:              getenvDefault("NSQ_EVENT_CHANNEL", "event-consumer"),
 		NSQLogChannel:                getenvDefault("NSQ_LOG_CHANNEL", "log-consumer"),
 		NSQMaxInFlight:               parseIntDefault(getenvDefault("NSQ_MAX_IN_FLIGHT", "200"), 200),
@@ -144,6 +184,19 @@ Optional: set AUTH_SECRET_FILE=/path/to/secret (file contains the base64 secret)
 		CleanupDeleteBatchSize:       parseIntDefault(getenvDefault("CLEANUP_DELETE_BATCH_SIZE", "5000"), 5000),
 		CleanupMaxBatches:            parseIntDefault(getenvDefault("CLEANUP_MAX_BATCHES", "50"), 50),
 		CleanupBatchSleep:            parseDurationDefault(getenvDefault("CLEANUP_BATCH_SLEEP", "0s"), 0),
+		QuotaCheckInterval:           parseDurationDefault(getenvDefault("QUOTA_CHECK_INTERVAL", "5m"), 5*time.Minute),
+		LogMetricInterval:            parseDurationDefault(getenvDefault("LOG_METRIC_INTERVAL", "30s"), 30*time.Second),
+		LogMetricDelay:               parseDurationDefault(getenvDefault("LOG_METRIC_DELAY", "30s"), 30*time.Second),
+		SavedSearchInterval:          parseDurationDefault(getenvDefault("SAVED_SEARCH_INTERVAL", "1m"), time.Minute),
+		ExportMaxBytes:               int64(parseIntDefault(getenvDefault("EXPORT_MAX_BYTES", "1073741824"), 1<<30)),
+		TailMaxStreams:               parseIntDefault(getenvDefault("TAIL_MAX_STREAMS", "20"), 20),
+		TailMaxRate:                  parseIntDefault(getenvDefault("TAIL_MAX_RATE", "100"), 100),
+		LogPatterns:                  parseBoolDefault(getenvDefault("LOG_PATTERNS", "true"), true),
+		LogPatternMax:                parseIntDefault(getenvDefault("LOG_PATTERN_MAX", "2000"), 2000),
+		QueryJobWorkers:              parseIntDefault(getenvDefault("QUERY_JOB_WORKERS", "4"), 4),
+		QueryJobPerProject:           parseIntDefault(getenvDefault("QUERY_JOB_PROJECT_CONCURRENCY", "2"), 2),
+		QueryJobTimeout:              parseDurationDefault(getenvDefault("QUERY_JOB_TIMEOUT", "10m"), 10*time.Minute),
+		QueryJobCacheTTL:             parseDurationDefault(getenvDefault("QUERY_JOB_CACHE_TTL", "5m"), 5*time.Minute),
 		RedisAddr:                    strings.TrimSpace(os.Getenv("REDIS_ADDR")),
 		RedisPassword:                os.Getenv("REDIS_PASSWORD"),
 		RedisDB:                      parseIntDefault(getenvDefault("REDIS_DB", "0"), 0),
@@ -157,6 +210,9 @@ Optional: set AUTH_SECRET_FILE=/path/to/secret (file contains the base64 secret)
 		LogtapProxySecret:            strings.TrimSpace(os.Getenv("LOGTAP_PROXY_SECRET")),
 		EnableDebugEndpoints:         parseBoolDefault(getenvDefault("ENABLE_DEBUG_ENDPOINTS", "false"), false),
 		DBRequireTimescale:           parseBoolDefault(getenvDefault("DB_REQUIRE_TIMESCALE", "false"), false),
+		DBMigrateTimeout:             parseDurationDefault(getenvDefault("DB_MIGRATE_TIMEOUT", "30s"), 30*time.Second),
+		PGPartitioning:               strings.ToLower(getenvDefault("PG_PARTITIONING", "off")),
+		PGPartitionPremake:           parseIntDefault(getenvDefault("PG_PARTITION_PREMAKE", "7"), 7),
 		DetectorPluginDirs:           parseStringListEnv(getenvDefault("DETECTOR_PLUGIN_DIRS", "")),
 		RunMonitorWorker:             parseBoolDefault(getenvDefault("RUN_MONITOR_WORKER", "false"), false),
 		MonitorTickInterval:          parseDurationDefault(getenvDefault("MONITOR_TICK_INTERVAL", "2s"), 2*time.Second),
@@ -168,6 +224,21 @@ Optional: set AUTH_SECRET_FILE=/path/to/secret (file contains the base64 secret)
 		AlertDeliveriesRetentionDays: parseIntDefault(getenvDefault("ALERT_DELIVERIES_RETENTION_DAYS", "0"), 0),
 		AlertStatesRetentionDays:     parseIntDefault(getenvDefault("ALERT_STATES_RETENTION_DAYS", "0"), 0),
 
+		TimescaleCompressAfterDays:    parseIntDefault(getenvDefault("TIMESCALE_COMPRESS_AFTER_DAYS", "7"), 7),
+		TimescaleRetention:            parseBoolDefault(getenvDefault("TIMESCALE_RETENTION", "true"), true),
+		TimescaleContinuousAggregates: parseBoolDefault(getenvDefault("TIMESCALE_CONTINUOUS_AGGREGATES", "true"), true),
+
+		ArchiveStore:             strings.ToLower(strings.TrimSpace(os.Getenv("ARCHIVE_STORE"))),
+		ArchiveDir:               getenvDefault("ARCHIVE_DIR", "archive"),
+		ArchiveS3Endpoint:        strings.TrimSpace(os.Getenv("ARCHIVE_S3_ENDPOINT")),
+		ArchiveS3Bucket:          strings.TrimSpace(os.Getenv("ARCHIVE_S3_BUCKET")),
+		ArchiveS3Region:          getenvDefault("ARCHIVE_S3_REGION", "us-east-1"),
+		ArchiveS3AccessKeyID:     strings.TrimSpace(os.Getenv("ARCHIVE_S3_ACCESS_KEY_ID")),
+		ArchiveS3SecretAccessKey: os.Getenv("ARCHIVE_S3_SECRET_ACCESS_KEY"),
+
+		ArtifactStore: strings.ToLower(getenvDefault("ARTIFACT_STORE", "local")),
+		ArtifactDir:   getenvDefault("ARTIFACT_DIR", "artifacts"),
+
 		SMTPHost:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
 		SMTPPort:     parseIntDefault(getenvDefault("SMTP_PORT", "587"), 587),
 		SMTPFrom:     strings.TrimSpace(os.Getenv("SMTP_FROM")),
@@ -201,10 +272,38 @@ Optional: set AUTH_SECRET_FILE=/path/to/secret (file contains the base64 secret)
 	if cfg.NSQDHTTPAddress == "" {
 		cfg.NSQDHTTPAddress = deriveNSQDHTTPAddress(cfg.NSQDAddress)
 	}
-	if cfg.RunConsumers && cfg.PostgresURL == "" {
+	switch cfg.DBDriver {
+	case "postgres", "sqlite":
+	default:
+		return Config{}, fmt.Errorf("invalid DB_DRIVER %q (expected postgres|sqlite)", cfg.DBDriver)
+	}
+	switch cfg.PGPartitioning {
+	case "off", "day", "week":
+	default:
+		return Config{}, fmt.Errorf("invalid PG_PARTITIONING %q (expected off|day|week)", cfg.PGPartitioning)
+	}
+	switch cfg.ArchiveStore {
+	case "", "off", "local":
+	case "s3":
+		if cfg.ArchiveS3Endpoint == "" || cfg.ArchiveS3Bucket == "" {
+			return Config{}, errors.New("ARCHIVE_S3_ENDPOINT and ARCHIVE_S3_BUCKET are required when ARCHIVE_STORE=s3")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid ARCHIVE_STORE %q (expected off|local|s3)", cfg.ArchiveStore)
+	}
+	switch cfg.ArtifactStore {
+	case "off", "local":
+	case "s3":
+		if cfg.ArchiveS3Endpoint == "" || cfg.ArchiveS3Bucket == "" {
+			return Config{}, errors.New("ARCHIVE_S3_ENDPOINT and ARCHIVE_S3_BUCKET are required when ARTIFACT_STORE=s3")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid ARTIFACT_STORE %q (expected off|local|s3)", cfg.ArtifactStore)
+	}
+	if cfg.RunConsumers && !cfg.DatabaseConfigured() {
 		return Config{}, errors.New("POSTGRES_URL is required when RUN_CONSUMERS=true")
 	}
-	if cfg.RunAlertWorker && cfg.PostgresURL == "" {
+	if cfg.RunAlertWorker && !cfg.DatabaseConfigured() {
 		return Config{}, errors.New("POSTGRES_URL is required when RUN_ALERT_WORKER=true")
 	}
 	if cfg.NSQMaxInFlight <= 0 {
@@ -252,6 +351,51 @@ Optional: set AUTH_SECRET_FILE=/path/to/secret (file contains the base64 secret)
 	if cfg.CleanupBatchSleep < 0 {
 		cfg.CleanupBatchSleep = 0
 	}
+	if cfg.QuotaCheckInterval <= 0 {
+		cfg.QuotaCheckInterval = 5 * time.Minute
+	}
+	if cfg.LogMetricInterval <= 0 {
+		cfg.LogMetricInterval = 30 * time.Second
+	}
+	if cfg.LogMetricDelay < 0 {
+		cfg.LogMetricDelay = 0
+	}
+	if cfg.SavedSearchInterval <= 0 {
+		cfg.SavedSearchInterval = time.Minute
+	}
+	if cfg.ExportMaxBytes < 0 {
+		cfg.ExportMaxBytes = 0
+	}
+	if cfg.TailMaxStreams < 0 {
+		cfg.TailMaxStreams = 0
+	}
+	if cfg.TailMaxRate <= 0 {
+		cfg.TailMaxRate = 100
+	}
+	if cfg.LogPatternMax <= 0 {
+		cfg.LogPatternMax = 2000
+	}
+	if cfg.QueryJobWorkers <= 0 {
+		cfg.QueryJobWorkers = 4
+	}
+	if cfg.QueryJobPerProject <= 0 {
+		cfg.QueryJobPerProject = 2
+	}
+	if cfg.QueryJobTimeout <= 0 {
+		cfg.QueryJobTimeout = 10 * time.Minute
+	}
+	if cfg.QueryJobCacheTTL < 0 {
+		cfg.QueryJobCacheTTL = 0
+	}
+	if cfg.DBMigrateTimeout <= 0 {
+		cfg.DBMigrateTimeout = 30 * time.Second
+	}
+	if cfg.PGPartitionPremake <= 0 {
+		cfg.PGPartitionPremake = 7
+	}
+	if cfg.TimescaleCompressAfterDays < 0 {
+		cfg.TimescaleCompressAfterDays = 0
+	}
 	if cfg.AlertCleanupInterval <= 0 {
 		cfg.AlertCleanupInterval = time.Hour
 	}
@@ -324,6 +468,20 @@ func FromEnvAlertWorker() (Config, error) {
 	return cfg, nil
 }
 
+// UseSQLite reports whether the gateway should run on an embedded SQLite file
+// instead of Postgres (small installs, laptops, edge boxes).
+func (c Config) UseSQLite() bool {
+	return c.DBDriver == "sqlite"
+}
+
+// DatabaseConfigured reports whether a database backend is available.
+func (c Config) DatabaseConfigured() bool {
+	if c.UseSQLite() {
+		return strings.TrimSpace(c.SQLitePath) != ""
+	}
+	return c.PostgresURL != ""
+}
+
 func parseCIDRPrefixesEnv(raw string) []netip.Prefix {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
@@ -417,11 +575,12 @@ func decodeBase64Any(s string) ([]byte, error) {
 
 func (c Config) String() string {
 	return fmt.Sprintf(
-		"http=%s nsqd=%s nsqd_http=%s consumers=%v pg=%s redis=%s metrics=%v geoip=%v auth=%v maintenance=%v channels(events=%s logs=%s) nsq(max_in_flight=%d event_cc=%d log_cc=%d) db(max_open=%d max_idle=%d log_batch=%d/%s event_batch=%d/%s) cleanup(interval=%s limit=%d batch=%d max_batches=%d sleep=%s)",
+		"http=%s nsqd=%s nsqd_http=%s consumers=%v db=%s pg=%s redis=%s metrics=%v geoip=%v auth=%v maintenance=%v channels(events=%s logs=%s) nsq(max_in_flight=%d event_cc=%d log_cc=%d) db(max_open=%d max_idle=%d log_batch=%d/%s event_batch=%d/%s) cleanup(interval=%s limit=%d batch=%d max_batches=%d sleep=%s)",
 		c.HTTPAddr,
 		c.NSQDAddress,
 		c.NSQDHTTPAddress,
 		c.RunConsumers,
+		c.dbDescription(),
 		redactPostgresURL(c.PostgresURL),
 		redactRedis(c.RedisAddr),
 		c.EnableMetrics,
@@ -447,6 +606,16 @@ func (c Config) String() string {
 	)
 }
 
+func (c Config) dbDescription() string {
+	if c.UseSQLite() {
+		return "sqlite:" + c.SQLitePath
+	}
+	if c.DBDriver == "" {
+		return "postgres"
+	}
+	return c.DBDriver
+}
+
 func deriveNSQDHTTPAddress(tcpAddr string) string {
 	tcpAddr = strings.TrimSpace(tcpAddr)
 	if tcpAddr == "" {
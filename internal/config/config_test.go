@@ -19,6 +19,58 @@ func TestFromEnv_RequiresPostgresWhenConsumersEnabled(t *testing.T) {
 	}
 }
 
+func TestFromEnv_SQLiteDriverSatisfiesDatabaseRequirement(t *testing.T) {
+	t.Setenv("RUN_CONSUMERS", "true")
+	t.Setenv("POSTGRES_URL", "")
+	t.Setenv("DB_DRIVER", "SQLite")
+	t.Setenv("SQLITE_PATH", "/var/lib/logtap/logtap.db")
+	t.Setenv("NSQD_ADDRESS", "127.0.0.1:4150")
+	t.Setenv("AUTH_SECRET", base64.RawStdEncoding.EncodeToString(make([]byte, 32)))
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if !cfg.UseSQLite() || !cfg.DatabaseConfigured() {
+		t.Fatalf("expected sqlite backend, got driver=%q path=%q", cfg.DBDriver, cfg.SQLitePath)
+	}
+	if !strings.Contains(cfg.String(), "db=sqlite:/var/lib/logtap/logtap.db") {
+		t.Fatalf("expected sqlite in config summary, got %s", cfg.String())
+	}
+
+	t.Setenv("DB_DRIVER", "mysql")
+	if _, err := FromEnv(); err == nil {
+		t.Fatalf("expected error for unsupported DB_DRIVER")
+	}
+}
+
+func TestFromEnv_PGPartitioning(t *testing.T) {
+	t.Setenv("RUN_CONSUMERS", "false")
+	t.Setenv("NSQD_ADDRESS", "127.0.0.1:4150")
+	t.Setenv("AUTH_SECRET", base64.RawStdEncoding.EncodeToString(make([]byte, 32)))
+	t.Setenv("PG_PARTITIONING", "Week")
+	t.Setenv("PG_PARTITION_PREMAKE", "0")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if cfg.PGPartitioning != "week" {
+		t.Fatalf("expected PGPartitioning=week, got %q", cfg.PGPartitioning)
+	}
+	if cfg.PGPartitionPremake != 7 {
+		t.Fatalf("expected PGPartitionPremake clamped to 7, got %d", cfg.PGPartitionPremake)
+	}
+	if cfg.DBMigrateTimeout != 30*time.Second {
+		t.Fatalf("expected default DBMigrateTimeout, got %v", cfg.DBMigrateTimeout)
+	}
+
+	t.Setenv("PG_PARTITIONING", "month")
+	if _, err := FromEnv(); err == nil {
+		t.Fatalf("expected error for unsupported PG_PARTITIONING")
+	}
+}
+
 func TestFromEnv_DefaultsAndToggles(t *testing.T) {
 	t.Setenv("RUN_CONSUMERS", "false")
 	t.Setenv("POSTGRES_URL", "")
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/alert"
+	"github.com/aak1247/logtap/internal/artifact"
 	"github.com/aak1247/logtap/internal/config"
 	"github.com/aak1247/logtap/internal/enrich"
 	"github.com/aak1247/logtap/internal/identity"
@@ -15,7 +16,11 @@ import (
 	"github.com/aak1247/logtap/internal/metrics"
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/obs"
+	"github.com/aak1247/logtap/internal/pattern"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/quota"
 	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/tail"
 	"github.com/google/uuid"
 	"github.com/nsqio/go-nsq"
 	"gorm.io/gorm"
@@ -45,12 +50,14 @@ func NewNSQEventConsumer(ctx context.Context, cfg config.Config, db *gorm.DB, re
 	return c, nil
 }
 
-func NewNSQLogConsumer(ctx context.Context, cfg config.Config, db *gorm.DB, recorder *metrics.RedisRecorder, geoip *enrich.GeoIP, stats *obs.Stats) (*NSQConsumer, error) {
+// NewNSQLogConsumer consumes logs; tails, when not nil, receives every
+// stored batch for live tails.
+func NewNSQLogConsumer(ctx context.Context, cfg config.Config, db *gorm.DB, recorder *metrics.RedisRecorder, geoip *enrich.GeoIP, stats *obs.Stats, tails *tail.Hub) (*NSQConsumer, error) {
 	channel := cfg.NSQLogChannel
 	if channel == "" {
 		channel = "log-consumer"
 	}
-	handler, cleanup := handleLogMessage(cfg, db, recorder, geoip, stats)
+	handler, cleanup := handleLogMessage(cfg, db, recorder, geoip, stats, tails)
 	c, err := newConsumer(ctx, cfg, "logs", channel, cfg.NSQLogConcurrency, handler)
 	if err != nil {
 		if cleanup != nil {
@@ -102,6 +109,54 @@ func newConsumer(ctx context.Context, cfg config.Config, topic, channel string,
 	return &NSQConsumer{consumer: cons}, nil
 }
 
+// newDeobfuscator returns nil when there is no database or artifact store.
+func newDeobfuscator(cfg config.Config, db *gorm.DB) *artifact.Deobfuscator {
+	if db == nil {
+		return nil
+	}
+	objects, err := artifact.NewStore(cfg)
+	if err != nil {
+		log.Printf("consumer: artifact store: %v; stack traces will not be deobfuscated", err)
+		return nil
+	}
+	if objects == nil {
+		return nil
+	}
+	return artifact.NewDeobfuscator(db, objects)
+}
+
+// deobfuscateEvent rewrites obfuscated stack traces before the event is
+// stored; failures are logged and the event is kept as sent.
+func deobfuscateEvent(d *artifact.Deobfuscator, projectID string, event map[string]any) {
+	pid, err := project.ParseID(projectID)
+	if d == nil || err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := d.Event(ctx, pid, event); err != nil {
+		log.Printf("consumer: deobfuscate event: %v", err)
+	}
+}
+
+// deobfuscateLog rewrites stack traces in a log's fields; the release comes
+// from the "release" field or tag.
+func deobfuscateLog(d *artifact.Deobfuscator, projectID string, lp ingest.CustomLogPayload) {
+	pid, err := project.ParseID(projectID)
+	if d == nil || err != nil || len(lp.Fields) == 0 {
+		return
+	}
+	release, _ := lp.Fields["release"].(string)
+	if release == "" {
+		release = lp.Tags["release"]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := d.Fields(ctx, pid, release, lp.Fields); err != nil {
+		log.Printf("consumer: deobfuscate log: %v", err)
+	}
+}
+
 func connectToNSQDWithRetry(ctx context.Context, cons *nsq.Consumer, addr, topic, channel string) error {
 	const (
 		totalWait = 2 * time.Minute
@@ -138,17 +193,45 @@ func connectToNSQDWithRetry(ctx context.Context, cons *nsq.Consumer, addr, topic
 
 func handleEventMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisRecorder, geoip *enrich.GeoIP, stats *obs.Stats) (nsq.HandlerFunc, func()) {
 	var eng *alert.Engine
+	var quotas *quota.Enforcer
 	if db != nil {
 		eng = alert.NewEngine(db, nil)
+		quotas = quota.NewEnforcer(db)
 	}
+	deob := newDeobfuscator(cfg, db)
 
 	batcher := NewBatcher[model.Event](cfg.DBEventBatchSize, cfg.DBEventFlushInterval, 5*time.Second, func(ctx context.Context, rows []model.Event) error {
 		start := time.Now()
 		existing := existingEventIDs(ctx, db, rows)
-		err := store.InsertEventsBatch(ctx, db, rows)
+		fresh := make([]model.Event, 0, len(rows))
+		for _, r := range rows {
+			if !existing[r.ID] {
+				fresh = append(fresh, r)
+			}
+		}
+		// Issues (and the releases they are ordered by) are updated with the
+		// events, so a failure leaves both unstored and the redelivered batch
+		// counts them then.
+		var triggers []store.IssueTrigger
+		var err error
+		if db != nil {
+			triggers, err = store.InsertEventsWithIssues(ctx, db, rows, fresh)
+		}
 		if stats != nil {
 			stats.ObserveDBFlush(len(rows), time.Since(start), err)
 		}
+		if err == nil && db != nil {
+			if eng != nil && len(triggers) > 0 {
+				evalCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				for _, t := range triggers {
+					_ = eng.Evaluate(evalCtx, alert.InputFromIssue(t.Issue, t.Kind, t.Event))
+				}
+				cancel()
+			}
+			if err := store.UpsertProjectUsageDailyBatch(ctx, db, quotas.Usage(store.UsageRowsFromEvents(fresh))); err != nil {
+				log.Printf("consumer: record event usage: %v", err)
+			}
+		}
 		if err == nil && eng != nil {
 			evalCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 			defer cancel()
@@ -178,6 +261,7 @@ func handleEventMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisR
 			if err := json.Unmarshal(msg.Payload, &event); err != nil {
 				return nil
 			}
+			deobfuscateEvent(deob, msg.ProjectID, event)
 			row, err := store.EventRowFromMap(msg.ProjectID, event)
 			if err != nil {
 				if stats != nil {
@@ -185,6 +269,12 @@ func handleEventMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisR
 				}
 				return err
 			}
+			if quotas != nil && !quotas.Keep(context.Background(), row.ProjectID, row.Level) {
+				if stats != nil {
+					stats.ObserveConsumerMessage(time.Since(msgStart), nil)
+				}
+				return nil
+			}
 
 			if err := batcher.Add(row); err != nil {
 				if stats != nil {
@@ -249,30 +339,54 @@ func handleEventMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisR
 	}), batcher.Close
 }
 
-func handleLogMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisRecorder, geoip *enrich.GeoIP, stats *obs.Stats) (nsq.HandlerFunc, func()) {
+func handleLogMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisRecorder, geoip *enrich.GeoIP, stats *obs.Stats, tails *tail.Hub) (nsq.HandlerFunc, func()) {
 	var eng *alert.Engine
+	var quotas *quota.Enforcer
 	if db != nil {
 		eng = alert.NewEngine(db, nil)
+		quotas = quota.NewEnforcer(db)
+	}
+	deob := newDeobfuscator(cfg, db)
+	var miner *pattern.Miner
+	if cfg.LogPatterns {
+		miner = pattern.NewMiner(db)
+		miner.MaxClusters = cfg.LogPatternMax
 	}
 
 	batcher := NewBatcher[model.Log](cfg.DBLogBatchSize, cfg.DBLogFlushInterval, 5*time.Second, func(ctx context.Context, rows []model.Log) error {
 		start := time.Now()
+		miner.Assign(ctx, rows)
 		existing := existingLogIngestIDs(ctx, db, rows)
 		err := store.InsertLogsAndTrackEventsBatch(ctx, db, rows)
 		if stats != nil {
 			stats.ObserveDBFlush(len(rows), time.Since(start), err)
 		}
-		if err == nil && eng != nil {
+		if err != nil {
+			return err
+		}
+		fresh := make([]model.Log, 0, len(rows))
+		for _, r := range rows {
+			if r.IngestID == nil || existing[r.ProjectID] == nil || !existing[r.ProjectID][*r.IngestID] {
+				fresh = append(fresh, r)
+			}
+		}
+		tails.Publish(ctx, fresh)
+		if err := miner.Record(ctx, fresh); err != nil {
+			log.Printf("consumer: record log patterns: %v", err)
+		}
+		if quotas != nil {
+			if err := store.UpsertProjectUsageDailyBatch(ctx, db, quotas.Usage(store.UsageRowsFromLogs(fresh))); err != nil {
+				log.Printf("consumer: record log usage: %v", err)
+			}
+		}
+		if eng != nil {
 			evalCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 			defer cancel()
-			for _, r := range rows {
-				if r.IngestID != nil && existing[r.ProjectID] != nil && existing[r.ProjectID][*r.IngestID] {
-					continue
-				}
+			for _, r := range fresh {
 				_ = eng.Evaluate(evalCtx, alert.InputFromLog(r))
 			}
 		}
-		return err
+		return nil
 	})
 
 	return nsq.HandlerFunc(func(m *nsq.Message) error {
@@ -308,6 +422,8 @@ func handleLogMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisRec
 			return nil
 		}
 
+		deobfuscateLog(deob, msg.ProjectID, lp)
+
 		var ingestID uuid.UUID
 		copy(ingestID[:], m.ID[:])
 		row, err := store.LogRowFromPayloadWithIngestID(msg.ProjectID, lp, ingestID)
@@ -317,6 +433,12 @@ func handleLogMessage(cfg config.Config, db *gorm.DB, recorder *metrics.RedisRec
 			}
 			return err
 		}
+		if quotas != nil && !quotas.Keep(context.Background(), row.ProjectID, row.Level) {
+			if stats != nil {
+				stats.ObserveConsumerMessage(time.Since(msgStart), nil)
+			}
+			return nil
+		}
 		if err := batcher.Add(row); err != nil {
 			if stats != nil {
 				stats.ObserveConsumerMessage(time.Since(msgStart), err)
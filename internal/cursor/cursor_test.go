@@ -0,0 +1,54 @@
+package cursor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ts := time.Date(2025, 5, 1, 10, 7, 33, 123456789, time.UTC)
+	id := uuid.New()
+	for _, c := range []*Cursor{
+		After(ts, int64(42)),
+		After(ts, id),
+		{Time: ts, ID: "7", Source: "events"},
+		After(time.Time{}, 9),
+	} {
+		got, err := Parse(c.String())
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.String(), err)
+		}
+		if !got.Time.Equal(c.Time) || got.ID != c.ID || got.Source != c.Source {
+			t.Fatalf("got %+v, want %+v", got, c)
+		}
+	}
+	if After(ts, id).ID != id.String() {
+		t.Fatalf("uuid id not formatted")
+	}
+	if got := After(ts, int32(5)).ID; got != "5" {
+		t.Fatalf("int32 id = %q", got)
+	}
+	if c, err := Parse(" "); c != nil || err != nil {
+		t.Fatalf("empty token: %v %v", c, err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"nope!", "e30", "bm90IGpzb24"} { // "{}", "not json"
+		if _, err := Parse(s); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Parse(%q): err = %v", s, err)
+		}
+	}
+}
+
+func TestOrder(t *testing.T) {
+	if got := Order("timestamp", "id", false); got != "timestamp DESC, id DESC" {
+		t.Fatalf("got %q", got)
+	}
+	if got := Order("", "id", true); got != "id ASC" {
+		t.Fatalf("got %q", got)
+	}
+}
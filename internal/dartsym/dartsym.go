@@ -0,0 +1,299 @@
+// Package dartsym symbolizes the non-symbolic stack traces of Dart AOT builds
+// made with --split-debug-info, using the ELF/DWARF symbol files the build
+// wrote next to the app.
+package dartsym
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Instruction section symbols non-symbolic traces are relative to.
+const (
+	IsolateInstructions = "_kDartIsolateSnapshotInstructions"
+	VMInstructions      = "_kDartVmSnapshotInstructions"
+)
+
+var ErrNoBuildID = errors.New("dartsym: no GNU build id note")
+
+// File is a loaded symbol file.
+type File struct {
+	BuildID string
+	// Symbols holds the instruction section addresses, see IsolateInstructions.
+	Symbols map[string]uint64
+
+	d     *dwarf.Data
+	units []*dwarf.Entry
+	funcs []funcRange
+
+	mu    sync.Mutex
+	lines map[int]*dwarf.LineReader // by unit index
+}
+
+type funcRange struct {
+	low, high uint64
+	fn        *function
+}
+
+type function struct {
+	name    string
+	unit    int
+	inlines []inline
+}
+
+type inline struct {
+	low, high uint64
+	depth     int
+	name      string
+	callFile  int64
+	callLine  int64
+}
+
+// Frame is one symbolized frame.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// Open loads a symbol file.
+func Open(data []byte) (*File, error) {
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("dartsym: %w", err)
+	}
+	defer ef.Close()
+
+	f := &File{Symbols: map[string]uint64{}, lines: map[int]*dwarf.LineReader{}}
+	f.BuildID, _ = buildID(ef)
+	for _, load := range []func() ([]elf.Symbol, error){ef.Symbols, ef.DynamicSymbols} {
+		syms, _ := load()
+		for _, s := range syms {
+			if s.Name == IsolateInstructions || s.Name == VMInstructions {
+				f.Symbols[s.Name] = s.Value
+			}
+		}
+	}
+	if f.d, err = ef.DWARF(); err != nil {
+		return nil, fmt.Errorf("dartsym: %w", err)
+	}
+	if err := f.index(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// BuildID returns the GNU build id of an ELF file as hex.
+func BuildID(data []byte) (string, error) {
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("dartsym: %w", err)
+	}
+	defer ef.Close()
+	return buildID(ef)
+}
+
+func buildID(ef *elf.File) (string, error) {
+	for _, s := range ef.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		b, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for len(b) >= 12 {
+			nameSize := ef.ByteOrder.Uint32(b[0:4])
+			descSize := ef.ByteOrder.Uint32(b[4:8])
+			typ := ef.ByteOrder.Uint32(b[8:12])
+			nameEnd := 12 + align4(nameSize)
+			descEnd := nameEnd + align4(descSize)
+			if uint64(descEnd) > uint64(len(b)) {
+				break
+			}
+			name := string(bytes.TrimRight(b[12:12+nameSize], "\x00"))
+			if name == "GNU" && typ == 3 { // NT_GNU_BUILD_ID
+				return hex.EncodeToString(b[nameEnd : nameEnd+descSize]), nil
+			}
+			b = b[descEnd:]
+		}
+	}
+	return "", ErrNoBuildID
+}
+
+func align4(n uint32) uint32 { return (n + 3) &^ 3 }
+
+// index records the compile units and the address ranges of every function
+// with the functions inlined into it.
+func (f *File) index() error {
+	r := f.d.Reader()
+	type open struct {
+		fn    *function
+		depth int
+	}
+	var (
+		depth int
+		stack []open // enclosing subprograms
+		cu    = -1
+	)
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return fmt.Errorf("dartsym: %w", err)
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			depth--
+			for len(stack) > 0 && stack[len(stack)-1].depth > depth {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		switch e.Tag {
+		case dwarf.TagCompileUnit:
+			f.units = append(f.units, e)
+			cu = len(f.units) - 1
+			stack = stack[:0]
+		case dwarf.TagSubprogram:
+			ranges, _ := f.d.Ranges(e)
+			if len(ranges) > 0 {
+				fn := &function{name: f.name(e), unit: cu}
+				for _, rg := range ranges {
+					f.funcs = append(f.funcs, funcRange{low: rg[0], high: rg[1], fn: fn})
+				}
+				if e.Children {
+					stack = append(stack, open{fn: fn, depth: depth + 1})
+				}
+			}
+		case dwarf.TagInlinedSubroutine:
+			if len(stack) == 0 {
+				break
+			}
+			top := stack[len(stack)-1]
+			ranges, _ := f.d.Ranges(e)
+			callFile, _ := e.Val(dwarf.AttrCallFile).(int64)
+			callLine, _ := e.Val(dwarf.AttrCallLine).(int64)
+			name := f.name(e)
+			for _, rg := range ranges {
+				top.fn.inlines = append(top.fn.inlines, inline{
+					low: rg[0], high: rg[1], depth: depth - top.depth,
+					name: name, callFile: callFile, callLine: callLine,
+				})
+			}
+		}
+		if e.Children {
+			depth++
+		}
+	}
+	sort.Slice(f.funcs, func(i, j int) bool { return f.funcs[i].low < f.funcs[j].low })
+	return nil
+}
+
+// name resolves an entry's name through abstract origins and specifications.
+func (f *File) name(e *dwarf.Entry) string {
+	for i := 0; e != nil && i < 4; i++ {
+		if n, ok := e.Val(dwarf.AttrName).(string); ok {
+			return n
+		}
+		off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if off, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				return ""
+			}
+		}
+		r := f.d.Reader()
+		r.Seek(off)
+		e, _ = r.Next()
+	}
+	return ""
+}
+
+// Symbolize returns the frames at a virtual address, innermost first: one
+// per function inlined at pc plus the function containing it.
+func (f *File) Symbolize(pc uint64) []Frame {
+	i := sort.Search(len(f.funcs), func(i int) bool { return f.funcs[i].low > pc }) - 1
+	var fn *function
+	// Ranges rarely overlap; look back a little in case pc's function starts
+	// before a smaller one.
+	for k := 0; i >= 0 && k < 16; i, k = i-1, k+1 {
+		if r := f.funcs[i]; r.low <= pc && pc < r.high {
+			fn = r.fn
+			break
+		}
+	}
+	if fn == nil {
+		return nil
+	}
+
+	var chain []inline // outermost first
+	for _, in := range fn.inlines {
+		if in.low <= pc && pc < in.high {
+			chain = append(chain, in)
+		}
+	}
+	sort.SliceStable(chain, func(i, j int) bool { return chain[i].depth < chain[j].depth })
+
+	file, line := f.lineAt(fn.unit, pc)
+	names := make([]string, 0, len(chain)+1)
+	names = append(names, fn.name)
+	for _, in := range chain {
+		names = append(names, in.name)
+	}
+	frames := make([]Frame, 0, len(names))
+	for k := len(chain); k >= 0; k-- {
+		frames = append(frames, Frame{Function: names[k], File: file, Line: line})
+		if k > 0 {
+			file = f.fileName(fn.unit, chain[k-1].callFile)
+			line = int(chain[k-1].callLine)
+		}
+	}
+	return frames
+}
+
+func (f *File) lineReader(u int) *dwarf.LineReader {
+	if u < 0 || u >= len(f.units) {
+		return nil
+	}
+	lr, ok := f.lines[u]
+	if !ok {
+		lr, _ = f.d.LineReader(f.units[u])
+		f.lines[u] = lr
+	}
+	return lr
+}
+
+func (f *File) lineAt(u int, pc uint64) (string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lr := f.lineReader(u)
+	if lr == nil {
+		return "", 0
+	}
+	var le dwarf.LineEntry
+	if err := lr.SeekPC(pc, &le); err != nil || le.File == nil {
+		return "", 0
+	}
+	return le.File.Name, le.Line
+}
+
+func (f *File) fileName(u int, idx int64) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lr := f.lineReader(u)
+	if lr == nil {
+		return ""
+	}
+	files := lr.Files()
+	if idx < 0 || idx >= int64(len(files)) || files[idx] == nil {
+		return ""
+	}
+	return files[idx].Name
+}
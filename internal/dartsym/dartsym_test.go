@@ -0,0 +1,152 @@
+package dartsym
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fixture stands in for a Dart symbol file: an ELF shared object with
+// DWARF, a build id, an instruction symbol and a function inlined into
+// another.
+const fixture = `int _kDartIsolateSnapshotInstructions(void) { return 0; }
+
+static inline __attribute__((always_inline)) int inner(int x) {
+	return x * 3 + _kDartIsolateSnapshotInstructions();
+}
+
+int target(int x) {
+	int y = inner(x);
+	return y + 1;
+}
+`
+
+// buildFixture compiles the fixture with the system C compiler and returns
+// the object and the address of target.
+func buildFixture(t *testing.T) ([]byte, uint64) {
+	t.Helper()
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler to build the fixture")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "fixture.c")
+	if err := os.WriteFile(src, []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lib := filepath.Join(dir, "fixture.so")
+	if out, err := exec.Command(cc, "-g", "-O1", "-shared", "-fPIC", "-Wl,--build-id", "-o", lib, src).CombinedOutput(); err != nil {
+		t.Skipf("compile fixture: %v: %s", err, out)
+	}
+	data, err := os.ReadFile(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ef, err := elf.Open(lib)
+	if err != nil {
+		t.Skipf("fixture is not ELF: %v", err)
+	}
+	defer ef.Close()
+	syms, _ := ef.Symbols()
+	for _, s := range syms {
+		if s.Name == "target" {
+			return data, s.Value
+		}
+	}
+	t.Skip("target not in the fixture's symbol table")
+	return nil, 0
+}
+
+// inlinedPC is the address of the first instruction after target's call
+// inside the inlined inner.
+func inlinedPC(t *testing.T, f *File, target uint64) uint64 {
+	t.Helper()
+	for pc := target; pc < target+32; pc++ {
+		if frames := f.Symbolize(pc); len(frames) == 2 {
+			return pc
+		}
+	}
+	t.Skip("compiler did not inline inner into target")
+	return 0
+}
+
+func TestSymbolize(t *testing.T) {
+	data, target := buildFixture(t)
+	f, err := Open(data)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	id, err := BuildID(data)
+	if err != nil || len(id) != 40 || id != f.BuildID {
+		t.Fatalf("BuildID = %q (file %q) err=%v", id, f.BuildID, err)
+	}
+
+	frames := f.Symbolize(target)
+	if len(frames) == 0 || frames[len(frames)-1].Function != "target" || !strings.HasSuffix(frames[len(frames)-1].File, "fixture.c") {
+		t.Fatalf("Symbolize(target) = %+v", frames)
+	}
+
+	frames = f.Symbolize(inlinedPC(t, f, target))
+	if frames[0].Function != "inner" || frames[0].Line != 4 {
+		t.Fatalf("inlined frame = %+v", frames[0])
+	}
+	if frames[1].Function != "target" || frames[1].Line != 8 || !strings.HasSuffix(frames[1].File, "fixture.c") {
+		t.Fatalf("caller frame = %+v", frames[1])
+	}
+	if f.Symbolize(0) != nil {
+		t.Fatalf("expected no frames for address 0")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	data, target := buildFixture(t)
+	f, err := Open(data)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	base, ok := f.Symbols[IsolateInstructions]
+	if !ok {
+		t.Fatalf("instruction symbol not found")
+	}
+	pc := inlinedPC(t, f, target)
+
+	trace := fmt.Sprintf(`*** *** *** *** *** *** *** *** *** *** *** *** *** *** *** ***
+pid: 1234, tid: 5678, name 1.ui
+build_id: '%s'
+isolate_dso_base: 7b2f3a4000, vm_dso_base: 7b2f3a4000
+    #00 abs 000000737ff8b8a7 virt %016x _kDartIsolateSnapshotInstructions+0x1be8a7
+    #01 abs 000000737ff8b8b0 _kDartIsolateSnapshotInstructions+0x%x
+    #02 abs 000000737ff8b8c0 _kDartVmSnapshotInstructions+0x20`, strings.ToUpper(f.BuildID), pc, target-base)
+
+	id, ok := TraceBuildID(trace)
+	if !ok || id != f.BuildID {
+		t.Fatalf("TraceBuildID = %q ok=%v", id, ok)
+	}
+	if _, ok := TraceBuildID("build_id: 'abc' but no frames"); ok {
+		t.Fatalf("expected non-trace to be rejected")
+	}
+
+	got, changed := f.Rewrite(trace)
+	if !changed {
+		t.Fatalf("Rewrite did not change the trace")
+	}
+	want := []string{
+		"    #0      inner (",
+		"    #0      target (",
+		"    #1      target (",
+		"    #02 abs 000000737ff8b8c0 _kDartVmSnapshotInstructions+0x20",
+	}
+	lines := strings.Split(got, "\n")[4:]
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected rewrite:\n%s", got)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Fatalf("line %d = %q, want prefix %q\n%s", i, lines[i], w, got)
+		}
+	}
+}
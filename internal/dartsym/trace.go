@@ -0,0 +1,88 @@
+package dartsym
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A non-symbolic trace looks like:
+//
+//	*** *** *** *** *** *** *** *** *** *** *** *** *** *** *** ***
+//	pid: 1234, tid: 5678, name 1.ui
+//	build_id: '4c5a7bcbe3f1d4e1a0f4b2c3d5e6f708'
+//	isolate_dso_base: 7b2f3a4000, vm_dso_base: 7b2f3a4000
+//	isolate_instructions: 7b2f4b5000, vm_instructions: 7b2f4b0000
+//	    #00 abs 000000737ff8b8a7 virt 00000000001e48a7 _kDartIsolateSnapshotInstructions+0x1be8a7
+var (
+	buildIDLine = regexp.MustCompile(`(?m)^\s*build_id:\s*'([0-9a-fA-F]+)'`)
+	frameLine   = regexp.MustCompile(`^(\s*)#(\d+)\s+abs\s+[0-9a-fA-F]+(?:\s+virt\s+([0-9a-fA-F]+))?(?:\s+(\w+)\+0x([0-9a-fA-F]+))?\s*$`)
+)
+
+// TraceBuildID returns the build id of a non-symbolic trace; ok is false
+// when s is not one.
+func TraceBuildID(s string) (string, bool) {
+	sm := buildIDLine.FindStringSubmatch(s)
+	if sm == nil || !strings.Contains(s, " abs ") {
+		return "", false
+	}
+	return strings.ToLower(sm[1]), true
+}
+
+// Address returns the virtual address of a frame: virt when the trace has
+// it, otherwise the instruction symbol's address plus the offset.
+func (f *File) Address(virt, symbol string, offset uint64) (uint64, bool) {
+	if virt != "" {
+		v, err := strconv.ParseUint(virt, 16, 64)
+		return v, err == nil
+	}
+	base, ok := f.Symbols[symbol]
+	if !ok {
+		return 0, false
+	}
+	return base + offset, true
+}
+
+// Rewrite replaces the frame lines of a non-symbolic trace with symbolized
+// ones, in Dart's own "#0      function (file:line)" form; frames it cannot
+// resolve are kept. It reports whether any frame was resolved.
+func (f *File) Rewrite(s string) (string, bool) {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	changed := false
+	for _, line := range lines {
+		sm := frameLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if sm == nil {
+			out = append(out, line)
+			continue
+		}
+		off, _ := strconv.ParseUint(sm[5], 16, 64)
+		pc, ok := f.Address(sm[3], sm[4], off)
+		var frames []Frame
+		if ok {
+			frames = f.Symbolize(pc)
+		}
+		if len(frames) == 0 {
+			out = append(out, line)
+			continue
+		}
+		n, _ := strconv.Atoi(sm[2])
+		for _, fr := range frames {
+			out = append(out, fmt.Sprintf("%s#%-6d %s", sm[1], n, fr))
+		}
+		changed = true
+	}
+	return strings.Join(out, "\n"), changed
+}
+
+func (fr Frame) String() string {
+	name := fr.Function
+	if name == "" {
+		name = "<unknown>"
+	}
+	if fr.File == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s:%d)", name, fr.File, fr.Line)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlitePragmas are applied to every pooled connection. WAL lets the HTTP
+// readers run concurrently with the consumer's batched writes; busy_timeout
+// makes writers queue instead of failing with SQLITE_BUSY.
+var sqlitePragmas = []string{
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+	"busy_timeout(5000)",
+	"foreign_keys(ON)",
+	"temp_store(MEMORY)",
+	"cache_size(-32000)",
+	"auto_vacuum(INCREMENTAL)",
+	"wal_autocheckpoint(1000)",
+}
+
+// NewSQLite opens (or creates) a SQLite database file tuned for a single-node
+// logtap install. It is the production counterpart of testkit.OpenTestDB.
+func NewSQLite(ctx context.Context, path string, opts Options) (*gorm.DB, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("sqlite path required")
+	}
+	if dir := filepath.Dir(path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create sqlite dir: %w", err)
+		}
+	}
+
+	gdb, err := gorm.Open(sqlite.Open(sqliteDSN(path)), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxOpenConns <= 0 {
+		opts.MaxOpenConns = 10
+	}
+	if opts.MaxIdleConns <= 0 {
+		// Keep connections around: every new one re-runs the pragmas.
+		opts.MaxIdleConns = opts.MaxOpenConns
+	}
+	if opts.MaxIdleConns > opts.MaxOpenConns {
+		opts.MaxIdleConns = opts.MaxOpenConns
+	}
+	sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
+	if opts.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := sqlDB.PingContext(pingCtx); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return gdb, nil
+}
+
+func sqliteDSN(path string) string {
+	q := url.Values{}
+	for _, p := range sqlitePragmas {
+		q.Add("_pragma", p)
+	}
+	// Take the write lock at BEGIN so read->write upgrades inside a
+	// transaction don't deadlock against the consumer.
+	q.Set("_txlock", "immediate")
+	return "file:" + path + "?" + q.Encode()
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewSQLite_AppliesPragmas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "logtap.db")
+	gdb, err := NewSQLite(context.Background(), path, Options{MaxOpenConns: 4})
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	sqlDB, _ := gdb.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	var mode string
+	if err := gdb.Raw("PRAGMA journal_mode").Scan(&mode).Error; err != nil {
+		t.Fatalf("journal_mode: %v", err)
+	}
+	if !strings.EqualFold(mode, "wal") {
+		t.Fatalf("expected WAL journal mode, got %q", mode)
+	}
+	var timeout int
+	if err := gdb.Raw("PRAGMA busy_timeout").Scan(&timeout).Error; err != nil {
+		t.Fatalf("busy_timeout: %v", err)
+	}
+	if timeout != 5000 {
+		t.Fatalf("expected busy_timeout=5000, got %d", timeout)
+	}
+	if _, err := NewSQLite(context.Background(), " ", Options{}); err == nil {
+		t.Fatalf("expected error for empty path")
+	}
+}
@@ -5,17 +5,38 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aak1247/logtap/internal/detector"
+	"github.com/aak1247/logtap/internal/pipeline"
 )
 
-type Plugin struct{}
+type Plugin struct {
+	// Metrics serves the "metric" config; nil when no database is configured.
+	Metrics MetricReader
+	// Queries serves the "query" config; nil when no database is configured.
+	Queries QueryReader
+}
+
+// MetricReader reads the points of log-derived metrics by name.
+type MetricReader interface {
+	MetricPoints(ctx context.Context, projectID int, metric string, tr detector.TimeRange) ([]detector.MetricPoint, error)
+}
+
+// QueryReader runs piped log queries (see package pipeline), one point per
+// result row, valued by column.
+type QueryReader interface {
+	QueryPoints(ctx context.Context, projectID int, query, column string, tr detector.TimeRange) ([]detector.MetricPoint, error)
+}
 
 func New() Plugin { return Plugin{} }
 
+// NewWithMetrics returns a plugin that can also check log metrics.
+func NewWithMetrics(r MetricReader) Plugin { return Plugin{Metrics: r} }
+
 func (Plugin) Type() string { return "metric_threshold" }
 
 func (Plugin) ConfigSchema() json.RawMessage {
@@ -23,27 +44,45 @@ func (Plugin) ConfigSchema() json.RawMessage {
   "type": "object",
   "properties": {
     "field": {"type": "string"},
+    "metric": {"type": "string"},
+    "query": {"type": "string"},
+    "column": {"type": "string"},
+    "windowSec": {"type": "integer", "minimum": 1},
+    "reduce": {"type": "string", "enum": ["last", "avg", "min", "max", "sum"]},
+    "labels": {"type": "object", "additionalProperties": {"type": "string"}},
     "op": {"type": "string", "enum": [">", "<", ">=", "<=", "between"]},
     "value": {"type": "number"},
     "min": {"type": "number"},
     "max": {"type": "number"},
     "severityOnViolation": {"type": "string"}
   },
-  "required": ["field", "op"],
+  "required": ["op"],
   "additionalProperties": true
 }`
 	return json.RawMessage(schema)
 }
 
+// With Metric set, the checked value is each series of that log metric,
+// reduced over the last WindowSec; with Query, each group of the query run
+// over the last WindowSec, its Column reduced; otherwise it is Field of the
+// payload.
 type metricThresholdConfig struct {
-	Field               string   `json:"field"`
-	Op                  string   `json:"op"`
-	Value               *float64 `json:"value,omitempty"`
-	Min                 *float64 `json:"min,omitempty"`
-	Max                 *float64 `json:"max,omitempty"`
-	SeverityOnViolation string   `json:"severityOnViolation"`
+	Field               string            `json:"field"`
+	Metric              string            `json:"metric,omitempty"`
+	Query               string            `json:"query,omitempty"`
+	Column              string            `json:"column,omitempty"`
+	WindowSec           int               `json:"windowSec,omitempty"`
+	Reduce              string            `json:"reduce,omitempty"`
+	Labels              map[string]string `json:"labels,omitempty"`
+	Op                  string            `json:"op"`
+	Value               *float64          `json:"value,omitempty"`
+	Min                 *float64          `json:"min,omitempty"`
+	Max                 *float64          `json:"max,omitempty"`
+	SeverityOnViolation string            `json:"severityOnViolation"`
 }
 
+const defaultWindowSec = 300
+
 func (Plugin) ValidateConfig(cfg json.RawMessage) error {
 	raw := strings.TrimSpace(string(cfg))
 	if raw == "" || raw == "null" {
@@ -53,8 +92,21 @@ func (Plugin) ValidateConfig(cfg json.RawMessage) error {
 	if err := json.Unmarshal(cfg, &c); err != nil {
 		return errors.New("config must be valid json object")
 	}
-	if strings.TrimSpace(c.Field) == "" {
-		return errors.New("field is required")
+	if strings.TrimSpace(c.Field) == "" && strings.TrimSpace(c.Metric) == "" && strings.TrimSpace(c.Query) == "" {
+		return errors.New("field, metric or query is required")
+	}
+	if strings.TrimSpace(c.Query) != "" {
+		if _, err := pipeline.Parse(c.Query); err != nil {
+			return fmt.Errorf("query: %w", err)
+		}
+	}
+	if c.WindowSec < 0 {
+		return errors.New("windowSec must be positive")
+	}
+	switch c.Reduce {
+	case "", "last", "avg", "min", "max", "sum":
+	default:
+		return fmt.Errorf("unsupported reduce: %s", c.Reduce)
 	}
 	op := strings.TrimSpace(c.Op)
 	if op == "" {
@@ -78,9 +130,7 @@ func (Plugin) ValidateConfig(cfg json.RawMessage) error {
 	return nil
 }
 
-func (Plugin) Execute(ctx context.Context, req detector.ExecuteRequest) ([]detector.Signal, error) {
-	_ = ctx // context is not used directly; kept for interface compatibility.
-
+func (p Plugin) Execute(ctx context.Context, req detector.ExecuteRequest) ([]detector.Signal, error) {
 	var c metricThresholdConfig
 	if len(req.Config) > 0 {
 		if err := json.Unmarshal(req.Config, &c); err != nil {
@@ -90,6 +140,9 @@ func (Plugin) Execute(ctx context.Context, req detector.ExecuteRequest) ([]detec
 	if err := (Plugin{}).ValidateConfig(req.Config); err != nil {
 		return nil, err
 	}
+	if strings.TrimSpace(c.Metric) != "" || strings.TrimSpace(c.Query) != "" {
+		return p.executeMetric(ctx, req, c)
+	}
 
 	valueAny, ok := lookupField(req.Payload, c.Field)
 	if !ok {
@@ -100,6 +153,73 @@ func (Plugin) Execute(ctx context.Context, req detector.ExecuteRequest) ([]detec
 		return nil, fmt.Errorf("metric field %s is not numeric", c.Field)
 	}
 
+	labels := map[string]string{
+		"field": c.Field,
+	}
+	return []detector.Signal{signal(req, c, c.Field, value, labels)}, nil
+}
+
+// executeMetric checks every series of a log metric, or every group of a
+// query, one signal each.
+func (p Plugin) executeMetric(ctx context.Context, req detector.ExecuteRequest, c metricThresholdConfig) ([]detector.Signal, error) {
+	window := c.WindowSec
+	if window <= 0 {
+		window = defaultWindowSec
+	}
+	now := nowOrUTC(req.Now)
+	tr := detector.TimeRange{Start: now.Add(-time.Duration(window) * time.Second), End: now}
+	var points []detector.MetricPoint
+	var err error
+	name, label := c.Metric, "metric"
+	if strings.TrimSpace(c.Metric) != "" {
+		if p.Metrics == nil {
+			return nil, errors.New("log metrics are not available")
+		}
+		points, err = p.Metrics.MetricPoints(ctx, req.ProjectID, c.Metric, tr)
+	} else {
+		if p.Queries == nil {
+			return nil, errors.New("log queries are not available")
+		}
+		name, label = c.Query, "query"
+		points, err = p.Queries.QueryPoints(ctx, req.ProjectID, c.Query, c.Column, tr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type series struct {
+		labels map[string]string
+		values []float64
+	}
+	var order []string
+	bySeries := map[string]*series{}
+	for _, pt := range points {
+		if !hasLabels(pt.Labels, c.Labels) {
+			continue
+		}
+		key := labelsKey(pt.Labels)
+		s := bySeries[key]
+		if s == nil {
+			s = &series{labels: pt.Labels}
+			bySeries[key] = s
+			order = append(order, key)
+		}
+		s.values = append(s.values, pt.Value) // points come oldest first
+	}
+
+	sigs := make([]detector.Signal, 0, len(order))
+	for _, key := range order {
+		s := bySeries[key]
+		labels := map[string]string{label: name}
+		for k, v := range s.labels {
+			labels[k] = v
+		}
+		sigs = append(sigs, signal(req, c, name, reduce(c.Reduce, s.values), labels))
+	}
+	return sigs, nil
+}
+
+func signal(req detector.ExecuteRequest, c metricThresholdConfig, name string, value float64, labels map[string]string) detector.Signal {
 	violated := isViolation(c, value)
 
 	severity := "info"
@@ -111,15 +231,32 @@ func (Plugin) Execute(ctx context.Context, req detector.ExecuteRequest) ([]detec
 			severity = "error"
 		}
 		status = "firing"
-		message = fmt.Sprintf("metric_threshold violated: field=%s value=%v op=%s", c.Field, value, c.Op)
+		switch {
+		case c.Metric != "":
+			message = fmt.Sprintf("metric_threshold violated: metric=%s value=%v op=%s", name, value, c.Op)
+		case c.Query != "":
+			message = fmt.Sprintf("metric_threshold violated: query=%s value=%v op=%s", name, value, c.Op)
+		default:
+			message = fmt.Sprintf("metric_threshold violated: field=%s value=%v op=%s", name, value, c.Op)
+		}
 	}
 
 	fields := map[string]any{
 		"source_type": "metric_threshold",
-		"field":       c.Field,
 		"value":       value,
 		"op":          c.Op,
 	}
+	switch {
+	case c.Metric != "":
+		fields["metric"] = c.Metric
+	case c.Query != "":
+		fields["query"] = c.Query
+		if c.Column != "" {
+			fields["column"] = c.Column
+		}
+	default:
+		fields["field"] = c.Field
+	}
 	if c.Min != nil {
 		fields["min"] = *c.Min
 	}
@@ -127,24 +264,68 @@ func (Plugin) Execute(ctx context.Context, req detector.ExecuteRequest) ([]detec
 		fields["max"] = *c.Max
 	}
 
-	labels := map[string]string{
-		"field": c.Field,
-	}
-
-	sig := detector.Signal{
+	return detector.Signal{
 		ProjectID:  req.ProjectID,
 		Source:     "logs",
 		SourceType: "metric_threshold",
 		Severity:   severity,
 		Status:     status,
-		Title:      fmt.Sprintf("Metric threshold %s", c.Field),
+		Title:      fmt.Sprintf("Metric threshold %s", name),
 		Message:    message,
 		Labels:     labels,
 		Fields:     fields,
 		OccurredAt: nowOrUTC(req.Now),
 	}
+}
 
-	return []detector.Signal{sig}, nil
+func reduce(how string, values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	out := values[len(values)-1]
+	switch how {
+	case "avg", "sum":
+		out = 0
+		for _, v := range values {
+			out += v
+		}
+		if how == "avg" {
+			out /= float64(len(values))
+		}
+	case "min", "max":
+		out = values[0]
+		for _, v := range values[1:] {
+			if (how == "min" && v < out) || (how == "max" && v > out) {
+				out = v
+			}
+		}
+	}
+	return out
+}
+
+func hasLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(labels[k])
+		b.WriteByte(0)
+	}
+	return b.String()
 }
 
 func isSupportedOp(op string) bool {
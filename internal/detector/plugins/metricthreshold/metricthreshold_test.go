@@ -78,6 +78,94 @@ func TestPlugin_Execute_Violation(t *testing.T) {
 	}
 }
 
+type fakeMetrics []detector.MetricPoint
+
+func (f fakeMetrics) MetricPoints(_ context.Context, _ int, _ string, tr detector.TimeRange) ([]detector.MetricPoint, error) {
+	var out []detector.MetricPoint
+	for _, p := range f {
+		if !p.Timestamp.Before(tr.Start) && p.Timestamp.Before(tr.End) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func TestPlugin_Execute_LogMetric(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	pay := map[string]string{"fields.route": "/pay"}
+	find := map[string]string{"fields.route": "/find"}
+	p := NewWithMetrics(fakeMetrics{
+		{Timestamp: now.Add(-10 * time.Minute), Value: 900, Labels: pay},
+		{Timestamp: now.Add(-2 * time.Minute), Value: 300, Labels: pay},
+		{Timestamp: now.Add(-1 * time.Minute), Value: 700, Labels: pay},
+		{Timestamp: now.Add(-1 * time.Minute), Value: 50, Labels: find},
+	})
+
+	cfg := mustJSON(map[string]any{"metric": "latency", "windowSec": 300, "reduce": "avg", "op": ">", "value": 400})
+	sigs, err := p.Execute(context.Background(), detector.ExecuteRequest{ProjectID: 1, Config: cfg, Now: now})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("expected a signal per series, got %d", len(sigs))
+	}
+	if s := sigs[0]; s.Status != "firing" || s.Fields["value"] != 500.0 || s.Labels["fields.route"] != "/pay" || s.Labels["metric"] != "latency" {
+		t.Fatalf("unexpected /pay signal %+v", s)
+	}
+	if s := sigs[1]; s.Status != "resolved" || s.Labels["fields.route"] != "/find" {
+		t.Fatalf("unexpected /find signal %+v", s)
+	}
+
+	cfg = mustJSON(map[string]any{"metric": "latency", "labels": find, "op": ">", "value": 400})
+	if sigs, err = p.Execute(context.Background(), detector.ExecuteRequest{ProjectID: 1, Config: cfg, Now: now}); err != nil || len(sigs) != 1 {
+		t.Fatalf("Execute with labels: %+v err=%v", sigs, err)
+	}
+
+	if _, err := (Plugin{}).Execute(context.Background(), detector.ExecuteRequest{ProjectID: 1, Config: cfg, Now: now}); err == nil {
+		t.Fatalf("expected an error without a metric reader")
+	}
+}
+
+type fakeQueries struct {
+	query, column string
+	points        []detector.MetricPoint
+}
+
+func (f *fakeQueries) QueryPoints(_ context.Context, _ int, query, column string, _ detector.TimeRange) ([]detector.MetricPoint, error) {
+	f.query, f.column = query, column
+	return f.points, nil
+}
+
+func TestPlugin_Execute_Query(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	q := &fakeQueries{points: []detector.MetricPoint{
+		{Timestamp: now, Value: 12, Labels: map[string]string{"service": "api"}},
+		{Timestamp: now, Value: 3, Labels: map[string]string{"service": "web"}},
+	}}
+	p := Plugin{Queries: q}
+
+	query := "level:error | stats count() as n by service"
+	cfg := mustJSON(map[string]any{"query": query, "column": "n", "op": ">", "value": 10})
+	sigs, err := p.Execute(context.Background(), detector.ExecuteRequest{ProjectID: 1, Config: cfg, Now: now})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if q.query != query || q.column != "n" {
+		t.Fatalf("ran %q column %q", q.query, q.column)
+	}
+	if len(sigs) != 2 || sigs[0].Status != "firing" || sigs[0].Labels["service"] != "api" || sigs[0].Labels["query"] != query || sigs[1].Status != "resolved" {
+		t.Fatalf("unexpected signals %+v", sigs)
+	}
+
+	bad := mustJSON(map[string]any{"query": "| stats", "op": ">", "value": 10})
+	if err := p.ValidateConfig(bad); err == nil {
+		t.Fatalf("expected an invalid query to be rejected")
+	}
+	if _, err := (Plugin{}).Execute(context.Background(), detector.ExecuteRequest{ProjectID: 1, Config: cfg, Now: now}); err == nil {
+		t.Fatalf("expected an error without a query reader")
+	}
+}
+
 func mustJSON(v any) json.RawMessage {
 	b, err := json.Marshal(v)
 	if err != nil {
@@ -0,0 +1,512 @@
+// Package export streams a project's logs, events or track events out of
+// the database as NDJSON, CSV or Parquet. Rows are read in (timestamp, id)
+// order from one query as they are written, so an export of any size holds
+// a single row in memory (a row group for Parquet), and an export stopped
+// by its size limit resumes from a cursor.
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/cursor"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"github.com/parquet-go/parquet-go"
+	parquetgzip "github.com/parquet-go/parquet-go/compress/gzip"
+	"github.com/parquet-go/parquet-go/compress/snappy"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Formats.
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+const MaxColumns = 100
+
+// flushRows is how many rows are written between flushes of the output and,
+// for Parquet, the size of a row group.
+const flushRows = 1000
+
+var ErrInvalid = errors.New("export: invalid request")
+
+// sourceColumns are the columns of each source in the order a full export
+// writes them. The last column of logs and events is their JSON column,
+// written as an object; other columns name a path in it.
+var sourceColumns = map[string][]string{
+	search.SourceLogs:   {"id", "timestamp", "level", "message", "trace_id", "span_id", "pattern_id", "distinct_id", "device_id", "fields"},
+	search.SourceEvents: {"id", "timestamp", "level", "title", "release", "environment", "os", "platform", "user_id", "distinct_id", "device_id", "fingerprint", "data"},
+	search.SourceTrack:  {"id", "timestamp", "name", "distinct_id", "device_id"},
+}
+
+var jsonColumns = map[string]string{
+	search.SourceLogs:   "fields",
+	search.SourceEvents: "data",
+}
+
+var fieldPath = regexp.MustCompile(`^[A-Za-z0-9_@-]+(\.[A-Za-z0-9_@-]+)*$`)
+
+// Request describes an export.
+type Request struct {
+	ProjectID int
+	Source    string // search.SourceLogs, SourceEvents or SourceTrack
+	Query     string
+	Start     time.Time // zero is unbounded
+	End       time.Time // zero is unbounded
+	Format    string
+	Columns   []string // nil is every column of the source
+	Gzip      bool
+	Cursor    string // export the rows after this cursor
+	MaxBytes  int64  // stop after this many bytes; 0 is unlimited
+}
+
+// Result summarises a finished export. Cursor is set when the size limit
+// stopped it with rows left: exporting again from it continues where this
+// export ended.
+type Result struct {
+	Rows      int64
+	Bytes     int64 // uncompressed; for Parquet the size of the values
+	Truncated bool
+	Cursor    string
+}
+
+// ContentType is the media type of an export in format.
+func ContentType(format string, gz bool) string {
+	if gz && format != FormatParquet {
+		return "application/gzip"
+	}
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// FileName is the suggested file name of an export.
+func FileName(req Request, now time.Time) string {
+	name := fmt.Sprintf("logtap-%d-%s-%s.%s", req.ProjectID, req.Source, now.UTC().Format("20060102T150405Z"), req.Format)
+	if req.Gzip && req.Format != FormatParquet {
+		name += ".gz"
+	}
+	return name
+}
+
+// Export is an export whose query is running; Write streams its rows.
+type Export struct {
+	req  Request
+	db   *gorm.DB
+	rows *sql.Rows
+	next *cursor.Cursor
+}
+
+// Open validates req and starts its query. Errors wrap ErrInvalid when req
+// is at fault; once Open succeeds only the output can fail.
+func Open(ctx context.Context, db *gorm.DB, req Request) (*Export, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+	}
+	all, ok := sourceColumns[req.Source]
+	if !ok {
+		return nil, invalid("source must be logs, events or track")
+	}
+	switch req.Format {
+	case FormatNDJSON, FormatCSV, FormatParquet:
+	default:
+		return nil, invalid("format must be ndjson, csv or parquet")
+	}
+	if len(req.Columns) == 0 {
+		req.Columns = all
+	}
+	if len(req.Columns) > MaxColumns {
+		return nil, invalid("at most %d columns", MaxColumns)
+	}
+	seen := make(map[string]bool, len(req.Columns))
+	for _, c := range req.Columns {
+		if seen[c] {
+			return nil, invalid("column %q is repeated", c)
+		}
+		seen[c] = true
+		if !isColumn(req.Source, c) && (jsonColumns[req.Source] == "" || !fieldPath.MatchString(c)) {
+			return nil, invalid("column %q is not a column of %s", c, req.Source)
+		}
+	}
+	if req.MaxBytes < 0 {
+		req.MaxBytes = 0
+	}
+	after, err := cursor.Parse(req.Cursor)
+	if err != nil {
+		return nil, invalid("invalid cursor")
+	}
+	parsed, err := search.NewQueryParser().Parse(req.Query)
+	if err != nil {
+		return nil, invalid("query: %v", err)
+	}
+
+	qdb, err := postgres.NewAdapter(db).Filtered(ctx, req.Source, search.SearchQuery{
+		ProjectID: req.ProjectID,
+		TimeRange: search.TimeRange{Start: req.Start, End: req.End},
+		Query:     parsed.Root,
+	})
+	if err != nil {
+		if errors.Is(err, search.ErrInvalidQuery) {
+			return nil, invalid("query: %v", err)
+		}
+		return nil, err
+	}
+	rows, err := after.Where(qdb, "timestamp", "id", true).
+		Order(cursor.Order("timestamp", "id", true)).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	return &Export{req: req, db: db, rows: rows}, nil
+}
+
+func isColumn(source, c string) bool {
+	for _, col := range sourceColumns[source] {
+		if col == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Close ends the query; Write closes it too.
+func (e *Export) Close() error { return e.rows.Close() }
+
+// Write writes the export to w, flushing it every thousand rows when w is
+// an http.Flusher. A row is written whole even when it crosses MaxBytes.
+func (e *Export) Write(w io.Writer) (Result, error) {
+	defer e.rows.Close()
+
+	var res Result
+	out := w
+	var gz *gzip.Writer
+	if e.req.Gzip && e.req.Format != FormatParquet {
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+	enc, err := newEncoder(e.req, out)
+	if err != nil {
+		return res, err
+	}
+	flush := func() error {
+		if err := enc.flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	var last *cursor.Cursor
+	for e.rows.Next() {
+		if e.req.MaxBytes > 0 && res.Bytes >= e.req.MaxBytes {
+			res.Truncated = true
+			res.Cursor = last.String()
+			break
+		}
+		r, err := e.scan()
+		if err != nil {
+			return res, err
+		}
+		n, err := enc.write(r)
+		res.Bytes += int64(n)
+		if err != nil {
+			return res, err
+		}
+		res.Rows++
+		last = cursor.After(r.ts, r.id)
+		if res.Rows%flushRows == 0 {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if err := e.rows.Err(); err != nil {
+		return res, err
+	}
+	if err := enc.close(); err != nil {
+		return res, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// record is one exported row.
+type record struct {
+	id   string
+	ts   time.Time
+	cols map[string]string // text columns
+	json datatypes.JSON    // fields or data; nil for track events
+	doc  map[string]any    // json decoded, on first use
+}
+
+func (e *Export) scan() (*record, error) {
+	switch e.req.Source {
+	case search.SourceEvents:
+		var ev model.Event
+		if err := e.db.ScanRows(e.rows, &ev); err != nil {
+			return nil, err
+		}
+		return &record{id: ev.ID.String(), ts: ev.Timestamp, json: ev.Data, cols: map[string]string{
+			"level":       ev.Level,
+			"title":       ev.Title,
+			"release":     ev.ReleaseTag,
+			"environment": ev.Environment,
+			"os":          ev.OS,
+			"platform":    ev.Platform,
+			"user_id":     ev.UserID,
+			"distinct_id": ev.DistinctID,
+			"device_id":   ev.DeviceID,
+			"fingerprint": ev.Fingerprint,
+		}}, nil
+	case search.SourceTrack:
+		var te model.TrackEvent
+		if err := e.db.ScanRows(e.rows, &te); err != nil {
+			return nil, err
+		}
+		return &record{id: strconv.FormatInt(te.ID, 10), ts: te.Timestamp, cols: map[string]string{
+			"name":        te.Name,
+			"distinct_id": te.DistinctID,
+			"device_id":   te.DeviceID,
+		}}, nil
+	default:
+		var l model.Log
+		if err := e.db.ScanRows(e.rows, &l); err != nil {
+			return nil, err
+		}
+		return &record{id: strconv.FormatInt(l.ID, 10), ts: l.Timestamp, json: l.Fields, cols: map[string]string{
+			"level":       l.Level,
+			"message":     l.Message,
+			"trace_id":    l.TraceID,
+			"span_id":     l.SpanID,
+			"pattern_id":  l.PatternID,
+			"distinct_id": l.DistinctID,
+			"device_id":   l.DeviceID,
+		}}, nil
+	}
+}
+
+// value is column c of r: a string, a time, the JSON column as
+// json.RawMessage, or, for a field path, the decoded value; nil when r has
+// no such field. A path first names a top-level key of the JSON column
+// (with or without its name as prefix), then nested objects.
+func (r *record) value(source, c string) any {
+	switch c {
+	case "id":
+		return r.id
+	case "timestamp":
+		return r.ts.UTC()
+	}
+	if v, ok := r.cols[c]; ok {
+		return v
+	}
+	jc := jsonColumns[source]
+	if c == jc {
+		if len(r.json) == 0 {
+			return json.RawMessage("{}")
+		}
+		return json.RawMessage(r.json)
+	}
+	if r.doc == nil {
+		r.doc = map[string]any{}
+		_ = json.Unmarshal(r.json, &r.doc)
+	}
+	path := strings.TrimPrefix(c, jc+".")
+	if v, ok := r.doc[path]; ok {
+		return v
+	}
+	var cur any = r.doc
+	for _, p := range strings.Split(path, ".") {
+		m, isMap := cur.(map[string]any)
+		if !isMap {
+			return nil
+		}
+		if cur = m[p]; cur == nil {
+			return nil
+		}
+	}
+	return cur
+}
+
+// text renders a value for CSV and Parquet; JSON values are encoded.
+func text(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case json.RawMessage:
+		return string(v), true
+	}
+	b, _ := json.Marshal(v)
+	return string(b), true
+}
+
+type encoder interface {
+	write(r *record) (int, error) // returns the bytes r took
+	flush() error
+	close() error
+}
+
+func newEncoder(req Request, w io.Writer) (encoder, error) {
+	switch req.Format {
+	case FormatCSV:
+		enc := &csvEncoder{req: req, w: csv.NewWriter(w), record: make([]string, len(req.Columns))}
+		if err := enc.w.Write(req.Columns); err != nil {
+			return nil, err
+		}
+		return enc, nil
+	case FormatParquet:
+		return newParquetEncoder(req, w), nil
+	}
+	return &ndjsonEncoder{req: req, w: w}, nil
+}
+
+// ndjsonEncoder writes an object per line with the columns in order.
+type ndjsonEncoder struct {
+	req Request
+	w   io.Writer
+	buf []byte
+}
+
+func (e *ndjsonEncoder) write(r *record) (int, error) {
+	b := append(e.buf[:0], '{')
+	for i, c := range e.req.Columns {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		k, _ := json.Marshal(c)
+		v, err := json.Marshal(r.value(e.req.Source, c))
+		if err != nil {
+			return 0, err
+		}
+		b = append(append(append(b, k...), ':'), v...)
+	}
+	b = append(b, '}', '\n')
+	e.buf = b
+	return e.w.Write(b)
+}
+
+func (e *ndjsonEncoder) flush() error { return nil }
+func (e *ndjsonEncoder) close() error { return nil }
+
+// csvEncoder writes a header row of the columns, then a row per record.
+type csvEncoder struct {
+	req    Request
+	w      *csv.Writer
+	record []string
+}
+
+func (e *csvEncoder) write(r *record) (int, error) {
+	n := len(e.record) // separators and newline
+	for i, c := range e.req.Columns {
+		e.record[i], _ = text(r.value(e.req.Source, c))
+		n += len(e.record[i])
+	}
+	return n, e.w.Write(e.record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) close() error { return e.flush() }
+
+// parquetEncoder writes the timestamp as a nanosecond timestamp and every
+// other column as an optional string, compressing pages with gzip when
+// asked to and snappy otherwise.
+type parquetEncoder struct {
+	req     Request
+	w       *parquet.Writer
+	indexes []int // column of the file each of req.Columns is written to
+	row     parquet.Row
+}
+
+func newParquetEncoder(req Request, w io.Writer) *parquetEncoder {
+	group := parquet.Group{}
+	for _, c := range req.Columns {
+		if c == "timestamp" {
+			group[c] = parquet.Timestamp(parquet.Nanosecond)
+		} else {
+			group[c] = parquet.Optional(parquet.String())
+		}
+	}
+	schema := parquet.NewSchema("logtap_"+req.Source, group)
+	var codec parquet.WriterOption = parquet.Compression(&snappy.Codec{})
+	if req.Gzip {
+		codec = parquet.Compression(&parquetgzip.Codec{Level: parquetgzip.DefaultCompression})
+	}
+	// Group orders its fields by name.
+	leaf := map[string]int{}
+	for i, path := range schema.Columns() {
+		leaf[path[0]] = i
+	}
+	indexes := make([]int, len(req.Columns))
+	for i, c := range req.Columns {
+		indexes[i] = leaf[c]
+	}
+	return &parquetEncoder{
+		req:     req,
+		w:       parquet.NewWriter(w, schema, codec, parquet.MaxRowsPerRowGroup(flushRows)),
+		indexes: indexes,
+		row:     make(parquet.Row, len(req.Columns)),
+	}
+}
+
+func (e *parquetEncoder) write(r *record) (int, error) {
+	n := 0
+	for i, c := range e.req.Columns {
+		col := e.indexes[i]
+		v := r.value(e.req.Source, c)
+		if ts, ok := v.(time.Time); ok {
+			e.row[col] = parquet.Int64Value(ts.UnixNano()).Level(0, 0, col)
+			n += 8
+			continue
+		}
+		s, ok := text(v)
+		if !ok {
+			e.row[col] = parquet.NullValue().Level(0, 0, col)
+			continue
+		}
+		e.row[col] = parquet.ByteArrayValue([]byte(s)).Level(0, 1, col)
+		n += len(s)
+	}
+	_, err := e.w.WriteRows([]parquet.Row{e.row})
+	return n, err
+}
+
+func (e *parquetEncoder) flush() error { return nil } // row groups flush themselves
+func (e *parquetEncoder) close() error { return e.w.Close() }
@@ -0,0 +1,221 @@
+package export_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/export"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+var base = time.Date(2025, 6, 9, 9, 0, 0, 0, time.UTC)
+
+func seed(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testkit.OpenTestDB(t)
+	logs := []model.Log{
+		{ProjectID: 1, Timestamp: base.Add(2 * time.Minute), Level: "error", Message: "second", Fields: []byte(`{"user":{"id":"u2"}}`)},
+		{ProjectID: 1, Timestamp: base.Add(time.Minute), Level: "error", Message: `quote "x", comma`, Fields: []byte(`{"user.id":7}`)},
+		{ProjectID: 1, Timestamp: base.Add(2 * time.Minute), Level: "error", Message: "third", Fields: []byte(`{}`)},
+		{ProjectID: 1, Timestamp: base.Add(3 * time.Minute), Level: "info", Message: "fine", Fields: []byte(`{}`)},
+		{ProjectID: 2, Timestamp: base.Add(time.Minute), Level: "error", Message: "other project", Fields: []byte(`{}`)},
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	return db
+}
+
+func run(t *testing.T, db *gorm.DB, req export.Request) ([]byte, export.Result) {
+	t.Helper()
+	exp, err := export.Open(context.Background(), db, req)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	var buf bytes.Buffer
+	res, err := exp.Write(&buf)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes(), res
+}
+
+func TestNDJSONResume(t *testing.T) {
+	db := seed(t)
+	req := export.Request{ProjectID: 1, Source: "logs", Query: "level:error", Format: export.FormatNDJSON, Columns: []string{"message", "timestamp"}, MaxBytes: 1}
+
+	// With a one-byte limit every export writes one row and hands on.
+	var messages []string
+	for i := 0; ; i++ {
+		if i > 5 {
+			t.Fatal("export does not end")
+		}
+		out, res := run(t, db, req)
+		var row struct {
+			Message   string    `json:"message"`
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if err := json.Unmarshal(out, &row); err != nil {
+			t.Fatalf("decode %q: %v", out, err)
+		}
+		if want := `{"message":`; !bytes.HasPrefix(out, []byte(want)) {
+			t.Fatalf("columns out of order: %q", out)
+		}
+		messages = append(messages, row.Message)
+		if res.Rows != 1 || res.Bytes != int64(len(out)) {
+			t.Fatalf("result = %+v for %q", res, out)
+		}
+		if !res.Truncated {
+			break
+		}
+		req.Cursor = res.Cursor
+	}
+	want := []string{`quote "x", comma`, "second", "third"}
+	if len(messages) != len(want) {
+		t.Fatalf("messages = %q, want %q", messages, want)
+	}
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Fatalf("messages = %q, want %q", messages, want)
+		}
+	}
+
+	// Without a limit the whole range comes at once.
+	req.Cursor, req.MaxBytes = "", 0
+	req.Start = base.Add(90 * time.Second)
+	out, res := run(t, db, req)
+	if res.Rows != 2 || res.Truncated || res.Cursor != "" || bytes.Count(out, []byte("\n")) != 2 {
+		t.Fatalf("result = %+v: %q", res, out)
+	}
+}
+
+func TestCSVGzip(t *testing.T) {
+	db := seed(t)
+	out, res := run(t, db, export.Request{
+		ProjectID: 1,
+		Source:    "logs",
+		Query:     "level:error",
+		Format:    export.FormatCSV,
+		Columns:   []string{"timestamp", "message", "user.id", "fields"},
+		Gzip:      true,
+	})
+	if res.Rows != 3 {
+		t.Fatalf("rows = %d", res.Rows)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	records, err := csv.NewReader(zr).ReadAll()
+	if err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	want := [][]string{
+		{"timestamp", "message", "user.id", "fields"},
+		{base.Add(time.Minute).Format(time.RFC3339Nano), `quote "x", comma`, "7", `{"user.id":7}`},
+		{base.Add(2 * time.Minute).Format(time.RFC3339Nano), "second", "u2", `{"user":{"id":"u2"}}`},
+		{base.Add(2 * time.Minute).Format(time.RFC3339Nano), "third", "", "{}"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records = %q", records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Fatalf("record %d = %q, want %q", i, records[i], want[i])
+			}
+		}
+	}
+}
+
+func TestParquet(t *testing.T) {
+	db := seed(t)
+	out, res := run(t, db, export.Request{
+		ProjectID: 1,
+		Source:    "logs",
+		Query:     "level:error",
+		Format:    export.FormatParquet,
+		Columns:   []string{"timestamp", "message", "user.id"},
+		Gzip:      true,
+	})
+	if res.Rows != 3 {
+		t.Fatalf("rows = %d", res.Rows)
+	}
+	f, err := parquet.OpenFile(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	if f.NumRows() != 3 {
+		t.Fatalf("parquet rows = %d", f.NumRows())
+	}
+	r := parquet.NewReader(f)
+	defer r.Close()
+	columns := map[string]int{}
+	for i, path := range f.Schema().Columns() {
+		columns[path[0]] = i
+	}
+	rows := make([]parquet.Row, 3)
+	if n, err := r.ReadRows(rows); n != 3 || (err != nil && !errors.Is(err, io.EOF)) {
+		t.Fatalf("read rows: n=%d err=%v", n, err)
+	}
+	first := rows[0]
+	if got := time.Unix(0, first[columns["timestamp"]].Int64()).UTC(); !got.Equal(base.Add(time.Minute)) {
+		t.Fatalf("timestamp = %s", got)
+	}
+	if got := string(first[columns["message"]].ByteArray()); got != `quote "x", comma` {
+		t.Fatalf("message = %q", got)
+	}
+	if got := string(first[columns["user.id"]].ByteArray()); got != "7" {
+		t.Fatalf("user.id = %q", got)
+	}
+	if !rows[2][columns["user.id"]].IsNull() {
+		t.Fatalf("missing field = %v, want null", rows[2][columns["user.id"]])
+	}
+}
+
+func TestTrackEvents(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	events := []model.TrackEvent{
+		{ProjectID: 1, Timestamp: base, Name: "signup", DistinctID: "u1"},
+		{ProjectID: 1, Timestamp: base.Add(time.Second), Name: "purchase", DistinctID: "u1", DeviceID: "d1"},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatalf("create track events: %v", err)
+	}
+	out, res := run(t, db, export.Request{ProjectID: 1, Source: "track", Query: "name:purchase", Format: export.FormatNDJSON})
+	var row map[string]any
+	if err := json.Unmarshal(out, &row); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if res.Rows != 1 || row["name"] != "purchase" || row["device_id"] != "d1" || len(row) != 5 {
+		t.Fatalf("row = %v (%+v)", row, res)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	for name, req := range map[string]export.Request{
+		"source":      {Source: "metrics", Format: export.FormatNDJSON},
+		"format":      {Source: "logs", Format: "xlsx"},
+		"column":      {Source: "logs", Format: export.FormatCSV, Columns: []string{"a b"}},
+		"repeated":    {Source: "logs", Format: export.FormatCSV, Columns: []string{"message", "message"}},
+		"track field": {Source: "track", Format: export.FormatCSV, Columns: []string{"user.id"}},
+		"query":       {Source: "logs", Format: export.FormatNDJSON, Query: "level:(error"},
+		"cursor":      {Source: "logs", Format: export.FormatNDJSON, Cursor: "!"},
+	} {
+		req.ProjectID = 1
+		if _, err := export.Open(context.Background(), db, req); !errors.Is(err, export.ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
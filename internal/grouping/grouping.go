@@ -0,0 +1,255 @@
+// Package grouping computes the fingerprint that groups error events into
+// issues. In order of preference it uses the SDK-provided fingerprint, the
+// exception types with their in-app stack frames, or the normalized message.
+package grouping
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	MethodSDK       = "sdk"
+	MethodException = "exception"
+	MethodMessage   = "message"
+	MethodFallback  = "fallback"
+
+	maxMessageLen = 512
+)
+
+// Result is the grouping of one event.
+type Result struct {
+	// Fingerprint is the hex SHA-1 of the grouping components.
+	Fingerprint string
+	Method      string
+	// Culprit names where the event happened (e.g. "handler in app/api.go").
+	Culprit string
+}
+
+// Compute groups a Sentry-style event payload.
+func Compute(event map[string]any) Result {
+	components, method, culprit := defaultComponents(event)
+	if sdk, ok := sdkFingerprint(event); ok {
+		var expanded []string
+		for _, part := range sdk {
+			if isDefaultPlaceholder(part) {
+				expanded = append(expanded, components...)
+				continue
+			}
+			expanded = append(expanded, "sdk:"+part)
+		}
+		components = expanded
+		method = MethodSDK
+	}
+	if c, _ := event["culprit"].(string); strings.TrimSpace(c) != "" {
+		culprit = strings.TrimSpace(c)
+	} else if culprit == "" {
+		culprit, _ = event["transaction"].(string)
+	}
+
+	sum := sha1.Sum([]byte(strings.Join(components, "\n")))
+	return Result{Fingerprint: hex.EncodeToString(sum[:]), Method: method, Culprit: culprit}
+}
+
+func sdkFingerprint(event map[string]any) ([]string, bool) {
+	raw, ok := event["fingerprint"].([]any)
+	if !ok || len(raw) == 0 {
+		return nil, false
+	}
+	out := make([]string, 0, len(raw))
+	for _, v := range raw {
+		s := strings.TrimSpace(fmt.Sprint(v))
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out, len(out) > 0
+}
+
+func isDefaultPlaceholder(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	return s == "{{default}}"
+}
+
+func defaultComponents(event map[string]any) ([]string, string, string) {
+	if excs := exceptionValues(event); len(excs) > 0 {
+		var parts []string
+		culprit := ""
+		for _, exc := range excs {
+			typ, _ := exc["type"].(string)
+			typ = strings.TrimSpace(typ)
+			frames := groupingFrames(exc)
+			if typ != "" {
+				parts = append(parts, "type:"+typ)
+			}
+			for _, f := range frames {
+				parts = append(parts, "frame:"+frameKey(f))
+			}
+			if typ == "" && len(frames) == 0 {
+				if val, _ := exc["value"].(string); strings.TrimSpace(val) != "" {
+					parts = append(parts, "value:"+NormalizeMessage(val))
+				}
+			}
+			if len(frames) > 0 {
+				// Frames run oldest to newest; the last one raised.
+				culprit = frameCulprit(frames[len(frames)-1])
+			}
+		}
+		if len(parts) > 0 {
+			return parts, MethodException, culprit
+		}
+	}
+	if msg := message(event); msg != "" {
+		return []string{"message:" + NormalizeMessage(msg)}, MethodMessage, ""
+	}
+	level, _ := event["level"].(string)
+	platform, _ := event["platform"].(string)
+	return []string{"fallback:" + strings.ToLower(level) + ":" + strings.ToLower(platform)}, MethodFallback, ""
+}
+
+// exceptionValues accepts both {"exception": {"values": [...]}} and the older
+// {"exception": [...]} shape.
+func exceptionValues(event map[string]any) []map[string]any {
+	var list []any
+	switch exc := event["exception"].(type) {
+	case map[string]any:
+		list, _ = exc["values"].([]any)
+	case []any:
+		list = exc
+	}
+	out := make([]map[string]any, 0, len(list))
+	for _, v := range list {
+		if m, ok := v.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// groupingFrames returns the in-app frames of the exception, or all frames
+// when the SDK marked none as in-app.
+func groupingFrames(exc map[string]any) []map[string]any {
+	st, _ := exc["stacktrace"].(map[string]any)
+	raw, _ := st["frames"].([]any)
+	var all, inApp []map[string]any
+	for _, v := range raw {
+		f, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		all = append(all, f)
+		if b, _ := f["in_app"].(bool); b {
+			inApp = append(inApp, f)
+		}
+	}
+	if len(inApp) > 0 {
+		return inApp
+	}
+	return all
+}
+
+func frameKey(f map[string]any) string {
+	loc, _ := f["module"].(string)
+	if strings.TrimSpace(loc) == "" {
+		loc = frameFile(f)
+	}
+	fn, _ := f["function"].(string)
+	return NormalizePath(loc) + ":" + NormalizeFunction(fn)
+}
+
+func frameFile(f map[string]any) string {
+	if s, _ := f["filename"].(string); strings.TrimSpace(s) != "" {
+		return s
+	}
+	s, _ := f["abs_path"].(string)
+	return s
+}
+
+func frameCulprit(f map[string]any) string {
+	loc, _ := f["module"].(string)
+	if strings.TrimSpace(loc) == "" {
+		loc = frameFile(f)
+	}
+	fn, _ := f["function"].(string)
+	switch {
+	case fn != "" && loc != "":
+		return fn + " in " + loc
+	case fn != "":
+		return fn
+	default:
+		return loc
+	}
+}
+
+// message prefers the unformatted logentry template, so messages differing
+// only in their parameters group together.
+func message(event map[string]any) string {
+	for _, key := range []string{"logentry", "message"} {
+		switch v := event[key].(type) {
+		case string:
+			if strings.TrimSpace(v) != "" {
+				return v
+			}
+		case map[string]any:
+			for _, k := range []string{"message", "formatted"} {
+				if s, _ := v[k].(string); strings.TrimSpace(s) != "" {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
+
+var (
+	uuidRe    = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	emailRe   = regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`)
+	ipRe      = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	hexRe     = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]{16,}\b`)
+	numberRe  = regexp.MustCompile(`\d+(\.\d+)?`)
+	spaceRe   = regexp.MustCompile(`\s+`)
+	lambdaRe  = regexp.MustCompile(`\$\d+|\$\$Lambda\$[^.]*|0x[0-9a-fA-F]+`)
+	hashSegRe = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}(\.|$)`)
+)
+
+// NormalizeMessage replaces variable parts (ids, numbers, addresses) with
+// placeholders.
+func NormalizeMessage(s string) string {
+	s = uuidRe.ReplaceAllString(s, "<uuid>")
+	s = emailRe.ReplaceAllString(s, "<email>")
+	s = ipRe.ReplaceAllString(s, "<ip>")
+	s = hexRe.ReplaceAllString(s, "<hex>")
+	s = numberRe.ReplaceAllString(s, "<num>")
+	s = strings.TrimSpace(spaceRe.ReplaceAllString(s, " "))
+	if len(s) > maxMessageLen {
+		s = s[:maxMessageLen]
+	}
+	return s
+}
+
+// NormalizeFunction strips compiler-generated suffixes (anonymous class and
+// lambda numbers, addresses).
+func NormalizeFunction(s string) string {
+	return lambdaRe.ReplaceAllString(strings.TrimSpace(s), "")
+}
+
+// NormalizePath drops the origin, query and content hashes of a frame path
+// so redeploying the same code keeps its grouping.
+func NormalizePath(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "://"); i >= 0 {
+		rest := s[i+3:]
+		if j := strings.Index(rest, "/"); j >= 0 {
+			s = rest[j:]
+		} else {
+			s = ""
+		}
+	}
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	return hashSegRe.ReplaceAllString(s, "$1")
+}
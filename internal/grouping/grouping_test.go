@@ -0,0 +1,74 @@
+package grouping
+
+import "testing"
+
+func exceptionEvent(value string, lineno float64, file string) map[string]any {
+	return map[string]any{
+		"exception": map[string]any{"values": []any{map[string]any{
+			"type":  "TypeError",
+			"value": value,
+			"stacktrace": map[string]any{"frames": []any{
+				map[string]any{"filename": "node_modules/react/index.js", "function": "render", "lineno": 10.0, "in_app": false},
+				map[string]any{"filename": file, "function": "onClick", "lineno": lineno, "in_app": true},
+			}},
+		}}},
+	}
+}
+
+func TestCompute_ExceptionIgnoresValueLinenoAndBundleHash(t *testing.T) {
+	a := Compute(exceptionEvent("x is undefined", 12, "https://cdn.example.com/static/app.3f9a2b1c.js?v=1"))
+	b := Compute(exceptionEvent("y is undefined", 40, "https://other.example.com/static/app.77aa00ff.js"))
+	if a.Method != MethodException || a.Fingerprint != b.Fingerprint {
+		t.Fatalf("expected equal exception fingerprints, got %+v %+v", a, b)
+	}
+	if a.Culprit != "onClick in https://cdn.example.com/static/app.3f9a2b1c.js?v=1" {
+		t.Fatalf("unexpected culprit %q", a.Culprit)
+	}
+
+	c := Compute(exceptionEvent("x is undefined", 12, "static/checkout.js"))
+	if c.Fingerprint == a.Fingerprint {
+		t.Fatalf("expected different in-app frames to split issues")
+	}
+}
+
+func TestCompute_SDKFingerprint(t *testing.T) {
+	ev := exceptionEvent("boom", 1, "app.js")
+	def := Compute(ev)
+
+	ev["fingerprint"] = []any{"{{ default }}"}
+	if got := Compute(ev); got.Fingerprint != def.Fingerprint || got.Method != MethodSDK {
+		t.Fatalf("expected {{ default }} to keep default grouping, got %+v", got)
+	}
+
+	ev["fingerprint"] = []any{"payment-gateway", "timeout"}
+	custom := Compute(ev)
+	other := Compute(map[string]any{"message": "unrelated", "fingerprint": []any{"payment-gateway", "timeout"}})
+	if custom.Fingerprint == def.Fingerprint || custom.Fingerprint != other.Fingerprint {
+		t.Fatalf("expected SDK fingerprint to decide grouping, got %+v %+v", custom, other)
+	}
+}
+
+func TestCompute_MessageNormalization(t *testing.T) {
+	a := Compute(map[string]any{"message": "user 42 failed login from 10.0.0.1 (id 3f2504e0-4f89-11d3-9a0c-0305e82c3301)"})
+	b := Compute(map[string]any{"message": "user 7 failed login from 192.168.1.9 (id 6ba7b810-9dad-11d1-80b4-00c04fd430c8)"})
+	if a.Method != MethodMessage || a.Fingerprint != b.Fingerprint {
+		t.Fatalf("expected normalized messages to group, got %+v %+v", a, b)
+	}
+
+	tpl := Compute(map[string]any{"logentry": map[string]any{"message": "order %s failed", "formatted": "order A-1 failed"}})
+	tpl2 := Compute(map[string]any{"logentry": map[string]any{"message": "order %s failed", "formatted": "order B-2 failed"}})
+	if tpl.Fingerprint != tpl2.Fingerprint {
+		t.Fatalf("expected logentry template to group")
+	}
+
+	if got := NormalizeMessage("took 15.5ms at 0xdeadbeef for a@b.io"); got != "took <num>ms at <hex> for <email>" {
+		t.Fatalf("NormalizeMessage=%q", got)
+	}
+}
+
+func TestCompute_Fallback(t *testing.T) {
+	got := Compute(map[string]any{"level": "error", "platform": "go"})
+	if got.Method != MethodFallback || got.Fingerprint == "" {
+		t.Fatalf("unexpected fallback %+v", got)
+	}
+}
@@ -97,6 +97,31 @@ func RequireProjectOwner(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// RequireAdmin allows the trusted proxy and the instance admin (the bootstrap user).
+func RequireAdmin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if proxyOK(c) {
+			c.Next()
+			return
+		}
+		uid, ok := userIDFromContext(c)
+		if !ok {
+			c.Status(http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+		admin, err := store.IsAdminUser(ctx, db, uid)
+		if err != nil || !admin {
+			c.Status(http.StatusForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func RequireProjectKey(db *gorm.DB) gin.HandlerFunc {
 	cache := newProjectKeyCache(10_000, 30*time.Second)
 	return func(c *gin.Context) {
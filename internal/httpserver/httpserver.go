@@ -2,11 +2,14 @@ package httpserver
 
 import (
 	"expvar"
+	"log"
 	"net/http"
 	"net/http/pprof"
 	"strings"
 	"time"
 
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/artifact"
 	"github.com/aak1247/logtap/internal/config"
 	"github.com/aak1247/logtap/internal/detector"
 	"github.com/aak1247/logtap/internal/ingest"
@@ -14,15 +17,17 @@ import (
 	"github.com/aak1247/logtap/internal/obs"
 	"github.com/aak1247/logtap/internal/openapi"
 	"github.com/aak1247/logtap/internal/query"
+	"github.com/aak1247/logtap/internal/queryjob"
 	"github.com/aak1247/logtap/internal/search"
 	searchpostgres "github.com/aak1247/logtap/internal/search/adapters/postgres"
 	"github.com/aak1247/logtap/internal/queue"
+	"github.com/aak1247/logtap/internal/tail"
 	"github.com/gin-gonic/gin"
 	swgui "github.com/swaggest/swgui/v3"
 	"gorm.io/gorm"
 )
 
-func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *metrics.RedisRecorder, stats *obs.Stats, detectorService *detector.Service, detectorStore *detector.ResultStore) *http.Server {
+func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *metrics.RedisRecorder, stats *obs.Stats, detectorService *detector.Service, detectorStore *detector.ResultStore, tails *tail.Hub) *http.Server {
 	router := gin.New()
 	router.Use(gin.Recovery())
 	router.Use(corsMiddleware())
@@ -86,6 +91,15 @@ func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *me
 		authed.GET("/projects/:projectId/keys", query.ListProjectKeysHandler(db))
 		authed.POST("/projects/:projectId/keys", query.CreateProjectKeyHandler(db))
 		authed.POST("/projects/:projectId/keys/:keyId/revoke", query.RevokeProjectKeyHandler(db))
+
+		admin := authed.Group("/admin")
+		admin.Use(RequireAdmin(db))
+		admin.GET("/timescale", query.GetTimescaleHandler(db))
+		admin.PUT("/timescale", query.UpdateTimescaleHandler(db))
+		// The admin sets quotas on projects they do not own here; the
+		// project-scoped PUT /quota only reaches their own.
+		admin.GET("/projects/:projectId/quota", query.GetQuotaHandler(db))
+		admin.PUT("/projects/:projectId/quota", query.UpsertQuotaHandler(db))
 	}
 
 	ingestAPI := router.Group("/api/:projectId")
@@ -95,20 +109,22 @@ func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *me
 		ingestAPI.Use(acceptProxySecretMiddleware(cfg.LogtapProxySecret))
 	}
 	{
+		quotaCheck := quotaMiddleware(db)
 		switch {
 		case authEnabled:
-			ingestAPI.POST("/store/", RequireProjectKey(db), ingest.SentryStoreHandler(publisher))
-			ingestAPI.POST("/envelope/", RequireProjectKey(db), ingest.SentryEnvelopeHandler(publisher))
-			ingestAPI.POST("/logs/", RequireProjectKey(db), ingest.CustomLogHandler(publisher))
-			ingestAPI.POST("/track/", RequireProjectKey(db), ingest.TrackEventHandler(publisher))
+			ingestAPI.POST("/store/", RequireProjectKey(db), quotaCheck, ingest.SentryStoreHandler(publisher))
+			ingestAPI.POST("/envelope/", RequireProjectKey(db), quotaCheck, ingest.SentryEnvelopeHandler(publisher))
+			ingestAPI.POST("/logs/", RequireProjectKey(db), quotaCheck, ingest.CustomLogHandler(publisher))
+			ingestAPI.POST("/track/", RequireProjectKey(db), quotaCheck, ingest.TrackEventHandler(publisher))
 		default:
-			ingestAPI.POST("/store/", ingest.SentryStoreHandler(publisher))
-			ingestAPI.POST("/envelope/", ingest.SentryEnvelopeHandler(publisher))
-			ingestAPI.POST("/logs/", ingest.CustomLogHandler(publisher))
-			ingestAPI.POST("/track/", ingest.TrackEventHandler(publisher))
+			ingestAPI.POST("/store/", quotaCheck, ingest.SentryStoreHandler(publisher))
+			ingestAPI.POST("/envelope/", quotaCheck, ingest.SentryEnvelopeHandler(publisher))
+			ingestAPI.POST("/logs/", quotaCheck, ingest.CustomLogHandler(publisher))
+			ingestAPI.POST("/track/", quotaCheck, ingest.TrackEventHandler(publisher))
 		}
 	}
 
+	var jobs *queryjob.Manager
 	queryAPI := router.Group("/api/:projectId")
 	if trustedProxyEnabled && !authEnabled {
 		queryAPI.Use(requireProxySecretMiddleware(cfg.LogtapProxySecret))
@@ -121,15 +137,50 @@ func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *me
 	{
 		if db != nil {
 			queryAPI.GET("/events/recent", query.RecentEventsHandler(db))
-			queryAPI.GET("/events/:eventId", query.GetEventHandler(db))
+			artifactStore, err := artifact.NewStore(cfg)
+			if err != nil {
+				log.Printf("artifact store: %v", err)
+			}
+			queryAPI.GET("/events/:eventId", query.GetEventHandler(db, artifact.NewSymbolicator(db, artifactStore)))
+			queryAPI.GET("/events/:eventId/context", query.EventContextHandler(db))
 			queryAPI.GET("/events/schema", query.ListEventDefinitionsHandler(db))
 			queryAPI.POST("/events/schema", query.CreateEventDefinitionHandler(db))
 			queryAPI.PUT("/events/schema/:eventName", query.UpdateEventDefinitionHandler(db))
-			queryAPI.GET("/logs/search", query.SearchLogsHandler(db))
+			queryAPI.GET("/issues", query.ListIssuesHandler(db))
+			queryAPI.GET("/issues/:issueId", query.GetIssueHandler(db))
+			queryAPI.GET("/issues/:issueId/events", query.ListIssueEventsHandler(db))
+			queryAPI.PUT("/issues/:issueId", query.UpdateIssueHandler(db))
+			queryAPI.GET("/issues/:issueId/activity", query.ListIssueActivityHandler(db))
+			queryAPI.GET("/releases/:release/artifacts", query.ListArtifactsHandler(db))
+			queryAPI.POST("/releases/:release/artifacts", query.UploadArtifactHandler(db, artifactStore))
+			queryAPI.GET("/releases", query.ListReleasesHandler(db))
+			queryAPI.POST("/releases", query.CreateReleaseHandler(db))
+			queryAPI.GET("/releases/:release", query.GetReleaseHandler(db))
+			queryAPI.GET("/releases/:release/deploys", query.ListReleaseDeploysHandler(db))
+			queryAPI.POST("/releases/:release/deploys", query.CreateDeployHandler(db))
+			queryAPI.GET("/deploys/annotations", query.ListDeployAnnotationsHandler(db))
+			queryAPI.DELETE("/releases/:release/artifacts/:artifactId", query.DeleteArtifactHandler(db, artifactStore))
+			jobs = &queryjob.Manager{
+				DB:         db,
+				Workers:    cfg.QueryJobWorkers,
+				PerProject: cfg.QueryJobPerProject,
+				Timeout:    cfg.QueryJobTimeout,
+				CacheTTL:   cfg.QueryJobCacheTTL,
+			}
+			queryAPI.GET("/jobs/:jobId", query.GetQueryJobHandler(jobs))
+			queryAPI.DELETE("/jobs/:jobId", query.CancelQueryJobHandler(jobs))
+			queryAPI.GET("/logs/search", query.SearchLogsHandler(db, jobs))
+			queryAPI.GET("/export", query.ExportHandler(db, cfg.ExportMaxBytes))
+			queryAPI.GET("/logs/:id/context", query.LogContextHandler(db))
+			if tails != nil {
+				queryAPI.GET("/logs/tail", tail.Handler(tails))
+			}
 			// Unified search endpoint (v1: queries logs table via adapter)
 			if db != nil {
 				searchEngine := search.NewEngine(searchpostgres.NewAdapter(db))
 				queryAPI.GET("/search", search.SearchHandler(searchEngine))
+				queryAPI.GET("/query", query.PipelineQueryHandler(db, jobs))
+				queryAPI.POST("/query", query.PipelineQueryHandler(db, jobs))
 			}
 			queryAPI.DELETE("/logs/cleanup", query.CleanupLogsHandler(db))
 			queryAPI.DELETE("/events/cleanup", query.CleanupEventsHandler(db))
@@ -137,10 +188,22 @@ func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *me
 			queryAPI.GET("/cleanup/policy", query.GetCleanupPolicyHandler(db))
 			queryAPI.PUT("/cleanup/policy", query.UpsertCleanupPolicyHandler(db))
 			queryAPI.POST("/cleanup/run", query.RunCleanupPolicyHandler(db))
+			archiveStore, err := archive.NewStore(cfg)
+			if err != nil {
+				log.Printf("archive store: %v", err)
+			}
+			queryAPI.GET("/quota", query.GetQuotaHandler(db))
+			// Quotas protect the instance from its projects, so only the
+			// instance admin sets them.
+			queryAPI.PUT("/quota", RequireAdmin(db), query.UpsertQuotaHandler(db))
+			queryAPI.GET("/usage", query.ListUsageHandler(db))
+			queryAPI.GET("/archives", query.ListArchivesHandler(db))
+			queryAPI.POST("/archives/rehydrate", query.RehydrateArchivesHandler(db, archiveStore))
+			queryAPI.DELETE("/archives/rehydrated", query.DropRehydratedHandler(db))
 			queryAPI.GET("/analytics/events/top", query.TopEventsHandler(db))
 			queryAPI.GET("/analytics/users", query.UserGrowthHandler(db))
-			queryAPI.GET("/analytics/funnel", query.FunnelHandler(db))
-			queryAPI.POST("/analytics/custom", query.CustomAnalyticsHandler(db))
+			queryAPI.GET("/analytics/funnel", query.FunnelHandler(db, jobs))
+			queryAPI.POST("/analytics/custom", query.CustomAnalyticsHandler(db, jobs))
 			queryAPI.GET("/analytics/views", query.ListAnalysisViewsHandler(db))
 			queryAPI.POST("/analytics/views", query.CreateAnalysisViewHandler(db))
 			queryAPI.GET("/analytics/views/:viewId", query.GetAnalysisViewHandler(db))
@@ -189,10 +252,54 @@ func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *me
 				monitors.POST("/:monitorId/run", query.RunMonitorNowHandler(db))
 				monitors.POST("/:monitorId/test", query.TestMonitorHandler(db, detectorService))
 			}
+
+			logMetrics := queryAPI.Group("/log-metrics")
+			{
+				logMetrics.GET("", query.ListLogMetricsHandler(db))
+				logMetrics.POST("", query.CreateLogMetricHandler(db))
+				logMetrics.GET("/:metricId", query.GetLogMetricHandler(db))
+				logMetrics.PUT("/:metricId", query.UpdateLogMetricHandler(db))
+				logMetrics.DELETE("/:metricId", query.DeleteLogMetricHandler(db))
+				logMetrics.GET("/:metricId/series", query.LogMetricSeriesHandler(db))
+			}
+
+			savedSearches := queryAPI.Group("/saved-searches")
+			{
+				savedSearches.GET("", query.ListSavedSearchesHandler(db))
+				savedSearches.POST("", query.CreateSavedSearchHandler(db))
+				savedSearches.GET("/:searchId", query.GetSavedSearchHandler(db))
+				savedSearches.PUT("/:searchId", query.UpdateSavedSearchHandler(db))
+				savedSearches.DELETE("/:searchId", query.DeleteSavedSearchHandler(db))
+				savedSearches.POST("/:searchId/run", query.RunSavedSearchHandler(db))
+			}
+
+			imports := queryAPI.Group("/imports")
+			{
+				imports.GET("", query.ListImportsHandler(db))
+				imports.POST("", query.CreateImportHandler(db))
+				imports.GET("/:importId", query.GetImportHandler(db))
+				imports.POST("/:importId/data", query.UploadImportHandler(db, artifactStore))
+			}
+
+			patterns := queryAPI.Group("/patterns")
+			{
+				patterns.GET("", query.ListPatternsHandler(db))
+				patterns.GET("/new", query.NewPatternsHandler(db))
+				patterns.GET("/spikes", query.PatternSpikesHandler(db))
+				patterns.GET("/:patternId", query.GetPatternHandler(db))
+			}
+
+			propertyIndexes := queryAPI.Group("/properties/indexes")
+			{
+				propertyIndexes.GET("", query.ListPropertyIndexesHandler(db))
+				propertyIndexes.POST("", query.CreatePropertyIndexHandler(db, jobs))
+				propertyIndexes.GET("/advice", query.PropertyIndexAdviceHandler(db))
+				propertyIndexes.DELETE("/:propertyKey", query.DeletePropertyIndexHandler(db))
+			}
 		}
 		queryAPI.GET("/metrics/today", query.MetricsTodayHandler(recorder))
 		queryAPI.GET("/metrics/total", query.MetricsTotalHandler(recorder))
-		queryAPI.GET("/analytics/active", query.ActiveSeriesHandler(recorder))
+		queryAPI.GET("/analytics/active", query.ActiveSeriesHandler(recorder, db))
 		queryAPI.GET("/analytics/dist", query.DistributionHandler(recorder))
 		queryAPI.GET("/analytics/retention", query.RetentionHandler(recorder))
 		queryAPI.GET("/properties/schema", query.ListPropertyDefinitionsHandler(db))
@@ -200,11 +307,16 @@ func New(cfg config.Config, publisher queue.Publisher, db *gorm.DB, recorder *me
 		queryAPI.PUT("/properties/schema/:propertyKey", query.UpdatePropertyDefinitionHandler(db))
 	}
 
-	return &http.Server{
+	srv := &http.Server{
 		Addr:              cfg.HTTPAddr,
 		Handler:           router,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
+	if jobs != nil {
+		// Cancel running query jobs, and record it, when the server shuts down.
+		srv.RegisterOnShutdown(jobs.Close)
+	}
+	return srv
 }
 
 func requireAuthReadyMiddleware(db *gorm.DB, authSecret []byte) gin.HandlerFunc {
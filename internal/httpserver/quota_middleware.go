@@ -0,0 +1,37 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/quota"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// quotaMiddleware refuses ingest with 429 while the project is over a quota
+// whose action rejects. Without a database it lets everything through.
+func quotaMiddleware(db *gorm.DB) gin.HandlerFunc {
+	if db == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	quotas := quota.NewEnforcer(db)
+	return func(c *gin.Context) {
+		pid, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+		if quotas.Reject(ctx, pid) {
+			c.Header("Retry-After", "60")
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": http.StatusTooManyRequests, "err": "project quota exceeded"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,475 @@
+// Package importer backfills a project's history from NDJSON: custom logs,
+// track events or Sentry events, keeping their original timestamps. Rows
+// are written straight to the database in batches, bypassing the queue,
+// alert evaluation, live metrics and tails; track events still roll up into
+// track_event_daily, events still group into issues, and stack traces are
+// deobfuscated with the project's uploaded mappings as on ingest.
+//
+// Imported rows count towards the project's daily usage like ingested ones.
+// A project over its quota is not sampled: the part fails with ErrQuota
+// before its next batch is written.
+//
+// Every row has an ingest ID, given by the client or derived from its line,
+// and rows already stored are skipped, so importing a file again adds
+// nothing.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/artifact"
+	"github.com/aak1247/logtap/internal/ingest"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/quota"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of import.
+const (
+	KindLogs   = "logs"   // ingest.CustomLogPayload
+	KindTrack  = "track"  // ingest.TrackEventPayload
+	KindEvents = "events" // Sentry event JSON
+)
+
+// Job statuses.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// MaxLineBytes is the longest line an import reads, as much as the ingest
+// endpoints accept in one request.
+const MaxLineBytes = 5 << 20
+
+// staleAfter is how long a running part may go without progress before it
+// is taken as abandoned (its gateway stopped) and another part may start.
+const staleAfter = 10 * time.Minute
+
+var (
+	ErrInvalidKind = errors.New("importer: kind must be logs, track or events")
+	ErrBusy        = errors.New("importer: another part of this import is running")
+	// ErrInput is wrapped by errors reading the uploaded data.
+	ErrInput = errors.New("importer: unreadable input")
+	// ErrQuota fails a part once the project is over its quota.
+	ErrQuota = errors.New("importer: project quota exceeded")
+)
+
+func ValidKind(kind string) bool {
+	return kind == KindLogs || kind == KindTrack || kind == KindEvents
+}
+
+// LineError is a line of a part that could not be imported.
+type LineError struct {
+	Part  int    `json:"part"`
+	Line  int64  `json:"line"`
+	Error string `json:"error"`
+}
+
+type Importer struct {
+	DB           *gorm.DB
+	Quotas       *quota.Enforcer
+	Deobfuscator *artifact.Deobfuscator // optional
+	BatchSize    int                    // rows per insert and progress update
+	MaxErrors    int                    // line errors kept on a job
+	Now          func() time.Time
+}
+
+func New(db *gorm.DB) *Importer {
+	quotas := quota.NewEnforcer(db)
+	// Every batch sees the usage the one before it recorded.
+	quotas.TTL = 0
+	return &Importer{
+		DB:        db,
+		Quotas:    quotas,
+		BatchSize: 500,
+		MaxErrors: 20,
+		Now:       time.Now,
+	}
+}
+
+// Begin starts a new part of job, unless one is running; it returns the
+// job as claimed.
+func (im *Importer) Begin(ctx context.Context, job model.ImportJob) (model.ImportJob, error) {
+	now := im.Now().UTC()
+	res := im.DB.WithContext(ctx).
+		Model(&model.ImportJob{}).
+		Where("id = ? AND (status <> ? OR updated_at < ?)", job.ID, StatusRunning, now.Add(-staleAfter)).
+		Updates(map[string]any{
+			"status":      StatusRunning,
+			"parts":       gorm.Expr("parts + 1"),
+			"started_at":  gorm.Expr("COALESCE(started_at, ?)", now),
+			"finished_at": nil,
+			"error":       "",
+			"updated_at":  now,
+		})
+	if res.Error != nil {
+		return job, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return job, ErrBusy
+	}
+	err := im.DB.WithContext(ctx).First(&job, job.ID).Error
+	return job, err
+}
+
+// Import reads the NDJSON lines of r into job's project as its current part
+// (see Begin), saving progress after every batch, and finishes the job as
+// done, or as failed when r or the database fail. Lines that are not valid
+// rows are counted and skipped. Rows of a failed batch are not counted;
+// importing the part again picks them up.
+func (im *Importer) Import(ctx context.Context, job model.ImportJob, r io.Reader) (model.ImportJob, error) {
+	var errs []LineError
+	_ = json.Unmarshal(job.Errors, &errs)
+	b := &batch{kind: job.Kind, projectID: strconv.Itoa(job.ProjectID), pid: job.ProjectID, deob: im.Deobfuscator}
+
+	flush := func() error {
+		imported, dups, taken, err := im.flush(ctx, b)
+		if err != nil {
+			return err
+		}
+		b.logs, b.events, b.lines = b.logs[:0], b.events[:0], b.lines[:0]
+		job.Imported += imported
+		job.Duplicates += dups
+		job.Failed += int64(len(taken))
+		for _, l := range taken {
+			if len(errs) < im.MaxErrors {
+				errs = append(errs, LineError{Part: job.Parts, Line: l, Error: "event_id is used by another project"})
+			}
+		}
+		return im.save(ctx, &job, errs, nil)
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), MaxLineBytes)
+	var line int64
+	var err error
+	for sc.Scan() {
+		raw := sc.Bytes()
+		line++
+		job.Bytes += int64(len(raw)) + 1
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		job.Lines++
+		if lerr := b.add(ctx, line, raw); lerr != nil {
+			job.Failed++
+			if len(errs) < im.MaxErrors {
+				errs = append(errs, LineError{Part: job.Parts, Line: line, Error: lerr.Error()})
+			}
+			continue
+		}
+		if b.len() >= im.BatchSize {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		if serr := sc.Err(); serr != nil {
+			err = fmt.Errorf("%w: line %d: %v", ErrInput, line+1, serr)
+		}
+	}
+	if err == nil && b.len() > 0 {
+		err = flush()
+	}
+
+	job.Status = StatusDone
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	}
+	finished := im.Now().UTC()
+	job.FinishedAt = &finished
+	if serr := im.save(context.WithoutCancel(ctx), &job, errs, map[string]any{
+		"status":      job.Status,
+		"error":       job.Error,
+		"finished_at": finished,
+	}); serr != nil && err == nil {
+		err = serr
+	}
+	return job, err
+}
+
+// save records job's progress and the columns in extra.
+func (im *Importer) save(ctx context.Context, job *model.ImportJob, errs []LineError, extra map[string]any) error {
+	if errs == nil {
+		errs = []LineError{}
+	}
+	job.Errors, _ = json.Marshal(errs)
+	job.UpdatedAt = im.Now().UTC()
+	updates := map[string]any{
+		"bytes":      job.Bytes,
+		"lines":      job.Lines,
+		"imported":   job.Imported,
+		"duplicates": job.Duplicates,
+		"failed":     job.Failed,
+		"errors":     job.Errors,
+		"updated_at": job.UpdatedAt,
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	return im.DB.WithContext(ctx).Model(&model.ImportJob{}).Where("id = ?", job.ID).Updates(updates).Error
+}
+
+// batch collects the rows of the lines read since the last flush.
+type batch struct {
+	kind      string
+	projectID string
+	pid       int
+	deob      *artifact.Deobfuscator
+	logs      []model.Log
+	events    []model.Event
+	lines     []int64 // line of each row
+}
+
+func (b *batch) len() int { return len(b.logs) + len(b.events) }
+
+type logLine struct {
+	ingest.CustomLogPayload
+	IngestID string `json:"ingest_id"`
+}
+
+type trackLine struct {
+	ingest.TrackEventPayload
+	IngestID string `json:"ingest_id"`
+}
+
+// add decodes a line into a row; the error says why the line is skipped.
+func (b *batch) add(ctx context.Context, line int64, raw []byte) error {
+	n := b.len()
+	if err := b.decode(ctx, raw); err != nil {
+		return err
+	}
+	if b.len() > n {
+		b.lines = append(b.lines, line)
+	}
+	return nil
+}
+
+func (b *batch) decode(ctx context.Context, raw []byte) error {
+	switch b.kind {
+	case KindEvents:
+		var event map[string]any
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+		if event["timestamp"] == nil {
+			return errors.New("timestamp required")
+		}
+		if id, _ := event["event_id"].(string); strings.TrimSpace(id) == "" {
+			event["event_id"] = uuid.NewSHA1(uuid.Nil, raw).String()
+		}
+		// Before the row is built: the fingerprint comes from the frames.
+		if _, err := b.deob.Event(ctx, b.pid, event); err != nil {
+			log.Printf("importer: deobfuscate event: %v", err)
+		}
+		row, err := store.EventRowFromMap(b.projectID, event)
+		if err != nil {
+			return err
+		}
+		b.events = append(b.events, row)
+		return nil
+
+	case KindTrack:
+		var ev trackLine
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+		name := strings.TrimSpace(ev.Name)
+		if name == "" {
+			return errors.New("name required")
+		}
+		// Stored as TrackEventHandler queues it: a log at level event.
+		return b.addLog(ctx, raw, ev.IngestID, ingest.CustomLogPayload{
+			Level:     "event",
+			Message:   name,
+			DeviceID:  ev.DeviceID,
+			TraceID:   ev.TraceID,
+			SpanID:    ev.SpanID,
+			Fields:    ev.Properties,
+			Timestamp: ev.Timestamp,
+			Extra:     ev.Extra,
+			Tags:      ev.Tags,
+			User:      ev.User,
+			SDK:       ev.SDK,
+			Contexts:  ev.Contexts,
+		})
+
+	default:
+		var lp logLine
+		if err := json.Unmarshal(raw, &lp); err != nil {
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+		if strings.TrimSpace(lp.Message) == "" {
+			return errors.New("message required")
+		}
+		if strings.TrimSpace(lp.Level) == "" {
+			lp.Level = "info"
+		}
+		return b.addLog(ctx, raw, lp.IngestID, lp.CustomLogPayload)
+	}
+}
+
+func (b *batch) addLog(ctx context.Context, raw []byte, id string, lp ingest.CustomLogPayload) error {
+	if lp.Timestamp == nil {
+		return errors.New("timestamp required")
+	}
+	if len(lp.Fields) > 0 {
+		release, _ := lp.Fields["release"].(string)
+		if release == "" {
+			release = lp.Tags["release"]
+		}
+		if _, err := b.deob.Fields(ctx, b.pid, release, lp.Fields); err != nil {
+			log.Printf("importer: deobfuscate log: %v", err)
+		}
+	}
+	row, err := store.LogRowFromPayloadWithIngestID(b.projectID, lp, ingestID(id, raw))
+	if err != nil {
+		return err
+	}
+	b.logs = append(b.logs, row)
+	return nil
+}
+
+// ingestID is the client's ingest ID as a UUID, hashed when it is not one;
+// without one it is the hash of the line.
+func ingestID(id string, raw []byte) uuid.UUID {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return uuid.NewSHA1(uuid.Nil, raw)
+	}
+	if u, err := uuid.Parse(id); err == nil {
+		return u
+	}
+	return uuid.NewSHA1(uuid.Nil, []byte(id))
+}
+
+// flush stores the rows of b that are not stored yet, returning how many it
+// stored, how many it skipped and the lines of rows whose ID another
+// project's row already has. It stores nothing while the project is over
+// its quota.
+func (im *Importer) flush(ctx context.Context, b *batch) (int64, int64, []int64, error) {
+	if im.Quotas != nil {
+		projectID, _ := strconv.Atoi(b.projectID)
+		if st, ok := im.Quotas.Status(ctx, projectID); ok && (st.Reject() || st.Downsample()) {
+			return 0, 0, nil, ErrQuota
+		}
+	}
+	if len(b.events) > 0 {
+		return im.flushEvents(ctx, b.events, b.lines)
+	}
+	imported, dups, err := im.flushLogs(ctx, b.logs)
+	return imported, dups, nil, err
+}
+
+func (im *Importer) flushLogs(ctx context.Context, rows []model.Log) (int64, int64, error) {
+	if len(rows) == 0 {
+		return 0, 0, nil
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, *r.IngestID)
+	}
+	var found []uuid.UUID
+	if err := im.DB.WithContext(ctx).
+		Model(&model.Log{}).
+		Where("project_id = ? AND ingest_id IN ?", rows[0].ProjectID, ids).
+		Pluck("ingest_id", &found).Error; err != nil {
+		return 0, 0, err
+	}
+	seen := make(map[uuid.UUID]bool, len(rows))
+	for _, id := range found {
+		seen[id] = true
+	}
+	fresh := make([]model.Log, 0, len(rows))
+	for _, r := range rows {
+		if !seen[*r.IngestID] {
+			seen[*r.IngestID] = true
+			fresh = append(fresh, r)
+		}
+	}
+	if err := store.InsertLogsAndTrackEventsBatch(ctx, im.DB, fresh); err != nil {
+		return 0, 0, err
+	}
+	if err := store.UpsertProjectUsageDailyBatch(ctx, im.DB, store.UsageRowsFromLogs(fresh)); err != nil {
+		log.Printf("importer: record log usage: %v", err)
+	}
+	return int64(len(fresh)), int64(len(rows) - len(fresh)), nil
+}
+
+// flushEvents is flushLogs for events. Event IDs are unique across
+// projects, so an ID another project already has is not a duplicate but a
+// line that cannot be imported.
+func (im *Importer) flushEvents(ctx context.Context, rows []model.Event, lines []int64) (int64, int64, []int64, error) {
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	var found []uuid.UUID
+	if err := im.DB.WithContext(ctx).
+		Model(&model.Event{}).
+		Where("project_id = ? AND id IN ?", rows[0].ProjectID, ids).
+		Pluck("id", &found).Error; err != nil {
+		return 0, 0, nil, err
+	}
+	seen := make(map[uuid.UUID]bool, len(rows))
+	for _, id := range found {
+		seen[id] = true
+	}
+	rest := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			rest = append(rest, id)
+		}
+	}
+	var foreign []uuid.UUID
+	if len(rest) > 0 {
+		if err := im.DB.WithContext(ctx).
+			Model(&model.Event{}).
+			Where("id IN ?", rest).
+			Pluck("id", &foreign).Error; err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	taken := make(map[uuid.UUID]bool, len(foreign))
+	for _, id := range foreign {
+		taken[id] = true
+	}
+
+	fresh := make([]model.Event, 0, len(rows))
+	var takenLines []int64
+	for i, r := range rows {
+		switch {
+		case taken[r.ID]:
+			takenLines = append(takenLines, lines[i])
+		case !seen[r.ID]:
+			seen[r.ID] = true
+			fresh = append(fresh, r)
+		}
+	}
+	// Issues are updated with the events, so a batch whose issues fail is
+	// not stored and importing the part again counts them then. Their
+	// triggers are not alerted on.
+	if _, err := store.InsertEventsWithIssues(ctx, im.DB, fresh, fresh); err != nil {
+		return 0, 0, nil, err
+	}
+	if err := store.UpsertProjectUsageDailyBatch(ctx, im.DB, store.UsageRowsFromEvents(fresh)); err != nil {
+		log.Printf("importer: record event usage: %v", err)
+	}
+	return int64(len(fresh)), int64(len(rows) - len(fresh) - len(takenLines)), takenLines, nil
+}
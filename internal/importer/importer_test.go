@@ -0,0 +1,266 @@
+package importer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/artifact"
+	"github.com/aak1247/logtap/internal/importer"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func newJob(t *testing.T, db *gorm.DB, kind string) model.ImportJob {
+	t.Helper()
+	job := model.ImportJob{ProjectID: 1, UserID: 1, Kind: kind, Status: importer.StatusPending, Errors: []byte("[]")}
+	if err := db.Create(&job).Error; err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	return job
+}
+
+func runPart(t *testing.T, im *importer.Importer, job model.ImportJob, data string) model.ImportJob {
+	t.Helper()
+	job, err := im.Begin(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	job, err = im.Import(context.Background(), job, strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	return job
+}
+
+func TestImportLogsIdempotent(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	im := importer.New(db)
+	im.BatchSize = 2
+	job := newJob(t, db, importer.KindLogs)
+
+	data := strings.Join([]string{
+		`{"message":"a","timestamp":"2024-01-02T03:04:05Z","ingest_id":"order-1"}`,
+		`{"message":"b","level":"error","timestamp":"2024-01-02T03:04:06Z"}`,
+		``,
+		`{"message":"a again","timestamp":"2024-01-02T03:04:07Z","ingest_id":"order-1"}`,
+		`{"message":"no time"}`,
+		`not json`,
+		`{"message":"c","timestamp":"2024-01-02T03:04:08Z"}`,
+	}, "\n")
+
+	job = runPart(t, im, job, data)
+	if job.Status != importer.StatusDone || job.Parts != 1 || job.Lines != 6 || job.Imported != 3 || job.Duplicates != 1 || job.Failed != 2 {
+		t.Fatalf("first part = %+v", job)
+	}
+	var errs []importer.LineError
+	if err := json.Unmarshal(job.Errors, &errs); err != nil || len(errs) != 2 || errs[0].Line != 5 || errs[1].Line != 6 {
+		t.Fatalf("errors = %s", job.Errors)
+	}
+
+	var logs []model.Log
+	if err := db.Order("timestamp").Find(&logs).Error; err != nil {
+		t.Fatalf("list logs: %v", err)
+	}
+	if len(logs) != 3 || logs[0].Message != "a" || logs[0].Level != "info" || !logs[0].Timestamp.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("logs = %+v", logs)
+	}
+
+	// The same file again adds nothing.
+	job = runPart(t, im, job, data)
+	if job.Parts != 2 || job.Imported != 3 || job.Duplicates != 5 {
+		t.Fatalf("second part = %+v", job)
+	}
+	var n int64
+	db.Model(&model.Log{}).Count(&n)
+	if n != 3 {
+		t.Fatalf("logs after re-import = %d", n)
+	}
+}
+
+func TestImportTrackRollsUp(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	im := importer.New(db)
+	job := newJob(t, db, importer.KindTrack)
+
+	job = runPart(t, im, job, strings.Join([]string{
+		`{"name":"signup","timestamp":"2024-03-01T10:00:00Z","user":{"id":"u1"}}`,
+		`{"name":"purchase","timestamp":"2024-03-01T11:00:00Z","user":{"id":"u1"},"properties":{"amount":3}}`,
+		`{"name":"purchase","timestamp":"2024-03-02T11:00:00Z","user":{"id":"u1"}}`,
+		`{"timestamp":"2024-03-02T11:00:00Z"}`,
+	}, "\n"))
+	if job.Imported != 3 || job.Failed != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+
+	var daily []model.TrackEventDaily
+	if err := db.Where("name = ?", "purchase").Order("day").Find(&daily).Error; err != nil {
+		t.Fatalf("list daily: %v", err)
+	}
+	if len(daily) != 2 || daily[0].Day != "2024-03-01" || daily[0].DistinctID != "u1" || daily[0].Events != 1 {
+		t.Fatalf("daily = %+v", daily)
+	}
+}
+
+func TestImportEventsCreatesIssues(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	im := importer.New(db)
+	job := newJob(t, db, importer.KindEvents)
+
+	data := strings.Join([]string{
+		`{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","timestamp":"2024-05-01T00:00:00Z","level":"error","message":"boom"}`,
+		`{"timestamp":1714521600,"level":"error","message":"boom"}`,
+		`{"level":"error","message":"no time"}`,
+	}, "\n")
+	job = runPart(t, im, job, data)
+	if job.Imported != 2 || job.Failed != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+	job = runPart(t, im, job, data)
+	if job.Imported != 2 || job.Duplicates != 2 {
+		t.Fatalf("re-import = %+v", job)
+	}
+
+	var issues []model.Issue
+	if err := db.Find(&issues).Error; err != nil {
+		t.Fatalf("list issues: %v", err)
+	}
+	if len(issues) != 1 || issues[0].TimesSeen != 2 || issues[0].LastSeen.Year() != 2024 {
+		t.Fatalf("issues = %+v", issues)
+	}
+}
+
+func TestImportEventsOfAnotherProject(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	im := importer.New(db)
+	other := model.Event{ID: uuid.MustParse("9ec79c33ec9942ab8353589fcb2e04dc"), ProjectID: 2, Timestamp: time.Now().UTC(), Level: "error", Data: []byte(`{}`)}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+
+	job := runPart(t, im, newJob(t, db, importer.KindEvents), strings.Join([]string{
+		`{"timestamp":"2024-05-01T00:00:00Z","level":"error","message":"mine"}`,
+		`{"event_id":"9ec79c33ec9942ab8353589fcb2e04dc","timestamp":"2024-05-01T00:00:00Z","level":"error","message":"theirs"}`,
+	}, "\n"))
+	var errs []importer.LineError
+	_ = json.Unmarshal(job.Errors, &errs)
+	if job.Imported != 1 || job.Duplicates != 0 || job.Failed != 1 || len(errs) != 1 || errs[0].Line != 2 {
+		t.Fatalf("job = %+v", job)
+	}
+	var got model.Event
+	if err := db.First(&got, "id = ?", other.ID).Error; err != nil || got.ProjectID != 2 {
+		t.Fatalf("other project's event = %+v (%v)", got, err)
+	}
+}
+
+func TestImportEventsDeobfuscated(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	objects, err := archive.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	mapping := "com.example.app.MainActivity -> a.a:\n    1:1:void handle(int):20 -> b\n"
+	if _, err := artifact.Upload(context.Background(), db, objects, 1, "app@1.0", "~/mapping.txt", "", []byte(mapping)); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	im := importer.New(db)
+	im.Deobfuscator = artifact.NewDeobfuscator(db, objects)
+
+	line := `{"platform":"java","release":"app@1.0","timestamp":"2024-05-01T00:00:00Z","level":"error",` +
+		`"exception":{"values":[{"type":"E","stacktrace":{"frames":[{"module":"a.a","function":"b","lineno":1}]}}]}}`
+	job := runPart(t, im, newJob(t, db, importer.KindEvents), line)
+	if job.Imported != 1 {
+		t.Fatalf("job = %+v", job)
+	}
+	var ev model.Event
+	if err := db.First(&ev).Error; err != nil || !strings.Contains(string(ev.Data), "com.example.app.MainActivity") {
+		t.Fatalf("event = %s (%v)", ev.Data, err)
+	}
+}
+
+func TestImportEventsFailWithIssues(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	if err := db.Migrator().DropTable(&model.IssueActivity{}); err != nil {
+		t.Fatalf("drop: %v", err)
+	}
+	im := importer.New(db)
+	job, err := im.Begin(context.Background(), newJob(t, db, importer.KindEvents))
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	job, err = im.Import(context.Background(), job, strings.NewReader(`{"timestamp":"2024-05-01T00:00:00Z","level":"error","message":"boom"}`))
+	if err == nil || job.Status != importer.StatusFailed || job.Imported != 0 {
+		t.Fatalf("Import = %+v, %v", job, err)
+	}
+	var n int64
+	db.Model(&model.Event{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("events = %d, want none until their issues are stored", n)
+	}
+}
+
+func TestImportStopsOverQuota(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	if err := db.Create(&model.ProjectQuota{ProjectID: 1, Enabled: true, MaxDailyRows: 2, Action: "reject", Channels: []byte("[]")}).Error; err != nil {
+		t.Fatalf("create quota: %v", err)
+	}
+	im := importer.New(db)
+	im.BatchSize = 2
+	job, err := im.Begin(context.Background(), newJob(t, db, importer.KindLogs))
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	var lines []string
+	for i := 0; i < 5; i++ {
+		lines = append(lines, fmt.Sprintf(`{"message":"m%d","timestamp":"2024-01-01T00:00:00Z"}`, i))
+	}
+	job, err = im.Import(context.Background(), job, strings.NewReader(strings.Join(lines, "\n")))
+	if !errors.Is(err, importer.ErrQuota) || job.Status != importer.StatusFailed || job.Imported != 2 {
+		t.Fatalf("Import = %+v, %v", job, err)
+	}
+
+	// The imported rows count as today's usage.
+	var usage model.ProjectUsageDaily
+	if err := db.Where("project_id = ?", 1).First(&usage).Error; err != nil || usage.Logs != 2 {
+		t.Fatalf("usage = %+v (%v)", usage, err)
+	}
+}
+
+func TestBeginBusy(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	im := importer.New(db)
+	job := newJob(t, db, importer.KindLogs)
+
+	if _, err := im.Begin(context.Background(), job); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := im.Begin(context.Background(), job); !errors.Is(err, importer.ErrBusy) {
+		t.Fatalf("second Begin = %v, want ErrBusy", err)
+	}
+
+	// A part that stopped long ago no longer holds the import.
+	im.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := im.Begin(context.Background(), job); err != nil {
+		t.Fatalf("Begin after stale part: %v", err)
+	}
+}
+
+func TestImportLineTooLong(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	im := importer.New(db)
+	job, err := im.Begin(context.Background(), newJob(t, db, importer.KindLogs))
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	job, err = im.Import(context.Background(), job, strings.NewReader(strings.Repeat("x", importer.MaxLineBytes+1)))
+	if !errors.Is(err, importer.ErrInput) || job.Status != importer.StatusFailed || job.Error == "" {
+		t.Fatalf("Import = %+v, %v", job, err)
+	}
+}
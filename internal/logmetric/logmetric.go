@@ -0,0 +1,533 @@
+// Package logmetric materializes log-derived metrics: a search query paired
+// with an aggregation over one field, grouped by other fields, rolled up per
+// interval into the metric_points table.
+package logmetric
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"gorm.io/gorm"
+)
+
+// Aggregations.
+const (
+	Count = "count"
+	Sum   = "sum"
+	Avg   = "avg"
+	Min   = "min"
+	Max   = "max"
+	P50   = "p50"
+	P90   = "p90"
+	P95   = "p95"
+	P99   = "p99"
+)
+
+var percentiles = map[string]float64{P50: 50, P90: 90, P95: 95, P99: 99}
+
+const (
+	MinIntervalSec = 10
+	MaxIntervalSec = 86400
+	MaxGroupBy     = 5
+	// MaxGroups caps the series of one rollup; the logs of further groups
+	// are aggregated into a series whose labels are all OtherLabel.
+	MaxGroups  = 1000
+	OtherLabel = "_other"
+)
+
+var ErrInvalid = errors.New("logmetric: invalid definition")
+
+// Log columns a path can name; anything else is read from fields.
+var columns = map[string]bool{"level": true, "trace_id": true, "span_id": true, "distinct_id": true, "device_id": true}
+
+// Fields the search DSL reads from the fields column without the prefix.
+var fieldAliases = map[string]bool{"environment": true, "service": true, "tag": true}
+
+var fieldPath = regexp.MustCompile(`^fields(\.[A-Za-z0-9_]+)+$`)
+
+func validPath(p string) bool {
+	return columns[p] || fieldAliases[p] || fieldPath.MatchString(p)
+}
+
+// GroupBy decodes a metric's group-by paths.
+func GroupBy(m model.LogMetric) []string {
+	var out []string
+	_ = json.Unmarshal(m.GroupBy, &out)
+	return out
+}
+
+// Validate checks a definition; errors wrap ErrInvalid.
+func Validate(m model.LogMetric) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+	}
+	if strings.TrimSpace(m.Name) == "" || len(m.Name) > 100 {
+		return invalid("name is required (at most 100 characters)")
+	}
+	switch m.Aggregation {
+	case Count:
+	case Sum, Avg, Min, Max, P50, P90, P95, P99:
+		if !validPath(m.Field) {
+			return invalid("field must be a log column or fields.<path> for %s", m.Aggregation)
+		}
+	default:
+		return invalid("aggregation must be one of count, sum, avg, min, max, p50, p90, p95, p99")
+	}
+	if m.IntervalSec < MinIntervalSec || m.IntervalSec > MaxIntervalSec {
+		return invalid("interval_sec must be between %d and %d", MinIntervalSec, MaxIntervalSec)
+	}
+	var groupBy []string
+	if len(m.GroupBy) > 0 {
+		if err := json.Unmarshal(m.GroupBy, &groupBy); err != nil {
+			return invalid("group_by must be a list of fields")
+		}
+	}
+	if len(groupBy) > MaxGroupBy {
+		return invalid("at most %d group_by fields", MaxGroupBy)
+	}
+	for _, g := range groupBy {
+		if !validPath(g) {
+			return invalid("group_by %q must be a log column or fields.<path>", g)
+		}
+	}
+	parsed, err := search.NewQueryParser().Parse(m.Query)
+	if err == nil {
+		err = postgres.Validate(parsed.Root)
+	}
+	if err != nil {
+		return invalid("query: %v", err)
+	}
+	return nil
+}
+
+type logRow struct {
+	ID         int64
+	Timestamp  time.Time
+	Level      string
+	TraceID    string
+	SpanID     string
+	DistinctID string
+	DeviceID   string
+	Fields     []byte
+}
+
+func (r *logRow) column(name string) string {
+	switch name {
+	case "level":
+		return r.Level
+	case "trace_id":
+		return r.TraceID
+	case "span_id":
+		return r.SpanID
+	case "distinct_id":
+		return r.DistinctID
+	default:
+		return r.DeviceID
+	}
+}
+
+// lookup resolves path on a row whose fields were decoded into fields.
+func (r *logRow) lookup(fields map[string]any, path string) (any, bool) {
+	if columns[path] {
+		v := r.column(path)
+		return v, v != ""
+	}
+	var cur any = fields
+	for _, p := range strings.Split(strings.TrimPrefix(path, "fields."), ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+type accumulator struct {
+	labels   map[string]string
+	count    int64
+	sum      float64
+	min, max float64
+	values   []float64
+	pct      *float64 // the percentile, when computed in the database
+}
+
+func (a *accumulator) add(v float64, keep bool) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.count++
+	a.sum += v
+	if keep {
+		a.values = append(a.values, v)
+	}
+}
+
+// merge adds the aggregates of n more values.
+func (a *accumulator) merge(n int64, sum, min, max float64) {
+	if a.count == 0 || min < a.min {
+		a.min = min
+	}
+	if a.count == 0 || max > a.max {
+		a.max = max
+	}
+	a.count += n
+	a.sum += sum
+}
+
+func (a *accumulator) value(agg string) float64 {
+	switch agg {
+	case Count:
+		return float64(a.count)
+	case Sum:
+		return a.sum
+	case Avg:
+		return a.sum / float64(a.count)
+	case Min:
+		return a.min
+	case Max:
+		return a.max
+	default:
+		if a.pct != nil {
+			return *a.pct
+		}
+		return Percentile(a.values, percentiles[agg])
+	}
+}
+
+// Percentile returns the p-th percentile of values, interpolating between
+// the closest ranks. It sorts values.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := p / 100 * float64(len(values)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return values[lo] + (values[hi]-values[lo])*(rank-float64(lo))
+}
+
+// Rollup aggregates the metric's logs with from <= timestamp < to into one
+// point per bucket and group. Ungrouped count metrics get a zero point for
+// empty buckets so that their series has no gaps. The aggregation runs in
+// the database, except for percentiles on SQLite, which has no
+// percentile_cont and reads the values into memory.
+func Rollup(ctx context.Context, db *gorm.DB, m model.LogMetric, from, to time.Time) ([]model.MetricPoint, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	parsed, err := search.NewQueryParser().Parse(m.Query)
+	if err != nil {
+		return nil, err
+	}
+	interval := time.Duration(m.IntervalSec) * time.Second
+
+	q := db.WithContext(ctx).Model(&model.Log{}).
+		Where("project_id = ? AND timestamp >= ? AND timestamp < ?", m.ProjectID, from.UTC(), to.UTC())
+	a, err := postgres.NewAdapter(db).ForProject(ctx, m.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if q, err = a.Where(q, parsed.Root); err != nil {
+		return nil, err
+	}
+
+	var acc map[key]*accumulator
+	if percentiles[m.Aggregation] > 0 && strings.EqualFold(db.Dialector.Name(), "sqlite") {
+		acc, err = rollupRows(q, m, interval)
+	} else {
+		acc, err = rollupSQL(q, a, m, from.UTC().Truncate(interval))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Aggregation == Count && len(GroupBy(m)) == 0 {
+		for b := from.UTC().Truncate(interval); b.Before(to); b = b.Add(interval) {
+			if k := (key{bucket: b.Unix()}); acc[k] == nil {
+				acc[k] = &accumulator{}
+			}
+		}
+	}
+
+	points := make([]model.MetricPoint, 0, len(acc))
+	for k, a := range acc {
+		labels := []byte("{}")
+		if len(a.labels) > 0 {
+			labels, _ = json.Marshal(a.labels)
+		}
+		points = append(points, model.MetricPoint{
+			ProjectID: m.ProjectID,
+			MetricID:  m.ID,
+			GroupKey:  k.group,
+			Bucket:    time.Unix(k.bucket, 0).UTC(),
+			Labels:    labels,
+			Value:     a.value(m.Aggregation),
+			Count:     a.count,
+		})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if !points[i].Bucket.Equal(points[j].Bucket) {
+			return points[i].Bucket.Before(points[j].Bucket)
+		}
+		return points[i].GroupKey < points[j].GroupKey
+	})
+	return points, nil
+}
+
+// key identifies a point: its bucket start in Unix seconds and its series.
+type key struct {
+	bucket int64
+	group  string
+}
+
+// series assigns groups to series in the order they are first seen; past
+// MaxGroups the rest share a series whose labels are all OtherLabel.
+type series struct {
+	groupBy []string
+	groups  map[string]map[string]string
+	other   bool // whether a group went to the OtherLabel series
+}
+
+func newSeries(groupBy []string) *series {
+	return &series{groupBy: groupBy, groups: map[string]map[string]string{}}
+}
+
+// of returns the key and labels of the series a group's labels belong to.
+func (s *series) of(labels map[string]string) (string, map[string]string) {
+	group := groupKey(labels)
+	if _, ok := s.groups[group]; !ok {
+		if len(s.groups) >= MaxGroups {
+			for _, g := range s.groupBy {
+				labels[g] = OtherLabel
+			}
+			group = groupKey(labels)
+			s.other = true
+		}
+		s.groups[group] = labels
+	}
+	return group, s.groups[group]
+}
+
+// rollupSQL aggregates the logs of q per bucket and group in the database.
+// Buckets start at base plus a multiple of the interval.
+func rollupSQL(q *gorm.DB, a *postgres.PostgresAdapter, m model.LogMetric, base time.Time) (map[key]*accumulator, error) {
+	groupBy := GroupBy(m)
+	sec := int64(m.IntervalSec)
+	bucket := fmt.Sprintf("%d + ((%s - %d) / %d) * %d", base.Unix(), a.TimeBucket(1), base.Unix(), sec, sec)
+
+	sel := []string{bucket + " AS bucket"}
+	group := []string{"bucket"}
+	labels := make([]string, MaxGroupBy)
+	for i := range labels {
+		labels[i] = "''"
+		if i < len(groupBy) {
+			f, err := a.LogField(groupBy[i])
+			if err != nil {
+				return nil, err
+			}
+			labels[i] = "COALESCE(" + f.Text + ", '')"
+			group = append(group, fmt.Sprintf("g%d", i))
+		}
+		sel = append(sel, fmt.Sprintf("%s AS g%d", labels[i], i))
+	}
+	labels = labels[:len(groupBy)]
+
+	value := ""
+	q = q.Session(&gorm.Session{})
+	if m.Aggregation == Count {
+		sel = append(sel, "COUNT(*) AS n, 0 AS sum, 0 AS min, 0 AS max")
+	} else {
+		f, err := a.LogField(m.Field)
+		if err != nil {
+			return nil, err
+		}
+		value = f.Number
+		q = q.Where(value + " IS NOT NULL").Session(&gorm.Session{})
+		sel = append(sel, fmt.Sprintf("COUNT(*) AS n, SUM(%s) AS sum, MIN(%s) AS min, MAX(%s) AS max", value, value, value))
+	}
+	pct := percentiles[m.Aggregation]
+	if pct > 0 {
+		sel = append(sel, fmt.Sprintf("percentile_cont(%g) WITHIN GROUP (ORDER BY %s) AS pct", pct/100, value))
+	}
+
+	var rows []struct {
+		Bucket             int64
+		G0, G1, G2, G3, G4 string
+		N                  int64
+		Sum, Min, Max      float64
+		Pct                *float64
+	}
+	if err := q.Select(strings.Join(sel, ", ")).
+		Group(strings.Join(group, ", ")).
+		Order(strings.Join(group, ", ")).
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("logmetric rollup: %w", err)
+	}
+
+	other := make(map[string]string, len(groupBy))
+	for _, g := range groupBy {
+		other[g] = OtherLabel
+	}
+	otherKey := groupKey(other)
+
+	acc := map[key]*accumulator{}
+	ss := newSeries(groupBy)
+	var kept [][]any // the labels of the groups with their own series
+	for _, r := range rows {
+		group := ""
+		var named map[string]string
+		if len(groupBy) > 0 {
+			values := []string{r.G0, r.G1, r.G2, r.G3, r.G4}[:len(groupBy)]
+			l := make(map[string]string, len(groupBy))
+			for i, g := range groupBy {
+				l[g] = values[i]
+			}
+			before := len(ss.groups)
+			if group, named = ss.of(l); len(ss.groups) > before && group != otherKey {
+				tuple := make([]any, len(values))
+				for i, v := range values {
+					tuple[i] = v
+				}
+				kept = append(kept, tuple)
+			}
+		}
+		k := key{bucket: r.Bucket, group: group}
+		ac := acc[k]
+		if ac == nil {
+			ac = &accumulator{labels: named}
+			acc[k] = ac
+		}
+		ac.merge(r.N, r.Sum, r.Min, r.Max)
+		if group != otherKey {
+			ac.pct = r.Pct
+		}
+	}
+
+	// Percentiles of the OtherLabel series do not follow from those of its
+	// groups: compute them over the logs outside the kept groups.
+	if pct > 0 && ss.other {
+		var prows []struct {
+			Bucket int64
+			Pct    *float64
+		}
+		if err := q.Select(fmt.Sprintf("%s AS bucket, percentile_cont(%g) WITHIN GROUP (ORDER BY %s) AS pct", bucket, pct/100, value)).
+			Where("("+strings.Join(labels, ", ")+") NOT IN ?", kept).
+			Group("bucket").
+			Find(&prows).Error; err != nil {
+			return nil, fmt.Errorf("logmetric rollup: %w", err)
+		}
+		for _, r := range prows {
+			if ac := acc[key{bucket: r.Bucket, group: otherKey}]; ac != nil {
+				ac.pct = r.Pct
+			}
+		}
+	}
+	return acc, nil
+}
+
+// rollupRows aggregates the logs of q in memory.
+func rollupRows(q *gorm.DB, m model.LogMetric, interval time.Duration) (map[key]*accumulator, error) {
+	groupBy := GroupBy(m)
+	keep := percentiles[m.Aggregation] > 0
+	acc := map[key]*accumulator{}
+	ss := newSeries(groupBy)
+	var batch []logRow
+	err := q.Select("id, timestamp, level, trace_id, span_id, distinct_id, device_id, fields").
+		FindInBatches(&batch, 5000, func(*gorm.DB, int) error {
+			for i := range batch {
+				r := &batch[i]
+				fields := map[string]any{}
+				_ = json.Unmarshal(r.Fields, &fields)
+
+				v := 1.0
+				if m.Aggregation != Count {
+					raw, ok := r.lookup(fields, m.Field)
+					if !ok {
+						continue
+					}
+					if v, ok = toFloat(raw); !ok {
+						continue
+					}
+				}
+
+				group := ""
+				var labels map[string]string
+				if len(groupBy) > 0 {
+					l := make(map[string]string, len(groupBy))
+					for _, g := range groupBy {
+						raw, _ := r.lookup(fields, g)
+						l[g] = labelValue(raw)
+					}
+					group, labels = ss.of(l)
+				}
+
+				k := key{bucket: r.Timestamp.UTC().Truncate(interval).Unix(), group: group}
+				a := acc[k]
+				if a == nil {
+					a = &accumulator{labels: labels}
+					acc[k] = a
+				}
+				a.add(v, keep)
+			}
+			return nil
+		}).Error
+	return acc, err
+}
+
+// groupKey identifies a series by its labels.
+func groupKey(labels map[string]string) string {
+	b, _ := json.Marshal(labels) // keys are sorted
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func labelValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,179 @@
+package logmetric_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/detector"
+	"github.com/aak1247/logtap/internal/logmetric"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/datatypes"
+)
+
+func TestValidate(t *testing.T) {
+	ok := model.LogMetric{Name: "pay_latency", Aggregation: logmetric.P95, Field: "fields.latency_ms", GroupBy: datatypes.JSON(`["service","fields.route"]`), IntervalSec: 60}
+	if err := logmetric.Validate(ok); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for name, m := range map[string]model.LogMetric{
+		"aggregation": {Name: "x", Aggregation: "median", IntervalSec: 60},
+		"field":       {Name: "x", Aggregation: logmetric.Sum, Field: "latency_ms; drop table logs", IntervalSec: 60},
+		"interval":    {Name: "x", Aggregation: logmetric.Count, IntervalSec: 1},
+		"group_by":    {Name: "x", Aggregation: logmetric.Count, IntervalSec: 60, GroupBy: datatypes.JSON(`["message"]`)},
+	} {
+		if err := logmetric.Validate(m); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{40, 10, 30, 20}
+	if got := logmetric.Percentile(values, 50); got != 25 {
+		t.Fatalf("p50 = %v", got)
+	}
+	if got := logmetric.Percentile(values, 100); got != 40 {
+		t.Fatalf("p100 = %v", got)
+	}
+}
+
+func TestWorkerRollup(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	ctx := context.Background()
+	t0 := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var logs []model.Log
+	add := func(at time.Time, level, service, route string, latency float64) {
+		fields, _ := json.Marshal(map[string]any{"service": service, "route": route, "latency_ms": latency})
+		logs = append(logs, model.Log{ProjectID: 1, Timestamp: at, Level: level, Message: "request", Fields: fields})
+	}
+	for i := 0; i < 10; i++ {
+		add(t0.Add(time.Duration(i)*time.Second), "error", "checkout", "/pay", float64(100+i*10))
+	}
+	add(t0.Add(10*time.Second), "info", "checkout", "/pay", 1000)
+	add(t0.Add(70*time.Second), "error", "search", "/find", 5)
+	add(t0.Add(190*time.Second), "error", "checkout", "/pay", 300)
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+
+	errorsPerMin := model.LogMetric{ProjectID: 1, Name: "checkout_errors", Query: "service:checkout level:error", Aggregation: logmetric.Count, GroupBy: datatypes.JSON(`[]`), IntervalSec: 60, Enabled: true}
+	latency := model.LogMetric{ProjectID: 1, Name: "latency", Aggregation: logmetric.P95, Field: "fields.latency_ms", GroupBy: datatypes.JSON(`["fields.route"]`), IntervalSec: 60, Enabled: true}
+	for _, m := range []*model.LogMetric{&errorsPerMin, &latency} {
+		if err := db.Create(m).Error; err != nil {
+			t.Fatalf("create metric: %v", err)
+		}
+	}
+	rule := model.AlertRule{ProjectID: 1, Name: "errors", Enabled: true, Source: "metrics",
+		Match: datatypes.JSON(`{"fieldsAll":[{"path":"metric","op":"eq","value":"checkout_errors"},{"path":"value","op":"gte","value":1}]}`)}
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+
+	w := logmetric.NewWorker(db)
+	w.Backfill = 5 * time.Minute
+	w.Delay = 0
+	w.Now = func() time.Time { return t0.Add(4 * time.Minute) }
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	series, err := logmetric.ReadSeries(ctx, db, errorsPerMin.ID, t0.Add(-time.Hour), t0.Add(time.Hour), nil)
+	if err != nil || len(series) != 1 {
+		t.Fatalf("ReadSeries = %+v err=%v", series, err)
+	}
+	var counts []string
+	for _, p := range series[0].Points {
+		counts = append(counts, fmt.Sprintf("%s=%v", p.Bucket.Format("15:04"), p.Value))
+	}
+	if got, want := fmt.Sprint(counts), "[11:59=0 12:00=10 12:01=0 12:02=0 12:03=1]"; got != want {
+		t.Fatalf("counts = %s, want %s", got, want)
+	}
+
+	series, err = logmetric.ReadSeries(ctx, db, latency.ID, t0, t0.Add(time.Minute), map[string]string{"fields.route": "/pay"})
+	if err != nil || len(series) != 1 || len(series[0].Points) != 1 {
+		t.Fatalf("ReadSeries latency = %+v err=%v", series, err)
+	}
+	// 100..190 plus 1000: p95 interpolates between 190 and 1000.
+	if p := series[0].Points[0]; p.Count != 11 || p.Value != 595 {
+		t.Fatalf("p95 point = %+v", p)
+	}
+
+	var states int64
+	db.Model(&model.AlertState{}).Where("rule_id = ?", rule.ID).Count(&states)
+	if states != 1 {
+		t.Fatalf("expected the latest bucket to hit the rule once, got %d states", states)
+	}
+
+	// A second run has nothing new to roll up; a definition change starts over.
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	m, _, _ := store.GetLogMetric(ctx, db, 1, errorsPerMin.ID)
+	if m.RolledUpTo == nil || !m.RolledUpTo.Equal(t0.Add(4*time.Minute)) {
+		t.Fatalf("rolled_up_to = %v", m.RolledUpTo)
+	}
+	if _, err := store.UpdateLogMetric(ctx, db, m, map[string]any{"query": "level:error"}, true); err != nil {
+		t.Fatalf("UpdateLogMetric: %v", err)
+	}
+	var points int64
+	db.Model(&model.MetricPoint{}).Where("metric_id = ?", m.ID).Count(&points)
+	if points != 0 {
+		t.Fatalf("expected points to be dropped, got %d", points)
+	}
+
+	pts, err := logmetric.NewReader(db).MetricPoints(ctx, 1, "latency", detector.TimeRange{Start: t0, End: t0.Add(5 * time.Minute)})
+	if err != nil || len(pts) != 3 {
+		t.Fatalf("MetricPoints = %+v err=%v", pts, err)
+	}
+}
+
+func TestRollupAggregates(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	t0 := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var logs []model.Log
+	for i, l := range []struct {
+		at      time.Duration
+		route   string
+		latency any
+	}{
+		{0, "/pay", 10}, {time.Second, "/pay", "30"}, {2 * time.Second, "/find", 5},
+		{3 * time.Second, "/pay", "slow"}, {70 * time.Second, "/pay", 7},
+	} {
+		fields, _ := json.Marshal(map[string]any{"route": l.route, "latency_ms": l.latency})
+		logs = append(logs, model.Log{ProjectID: 1, Timestamp: t0.Add(l.at), Level: "info", Message: fmt.Sprint(i), Fields: fields})
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+
+	for agg, want := range map[string]string{
+		logmetric.Sum: "[12:00 /find 5 1 12:00 /pay 40 2 12:01 /pay 7 1]",
+		logmetric.Avg: "[12:00 /find 5 1 12:00 /pay 20 2 12:01 /pay 7 1]",
+		logmetric.Max: "[12:00 /find 5 1 12:00 /pay 30 2 12:01 /pay 7 1]",
+	} {
+		m := model.LogMetric{ID: 1, ProjectID: 1, Name: agg, Aggregation: agg, Field: "fields.latency_ms", GroupBy: datatypes.JSON(`["fields.route"]`), IntervalSec: 60}
+		points, err := logmetric.Rollup(context.Background(), db, m, t0, t0.Add(2*time.Minute))
+		if err != nil {
+			t.Fatalf("%s: Rollup: %v", agg, err)
+		}
+		var got []string
+		for _, p := range points {
+			var labels map[string]string
+			_ = json.Unmarshal(p.Labels, &labels)
+			got = append(got, fmt.Sprintf("%s %s %v %d", p.Bucket.Format("15:04"), labels["fields.route"], p.Value, p.Count))
+		}
+		// Points sort by group key within a bucket.
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if fmt.Sprint(got) != want {
+			t.Fatalf("%s = %v, want %s", agg, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package logmetric
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aak1247/logtap/internal/detector"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+type Point struct {
+	Bucket time.Time `json:"bucket"`
+	Value  float64   `json:"value"`
+	Count  int64     `json:"count"`
+}
+
+// Series is one group of a metric.
+type Series struct {
+	Labels map[string]string `json:"labels"`
+	Points []Point           `json:"points"`
+}
+
+// ReadSeries returns the metric's series with start <= bucket < end. labels
+// keeps the series whose labels include all of them.
+func ReadSeries(ctx context.Context, db *gorm.DB, metricID int64, start, end time.Time, labels map[string]string) ([]Series, error) {
+	rows, err := store.ListMetricPoints(ctx, db, metricID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	out := []Series{}
+	group := ""
+	for i, p := range rows {
+		if i == 0 || p.GroupKey != group {
+			group = p.GroupKey
+			s := Series{Labels: map[string]string{}}
+			_ = json.Unmarshal(p.Labels, &s.Labels)
+			out = append(out, s)
+		}
+		s := &out[len(out)-1]
+		s.Points = append(s.Points, Point{Bucket: p.Bucket.UTC(), Value: p.Value, Count: p.Count})
+	}
+	if len(labels) == 0 {
+		return out, nil
+	}
+	kept := out[:0]
+	for _, s := range out {
+		if hasLabels(s.Labels, labels) {
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
+
+func hasLabels(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Reader serves the points of log metrics, by name, to the metric_threshold
+// detector.
+type Reader struct {
+	DB *gorm.DB
+}
+
+func NewReader(db *gorm.DB) Reader { return Reader{DB: db} }
+
+func (r Reader) MetricPoints(ctx context.Context, projectID int, metric string, tr detector.TimeRange) ([]detector.MetricPoint, error) {
+	m, found, err := store.GetLogMetricByName(ctx, r.DB, projectID, metric)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("log metric %s not found", metric)
+	}
+	series, err := ReadSeries(ctx, r.DB, m.ID, tr.Start, tr.End, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []detector.MetricPoint
+	for _, s := range series {
+		for _, p := range s.Points {
+			out = append(out, detector.MetricPoint{Timestamp: p.Bucket, Value: p.Value, Labels: s.Labels})
+		}
+	}
+	return out, nil
+}
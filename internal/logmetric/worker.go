@@ -0,0 +1,116 @@
+package logmetric
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aak1247/logtap/internal/alert"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// Worker rolls up enabled log metrics. A bucket is rolled up once Delay has
+// passed after it ended, leaving time for late logs; a new metric starts
+// Backfill in the past. The points of the latest bucket are evaluated
+// against "metrics" alert rules, older ones (backfill, catching up after
+// downtime) are not.
+type Worker struct {
+	DB         *gorm.DB
+	Interval   time.Duration
+	Delay      time.Duration
+	Backfill   time.Duration
+	MaxBuckets int // per metric and run
+	Engine     *alert.Engine
+	Now        func() time.Time
+}
+
+func NewWorker(db *gorm.DB) *Worker {
+	return &Worker{
+		DB:         db,
+		Interval:   30 * time.Second,
+		Delay:      30 * time.Second,
+		Backfill:   time.Hour,
+		MaxBuckets: 120,
+		Engine:     alert.NewEngine(db, nil),
+		Now:        time.Now,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	if w == nil || w.DB == nil {
+		return
+	}
+	_ = w.RunOnce(ctx)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = w.RunOnce(ctx)
+		}
+	}
+}
+
+func (w *Worker) RunOnce(ctx context.Context) error {
+	metrics, err := store.ListEnabledLogMetrics(ctx, w.DB)
+	if err != nil {
+		log.Printf("logmetric: list metrics: %v", err)
+		return err
+	}
+	for _, m := range metrics {
+		metricCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		err := w.rollup(metricCtx, m)
+		cancel()
+		if err != nil {
+			log.Printf("logmetric: project=%d metric=%s: %v", m.ProjectID, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) rollup(ctx context.Context, m model.LogMetric) error {
+	if m.IntervalSec <= 0 {
+		return nil
+	}
+	interval := time.Duration(m.IntervalSec) * time.Second
+	end := w.Now().UTC().Add(-w.Delay).Truncate(interval)
+	var from time.Time
+	if m.RolledUpTo != nil {
+		from = m.RolledUpTo.UTC()
+	} else {
+		from = end.Add(-w.Backfill).Truncate(interval)
+	}
+	if !from.Before(end) {
+		return nil
+	}
+	to := end
+	if w.MaxBuckets > 0 {
+		if limit := from.Add(time.Duration(w.MaxBuckets) * interval); limit.Before(to) {
+			to = limit
+		}
+	}
+
+	points, err := Rollup(ctx, w.DB, m, from, to)
+	if err != nil {
+		return err
+	}
+	if err := store.SaveMetricRollup(ctx, w.DB, m.ID, points, to); err != nil {
+		return err
+	}
+	if w.Engine == nil || to.Before(end) {
+		return nil
+	}
+	last := to.Add(-interval)
+	for _, p := range points {
+		if p.Bucket.Equal(last) {
+			_ = w.Engine.Evaluate(ctx, alert.InputFromMetricPoint(m, p))
+		}
+	}
+	return nil
+}
@@ -4,15 +4,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"time"
 
 	"github.com/aak1247/logtap/internal/detector"
 	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/partition"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/timescale"
 	"gorm.io/gorm"
 )
 
 type Options struct {
 	RequireTimescale bool
+	// Partitioning is "day" or "week" to range-partition the time-series
+	// tables natively when TimescaleDB is not installed; anything else is off.
+	Partitioning     string
+	PartitionPremake int
+	// Timescale seeds the managed TimescaleDB policies on first start; later
+	// changes go through the admin API.
+	Timescale model.TimescaleSettings
 }
 
 func AutoMigrate(ctx context.Context, db *gorm.DB, opts Options) error {
@@ -36,7 +48,28 @@ func AutoMigrate(ctx context.Context, db *gorm.DB, opts Options) error {
 		&model.CleanupPolicy{},
 		&model.EventDefinition{},
 		&model.PropertyDefinition{},
+		&model.PropertyIndex{},
+		&model.SlowSearchField{},
 		&model.AnalysisView{},
+		&model.SavedSearch{},
+		&model.ImportJob{},
+		&model.QueryJob{},
+		&model.ArchiveManifest{},
+		&model.RehydratedLog{},
+		&model.RehydratedEvent{},
+		&model.RehydratedTrackEvent{},
+		&model.ProjectQuota{},
+		&model.ProjectUsageDaily{},
+		&model.Issue{},
+		&model.IssueUser{},
+		&model.IssueActivity{},
+		&model.ReleaseArtifact{},
+		&model.Release{},
+		&model.Deploy{},
+		&model.LogMetric{},
+		&model.MetricPoint{},
+		&model.LogPattern{},
+		&model.LogPatternCount{},
 
 		// Alerting (optional feature; safe to have tables even if unused).
 		&model.AlertContact{},
@@ -49,6 +82,7 @@ func AutoMigrate(ctx context.Context, db *gorm.DB, opts Options) error {
 		&model.AlertDelivery{},
 		&model.MonitorDefinition{},
 		&model.MonitorRun{},
+		&model.TimescaleSettings{},
 	); err != nil {
 		return err
 	}
@@ -58,20 +92,19 @@ func AutoMigrate(ctx context.Context, db *gorm.DB, opts Options) error {
 		return fmt.Errorf("auto migrate detector_results: %w", err)
 	}
 
-	// GIN indexes for JSONB.
-	if err := gdb.Exec(`CREATE INDEX IF NOT EXISTS idx_events_data ON events USING GIN (data)`).Error; err != nil {
-		return err
-	}
-	if err := gdb.Exec(`CREATE INDEX IF NOT EXISTS idx_logs_fields ON logs USING GIN (fields)`).Error; err != nil {
-		return err
+	if strings.EqualFold(db.Dialector.Name(), "postgres") {
+		if err := ensurePostgresSearchIndexes(gdb); err != nil {
+			return err
+		}
 	}
-
-	// Full text search index for /logs/search?q=... (expression index; no schema init needed).
-	if err := gdb.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_logs_search_expr
-		ON logs USING GIN (to_tsvector('simple', coalesce(message,'') || ' ' || coalesce(fields::text,'')))
-	`).Error; err != nil {
-		return err
+	if strings.EqualFold(db.Dialector.Name(), "sqlite") {
+		if err := store.EnsureSQLiteAutoVacuum(ctx, db); err != nil {
+			return fmt.Errorf("sqlite auto_vacuum: %w", err)
+		}
+		// Full text search for /logs/search on SQLite installs (FTS5 + sync triggers).
+		if err := store.EnsureLogsFTS(ctx, db); err != nil {
+			return fmt.Errorf("sqlite logs fts: %w", err)
+		}
 	}
 
 	// Idempotency for logs: dedupe retries by a stable ingest_id (e.g. NSQ message id).
@@ -88,15 +121,116 @@ func AutoMigrate(ctx context.Context, db *gorm.DB, opts Options) error {
 		return err
 	}
 
+	// Indexes added to tables that are large by the time they upgrade.
+	if err := ensureIndex(ctx, db, "logs", "idx_logs_project_pattern", "project_id, pattern_id"); err != nil {
+		return fmt.Errorf("index logs pattern: %w", err)
+	}
+	if err := ensureIndex(ctx, db, "events", "idx_events_project_fingerprint", "project_id, fingerprint, timestamp DESC"); err != nil {
+		return fmt.Errorf("index events fingerprint: %w", err)
+	}
+
 	if strings.EqualFold(db.Dialector.Name(), "postgres") {
 		if err := ensureTimescaleHypertables(gdb, opts.RequireTimescale, timescaleInstalled); err != nil {
 			return err
 		}
+		if timescaleInstalled {
+			if err := ensureTimescalePolicies(ctx, db, opts); err != nil {
+				return err
+			}
+		}
+		// Hypertables already give chunk-drop retention; native partitioning is the fallback.
+		if period, ok := partition.ParsePeriod(opts.Partitioning); ok && !timescaleInstalled {
+			if err := partition.ConvertAll(ctx, db, period, opts.PartitionPremake, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// ensureIndex builds index name on table (cols). On PostgreSQL it is built
+// CONCURRENTLY so that upgrading a large table does not block ingest for the
+// whole build, except on partitioned tables and hypertables, which only take
+// a plain build; an invalid index left by an interrupted build is replaced.
+func ensureIndex(ctx context.Context, db *gorm.DB, table, name, cols string) error {
+	gdb := db.WithContext(ctx)
+	def := name + " ON " + table + " (" + cols + ")"
+	if !strings.EqualFold(db.Dialector.Name(), "postgres") {
+		return gdb.Exec("CREATE INDEX IF NOT EXISTS " + def).Error
+	}
+	var valid []bool
+	if err := gdb.Raw("SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass(?)", name).Scan(&valid).Error; err != nil {
+		return err
+	}
+	if len(valid) == 1 && !valid[0] {
+		if err := gdb.Exec("DROP INDEX IF EXISTS " + name).Error; err != nil {
+			return err
+		}
+	}
+	concurrent, err := partition.ConcurrentIndexes(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	if !concurrent {
+		return gdb.Exec("CREATE INDEX IF NOT EXISTS " + def).Error
+	}
+	if err := gdb.Exec("CREATE INDEX CONCURRENTLY IF NOT EXISTS " + def).Error; err != nil {
+		// A failed concurrent build leaves an invalid index behind.
+		if derr := db.WithContext(context.WithoutCancel(ctx)).Exec("DROP INDEX IF EXISTS " + name).Error; derr != nil {
+			log.Printf("migrate: drop invalid index %s: %v", name, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+func ensurePostgresSearchIndexes(db *gorm.DB) error {
+	// GIN indexes for JSONB.
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_events_data ON events USING GIN (data)`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_logs_fields ON logs USING GIN (fields)`).Error; err != nil {
+		return err
+	}
+
+	// Datetime properties compare stored text as a time; a value that does not
+	// parse must not fail the whole search, so the cast yields NULL instead.
+	if err := db.Exec(`
+		CREATE OR REPLACE FUNCTION logtap_try_timestamptz(v text) RETURNS timestamptz
+		LANGUAGE plpgsql STABLE AS $$
+		BEGIN
+			RETURN v::timestamptz;
+		EXCEPTION WHEN others THEN
+			RETURN NULL;
+		END
+		$$
+	`).Error; err != nil {
+		return err
+	}
+
+	// Full text search index for /logs/search?q=... (expression index; no schema init needed).
+	if err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_logs_search_expr
+		ON logs USING GIN (to_tsvector('simple', coalesce(message,'') || ' ' || coalesce(fields::text,'')))
+	`).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func ensureTimescalePolicies(ctx context.Context, db *gorm.DB, opts Options) error {
+	settings, err := store.EnsureTimescaleSettings(ctx, db, opts.Timescale)
+	if err != nil {
+		return err
+	}
+	// Policies are best-effort like hypertables unless Timescale is required.
+	if err := timescale.Apply(ctx, db, settings); err != nil && opts.RequireTimescale {
+		return fmt.Errorf("timescale policies: %w", err)
+	}
+	return nil
+}
+
 func ensureTimescaleExtension(db *gorm.DB, require bool) (bool, error) {
 	if db == nil {
 		return false, gorm.ErrInvalidDB
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// ArchiveManifest records one archived object: the rows of one project and
+// table within [RangeStart, RangeEnd), exported before retention deleted them.
+type ArchiveManifest struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID    int        `gorm:"not null;index:idx_archive_manifests_project_kind_start,priority:1;column:project_id" json:"project_id"`
+	Kind         string     `gorm:"type:varchar(32);not null;index:idx_archive_manifests_project_kind_start,priority:2;column:kind" json:"kind"`
+	RangeStart   time.Time  `gorm:"not null;index:idx_archive_manifests_project_kind_start,priority:3;column:range_start" json:"range_start"`
+	RangeEnd     time.Time  `gorm:"not null;column:range_end" json:"range_end"`
+	Rows         int64      `gorm:"not null;default:0;column:rows" json:"rows"`
+	Bytes        int64      `gorm:"not null;default:0;column:bytes" json:"bytes"`
+	SHA256       string     `gorm:"type:varchar(64);not null;column:sha256" json:"sha256"`
+	Format       string     `gorm:"type:varchar(32);not null;column:format" json:"format"`
+	Store        string     `gorm:"type:varchar(16);not null;column:store" json:"store"`
+	ObjectKey    string     `gorm:"type:text;not null;column:object_key" json:"object_key"`
+	RehydratedAt *time.Time `gorm:"column:rehydrated_at" json:"rehydrated_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+}
+
+func (ArchiveManifest) TableName() string { return "archive_manifests" }
+
+// RehydratedLog is a log row restored from an archive. The json tags define
+// the archived NDJSON record, so the same type is used to export and restore.
+type RehydratedLog struct {
+	ArchiveID  int64          `gorm:"primaryKey;autoIncrement:false;column:archive_id" json:"-"`
+	ID         int64          `gorm:"primaryKey;autoIncrement:false;column:id" json:"id"`
+	ProjectID  int            `gorm:"not null;index:idx_rehydrated_logs_project_ts,priority:1;column:project_id" json:"project_id"`
+	Timestamp  time.Time      `gorm:"not null;index:idx_rehydrated_logs_project_ts,priority:2,sort:desc;column:timestamp" json:"timestamp"`
+	IngestID   *uuid.UUID     `gorm:"type:uuid;column:ingest_id" json:"ingest_id,omitempty"`
+	Level      string         `gorm:"type:varchar(20);column:level" json:"level"`
+	DistinctID string         `gorm:"type:varchar(255);column:distinct_id" json:"distinct_id"`
+	DeviceID   string         `gorm:"type:varchar(255);column:device_id" json:"device_id"`
+	TraceID    string         `gorm:"type:varchar(64);column:trace_id" json:"trace_id"`
+	SpanID     string         `gorm:"type:varchar(64);column:span_id" json:"span_id"`
+	Message    string         `gorm:"type:text;not null;column:message" json:"message"`
+	Fields     datatypes.JSON `gorm:"type:jsonb;not null;default:'{}';column:fields" json:"fields"`
+}
+
+func (RehydratedLog) TableName() string { return "rehydrated_logs" }
+
+type RehydratedEvent struct {
+	ArchiveID   int64          `gorm:"primaryKey;autoIncrement:false;column:archive_id" json:"-"`
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey;column:id" json:"id"`
+	ProjectID   int            `gorm:"not null;index:idx_rehydrated_events_project_ts,priority:1;column:project_id" json:"project_id"`
+	Timestamp   time.Time      `gorm:"not null;index:idx_rehydrated_events_project_ts,priority:2,sort:desc;column:timestamp" json:"timestamp"`
+	Level       string         `gorm:"type:varchar(20);column:level" json:"level"`
+	DistinctID  string         `gorm:"type:varchar(255);column:distinct_id" json:"distinct_id"`
+	DeviceID    string         `gorm:"type:varchar(255);column:device_id" json:"device_id"`
+	OS          string         `gorm:"type:varchar(100);column:os" json:"os"`
+	Platform    string         `gorm:"type:varchar(50);column:platform" json:"platform"`
+	ReleaseTag  string         `gorm:"type:varchar(100);column:release_tag" json:"release_tag"`
+	Environment string         `gorm:"type:varchar(50);column:environment" json:"environment"`
+	UserID      string         `gorm:"type:varchar(255);column:user_id" json:"user_id"`
+	Title       string         `gorm:"type:text;column:title" json:"title"`
+	Fingerprint string         `gorm:"type:varchar(64);column:fingerprint" json:"fingerprint"`
+	Data        datatypes.JSON `gorm:"type:jsonb;not null;column:data" json:"data"`
+}
+
+func (RehydratedEvent) TableName() string { return "rehydrated_events" }
+
+type RehydratedTrackEvent struct {
+	ArchiveID  int64      `gorm:"primaryKey;autoIncrement:false;column:archive_id" json:"-"`
+	ID         int64      `gorm:"primaryKey;autoIncrement:false;column:id" json:"id"`
+	ProjectID  int        `gorm:"not null;index:idx_rehydrated_track_events_project_ts,priority:1;column:project_id" json:"project_id"`
+	Timestamp  time.Time  `gorm:"not null;index:idx_rehydrated_track_events_project_ts,priority:2,sort:desc;column:timestamp" json:"timestamp"`
+	IngestID   *uuid.UUID `gorm:"type:uuid;column:ingest_id" json:"ingest_id,omitempty"`
+	Name       string     `gorm:"type:text;not null;column:name" json:"name"`
+	DistinctID string     `gorm:"type:varchar(255);not null;column:distinct_id" json:"distinct_id"`
+	DeviceID   string     `gorm:"type:varchar(255);column:device_id" json:"device_id"`
+}
+
+func (RehydratedTrackEvent) TableName() string { return "rehydrated_track_events" }
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// ReleaseArtifact is a file uploaded for one release of a project (a minified
+// bundle, its source map or an original source) and used to symbolicate that
+// release's events. The bytes live in the artifact object store under
+// ObjectKey; Name is the URL the file is served from, usually "~/path" with
+// the scheme and host left out. For ProGuard mappings and Dart symbol files
+// DebugID is the mapping's pg_map_id or the symbol file's build id.
+type ReleaseArtifact struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID int       `gorm:"not null;uniqueIndex:idx_release_artifacts_project_release_name,priority:1;index:idx_release_artifacts_project_debug_id,priority:1;column:project_id" json:"project_id"`
+	Release   string    `gorm:"type:varchar(200);not null;uniqueIndex:idx_release_artifacts_project_release_name,priority:2;column:release" json:"release"`
+	Name      string    `gorm:"type:varchar(1000);not null;uniqueIndex:idx_release_artifacts_project_release_name,priority:3;column:name" json:"name"`
+	Type      string    `gorm:"type:varchar(32);not null;column:type" json:"type"`
+	DebugID   string    `gorm:"type:varchar(64);not null;default:'';index:idx_release_artifacts_project_debug_id,priority:2;column:debug_id" json:"debug_id,omitempty"`
+	Size      int64     `gorm:"not null;default:0;column:size" json:"size"`
+	SHA1      string    `gorm:"type:varchar(40);not null;column:sha1" json:"sha1"`
+	ObjectKey string    `gorm:"type:text;not null;column:object_key" json:"-"`
+	CreatedAt time.Time `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (ReleaseArtifact) TableName() string { return "release_artifacts" }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ImportJob is a backfill of a project's history from NDJSON of one Kind:
+// custom logs, track events or Sentry events. Data is uploaded to it in one
+// or more parts; the counters add up over all parts and are updated while a
+// part is imported. Errors keeps the first failed lines ([]{line, error}).
+type ImportJob struct {
+	ID         int            `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID  int            `gorm:"not null;index;column:project_id" json:"project_id"`
+	UserID     int64          `gorm:"not null;default:0;column:user_id" json:"user_id"`
+	Kind       string         `gorm:"type:varchar(16);not null;column:kind" json:"kind"`     // logs, track, events
+	Status     string         `gorm:"type:varchar(16);not null;column:status" json:"status"` // pending, running, done, failed
+	Parts      int            `gorm:"not null;default:0;column:parts" json:"parts"`
+	Bytes      int64          `gorm:"not null;default:0;column:bytes" json:"bytes"`
+	Lines      int64          `gorm:"not null;default:0;column:lines" json:"lines"`
+	Imported   int64          `gorm:"not null;default:0;column:imported" json:"imported"`
+	Duplicates int64          `gorm:"not null;default:0;column:duplicates" json:"duplicates"`
+	Failed     int64          `gorm:"not null;default:0;column:failed" json:"failed"`
+	Errors     datatypes.JSON `gorm:"type:jsonb;not null;default:'[]';column:errors" json:"errors"`
+	Error      string         `gorm:"type:text;not null;default:'';column:error" json:"error,omitempty"`
+	StartedAt  *time.Time     `gorm:"column:started_at" json:"started_at,omitempty"`
+	FinishedAt *time.Time     `gorm:"column:finished_at" json:"finished_at,omitempty"`
+	CreatedAt  time.Time      `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt  time.Time      `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (ImportJob) TableName() string { return "import_jobs" }
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Issue statuses. An ignored issue returns to unresolved once IgnoreUntil
+// passes or its count or users reach IgnoreUntilCount / IgnoreUntilUsers; a
+// muted one stays muted. A resolved issue that receives a newer event (for
+// resolved_in_next_release: one from a release other than
+// ResolvedInRelease) is reopened as a regression.
+const (
+	IssueStatusUnresolved            = "unresolved"
+	IssueStatusResolved              = "resolved"
+	IssueStatusResolvedInNextRelease = "resolved_in_next_release"
+	IssueStatusIgnored               = "ignored"
+	IssueStatusMuted                 = "muted"
+)
+
+// Issue groups the events of a project that share a fingerprint (see package
+// grouping). Counters are maintained by the event consumer; Title, Culprit
+// and Level follow the most recent event.
+type Issue struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID   int       `gorm:"not null;uniqueIndex:idx_issues_project_fingerprint,priority:1;index:idx_issues_project_last_seen,priority:1;column:project_id" json:"project_id"`
+	Fingerprint string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_issues_project_fingerprint,priority:2;column:fingerprint" json:"fingerprint"`
+	Title       string    `gorm:"type:text;not null;default:'';column:title" json:"title"`
+	Culprit     string    `gorm:"type:text;not null;default:'';column:culprit" json:"culprit"`
+	Level       string    `gorm:"type:varchar(20);not null;default:'';column:level" json:"level"`
+	FirstSeen   time.Time `gorm:"not null;column:first_seen" json:"first_seen"`
+	LastSeen    time.Time `gorm:"not null;index:idx_issues_project_last_seen,priority:2,sort:desc;column:last_seen" json:"last_seen"`
+	TimesSeen   int64     `gorm:"not null;default:0;column:times_seen" json:"count"`
+	UserCount   int64     `gorm:"not null;default:0;column:user_count" json:"users"`
+	LastEventID uuid.UUID `gorm:"type:uuid;column:last_event_id" json:"last_event_id"`
+	// FirstRelease is the release of the issue's first event.
+	FirstRelease string `gorm:"type:varchar(100);not null;default:'';index;column:first_release" json:"first_release,omitempty"`
+
+	Status            string     `gorm:"type:varchar(32);not null;default:'unresolved';index;column:status" json:"status"`
+	Regressed         bool       `gorm:"not null;default:false;column:regressed" json:"regressed"`
+	ResolvedAt        *time.Time `gorm:"column:resolved_at" json:"resolved_at,omitempty"`
+	ResolvedInRelease string     `gorm:"type:varchar(100);not null;default:'';column:resolved_in_release" json:"resolved_in_release,omitempty"`
+	IgnoreUntil       *time.Time `gorm:"column:ignore_until" json:"ignore_until,omitempty"`
+	IgnoreUntilCount  int64      `gorm:"not null;default:0;column:ignore_until_count" json:"ignore_until_count,omitempty"`
+	IgnoreUntilUsers  int64      `gorm:"not null;default:0;column:ignore_until_users" json:"ignore_until_users,omitempty"`
+	AssigneeUserID    *int64     `gorm:"index;column:assignee_user_id" json:"assignee_user_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (Issue) TableName() string { return "issues" }
+
+// IssueActivity is one entry of an issue's history. UserID is 0 for changes
+// made by the system (first seen, regression, ignore expiry); Data carries
+// kind-specific details such as the old and new status.
+type IssueActivity struct {
+	ID        int64          `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID int            `gorm:"not null;index;column:project_id" json:"project_id"`
+	IssueID   int64          `gorm:"not null;index:idx_issue_activities_issue,priority:1;column:issue_id" json:"issue_id"`
+	Kind      string         `gorm:"type:varchar(32);not null;column:kind" json:"kind"`
+	UserID    int64          `gorm:"not null;default:0;column:user_id" json:"user_id"`
+	Data      datatypes.JSON `gorm:"type:jsonb;not null;default:'{}';column:data" json:"data"`
+	CreatedAt time.Time      `gorm:"not null;autoCreateTime;index:idx_issue_activities_issue,priority:2;column:created_at" json:"created_at"`
+}
+
+func (IssueActivity) TableName() string { return "issue_activities" }
+
+// IssueUser records each distinct user an issue affected, so Issue.UserCount
+// stays exact across batches.
+type IssueUser struct {
+	ProjectID   int    `gorm:"primaryKey;autoIncrement:false;column:project_id"`
+	Fingerprint string `gorm:"type:varchar(64);primaryKey;column:fingerprint"`
+	User        string `gorm:"type:varchar(255);primaryKey;column:user_key"`
+}
+
+func (IssueUser) TableName() string { return "issue_users" }
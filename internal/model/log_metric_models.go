@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LogMetric derives a time series from logs: every IntervalSec, the logs
+// matching Query (search DSL) are aggregated per GroupBy combination into
+// MetricPoints. Field is the value aggregated, unused by count.
+type LogMetric struct {
+	ID          int64          `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID   int            `gorm:"not null;uniqueIndex:idx_log_metrics_project_name,priority:1;column:project_id" json:"project_id"`
+	Name        string         `gorm:"type:varchar(100);not null;uniqueIndex:idx_log_metrics_project_name,priority:2;column:name" json:"name"`
+	Description string         `gorm:"type:text;not null;default:'';column:description" json:"description,omitempty"`
+	Query       string         `gorm:"type:text;not null;default:'';column:query" json:"query"`
+	Aggregation string         `gorm:"type:varchar(16);not null;column:aggregation" json:"aggregation"`
+	Field       string         `gorm:"type:varchar(200);not null;default:'';column:field" json:"field,omitempty"`
+	GroupBy     datatypes.JSON `gorm:"type:jsonb;not null;default:'[]';column:group_by" json:"group_by"`
+	IntervalSec int            `gorm:"not null;default:60;column:interval_sec" json:"interval_sec"`
+	Enabled     bool           `gorm:"not null;default:true;index;column:enabled" json:"enabled"`
+	// RolledUpTo is the end of the last materialized bucket.
+	RolledUpTo *time.Time `gorm:"column:rolled_up_to" json:"rolled_up_to,omitempty"`
+	CreatedAt  time.Time  `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (LogMetric) TableName() string { return "log_metrics" }
+
+// MetricPoint is one bucket of a LogMetric series. GroupKey identifies the
+// series (a hash of Labels, empty without group-by); Count is the number of
+// logs aggregated.
+type MetricPoint struct {
+	ID        int64          `gorm:"primaryKey;autoIncrement;column:id" json:"-"`
+	ProjectID int            `gorm:"not null;index;column:project_id" json:"-"`
+	MetricID  int64          `gorm:"not null;uniqueIndex:idx_metric_points_series,priority:1;column:metric_id" json:"-"`
+	GroupKey  string         `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_metric_points_series,priority:2;column:group_key" json:"-"`
+	Bucket    time.Time      `gorm:"not null;uniqueIndex:idx_metric_points_series,priority:3;column:bucket" json:"bucket"`
+	Labels    datatypes.JSON `gorm:"type:jsonb;not null;default:'{}';column:labels" json:"labels,omitempty"`
+	Value     float64        `gorm:"not null;column:value" json:"value"`
+	Count     int64          `gorm:"not null;column:count" json:"count"`
+}
+
+func (MetricPoint) TableName() string { return "metric_points" }
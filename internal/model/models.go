@@ -51,6 +51,7 @@ type Event struct {
 	Environment string         `gorm:"type:varchar(50);column:environment"`
 	UserID      string         `gorm:"type:varchar(255);column:user_id"`
 	Title       string         `gorm:"type:text;column:title"`
+	Fingerprint string         `gorm:"type:varchar(64);column:fingerprint"` // indexed by migrate, concurrently
 	Data        datatypes.JSON `gorm:"type:jsonb;not null;column:data"`
 }
 
@@ -68,6 +69,9 @@ type Log struct {
 	SpanID     string         `gorm:"type:varchar(64);column:span_id"`
 	Message    string         `gorm:"type:text;not null;column:message"`
 	Fields     datatypes.JSON `gorm:"type:jsonb;not null;default:'{}';column:fields"`
+	// PatternID is the log's message template (see LogPattern), empty when
+	// pattern mining is off. Its index is built by migrate, concurrently.
+	PatternID string `gorm:"type:varchar(16);not null;default:'';column:pattern_id"`
 	// search_vector is created via DDL during migration for full-text search.
 }
 
@@ -101,22 +105,37 @@ type TrackEventDaily struct {
 
 func (TrackEventDaily) TableName() string { return "track_event_daily" }
 
+// CleanupPolicy is a project's retention. RetentionRules holds an ordered
+// []RetentionRule that overrides the per-table days for the rows it matches.
 type CleanupPolicy struct {
-	ProjectID                int        `gorm:"primaryKey;column:project_id" json:"project_id"`
-	Enabled                  bool       `gorm:"not null;default:false;column:enabled" json:"enabled"`
-	LogsRetentionDays        int        `gorm:"not null;default:30;column:logs_retention_days" json:"logs_retention_days"`
-	EventsRetentionDays      int        `gorm:"not null;default:30;column:events_retention_days" json:"events_retention_days"`
-	TrackEventsRetentionDays int        `gorm:"not null;default:0;column:track_events_retention_days" json:"track_events_retention_days"`
-	ScheduleHourUTC          int        `gorm:"not null;default:3;column:schedule_hour_utc" json:"schedule_hour_utc"`
-	ScheduleMinuteUTC        int        `gorm:"not null;default:0;column:schedule_minute_utc" json:"schedule_minute_utc"`
-	LastRunAt                *time.Time `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
-	NextRunAt                *time.Time `gorm:"index;column:next_run_at" json:"next_run_at,omitempty"`
-	CreatedAt                time.Time  `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
-	UpdatedAt                time.Time  `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+	ProjectID                int            `gorm:"primaryKey;column:project_id" json:"project_id"`
+	Enabled                  bool           `gorm:"not null;default:false;column:enabled" json:"enabled"`
+	LogsRetentionDays        int            `gorm:"not null;default:30;column:logs_retention_days" json:"logs_retention_days"`
+	EventsRetentionDays      int            `gorm:"not null;default:30;column:events_retention_days" json:"events_retention_days"`
+	TrackEventsRetentionDays int            `gorm:"not null;default:0;column:track_events_retention_days" json:"track_events_retention_days"`
+	ScheduleHourUTC          int            `gorm:"not null;default:3;column:schedule_hour_utc" json:"schedule_hour_utc"`
+	ScheduleMinuteUTC        int            `gorm:"not null;default:0;column:schedule_minute_utc" json:"schedule_minute_utc"`
+	ArchiveEnabled           bool           `gorm:"not null;default:false;column:archive_enabled" json:"archive_enabled"`
+	RetentionRules           datatypes.JSON `gorm:"type:jsonb;not null;default:'[]';column:retention_rules" json:"retention_rules"`
+	LastRunAt                *time.Time     `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
+	NextRunAt                *time.Time     `gorm:"index;column:next_run_at" json:"next_run_at,omitempty"`
+	CreatedAt                time.Time      `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt                time.Time      `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
 }
 
 func (CleanupPolicy) TableName() string { return "cleanup_policies" }
 
+// RetentionRule keeps the rows of Table that match it for Days (0 = forever)
+// instead of the table's default. A rule matches on a level set, a field
+// predicate (Field = Value), or both; the first matching rule wins.
+type RetentionRule struct {
+	Table  string   `json:"table"`
+	Levels []string `json:"levels,omitempty"`
+	Field  string   `json:"field,omitempty"`
+	Value  string   `json:"value,omitempty"`
+	Days   int      `json:"days"`
+}
+
 // EventDefinition stores per-project metadata for named events (behavior categories).
 // It is used by the Analytics UI to present friendly names and descriptions for
 // event-based analyses, but does not affect ingest.
@@ -140,21 +159,52 @@ func (EventDefinition) TableName() string { return "event_definitions" }
 // live in logs.fields/track properties; this table only carries schema
 // metadata such as type and enum candidates.
 type PropertyDefinition struct {
-	ID           int            `gorm:"primaryKey;autoIncrement;column:id"`
-	ProjectID    int            `gorm:"not null;index;uniqueIndex:idx_property_definitions_project_key,priority:1;column:project_id"`
-	Key          string         `gorm:"type:varchar(255);not null;uniqueIndex:idx_property_definitions_project_key,priority:2;column:key"`
-	DisplayName  string         `gorm:"type:varchar(255);not null;default:'';column:display_name"`
-	Type         string         `gorm:"type:varchar(32);not null;default:'string';column:type"`
-	Description  string         `gorm:"type:text;column:description"`
-	Status       string         `gorm:"type:varchar(32);not null;default:'active';column:status"`
-	EnumValues   datatypes.JSON `gorm:"type:jsonb;column:enum_values"`
+	ID            int            `gorm:"primaryKey;autoIncrement;column:id"`
+	ProjectID     int            `gorm:"not null;index;uniqueIndex:idx_property_definitions_project_key,priority:1;column:project_id"`
+	Key           string         `gorm:"type:varchar(255);not null;uniqueIndex:idx_property_definitions_project_key,priority:2;column:key"`
+	DisplayName   string         `gorm:"type:varchar(255);not null;default:'';column:display_name"`
+	Type          string         `gorm:"type:varchar(32);not null;default:'string';column:type"`
+	Description   string         `gorm:"type:text;column:description"`
+	Status        string         `gorm:"type:varchar(32);not null;default:'active';column:status"`
+	EnumValues    datatypes.JSON `gorm:"type:jsonb;column:enum_values"`
 	ExampleValues datatypes.JSON `gorm:"type:jsonb;column:example_values"`
-	CreatedAt    time.Time      `gorm:"not null;autoCreateTime;column:created_at"`
-	UpdatedAt    time.Time      `gorm:"not null;autoUpdateTime;column:updated_at"`
+	CreatedAt     time.Time      `gorm:"not null;autoCreateTime;column:created_at"`
+	UpdatedAt     time.Time      `gorm:"not null;autoUpdateTime;column:updated_at"`
 }
 
 func (PropertyDefinition) TableName() string { return "property_definitions" }
 
+// PropertyIndex is an expression index on logs for a property, built for a
+// project on request; projects indexing the same property as the same type
+// share IndexName.
+type PropertyIndex struct {
+	ID         int       `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID  int       `gorm:"not null;uniqueIndex:idx_property_indexes_project_key,priority:1;column:project_id" json:"project_id"`
+	Key        string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_property_indexes_project_key,priority:2;column:key" json:"key"`
+	Type       string    `gorm:"type:varchar(32);not null;column:type" json:"type"`
+	IndexName  string    `gorm:"type:varchar(63);not null;index;column:index_name" json:"index_name"`
+	Expression string    `gorm:"type:text;not null;column:expression" json:"expression"`
+	Status     string    `gorm:"type:varchar(16);not null;column:status" json:"status"` // building, ready, failed
+	Error      string    `gorm:"type:text;column:error" json:"error"`
+	CreatedAt  time.Time `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (PropertyIndex) TableName() string { return "property_indexes" }
+
+// SlowSearchField counts the slow searches that filtered on a property; the
+// index advisor suggests indexes from it.
+type SlowSearchField struct {
+	ProjectID int       `gorm:"primaryKey;autoIncrement:false;column:project_id"`
+	Field     string    `gorm:"primaryKey;type:varchar(255);column:field"`
+	Count     int64     `gorm:"not null;default:0;column:count"`
+	TotalMs   int64     `gorm:"not null;default:0;column:total_ms"`
+	MaxMs     int64     `gorm:"not null;default:0;column:max_ms"`
+	LastSeen  time.Time `gorm:"not null;column:last_seen"`
+}
+
+func (SlowSearchField) TableName() string { return "slow_search_fields" }
+
 // AnalysisView stores saved analytics configurations (event/property analyses)
 // so that users can quickly reopen commonly used reports.
 type AnalysisView struct {
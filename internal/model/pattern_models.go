@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// LogPattern is a message template mined from a project's logs, variable
+// tokens masked as <*>. PatternID is stored on the logs it matches and stays
+// the same as the template generalizes; Sample is the first message seen.
+type LogPattern struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement;column:id" json:"-"`
+	ProjectID int       `gorm:"not null;uniqueIndex:idx_log_patterns_project_pattern,priority:1;index:idx_log_patterns_project_first_seen,priority:1;column:project_id" json:"project_id"`
+	PatternID string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_log_patterns_project_pattern,priority:2;column:pattern_id" json:"pattern_id"`
+	Template  string    `gorm:"type:text;not null;column:template" json:"template"`
+	Sample    string    `gorm:"type:text;not null;default:'';column:sample" json:"sample"`
+	Level     string    `gorm:"type:varchar(20);not null;default:'';column:level" json:"level,omitempty"`
+	Count     int64     `gorm:"not null;default:0;column:count" json:"count"`
+	FirstSeen time.Time `gorm:"not null;index:idx_log_patterns_project_first_seen,priority:2;column:first_seen" json:"first_seen"`
+	LastSeen  time.Time `gorm:"not null;column:last_seen" json:"last_seen"`
+}
+
+func (LogPattern) TableName() string { return "log_patterns" }
+
+// LogPatternCount is the number of a pattern's logs whose timestamp falls in
+// the bucket starting at Bucket.
+type LogPatternCount struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement;column:id" json:"-"`
+	ProjectID int       `gorm:"not null;uniqueIndex:idx_log_pattern_counts_series,priority:1;index:idx_log_pattern_counts_project_bucket,priority:1;column:project_id" json:"-"`
+	PatternID string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_log_pattern_counts_series,priority:2;column:pattern_id" json:"-"`
+	Bucket    time.Time `gorm:"not null;uniqueIndex:idx_log_pattern_counts_series,priority:3;index:idx_log_pattern_counts_project_bucket,priority:2;column:bucket" json:"bucket"`
+	Count     int64     `gorm:"not null;column:count" json:"count"`
+}
+
+func (LogPatternCount) TableName() string { return "log_pattern_counts" }
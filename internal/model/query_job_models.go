@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// QueryJob is the shared state of an async query job, so that any gateway
+// can poll or cancel a job another one runs. Instance is the gateway that
+// runs it; it refreshes HeartbeatAt while the job is unfinished and cancels
+// the job when CancelRequested is set. Partial and Result hold JSON.
+type QueryJob struct {
+	ID              string         `gorm:"type:varchar(36);primaryKey;column:id"`
+	ProjectID       int            `gorm:"not null;index;column:project_id"`
+	Kind            string         `gorm:"type:varchar(50);not null;column:kind"`
+	Status          string         `gorm:"type:varchar(16);not null;column:status"`
+	Progress        float64        `gorm:"not null;default:0;column:progress"`
+	Partial         datatypes.JSON `gorm:"type:jsonb;column:partial"`
+	Result          datatypes.JSON `gorm:"type:jsonb;column:result"`
+	Error           string         `gorm:"type:text;not null;default:'';column:error"`
+	Cached          bool           `gorm:"not null;default:false;column:cached"`
+	Instance        string         `gorm:"type:varchar(36);not null;index;column:instance"`
+	CancelRequested bool           `gorm:"not null;default:false;column:cancel_requested"`
+	HeartbeatAt     time.Time      `gorm:"not null;column:heartbeat_at"`
+	CreatedAt       time.Time      `gorm:"not null;column:created_at"`
+	StartedAt       *time.Time     `gorm:"column:started_at"`
+	FinishedAt      *time.Time     `gorm:"index;column:finished_at"`
+}
+
+func (QueryJob) TableName() string { return "query_jobs" }
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ProjectUsageDaily accounts what a project ingested on one UTC day. Rows are
+// added by the consumers when a batch is flushed; Dropped counts rows
+// discarded by quota downsampling.
+type ProjectUsageDaily struct {
+	ProjectID  int    `gorm:"primaryKey;autoIncrement:false;column:project_id" json:"project_id"`
+	Day        string `gorm:"type:varchar(10);primaryKey;column:day" json:"day"`
+	Logs       int64  `gorm:"not null;default:0;column:logs" json:"logs"`
+	LogBytes   int64  `gorm:"not null;default:0;column:log_bytes" json:"log_bytes"`
+	Events     int64  `gorm:"not null;default:0;column:events" json:"events"`
+	EventBytes int64  `gorm:"not null;default:0;column:event_bytes" json:"event_bytes"`
+	Dropped    int64  `gorm:"not null;default:0;column:dropped" json:"dropped"`
+	// ExportBytes is what exports wrote, before compression.
+	ExportBytes int64     `gorm:"not null;default:0;column:export_bytes" json:"export_bytes"`
+	CreatedAt   time.Time `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (ProjectUsageDaily) TableName() string { return "project_usage_daily" }
+
+// ProjectQuota limits a project's stored bytes and daily ingest volume. A zero
+// limit is unlimited. Action decides what happens once a limit is reached:
+// "reject" refuses ingest, "downsample" keeps SampleRate of new non-error
+// rows, "cleanup" deletes the oldest rows until storage is back under quota.
+// Channels is an optional []channel.ChannelConfig notified at 80% and 100%
+// in addition to the owner (NotifyOwner). Column defaults are zero values so
+// upserts can store them; the API's defaults live in the query handlers.
+// MaxExportBytes caps what a project exports per UTC day whether or not the
+// quota is enabled; 0 falls back to EXPORT_MAX_BYTES per export.
+type ProjectQuota struct {
+	ProjectID       int            `gorm:"primaryKey;autoIncrement:false;column:project_id" json:"project_id"`
+	Enabled         bool           `gorm:"not null;default:false;column:enabled" json:"enabled"`
+	MaxStorageBytes int64          `gorm:"not null;default:0;column:max_storage_bytes" json:"max_storage_bytes"`
+	MaxDailyBytes   int64          `gorm:"not null;default:0;column:max_daily_bytes" json:"max_daily_bytes"`
+	MaxDailyRows    int64          `gorm:"not null;default:0;column:max_daily_rows" json:"max_daily_rows"`
+	MaxExportBytes  int64          `gorm:"not null;default:0;column:max_export_bytes" json:"max_export_bytes"`
+	Action          string         `gorm:"type:varchar(16);not null;default:'reject';column:action" json:"action"`
+	SampleRate      float64        `gorm:"not null;default:0;column:sample_rate" json:"sample_rate"`
+	NotifyOwner     bool           `gorm:"not null;default:false;column:notify_owner" json:"notify_owner"`
+	Channels        datatypes.JSON `gorm:"type:jsonb;not null;default:'[]';column:channels" json:"channels"`
+
+	// Maintained by the quota worker.
+	StorageBytes        int64      `gorm:"not null;default:0;column:storage_bytes" json:"storage_bytes"`
+	StorageCheckedAt    *time.Time `gorm:"column:storage_checked_at" json:"storage_checked_at,omitempty"`
+	StorageAlertPercent int        `gorm:"not null;default:0;column:storage_alert_percent" json:"-"`
+	VolumeAlertPercent  int        `gorm:"not null;default:0;column:volume_alert_percent" json:"-"`
+	VolumeAlertDay      string     `gorm:"type:varchar(10);not null;default:'';column:volume_alert_day" json:"-"`
+
+	CreatedAt time.Time `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (ProjectQuota) TableName() string { return "project_quotas" }
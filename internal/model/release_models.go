@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Release is a version of a project's app, named as the SDKs send it in
+// events' release field. Releases are registered by CI through the API or
+// created from the first event that carries the version; CreatedAt orders
+// them, so it is when the release was registered or first seen.
+type Release struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID int       `gorm:"not null;uniqueIndex:idx_releases_project_version,priority:1;index:idx_releases_project_created,priority:1;column:project_id" json:"project_id"`
+	Version   string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_releases_project_version,priority:2;column:version" json:"version"`
+	Ref       string    `gorm:"type:varchar(200);not null;default:'';column:ref" json:"ref,omitempty"`
+	URL       string    `gorm:"type:text;not null;default:'';column:url" json:"url,omitempty"`
+	CreatedAt time.Time `gorm:"not null;index:idx_releases_project_created,priority:2;column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (Release) TableName() string { return "releases" }
+
+// Deploy records a release going out to one environment. FinishedAt is when
+// the deploy completed and is where deploy markers are drawn.
+type Deploy struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID   int        `gorm:"not null;index:idx_deploys_project_finished,priority:1;column:project_id" json:"project_id"`
+	ReleaseID   int64      `gorm:"not null;index;column:release_id" json:"release_id"`
+	Version     string     `gorm:"type:varchar(100);not null;column:version" json:"version"`
+	Environment string     `gorm:"type:varchar(50);not null;column:environment" json:"environment"`
+	Name        string     `gorm:"type:varchar(200);not null;default:'';column:name" json:"name,omitempty"`
+	URL         string     `gorm:"type:text;not null;default:'';column:url" json:"url,omitempty"`
+	StartedAt   *time.Time `gorm:"column:started_at" json:"started_at,omitempty"`
+	FinishedAt  time.Time  `gorm:"not null;index:idx_deploys_project_finished,priority:2;column:finished_at" json:"finished_at"`
+	CreatedAt   time.Time  `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+}
+
+func (Deploy) TableName() string { return "deploys" }
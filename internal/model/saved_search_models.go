@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// SavedSearch is a log search kept under a name: the query (search DSL), the
+// time range as given (RFC 3339 or relative such as now-7d, resolved when the
+// search runs), the columns to show and the timestamp order. It is visible to
+// its owner, and to the whole project when Shared.
+//
+// With ScheduleEnabled it also runs on a UTC schedule (every hour at
+// ScheduleMinuteUTC, every day, or every week on ScheduleWeekday) and sends
+// the hit count, or a CSV of the first DeliveryRows hits, to Channels
+// ([]channel.ChannelConfig) through the alert delivery queue.
+type SavedSearch struct {
+	ID          int            `gorm:"primaryKey;autoIncrement;column:id" json:"id"`
+	ProjectID   int            `gorm:"not null;index;column:project_id" json:"project_id"`
+	OwnerUserID int64          `gorm:"not null;default:0;index;column:owner_user_id" json:"owner_user_id"`
+	Name        string         `gorm:"type:varchar(255);not null;column:name" json:"name"`
+	Description string         `gorm:"type:text;not null;default:'';column:description" json:"description,omitempty"`
+	Query       string         `gorm:"type:text;not null;default:'';column:query" json:"query"`
+	Sources     string         `gorm:"type:varchar(64);not null;default:'';column:sources" json:"sources,omitempty"`
+	Start       string         `gorm:"type:varchar(64);not null;default:'';column:range_start" json:"start,omitempty"`
+	End         string         `gorm:"type:varchar(64);not null;default:'';column:range_end" json:"end,omitempty"`
+	Columns     datatypes.JSON `gorm:"type:jsonb;not null;default:'[]';column:columns" json:"columns"`
+	Sort        string         `gorm:"type:varchar(8);not null;default:'desc';column:sort" json:"sort"` // timestamp order: desc, asc
+	Shared      bool           `gorm:"not null;default:false;column:shared" json:"shared"`
+
+	ScheduleEnabled   bool           `gorm:"not null;default:false;column:schedule_enabled" json:"schedule_enabled"`
+	ScheduleFrequency string         `gorm:"type:varchar(16);not null;default:'weekly';column:schedule_frequency" json:"schedule_frequency"` // hourly, daily, weekly
+	ScheduleWeekday   int            `gorm:"not null;default:1;column:schedule_weekday" json:"schedule_weekday"`                             // 0 = Sunday
+	ScheduleHourUTC   int            `gorm:"not null;default:9;column:schedule_hour_utc" json:"schedule_hour_utc"`
+	ScheduleMinuteUTC int            `gorm:"not null;default:0;column:schedule_minute_utc" json:"schedule_minute_utc"`
+	DeliveryFormat    string         `gorm:"type:varchar(16);not null;default:'count';column:delivery_format" json:"delivery_format"` // count, csv
+	DeliveryRows      int            `gorm:"not null;default:20;column:delivery_rows" json:"delivery_rows"`
+	Channels          datatypes.JSON `gorm:"type:jsonb;not null;default:'[]';column:channels" json:"channels"`
+
+	// Maintained by the saved search worker.
+	NextRunAt *time.Time `gorm:"index;column:next_run_at" json:"next_run_at,omitempty"`
+	LastRunAt *time.Time `gorm:"column:last_run_at" json:"last_run_at,omitempty"`
+	LastHits  int64      `gorm:"not null;default:0;column:last_hits" json:"last_hits"`
+	LastError string     `gorm:"type:text;not null;default:'';column:last_error" json:"last_error,omitempty"`
+
+	CreatedAt time.Time `gorm:"not null;autoCreateTime;column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (SavedSearch) TableName() string { return "saved_searches" }
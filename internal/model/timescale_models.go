@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// TimescaleSettings is the singleton row (id=1) holding the managed
+// TimescaleDB policies. It is seeded from env on first start and edited via
+// the admin API afterwards.
+type TimescaleSettings struct {
+	ID                   int       `gorm:"primaryKey;column:id" json:"-"`
+	CompressAfterDays    int       `gorm:"not null;default:0;column:compress_after_days" json:"compress_after_days"`
+	RetentionEnabled     bool      `gorm:"not null;default:false;column:retention_enabled" json:"retention_enabled"`
+	ContinuousAggregates bool      `gorm:"not null;default:false;column:continuous_aggregates" json:"continuous_aggregates"`
+	UpdatedAt            time.Time `gorm:"not null;autoUpdateTime;column:updated_at" json:"updated_at"`
+}
+
+func (TimescaleSettings) TableName() string { return "timescale_settings" }
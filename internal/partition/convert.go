@@ -0,0 +1,198 @@
+package partition
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConvertAll partitions every table in Tables that is not partitioned yet.
+func ConvertAll(ctx context.Context, db *gorm.DB, period Period, premake int, now time.Time) error {
+	for _, t := range Tables {
+		if err := Convert(ctx, db, t.Name, period, premake, now); err != nil {
+			return fmt.Errorf("partition %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Convert turns a plain table into a range-partitioned one in place. The
+// existing heap is renamed to <table>_legacy and attached as the partition
+// covering everything before the first managed period, so no rows are copied;
+// retention drops it like any other partition once it has expired.
+//
+// The slow steps run before the table is locked, while ingest goes on:
+// unique indexes that must include the partition key are built CONCURRENTLY,
+// and the CHECK matching the legacy bound is added NOT VALID and validated
+// separately. The final transaction then only renames, creates the parent
+// and attaches the heap, which adopts those indexes and trusts the validated
+// CHECK instead of scanning. Non-unique indexes are reused as-is. On a large
+// table the first run still takes a while and needs a generous
+// DB_MIGRATE_TIMEOUT.
+func Convert(ctx context.Context, db *gorm.DB, table string, period Period, premake int, now time.Time) error {
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	partitioned, err := IsPartitioned(ctx, db, table)
+	if err != nil || partitioned {
+		return err
+	}
+	gdb := db.WithContext(ctx)
+
+	var indexes []struct {
+		Name      string
+		Def       string
+		IsPrimary bool
+		IsUnique  bool
+	}
+	if err := gdb.Raw(`
+		SELECT i.relname AS name, pg_get_indexdef(i.oid) AS def, x.indisprimary AS is_primary, x.indisunique AS is_unique
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		WHERE x.indrelid = to_regclass(?) AND i.relname NOT LIKE '%\_part'
+	`, table).Scan(&indexes).Error; err != nil {
+		return err
+	}
+
+	var maxTS sql.NullTime
+	if err := gdb.Raw(fmt.Sprintf(`SELECT MAX("timestamp") FROM %s`, quoteIdent(table))).Scan(&maxTS).Error; err != nil {
+		return err
+	}
+	// One period of headroom: rows keep arriving until the ATTACH and must
+	// pass the CHECK meanwhile, including slightly future-dated ones.
+	cutover := period.Next(period.Next(period.Start(now)))
+	if maxTS.Valid && !maxTS.Time.Before(cutover) {
+		cutover = period.Next(period.Start(maxTS.Time))
+	}
+
+	var seq sql.NullString
+	if err := gdb.Raw(`SELECT pg_get_serial_sequence(?, 'id')`, table).Scan(&seq).Error; err != nil {
+		return err
+	}
+
+	legacy := legacyName(table)
+	check := quoteIdent(legacy + "_bound")
+
+	// Build the partition-key variants of the primary key and unique indexes
+	// next to the old ones without blocking writes. A failed earlier run can
+	// leave an invalid index behind, so it is dropped first.
+	swap := []string{fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, quoteIdent(table), quoteIdent(legacy))}
+	var parentIndexes []string
+	for _, idx := range indexes {
+		switch {
+		case idx.IsPrimary, idx.IsUnique:
+			cols, err := withPartitionKey(idx.Def)
+			if err != nil {
+				return fmt.Errorf("index %s: %w", idx.Name, err)
+			}
+			part := partIndexName(idx.Name)
+			for _, stmt := range []string{
+				fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS %s`, quoteIdent(part)),
+				fmt.Sprintf(`CREATE UNIQUE INDEX CONCURRENTLY %s ON %s (%s)`, quoteIdent(part), quoteIdent(table), cols),
+			} {
+				if err := gdb.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("%s: %w", stmt, err)
+				}
+			}
+			if idx.IsPrimary {
+				// ATTACH only adopts an index for the parent's key when it
+				// backs a constraint on the partition too.
+				swap = append(swap,
+					fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s`, quoteIdent(legacy), quoteIdent(idx.Name)),
+					fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s PRIMARY KEY USING INDEX %s`, quoteIdent(legacy), quoteIdent(legacyIndexName(idx.Name)), quoteIdent(part)),
+				)
+				parentIndexes = append(parentIndexes, fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s PRIMARY KEY (%s)`, quoteIdent(table), quoteIdent(idx.Name), cols))
+			} else {
+				swap = append(swap,
+					fmt.Sprintf(`DROP INDEX %s`, quoteIdent(idx.Name)),
+					fmt.Sprintf(`ALTER INDEX %s RENAME TO %s`, quoteIdent(part), quoteIdent(legacyIndexName(idx.Name))),
+				)
+				parentIndexes = append(parentIndexes, fmt.Sprintf(`CREATE UNIQUE INDEX %s ON %s (%s)`, quoteIdent(idx.Name), quoteIdent(table), cols))
+			}
+		default:
+			// Free the name for the parent; ATTACH adopts the renamed index
+			// because its definition matches.
+			swap = append(swap, fmt.Sprintf(`ALTER INDEX %s RENAME TO %s`, quoteIdent(idx.Name), quoteIdent(legacyIndexName(idx.Name))))
+			// pg_get_indexdef captured "ON <table>", which now names the parent.
+			parentIndexes = append(parentIndexes, idx.Def)
+		}
+	}
+
+	// ADD ... NOT VALID only takes the lock briefly; VALIDATE does the full
+	// scan under SHARE UPDATE EXCLUSIVE, so ingest continues during it.
+	for _, stmt := range []string{
+		fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s`, quoteIdent(table), check),
+		fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT %s CHECK ("timestamp" IS NOT NULL AND "timestamp" < %s) NOT VALID`, quoteIdent(table), check, boundLiteral(cutover)),
+		fmt.Sprintf(`ALTER TABLE %s VALIDATE CONSTRAINT %s`, quoteIdent(table), check),
+	} {
+		if err := gdb.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+
+	return gdb.Transaction(func(tx *gorm.DB) error {
+		stmts := append(swap, fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING STORAGE INCLUDING COMMENTS) PARTITION BY RANGE ("timestamp")`, quoteIdent(table), quoteIdent(legacy)))
+		if seq.Valid && seq.String != "" {
+			// The sequence is owned by the legacy heap; re-home it so dropping
+			// that partition later doesn't take the id default with it.
+			stmts = append(stmts, fmt.Sprintf(`ALTER SEQUENCE %s OWNED BY %s.id`, seq.String, quoteIdent(table)))
+		}
+		stmts = append(stmts, parentIndexes...)
+		// The validated CHECK implies the bound, so ATTACH skips its scan.
+		stmts = append(stmts,
+			fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO (%s)`, quoteIdent(table), quoteIdent(legacy), boundLiteral(cutover)),
+			fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s`, quoteIdent(legacy), check),
+		)
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("%s: %w", stmt, err)
+			}
+		}
+
+		if err := ensureRange(ctx, tx, table, period, premake, now); err != nil {
+			return err
+		}
+		return tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s DEFAULT`, quoteIdent(defaultName(table)), quoteIdent(table))).Error
+	})
+}
+
+var indexColsRe = regexp.MustCompile(`USING \w+ \(([^()]+)\)$`)
+
+// withPartitionKey extracts the column list of a plain btree index definition
+// and appends "timestamp" unless it is already part of the key.
+func withPartitionKey(def string) (string, error) {
+	m := indexColsRe.FindStringSubmatch(strings.TrimSpace(def))
+	if m == nil {
+		return "", fmt.Errorf("unsupported unique index for partitioning: %s", def)
+	}
+	cols := m[1]
+	for _, c := range strings.Split(cols, ",") {
+		if strings.Trim(strings.TrimSpace(c), `"`) == "timestamp" {
+			return cols, nil
+		}
+	}
+	return cols + `, "timestamp"`, nil
+}
+
+func legacyIndexName(name string) string {
+	return suffixedName(name, "_legacy")
+}
+
+// partIndexName names the unique index built with the partition key before
+// the swap.
+func partIndexName(name string) string {
+	return suffixedName(name, "_part")
+}
+
+func suffixedName(name, suffix string) string {
+	const maxIdent = 63
+	if len(name)+len(suffix) > maxIdent {
+		name = name[:maxIdent-len(suffix)]
+	}
+	return name + suffix
+}
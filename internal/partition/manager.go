@@ -0,0 +1,224 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aak1247/logtap/internal/retention"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// Manager keeps future partitions available and drops expired ones.
+type Manager struct {
+	DB       *gorm.DB
+	Period   Period
+	Premake  int
+	Interval time.Duration
+}
+
+func NewManager(db *gorm.DB, period Period) *Manager {
+	return &Manager{
+		DB:       db,
+		Period:   period,
+		Premake:  7,
+		Interval: time.Hour,
+	}
+}
+
+// Run pre-creates partitions immediately and then on every tick.
+func (m *Manager) Run(ctx context.Context) {
+	if m == nil || m.DB == nil {
+		return
+	}
+	m.tick(ctx)
+
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.tick(ctx)
+		}
+	}
+}
+
+func (m *Manager) tick(ctx context.Context) {
+	runCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	if err := m.EnsureFuture(runCtx, time.Now().UTC()); err != nil {
+		log.Printf("partition: ensure future: %v", err)
+	}
+}
+
+// EnsureFuture creates partitions for the current period and the next Premake
+// periods on every partitioned table. Tables that are not partitioned (e.g.
+// Timescale hypertables) are skipped.
+func (m *Manager) EnsureFuture(ctx context.Context, now time.Time) error {
+	for _, t := range Tables {
+		partitioned, err := IsPartitioned(ctx, m.DB, t.Name)
+		if err != nil {
+			return err
+		}
+		if !partitioned {
+			continue
+		}
+		if err := ensureRange(ctx, m.DB, t.Name, m.Period, m.Premake, now); err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// DropExpired drops whole partitions that are past retention for every
+// project with rows in them and returns their names. Rows of projects with
+// longer (or no) policies keep a partition alive; those are left to the
+// batched per-project deletes. Archive-enabled projects count as expired only
+// up to what has been archived.
+func (m *Manager) DropExpired(ctx context.Context, now time.Time) ([]string, error) {
+	if m == nil || m.DB == nil {
+		return nil, nil
+	}
+	policies, err := store.ListEnabledCleanupPolicies(ctx, m.DB)
+	if err != nil {
+		return nil, err
+	}
+	var dropped []string
+	for _, t := range Tables {
+		cutoffs := make(map[int]time.Time, len(policies))
+		var latest time.Time
+		for _, p := range policies {
+			days := t.Retention(p)
+			if days <= 0 {
+				continue
+			}
+			cutoff := now.Add(-time.Duration(days) * 24 * time.Hour)
+			if t.Archived && p.ArchiveEnabled {
+				if rules, _ := retention.Rules(p); len(rules) > 0 {
+					// Rows a rule kept longer expire after the archiver's
+					// bound moved past them; leave them to the batched
+					// deletes, which archive them first.
+					continue
+				}
+				// Never drop rows the archiver has not exported yet.
+				archived, ok, err := store.ArchivedUntil(ctx, m.DB, p.ProjectID, t.Name)
+				if err != nil {
+					return dropped, err
+				}
+				if !ok {
+					continue
+				}
+				if archived.Before(cutoff) {
+					cutoff = archived
+				}
+			}
+			cutoffs[p.ProjectID] = cutoff
+			if cutoff.After(latest) {
+				latest = cutoff
+			}
+		}
+		if len(cutoffs) == 0 {
+			continue
+		}
+		partitioned, err := IsPartitioned(ctx, m.DB, t.Name)
+		if err != nil {
+			return dropped, err
+		}
+		if !partitioned {
+			continue
+		}
+		parts, err := List(ctx, m.DB, t.Name)
+		if err != nil {
+			return dropped, err
+		}
+		for _, p := range parts {
+			if p.Default || p.To.IsZero() || p.To.After(latest) {
+				continue
+			}
+			projects, err := projectsIn(ctx, m.DB, p.Name)
+			if err != nil {
+				return dropped, err
+			}
+			if !droppable(p.To, projects, cutoffs) {
+				continue
+			}
+			if err := m.DB.WithContext(ctx).Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, quoteIdent(p.Name))).Error; err != nil {
+				return dropped, err
+			}
+			dropped = append(dropped, p.Name)
+		}
+	}
+	return dropped, nil
+}
+
+// ensureRange creates missing partitions from the current period through
+// premake periods ahead. Ranges already covered (e.g. by the legacy heap or
+// by partitions of a previous period setting) are left alone.
+func ensureRange(ctx context.Context, db *gorm.DB, table string, period Period, premake int, now time.Time) error {
+	if premake < 0 {
+		premake = 0
+	}
+	parts, err := List(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	hasDefault := false
+	for _, p := range parts {
+		if p.Default {
+			hasDefault = true
+		}
+	}
+	start := period.Start(now)
+	for i := 0; i <= premake; i++ {
+		end := period.Next(start)
+		if !overlaps(parts, start, end) {
+			if err := createPartition(ctx, db, table, start, end, hasDefault); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// createPartition adds [from, to) to table. Rows that already landed in the
+// default partition for that range (far-future timestamps) are moved into the
+// new partition first, otherwise Postgres refuses to create it.
+func createPartition(ctx context.Context, db *gorm.DB, table string, from, to time.Time, hasDefault bool) error {
+	name := quoteIdent(partitionName(table, from))
+	parent := quoteIdent(table)
+	bounds := fmt.Sprintf(`FOR VALUES FROM (%s) TO (%s)`, boundLiteral(from), boundLiteral(to))
+	gdb := db.WithContext(ctx)
+
+	var stray int64
+	if hasDefault {
+		if err := gdb.Raw(
+			fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE "timestamp" >= ? AND "timestamp" < ?`, quoteIdent(defaultName(table))),
+			from, to,
+		).Scan(&stray).Error; err != nil {
+			return err
+		}
+	}
+	if stray == 0 {
+		return gdb.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s %s`, name, parent, bounds)).Error
+	}
+	return gdb.Transaction(func(tx *gorm.DB) error {
+		stmts := []string{
+			fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING STORAGE)`, name, parent),
+			fmt.Sprintf(`WITH moved AS (DELETE FROM %s WHERE "timestamp" >= %s AND "timestamp" < %s RETURNING *) INSERT INTO %s SELECT * FROM moved`,
+				quoteIdent(defaultName(table)), boundLiteral(from), boundLiteral(to), name),
+			fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s %s`, parent, name, bounds),
+		}
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,260 @@
+// Package partition manages native Postgres range partitioning of the
+// time-series tables for installs without TimescaleDB.
+//
+// Unique indexes of a partitioned table must contain the partition key, so
+// converting a table adds "timestamp" to them. Deduplication by ingest_id is
+// weaker as a result: track_events then dedupes on (project_id, ingest_id,
+// timestamp), which catches a redelivered queue message (it keeps its
+// timestamp) but not a client resending the same ingest_id with a new one.
+package partition
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/retention"
+	"gorm.io/gorm"
+)
+
+// Period is the width of one range partition.
+type Period string
+
+const (
+	Day  Period = "day"
+	Week Period = "week"
+)
+
+// ParsePeriod accepts "day" or "week"; anything else (including "off") disables partitioning.
+func ParsePeriod(s string) (Period, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case string(Day):
+		return Day, true
+	case string(Week):
+		return Week, true
+	default:
+		return "", false
+	}
+}
+
+// Start truncates t to the beginning of its period in UTC. Weeks start on Monday.
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if p == Week {
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// Next returns the start of the period following the one starting at start.
+func (p Period) Next(start time.Time) time.Time {
+	if p == Week {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Table describes a time-series table partitioned on its "timestamp" column.
+type Table struct {
+	Name string
+	// Retention is the longest any row of this table is kept (days; <= 0 keeps data forever).
+	Retention func(model.CleanupPolicy) int
+	// Archived tables are exported to the cold archive for archive-enabled
+	// projects; their partitions may only be dropped once archived.
+	Archived bool
+}
+
+// Tables lists every table the partition manager owns.
+var Tables = []Table{
+	{Name: "logs", Retention: func(p model.CleanupPolicy) int { return retention.LongestDays(p, retention.TableLogs) }, Archived: true},
+	{Name: "events", Retention: func(p model.CleanupPolicy) int { return retention.LongestDays(p, retention.TableEvents) }, Archived: true},
+	{Name: "track_events", Retention: func(p model.CleanupPolicy) int { return retention.LongestDays(p, retention.TableTrackEvents) }, Archived: true},
+	// Detector results have no policy of their own; they follow log retention.
+	{Name: "detector_results", Retention: func(p model.CleanupPolicy) int { return p.LogsRetentionDays }},
+}
+
+// Partition is one child of a partitioned table. A zero From means MINVALUE
+// (the converted legacy heap); Default partitions have no bounds.
+type Partition struct {
+	Name    string
+	From    time.Time
+	To      time.Time
+	Default bool
+}
+
+func partitionName(table string, start time.Time) string {
+	return fmt.Sprintf("%s_p%s", table, start.UTC().Format("20060102"))
+}
+
+func legacyName(table string) string  { return table + "_legacy" }
+func defaultName(table string) string { return table + "_default" }
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func boundLiteral(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339) + "'"
+}
+
+// IsPartitioned reports whether table exists and is a declaratively partitioned table.
+func IsPartitioned(ctx context.Context, db *gorm.DB, table string) (bool, error) {
+	if db == nil {
+		return false, gorm.ErrInvalidDB
+	}
+	var partitioned bool
+	err := db.WithContext(ctx).Raw(
+		`SELECT COALESCE((SELECT relkind = 'p' FROM pg_class WHERE oid = to_regclass(?)), false)`,
+		table,
+	).Scan(&partitioned).Error
+	return partitioned, err
+}
+
+// ConcurrentIndexes reports whether indexes on table can be built and
+// dropped CONCURRENTLY: PostgreSQL refuses it on a partitioned table and
+// TimescaleDB on a hypertable, which take a plain build instead.
+func ConcurrentIndexes(ctx context.Context, db *gorm.DB, table string) (bool, error) {
+	partitioned, err := IsPartitioned(ctx, db, table)
+	if err != nil || partitioned {
+		return false, err
+	}
+	var hypertable bool
+	if err := db.WithContext(ctx).Raw(
+		`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')`,
+	).Scan(&hypertable).Error; err != nil || !hypertable {
+		return true, err
+	}
+	if err := db.WithContext(ctx).Raw(
+		`SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = ?)`, table,
+	).Scan(&hypertable).Error; err != nil {
+		return false, err
+	}
+	return !hypertable, nil
+}
+
+// List returns the partitions of table ordered by lower bound (default last).
+func List(ctx context.Context, db *gorm.DB, table string) ([]Partition, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	if err := db.WithContext(ctx).Raw(`
+		SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass(?)
+	`, table).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Partition, 0, len(rows))
+	for _, r := range rows {
+		p, err := parseBound(r.Bound)
+		if err != nil {
+			return nil, fmt.Errorf("partition %s: %w", r.Name, err)
+		}
+		p.Name = r.Name
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Default != out[j].Default {
+			return !out[i].Default
+		}
+		return out[i].From.Before(out[j].From)
+	})
+	return out, nil
+}
+
+var boundRe = regexp.MustCompile(`^FOR VALUES FROM \((.+?)\) TO \((.+?)\)$`)
+
+// parseBound decodes pg_get_expr(relpartbound) output, e.g.
+// FOR VALUES FROM ('2026-01-01 00:00:00+00') TO ('2026-01-02 00:00:00+00').
+func parseBound(expr string) (Partition, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.EqualFold(expr, "DEFAULT") {
+		return Partition{Default: true}, nil
+	}
+	m := boundRe.FindStringSubmatch(expr)
+	if m == nil {
+		return Partition{}, fmt.Errorf("unsupported partition bound %q", expr)
+	}
+	from, err := parseBoundValue(m[1])
+	if err != nil {
+		return Partition{}, err
+	}
+	to, err := parseBoundValue(m[2])
+	if err != nil {
+		return Partition{}, err
+	}
+	return Partition{From: from, To: to}, nil
+}
+
+// parseBoundValue returns the zero time for MINVALUE/MAXVALUE.
+func parseBoundValue(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if strings.EqualFold(v, "MINVALUE") || strings.EqualFold(v, "MAXVALUE") {
+		return time.Time{}, nil
+	}
+	v = strings.Trim(v, "'")
+	// Rendered in the session TimeZone; the offset may carry minutes.
+	for _, layout := range []string{"2006-01-02 15:04:05-07", "2006-01-02 15:04:05-07:00", "2006-01-02 15:04:05-07:00:00"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized partition bound value %q", v)
+}
+
+func overlaps(parts []Partition, from, to time.Time) bool {
+	for _, p := range parts {
+		if p.Default {
+			continue
+		}
+		if (p.From.IsZero() || p.From.Before(to)) && (p.To.IsZero() || p.To.After(from)) {
+			return true
+		}
+	}
+	return false
+}
+
+// droppable reports whether a partition ending at to has expired for every
+// project that still has rows in it. Projects without an enabled policy for
+// the table (no cutoff) keep the partition alive.
+func droppable(to time.Time, projects []int, cutoffs map[int]time.Time) bool {
+	if to.IsZero() {
+		return false
+	}
+	for _, id := range projects {
+		cutoff, ok := cutoffs[id]
+		if !ok || to.After(cutoff) {
+			return false
+		}
+	}
+	return true
+}
+
+// projectsIn lists distinct project ids in a partition using a skip scan over
+// the (project_id, timestamp) index, so it stays cheap on large partitions.
+func projectsIn(ctx context.Context, db *gorm.DB, partition string) ([]int, error) {
+	q := fmt.Sprintf(`
+		WITH RECURSIVE p AS (
+			SELECT MIN(project_id) AS id FROM %[1]s
+			UNION ALL
+			SELECT (SELECT MIN(project_id) FROM %[1]s WHERE project_id > p.id) FROM p WHERE p.id IS NOT NULL
+		)
+		SELECT id FROM p WHERE id IS NOT NULL
+	`, quoteIdent(partition))
+	var ids []int
+	if err := db.WithContext(ctx).Raw(q).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
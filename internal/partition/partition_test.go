@@ -0,0 +1,120 @@
+package partition
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodStartAndNext(t *testing.T) {
+	// 2026-10-18 is a Sunday.
+	ts := time.Date(2026, 10, 18, 15, 30, 0, 0, time.FixedZone("UTC+8", 8*3600))
+
+	if got := Day.Start(ts); !got.Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("day start: %v", got)
+	}
+	weekStart := Week.Start(ts)
+	if !weekStart.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("week start: %v", weekStart)
+	}
+	if got := Week.Next(weekStart); !got.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("week next: %v", got)
+	}
+	if got := partitionName("logs", weekStart); got != "logs_p20261012" {
+		t.Fatalf("partition name: %q", got)
+	}
+	if _, ok := ParsePeriod("off"); ok {
+		t.Fatalf("expected off to disable partitioning")
+	}
+	if p, ok := ParsePeriod(" Week "); !ok || p != Week {
+		t.Fatalf("expected week, got %q ok=%v", p, ok)
+	}
+}
+
+func TestParseBound(t *testing.T) {
+	p, err := parseBound(`FOR VALUES FROM ('2026-10-18 08:00:00+08') TO ('2026-10-19 00:00:00+00')`)
+	if err != nil {
+		t.Fatalf("parseBound: %v", err)
+	}
+	if !p.From.Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)) || !p.To.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected bounds: %+v", p)
+	}
+
+	legacy, err := parseBound(`FOR VALUES FROM (MINVALUE) TO ('2026-10-19 05:30:00+05:30')`)
+	if err != nil {
+		t.Fatalf("parseBound legacy: %v", err)
+	}
+	if !legacy.From.IsZero() || !legacy.To.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected legacy bounds: %+v", legacy)
+	}
+
+	def, err := parseBound("DEFAULT")
+	if err != nil || !def.Default {
+		t.Fatalf("expected default partition, got %+v err=%v", def, err)
+	}
+	if _, err := parseBound(`FOR VALUES IN (1)`); err == nil {
+		t.Fatalf("expected error for list partition bound")
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	d := func(day int) time.Time { return time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC) }
+	parts := []Partition{
+		{Name: "logs_legacy", To: d(13)},
+		{Name: "logs_p20261013", From: d(13), To: d(14)},
+		{Name: "logs_default", Default: true},
+	}
+	if !overlaps(parts, d(12), d(13)) {
+		t.Fatalf("expected legacy range to overlap")
+	}
+	if !overlaps(parts, d(12), d(19)) {
+		t.Fatalf("expected week to overlap existing days")
+	}
+	if overlaps(parts, d(14), d(15)) {
+		t.Fatalf("expected free range")
+	}
+}
+
+func TestDroppable(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	cutoffs := map[int]time.Time{
+		1: now.AddDate(0, 0, -7),
+		2: now.AddDate(0, 0, -30),
+	}
+	weekAgo := now.AddDate(0, 0, -7)
+
+	if !droppable(weekAgo, []int{1}, cutoffs) {
+		t.Fatalf("expected partition expired for project 1")
+	}
+	if droppable(weekAgo, []int{1, 2}, cutoffs) {
+		t.Fatalf("project 2 keeps data for 30 days")
+	}
+	if droppable(weekAgo, []int{1, 3}, cutoffs) {
+		t.Fatalf("project 3 has no policy and keeps data forever")
+	}
+	if !droppable(weekAgo, nil, cutoffs) {
+		t.Fatalf("expected empty expired partition to be droppable")
+	}
+	if droppable(time.Time{}, nil, cutoffs) {
+		t.Fatalf("unbounded partition must never be dropped")
+	}
+}
+
+func TestWithPartitionKey(t *testing.T) {
+	cases := map[string]string{
+		`CREATE UNIQUE INDEX logs_pkey ON public.logs USING btree (id)`:                          `id, "timestamp"`,
+		`CREATE UNIQUE INDEX idx_logs_dedupe ON public.logs USING btree (project_id, ingest_id)`: `project_id, ingest_id, "timestamp"`,
+		`CREATE UNIQUE INDEX idx_x ON public.logs USING btree (project_id, "timestamp")`:         `project_id, "timestamp"`,
+	}
+	for def, want := range cases {
+		got, err := withPartitionKey(def)
+		if err != nil || got != want {
+			t.Fatalf("withPartitionKey(%q)=%q err=%v want %q", def, got, err, want)
+		}
+	}
+	if _, err := withPartitionKey(`CREATE UNIQUE INDEX idx_y ON public.logs USING btree (project_id) WHERE (ingest_id IS NOT NULL)`); err == nil {
+		t.Fatalf("expected error for partial unique index")
+	}
+	if got := legacyIndexName("idx_track_events_project_name_ts_with_a_very_long_suffix_to_truncate"); len(got) != 63 {
+		t.Fatalf("expected name truncated to 63 chars, got %d", len(got))
+	}
+}
@@ -0,0 +1,340 @@
+// Package pattern mines message templates from logs with a Drain-style
+// online parser (He et al., "Drain: An Online Log Parsing Approach with Fixed
+// Depth Tree", ICWS 2017). Messages are masked (numbers, ids, addresses) and
+// split into tokens, routed by token count and leading tokens to a leaf, and
+// merged into the most similar template there; the tokens that differ become
+// wildcards. Each template keeps the id it was created with, which is stored
+// on the logs it matches.
+package pattern
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+)
+
+// Wildcard stands for a variable token in a template.
+const Wildcard = "<*>"
+
+const (
+	// DefaultSimilarity is the share of a template's constant tokens a
+	// message must have at the same positions to match it.
+	DefaultSimilarity = 0.4
+	// DefaultMaxClusters caps the templates kept in memory per project; the
+	// least recently matched one is forgotten first.
+	DefaultMaxClusters = 2000
+
+	// depth counts the token-count layer, the leading-token layers and the
+	// leaves.
+	depth       = 4
+	maxChildren = 100
+	maxTokens   = 64
+	maxMessage  = 2048
+)
+
+// masks replace the parts of a message that are almost always variable,
+// in order.
+var masks = []*regexp.Regexp{
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`),
+	regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+	regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`),
+	regexp.MustCompile(`\b0[xX][0-9a-fA-F]+\b`),
+	regexp.MustCompile(`\b[0-9a-fA-F]{16,}\b`),
+	regexp.MustCompile(`\b\d+(?:\.\d+)?`),
+}
+
+// Tokens masks message and splits it on white space. Messages longer than
+// maxTokens tokens end in a wildcard standing for the rest.
+func Tokens(message string) []string {
+	if len(message) > maxMessage {
+		message = message[:maxMessage]
+	}
+	for _, re := range masks {
+		message = re.ReplaceAllLiteralString(message, Wildcard)
+	}
+	tokens := strings.Fields(message)
+	if len(tokens) > maxTokens {
+		tokens = append(tokens[:maxTokens-1], Wildcard)
+	}
+	return tokens
+}
+
+// variable reports whether a token should not be a branch of its own: it
+// is or contains a wildcard, or has a digit the masks left.
+func variable(tok string) bool {
+	return strings.Contains(tok, Wildcard) || strings.ContainsAny(tok, "0123456789")
+}
+
+// ID is the pattern id of a newly created template.
+func ID(template string) string {
+	sum := sha1.Sum([]byte(template))
+	return hex.EncodeToString(sum[:8])
+}
+
+type cluster struct {
+	id     string
+	tokens []string
+	leaf   *node
+	used   uint64
+}
+
+func (c *cluster) template() string { return strings.Join(c.tokens, " ") }
+
+// similarity is the share of c's tokens equal to tokens, and the number of
+// c's wildcards.
+func (c *cluster) similarity(tokens []string) (float64, int) {
+	same, params := 0, 0
+	for i, t := range c.tokens {
+		switch {
+		case t == Wildcard:
+			params++
+		case t == tokens[i]:
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens)), params
+}
+
+func (c *cluster) merge(tokens []string) {
+	for i, t := range c.tokens {
+		if t != tokens[i] {
+			c.tokens[i] = Wildcard
+		}
+	}
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*cluster
+}
+
+func (n *node) child(tok string) *node {
+	if n.children == nil {
+		n.children = map[string]*node{}
+	}
+	if c := n.children[tok]; c != nil {
+		return c
+	}
+	if variable(tok) || len(n.children) >= maxChildren-1 {
+		tok = Wildcard
+	}
+	c := n.children[tok]
+	if c == nil {
+		c = &node{}
+		n.children[tok] = c
+	}
+	return c
+}
+
+// tree holds the templates of one project.
+type tree struct {
+	byLength map[int]*node
+	byID     map[string]*cluster
+	tick     uint64
+}
+
+func newTree() *tree {
+	return &tree{byLength: map[int]*node{}, byID: map[string]*cluster{}}
+}
+
+// search returns the leaf tokens route to without changing the tree:
+// through a token's own branch when there is one, else its wildcard branch.
+func (t *tree) search(tokens []string) *node {
+	n := t.byLength[len(tokens)]
+	for i := 0; n != nil && i < depth-2 && i < len(tokens); i++ {
+		next := n.children[tokens[i]]
+		if next == nil {
+			next = n.children[Wildcard]
+		}
+		n = next
+	}
+	return n
+}
+
+// leaf returns the leaf tokens are added to, creating the path.
+func (t *tree) leaf(tokens []string) *node {
+	n := t.byLength[len(tokens)]
+	if n == nil {
+		n = &node{}
+		t.byLength[len(tokens)] = n
+	}
+	for i := 0; i < depth-2 && i < len(tokens); i++ {
+		n = n.child(tokens[i])
+	}
+	return n
+}
+
+// match returns the most similar cluster of n, preferring the one with more
+// wildcards on ties, when it is at least sim similar.
+func match(n *node, tokens []string, sim float64) *cluster {
+	if n == nil {
+		return nil
+	}
+	var best *cluster
+	bestSim, bestParams := -1.0, -1
+	for _, c := range n.clusters {
+		s, p := c.similarity(tokens)
+		if s > bestSim || (s == bestSim && p > bestParams) {
+			best, bestSim, bestParams = c, s, p
+		}
+	}
+	if best == nil || bestSim < sim {
+		return nil
+	}
+	return best
+}
+
+func (t *tree) add(tokens []string, sim float64, max int) *cluster {
+	t.tick++
+	if c := match(t.search(tokens), tokens, sim); c != nil {
+		c.merge(tokens)
+		c.used = t.tick
+		return c
+	}
+	id := ID(strings.Join(tokens, " "))
+	if c := t.byID[id]; c != nil {
+		c.used = t.tick
+		return c
+	}
+	return t.insert(id, tokens, max)
+}
+
+func (t *tree) insert(id string, tokens []string, max int) *cluster {
+	for len(t.byID) >= max {
+		t.evict()
+	}
+	c := &cluster{id: id, tokens: tokens, used: t.tick}
+	c.leaf = t.leaf(tokens)
+	c.leaf.clusters = append(c.leaf.clusters, c)
+	t.byID[id] = c
+	return c
+}
+
+// evict forgets the least recently matched cluster. Its leaf's path stays.
+func (t *tree) evict() {
+	var lru *cluster
+	for _, c := range t.byID {
+		if lru == nil || c.used < lru.used {
+			lru = c
+		}
+	}
+	if lru == nil {
+		return
+	}
+	delete(t.byID, lru.id)
+	for i, c := range lru.leaf.clusters {
+		if c == lru {
+			lru.leaf.clusters = append(lru.leaf.clusters[:i], lru.leaf.clusters[i+1:]...)
+			break
+		}
+	}
+}
+
+// Miner assigns logs to templates, one tree per project. With DB set, a
+// project's tree starts from its most recently seen stored patterns, so ids
+// survive restarts and mostly agree between gateways.
+type Miner struct {
+	DB          *gorm.DB
+	Similarity  float64
+	MaxClusters int
+
+	mu       sync.Mutex
+	projects map[int]*tree
+}
+
+func NewMiner(db *gorm.DB) *Miner {
+	return &Miner{
+		DB:          db,
+		Similarity:  DefaultSimilarity,
+		MaxClusters: DefaultMaxClusters,
+		projects:    map[int]*tree{},
+	}
+}
+
+// Assign sets the PatternID of every log with a message.
+func (m *Miner) Assign(ctx context.Context, rows []model.Log) {
+	if m == nil {
+		return
+	}
+	seen := map[int]bool{}
+	for _, r := range rows {
+		if !seen[r.ProjectID] {
+			seen[r.ProjectID] = true
+			m.load(ctx, r.ProjectID)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range rows {
+		tokens := Tokens(rows[i].Message)
+		if len(tokens) == 0 {
+			continue
+		}
+		rows[i].PatternID = m.projects[rows[i].ProjectID].add(tokens, m.Similarity, m.maxClusters()).id
+	}
+}
+
+func (m *Miner) maxClusters() int {
+	if m.MaxClusters <= 0 {
+		return DefaultMaxClusters
+	}
+	return m.MaxClusters
+}
+
+// Template returns the current template of a pattern the miner knows.
+func (m *Miner) Template(projectID int, patternID string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.projects[projectID]
+	if t == nil {
+		return "", false
+	}
+	c := t.byID[patternID]
+	if c == nil {
+		return "", false
+	}
+	return c.template(), true
+}
+
+// load creates the project's tree the first time it is seen.
+func (m *Miner) load(ctx context.Context, projectID int) {
+	m.mu.Lock()
+	_, ok := m.projects[projectID]
+	m.mu.Unlock()
+	if ok {
+		return
+	}
+
+	t := newTree()
+	if m.DB != nil {
+		var stored []model.LogPattern
+		_ = m.DB.WithContext(ctx).
+			Select("pattern_id, template").
+			Where("project_id = ?", projectID).
+			Order("last_seen DESC").
+			Limit(m.maxClusters()).
+			Find(&stored).Error
+		// Oldest first, so that the most recent are evicted last.
+		for i := len(stored) - 1; i >= 0; i-- {
+			if tokens := strings.Fields(stored[i].Template); len(tokens) > 0 {
+				t.tick++
+				t.insert(stored[i].PatternID, tokens, m.maxClusters())
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.projects[projectID]; !ok {
+		m.projects[projectID] = t
+	}
+}
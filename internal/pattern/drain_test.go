@@ -0,0 +1,83 @@
+package pattern
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aak1247/logtap/internal/model"
+)
+
+func TestTokensMasks(t *testing.T) {
+	for msg, want := range map[string]string{
+		"user 42 logged in from 10.0.0.7:5432":                     "user <*> logged in from <*>",
+		"request 3f2b6c1e-8a4d-4b7e-9c1a-2d3e4f5a6b7c took 12.5ms": "request <*> took <*>ms",
+		"at 2025-05-01T10:00:00.123Z wrote 0x1f bytes to v2 cache": "at <*> wrote <*> bytes to v2 cache",
+		"trace 4bf92f3577b34da6a3ce929d0e0e4736 sampled":           "trace <*> sampled",
+		"  spaced\tout  ": "spaced out",
+	} {
+		if got := strings.Join(Tokens(msg), " "); got != want {
+			t.Fatalf("Tokens(%q) = %q, want %q", msg, got, want)
+		}
+	}
+	long := strings.Repeat("word ", 100)
+	if tokens := Tokens(long); len(tokens) != maxTokens || tokens[maxTokens-1] != Wildcard {
+		t.Fatalf("long message: %d tokens, last %q", len(tokens), tokens[len(tokens)-1])
+	}
+}
+
+func TestMinerMergesVariableTokens(t *testing.T) {
+	m := NewMiner(nil)
+	rows := []model.Log{
+		{ProjectID: 1, Message: "connection to db-primary failed: timeout"},
+		{ProjectID: 1, Message: "connection to db-replica failed: timeout"},
+		{ProjectID: 1, Message: "connection to cache failed: refused"},
+		{ProjectID: 1, Message: "user 7 signed up"},
+		{ProjectID: 1, Message: "user 8 signed up"},
+		{ProjectID: 2, Message: "user 9 signed up"},
+	}
+	m.Assign(context.Background(), rows)
+
+	if rows[0].PatternID == "" || rows[0].PatternID != rows[1].PatternID || rows[1].PatternID != rows[2].PatternID {
+		t.Fatalf("expected the connection errors to share a pattern: %q %q %q", rows[0].PatternID, rows[1].PatternID, rows[2].PatternID)
+	}
+	if tmpl, _ := m.Template(1, rows[0].PatternID); tmpl != "connection to <*> failed: <*>" {
+		t.Fatalf("template = %q", tmpl)
+	}
+	// The id is the one the pattern was created with.
+	if rows[0].PatternID != ID("connection to db-primary failed: timeout") {
+		t.Fatalf("id changed as the template generalized")
+	}
+	if rows[3].PatternID != rows[4].PatternID || rows[3].PatternID == rows[0].PatternID {
+		t.Fatalf("signups: %q %q", rows[3].PatternID, rows[4].PatternID)
+	}
+	// Projects have their own trees, but equal templates get equal ids.
+	if rows[5].PatternID != rows[3].PatternID {
+		t.Fatalf("project 2 signup id = %q, want %q", rows[5].PatternID, rows[3].PatternID)
+	}
+	if _, ok := m.Template(2, rows[0].PatternID); ok {
+		t.Fatalf("project 2 should not know project 1's patterns")
+	}
+}
+
+func TestMinerEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMiner(nil)
+	m.MaxClusters = 3
+	assign := func(msg string) string {
+		rows := []model.Log{{ProjectID: 1, Message: msg}}
+		m.Assign(context.Background(), rows)
+		return rows[0].PatternID
+	}
+	first := assign("alpha happened")
+	for i := 0; i < 3; i++ {
+		assign(fmt.Sprintf("event%c one two three", 'a'+i))
+		assign("alpha happened")
+	}
+	if _, ok := m.Template(1, first); !ok {
+		t.Fatalf("the recently used pattern was evicted")
+	}
+	if _, ok := m.Template(1, ID("eventa one two three")); ok {
+		t.Fatalf("expected the oldest pattern to be evicted")
+	}
+}
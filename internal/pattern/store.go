@@ -0,0 +1,329 @@
+package pattern
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BucketSize is the width of the buckets pattern counts are kept in.
+const BucketSize = 5 * time.Minute
+
+// Bucket returns the start of the bucket t falls in.
+func Bucket(t time.Time) time.Time { return t.UTC().Truncate(BucketSize) }
+
+// Record adds logs to the counts of their patterns, saving each pattern's
+// current template. Logs without a PatternID, or whose pattern the miner no
+// longer knows, are skipped.
+func (m *Miner) Record(ctx context.Context, rows []model.Log) error {
+	if m == nil || m.DB == nil || len(rows) == 0 {
+		return nil
+	}
+	type key struct {
+		projectID int
+		patternID string
+	}
+	type bucketKey struct {
+		key
+		bucket time.Time
+	}
+	patterns := map[key]*model.LogPattern{}
+	buckets := map[bucketKey]*model.LogPatternCount{}
+	var order []key
+	var countOrder []bucketKey
+	for _, r := range rows {
+		if r.PatternID == "" {
+			continue
+		}
+		k := key{projectID: r.ProjectID, patternID: r.PatternID}
+		p, ok := patterns[k]
+		if !ok {
+			template, known := m.Template(r.ProjectID, r.PatternID)
+			if !known {
+				continue
+			}
+			p = &model.LogPattern{ProjectID: r.ProjectID, PatternID: r.PatternID, Template: template, Sample: r.Message, Level: r.Level, FirstSeen: r.Timestamp, LastSeen: r.Timestamp}
+			patterns[k] = p
+			order = append(order, k)
+		}
+		p.Count++
+		if r.Timestamp.Before(p.FirstSeen) {
+			p.FirstSeen = r.Timestamp
+		}
+		if !r.Timestamp.Before(p.LastSeen) {
+			p.LastSeen = r.Timestamp
+			p.Level = r.Level
+		}
+
+		bk := bucketKey{key: k, bucket: Bucket(r.Timestamp)}
+		c, ok := buckets[bk]
+		if !ok {
+			c = &model.LogPatternCount{ProjectID: r.ProjectID, PatternID: r.PatternID, Bucket: bk.bucket}
+			buckets[bk] = c
+			countOrder = append(countOrder, bk)
+		}
+		c.Count++
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	upserts := make([]model.LogPattern, 0, len(order))
+	for _, k := range order {
+		upserts = append(upserts, *patterns[k])
+	}
+	countRows := make([]model.LogPatternCount, 0, len(countOrder))
+	for _, k := range countOrder {
+		countRows = append(countRows, *buckets[k])
+	}
+
+	newer := "EXCLUDED.last_seen >= log_patterns.last_seen"
+	return m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "project_id"}, {Name: "pattern_id"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"template":   gorm.Expr("EXCLUDED.template"),
+				"count":      gorm.Expr("log_patterns.count + EXCLUDED.count"),
+				"first_seen": gorm.Expr("CASE WHEN EXCLUDED.first_seen < log_patterns.first_seen THEN EXCLUDED.first_seen ELSE log_patterns.first_seen END"),
+				"last_seen":  gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.last_seen ELSE log_patterns.last_seen END"),
+				"level":      gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.level ELSE log_patterns.level END"),
+			}),
+		}).CreateInBatches(&upserts, 200).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "project_id"}, {Name: "pattern_id"}, {Name: "bucket"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"count": gorm.Expr("log_pattern_counts.count + EXCLUDED.count"),
+			}),
+		}).CreateInBatches(&countRows, 500).Error
+	})
+}
+
+// Summary is a pattern with the number of its logs in a time range. For
+// spikes, Expected is the number its baseline rate predicts and Ratio is
+// Matches over Expected.
+type Summary struct {
+	model.LogPattern
+	Matches  int64   `json:"matches"`
+	Expected float64 `json:"expected,omitempty"`
+	Ratio    float64 `json:"ratio,omitempty"`
+}
+
+type patternCount struct {
+	PatternID string
+	Total     int64
+}
+
+// counts sums the pattern counts of the buckets in [from, to); with ids, of
+// those patterns only.
+func counts(ctx context.Context, db *gorm.DB, projectID int, from, to time.Time, ids []string, limit int) ([]patternCount, error) {
+	q := db.WithContext(ctx).Model(&model.LogPatternCount{}).
+		Select("pattern_id, SUM(count) AS total").
+		Where("project_id = ? AND bucket >= ? AND bucket < ?", projectID, Bucket(from), to.UTC()).
+		Group("pattern_id")
+	if ids != nil {
+		q = q.Where("pattern_id IN ?", ids)
+	}
+	if limit > 0 {
+		q = q.Order("total DESC").Limit(limit)
+	}
+	var out []patternCount
+	if err := q.Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func loadPatterns(ctx context.Context, db *gorm.DB, projectID int, ids []string) (map[string]model.LogPattern, error) {
+	out := map[string]model.LogPattern{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var rows []model.LogPattern
+	if err := db.WithContext(ctx).Where("project_id = ? AND pattern_id IN ?", projectID, ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.PatternID] = r
+	}
+	return out, nil
+}
+
+// Top returns the limit patterns with the most logs in [from, to).
+func Top(ctx context.Context, db *gorm.DB, projectID int, from, to time.Time, limit int) ([]Summary, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	top, err := counts(ctx, db, projectID, from, to, nil, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(top))
+	for _, c := range top {
+		ids = append(ids, c.PatternID)
+	}
+	byID, err := loadPatterns(ctx, db, projectID, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Summary, 0, len(top))
+	for _, c := range top {
+		if p, ok := byID[c.PatternID]; ok {
+			out = append(out, Summary{LogPattern: p, Matches: c.Total})
+		}
+	}
+	return out, nil
+}
+
+// New returns the patterns first seen in [from, to), newest first.
+func New(ctx context.Context, db *gorm.DB, projectID int, from, to time.Time, limit int) ([]Summary, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.LogPattern
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND first_seen >= ? AND first_seen < ?", projectID, from.UTC(), to.UTC()).
+		Order("first_seen DESC").
+		Limit(limit).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.PatternID)
+	}
+	cur, err := counts(ctx, db, projectID, from, to, ids, 0)
+	if err != nil {
+		return nil, err
+	}
+	matches := map[string]int64{}
+	for _, c := range cur {
+		matches[c.PatternID] = c.Total
+	}
+	out := make([]Summary, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, Summary{LogPattern: r, Matches: matches[r.PatternID]})
+	}
+	return out, nil
+}
+
+// SpikeOptions tune Spikes.
+type SpikeOptions struct {
+	// Baseline is how far before from the normal rate is measured.
+	Baseline time.Duration
+	// MinMatches ignores patterns with fewer logs in the range.
+	MinMatches int64
+	// MinRatio is how many times the expected number of logs a pattern must
+	// have; expectations under one log count as one.
+	MinRatio float64
+	Limit    int
+}
+
+// Spikes returns the patterns whose number of logs in [from, to) is at least
+// opts.MinRatio times what their rate over the baseline before from
+// predicts, the largest ratios first. Patterns new in the range have no
+// baseline and are compared against one log.
+func Spikes(ctx context.Context, db *gorm.DB, projectID int, from, to time.Time, opts SpikeOptions) ([]Summary, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	if opts.Baseline <= 0 {
+		return nil, errors.New("pattern: baseline must be positive")
+	}
+	cur, err := counts(ctx, db, projectID, from, to, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, c := range cur {
+		if c.Total >= opts.MinMatches {
+			ids = append(ids, c.PatternID)
+		}
+	}
+	if len(ids) == 0 {
+		return []Summary{}, nil
+	}
+	base, err := counts(ctx, db, projectID, from.Add(-opts.Baseline), from, ids, 0)
+	if err != nil {
+		return nil, err
+	}
+	baseline := map[string]int64{}
+	for _, c := range base {
+		baseline[c.PatternID] = c.Total
+	}
+
+	scale := float64(to.Sub(from)) / float64(opts.Baseline)
+	var spikes []Summary
+	for _, c := range cur {
+		if c.Total < opts.MinMatches {
+			continue
+		}
+		expected := float64(baseline[c.PatternID]) * scale
+		ratio := float64(c.Total) / max(expected, 1)
+		if ratio >= opts.MinRatio {
+			spikes = append(spikes, Summary{LogPattern: model.LogPattern{PatternID: c.PatternID}, Matches: c.Total, Expected: expected, Ratio: ratio})
+		}
+	}
+	sort.Slice(spikes, func(i, j int) bool {
+		if spikes[i].Ratio != spikes[j].Ratio {
+			return spikes[i].Ratio > spikes[j].Ratio
+		}
+		return spikes[i].Matches > spikes[j].Matches
+	})
+	if opts.Limit > 0 && len(spikes) > opts.Limit {
+		spikes = spikes[:opts.Limit]
+	}
+
+	ids = ids[:0]
+	for _, s := range spikes {
+		ids = append(ids, s.PatternID)
+	}
+	byID, err := loadPatterns(ctx, db, projectID, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Summary, 0, len(spikes))
+	for _, s := range spikes {
+		if p, ok := byID[s.PatternID]; ok {
+			s.LogPattern = p
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// Get returns a stored pattern.
+func Get(ctx context.Context, db *gorm.DB, projectID int, patternID string) (model.LogPattern, bool, error) {
+	if db == nil {
+		return model.LogPattern{}, false, gorm.ErrInvalidDB
+	}
+	var row model.LogPattern
+	if err := db.WithContext(ctx).Where("project_id = ? AND pattern_id = ?", projectID, patternID).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.LogPattern{}, false, nil
+		}
+		return model.LogPattern{}, false, err
+	}
+	return row, true, nil
+}
+
+// Series returns a pattern's counts with from <= bucket < to, oldest first;
+// buckets without logs are left out.
+func Series(ctx context.Context, db *gorm.DB, projectID int, patternID string, from, to time.Time) ([]model.LogPatternCount, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.LogPatternCount
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND pattern_id = ? AND bucket >= ? AND bucket < ?", projectID, patternID, Bucket(from), to.UTC()).
+		Order("bucket ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
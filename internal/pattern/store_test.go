@@ -0,0 +1,95 @@
+package pattern_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/pattern"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	ctx := context.Background()
+	m := pattern.NewMiner(db)
+
+	now := pattern.Bucket(time.Now()).Add(-time.Hour)
+	var rows []model.Log
+	add := func(at time.Time, n int, format string) {
+		for i := 0; i < n; i++ {
+			rows = append(rows, model.Log{ProjectID: 1, Timestamp: at, Level: "info", Message: fmt.Sprintf(format, i)})
+		}
+	}
+	// A steady pattern over the day, one that spikes in the last hour and
+	// one new in it.
+	for h := 24; h >= 1; h-- {
+		add(now.Add(-time.Duration(h)*time.Hour), 10, "request %d served")
+		add(now.Add(-time.Duration(h)*time.Hour), 1, "cache miss for key %d")
+	}
+	add(now.Add(10*time.Minute), 10, "request %d served")
+	add(now.Add(20*time.Minute), 30, "cache miss for key %d")
+	add(now.Add(30*time.Minute), 15, "payment %d declined")
+
+	m.Assign(ctx, rows)
+	if err := m.Record(ctx, rows[:len(rows)/2]); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := m.Record(ctx, rows[len(rows)/2:]); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	served, miss, payment := rows[0].PatternID, rows[10].PatternID, rows[len(rows)-1].PatternID
+
+	p, ok, err := pattern.Get(ctx, db, 1, served)
+	if err != nil || !ok {
+		t.Fatalf("Get: ok=%v err=%v", ok, err)
+	}
+	if p.Template != "request <*> served" || p.Count != 250 || p.Sample != "request 0 served" {
+		t.Fatalf("pattern = %+v", p)
+	}
+
+	from, to := now, now.Add(time.Hour)
+	top, err := pattern.Top(ctx, db, 1, from, to, 2)
+	if err != nil {
+		t.Fatalf("Top: %v", err)
+	}
+	if len(top) != 2 || top[0].PatternID != miss || top[0].Matches != 30 || top[1].PatternID != payment {
+		t.Fatalf("top = %+v", top)
+	}
+
+	fresh, err := pattern.New(ctx, db, 1, from, to, 10)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if len(fresh) != 1 || fresh[0].PatternID != payment || fresh[0].Matches != 15 {
+		t.Fatalf("new = %+v", fresh)
+	}
+
+	spikes, err := pattern.Spikes(ctx, db, 1, from, to, pattern.SpikeOptions{Baseline: 24 * time.Hour, MinMatches: 10, MinRatio: 3})
+	if err != nil {
+		t.Fatalf("Spikes: %v", err)
+	}
+	if len(spikes) != 2 || spikes[0].PatternID != miss || spikes[1].PatternID != payment {
+		t.Fatalf("spikes = %+v", spikes)
+	}
+	if spikes[0].Expected != 1 || spikes[0].Ratio != 30 {
+		t.Fatalf("miss spike: expected=%v ratio=%v", spikes[0].Expected, spikes[0].Ratio)
+	}
+
+	series, err := pattern.Series(ctx, db, 1, miss, from.Add(-2*time.Hour), to)
+	if err != nil {
+		t.Fatalf("Series: %v", err)
+	}
+	if len(series) != 3 || series[2].Count != 30 {
+		t.Fatalf("series = %+v", series)
+	}
+
+	// A new miner starts from the stored patterns.
+	rows = []model.Log{{ProjectID: 1, Timestamp: to, Message: "payment 99 declined"}}
+	pattern.NewMiner(db).Assign(ctx, rows)
+	if rows[0].PatternID != payment {
+		t.Fatalf("reloaded id = %q, want %q", rows[0].PatternID, payment)
+	}
+}
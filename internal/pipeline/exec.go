@@ -0,0 +1,768 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/logmetric"
+	"github.com/aak1247/logtap/internal/search"
+	searchpostgres "github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTimeout bounds a query; on Postgres it is also the statement
+	// timeout.
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxGroups bounds the rows an aggregation may produce.
+	DefaultMaxGroups = 10000
+	// TimeColumn is the bucket column of timechart.
+	TimeColumn = "_time"
+
+	// maxPercentileValues bounds the values read to compute percentiles on
+	// SQLite, which has no percentile function.
+	maxPercentileValues = 1_000_000
+)
+
+// ErrTimeout is returned when a query runs out of time.
+var ErrTimeout = errors.New("pipeline: query timed out")
+
+// Result is the table a query produces. Values are strings, numbers and
+// times; the fields column of whole logs is the decoded object.
+type Result struct {
+	Columns []string         `json:"columns"`
+	Rows    []map[string]any `json:"rows"`
+	// Groups are the columns the aggregation grouped by, TimeColumn first
+	// for timechart; the other columns are its values.
+	Groups      []string `json:"groups,omitempty"`
+	IntervalSec int64    `json:"interval_sec,omitempty"`
+}
+
+// logColumns are the columns of a whole log, in output order.
+var logColumns = []string{"id", "timestamp", "level", "message", "trace_id", "span_id", "pattern_id", "fields"}
+
+func isLogColumn(name string) bool {
+	for _, c := range logColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Executor runs queries on the logs table within limits.
+type Executor struct {
+	DB      *gorm.DB
+	Timeout time.Duration
+	// MaxGroups bounds the rows an aggregation may produce; producing more
+	// is an error, unless a head right after it keeps fewer.
+	MaxGroups int
+}
+
+func NewExecutor(db *gorm.DB) *Executor {
+	return &Executor{DB: db, Timeout: DefaultTimeout, MaxGroups: DefaultMaxGroups}
+}
+
+// Run runs q over the logs of projectID with start <= timestamp < end.
+// Errors of queries that cannot run as written wrap search.ErrInvalidQuery.
+func (e *Executor) Run(ctx context.Context, projectID int, start, end time.Time, q *Query) (*Result, error) {
+	if e == nil || e.DB == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	if q == nil {
+		q = &Query{}
+	}
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxGroups := e.MaxGroups
+	if maxGroups <= 0 {
+		maxGroups = DefaultMaxGroups
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var out *Result
+	started := time.Now()
+	err := e.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if strings.EqualFold(tx.Dialector.Name(), "postgres") {
+			if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())).Error; err != nil {
+				return err
+			}
+		}
+		a, err := searchpostgres.NewAdapter(tx).ForProject(ctx, projectID)
+		if err != nil {
+			return err
+		}
+		r := &run{
+			tx:        tx,
+			a:         a,
+			sqlite:    strings.EqualFold(tx.Dialector.Name(), "sqlite"),
+			maxGroups: maxGroups,
+			projectID: projectID,
+			start:     start.UTC(),
+			end:       end.UTC(),
+		}
+		out, err = r.exec(q)
+		return err
+	})
+	// Slow filters feed the index advisor like slow searches do.
+	searchpostgres.NewAdapter(e.DB).RecordSlow(ctx, projectID, q.Search, time.Since(started))
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w after %s", ErrTimeout, timeout)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// run is the state of one query. Until the aggregation, rel is a query on
+// logs-shaped rows with a pending order and limit; stages that must see the
+// limited rows wrap it into a subquery.
+type run struct {
+	tx        *gorm.DB
+	a         *searchpostgres.PostgresAdapter
+	sqlite    bool
+	maxGroups int
+	projectID int
+	start     time.Time
+	end       time.Time
+
+	rel     *gorm.DB
+	order   []string
+	limit   int
+	columns []string // the output columns; nil for logColumns
+}
+
+func (r *run) exec(q *Query) (*Result, error) {
+	rel, err := r.a.Where(r.tx.Table("logs").
+		Where("project_id = ? AND timestamp >= ? AND timestamp < ?", r.projectID, r.start, r.end), q.Search)
+	if err != nil {
+		return nil, err
+	}
+	r.rel = rel
+	for i, s := range q.Stages {
+		switch s := s.(type) {
+		case Where:
+			if r.limit > 0 {
+				r.wrap()
+			}
+			if r.rel, err = r.a.Where(r.rel, s.Query); err != nil {
+				return nil, err
+			}
+		case Sort:
+			if r.limit > 0 {
+				r.wrap()
+			}
+			if r.order, err = r.sortExprs(s.Keys); err != nil {
+				return nil, err
+			}
+		case Head:
+			if r.limit == 0 || s.N < r.limit {
+				r.limit = s.N
+			}
+		case Fields:
+			r.columns = project(r.columns, s)
+		default:
+			if r.limit > 0 {
+				r.wrap()
+			}
+			res, rest, err := r.aggregate(s, q.Stages[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			return after(res, rest)
+		}
+	}
+	return r.logs()
+}
+
+// wrap turns the pending order and limit into a subquery.
+func (r *run) wrap() {
+	sub := r.rel.Select("*")
+	if len(r.order) > 0 {
+		sub = sub.Order(strings.Join(r.order, ", "))
+	}
+	r.rel = r.tx.Table("(?) AS logs", sub.Limit(r.limit))
+	r.order, r.limit = nil, 0
+}
+
+func (r *run) sortExprs(keys []SortKey) ([]string, error) {
+	var out []string
+	for _, k := range keys {
+		f, err := r.a.LogField(k.Field)
+		if err != nil {
+			return nil, err
+		}
+		dir := " ASC"
+		if k.Desc {
+			dir = " DESC"
+		}
+		if f.Time {
+			out = append(out, "timestamp"+dir)
+			continue
+		}
+		// Numbers in numeric order first, then the rest as text.
+		out = append(out, f.Number+dir+" NULLS LAST", f.Text+dir+" NULLS LAST")
+	}
+	return out, nil
+}
+
+func project(columns []string, f Fields) []string {
+	if !f.Drop {
+		return f.Names
+	}
+	if columns == nil {
+		columns = logColumns
+	}
+	var out []string
+	for _, c := range columns {
+		drop := false
+		for _, n := range f.Names {
+			drop = drop || n == c
+		}
+		if !drop {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// logs reads the rows of a query without an aggregation.
+func (r *run) logs() (*Result, error) {
+	columns := r.columns
+	if columns == nil {
+		columns = logColumns
+	}
+	sel := []string{r.a.LogColumns()}
+	aliases := map[string]string{}
+	times := map[string]bool{"timestamp": true}
+	for i, name := range columns {
+		if isLogColumn(name) {
+			continue
+		}
+		f, err := r.a.LogField(name)
+		if err != nil {
+			return nil, err
+		}
+		alias := fmt.Sprintf("p%d", i)
+		aliases[name] = alias
+		times[alias] = f.Time
+		sel = append(sel, f.Text+" AS "+alias)
+	}
+	order := "timestamp DESC, id DESC"
+	if len(r.order) > 0 {
+		order = strings.Join(r.order, ", ")
+	}
+	limit := r.limit
+	if limit == 0 {
+		limit = DefaultRows
+	}
+	rows, err := scan(r.rel.Select(strings.Join(sel, ", ")).Order(order).Limit(limit), times)
+	if err != nil {
+		return nil, err
+	}
+	out := &Result{Columns: columns, Rows: make([]map[string]any, 0, len(rows))}
+	for _, row := range rows {
+		m := make(map[string]any, len(columns))
+		for _, name := range columns {
+			switch {
+			case name == "fields":
+				fields := map[string]any{}
+				if s, ok := row["fields"].(string); ok {
+					_ = json.Unmarshal([]byte(s), &fields)
+				}
+				m[name] = fields
+			case isLogColumn(name):
+				m[name] = row[name]
+			default:
+				m[name] = row[aliases[name]]
+			}
+		}
+		out.Rows = append(out.Rows, m)
+	}
+	return out, nil
+}
+
+// column is an output column of an aggregation.
+type column struct {
+	name  string
+	alias string
+	expr  string
+	time  bool
+	// pct is the percentile of the number expression value computed in
+	// memory, on SQLite.
+	pct   float64
+	value string
+}
+
+func (r *run) aggregate(s Stage, rest []Stage) (*Result, []Stage, error) {
+	var groups []column
+	var aggs []Agg
+	var span time.Duration
+	addGroup := func(name string) error {
+		f, err := r.a.LogField(name)
+		if err != nil {
+			return err
+		}
+		if f.Time {
+			return fmt.Errorf("%w: %s: cannot group by %s, use timechart", search.ErrInvalidQuery, s.Name(), name)
+		}
+		groups = append(groups, column{name: name, alias: fmt.Sprintf("g%d", len(groups)), expr: f.Text})
+		return nil
+	}
+	switch s := s.(type) {
+	case Stats:
+		aggs = s.Aggs
+		for _, b := range s.By {
+			if err := addGroup(b); err != nil {
+				return nil, nil, err
+			}
+		}
+	case Timechart:
+		aggs = s.Aggs
+		span = s.Span
+		if span <= 0 {
+			span = search.HistogramInterval(r.end.Sub(r.start))
+		}
+		if n := r.end.Sub(r.start) / span; n >= search.MaxHistogramBuckets {
+			return nil, nil, fmt.Errorf("%w: timechart: span %s gives more than %d buckets", search.ErrInvalidQuery, span, search.MaxHistogramBuckets)
+		}
+		groups = append(groups, column{name: TimeColumn, alias: "g0", expr: r.a.TimeBucket(int64(span / time.Second)), time: true})
+		if s.By != "" {
+			if err := addGroup(s.By); err != nil {
+				return nil, nil, err
+			}
+		}
+	case Top:
+		aggs = []Agg{{Func: "count", As: "count"}}
+		for _, f := range s.Fields {
+			if err := addGroup(f); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	res := &Result{IntervalSec: int64(span / time.Second)}
+	var values []column
+	for _, g := range groups {
+		res.Groups = append(res.Groups, g.name)
+		res.Columns = append(res.Columns, g.name)
+	}
+	for i, a := range aggs {
+		c, err := r.aggColumn(a, fmt.Sprintf("a%d", i))
+		if err != nil {
+			return nil, nil, err
+		}
+		if res.hasColumn(c.name) {
+			return nil, nil, fmt.Errorf("%w: %s: duplicate column %q", search.ErrInvalidQuery, s.Name(), c.name)
+		}
+		values = append(values, c)
+		res.Columns = append(res.Columns, c.name)
+	}
+
+	// Rows missing a group field are left out, as they have no group.
+	rel := r.rel
+	for _, g := range groups {
+		if !g.time {
+			rel = rel.Where(g.expr + " IS NOT NULL")
+		}
+	}
+	// Each statement below starts from rel.
+	rel = rel.Session(&gorm.Session{})
+	var sel, groupBy []string
+	for _, c := range append(append([]column{}, groups...), values...) {
+		if c.pct > 0 {
+			continue
+		}
+		sel = append(sel, c.expr+" AS "+c.alias)
+	}
+	for _, g := range groups {
+		groupBy = append(groupBy, g.alias)
+	}
+
+	// The order, and the limit that bounds the groups.
+	var order []string
+	limit := 0
+	top, isTop := s.(Top)
+	switch {
+	case isTop:
+		dir := " DESC"
+		if top.Rare {
+			dir = " ASC"
+		}
+		order = append(order, values[0].alias+dir)
+		for _, g := range groups {
+			order = append(order, g.alias+" ASC")
+		}
+		limit = top.Limit
+	case !r.sqlite || !hasPercentiles(values):
+		// Push the sort and head right after the aggregation down.
+		n := 0
+	push:
+		for ; n < len(rest); n++ {
+			switch st := rest[n].(type) {
+			case Sort:
+				if limit > 0 {
+					break push
+				}
+				order = order[:0]
+				for _, k := range st.Keys {
+					c, ok := findColumn(groups, values, k.Field)
+					if !ok {
+						return nil, nil, fmt.Errorf("%w: sort: unknown column %q", search.ErrInvalidQuery, k.Field)
+					}
+					dir := " ASC NULLS LAST"
+					if k.Desc {
+						dir = " DESC NULLS LAST"
+					}
+					order = append(order, c.alias+dir)
+				}
+			case Head:
+				if limit == 0 || st.N < limit {
+					limit = st.N
+				}
+			default:
+				break push
+			}
+		}
+		rest = rest[n:]
+	}
+	if len(order) == 0 {
+		for _, g := range groups {
+			order = append(order, g.alias+" ASC")
+		}
+	}
+	bounded := limit > 0 && limit <= r.maxGroups
+	if !bounded {
+		limit = r.maxGroups + 1
+	}
+
+	q := rel.Select(strings.Join(sel, ", "))
+	if len(groupBy) > 0 {
+		q = q.Group(strings.Join(groupBy, ", "))
+	}
+	if len(order) > 0 {
+		q = q.Order(strings.Join(order, ", "))
+	}
+	times := map[string]bool{}
+	for _, c := range append(append([]column{}, groups...), values...) {
+		times[c.alias] = c.time
+	}
+	rows, err := scan(q.Limit(limit), times)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bounded && len(rows) > r.maxGroups {
+		return nil, nil, fmt.Errorf("%w: %s: more than %d groups; narrow the query or add a head after it", search.ErrInvalidQuery, s.Name(), r.maxGroups)
+	}
+	if err := r.percentiles(rel, groups, values, rows); err != nil {
+		return nil, nil, err
+	}
+
+	for _, row := range rows {
+		m := make(map[string]any, len(res.Columns))
+		for _, c := range append(append([]column{}, groups...), values...) {
+			m[c.name] = row[c.alias]
+		}
+		res.Rows = append(res.Rows, m)
+	}
+	if ts, ok := s.(Timechart); ok && ts.By == "" {
+		res.Rows = r.fill(res.Rows, span, aggs)
+	}
+	if isTop {
+		if err := r.percent(rel, res); err != nil {
+			return nil, nil, err
+		}
+	}
+	if res.Rows == nil {
+		res.Rows = []map[string]any{}
+	}
+	return res, rest, nil
+}
+
+func (res *Result) hasColumn(name string) bool {
+	for _, c := range res.Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func findColumn(groups, values []column, name string) (column, bool) {
+	for _, c := range append(append([]column{}, groups...), values...) {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+func hasPercentiles(values []column) bool {
+	for _, c := range values {
+		if c.pct > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *run) aggColumn(a Agg, alias string) (column, error) {
+	c := column{name: a.As, alias: alias}
+	if a.Field == "" {
+		c.expr = "COUNT(*)"
+		return c, nil
+	}
+	f, err := r.a.LogField(a.Field)
+	if err != nil {
+		return c, err
+	}
+	switch a.Func {
+	case "count":
+		c.expr = "COUNT(" + f.Text + ")"
+	case "dc":
+		c.expr = "COUNT(DISTINCT " + f.Text + ")"
+	case "min", "max":
+		c.expr = strings.ToUpper(a.Func) + "(" + f.Number + ")"
+		c.time = f.Time
+	case "sum", "avg":
+		if f.Time {
+			return c, fmt.Errorf("%w: cannot %s %s", search.ErrInvalidQuery, a.Func, a.Field)
+		}
+		c.expr = strings.ToUpper(a.Func) + "(" + f.Number + ")"
+	default:
+		p, _ := a.percentile()
+		if f.Time {
+			return c, fmt.Errorf("%w: cannot %s %s", search.ErrInvalidQuery, a.Func, a.Field)
+		}
+		if r.sqlite {
+			c.pct, c.value = p, f.Number
+			return c, nil
+		}
+		c.expr = fmt.Sprintf("percentile_cont(%g) WITHIN GROUP (ORDER BY %s)", p/100, f.Number)
+	}
+	return c, nil
+}
+
+// percentiles computes the percentile columns of rows in memory.
+func (r *run) percentiles(rel *gorm.DB, groups, values []column, rows []map[string]any) error {
+	for _, c := range values {
+		if c.pct <= 0 {
+			continue
+		}
+		sel := make([]string, 0, len(groups)+1)
+		for _, g := range groups {
+			sel = append(sel, g.expr+" AS "+g.alias)
+		}
+		sel = append(sel, c.value+" AS v")
+		found, err := scan(rel.
+			Select(strings.Join(sel, ", ")).
+			Where(c.value+" IS NOT NULL").
+			Limit(maxPercentileValues+1), nil)
+		if err != nil {
+			return err
+		}
+		if len(found) > maxPercentileValues {
+			return fmt.Errorf("%w: %s reads more than %d values on SQLite; narrow the query", search.ErrInvalidQuery, c.name, maxPercentileValues)
+		}
+		byGroup := map[string][]float64{}
+		for _, f := range found {
+			if v, ok := number(f["v"]); ok {
+				k := groupKey(groups, f)
+				byGroup[k] = append(byGroup[k], v)
+			}
+		}
+		for _, row := range rows {
+			if vs := byGroup[groupKey(groups, row)]; len(vs) > 0 {
+				row[c.alias] = logmetric.Percentile(vs, c.pct)
+			} else {
+				row[c.alias] = nil
+			}
+		}
+	}
+	return nil
+}
+
+func groupKey(groups []column, row map[string]any) string {
+	var b strings.Builder
+	for _, g := range groups {
+		b.WriteString(text(row[g.alias]))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// fill adds the empty buckets of an ungrouped timechart; counts are zero
+// there and other values null.
+func (r *run) fill(rows []map[string]any, span time.Duration, aggs []Agg) []map[string]any {
+	byTime := map[int64]map[string]any{}
+	for _, row := range rows {
+		if t, ok := row[TimeColumn].(time.Time); ok {
+			byTime[t.Unix()] = row
+		}
+	}
+	sec := int64(span / time.Second)
+	first := r.start.Unix() / sec * sec
+	var out []map[string]any
+	for b := first; b < r.end.Unix(); b += sec {
+		if row, ok := byTime[b]; ok {
+			out = append(out, row)
+			continue
+		}
+		row := map[string]any{TimeColumn: time.Unix(b, 0).UTC()}
+		for _, a := range aggs {
+			row[a.As] = nil
+			if a.Func == "count" || a.Func == "dc" {
+				row[a.As] = int64(0)
+			}
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+// percent adds the share of the counted rows to top and rare.
+func (r *run) percent(rel *gorm.DB, res *Result) error {
+	var total int64
+	if err := rel.Count(&total).Error; err != nil {
+		return err
+	}
+	res.Columns = append(res.Columns, "percent")
+	for _, row := range res.Rows {
+		n, _ := number(row["count"])
+		pct := 0.0
+		if total > 0 {
+			pct = n * 100 / float64(total)
+		}
+		row["percent"] = pct
+	}
+	return nil
+}
+
+// after runs the stages after the aggregation on its rows.
+func after(res *Result, rest []Stage) (*Result, error) {
+	now := time.Now().UTC()
+	for _, s := range rest {
+		switch s := s.(type) {
+		case Where:
+			m, err := search.NewMatcher(s.Query, now)
+			if err != nil {
+				return nil, err
+			}
+			kept := res.Rows[:0]
+			for _, row := range res.Rows {
+				if m.Match(rowDoc(row)) {
+					kept = append(kept, row)
+				}
+			}
+			res.Rows = kept
+		case Sort:
+			for _, k := range s.Keys {
+				if !res.hasColumn(k.Field) {
+					return nil, fmt.Errorf("%w: sort: unknown column %q", search.ErrInvalidQuery, k.Field)
+				}
+			}
+			sort.SliceStable(res.Rows, func(i, j int) bool {
+				for _, k := range s.Keys {
+					c := compare(res.Rows[i][k.Field], res.Rows[j][k.Field])
+					if c == 0 {
+						continue
+					}
+					if k.Desc {
+						// Nulls stay last either way.
+						if res.Rows[i][k.Field] == nil || res.Rows[j][k.Field] == nil {
+							return c < 0
+						}
+						return c > 0
+					}
+					return c < 0
+				}
+				return false
+			})
+		case Head:
+			if len(res.Rows) > s.N {
+				res.Rows = res.Rows[:s.N]
+			}
+		case Fields:
+			res.Columns = project(res.Columns, s)
+			keep := map[string]bool{}
+			for _, c := range res.Columns {
+				keep[c] = true
+			}
+			for _, row := range res.Rows {
+				for k := range row {
+					if !keep[k] {
+						delete(row, k)
+					}
+				}
+			}
+			var groups []string
+			for _, g := range res.Groups {
+				if keep[g] {
+					groups = append(groups, g)
+				}
+			}
+			res.Groups = groups
+		default:
+			return nil, fmt.Errorf("%w: only one of stats, timechart, top and rare per query", search.ErrInvalidQuery)
+		}
+	}
+	return res, nil
+}
+
+// rowDoc lets where match result rows; free text searches the message
+// column.
+type rowDoc map[string]any
+
+func (d rowDoc) Text() string { return text(d["message"]) }
+
+func (d rowDoc) Field(name string) (any, bool) {
+	v, ok := d[name]
+	if !ok || v == nil {
+		return nil, false
+	}
+	if f, isNum := number(v); isNum {
+		if _, isText := v.(string); !isText {
+			return f, true
+		}
+	}
+	return v, true
+}
+
+// compare orders values: nulls last, numbers by value, times by time and
+// the rest as text.
+func compare(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(text(a), text(b))
+}
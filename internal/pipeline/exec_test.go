@@ -0,0 +1,165 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/detector"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/pipeline"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/datatypes"
+)
+
+func TestExecutor_Run(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	ctx := context.Background()
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.Add(-time.Hour)
+
+	var rows []model.Log
+	for i := 0; i < 20; i++ {
+		svc, level := "api", "info"
+		if i%4 == 0 {
+			svc, level = "worker", "error"
+		}
+		rows = append(rows, model.Log{
+			ProjectID: 1,
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Level:     level,
+			Message:   fmt.Sprintf("request %d", i),
+			Fields:    datatypes.JSON(fmt.Sprintf(`{"service":%q,"latency_ms":%d}`, svc, (i+1)*10)),
+		})
+	}
+	rows = append(rows, model.Log{ProjectID: 2, Timestamp: start, Level: "error", Message: "other project", Fields: datatypes.JSON(`{}`)})
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	e := pipeline.NewExecutor(db)
+	run := func(raw string) *pipeline.Result {
+		t.Helper()
+		q, err := pipeline.Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", raw, err)
+		}
+		res, err := e.Run(ctx, 1, start, end, q)
+		if err != nil {
+			t.Fatalf("Run(%q): %v", raw, err)
+		}
+		return res
+	}
+	num := func(v any) float64 {
+		switch n := v.(type) {
+		case int64:
+			return float64(n)
+		case float64:
+			return n
+		}
+		t.Fatalf("not a number: %#v", v)
+		return 0
+	}
+
+	res := run("| stats count() as n, avg(fields.latency_ms) as avg, p50(latency_ms) by fields.service | sort -n")
+	if len(res.Rows) != 2 || res.Rows[0]["fields.service"] != "api" || num(res.Rows[0]["n"]) != 15 {
+		t.Fatalf("stats = %+v", res.Rows)
+	}
+	// worker: 10, 50, 90, 130, 170.
+	if w := res.Rows[1]; num(w["n"]) != 5 || num(w["avg"]) != 90 || num(w["p50(latency_ms)"]) != 90 {
+		t.Fatalf("worker = %+v", w)
+	}
+	if fmt.Sprint(res.Groups) != "[fields.service]" {
+		t.Fatalf("groups = %v", res.Groups)
+	}
+
+	res = run("level:error | stats count() as n")
+	if len(res.Rows) != 1 || num(res.Rows[0]["n"]) != 5 {
+		t.Fatalf("filtered stats = %+v", res.Rows)
+	}
+
+	// Stages after the aggregation run on its rows.
+	res = run("| stats count() as n by level | where n:>10 | fields level")
+	if len(res.Rows) != 1 || res.Rows[0]["level"] != "info" || len(res.Rows[0]) != 1 {
+		t.Fatalf("where after stats = %+v", res.Rows)
+	}
+
+	res = run("| top 1 service")
+	if len(res.Rows) != 1 || res.Rows[0]["service"] != "api" || num(res.Rows[0]["count"]) != 15 || num(res.Rows[0]["percent"]) != 75 {
+		t.Fatalf("top = %+v", res.Rows)
+	}
+	res = run("| rare service")
+	if len(res.Rows) != 2 || res.Rows[0]["service"] != "worker" {
+		t.Fatalf("rare = %+v", res.Rows)
+	}
+
+	res = run("| timechart span=15m count() as n")
+	if len(res.Rows) != 4 || res.IntervalSec != 900 {
+		t.Fatalf("timechart = %+v", res.Rows)
+	}
+	for i, row := range res.Rows {
+		if ts, ok := row[pipeline.TimeColumn].(time.Time); !ok || !ts.Equal(start.Add(time.Duration(i)*15*time.Minute)) {
+			t.Fatalf("bucket %d = %+v", i, row)
+		}
+	}
+	if num(res.Rows[0]["n"]) != 15 || num(res.Rows[1]["n"]) != 5 || num(res.Rows[2]["n"]) != 0 {
+		t.Fatalf("timechart counts = %+v", res.Rows)
+	}
+
+	// Without an aggregation the logs themselves come back; a head before
+	// a where limits what the where sees.
+	res = run("| sort -latency_ms | head 4 | where level:error | fields message, latency_ms")
+	if len(res.Rows) != 1 || res.Rows[0]["message"] != "request 16" || fmt.Sprint(res.Columns) != "[message latency_ms]" {
+		t.Fatalf("logs = %+v", res.Rows)
+	}
+	res = run("level:error")
+	if len(res.Rows) != 5 || res.Rows[0]["message"] != "request 16" {
+		t.Fatalf("default logs = %+v", res.Rows)
+	}
+	if ts, ok := res.Rows[0]["timestamp"].(time.Time); !ok || !ts.Equal(start.Add(16*time.Minute)) {
+		t.Fatalf("timestamp = %#v", res.Rows[0]["timestamp"])
+	}
+	if f, ok := res.Rows[0]["fields"].(map[string]any); !ok || f["service"] != "worker" {
+		t.Fatalf("fields = %#v", res.Rows[0]["fields"])
+	}
+
+	// Group limits.
+	small := &pipeline.Executor{DB: db, MaxGroups: 5}
+	q, _ := pipeline.Parse("| stats count() by message")
+	if _, err := small.Run(ctx, 1, start, end, q); !errors.Is(err, search.ErrInvalidQuery) {
+		t.Fatalf("too many groups: err = %v", err)
+	}
+	q, _ = pipeline.Parse("| stats count() as n by message | sort message | head 5")
+	if res, err := small.Run(ctx, 1, start, end, q); err != nil || len(res.Rows) != 5 || res.Rows[0]["message"] != "request 0" {
+		t.Fatalf("head after stats: %+v, %v", res, err)
+	}
+
+	// Fields are resolved like search fields.
+	q, _ = pipeline.Parse("| stats count() by fields..x")
+	if _, err := e.Run(ctx, 1, start, end, q); !errors.Is(err, search.ErrInvalidQuery) {
+		t.Fatalf("invalid field: err = %v", err)
+	}
+}
+
+func TestReader_QueryPoints(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	now := time.Now().UTC()
+	rows := []model.Log{
+		{ProjectID: 1, Timestamp: now.Add(-time.Minute), Level: "error", Message: "a", Fields: datatypes.JSON(`{"service":"api"}`)},
+		{ProjectID: 1, Timestamp: now.Add(-time.Minute), Level: "error", Message: "b", Fields: datatypes.JSON(`{"service":"api"}`)},
+		{ProjectID: 1, Timestamp: now.Add(-time.Minute), Level: "error", Message: "c", Fields: datatypes.JSON(`{"service":"web"}`)},
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	points, err := pipeline.NewReader(db).QueryPoints(context.Background(), 1, "level:error | stats count() as n by service", "", detector.TimeRange{Start: now.Add(-time.Hour), End: now})
+	if err != nil {
+		t.Fatalf("QueryPoints: %v", err)
+	}
+	if len(points) != 2 || points[0].Labels["service"] != "api" || points[0].Value != 2 || points[1].Value != 1 {
+		t.Fatalf("points = %+v", points)
+	}
+}
@@ -0,0 +1,533 @@
+// Package pipeline runs piped analytics queries over logs:
+//
+//	level:error | stats count() as n, p95(fields.latency_ms) by fields.service | sort -n | head 10
+//
+// The part before the first | is a search query (docs/SEARCH.md); each stage
+// after it transforms the rows of the one before. The stages up to the
+// aggregation (stats, timechart, top or rare, at most one), and the sort and
+// head right after it, compile to one SQL statement: field names only reach
+// it resolved by the search adapter, and values are bound parameters. The
+// stages after that run in memory on the at most MaxGroups aggregated rows.
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/search"
+)
+
+const (
+	// DefaultRows is how many logs a query without an aggregation returns
+	// unless a head says otherwise; MaxRows bounds head.
+	DefaultRows = 100
+	MaxRows     = 10000
+	// DefaultTop is how many values top and rare keep by default.
+	DefaultTop = 10
+
+	maxStages = 20
+	maxAggs   = 20
+	maxBy     = 5
+)
+
+// Query is a parsed query.
+type Query struct {
+	Search search.Node // nil matches every log
+	Stages []Stage
+}
+
+// Stage is a Where, Stats, Timechart, Top, Fields, Sort or Head.
+type Stage interface {
+	Name() string
+}
+
+// Where keeps the rows matching a search query.
+type Where struct{ Query search.Node }
+
+// Stats aggregates the rows, per combination of the By fields when there
+// are any.
+type Stats struct {
+	Aggs []Agg
+	By   []string
+}
+
+// Timechart aggregates the rows per Span of time (0 picks one from the time
+// range), and per value of By when set.
+type Timechart struct {
+	Span time.Duration
+	Aggs []Agg
+	By   string
+}
+
+// Top counts the rows per combination of Fields and keeps the Limit most
+// frequent, or the least frequent for rare.
+type Top struct {
+	Fields []string
+	Limit  int
+	Rare   bool
+}
+
+// Fields keeps only the named columns, or with Drop removes them.
+type Fields struct {
+	Names []string
+	Drop  bool
+}
+
+// Sort orders the rows by Keys.
+type Sort struct{ Keys []SortKey }
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Head keeps the first N rows.
+type Head struct{ N int }
+
+func (Where) Name() string     { return "where" }
+func (Stats) Name() string     { return "stats" }
+func (Timechart) Name() string { return "timechart" }
+func (t Top) Name() string {
+	if t.Rare {
+		return "rare"
+	}
+	return "top"
+}
+func (Fields) Name() string { return "fields" }
+func (Sort) Name() string   { return "sort" }
+func (Head) Name() string   { return "head" }
+
+// aggregation reports whether s groups rows.
+func aggregation(s Stage) bool {
+	switch s.(type) {
+	case Stats, Timechart, Top:
+		return true
+	}
+	return false
+}
+
+// Agg is an aggregate function of a field: count (Field "" counts rows),
+// dc (distinct values), sum, avg, min, max, or the percentiles p1 to p99.
+type Agg struct {
+	Func  string
+	Field string
+	As    string // the output column
+}
+
+// percentile returns the percentile a pNN function computes.
+func (a Agg) percentile() (float64, bool) {
+	if len(a.Func) < 2 || a.Func[0] != 'p' {
+		return 0, false
+	}
+	n, err := strconv.Atoi(a.Func[1:])
+	if err != nil || n < 1 || n > 99 {
+		return 0, false
+	}
+	return float64(n), true
+}
+
+// aggNames maps the accepted spellings of aggregate functions to Agg.Func.
+var aggNames = map[string]string{
+	"count": "count", "c": "count",
+	"dc": "dc", "distinct_count": "dc",
+	"sum": "sum", "avg": "avg", "mean": "avg",
+	"min": "min", "max": "max",
+	"median": "p50",
+}
+
+// Parse parses a query:
+//
+//	query     = search { "|" stage }
+//	stage     = "where" search
+//	          | "stats" aggs [ "by" fields ]
+//	          | "timechart" [ "span" "=" duration ] aggs [ "by" field ]
+//	          | ( "top" | "rare" ) [ [ "limit" "=" ] n ] fields
+//	          | "fields" [ "-" ] fields
+//	          | "sort" [ "-" | "+" ] field { [ "," ] [ "-" | "+" ] field }
+//	          | "head" [ n ]
+//	aggs      = agg [ "as" name ] { [ "," ] agg [ "as" name ] }
+//	agg       = func "(" [ field ] ")"
+//	fields    = field { [ "," ] field }
+//
+// A | inside double quotes or after \ does not start a stage. Errors wrap
+// search.ErrInvalidQuery.
+func Parse(raw string) (*Query, error) {
+	parts := splitStages(raw)
+	if len(parts)-1 > maxStages {
+		return nil, fmt.Errorf("%w: at most %d stages", search.ErrInvalidQuery, maxStages)
+	}
+	parsed, err := search.NewQueryParser().Parse(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{Search: parsed.Root}
+	aggregated := false
+	for i, part := range parts[1:] {
+		s, err := parseStage(part)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i+1, err)
+		}
+		if aggregation(s) {
+			if aggregated {
+				return nil, fmt.Errorf("%w: stage %d: only one of stats, timechart, top and rare per query", search.ErrInvalidQuery, i+1)
+			}
+			aggregated = true
+		}
+		q.Stages = append(q.Stages, s)
+	}
+	return q, nil
+}
+
+// splitStages splits raw on the | outside quotes and escapes.
+func splitStages(raw string) []string {
+	var out []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '|':
+			if !quoted {
+				out = append(out, raw[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, raw[start:])
+}
+
+func parseStage(part string) (Stage, error) {
+	part = strings.TrimSpace(part)
+	op, rest, _ := strings.Cut(part, " ")
+	rest = strings.TrimSpace(rest)
+	op = strings.ToLower(op)
+	if op == "" {
+		return nil, fmt.Errorf("%w: empty stage", search.ErrInvalidQuery)
+	}
+	if op == "where" {
+		parsed, err := search.NewQueryParser().Parse(rest)
+		if err != nil {
+			return nil, err
+		}
+		return Where{Query: parsed.Root}, nil
+	}
+
+	toks, err := lex(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", search.ErrInvalidQuery, op, err)
+	}
+	p := &stageParser{op: op, toks: toks}
+	var s Stage
+	switch op {
+	case "stats":
+		s, err = p.stats()
+	case "timechart":
+		s, err = p.timechart()
+	case "top", "rare":
+		s, err = p.top(op == "rare")
+	case "fields":
+		s, err = p.fields()
+	case "sort":
+		s, err = p.sort()
+	case "head":
+		s, err = p.head()
+	default:
+		return nil, fmt.Errorf("%w: unknown stage %q", search.ErrInvalidQuery, op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	return s, nil
+}
+
+// token is a word (a field, number or name, possibly quoted) or one of the
+// punctuation characters ( ) , = - +.
+type token struct {
+	text string
+	word bool
+}
+
+func lex(s string) ([]token, error) {
+	var out []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.IndexByte("(),=-+", c) >= 0:
+			out = append(out, token{text: s[i : i+1]})
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			out = append(out, token{text: s[i+1 : i+1+end], word: true})
+			i += end + 2
+		case isWordChar(c):
+			j := i
+			for j < len(s) && isWordChar(s[j]) {
+				j++
+			}
+			out = append(out, token{text: s[i:j], word: true})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", s[i:i+1])
+		}
+	}
+	return out, nil
+}
+
+// isWordChar reports whether c can be part of a word: the characters of
+// field names, so that words can hold durations and numbers too.
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '@' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+type stageParser struct {
+	op   string
+	toks []token
+	pos  int
+}
+
+func (p *stageParser) errorf(msg string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s", search.ErrInvalidQuery, p.op, fmt.Sprintf(msg, args...))
+}
+
+func (p *stageParser) done() bool { return p.pos >= len(p.toks) }
+
+// punct consumes the punctuation c when it is next.
+func (p *stageParser) punct(c string) bool {
+	if !p.done() && !p.toks[p.pos].word && p.toks[p.pos].text == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// keyword consumes the word kw, in any case, when it is next.
+func (p *stageParser) keyword(kw string) bool {
+	if !p.done() && p.toks[p.pos].word && strings.EqualFold(p.toks[p.pos].text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *stageParser) word(what string) (string, error) {
+	if p.done() || !p.toks[p.pos].word {
+		return "", p.errorf("expected %s", what)
+	}
+	p.pos++
+	return p.toks[p.pos-1].text, nil
+}
+
+// number consumes a positive integer when one is next.
+func (p *stageParser) number() (int, bool) {
+	if p.done() || !p.toks[p.pos].word {
+		return 0, false
+	}
+	n, err := strconv.Atoi(p.toks[p.pos].text)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	p.pos++
+	return n, true
+}
+
+// list parses fields separated by optional commas, up to the keyword stop.
+func (p *stageParser) list(stop string) ([]string, error) {
+	var out []string
+	for !p.done() {
+		if stop != "" && p.toks[p.pos].word && strings.EqualFold(p.toks[p.pos].text, stop) {
+			break
+		}
+		name, err := p.word("a field")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+		p.punct(",")
+	}
+	if len(out) == 0 {
+		return nil, p.errorf("expected a field")
+	}
+	return out, nil
+}
+
+func (p *stageParser) aggs() ([]Agg, error) {
+	var out []Agg
+	seen := map[string]bool{}
+	for !p.done() && !(p.toks[p.pos].word && strings.EqualFold(p.toks[p.pos].text, "by")) {
+		fn, err := p.word("an aggregate function")
+		if err != nil {
+			return nil, err
+		}
+		a := Agg{Func: strings.ToLower(fn)}
+		if name, ok := aggNames[a.Func]; ok {
+			a.Func = name
+		} else if _, ok := a.percentile(); !ok {
+			return nil, p.errorf("unknown function %q", fn)
+		}
+		if !p.punct("(") {
+			return nil, p.errorf("expected ( after %s", fn)
+		}
+		if !p.punct(")") {
+			if a.Field, err = p.word("a field"); err != nil {
+				return nil, err
+			}
+			if !p.punct(")") {
+				return nil, p.errorf("expected ) after %s(%s", fn, a.Field)
+			}
+		}
+		if a.Field == "" && a.Func != "count" {
+			return nil, p.errorf("%s needs a field", fn)
+		}
+		a.As = a.Func
+		if a.Field != "" {
+			a.As = a.Func + "(" + a.Field + ")"
+		}
+		if p.keyword("as") {
+			if a.As, err = p.word("a name after as"); err != nil {
+				return nil, err
+			}
+		}
+		if seen[a.As] {
+			return nil, p.errorf("duplicate column %q", a.As)
+		}
+		seen[a.As] = true
+		out = append(out, a)
+		p.punct(",")
+	}
+	if len(out) == 0 {
+		return nil, p.errorf("expected an aggregate function")
+	}
+	if len(out) > maxAggs {
+		return nil, p.errorf("at most %d aggregates", maxAggs)
+	}
+	return out, nil
+}
+
+func (p *stageParser) stats() (Stage, error) {
+	aggs, err := p.aggs()
+	if err != nil {
+		return nil, err
+	}
+	s := Stats{Aggs: aggs}
+	if p.keyword("by") {
+		if s.By, err = p.list(""); err != nil {
+			return nil, err
+		}
+		if len(s.By) > maxBy {
+			return nil, p.errorf("at most %d by fields", maxBy)
+		}
+	}
+	return s, nil
+}
+
+func (p *stageParser) timechart() (Stage, error) {
+	var s Timechart
+	if p.keyword("span") {
+		if !p.punct("=") {
+			return nil, p.errorf("expected span=<duration>")
+		}
+		raw, err := p.word("a duration")
+		if err != nil {
+			return nil, err
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second || d%time.Second != 0 {
+			return nil, p.errorf("span must be a whole number of seconds, like 30s or 5m")
+		}
+		s.Span = d
+	}
+	aggs, err := p.aggs()
+	if err != nil {
+		return nil, err
+	}
+	s.Aggs = aggs
+	if p.keyword("by") {
+		if s.By, err = p.word("a field"); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *stageParser) top(rare bool) (Stage, error) {
+	s := Top{Limit: DefaultTop, Rare: rare}
+	if p.keyword("limit") {
+		if !p.punct("=") {
+			return nil, p.errorf("expected limit=<n>")
+		}
+		n, ok := p.number()
+		if !ok {
+			return nil, p.errorf("limit must be a positive number")
+		}
+		s.Limit = n
+	} else if n, ok := p.number(); ok {
+		s.Limit = n
+	}
+	if s.Limit > MaxRows {
+		return nil, p.errorf("limit must be at most %d", MaxRows)
+	}
+	var err error
+	if s.Fields, err = p.list(""); err != nil {
+		return nil, err
+	}
+	if len(s.Fields) > maxBy {
+		return nil, p.errorf("at most %d fields", maxBy)
+	}
+	return s, nil
+}
+
+func (p *stageParser) fields() (Stage, error) {
+	var s Fields
+	s.Drop = p.punct("-")
+	if !s.Drop {
+		p.punct("+")
+	}
+	var err error
+	s.Names, err = p.list("")
+	return s, err
+}
+
+func (p *stageParser) sort() (Stage, error) {
+	var s Sort
+	for !p.done() {
+		k := SortKey{Desc: p.punct("-")}
+		if !k.Desc {
+			p.punct("+")
+		}
+		var err error
+		if k.Field, err = p.word("a field"); err != nil {
+			return nil, err
+		}
+		s.Keys = append(s.Keys, k)
+		p.punct(",")
+	}
+	if len(s.Keys) == 0 {
+		return nil, p.errorf("expected a field")
+	}
+	return s, nil
+}
+
+func (p *stageParser) head() (Stage, error) {
+	if p.done() {
+		return Head{N: 10}, nil
+	}
+	n, ok := p.number()
+	if !ok || n > MaxRows {
+		return nil, p.errorf("expected a number between 1 and %d", MaxRows)
+	}
+	return Head{N: n}, nil
+}
@@ -0,0 +1,74 @@
+package pipeline_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/pipeline"
+	"github.com/aak1247/logtap/internal/search"
+)
+
+func TestParse(t *testing.T) {
+	q, err := pipeline.Parse(`level:error message:"a | b" | stats count() as n, p95(fields.latency_ms) by fields.service | sort -n | head 10`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if q.Search == nil || q.Search.String() != `(level:error AND message:"a | b")` {
+		t.Fatalf("search = %v", q.Search)
+	}
+	want := []pipeline.Stage{
+		pipeline.Stats{
+			Aggs: []pipeline.Agg{{Func: "count", As: "n"}, {Func: "p95", Field: "fields.latency_ms", As: "p95(fields.latency_ms)"}},
+			By:   []string{"fields.service"},
+		},
+		pipeline.Sort{Keys: []pipeline.SortKey{{Field: "n", Desc: true}}},
+		pipeline.Head{N: 10},
+	}
+	if !reflect.DeepEqual(q.Stages, want) {
+		t.Fatalf("stages = %#v", q.Stages)
+	}
+
+	cases := map[string]pipeline.Stage{
+		"| timechart span=5m avg(fields.ms) by level": pipeline.Timechart{Span: 5 * time.Minute, Aggs: []pipeline.Agg{{Func: "avg", Field: "fields.ms", As: "avg(fields.ms)"}}, By: "level"},
+		"| top limit=3 service, level":                pipeline.Top{Fields: []string{"service", "level"}, Limit: 3},
+		"| rare host":                                 pipeline.Top{Fields: []string{"host"}, Limit: pipeline.DefaultTop, Rare: true},
+		"| fields - fields, trace_id":                 pipeline.Fields{Names: []string{"fields", "trace_id"}, Drop: true},
+		"| sort +level, -timestamp":                   pipeline.Sort{Keys: []pipeline.SortKey{{Field: "level"}, {Field: "timestamp", Desc: true}}},
+		"| where fields.n:>5":                         pipeline.Where{Query: search.Range{Field: "fields.n", From: "5"}},
+		"| stats dc(user) median(ms) as \"p 50\"":     pipeline.Stats{Aggs: []pipeline.Agg{{Func: "dc", Field: "user", As: "dc(user)"}, {Func: "p50", Field: "ms", As: "p 50"}}},
+	}
+	for raw, want := range cases {
+		q, err := pipeline.Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", raw, err)
+		}
+		if len(q.Stages) != 1 || !reflect.DeepEqual(q.Stages[0], want) {
+			t.Fatalf("Parse(%q) = %#v", raw, q.Stages)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"| stats",
+		"| stats count",
+		"| stats sum()",
+		"| stats p100(x)",
+		"| stats count() as n, sum(x) as n",
+		"| stats count() | top level",
+		"| head 0",
+		"| head many",
+		"| timechart span=1ms count()",
+		"| nope",
+		"| ",
+		"| sort",
+		"| where level:(",
+		"| stats count() by x; drop table logs",
+	} {
+		if _, err := pipeline.Parse(raw); !errors.Is(err, search.ErrInvalidQuery) {
+			t.Fatalf("Parse(%q) err = %v", raw, err)
+		}
+	}
+}
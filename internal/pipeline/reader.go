@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aak1247/logtap/internal/detector"
+	"gorm.io/gorm"
+)
+
+// Reader serves query results to the metric_threshold detector, one point
+// per row.
+type Reader struct {
+	DB *gorm.DB
+}
+
+func NewReader(db *gorm.DB) Reader { return Reader{DB: db} }
+
+// QueryPoints runs query over tr. A point's value is the row's column, by
+// default the first one the aggregation computed; its labels are the row's
+// groups and its time the row's bucket, for timechart, else tr.End. Rows
+// whose value is not a number are skipped.
+func (r Reader) QueryPoints(ctx context.Context, projectID int, query, column string, tr detector.TimeRange) ([]detector.MetricPoint, error) {
+	q, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	res, err := NewExecutor(r.DB).Run(ctx, projectID, tr.Start, tr.End, q)
+	if err != nil {
+		return nil, err
+	}
+	if column == "" {
+		for _, c := range res.Columns {
+			if !contains(res.Groups, c) {
+				column = c
+				break
+			}
+		}
+	}
+	if column == "" || !res.hasColumn(column) {
+		return nil, fmt.Errorf("query has no column %q", column)
+	}
+
+	out := make([]detector.MetricPoint, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		v, ok := number(row[column])
+		if !ok {
+			continue
+		}
+		p := detector.MetricPoint{Timestamp: tr.End, Value: v, Labels: map[string]string{}}
+		for _, g := range res.Groups {
+			if t, isTime := row[g].(time.Time); isTime && g == TimeColumn {
+				p.Timestamp = t
+				continue
+			}
+			p.Labels[g] = text(row[g])
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, it := range list {
+		if it == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// scan reads the rows of q by column name. Columns in times hold times:
+// SQLite returns them as text, and time buckets as Unix seconds.
+func scan(q *gorm.DB, times map[string]bool) ([]map[string]any, error) {
+	rows, err := q.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var out []map[string]any
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		m := make(map[string]any, len(cols))
+		for i, c := range cols {
+			m[c] = value(vals[i], times[c])
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// storedTime are the layouts SQLite timestamps are stored in.
+var storedTime = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+}
+
+func value(v any, isTime bool) any {
+	switch t := v.(type) {
+	case []byte:
+		v = string(t)
+	case time.Time:
+		return t.UTC()
+	}
+	if !isTime {
+		return v
+	}
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0).UTC()
+	case float64:
+		return time.Unix(int64(t), 0).UTC()
+	case string:
+		for _, layout := range storedTime {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts.UTC()
+			}
+		}
+	}
+	return v
+}
+
+// number is a value as a number; numeric text counts, as JSON fields read
+// as text on Postgres.
+func number(v any) (float64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// text is a value as text, as group keys and labels show it.
+func text(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
@@ -0,0 +1,283 @@
+// Package proguard reads ProGuard/R8 mapping files (mapping.txt) and retraces
+// obfuscated Java/Kotlin stack frames, expanding frames R8 inlined.
+package proguard
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Mapping is a parsed mapping file.
+type Mapping struct {
+	// ID is the pg_map_id header R8 writes, if any.
+	ID string
+
+	classes map[string]*class // by obfuscated name
+	files   map[string]string // original class -> source file
+}
+
+type class struct {
+	name    string
+	methods map[string][]member // by obfuscated name, in file order
+}
+
+type member struct {
+	start, end         int // obfuscated line range; 0 when absent
+	origStart, origEnd int // original line range; 0 when absent
+	// class is set when the method was inlined from another class.
+	class string
+	name  string
+}
+
+// Frame is one stack frame.
+type Frame struct {
+	Class  string
+	Method string
+	File   string
+	Line   int
+}
+
+// Parse reads a mapping file.
+func Parse(r io.Reader) (*Mapping, error) {
+	m := &Mapping{classes: map[string]*class{}, files: map[string]string{}}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var cur *class
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			m.comment(trimmed, cur)
+		case line[0] != ' ' && line[0] != '\t':
+			// com.example.Foo -> a.a:
+			orig, obf, ok := strings.Cut(strings.TrimSuffix(trimmed, ":"), " -> ")
+			if !ok {
+				cur = nil
+				continue
+			}
+			cur = &class{name: strings.TrimSpace(orig), methods: map[string][]member{}}
+			m.classes[strings.TrimSpace(obf)] = cur
+		case cur != nil:
+			if mem, obf, ok := parseMember(trimmed); ok {
+				cur.methods[obf] = append(cur.methods[obf], mem)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// comment handles "# pg_map_id: ..." and R8's JSON metadata, of which only
+// the class's source file is used.
+func (m *Mapping) comment(c string, cur *class) {
+	body := strings.TrimSpace(strings.TrimPrefix(c, "#"))
+	if id, ok := strings.CutPrefix(body, "pg_map_id:"); ok {
+		m.ID = strings.TrimSpace(id)
+		return
+	}
+	if cur == nil || !strings.HasPrefix(body, "{") {
+		return
+	}
+	var meta struct {
+		ID       string `json:"id"`
+		FileName string `json:"fileName"`
+	}
+	if json.Unmarshal([]byte(body), &meta) == nil && meta.ID == "sourceFile" && meta.FileName != "" {
+		m.files[cur.name] = meta.FileName
+	}
+}
+
+var rangePrefix = regexp.MustCompile(`^(\d+):(\d+):`)
+
+// parseMember parses "1:5:void bar(int):10:14 -> b"; fields are skipped.
+func parseMember(s string) (member, string, bool) {
+	left, obf, ok := strings.Cut(s, " -> ")
+	if !ok {
+		return member{}, "", false
+	}
+	var mem member
+	if sm := rangePrefix.FindStringSubmatch(left); sm != nil {
+		mem.start, _ = strconv.Atoi(sm[1])
+		mem.end, _ = strconv.Atoi(sm[2])
+		left = left[len(sm[0]):]
+	}
+	open := strings.IndexByte(left, '(')
+	closing := strings.LastIndexByte(left, ')')
+	if open < 0 || closing < open {
+		return member{}, "", false
+	}
+	if rest := left[closing+1:]; strings.HasPrefix(rest, ":") {
+		parts := strings.Split(rest[1:], ":")
+		mem.origStart, _ = strconv.Atoi(parts[0])
+		if len(parts) > 1 {
+			mem.origEnd, _ = strconv.Atoi(parts[1])
+		}
+	}
+	sig := strings.TrimSpace(left[:open])
+	if i := strings.LastIndexByte(sig, ' '); i >= 0 {
+		sig = sig[i+1:]
+	}
+	if i := strings.LastIndexByte(sig, '.'); i >= 0 {
+		mem.class, sig = sig[:i], sig[i+1:]
+	}
+	mem.name = sig
+	return mem, strings.TrimSpace(obf), true
+}
+
+// MapID returns the pg_map_id from the header comments of a mapping file
+// without parsing the rest.
+func MapID(r io.Reader) string {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if id, ok := strings.CutPrefix(strings.TrimSpace(strings.TrimPrefix(line, "#")), "pg_map_id:"); ok {
+			return strings.TrimSpace(id)
+		}
+	}
+	return ""
+}
+
+// Class returns the original name of an obfuscated class.
+func (m *Mapping) Class(obf string) (string, bool) {
+	c, ok := m.classes[obf]
+	if !ok {
+		return "", false
+	}
+	return c.name, true
+}
+
+// Retrace returns the original frames for f, innermost first; a frame R8
+// inlined into another expands into several. ok is false when the class is
+// not in the mapping.
+func (m *Mapping) Retrace(f Frame) ([]Frame, bool) {
+	c, ok := m.classes[f.Class]
+	if !ok {
+		return nil, false
+	}
+	members := c.methods[f.Method]
+	var matched []member
+	if f.Line > 0 {
+		for _, mem := range members {
+			if mem.start > 0 && mem.start <= f.Line && f.Line <= mem.end {
+				matched = append(matched, mem)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		for _, mem := range members {
+			if mem.start == 0 {
+				matched = append(matched, mem)
+				break
+			}
+		}
+	}
+	if len(matched) == 0 && len(members) > 0 {
+		matched = members[:1]
+	}
+	if len(matched) == 0 {
+		return []Frame{{Class: c.name, Method: f.Method, File: m.file(c.name, f.File), Line: f.Line}}, true
+	}
+
+	out := make([]Frame, 0, len(matched))
+	for _, mem := range matched {
+		cls := c.name
+		if mem.class != "" {
+			cls = mem.class
+		}
+		out = append(out, Frame{Class: cls, Method: mem.name, File: m.file(cls, f.File), Line: mem.line(f.Line)})
+	}
+	return out, true
+}
+
+func (mem member) line(obf int) int {
+	switch {
+	case mem.origStart == 0:
+		return obf
+	case mem.origEnd > mem.origStart && mem.start > 0:
+		return mem.origStart + obf - mem.start
+	default:
+		return mem.origStart
+	}
+}
+
+// file returns the source file of an original class: R8's metadata, the
+// frame's own file unless it is a placeholder, or one derived from the
+// outermost class name.
+func (m *Mapping) file(cls, frameFile string) string {
+	if f, ok := m.files[cls]; ok {
+		return f
+	}
+	if frameFile != "" && frameFile != "SourceFile" && frameFile != "Unknown Source" {
+		return frameFile
+	}
+	simple := cls
+	if i := strings.LastIndexByte(simple, '.'); i >= 0 {
+		simple = simple[i+1:]
+	}
+	if i := strings.IndexByte(simple, '$'); i >= 0 {
+		simple = simple[:i]
+	}
+	return simple + ".java"
+}
+
+var (
+	frameLine     = regexp.MustCompile(`^(\s*at\s+)([\w$.]+)\.([\w$<>-]+)\(([^)]*)\)(.*)$`)
+	exceptionLine = regexp.MustCompile(`^(\s*(?:Caused by: |Suppressed: )?)([\w$]+(?:\.[\w$]+)+)(:.*)?$`)
+)
+
+// RetraceText rewrites a Java stack trace as printed by
+// Throwable.printStackTrace. It reports whether anything changed.
+func (m *Mapping) RetraceText(s string) (string, bool) {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	changed := false
+	for _, line := range lines {
+		if sm := frameLine.FindStringSubmatch(line); sm != nil {
+			file, lineNo := sm[4], 0
+			if f, l, ok := strings.Cut(sm[4], ":"); ok {
+				file = f
+				lineNo, _ = strconv.Atoi(l)
+			}
+			frames, ok := m.Retrace(Frame{Class: sm[2], Method: sm[3], File: file, Line: lineNo})
+			if ok {
+				for _, f := range frames {
+					loc := f.File
+					if f.Line > 0 {
+						loc += ":" + strconv.Itoa(f.Line)
+					}
+					out = append(out, sm[1]+f.Class+"."+f.Method+"("+loc+")"+sm[5])
+				}
+				changed = true
+				continue
+			}
+		} else if sm := exceptionLine.FindStringSubmatch(line); sm != nil {
+			if name, ok := m.Class(sm[2]); ok {
+				out = append(out, sm[1]+name+sm[3])
+				changed = true
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n"), changed
+}
+
+// LooksLikeTrace reports whether s contains Java stack frames.
+func LooksLikeTrace(s string) bool {
+	return strings.Contains(s, "\tat ") || strings.Contains(s, "\n    at ") || strings.HasPrefix(strings.TrimSpace(s), "at ")
+}
@@ -0,0 +1,70 @@
+package proguard
+
+import (
+	"strings"
+	"testing"
+)
+
+const mapping = `# compiler: R8
+# pg_map_id: 5b46fdc
+com.example.app.MainActivity -> a.a:
+# {"id":"sourceFile","fileName":"MainActivity.kt"}
+    int counter -> a
+    1:1:void onCreate(android.os.Bundle):12:12 -> onCreate
+    2:3:void com.example.app.Util.check(int):40:41 -> b
+    2:3:void handle(int):20 -> b
+    4:4:void handle(int):22:22 -> b
+    void reset() -> c
+com.example.app.Util -> a.b:
+com.example.app.BadState -> a.c:
+`
+
+func TestRetrace(t *testing.T) {
+	m, err := Parse(strings.NewReader(mapping))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if m.ID != "5b46fdc" {
+		t.Fatalf("ID = %q", m.ID)
+	}
+
+	frames, ok := m.Retrace(Frame{Class: "a.a", Method: "b", File: "SourceFile", Line: 3})
+	if !ok || len(frames) != 2 {
+		t.Fatalf("Retrace inlined = %+v ok=%v", frames, ok)
+	}
+	if frames[0] != (Frame{Class: "com.example.app.Util", Method: "check", File: "Util.java", Line: 41}) {
+		t.Fatalf("inlined frame = %+v", frames[0])
+	}
+	if frames[1] != (Frame{Class: "com.example.app.MainActivity", Method: "handle", File: "MainActivity.kt", Line: 20}) {
+		t.Fatalf("outer frame = %+v", frames[1])
+	}
+
+	frames, ok = m.Retrace(Frame{Class: "a.a", Method: "c", Line: 0})
+	if !ok || len(frames) != 1 || frames[0].Method != "reset" {
+		t.Fatalf("Retrace unranged = %+v ok=%v", frames, ok)
+	}
+	if _, ok := m.Retrace(Frame{Class: "android.app.Activity", Method: "performCreate"}); ok {
+		t.Fatalf("expected unknown class to be left alone")
+	}
+}
+
+func TestRetraceText(t *testing.T) {
+	m, err := Parse(strings.NewReader(mapping))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	in := "a.c: broken\n\tat a.a.b(SourceFile:4)\n\tat android.app.Activity.performCreate(Activity.java:8000)\nCaused by: a.c\n\tat a.a.b(SourceFile:2)"
+	want := "com.example.app.BadState: broken\n" +
+		"\tat com.example.app.MainActivity.handle(MainActivity.kt:22)\n" +
+		"\tat android.app.Activity.performCreate(Activity.java:8000)\n" +
+		"Caused by: com.example.app.BadState\n" +
+		"\tat com.example.app.Util.check(Util.java:40)\n" +
+		"\tat com.example.app.MainActivity.handle(MainActivity.kt:20)"
+	got, changed := m.RetraceText(in)
+	if !changed || got != want {
+		t.Fatalf("RetraceText =\n%s\nwant\n%s", got, want)
+	}
+	if !LooksLikeTrace(in) || LooksLikeTrace("plain message") {
+		t.Fatalf("LooksLikeTrace misclassified")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/alert"
+	"github.com/aak1247/logtap/internal/cursor"
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/project"
 	"github.com/gin-gonic/gin"
@@ -949,6 +950,7 @@ func TestAlertRulesHandler(db *gorm.DB) gin.HandlerFunc {
 			Level   string         `json:"level"`
 			Message string         `json:"message"`
 			Fields  map[string]any `json:"fields"`
+			Trigger string         `json:"trigger"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			respondErr(c, http.StatusBadRequest, err.Error())
@@ -967,8 +969,12 @@ func TestAlertRulesHandler(db *gorm.DB) gin.HandlerFunc {
 			source = alert.SourceEvents
 		case string(alert.SourceBoth):
 			source = alert.SourceBoth
+		case string(alert.SourceIssues):
+			source = alert.SourceIssues
+		case string(alert.SourceMetrics):
+			source = alert.SourceMetrics
 		default:
-			respondErr(c, http.StatusBadRequest, "invalid source (expected logs|events|both)")
+			respondErr(c, http.StatusBadRequest, "invalid source (expected logs|events|both|issues|metrics)")
 			return
 		}
 
@@ -979,6 +985,7 @@ func TestAlertRulesHandler(db *gorm.DB) gin.HandlerFunc {
 			Level:     strings.TrimSpace(req.Level),
 			Message:   strings.TrimSpace(req.Message),
 			Fields:    req.Fields,
+			Trigger:   strings.TrimSpace(req.Trigger),
 		}
 		if in.Fields == nil {
 			in.Fields = map[string]any{}
@@ -1171,6 +1178,11 @@ func ListAlertDeliveriesHandler(db *gorm.DB) gin.HandlerFunc {
 			ruleID = n
 		}
 
+		after, ok := parseCursor(c)
+		if !ok {
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
@@ -1185,12 +1197,18 @@ func ListAlertDeliveriesHandler(db *gorm.DB) gin.HandlerFunc {
 			q = q.Where("rule_id = ?", ruleID)
 		}
 
+		// Deliveries page by id alone: ids grow with created_at.
 		var items []model.AlertDelivery
-		if err := q.Order("id DESC").Limit(limit).Find(&items).Error; err != nil {
+		if err := after.Where(q, "", "id", false).Order(cursor.Order("", "id", false)).Limit(limit + 1).Find(&items).Error; err != nil {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
-		respondOK(c, gin.H{"items": items})
+		var next string
+		if len(items) > limit {
+			items = items[:limit]
+			next = cursor.After(time.Time{}, items[limit-1].ID).String()
+		}
+		respondPage(c, gin.H{"items": items}, next)
 	}
 }
 
@@ -1213,9 +1231,9 @@ func buildRuleFromRequest(ctx context.Context, db *gorm.DB, projectID int, ruleI
 		source = string(alert.SourceBoth)
 	}
 	switch source {
-	case string(alert.SourceLogs), string(alert.SourceEvents), string(alert.SourceBoth):
+	case string(alert.SourceLogs), string(alert.SourceEvents), string(alert.SourceBoth), string(alert.SourceIssues), string(alert.SourceMetrics):
 	default:
-		return model.AlertRule{}, errors.New("invalid source (expected logs|events|both)")
+		return model.AlertRule{}, errors.New("invalid source (expected logs|events|both|issues|metrics)")
 	}
 
 	enabled := true
@@ -1438,6 +1456,7 @@ func TestAlertRulesDeliveriesHandler(db *gorm.DB) gin.HandlerFunc {
 			Level   string         `json:"level"`
 			Message string         `json:"message"`
 			Fields  map[string]any `json:"fields"`
+			Trigger string         `json:"trigger"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			respondErr(c, http.StatusBadRequest, err.Error())
@@ -1456,8 +1475,12 @@ func TestAlertRulesDeliveriesHandler(db *gorm.DB) gin.HandlerFunc {
 			source = alert.SourceEvents
 		case string(alert.SourceBoth):
 			source = alert.SourceBoth
+		case string(alert.SourceIssues):
+			source = alert.SourceIssues
+		case string(alert.SourceMetrics):
+			source = alert.SourceMetrics
 		default:
-			respondErr(c, http.StatusBadRequest, "invalid source (expected logs|events|both)")
+			respondErr(c, http.StatusBadRequest, "invalid source (expected logs|events|both|issues|metrics)")
 			return
 		}
 
@@ -1468,6 +1491,7 @@ func TestAlertRulesDeliveriesHandler(db *gorm.DB) gin.HandlerFunc {
 			Level:     strings.TrimSpace(req.Level),
 			Message:   strings.TrimSpace(req.Message),
 			Fields:    req.Fields,
+			Trigger:   strings.TrimSpace(req.Trigger),
 		}
 		if in.Fields == nil {
 			in.Fields = map[string]any{}
@@ -9,10 +9,13 @@ import (
 	"github.com/aak1247/logtap/internal/metrics"
 	"github.com/aak1247/logtap/internal/project"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GET /api/:projectId/analytics/active?bucket=day|month&start=RFC3339&end=RFC3339
-func ActiveSeriesHandler(recorder *metrics.RedisRecorder) gin.HandlerFunc {
+//
+// annotations holds the deploy markers in the range when db is set.
+func ActiveSeriesHandler(recorder *metrics.RedisRecorder, db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if recorder == nil {
 			respondErr(c, http.StatusNotImplemented, "metrics not configured")
@@ -52,11 +55,12 @@ func ActiveSeriesHandler(recorder *metrics.RedisRecorder) gin.HandlerFunc {
 			return
 		}
 		respondOK(c, gin.H{
-			"project_id": projectID,
-			"bucket":     bucket,
-			"start":      start.UTC().Format(time.RFC3339),
-			"end":        end.UTC().Format(time.RFC3339),
-			"series":     series,
+			"project_id":  projectID,
+			"bucket":      bucket,
+			"start":       start.UTC().Format(time.RFC3339),
+			"end":         end.UTC().Format(time.RFC3339),
+			"series":      series,
+			"annotations": deployAnnotations(ctx, db, projectID, start, end),
 		})
 	}
 }
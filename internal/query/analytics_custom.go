@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/queryjob"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -79,7 +80,7 @@ type customRow struct {
 }
 
 // CustomAnalyticsHandler implements POST /api/:projectId/analytics/custom.
-func CustomAnalyticsHandler(db *gorm.DB) gin.HandlerFunc {
+func CustomAnalyticsHandler(db *gorm.DB, jobs *queryjob.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if db == nil {
 			respondErr(c, http.StatusNotImplemented, "database not configured")
@@ -142,27 +143,44 @@ func CustomAnalyticsHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		run := func(ctx context.Context, db *gorm.DB) (gin.H, error) {
+			rows, err := runCustomAnalyticsQuery(ctx, db, projectID, analysisType, metricType, granularity, start, end, groupBy, propertyKey, &req)
+			if err != nil {
+				return nil, err
+			}
+			series := buildCustomSeries(rows, metricType, groupBy, propertyKey)
+			return gin.H{
+				"project_id":    projectID,
+				"analysis_type": analysisType,
+				"metric":        metricType,
+				"granularity":   granularity,
+				"start":         start.UTC().Format(time.RFC3339),
+				"end":           end.UTC().Format(time.RFC3339),
+				"group_by":      groupBy,
+				"property_key":  propertyKey,
+				"series":        series,
+				"annotations":   deployAnnotations(ctx, db, projectID, start, end),
+			}, nil
+		}
+
+		// With async=1 the analysis runs as a query job keyed by the
+		// normalized request, so reopening a saved view hits its cache.
+		if asyncRequested(c) {
+			req.AnalysisType, req.Metric.Type, req.TimeRange.Granularity, req.GroupBy = analysisType, metricType, granularity, groupBy
+			submitJob(c, jobs, projectID, "analytics.custom", req, func(ctx context.Context, db *gorm.DB, _ func(float64, any)) (any, error) {
+				return run(ctx, db)
+			})
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
-
-		rows, err := runCustomAnalyticsQuery(ctx, db, projectID, analysisType, metricType, granularity, start, end, groupBy, propertyKey, &req)
+		out, err := run(ctx, db)
 		if err != nil {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
-
-		series := buildCustomSeries(rows, metricType, groupBy, propertyKey)
-		respondOK(c, gin.H{
-			"project_id":   projectID,
-			"analysis_type": analysisType,
-			"metric":       metricType,
-			"granularity":  granularity,
-			"start":        start.UTC().Format(time.RFC3339),
-			"end":          end.UTC().Format(time.RFC3339),
-			"group_by":     groupBy,
-			"property_key": propertyKey,
-			"series":       series,
-		})
+		respondOK(c, out)
 	}
 }
 
@@ -288,8 +306,14 @@ func propertyExpr(db *gorm.DB, key string) string {
 		return "''"
 	}
 	if db != nil && strings.EqualFold(db.Dialector.Name(), "sqlite") {
-		// SQLite json_extract with a simple path.
-		return fmt.Sprintf("json_extract(fields, '$.%s')", key)
+		// SQLite JSON1. The key is quoted so it is looked up literally (like
+		// Postgres ->>), and the value is rendered as text so IN filters and
+		// group-by values compare the same way on both dialects.
+		path := fmt.Sprintf(`'$."%s"'`, key)
+		return fmt.Sprintf(
+			"(CASE json_type(fields, %[1]s) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(json_extract(fields, %[1]s) AS TEXT) END)",
+			path,
+		)
 	}
 	// Postgres: fields->>'key'
 	return fmt.Sprintf("fields->>'%s'", key)
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func ListArchivesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		kind := strings.TrimSpace(c.Query("kind"))
+		if kind != "" {
+			if _, ok := archive.ParseKind(kind); !ok {
+				respondErr(c, http.StatusBadRequest, "invalid kind (expected logs|events|track_events)")
+				return
+			}
+		}
+		start, _ := parseTime(c.Query("start"))
+		end, _ := parseTime(c.Query("end"))
+		limit := parseLimit(c.Query("limit"), 100, 1000)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.ListArchiveManifests(ctx, db, projectID, kind, start, end, limit)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, rows)
+	}
+}
+
+// RehydrateArchivesHandler restores the archives overlapping a time range
+// into the rehydrated_<kind> table.
+func RehydrateArchivesHandler(db *gorm.DB, objects archive.ObjectStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		if objects == nil {
+			respondErr(c, http.StatusNotImplemented, "archive store not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var req struct {
+			Kind  string `json:"kind"`
+			Start string `json:"start"`
+			End   string `json:"end"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		kind, ok := archive.ParseKind(strings.TrimSpace(req.Kind))
+		if !ok {
+			respondErr(c, http.StatusBadRequest, "invalid kind (expected logs|events|track_events)")
+			return
+		}
+		start, okStart := parseTime(req.Start)
+		end, okEnd := parseTime(req.End)
+		if !okStart || !okEnd || !end.After(start) {
+			respondErr(c, http.StatusBadRequest, "start and end (RFC3339, end after start) are required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+		defer cancel()
+
+		res, err := archive.Rehydrate(ctx, db, objects, projectID, kind, start, end)
+		if err != nil {
+			status := http.StatusServiceUnavailable
+			if errors.Is(err, archive.ErrNoStore) {
+				status = http.StatusNotImplemented
+			}
+			respondErr(c, status, err.Error())
+			return
+		}
+		respondOK(c, gin.H{
+			"kind":       kind,
+			"table":      kind.RehydratedTable(),
+			"archives":   res.Archives,
+			"skipped":    res.Skipped,
+			"rows":       res.Rows,
+			"start":      start.Format(time.RFC3339),
+			"end":        end.Format(time.RFC3339),
+			"project_id": projectID,
+		})
+	}
+}
+
+// DropRehydratedHandler clears restored rows of one kind for the project.
+func DropRehydratedHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		kind, ok := archive.ParseKind(strings.TrimSpace(c.Query("kind")))
+		if !ok {
+			respondErr(c, http.StatusBadRequest, "invalid kind (expected logs|events|track_events)")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		n, err := archive.DropRehydrated(ctx, db, projectID, kind)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"kind": kind, "deleted": n})
+	}
+}
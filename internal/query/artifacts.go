@@ -0,0 +1,158 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/artifact"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UploadArtifactHandler stores one release artifact. Multipart form: file
+// (required), name (the URL the file is served from, e.g.
+// "~/static/js/app.js"; defaults to "~/" + the file name) and type
+// (defaults from the name; "proguard" for mapping.txt and "dart_symbols" for
+// --split-debug-info *.symbols files).
+func UploadArtifactHandler(db *gorm.DB, objects archive.ObjectStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if objects == nil {
+			respondErr(c, http.StatusNotImplemented, "artifact store not configured")
+			return
+		}
+		projectID, release, ok := artifactScope(c, db)
+		if !ok {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, artifact.MaxSize+1<<20)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, "file is required")
+			return
+		}
+		if fh.Size > artifact.MaxSize {
+			respondErr(c, http.StatusRequestEntityTooLarge, artifact.ErrTooLarge.Error())
+			return
+		}
+		name := c.PostForm("name")
+		if strings.TrimSpace(name) == "" {
+			name = "~/" + fh.Filename
+		}
+		name, err = artifact.NormalizeName(name)
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(f, artifact.MaxSize+1))
+		_ = f.Close()
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+		defer cancel()
+
+		row, err := artifact.Upload(ctx, db, objects, projectID, release, name, strings.TrimSpace(c.PostForm("type")), body)
+		if err != nil {
+			if errors.Is(err, artifact.ErrTooLarge) {
+				respondErr(c, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			if errors.Is(err, artifact.ErrInvalid) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+func ListArtifactsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, release, ok := artifactScope(c, db)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.ListReleaseArtifacts(ctx, db, projectID, release)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, rows)
+	}
+}
+
+func DeleteArtifactHandler(db *gorm.DB, objects archive.ObjectStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if objects == nil {
+			respondErr(c, http.StatusNotImplemented, "artifact store not configured")
+			return
+		}
+		projectID, release, ok := artifactScope(c, db)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(c.Param("artifactId")), 10, 64)
+		if err != nil || id <= 0 {
+			respondErr(c, http.StatusBadRequest, "invalid artifactId")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		row, found, err := store.GetReleaseArtifact(ctx, db, projectID, id)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if !found || row.Release != release {
+			respondErr(c, http.StatusNotFound, "not found")
+			return
+		}
+		if err := artifact.Delete(ctx, db, objects, row); err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"deleted": true})
+	}
+}
+
+// artifactScope parses the project and release of an artifact route.
+func artifactScope(c *gin.Context, db *gorm.DB) (int, string, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return 0, "", false
+	}
+	projectID, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return 0, "", false
+	}
+	release := strings.TrimSpace(c.Param("release"))
+	if release == "" || len(release) > 200 {
+		respondErr(c, http.StatusBadRequest, "invalid release")
+		return 0, "", false
+	}
+	return projectID, release, true
+}
@@ -2,12 +2,16 @@ package query
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/retention"
 	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/timescale"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -64,6 +68,9 @@ func UpsertCleanupPolicyHandler(db *gorm.DB) gin.HandlerFunc {
 			TrackEventsRetentionDays *int  `json:"track_events_retention_days"`
 			ScheduleHourUTC          *int  `json:"schedule_hour_utc"`
 			ScheduleMinuteUTC        *int  `json:"schedule_minute_utc"`
+			ArchiveEnabled           *bool `json:"archive_enabled"`
+
+			RetentionRules *[]model.RetentionRule `json:"retention_rules"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			respondErr(c, http.StatusBadRequest, err.Error())
@@ -101,6 +108,17 @@ func UpsertCleanupPolicyHandler(db *gorm.DB) gin.HandlerFunc {
 		if req.ScheduleMinuteUTC != nil {
 			next.ScheduleMinuteUTC = *req.ScheduleMinuteUTC
 		}
+		if req.ArchiveEnabled != nil {
+			next.ArchiveEnabled = *req.ArchiveEnabled
+		}
+		if req.RetentionRules != nil {
+			rules, err := retention.Encode(*req.RetentionRules)
+			if err != nil {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			next.RetentionRules = rules
+		}
 
 		if next.LogsRetentionDays < 0 || next.LogsRetentionDays > 3650 {
 			respondErr(c, http.StatusBadRequest, "invalid logs_retention_days (expected 0..3650)")
@@ -128,6 +146,10 @@ func UpsertCleanupPolicyHandler(db *gorm.DB) gin.HandlerFunc {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
+		// Native Timescale retention follows the longest project policy.
+		if err := timescale.SyncRetention(ctx, db); err != nil {
+			log.Printf("cleanup policy: project=%d: sync timescale retention: %v", projectID, err)
+		}
 		respondOK(c, saved)
 	}
 }
@@ -162,43 +184,55 @@ func RunCleanupPolicyHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		now := time.Now().UTC()
-		var logsDeleted int64
-		var eventsDeleted int64
-		var trackEventsDeleted int64
-		var logsBefore string
-		var eventsBefore string
-		var trackEventsBefore string
-
-		if policy.LogsRetentionDays > 0 {
-			before := now.Add(-time.Duration(policy.LogsRetentionDays) * 24 * time.Hour)
-			logsBefore = before.Format(time.RFC3339)
-			n, err := store.DeleteLogsBefore(ctx, db, projectID, before)
-			if err != nil {
+		if policy.ArchiveEnabled {
+			// Archiving needs the object store held by the cleanup worker, so
+			// only make the policy due instead of deleting here.
+			if err := store.ScheduleCleanupPolicyNow(ctx, db, projectID, now); err != nil {
 				respondErr(c, http.StatusServiceUnavailable, err.Error())
 				return
 			}
-			logsDeleted = n
+			respondOK(c, gin.H{
+				"project_id":   projectID,
+				"scheduled":    true,
+				"scheduled_at": now.Format(time.RFC3339),
+			})
+			return
 		}
-		if policy.EventsRetentionDays > 0 {
-			before := now.Add(-time.Duration(policy.EventsRetentionDays) * 24 * time.Hour)
-			eventsBefore = before.Format(time.RFC3339)
-			n, err := store.DeleteEventsBefore(ctx, db, projectID, before)
+
+		// On SQLite a single large DELETE holds the only write lock for its
+		// whole duration and stalls ingest, so delete in short batches instead.
+		batched := strings.EqualFold(db.Dialector.Name(), "sqlite")
+
+		deletedByTable := map[string]int64{}
+		beforeByTable := map[string]string{}
+		for _, table := range []string{retention.TableLogs, retention.TableEvents, retention.TableTrackEvents} {
+			buckets, err := retention.Buckets(db, policy, table, now)
 			if err != nil {
 				respondErr(c, http.StatusServiceUnavailable, err.Error())
 				return
 			}
-			eventsDeleted = n
-		}
-		if policy.TrackEventsRetentionDays > 0 {
-			before := now.Add(-time.Duration(policy.TrackEventsRetentionDays) * 24 * time.Hour)
-			trackEventsBefore = before.Format(time.RFC3339)
-			n, err := store.DeleteTrackEventsBefore(ctx, db, projectID, before)
-			if err != nil {
-				respondErr(c, http.StatusServiceUnavailable, err.Error())
-				return
+			if days := retention.BaseDays(policy, table); days > 0 {
+				beforeByTable[table] = now.Add(-time.Duration(days) * 24 * time.Hour).Format(time.RFC3339)
+			}
+			for _, b := range buckets {
+				n, err := deleteMaybeBatched(ctx, batched, func(ctx context.Context) (int64, error) {
+					return store.DeleteRowsBefore(ctx, db, table, projectID, b.Before, b.Where, b.Args)
+				}, func(ctx context.Context) (int64, error) {
+					return store.DeleteRowsBeforeBatched(ctx, db, table, projectID, b.Before, b.Where, b.Args, 5000)
+				})
+				if err != nil {
+					respondErr(c, http.StatusServiceUnavailable, err.Error())
+					return
+				}
+				deletedByTable[table] += n
 			}
-			trackEventsDeleted = n
 		}
+		logsDeleted := deletedByTable[retention.TableLogs]
+		eventsDeleted := deletedByTable[retention.TableEvents]
+		trackEventsDeleted := deletedByTable[retention.TableTrackEvents]
+		logsBefore := beforeByTable[retention.TableLogs]
+		eventsBefore := beforeByTable[retention.TableEvents]
+		trackEventsBefore := beforeByTable[retention.TableTrackEvents]
 
 		_ = store.MarkCleanupPolicyRun(ctx, db, projectID, now, policy.ScheduleHourUTC, policy.ScheduleMinuteUTC)
 
@@ -215,6 +249,23 @@ func RunCleanupPolicyHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+func deleteMaybeBatched(ctx context.Context, batched bool, all, batch func(context.Context) (int64, error)) (int64, error) {
+	if !batched {
+		return all(ctx)
+	}
+	var total int64
+	for {
+		n, err := batch(ctx)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
 func defaultCleanupPolicy(projectID int) model.CleanupPolicy {
 	return model.CleanupPolicy{
 		ProjectID:                projectID,
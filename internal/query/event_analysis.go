@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/queryjob"
 	"github.com/aak1247/logtap/internal/store"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -288,7 +289,7 @@ type FunnelStep struct {
 
 // GET /api/:projectId/analytics/funnel?steps=a,b,c&start=RFC3339&end=RFC3339&within=24h
 // Funnel is computed from track events stored in logs: logs.level='event', logs.message as event name and logs.distinct_id as user id.
-func FunnelHandler(db *gorm.DB) gin.HandlerFunc {
+func FunnelHandler(db *gorm.DB, jobs *queryjob.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if db == nil {
 			respondErr(c, http.StatusNotImplemented, "database not configured")
@@ -385,36 +386,54 @@ func FunnelHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		source := strings.ToLower(strings.TrimSpace(c.Query("source")))
-		counts, usedSource, err := computeFunnelCounts(ctx, db, projectID, steps, start, end, withinSec, source)
-		if err != nil {
-			respondErr(c, http.StatusServiceUnavailable, err.Error())
-			return
-		}
+		run := func(ctx context.Context, db *gorm.DB) (gin.H, error) {
+			counts, usedSource, err := computeFunnelCounts(ctx, db, projectID, steps, start, end, withinSec, source)
+			if err != nil {
+				return nil, err
+			}
 
-		var out []FunnelStep
-		prev := int64(0)
-		for i, name := range steps {
-			cur := counts[i]
-			conv := 0.0
-			drop := int64(0)
-			if i == 0 {
-				conv = 1.0
-			} else if prev > 0 {
-				conv = float64(cur) / float64(prev)
-				drop = prev - cur
+			var out []FunnelStep
+			prev := int64(0)
+			for i, name := range steps {
+				cur := counts[i]
+				conv := 0.0
+				drop := int64(0)
+				if i == 0 {
+					conv = 1.0
+				} else if prev > 0 {
+					conv = float64(cur) / float64(prev)
+					drop = prev - cur
+				}
+				out = append(out, FunnelStep{Name: name, Users: cur, Conversion: conv, Dropoff: drop})
+				prev = cur
 			}
-			out = append(out, FunnelStep{Name: name, Users: cur, Conversion: conv, Dropoff: drop})
-			prev = cur
+
+			return gin.H{
+				"project_id":  projectID,
+				"start":       start.UTC().Format(time.RFC3339),
+				"end":         end.UTC().Format(time.RFC3339),
+				"within_secs": withinSec,
+				"source":      usedSource,
+				"steps":       out,
+			}, nil
+		}
+
+		// With async=1 the funnel runs as a query job; unset start/end stay
+		// relative in its cache key.
+		if asyncRequested(c) {
+			key := gin.H{"steps": steps, "start": c.Query("start"), "end": c.Query("end"), "within_secs": withinSec, "source": source}
+			submitJob(c, jobs, projectID, "analytics.funnel", key, func(ctx context.Context, db *gorm.DB, _ func(float64, any)) (any, error) {
+				return run(ctx, db)
+			})
+			return
 		}
 
-		respondOK(c, gin.H{
-			"project_id":  projectID,
-			"start":       start.UTC().Format(time.RFC3339),
-			"end":         end.UTC().Format(time.RFC3339),
-			"within_secs": withinSec,
-			"source":      usedSource,
-			"steps":       out,
-		})
+		res, err := run(ctx, db)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, res)
 	}
 }
 
@@ -680,6 +699,7 @@ func UserGrowthHandler(db *gorm.DB) gin.HandlerFunc {
 			"end":         end.UTC().Format(time.RFC3339),
 			"series":      points,
 			"total_users": totalUsers,
+			"annotations": deployAnnotations(ctx, db, projectID, start, end),
 		})
 	}
 }
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/export"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Trailers of an export, sent after its rows.
+const (
+	exportRowsTrailer      = "X-Export-Rows"
+	exportTruncatedTrailer = "X-Export-Truncated"
+	exportCursorTrailer    = "X-Export-Cursor"
+)
+
+// ExportHandler streams the rows of one source matching q in [start, end]
+// as a file, oldest first:
+//
+//	source   logs (default), events or track
+//	format   ndjson (default), csv or parquet
+//	columns  comma-separated columns or field paths; default every column
+//	gzip     1 to gzip NDJSON and CSV, or to compress Parquet pages with gzip
+//	cursor   continue after this cursor
+//
+// A project's max_export_bytes is a daily budget: an export stops once it
+// has written what is left of it, and none starts once it is spent. Without
+// one an export stops after maxBytes (0 is unlimited). The X-Export-Rows,
+// X-Export-Truncated and X-Export-Cursor trailers tell how it ended; a
+// truncated export continues with cursor set to X-Export-Cursor.
+func ExportHandler(db *gorm.DB, maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		now := time.Now().UTC()
+		req := export.Request{
+			ProjectID: projectID,
+			Source:    strings.ToLower(strings.TrimSpace(c.DefaultQuery("source", search.SourceLogs))),
+			Query:     c.Query("q"),
+			Format:    strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", export.FormatNDJSON))),
+			Columns:   parseColumns(c.Query("columns")),
+			Gzip:      c.Query("gzip") == "1" || strings.EqualFold(c.Query("gzip"), "true"),
+			Cursor:    c.Query("cursor"),
+			MaxBytes:  maxBytes,
+		}
+		for _, b := range []struct {
+			name string
+			dst  *time.Time
+		}{{"start", &req.Start}, {"end", &req.End}} {
+			raw := strings.TrimSpace(c.Query(b.name))
+			if raw == "" {
+				continue
+			}
+			if *b.dst, err = search.ParseTime(raw, now); err != nil {
+				respondErr(c, http.StatusBadRequest, fmt.Sprintf("invalid %s (expected RFC3339 or now-7d)", b.name))
+				return
+			}
+		}
+
+		ctx := c.Request.Context()
+		day := now.Format("2006-01-02")
+		quotaCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		q, ok, err := store.GetProjectQuota(quotaCtx, db, projectID)
+		var usage model.ProjectUsageDaily
+		if err == nil && ok && q.MaxExportBytes > 0 {
+			usage, err = store.GetProjectUsageDay(quotaCtx, db, projectID, day)
+		}
+		cancel()
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if ok && q.MaxExportBytes > 0 {
+			left := q.MaxExportBytes - usage.ExportBytes
+			if left <= 0 {
+				respondErr(c, http.StatusTooManyRequests, "daily export limit reached")
+				return
+			}
+			req.MaxBytes = left
+		}
+
+		exp, err := export.Open(ctx, db, req)
+		if err != nil {
+			if errors.Is(err, export.ErrInvalid) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		h := c.Writer.Header()
+		h.Set("Content-Type", export.ContentType(req.Format, req.Gzip))
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName(req, now)))
+		h.Set("Cache-Control", "no-store")
+		h.Set("X-Accel-Buffering", "no")
+		h.Set("Trailer", strings.Join([]string{exportRowsTrailer, exportTruncatedTrailer, exportCursorTrailer}, ", "))
+		c.Status(http.StatusOK)
+
+		res, err := exp.Write(c.Writer)
+		if res.Bytes > 0 {
+			usageCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+			if err := store.UpsertProjectUsageDailyBatch(usageCtx, db, []model.ProjectUsageDaily{{ProjectID: projectID, Day: day, ExportBytes: res.Bytes}}); err != nil {
+				log.Printf("export: project=%d: record usage: %v", projectID, err)
+			}
+			cancel()
+		}
+		if err != nil {
+			// The status is sent: all that is left is to cut the body short.
+			log.Printf("export: project=%d source=%s: %v", projectID, req.Source, err)
+			return
+		}
+		h.Set(exportRowsTrailer, strconv.FormatInt(res.Rows, 10))
+		h.Set(exportTruncatedTrailer, strconv.FormatBool(res.Truncated))
+		h.Set(exportCursorTrailer, res.Cursor)
+	}
+}
+
+// parseColumns splits a comma-separated list of columns; nil when empty.
+func parseColumns(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
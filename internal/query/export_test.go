@@ -0,0 +1,112 @@
+package query_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestExport(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	base := fmt.Sprintf("%s/api/%d/export", srv.HTTP.URL, boot.ProjectID)
+
+	now := time.Now().UTC()
+	var logs []model.Log
+	for i := range 5 {
+		logs = append(logs, model.Log{ProjectID: boot.ProjectID, Timestamp: now.Add(time.Duration(i-10) * time.Minute), Level: "error", Message: fmt.Sprintf("m%d", i), Fields: []byte(`{}`)})
+	}
+	if err := srv.DB.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+
+	get := func(params url.Values) (*http.Response, []string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, base+"?"+params.Encode(), nil)
+		req.Header.Set("Authorization", "Bearer "+boot.Token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		defer resp.Body.Close()
+		var lines []string
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		return resp, lines
+	}
+
+	resp, lines := get(url.Values{"format": {"csv"}, "columns": {"message,level"}, "start": {"now-1h"}})
+	if resp.StatusCode != http.StatusOK || len(lines) != 6 || lines[0] != "message,level" || lines[1] != "m0,error" {
+		t.Fatalf("csv: status=%d lines=%q", resp.StatusCode, lines)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") || !strings.Contains(resp.Header.Get("Content-Disposition"), ".csv") {
+		t.Fatalf("csv headers = %v", resp.Header)
+	}
+	if resp.Trailer.Get("X-Export-Rows") != "5" || resp.Trailer.Get("X-Export-Truncated") != "false" {
+		t.Fatalf("csv trailers = %v", resp.Trailer)
+	}
+
+	// The project's limit is a daily budget: the export stops after the row
+	// that spends it and no other starts until the limit is raised; the
+	// cursor then picks up from there.
+	setLimit := func(n int) {
+		t.Helper()
+		status, body := testkit.DoJSON(t, client, http.MethodPut, fmt.Sprintf("%s/api/%d/quota", srv.HTTP.URL, boot.ProjectID),
+			map[string]any{"max_export_bytes": n}, map[string]string{"Authorization": "Bearer " + boot.Token})
+		if status != http.StatusOK {
+			t.Fatalf("quota: status=%d body=%s", status, body)
+		}
+	}
+	exported := func() int64 {
+		t.Helper()
+		var usage model.ProjectUsageDaily
+		if err := srv.DB.Where("project_id = ?", boot.ProjectID).First(&usage).Error; err != nil {
+			t.Fatalf("usage: %v", err)
+		}
+		return usage.ExportBytes
+	}
+	before := exported() // the CSV export counts too
+	setLimit(int(before) + 30)
+	params := url.Values{"columns": {"message"}}
+	resp, got := get(params)
+	if resp.StatusCode != http.StatusOK || len(got) != 2 || resp.Trailer.Get("X-Export-Truncated") != "true" || resp.Trailer.Get("X-Export-Cursor") == "" {
+		t.Fatalf("truncated: status=%d lines=%q trailers=%v", resp.StatusCode, got, resp.Trailer)
+	}
+	params.Set("cursor", resp.Trailer.Get("X-Export-Cursor"))
+	if resp, _ := get(params); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("over the daily limit: status=%d", resp.StatusCode)
+	}
+	if n := exported() - before; n != 34 {
+		t.Fatalf("exported %d bytes, want 34", n)
+	}
+	setLimit(int(before) + 1000)
+	resp, lines = get(params)
+	if resp.StatusCode != http.StatusOK || resp.Trailer.Get("X-Export-Truncated") != "false" {
+		t.Fatalf("resume: status=%d trailers=%v", resp.StatusCode, resp.Trailer)
+	}
+	got = append(got, lines...)
+	if len(got) != 5 || got[0] != `{"message":"m0"}` || got[4] != `{"message":"m4"}` {
+		t.Fatalf("resumed = %q", got)
+	}
+
+	for _, params := range []url.Values{
+		{"format": {"xml"}},
+		{"source": {"metrics"}},
+		{"start": {"yesterday"}},
+		{"cursor": {"!"}},
+	} {
+		if resp, _ := get(params); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: status=%d", params, resp.StatusCode)
+		}
+	}
+}
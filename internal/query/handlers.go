@@ -4,20 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aak1247/logtap/internal/artifact"
+	"github.com/aak1247/logtap/internal/cursor"
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/queryjob"
+	"github.com/aak1247/logtap/internal/store"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
-func GetEventHandler(db *gorm.DB) gin.HandlerFunc {
+// GetEventHandler returns an event's payload. With sym set, JavaScript
+// frames are symbolicated against the release's uploaded source maps; a
+// failure to do so is logged and the stored payload returned.
+func GetEventHandler(db *gorm.DB, sym *artifact.Symbolicator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if db == nil {
 			respondErr(c, http.StatusNotImplemented, "database not configured")
@@ -50,6 +58,19 @@ func GetEventHandler(db *gorm.DB) gin.HandlerFunc {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
+		if sym != nil {
+			var event map[string]any
+			if err := json.Unmarshal(e.Data, &event); err == nil {
+				changed, err := sym.Symbolicate(ctx, projectID, event)
+				if err != nil {
+					log.Printf("symbolicate event %s: %v", eid, err)
+				}
+				if changed {
+					respondOK(c, event)
+					return
+				}
+			}
+		}
 		respondOK(c, json.RawMessage(e.Data))
 	}
 }
@@ -66,6 +87,10 @@ func RecentEventsHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		limit := parseLimit(c.Query("limit"), 50, 500)
+		after, ok := parseCursor(c)
+		if !ok {
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
@@ -83,16 +108,22 @@ func RecentEventsHandler(db *gorm.DB) gin.HandlerFunc {
 			Title     string
 		}
 		var rows []dbRow
-		if err := db.WithContext(ctx).
+		qdb := db.WithContext(ctx).
 			Model(&model.Event{}).
 			Select("id, timestamp, level, title").
-			Where("project_id = ?", projectID).
-			Order("timestamp DESC").
-			Limit(limit).
+			Where("project_id = ?", projectID)
+		if err := after.Where(qdb, "timestamp", "id", false).
+			Order(cursor.Order("timestamp", "id", false)).
+			Limit(limit + 1).
 			Find(&rows).Error; err != nil {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
+		var next string
+		if len(rows) > limit {
+			rows = rows[:limit]
+			next = cursor.After(rows[limit-1].Timestamp, rows[limit-1].ID).String()
+		}
 		out := make([]row, 0, len(rows))
 		for _, r := range rows {
 			out = append(out, row{
@@ -102,11 +133,16 @@ func RecentEventsHandler(db *gorm.DB) gin.HandlerFunc {
 				Title:     r.Title,
 			})
 		}
-		respondOK(c, out)
+		respondPage(c, out, next)
 	}
 }
 
-func SearchLogsHandler(db *gorm.DB) gin.HandlerFunc {
+// SearchLogsHandler lists the logs matching q, trace_id, level and the
+// start/end range newest first. Pass next_cursor back as cursor= to page.
+// With async=1 the search runs as a query job (see submitJob) over slices of
+// the range, newest first, reporting the logs found so far; the job's
+// result is {"data":[...],"next_cursor":"..."}.
+func SearchLogsHandler(db *gorm.DB, jobs *queryjob.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if db == nil {
 			respondErr(c, http.StatusNotImplemented, "database not configured")
@@ -118,83 +154,179 @@ func SearchLogsHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		q := strings.TrimSpace(c.Query("q"))
-		mode := strings.ToLower(strings.TrimSpace(c.Query("mode")))
-		traceID := strings.TrimSpace(c.Query("trace_id"))
-		level := strings.TrimSpace(c.Query("level"))
-		start, _ := parseTime(c.Query("start"))
-		end, _ := parseTime(c.Query("end"))
-		limit := parseLimit(c.Query("limit"), 100, 500)
+		s := logSearch{
+			Q:       strings.TrimSpace(c.Query("q")),
+			Mode:    strings.ToLower(strings.TrimSpace(c.Query("mode"))),
+			TraceID: strings.TrimSpace(c.Query("trace_id")),
+			Level:   strings.TrimSpace(c.Query("level")),
+			Limit:   parseLimit(c.Query("limit"), 100, 500),
+			// archived=true searches rows restored via /archives/rehydrate. That
+			// table has no full-text index, so text matching falls back to LIKE.
+			Archived: c.Query("archived") == "true" || c.Query("archived") == "1",
+			Cursor:   c.Query("cursor"),
+		}
+		s.Start, _ = parseTime(c.Query("start"))
+		s.End, _ = parseTime(c.Query("end"))
+		after, ok := parseCursor(c)
+		if !ok {
+			return
+		}
+		s.after = after
+
+		if asyncRequested(c) {
+			submitJob(c, jobs, projectID, "logs.search", s, func(ctx context.Context, db *gorm.DB, report func(float64, any)) (any, error) {
+				out, next, err := s.run(ctx, db, projectID, report)
+				if err != nil {
+					return nil, err
+				}
+				page := gin.H{"data": out}
+				if next != "" {
+					page["next_cursor"] = next
+				}
+				return page, nil
+			})
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
-
-		qdb := db.WithContext(ctx).Model(&model.Log{}).Where("project_id = ?", projectID)
-		if !start.IsZero() {
-			qdb = qdb.Where("timestamp >= ?", start)
+		out, next, err := s.run(ctx, db, projectID, nil)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
 		}
-		if !end.IsZero() {
-			qdb = qdb.Where("timestamp <= ?", end)
+		respondPage(c, out, next)
+	}
+}
+
+// logSearchSlices is how many slices of the range an async log search
+// queries, each one reporting progress.
+const logSearchSlices = 8
+
+// logSearch is a parsed log search; its exported fields key the job cache.
+type logSearch struct {
+	Q        string    `json:"q,omitempty"`
+	Mode     string    `json:"mode,omitempty"`
+	TraceID  string    `json:"trace_id,omitempty"`
+	Level    string    `json:"level,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Limit    int       `json:"limit"`
+	Archived bool      `json:"archived,omitempty"`
+	Cursor   string    `json:"cursor,omitempty"`
+
+	after *cursor.Cursor
+}
+
+type logSearchRow struct {
+	ID        int64
+	Timestamp time.Time
+	Level     string
+	TraceID   string
+	SpanID    string
+	Message   string
+	Fields    datatypes.JSON
+}
+
+// run returns a page of matching logs and the cursor of the next. With
+// report set and a start given it queries the range in slices, newest
+// first, reporting the logs found after each.
+func (s logSearch) run(ctx context.Context, db *gorm.DB, projectID int, report func(float64, any)) ([]map[string]any, string, error) {
+	type window struct {
+		from, to time.Time
+		closed   bool // to is inclusive
+	}
+	windows := []window{{s.Start, s.End, true}}
+	if report != nil && !s.Start.IsZero() {
+		end := s.End
+		if end.IsZero() {
+			end = time.Now().UTC()
 		}
-		if traceID != "" {
-			qdb = qdb.Where("trace_id = ?", traceID)
+		if step := end.Sub(s.Start) / logSearchSlices; step > 0 {
+			windows = windows[:0]
+			for i := 0; i < logSearchSlices; i++ {
+				w := window{from: end.Add(-step * time.Duration(i+1)), to: end.Add(-step * time.Duration(i)), closed: i == 0}
+				if i == logSearchSlices-1 {
+					w.from = s.Start
+				}
+				windows = append(windows, w)
+			}
 		}
-		if level != "" {
-			qdb = qdb.Where("level = ?", level)
+	}
+
+	mode := s.Mode
+	var table any = &model.Log{}
+	if s.Archived {
+		table = &model.RehydratedLog{}
+		mode = "like"
+	}
+	var rows []logSearchRow
+	for i, w := range windows {
+		qdb := db.WithContext(ctx).Model(table).Where("project_id = ?", projectID)
+		if !w.from.IsZero() {
+			qdb = qdb.Where("timestamp >= ?", w.from)
 		}
-		if q != "" {
-			useFTS := (mode == "" || mode == "fts") && strings.EqualFold(db.Dialector.Name(), "postgres")
-			if useFTS {
-				qdb = qdb.Where(
-					"to_tsvector('simple', coalesce(message,'') || ' ' || coalesce(fields::text,'')) @@ plainto_tsquery('simple', ?)",
-					q,
-				)
+		if !w.to.IsZero() {
+			if w.closed {
+				qdb = qdb.Where("timestamp <= ?", w.to)
 			} else {
-				pat := "%" + q + "%"
-				qdb = qdb.Where(db.Where("message ILIKE ?", pat).Or("fields::text ILIKE ?", pat))
+				qdb = qdb.Where("timestamp < ?", w.to)
 			}
 		}
-
-		type row struct {
-			ID        int64
-			Timestamp time.Time
-			Level     string
-			TraceID   string
-			SpanID    string
-			Message   string
-			Fields    datatypes.JSON
+		if s.TraceID != "" {
+			qdb = qdb.Where("trace_id = ?", s.TraceID)
+		}
+		if s.Level != "" {
+			qdb = qdb.Where("level = ?", s.Level)
 		}
-		var rows []row
-		if err := qdb.
+		if s.Q != "" {
+			qdb = store.WhereLogText(qdb, db, s.Q, mode)
+		}
+		var got []logSearchRow
+		if err := s.after.Where(qdb, "timestamp", "id", false).
 			Select("id, timestamp, level, trace_id, span_id, message, fields").
-			Order("timestamp DESC").
-			Limit(limit).
-			Find(&rows).Error; err != nil {
-			respondErr(c, http.StatusServiceUnavailable, err.Error())
-			return
+			Order(cursor.Order("timestamp", "id", false)).
+			Limit(s.Limit + 1 - len(rows)).
+			Find(&got).Error; err != nil {
+			return nil, "", err
 		}
+		rows = append(rows, got...)
+		if len(rows) > s.Limit {
+			break
+		}
+		if report != nil && i < len(windows)-1 {
+			report(float64(i+1)/float64(len(windows)), logSearchEntries(rows))
+		}
+	}
+	var next string
+	if len(rows) > s.Limit {
+		rows = rows[:s.Limit]
+		next = cursor.After(rows[s.Limit-1].Timestamp, rows[s.Limit-1].ID).String()
+	}
+	return logSearchEntries(rows), next, nil
+}
 
-		out := make([]map[string]any, 0, len(rows))
-		for _, r := range rows {
-			entry := map[string]any{
-				"id":        r.ID,
-				"timestamp": r.Timestamp,
-				"level":     r.Level,
-				"trace_id":  r.TraceID,
-				"span_id":   r.SpanID,
-				"message":   r.Message,
-			}
-			if len(r.Fields) > 0 && string(r.Fields) != "null" && string(r.Fields) != "{}" {
-				var fields map[string]any
-				_ = json.Unmarshal(r.Fields, &fields)
-				if len(fields) > 0 {
-					entry["fields"] = fields
-				}
+func logSearchEntries(rows []logSearchRow) []map[string]any {
+	out := make([]map[string]any, 0, len(rows))
+	for _, r := range rows {
+		entry := map[string]any{
+			"id":        r.ID,
+			"timestamp": r.Timestamp,
+			"level":     r.Level,
+			"trace_id":  r.TraceID,
+			"span_id":   r.SpanID,
+			"message":   r.Message,
+		}
+		if len(r.Fields) > 0 && string(r.Fields) != "null" && string(r.Fields) != "{}" {
+			var fields map[string]any
+			_ = json.Unmarshal(r.Fields, &fields)
+			if len(fields) > 0 {
+				entry["fields"] = fields
 			}
-			out = append(out, entry)
 		}
-		respondOK(c, out)
+		out = append(out, entry)
 	}
+	return out
 }
 
 func parseTime(s string) (time.Time, bool) {
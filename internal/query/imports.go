@@ -0,0 +1,194 @@
+package query
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/archive"
+	"github.com/aak1247/logtap/internal/artifact"
+	"github.com/aak1247/logtap/internal/importer"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListImportsHandler lists the project's latest imports.
+func ListImportsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var items []model.ImportJob
+		if err := db.WithContext(ctx).
+			Where("project_id = ?", projectID).
+			Order("id DESC").
+			Limit(parseLimit(c.Query("limit"), 50, 200)).
+			Find(&items).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"items": items})
+	}
+}
+
+// CreateImportHandler creates an import of one kind; data is then uploaded
+// to it with UploadImportHandler.
+func CreateImportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		uid := userIDFromGin(c)
+		if uid <= 0 {
+			respondErr(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var req struct {
+			Kind string `json:"kind"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		kind := strings.ToLower(strings.TrimSpace(req.Kind))
+		if !importer.ValidKind(kind) {
+			respondErr(c, http.StatusBadRequest, importer.ErrInvalidKind.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		row := model.ImportJob{
+			ProjectID: projectID,
+			UserID:    uid,
+			Kind:      kind,
+			Status:    importer.StatusPending,
+			Errors:    []byte("[]"),
+		}
+		if err := db.WithContext(ctx).Create(&row).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+// GetImportHandler returns an import with its progress.
+func GetImportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		row, ok := loadImport(ctx, c, db)
+		if !ok {
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+// UploadImportHandler imports the NDJSON request body (gzip when sent with
+// Content-Encoding: gzip) as the next part of an import and returns the job
+// once the part is done. One part of an import runs at a time; its progress
+// can be followed with GetImportHandler meanwhile. Stack traces are
+// deobfuscated with the mappings in objects, as on ingest.
+func UploadImportHandler(db *gorm.DB, objects archive.ObjectStore) gin.HandlerFunc {
+	deob := artifact.NewDeobfuscator(db, objects)
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		job, ok := loadImport(lookupCtx, c, db)
+		cancel()
+		if !ok {
+			return
+		}
+
+		var body io.Reader = c.Request.Body
+		if strings.EqualFold(strings.TrimSpace(c.GetHeader("Content-Encoding")), "gzip") {
+			zr, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				respondErr(c, http.StatusBadRequest, "invalid gzip body: "+err.Error())
+				return
+			}
+			defer zr.Close()
+			body = zr
+		}
+
+		im := importer.New(db)
+		im.Deobfuscator = deob
+		job, err := im.Begin(ctx, job)
+		if err != nil {
+			if errors.Is(err, importer.ErrBusy) {
+				respondErr(c, http.StatusConflict, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		job, err = im.Import(ctx, job, body)
+		if err != nil {
+			if errors.Is(err, importer.ErrInput) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			if errors.Is(err, importer.ErrQuota) {
+				c.Header("Retry-After", "60")
+				respondErr(c, http.StatusTooManyRequests, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, job)
+	}
+}
+
+func loadImport(ctx context.Context, c *gin.Context, db *gorm.DB) (model.ImportJob, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return model.ImportJob{}, false
+	}
+	projectID, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return model.ImportJob{}, false
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(c.Param("importId")))
+	if err != nil || id <= 0 {
+		respondErr(c, http.StatusBadRequest, "invalid importId")
+		return model.ImportJob{}, false
+	}
+	var row model.ImportJob
+	if err := db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, id).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondErr(c, http.StatusNotFound, "not found")
+			return model.ImportJob{}, false
+		}
+		respondErr(c, http.StatusServiceUnavailable, err.Error())
+		return model.ImportJob{}, false
+	}
+	return row, true
+}
@@ -0,0 +1,97 @@
+package query_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestImports(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	base := fmt.Sprintf("%s/api/%d/imports", srv.HTTP.URL, boot.ProjectID)
+	auth := map[string]string{"Authorization": "Bearer " + boot.Token}
+
+	status, body := testkit.DoJSON(t, client, http.MethodPost, base, map[string]any{"kind": "metrics"}, auth)
+	if status != http.StatusBadRequest {
+		t.Fatalf("invalid kind: status=%d body=%s", status, body)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodPost, base, map[string]any{"kind": "logs"}, auth)
+	if status != http.StatusOK {
+		t.Fatalf("create: status=%d body=%s", status, body)
+	}
+	var job model.ImportJob
+	if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &job); err != nil || job.ID == 0 || job.Status != "pending" {
+		t.Fatalf("created = %+v (%v)", job, err)
+	}
+
+	upload := func(data []byte, gz bool) (int, model.ImportJob) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%d/data", base, job.ID), bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+boot.Token)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		if gz {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		var got model.ImportJob
+		if resp.StatusCode == http.StatusOK {
+			json.Unmarshal(testkit.DecodeEnvelope(t, raw).Data, &got)
+		}
+		return resp.StatusCode, got
+	}
+
+	data := []byte(`{"message":"old","timestamp":"2023-07-01T00:00:00Z","ingest_id":"a"}
+{"message":"older","timestamp":"2023-06-01T00:00:00Z","ingest_id":"b"}
+`)
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(data)
+	zw.Close()
+	status, got := upload(zipped.Bytes(), true)
+	if status != http.StatusOK || got.Status != "done" || got.Imported != 2 {
+		t.Fatalf("upload: status=%d job=%+v", status, got)
+	}
+	status, got = upload(data, false)
+	if status != http.StatusOK || got.Imported != 2 || got.Duplicates != 2 || got.Parts != 2 {
+		t.Fatalf("re-upload: status=%d job=%+v", status, got)
+	}
+	if status, _ := upload([]byte("not gzip"), true); status != http.StatusBadRequest {
+		t.Fatalf("bad gzip: status=%d", status)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/%d", base, job.ID), nil, auth)
+	if status != http.StatusOK {
+		t.Fatalf("get: status=%d body=%s", status, body)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodGet, base+"/999", nil, auth)
+	if status != http.StatusNotFound {
+		t.Fatalf("get missing: status=%d body=%s", status, body)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodGet, base, nil, auth)
+	var list struct {
+		Items []model.ImportJob `json:"items"`
+	}
+	if status != http.StatusOK || json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &list) != nil || len(list.Items) != 1 {
+		t.Fatalf("list: status=%d body=%s", status, body)
+	}
+
+	var n int64
+	srv.DB.Model(&model.Log{}).Where("project_id = ?", boot.ProjectID).Count(&n)
+	if n != 2 {
+		t.Fatalf("logs = %d", n)
+	}
+}
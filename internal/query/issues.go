@@ -0,0 +1,256 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListIssuesHandler lists the project's issues. Query params: q (title or
+// culprit substring), level, status, assignee (user id), first_release
+// (issues introduced in that release), sort (last_seen|first_seen|count|users),
+// limit, offset.
+func ListIssuesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		offset, _ := strconv.Atoi(strings.TrimSpace(c.Query("offset")))
+		if offset < 0 {
+			offset = 0
+		}
+		assignee, _ := strconv.ParseInt(strings.TrimSpace(c.Query("assignee")), 10, 64)
+		f := store.IssueFilter{
+			Query:          strings.TrimSpace(c.Query("q")),
+			Level:          strings.TrimSpace(c.Query("level")),
+			Status:         strings.ToLower(strings.TrimSpace(c.Query("status"))),
+			AssigneeUserID: assignee,
+			FirstRelease:   strings.TrimSpace(c.Query("first_release")),
+			Sort:           strings.ToLower(strings.TrimSpace(c.Query("sort"))),
+			Limit:          parseLimit(c.Query("limit"), 50, 200),
+			Offset:         offset,
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.ListIssues(ctx, db, projectID, f)
+		if err != nil {
+			if errors.Is(err, store.ErrInvalidIssueSort) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, rows)
+	}
+}
+
+// GetIssueHandler returns the issue with the payload of its latest event.
+func GetIssueHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		issue, ok := loadIssue(c, db)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		out := gin.H{"issue": issue}
+		var e model.Event
+		err := db.WithContext(ctx).
+			Select("data").
+			Where("project_id = ? AND id = ?", issue.ProjectID, issue.LastEventID).
+			First(&e).Error
+		switch {
+		case err == nil:
+			out["latest_event"] = json.RawMessage(e.Data)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, out)
+	}
+}
+
+// ListIssueEventsHandler lists the issue's events newest first. Pass the last
+// timestamp seen as before= to page.
+func ListIssueEventsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		issue, ok := loadIssue(c, db)
+		if !ok {
+			return
+		}
+		before, _ := parseTime(c.Query("before"))
+		limit := parseLimit(c.Query("limit"), 50, 500)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.ListIssueEvents(ctx, db, issue, before, limit)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		type row struct {
+			ID         string    `json:"id"`
+			Timestamp  time.Time `json:"timestamp"`
+			Level      string    `json:"level,omitempty"`
+			Title      string    `json:"title,omitempty"`
+			DistinctID string    `json:"distinct_id,omitempty"`
+			ReleaseTag string    `json:"release,omitempty"`
+		}
+		out := make([]row, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, row{
+				ID:         r.ID.String(),
+				Timestamp:  r.Timestamp,
+				Level:      r.Level,
+				Title:      r.Title,
+				DistinctID: r.DistinctID,
+				ReleaseTag: r.ReleaseTag,
+			})
+		}
+		respondOK(c, out)
+	}
+}
+
+// UpdateIssueHandler changes an issue's status and/or assignee. Body:
+// {"status": "...", "ignore_minutes": n, "ignore_count": n, "ignore_users": n,
+// "assignee_user_id": id|null}. The ignore_* thresholds only apply with
+// status "ignored"; a present assignee_user_id of null unassigns.
+func UpdateIssueHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		issue, ok := loadIssue(c, db)
+		if !ok {
+			return
+		}
+		var req struct {
+			Status        *string         `json:"status"`
+			IgnoreMinutes int64           `json:"ignore_minutes"`
+			IgnoreCount   int64           `json:"ignore_count"`
+			IgnoreUsers   int64           `json:"ignore_users"`
+			Assignee      json.RawMessage `json:"assignee_user_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.IgnoreMinutes < 0 || req.IgnoreCount < 0 || req.IgnoreUsers < 0 {
+			respondErr(c, http.StatusBadRequest, "ignore thresholds must be >= 0")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		u := store.IssueUpdate{
+			IgnoreDuration: time.Duration(req.IgnoreMinutes) * time.Minute,
+			IgnoreCount:    req.IgnoreCount,
+			IgnoreUsers:    req.IgnoreUsers,
+		}
+		if req.Status != nil {
+			st := strings.ToLower(strings.TrimSpace(*req.Status))
+			u.Status = &st
+		}
+		if len(req.Assignee) > 0 {
+			u.SetAssignee = true
+			if string(req.Assignee) != "null" {
+				var uid int64
+				if err := json.Unmarshal(req.Assignee, &uid); err != nil || uid <= 0 {
+					respondErr(c, http.StatusBadRequest, "invalid assignee_user_id")
+					return
+				}
+				if _, found, err := store.GetUserByID(ctx, db, uid); err != nil {
+					respondErr(c, http.StatusServiceUnavailable, err.Error())
+					return
+				} else if !found {
+					respondErr(c, http.StatusBadRequest, "assignee not found")
+					return
+				}
+				u.AssigneeUserID = &uid
+			}
+		}
+
+		saved, err := store.UpdateIssue(ctx, db, issue, u, userIDFromGin(c))
+		if err != nil {
+			if errors.Is(err, store.ErrInvalidIssueStatus) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, saved)
+	}
+}
+
+// ListIssueActivityHandler returns the issue's history, oldest first.
+func ListIssueActivityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		issue, ok := loadIssue(c, db)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.ListIssueActivity(ctx, db, issue)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, rows)
+	}
+}
+
+// loadIssue resolves :projectId/:issueId, responding itself on failure.
+func loadIssue(c *gin.Context, db *gorm.DB) (model.Issue, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return model.Issue{}, false
+	}
+	projectID, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return model.Issue{}, false
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("issueId")), 10, 64)
+	if err != nil || id <= 0 {
+		respondErr(c, http.StatusBadRequest, "invalid issueId")
+		return model.Issue{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	issue, ok, err := store.GetIssue(ctx, db, projectID, id)
+	if err != nil {
+		respondErr(c, http.StatusServiceUnavailable, err.Error())
+		return model.Issue{}, false
+	}
+	if !ok {
+		respondErr(c, http.StatusNotFound, "not found")
+		return model.Issue{}, false
+	}
+	return issue, true
+}
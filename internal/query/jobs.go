@@ -0,0 +1,99 @@
+package query
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/queryjob"
+	"github.com/gin-gonic/gin"
+)
+
+// asyncRequested reports whether the caller asked, with async=1, for the
+// query to run as a job instead of within the request.
+func asyncRequested(c *gin.Context) bool {
+	v := strings.ToLower(strings.TrimSpace(c.Query("async")))
+	return v == "1" || v == "true"
+}
+
+// submitJob queues run as a job of kind keyed by req and responds with it:
+// 202 while it is queued or running, 200 when a cached result finished it.
+// Poll GET /api/:projectId/jobs/:jobId for its progress and result.
+func submitJob(c *gin.Context, jobs *queryjob.Manager, projectID int, kind string, req any, run queryjob.Func) {
+	if jobs == nil {
+		respondErr(c, http.StatusNotImplemented, "query jobs not configured")
+		return
+	}
+	job, err := jobs.Submit(projectID, kind, queryjob.Key(kind, projectID, req), run)
+	respondJob(c, job, job, err)
+}
+
+// respondJob responds with data for a submitted job: 202 while the job is
+// queued or running, 200 once it is done.
+func respondJob(c *gin.Context, job queryjob.Job, data any, err error) {
+	if err != nil {
+		if errors.Is(err, queryjob.ErrQueueFull) {
+			respondErr(c, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		respondErr(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	status := http.StatusAccepted
+	if job.Status.Done() {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"code": 0, "data": data})
+}
+
+// GetQueryJobHandler returns a query job: its status, progress, partial
+// result while it runs and result once it succeeded.
+func GetQueryJobHandler(jobs *queryjob.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if jobs == nil {
+			respondErr(c, http.StatusNotImplemented, "query jobs not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		job, err := jobs.Get(c.Request.Context(), projectID, c.Param("jobId"))
+		if err != nil {
+			if errors.Is(err, queryjob.ErrNotFound) {
+				respondErr(c, http.StatusNotFound, "not found")
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, job)
+	}
+}
+
+// CancelQueryJobHandler cancels a queued or running query job.
+func CancelQueryJobHandler(jobs *queryjob.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if jobs == nil {
+			respondErr(c, http.StatusNotImplemented, "query jobs not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		job, err := jobs.Cancel(c.Request.Context(), projectID, c.Param("jobId"))
+		if err != nil {
+			if errors.Is(err, queryjob.ErrNotFound) {
+				respondErr(c, http.StatusNotFound, "not found")
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, job)
+	}
+}
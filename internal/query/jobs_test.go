@@ -0,0 +1,95 @@
+package query_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+type queryJob struct {
+	ID       string          `json:"id"`
+	Status   string          `json:"status"`
+	Progress float64         `json:"progress"`
+	Cached   bool            `json:"cached"`
+	Error    string          `json:"error"`
+	Result   json.RawMessage `json:"result"`
+}
+
+func TestQueryJobs_AsyncSearchPollAndCache(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+
+	now := time.Now().UTC()
+	var rows []model.Log
+	for i := 0; i < 5; i++ {
+		rows = append(rows, model.Log{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Duration(i+1) * time.Hour), Level: "info", Message: fmt.Sprintf("slow query %d", i)})
+	}
+	if err := srv.DB.Create(&rows).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	base := fmt.Sprintf("%s/api/%d", srv.HTTP.URL, boot.ProjectID)
+	search := base + "/logs/search?async=1&limit=3&start=" + url.QueryEscape(now.Add(-24*time.Hour).Format(time.RFC3339)) + "&end=" + url.QueryEscape(now.Format(time.RFC3339))
+	status, body := testkit.DoJSON(t, client, http.MethodGet, search, nil, headers)
+	if status != http.StatusAccepted && status != http.StatusOK {
+		t.Fatalf("submit: status=%d body=%s", status, body)
+	}
+	var job queryJob
+	if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &job); err != nil || job.ID == "" {
+		t.Fatalf("decode job: %v body=%s", err, body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != "succeeded" {
+		if job.Status == "failed" || job.Status == "canceled" || time.Now().After(deadline) {
+			t.Fatalf("job = %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		status, body = testkit.DoJSON(t, client, http.MethodGet, base+"/jobs/"+job.ID, nil, headers)
+		if status != http.StatusOK {
+			t.Fatalf("poll: status=%d body=%s", status, body)
+		}
+		if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &job); err != nil {
+			t.Fatalf("decode job: %v", err)
+		}
+	}
+	var page struct {
+		Data       []map[string]any `json:"data"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(job.Result, &page); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if len(page.Data) != 3 || page.Data[0]["message"] != "slow query 0" || page.Data[2]["message"] != "slow query 2" || page.NextCursor == "" {
+		t.Fatalf("result = %+v", page)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodGet, search, nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("resubmit: status=%d body=%s", status, body)
+	}
+	var again queryJob
+	if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &again); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	if !again.Cached || again.Status != "succeeded" || string(again.Result) != string(job.Result) {
+		t.Fatalf("resubmitted job = %+v", again)
+	}
+
+	status, _ = testkit.DoJSON(t, client, http.MethodPost, base+"/query?async=1", map[string]any{"q": "| stats count() as n"}, headers)
+	if status != http.StatusAccepted && status != http.StatusOK {
+		t.Fatalf("submit query: status=%d", status)
+	}
+	status, _ = testkit.DoJSON(t, client, http.MethodDelete, base+"/jobs/missing", nil, headers)
+	if status != http.StatusNotFound {
+		t.Fatalf("cancel missing: status=%d", status)
+	}
+}
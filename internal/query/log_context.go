@@ -0,0 +1,346 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/cursor"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/search"
+	searchpostgres "github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Context seeks stay within this much time on each side of the anchor so a
+// rare by value cannot scan a project's whole history.
+const (
+	defaultContextWindow = 24 * time.Hour
+	maxContextWindow     = 7 * 24 * time.Hour
+)
+
+type contextLog struct {
+	ID         int64           `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Level      string          `json:"level,omitempty"`
+	TraceID    string          `json:"trace_id,omitempty"`
+	SpanID     string          `json:"span_id,omitempty"`
+	DistinctID string          `json:"distinct_id,omitempty"`
+	DeviceID   string          `json:"device_id,omitempty"`
+	PatternID  string          `json:"pattern_id,omitempty"`
+	Message    string          `json:"message"`
+	Fields     json.RawMessage `json:"fields,omitempty"`
+}
+
+func contextLogFrom(l model.Log) contextLog {
+	out := contextLog{
+		ID:         l.ID,
+		Timestamp:  l.Timestamp,
+		Level:      l.Level,
+		TraceID:    l.TraceID,
+		SpanID:     l.SpanID,
+		DistinctID: l.DistinctID,
+		DeviceID:   l.DeviceID,
+		PatternID:  l.PatternID,
+		Message:    l.Message,
+	}
+	if s := string(l.Fields); s != "" && s != "null" && s != "{}" {
+		out.Fields = json.RawMessage(l.Fields)
+	}
+	return out
+}
+
+// contextParams are the before, after and window parameters.
+type contextParams struct {
+	before, after int
+	window        time.Duration
+}
+
+func parseContextParams(c *gin.Context) (contextParams, bool) {
+	p := contextParams{
+		before: parseCount(c.Query("before"), 50, 500),
+		after:  parseCount(c.Query("after"), 50, 500),
+		window: defaultContextWindow,
+	}
+	if raw := strings.TrimSpace(c.Query("window")); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			respondErr(c, http.StatusBadRequest, "invalid window")
+			return p, false
+		}
+		p.window = min(d, maxContextWindow)
+	}
+	return p, true
+}
+
+// parseCount is parseLimit that also accepts 0.
+func parseCount(s string, def, max int) int {
+	if strings.TrimSpace(s) == "0" {
+		return 0
+	}
+	return parseLimit(s, def, max)
+}
+
+// LogContextHandler returns the logs around a log: ?before=50&after=50 lines
+// of the project, or only those sharing the log's value of by (device_id,
+// trace_id, distinct_id, or any search field such as fields.host).
+func LogContextHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+		if err != nil || id <= 0 {
+			respondErr(c, http.StatusBadRequest, "invalid log id")
+			return
+		}
+		p, ok := parseContextParams(c)
+		if !ok {
+			return
+		}
+		by := strings.TrimSpace(c.Query("by"))
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var anchor model.Log
+		if err := db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, id).First(&anchor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondErr(c, http.StatusNotFound, "not found")
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		value := ""
+		if by != "" {
+			if value, ok = logValue(anchor, by); !ok {
+				respondErr(c, http.StatusBadRequest, "the log has no "+by)
+				return
+			}
+		}
+
+		out, err := logsAround(ctx, db, projectID, cursor.After(anchor.Timestamp, anchor.ID), by, value, p)
+		if err != nil {
+			if errors.Is(err, search.ErrInvalidQuery) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		out["anchor"] = contextLogFrom(anchor)
+		respondOK(c, out)
+	}
+}
+
+// EventContextHandler returns the logs around a Sentry event sharing its
+// device_id (the default), distinct_id or trace_id; by=none takes all of the
+// project's logs.
+func EventContextHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		eid, err := uuid.Parse(strings.TrimSpace(c.Param("eventId")))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, "invalid eventId")
+			return
+		}
+		p, ok := parseContextParams(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var e model.Event
+		if err := db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, eid).First(&e).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondErr(c, http.StatusNotFound, "not found")
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		values := map[string]string{
+			"device_id":   e.DeviceID,
+			"distinct_id": e.DistinctID,
+			"trace_id":    eventTraceID(e.Data),
+		}
+		by := strings.TrimSpace(c.Query("by"))
+		switch by {
+		case "":
+			for _, k := range []string{"device_id", "distinct_id"} {
+				if values[k] != "" {
+					by = k
+					break
+				}
+			}
+		case "none":
+			by = ""
+		case "device_id", "distinct_id", "trace_id":
+			if values[by] == "" {
+				respondErr(c, http.StatusBadRequest, "the event has no "+by)
+				return
+			}
+		default:
+			respondErr(c, http.StatusBadRequest, "invalid by (expected device_id|distinct_id|trace_id|none)")
+			return
+		}
+
+		// Logs at the event's timestamp count as before it.
+		out, err := logsAround(ctx, db, projectID, &cursor.Cursor{Time: e.Timestamp, ID: strconv.FormatInt(math.MaxInt64, 10)}, by, values[by], p)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		out["anchor"] = gin.H{
+			"id":        e.ID.String(),
+			"timestamp": e.Timestamp,
+			"level":     e.Level,
+			"title":     e.Title,
+		}
+		respondOK(c, out)
+	}
+}
+
+// logsAround reads up to p.before logs preceding at and p.after logs
+// following it within p.window, optionally only those whose by equals
+// value. Both are keyset seeks on (project_id, timestamp); before is
+// returned oldest first.
+func logsAround(ctx context.Context, db *gorm.DB, projectID int, at *cursor.Cursor, by, value string, p contextParams) (gin.H, error) {
+	base := func() (*gorm.DB, error) {
+		qdb := db.WithContext(ctx).Model(&model.Log{}).
+			Where("project_id = ? AND timestamp >= ? AND timestamp <= ?", projectID, at.Time.Add(-p.window), at.Time.Add(p.window))
+		if by == "" {
+			return qdb, nil
+		}
+		return searchpostgres.NewAdapter(db).Where(qdb, search.Term{Field: by, Value: value})
+	}
+	seek := func(n int, asc bool) ([]contextLog, bool, error) {
+		if n == 0 {
+			return []contextLog{}, false, nil
+		}
+		qdb, err := base()
+		if err != nil {
+			return nil, false, err
+		}
+		var rows []model.Log
+		if err := at.Where(qdb, "timestamp", "id", asc).
+			Order(cursor.Order("timestamp", "id", asc)).
+			Limit(n + 1).
+			Find(&rows).Error; err != nil {
+			return nil, false, err
+		}
+		more := len(rows) > n
+		if more {
+			rows = rows[:n]
+		}
+		out := make([]contextLog, len(rows))
+		for i, r := range rows {
+			if asc {
+				out[i] = contextLogFrom(r)
+			} else {
+				out[len(rows)-1-i] = contextLogFrom(r)
+			}
+		}
+		return out, more, nil
+	}
+
+	before, moreBefore, err := seek(p.before, false)
+	if err != nil {
+		return nil, err
+	}
+	after, moreAfter, err := seek(p.after, true)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"by":          by,
+		"value":       value,
+		"before":      before,
+		"after":       after,
+		"more_before": moreBefore,
+		"more_after":  moreAfter,
+	}, nil
+}
+
+// logValue is the log's value of a search field as the search compares it.
+func logValue(l model.Log, by string) (string, bool) {
+	var v string
+	switch strings.ToLower(by) {
+	case "level":
+		v = l.Level
+	case "message":
+		v = l.Message
+	case "trace_id", "traceid":
+		v = l.TraceID
+	case "span_id", "spanid":
+		v = l.SpanID
+	case "distinct_id":
+		v = l.DistinctID
+	case "device_id":
+		v = l.DeviceID
+	case "pattern_id":
+		v = l.PatternID
+	default:
+		var cur any
+		if err := json.Unmarshal(l.Fields, &cur); err != nil {
+			return "", false
+		}
+		for _, seg := range strings.Split(strings.TrimPrefix(by, "fields."), ".") {
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return "", false
+			}
+			cur = m[seg]
+		}
+		switch t := cur.(type) {
+		case string:
+			v = t
+		case float64:
+			v = strconv.FormatFloat(t, 'f', -1, 64)
+		case bool:
+			v = strconv.FormatBool(t)
+		default:
+			return "", false
+		}
+	}
+	return v, v != ""
+}
+
+// eventTraceID is the trace id of a Sentry event's trace context.
+func eventTraceID(data []byte) string {
+	var e struct {
+		Contexts struct {
+			Trace struct {
+				TraceID string `json:"trace_id"`
+			} `json:"trace"`
+		} `json:"contexts"`
+	}
+	_ = json.Unmarshal(data, &e)
+	return e.Contexts.Trace.TraceID
+}
@@ -0,0 +1,104 @@
+package query_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+	"github.com/google/uuid"
+)
+
+type contextPayload struct {
+	By         string `json:"by"`
+	Value      string `json:"value"`
+	Before     []struct{ Message string }
+	After      []struct{ Message string }
+	MoreBefore bool `json:"more_before"`
+	MoreAfter  bool `json:"more_after"`
+}
+
+func messagesOf(rows []struct{ Message string }) string {
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.Message)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestLogContext(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var logs []model.Log
+	for i := 0; i < 10; i++ {
+		device, host := "a", "web-1"
+		if i%2 == 1 {
+			device, host = "b", "web-2"
+		}
+		logs = append(logs, model.Log{
+			ProjectID: boot.ProjectID,
+			Timestamp: now.Add(time.Duration(i/2) * time.Second), // pairs share a timestamp
+			Level:     "info",
+			DeviceID:  device,
+			Message:   fmt.Sprintf("%s%d", device, i),
+			Fields:    []byte(fmt.Sprintf(`{"host":%q}`, host)),
+		})
+	}
+	logs = append(logs, model.Log{ProjectID: boot.ProjectID, Timestamp: now.Add(-48 * time.Hour), Level: "info", DeviceID: "a", Message: "old", Fields: []byte(`{}`)})
+	if err := srv.DB.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	event := model.Event{ID: uuid.New(), ProjectID: boot.ProjectID, Timestamp: now.Add(2 * time.Second), Level: "error", Title: "boom", DeviceID: "b", Data: []byte(`{"contexts":{"trace":{"trace_id":"t1"}}}`)}
+	if err := srv.DB.Create(&event).Error; err != nil {
+		t.Fatalf("create event: %v", err)
+	}
+
+	get := func(path string, wantStatus int) contextPayload {
+		t.Helper()
+		status, body := testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/api/%d/%s", srv.HTTP.URL, boot.ProjectID, path), nil, headers)
+		if status != wantStatus {
+			t.Fatalf("%s: status=%d body=%s", path, status, body)
+		}
+		var out contextPayload
+		if status == http.StatusOK {
+			if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &out); err != nil {
+				t.Fatalf("%s: data: %v", path, err)
+			}
+		}
+		return out
+	}
+
+	anchor := logs[4] // a4
+	res := get(fmt.Sprintf("logs/%d/context?before=3&after=2", anchor.ID), http.StatusOK)
+	if got := messagesOf(res.Before); got != "[b1 a2 b3]" || !res.MoreBefore {
+		t.Fatalf("before = %s more=%v", got, res.MoreBefore)
+	}
+	if got := messagesOf(res.After); got != "[b5 a6]" || !res.MoreAfter {
+		t.Fatalf("after = %s more=%v", got, res.MoreAfter)
+	}
+
+	res = get(fmt.Sprintf("logs/%d/context?by=device_id", anchor.ID), http.StatusOK)
+	if res.Value != "a" || messagesOf(res.Before) != "[a0 a2]" || messagesOf(res.After) != "[a6 a8]" || res.MoreBefore || res.MoreAfter {
+		t.Fatalf("by device: %+v", res)
+	}
+	res = get(fmt.Sprintf("logs/%d/context?by=fields.host&before=1&window=72h", anchor.ID), http.StatusOK)
+	if res.Value != "web-1" || messagesOf(res.Before) != "[a2]" || !res.MoreBefore {
+		t.Fatalf("by host: %+v", res)
+	}
+	get(fmt.Sprintf("logs/%d/context?by=trace_id", anchor.ID), http.StatusBadRequest)
+	get("logs/999999/context", http.StatusNotFound)
+
+	res = get(fmt.Sprintf("events/%s/context?before=2&after=1", event.ID), http.StatusOK)
+	if res.By != "device_id" || messagesOf(res.Before) != "[b3 b5]" || messagesOf(res.After) != "[b7]" {
+		t.Fatalf("event context: %+v", res)
+	}
+	get(fmt.Sprintf("events/%s/context?by=trace_id", event.ID), http.StatusOK)
+	get(fmt.Sprintf("events/%s/context?by=fields.host", event.ID), http.StatusBadRequest)
+}
@@ -0,0 +1,296 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/logmetric"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type logMetricRequest struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Query       *string   `json:"query"`
+	Aggregation *string   `json:"aggregation"`
+	Field       *string   `json:"field"`
+	GroupBy     *[]string `json:"group_by"`
+	IntervalSec *int      `json:"interval_sec"`
+	Enabled     *bool     `json:"enabled"`
+}
+
+// maxSeriesBuckets bounds the buckets a series request may span.
+const maxSeriesBuckets = 10000
+
+// apply sets the fields given in req on m and returns the changed columns,
+// and whether the change invalidates the points rolled up so far.
+func (req logMetricRequest) apply(m *model.LogMetric) (map[string]any, bool) {
+	updates := map[string]any{}
+	reset := false
+	set := func(dst *string, v *string, col string, resets bool) {
+		if v == nil || strings.TrimSpace(*v) == *dst {
+			return
+		}
+		*dst = strings.TrimSpace(*v)
+		updates[col] = *dst
+		reset = reset || resets
+	}
+	set(&m.Name, req.Name, "name", false)
+	set(&m.Description, req.Description, "description", false)
+	set(&m.Query, req.Query, "query", true)
+	set(&m.Aggregation, req.Aggregation, "aggregation", true)
+	set(&m.Field, req.Field, "field", true)
+	if req.GroupBy != nil {
+		groupBy := make([]string, 0, len(*req.GroupBy))
+		for _, g := range *req.GroupBy {
+			if g = strings.TrimSpace(g); g != "" {
+				groupBy = append(groupBy, g)
+			}
+		}
+		b, _ := json.Marshal(groupBy)
+		if string(b) != string(m.GroupBy) {
+			m.GroupBy = b
+			updates["group_by"] = m.GroupBy
+			reset = true
+		}
+	}
+	if req.IntervalSec != nil && *req.IntervalSec != m.IntervalSec {
+		m.IntervalSec = *req.IntervalSec
+		updates["interval_sec"] = m.IntervalSec
+		reset = true
+	}
+	if req.Enabled != nil && *req.Enabled != m.Enabled {
+		m.Enabled = *req.Enabled
+		updates["enabled"] = m.Enabled
+	}
+	return updates, reset
+}
+
+func ListLogMetricsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		pid, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		items, err := store.ListLogMetrics(ctx, db, pid)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"items": items})
+	}
+}
+
+// CreateLogMetricHandler defines a metric; aggregation defaults to count and
+// interval_sec to 60.
+func CreateLogMetricHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		pid, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var req logMetricRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		row := model.LogMetric{
+			ProjectID:   pid,
+			Aggregation: logmetric.Count,
+			GroupBy:     []byte("[]"),
+			IntervalSec: 60,
+			Enabled:     true,
+		}
+		req.apply(&row)
+		if err := logmetric.Validate(row); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		if _, found, err := store.GetLogMetricByName(ctx, db, pid, row.Name); err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		} else if found {
+			respondErr(c, http.StatusConflict, "metric already exists")
+			return
+		}
+		if err := db.WithContext(ctx).Create(&row).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+func GetLogMetricHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		row, ok := loadLogMetric(ctx, c, db)
+		if !ok {
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+// UpdateLogMetricHandler changes the fields given. Changing what the metric
+// measures (query, aggregation, field, group_by, interval_sec) drops its
+// points and rolls it up again.
+func UpdateLogMetricHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req logMetricRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		cur, ok := loadLogMetric(ctx, c, db)
+		if !ok {
+			return
+		}
+		next := cur
+		updates, reset := req.apply(&next)
+		if len(updates) == 0 {
+			respondOK(c, cur)
+			return
+		}
+		if err := logmetric.Validate(next); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if next.Name != cur.Name {
+			if _, found, err := store.GetLogMetricByName(ctx, db, cur.ProjectID, next.Name); err != nil {
+				respondErr(c, http.StatusServiceUnavailable, err.Error())
+				return
+			} else if found {
+				respondErr(c, http.StatusConflict, "metric already exists")
+				return
+			}
+		}
+		saved, err := store.UpdateLogMetric(ctx, db, cur, updates, reset)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, saved)
+	}
+}
+
+func DeleteLogMetricHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		row, ok := loadLogMetric(ctx, c, db)
+		if !ok {
+			return
+		}
+		if _, err := store.DeleteLogMetric(ctx, db, row.ProjectID, row.ID); err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"deleted": true})
+	}
+}
+
+// LogMetricSeriesHandler returns a metric's series between start and end
+// (default: the last hour). Repeated label=key=value params keep the series
+// with those labels.
+func LogMetricSeriesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		end := time.Now().UTC()
+		if t, ok := parseTime(c.Query("end")); ok {
+			end = t
+		}
+		start := end.Add(-time.Hour)
+		if t, ok := parseTime(c.Query("start")); ok {
+			start = t
+		}
+		if !start.Before(end) {
+			respondErr(c, http.StatusBadRequest, "start must be before end")
+			return
+		}
+		labels := map[string]string{}
+		for _, raw := range c.QueryArray("label") {
+			k, v, ok := strings.Cut(raw, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				respondErr(c, http.StatusBadRequest, "label must be key=value")
+				return
+			}
+			labels[strings.TrimSpace(k)] = v
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		m, ok := loadLogMetric(ctx, c, db)
+		if !ok {
+			return
+		}
+		if end.Sub(start) > time.Duration(m.IntervalSec)*time.Second*maxSeriesBuckets {
+			respondErr(c, http.StatusBadRequest, "time range too large for the metric's interval")
+			return
+		}
+		series, err := logmetric.ReadSeries(ctx, db, m.ID, start, end, labels)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{
+			"metric":       m,
+			"start":        start,
+			"end":          end,
+			"interval_sec": m.IntervalSec,
+			"series":       series,
+		})
+	}
+}
+
+func loadLogMetric(ctx context.Context, c *gin.Context, db *gorm.DB) (model.LogMetric, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return model.LogMetric{}, false
+	}
+	pid, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return model.LogMetric{}, false
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("metricId")), 10, 64)
+	if err != nil || id <= 0 {
+		respondErr(c, http.StatusBadRequest, "invalid metricId")
+		return model.LogMetric{}, false
+	}
+	row, found, err := store.GetLogMetric(ctx, db, pid, id)
+	if err != nil {
+		respondErr(c, http.StatusServiceUnavailable, err.Error())
+		return model.LogMetric{}, false
+	}
+	if !found {
+		respondErr(c, http.StatusNotFound, "not found")
+		return model.LogMetric{}, false
+	}
+	return row, true
+}
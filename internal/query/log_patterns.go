@@ -0,0 +1,189 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/pattern"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxPatternRange bounds the time range of pattern queries.
+const maxPatternRange = 31 * 24 * time.Hour
+
+// patternRange reads start and end, end defaulting to now and start to def
+// before end; it responds 400 and returns false when they are invalid.
+func patternRange(c *gin.Context, def time.Duration) (time.Time, time.Time, bool) {
+	end := time.Now().UTC()
+	if t, ok := parseTime(c.Query("end")); ok {
+		end = t
+	}
+	start := end.Add(-def)
+	if t, ok := parseTime(c.Query("start")); ok {
+		start = t
+	}
+	if !start.Before(end) {
+		respondErr(c, http.StatusBadRequest, "start must be before end")
+		return start, end, false
+	}
+	if end.Sub(start) > maxPatternRange {
+		respondErr(c, http.StatusBadRequest, "time range too large (max 31d)")
+		return start, end, false
+	}
+	return start, end, true
+}
+
+func patternProject(c *gin.Context, db *gorm.DB) (int, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return 0, false
+	}
+	pid, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	return pid, true
+}
+
+// ListPatternsHandler returns the patterns with the most logs in
+// ?start&end (default the last 24h).
+func ListPatternsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, ok := patternProject(c, db)
+		if !ok {
+			return
+		}
+		start, end, ok := patternRange(c, 24*time.Hour)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		out, err := pattern.Top(ctx, db, pid, start, end, parseLimit(c.Query("limit"), 50, 500))
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, out)
+	}
+}
+
+// NewPatternsHandler returns the patterns first seen in ?start&end (default
+// the last 24h), newest first.
+func NewPatternsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, ok := patternProject(c, db)
+		if !ok {
+			return
+		}
+		start, end, ok := patternRange(c, 24*time.Hour)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		out, err := pattern.New(ctx, db, pid, start, end, parseLimit(c.Query("limit"), 50, 500))
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, out)
+	}
+}
+
+// PatternSpikesHandler returns the patterns whose volume in ?start&end
+// (default the last hour) is ?minRatio (3) times what their rate over the
+// ?baseline (24h) before start predicts, ignoring those with fewer than
+// ?minCount (10) logs.
+func PatternSpikesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, ok := patternProject(c, db)
+		if !ok {
+			return
+		}
+		start, end, ok := patternRange(c, time.Hour)
+		if !ok {
+			return
+		}
+		opts := pattern.SpikeOptions{
+			Baseline:   24 * time.Hour,
+			MinMatches: int64(parseLimit(c.Query("minCount"), 10, 1<<30)),
+			MinRatio:   3,
+			Limit:      parseLimit(c.Query("limit"), 50, 500),
+		}
+		if raw := strings.TrimSpace(c.Query("baseline")); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 || d > maxPatternRange {
+				respondErr(c, http.StatusBadRequest, "invalid baseline")
+				return
+			}
+			opts.Baseline = d
+		}
+		if raw := strings.TrimSpace(c.Query("minRatio")); raw != "" {
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil || f <= 0 {
+				respondErr(c, http.StatusBadRequest, "invalid minRatio")
+				return
+			}
+			opts.MinRatio = f
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		out, err := pattern.Spikes(ctx, db, pid, start, end, opts)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{
+			"start":    start,
+			"end":      end,
+			"baseline": opts.Baseline.String(),
+			"items":    out,
+		})
+	}
+}
+
+// GetPatternHandler returns a pattern and its counts per bucket in
+// ?start&end (default the last 24h).
+func GetPatternHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pid, ok := patternProject(c, db)
+		if !ok {
+			return
+		}
+		start, end, ok := patternRange(c, 24*time.Hour)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		id := strings.TrimSpace(c.Param("patternId"))
+		p, found, err := pattern.Get(ctx, db, pid, id)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if !found {
+			respondErr(c, http.StatusNotFound, "not found")
+			return
+		}
+		series, err := pattern.Series(ctx, db, pid, id, start, end)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{
+			"pattern":      p,
+			"start":        start,
+			"end":          end,
+			"interval_sec": int(pattern.BucketSize / time.Second),
+			"series":       series,
+		})
+	}
+}
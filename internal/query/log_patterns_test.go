@@ -0,0 +1,98 @@
+package query_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/pattern"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestPatternEndpoints(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+
+	now := time.Now().UTC()
+	var rows []model.Log
+	for i := 0; i < 12; i++ {
+		rows = append(rows, model.Log{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Minute), Level: "error", Message: fmt.Sprintf("upstream %d timed out", i)})
+	}
+	m := pattern.NewMiner(srv.DB)
+	m.Assign(context.Background(), rows)
+	if err := m.Record(context.Background(), rows); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	id := rows[0].PatternID
+
+	get := func(path string, out any) {
+		t.Helper()
+		status, body := testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/api/%d/%s", srv.HTTP.URL, boot.ProjectID, path), nil, headers)
+		if status != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s", path, status, body)
+		}
+		if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, out); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	type summary struct {
+		PatternID string  `json:"pattern_id"`
+		Template  string  `json:"template"`
+		Matches   int64   `json:"matches"`
+		Ratio     float64 `json:"ratio"`
+	}
+
+	var top []summary
+	get("patterns", &top)
+	if len(top) != 1 || top[0].PatternID != id || top[0].Template != "upstream <*> timed out" || top[0].Matches != 12 {
+		t.Fatalf("top = %+v", top)
+	}
+	var fresh []summary
+	get("patterns/new", &fresh)
+	if len(fresh) != 1 || fresh[0].PatternID != id {
+		t.Fatalf("new = %+v", fresh)
+	}
+	var spikes struct {
+		Items []summary `json:"items"`
+	}
+	get("patterns/spikes", &spikes)
+	if len(spikes.Items) != 1 || spikes.Items[0].Ratio != 12 {
+		t.Fatalf("spikes = %+v", spikes)
+	}
+	var detail struct {
+		Pattern summary `json:"pattern"`
+		Series  []struct {
+			Count int64 `json:"count"`
+		} `json:"series"`
+	}
+	get("patterns/"+id, &detail)
+	if detail.Pattern.PatternID != id || len(detail.Series) != 1 || detail.Series[0].Count != 12 {
+		t.Fatalf("detail = %+v", detail)
+	}
+
+	// Logs of the pattern can be searched by its id.
+	if err := srv.DB.Create(&rows).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	status, body := testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/api/%d/search?q=pattern_id:%s", srv.HTTP.URL, boot.ProjectID, id), nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("search: status=%d body=%s", status, body)
+	}
+	var res struct {
+		Total int64 `json:"total"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Total != 12 {
+		t.Fatalf("search total = %d (%v): %s", res.Total, err, body)
+	}
+
+	status, _ = testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/api/%d/patterns/ffffffffffffffff", srv.HTTP.URL, boot.ProjectID), nil, headers)
+	if status != http.StatusNotFound {
+		t.Fatalf("unknown pattern: status=%d", status)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aak1247/logtap/internal/cursor"
 	"github.com/aak1247/logtap/internal/detector"
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/project"
@@ -281,18 +282,28 @@ func ListMonitorRunsHandler(db *gorm.DB) gin.HandlerFunc {
 			}
 			limit = v
 		}
+		after, ok := parseCursor(c)
+		if !ok {
+			return
+		}
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
+		// Runs page by id alone: ids grow with started_at.
 		var items []model.MonitorRun
-		if err := db.WithContext(ctx).
-			Where("project_id = ? AND monitor_id = ?", pid, mid).
-			Order("id DESC").
-			Limit(limit).
+		qdb := db.WithContext(ctx).Where("project_id = ? AND monitor_id = ?", pid, mid)
+		if err := after.Where(qdb, "", "id", false).
+			Order(cursor.Order("", "id", false)).
+			Limit(limit + 1).
 			Find(&items).Error; err != nil {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
-		respondOK(c, gin.H{"items": items})
+		var next string
+		if len(items) > limit {
+			items = items[:limit]
+			next = cursor.After(time.Time{}, items[limit-1].ID).String()
+		}
+		respondPage(c, gin.H{"items": items}, next)
 	}
 }
 
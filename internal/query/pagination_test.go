@@ -0,0 +1,90 @@
+package query_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+	"github.com/google/uuid"
+)
+
+func TestCursorPagination(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var logs []model.Log
+	for i := 0; i < 7; i++ {
+		// Pairs share a timestamp so that pages split ties.
+		logs = append(logs, model.Log{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Duration(i/2) * time.Second), Level: "info", Message: fmt.Sprintf("log %d", i), Fields: []byte(`{}`)})
+	}
+	if err := srv.DB.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	var events []model.Event
+	for i := 0; i < 5; i++ {
+		events = append(events, model.Event{ID: uuid.New(), ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Duration(i/2) * time.Second), Level: "error", Title: fmt.Sprintf("event %d", i), Data: []byte(`{}`)})
+	}
+	if err := srv.DB.Create(&events).Error; err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+
+	// page walks path through every page of limit 2 and returns the ids.
+	page := func(path string) []string {
+		t.Helper()
+		var ids []string
+		next := ""
+		for i := 0; ; i++ {
+			u := fmt.Sprintf("%s/api/%d/%s?limit=2", srv.HTTP.URL, boot.ProjectID, path)
+			if next != "" {
+				u += "&cursor=" + url.QueryEscape(next)
+			}
+			status, body := testkit.DoJSON(t, client, http.MethodGet, u, nil, headers)
+			if status != http.StatusOK {
+				t.Fatalf("%s: status=%d body=%s", path, status, body)
+			}
+			env := testkit.DecodeEnvelope(t, body)
+			var rows []struct {
+				ID any `json:"id"`
+			}
+			if err := json.Unmarshal(env.Data, &rows); err != nil {
+				t.Fatalf("%s: data: %v", path, err)
+			}
+			for _, r := range rows {
+				ids = append(ids, fmt.Sprint(r.ID))
+			}
+			if next = env.NextCursor; next == "" {
+				return ids
+			}
+			if i > 10 {
+				t.Fatalf("%s: too many pages", path)
+			}
+		}
+	}
+	distinct := func(ids []string) int {
+		seen := map[string]bool{}
+		for _, id := range ids {
+			seen[id] = true
+		}
+		return len(seen)
+	}
+
+	if ids := page("logs/search"); len(ids) != 7 || distinct(ids) != 7 {
+		t.Fatalf("logs: %v", ids)
+	}
+	if ids := page("events/recent"); len(ids) != 5 || distinct(ids) != 5 {
+		t.Fatalf("events: %v", ids)
+	}
+
+	status, _ := testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/api/%d/logs/search?cursor=nope", srv.HTTP.URL, boot.ProjectID), nil, headers)
+	if status != http.StatusBadRequest {
+		t.Fatalf("invalid cursor: status=%d", status)
+	}
+}
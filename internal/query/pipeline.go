@@ -0,0 +1,109 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/pipeline"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/queryjob"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxPipelineRange bounds the time range of piped queries.
+const maxPipelineRange = 31 * 24 * time.Hour
+
+type pipelineRequest struct {
+	Q     string `json:"q"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// PipelineQueryHandler runs a piped query (see package pipeline) over the
+// logs in start..end, end defaulting to now and start to a day before. GET
+// reads q, start and end from the query string, POST from a JSON body.
+func PipelineQueryHandler(db *gorm.DB, jobs *queryjob.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		req := pipelineRequest{Q: c.Query("q"), Start: c.Query("start"), End: c.Query("end")}
+		if c.Request.Method == http.MethodPost {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondErr(c, http.StatusBadRequest, "invalid json")
+				return
+			}
+		}
+
+		end := time.Now().UTC()
+		if t, ok := parseTime(req.End); ok {
+			end = t
+		}
+		start := end.Add(-24 * time.Hour)
+		if t, ok := parseTime(req.Start); ok {
+			start = t
+		}
+		if !start.Before(end) {
+			respondErr(c, http.StatusBadRequest, "start must be before end")
+			return
+		}
+		if end.Sub(start) > maxPipelineRange {
+			respondErr(c, http.StatusBadRequest, "time range too large (max 31d)")
+			return
+		}
+
+		q, err := pipeline.Parse(strings.TrimSpace(req.Q))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		run := func(ctx context.Context, ex *pipeline.Executor) (gin.H, error) {
+			res, err := ex.Run(ctx, projectID, start, end, q)
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{
+				"start":        start,
+				"end":          end,
+				"columns":      res.Columns,
+				"groups":       res.Groups,
+				"interval_sec": res.IntervalSec,
+				"rows":         res.Rows,
+			}, nil
+		}
+
+		// With async=1 the query runs as a job, bounded by the job timeout
+		// instead of the executor's.
+		if asyncRequested(c) {
+			key := pipelineRequest{Q: strings.TrimSpace(req.Q), Start: req.Start, End: req.End}
+			submitJob(c, jobs, projectID, "query", key, func(ctx context.Context, db *gorm.DB, _ func(float64, any)) (any, error) {
+				ex := pipeline.NewExecutor(db)
+				ex.Timeout = jobs.Timeout
+				return run(ctx, ex)
+			})
+			return
+		}
+
+		out, err := run(c.Request.Context(), pipeline.NewExecutor(db))
+		if err != nil {
+			if errors.Is(err, search.ErrInvalidQuery) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, out)
+	}
+}
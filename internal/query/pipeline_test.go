@@ -0,0 +1,68 @@
+package query_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/datatypes"
+)
+
+func TestPipelineQueryEndpoint(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+
+	now := time.Now().UTC()
+	var rows []model.Log
+	for i, svc := range []string{"api", "api", "web"} {
+		rows = append(rows, model.Log{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Duration(i+1) * time.Minute), Level: "error", Message: "boom", Fields: datatypes.JSON(fmt.Sprintf(`{"service":%q}`, svc))})
+	}
+	if err := srv.DB.Create(&rows).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	type result struct {
+		Columns []string         `json:"columns"`
+		Groups  []string         `json:"groups"`
+		Rows    []map[string]any `json:"rows"`
+	}
+	base := fmt.Sprintf("%s/api/%d/query", srv.HTTP.URL, boot.ProjectID)
+	q := "level:error | stats count() as n by service | sort -n | head 1"
+
+	status, body := testkit.DoJSON(t, client, http.MethodGet, base+"?q="+url.QueryEscape(q), nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("GET: status=%d body=%s", status, body)
+	}
+	var got result
+	if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Rows) != 1 || got.Rows[0]["service"] != "api" || got.Rows[0]["n"] != 2.0 || fmt.Sprint(got.Columns) != "[service n]" {
+		t.Fatalf("GET result = %+v", got)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodPost, base, map[string]any{"q": "| top service"}, headers)
+	if status != http.StatusOK {
+		t.Fatalf("POST: status=%d body=%s", status, body)
+	}
+	if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Rows) != 2 || got.Rows[0]["count"] != 2.0 {
+		t.Fatalf("POST result = %+v", got)
+	}
+
+	for _, bad := range []string{"| stats", "| stats count() by fields..x", "| stats count() | top level"} {
+		status, body = testkit.DoJSON(t, client, http.MethodGet, base+"?q="+url.QueryEscape(bad), nil, headers)
+		if status != http.StatusBadRequest {
+			t.Fatalf("%q: status=%d body=%s", bad, status, body)
+		}
+	}
+}
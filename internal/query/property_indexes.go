@@ -0,0 +1,293 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/queryjob"
+	searchpostgres "github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adviceWindow is how recent a slow search must be for the index advisor
+// to count it.
+const adviceWindow = 30 * 24 * time.Hour
+
+// ListPropertyIndexesHandler lists the expression indexes built for the
+// project's properties.
+func ListPropertyIndexesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var items []model.PropertyIndex
+		if err := db.WithContext(c.Request.Context()).
+			Where("project_id = ?", projectID).
+			Order("key ASC").
+			Find(&items).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"items": items})
+	}
+}
+
+// CreatePropertyIndexHandler builds an expression index on logs for a
+// property, {"key":"latency_ms"}, on the expression searches compare it
+// with as its declared type (string when undeclared). The build runs as a
+// query job: the response is {"index":...,"job":...} and the index's
+// status turns ready or failed when the job ends.
+func CreatePropertyIndexHandler(db *gorm.DB, jobs *queryjob.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		if jobs == nil {
+			respondErr(c, http.StatusNotImplemented, "query jobs not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		var req struct {
+			Key string `json:"key"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(req.Key), "fields.")
+		if key == "" {
+			respondErr(c, http.StatusBadRequest, "key required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		adapter := searchpostgres.NewAdapter(db)
+		types, err := adapter.PropertyTypes(ctx, projectID)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		typ := types[key]
+		if typ == "" || typ == "enum" {
+			typ = "string"
+		}
+		expr, err := adapter.PropertyIndexExpr(key, typ)
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		name := searchpostgres.PropertyIndexName(expr)
+
+		var row model.PropertyIndex
+		err = db.WithContext(ctx).Where("project_id = ? AND key = ?", projectID, key).First(&row).Error
+		switch {
+		case err == nil && row.IndexName != name:
+			respondErr(c, http.StatusConflict, "property already indexed as "+row.Type+"; delete the index first")
+			return
+		case err == nil && row.Status != "failed":
+			respondOK(c, gin.H{"index": row})
+			return
+		case err == nil:
+			row.Status, row.Error = "building", ""
+			err = db.WithContext(ctx).Save(&row).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			row = model.PropertyIndex{ProjectID: projectID, Key: key, Type: typ, IndexName: name, Expression: expr, Status: "building"}
+			err = db.WithContext(ctx).Create(&row).Error
+		}
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		// No cache key: a build must run even right after a drop.
+		job, err := jobs.Submit(projectID, "index.create", "", func(ctx context.Context, jdb *gorm.DB, _ func(float64, any)) (any, error) {
+			buildErr := searchpostgres.NewAdapter(jdb).CreatePropertyIndex(ctx, name, expr)
+			status, msg := "ready", ""
+			if buildErr != nil {
+				status, msg = "failed", buildErr.Error()
+			}
+			if err := db.WithContext(context.WithoutCancel(ctx)).Model(&model.PropertyIndex{}).
+				Where("id = ?", row.ID).
+				Updates(map[string]any{"status": status, "error": msg}).Error; err != nil && buildErr == nil {
+				return nil, err
+			}
+			if buildErr != nil {
+				return nil, buildErr
+			}
+			return gin.H{"index_name": name}, nil
+		})
+		if err != nil {
+			_ = db.WithContext(ctx).Model(&row).Updates(map[string]any{"status": "failed", "error": err.Error()}).Error
+		}
+		respondJob(c, job, gin.H{"index": row, "job": job}, err)
+	}
+}
+
+// DeletePropertyIndexHandler forgets a property's index and drops it unless
+// another project's index shares it.
+func DeletePropertyIndexHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(c.Param("propertyKey")), "fields.")
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+		defer cancel()
+
+		var row model.PropertyIndex
+		if err := db.WithContext(ctx).Where("project_id = ? AND key = ?", projectID, key).First(&row).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respondErr(c, http.StatusNotFound, "not found")
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if row.Status == "building" {
+			respondErr(c, http.StatusConflict, "index is still building")
+			return
+		}
+		if err := db.WithContext(ctx).Delete(&row).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		var shared int64
+		if err := db.WithContext(ctx).Model(&model.PropertyIndex{}).Where("index_name = ?", row.IndexName).Count(&shared).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if shared == 0 {
+			if err := searchpostgres.NewAdapter(db).DropPropertyIndex(ctx, row.IndexName); err != nil {
+				respondErr(c, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+		}
+		respondOK(c, gin.H{"deleted": true, "dropped": shared == 0})
+	}
+}
+
+// PropertyIndexAdvice suggests indexing a property slow searches filter on.
+type PropertyIndexAdvice struct {
+	Key          string    `json:"key"`
+	Type         string    `json:"type"`
+	Declared     bool      `json:"declared"` // the type comes from a property definition
+	SlowSearches int64     `json:"slow_searches"`
+	AvgMs        int64     `json:"avg_ms"`
+	MaxMs        int64     `json:"max_ms"`
+	LastSeen     time.Time `json:"last_seen"`
+	Indexable    bool      `json:"indexable"`
+	Expression   string    `json:"expression,omitempty"`
+	Status       string    `json:"status,omitempty"` // of a failed index
+	Reason       string    `json:"reason"`
+}
+
+// PropertyIndexAdviceHandler suggests which properties to index: those the
+// project's searches slower than 1s filtered on in the last 30 days, most
+// often slow first, skipping the ones already indexed or being indexed.
+func PropertyIndexAdviceHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		limit := parseLimit(c.Query("limit"), 20, 100)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		var slow []model.SlowSearchField
+		if err := db.WithContext(ctx).
+			Where("project_id = ? AND last_seen >= ?", projectID, time.Now().UTC().Add(-adviceWindow)).
+			Order("count DESC, total_ms DESC").
+			Find(&slow).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		adapter := searchpostgres.NewAdapter(db)
+		types, err := adapter.PropertyTypes(ctx, projectID)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		var existing []model.PropertyIndex
+		if err := db.WithContext(ctx).Where("project_id = ?", projectID).Find(&existing).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		indexed := make(map[string]model.PropertyIndex, len(existing))
+		for _, ix := range existing {
+			indexed[ix.Key] = ix
+		}
+
+		out := make([]PropertyIndexAdvice, 0, limit)
+		for _, s := range slow {
+			if len(out) == limit {
+				break
+			}
+			ix, ok := indexed[s.Field]
+			if ok && ix.Status != "failed" {
+				continue
+			}
+			typ, declared := types[s.Field]
+			if !declared || typ == "enum" {
+				typ = "string"
+			}
+			a := PropertyIndexAdvice{
+				Key:          s.Field,
+				Type:         typ,
+				Declared:     declared,
+				SlowSearches: s.Count,
+				AvgMs:        s.TotalMs / max(s.Count, 1),
+				MaxMs:        s.MaxMs,
+				LastSeen:     s.LastSeen,
+			}
+			if ok {
+				a.Status = ix.Status
+			}
+			expr, err := adapter.PropertyIndexExpr(s.Field, typ)
+			switch {
+			case err != nil:
+				a.Reason = err.Error()
+			case declared:
+				a.Indexable, a.Expression = true, expr
+				a.Reason = "filtered on by slow searches"
+			default:
+				a.Indexable, a.Expression = true, expr
+				a.Reason = "filtered on by slow searches; declare its type first if it is compared as a number, boolean or datetime"
+			}
+			out = append(out, a)
+		}
+		respondOK(c, gin.H{"items": out})
+	}
+}
@@ -0,0 +1,120 @@
+package query_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestPropertyIndexesAndAdvice(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+	base := fmt.Sprintf("%s/api/%d/properties", srv.HTTP.URL, boot.ProjectID)
+
+	status, body := testkit.DoJSON(t, client, http.MethodPost, base+"/schema", map[string]any{"key": "latency", "type": "number"}, headers)
+	if status != http.StatusOK {
+		t.Fatalf("define: status=%d body=%s", status, body)
+	}
+	now := time.Now().UTC()
+	slow := []model.SlowSearchField{
+		{ProjectID: boot.ProjectID, Field: "latency", Count: 3, TotalMs: 6000, MaxMs: 3000, LastSeen: now},
+		{ProjectID: boot.ProjectID, Field: "at", Count: 2, TotalMs: 3000, MaxMs: 2000, LastSeen: now},
+		{ProjectID: boot.ProjectID, Field: "old", Count: 9, TotalMs: 9000, MaxMs: 1000, LastSeen: now.AddDate(0, -2, 0)},
+	}
+	if err := srv.DB.Create(&slow).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	type advice struct {
+		Key        string `json:"key"`
+		Type       string `json:"type"`
+		Declared   bool   `json:"declared"`
+		AvgMs      int64  `json:"avg_ms"`
+		Indexable  bool   `json:"indexable"`
+		Expression string `json:"expression"`
+	}
+	getAdvice := func() []advice {
+		t.Helper()
+		status, body := testkit.DoJSON(t, client, http.MethodGet, base+"/indexes/advice", nil, headers)
+		if status != http.StatusOK {
+			t.Fatalf("advice: status=%d body=%s", status, body)
+		}
+		var out struct {
+			Items []advice `json:"items"`
+		}
+		if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return out.Items
+	}
+	items := getAdvice()
+	if len(items) != 2 || items[0].Key != "latency" || items[0].Type != "number" || !items[0].Declared || items[0].AvgMs != 2000 || !items[0].Indexable || items[0].Expression == "" {
+		t.Fatalf("advice = %+v", items)
+	}
+	if items[1].Key != "at" || items[1].Type != "string" || items[1].Declared {
+		t.Fatalf("advice = %+v", items)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodPost, base+"/indexes", map[string]any{"key": "latency"}, headers)
+	if status != http.StatusAccepted && status != http.StatusOK {
+		t.Fatalf("create index: status=%d body=%s", status, body)
+	}
+	type index struct {
+		Key       string `json:"key"`
+		Type      string `json:"type"`
+		IndexName string `json:"index_name"`
+		Status    string `json:"status"`
+		Error     string `json:"error"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	var list struct {
+		Items []index `json:"items"`
+	}
+	for {
+		status, body = testkit.DoJSON(t, client, http.MethodGet, base+"/indexes", nil, headers)
+		if status != http.StatusOK {
+			t.Fatalf("list: status=%d body=%s", status, body)
+		}
+		if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, &list); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(list.Items) == 1 && list.Items[0].Status != "building" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index still building: %s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ix := list.Items[0]; ix.Key != "latency" || ix.Type != "number" || ix.Status != "ready" {
+		t.Fatalf("index = %+v", ix)
+	}
+	var n int64
+	srv.DB.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", list.Items[0].IndexName).Scan(&n)
+	if n != 1 {
+		t.Fatalf("index %s not built", list.Items[0].IndexName)
+	}
+	if items := getAdvice(); len(items) != 1 || items[0].Key != "at" {
+		t.Fatalf("advice after indexing = %+v", items)
+	}
+
+	status, _ = testkit.DoJSON(t, client, http.MethodPost, base+"/indexes", map[string]any{"key": "bad key"}, headers)
+	if status != http.StatusBadRequest {
+		t.Fatalf("invalid key: status=%d", status)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodDelete, base+"/indexes/latency", nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("delete: status=%d body=%s", status, body)
+	}
+	srv.DB.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", list.Items[0].IndexName).Scan(&n)
+	if n != 0 {
+		t.Fatalf("index %s not dropped", list.Items[0].IndexName)
+	}
+}
@@ -15,10 +15,14 @@ import (
 	"gorm.io/gorm"
 )
 
+// allowedPropertyTypes are the property types; search compares number,
+// boolean and datetime properties as such (see docs/SEARCH.md).
 var allowedPropertyTypes = map[string]bool{
-	"string": true,
-	"enum":   true,
-	"number": true,
+	"string":   true,
+	"enum":     true,
+	"number":   true,
+	"boolean":  true,
+	"datetime": true,
 }
 
 // ListPropertyDefinitionsHandler returns all property definitions for a project.
@@ -106,7 +110,7 @@ func CreatePropertyDefinitionHandler(db *gorm.DB) gin.HandlerFunc {
 			pt = "string"
 		}
 		if !allowedPropertyTypes[pt] {
-			respondErr(c, http.StatusBadRequest, "invalid type (expected string|enum|number)")
+			respondErr(c, http.StatusBadRequest, "invalid type (expected string|enum|number|boolean|datetime)")
 			return
 		}
 		status := strings.TrimSpace(req.Status)
@@ -230,7 +234,7 @@ func UpdatePropertyDefinitionHandler(db *gorm.DB) gin.HandlerFunc {
 			pt = row.Type
 		}
 		if !allowedPropertyTypes[pt] {
-			respondErr(c, http.StatusBadRequest, "invalid type (expected string|enum|number)")
+			respondErr(c, http.StatusBadRequest, "invalid type (expected string|enum|number|boolean|datetime)")
 			return
 		}
 		status := strings.TrimSpace(req.Status)
@@ -0,0 +1,185 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/channel"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/quota"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func defaultProjectQuota(projectID int) model.ProjectQuota {
+	return model.ProjectQuota{
+		ProjectID:   projectID,
+		Action:      quota.ActionReject,
+		SampleRate:  0.1,
+		NotifyOwner: true,
+		Channels:    datatypes.JSON("[]"),
+	}
+}
+
+// GetQuotaHandler returns the project's quota together with today's usage.
+func GetQuotaHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+		defer cancel()
+
+		q, ok, err := store.GetProjectQuota(ctx, db, projectID)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if !ok {
+			q = defaultProjectQuota(projectID)
+		}
+		today, err := store.GetProjectUsageDay(ctx, db, projectID, quota.Day(time.Now()))
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, quota.Evaluate(q, today))
+	}
+}
+
+func UpsertQuotaHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var req struct {
+			Enabled         *bool                    `json:"enabled"`
+			MaxStorageBytes *int64                   `json:"max_storage_bytes"`
+			MaxDailyBytes   *int64                   `json:"max_daily_bytes"`
+			MaxDailyRows    *int64                   `json:"max_daily_rows"`
+			MaxExportBytes  *int64                   `json:"max_export_bytes"`
+			Action          *string                  `json:"action"`
+			SampleRate      *float64                 `json:"sample_rate"`
+			NotifyOwner     *bool                    `json:"notify_owner"`
+			Channels        *[]channel.ChannelConfig `json:"channels"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		cur, ok, err := store.GetProjectQuota(ctx, db, projectID)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if !ok {
+			cur = defaultProjectQuota(projectID)
+		}
+		next := cur
+		if req.Enabled != nil {
+			next.Enabled = *req.Enabled
+		}
+		if req.MaxStorageBytes != nil {
+			next.MaxStorageBytes = *req.MaxStorageBytes
+		}
+		if req.MaxDailyBytes != nil {
+			next.MaxDailyBytes = *req.MaxDailyBytes
+		}
+		if req.MaxDailyRows != nil {
+			next.MaxDailyRows = *req.MaxDailyRows
+		}
+		if req.MaxExportBytes != nil {
+			next.MaxExportBytes = *req.MaxExportBytes
+		}
+		if req.Action != nil {
+			next.Action = *req.Action
+		}
+		if req.SampleRate != nil {
+			next.SampleRate = *req.SampleRate
+		}
+		if req.NotifyOwner != nil {
+			next.NotifyOwner = *req.NotifyOwner
+		}
+		if req.Channels != nil {
+			b, err := json.Marshal(*req.Channels)
+			if err != nil {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			next.Channels = datatypes.JSON(b)
+		}
+		next, err = quota.Normalize(next)
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		saved, err := store.UpsertProjectQuota(ctx, db, next)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, saved)
+	}
+}
+
+// ListUsageHandler returns the project's daily usage for the last days
+// (?days=, default 30, max 366), oldest first.
+func ListUsageHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		days := 30
+		if raw := strings.TrimSpace(c.Query("days")); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > 366 {
+				respondErr(c, http.StatusBadRequest, "invalid days (expected 1..366)")
+				return
+			}
+			days = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		from := quota.Day(time.Now().AddDate(0, 0, -(days - 1)))
+		rows, err := store.ListProjectUsageDaily(ctx, db, projectID, from)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"days": days, "items": rows})
+	}
+}
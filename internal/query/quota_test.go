@@ -0,0 +1,79 @@
+package query_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/auth"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestQuotaAdminOnly(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+
+	status, body := testkit.DoJSON(t, client, http.MethodPut, fmt.Sprintf("%s/api/%d/quota", srv.HTTP.URL, boot.ProjectID),
+		map[string]any{"enabled": true, "max_daily_rows": 10}, map[string]string{"Authorization": "Bearer " + boot.Token})
+	if status != http.StatusOK {
+		t.Fatalf("admin put: status=%d body=%s", status, body)
+	}
+	var own model.ProjectQuota
+	if err := srv.DB.Where("project_id = ?", boot.ProjectID).First(&own).Error; err != nil || !own.Enabled || own.MaxDailyRows != 10 {
+		t.Fatalf("admin quota = %+v (%v)", own, err)
+	}
+
+	// Another user owns their project but cannot lift its quota.
+	user := model.User{Email: "team@example.com", PasswordHash: "x"}
+	if err := srv.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	proj := model.Project{OwnerUserID: user.ID, Name: "team"}
+	if err := srv.DB.Create(&proj).Error; err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	token, err := auth.SignToken(srv.Config.AuthSecret, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	quotaURL := fmt.Sprintf("%s/api/%d/quota", srv.HTTP.URL, proj.ID)
+
+	status, body = testkit.DoJSON(t, client, http.MethodPut, quotaURL, map[string]any{"enabled": false, "max_export_bytes": 0}, headers)
+	if status != http.StatusForbidden {
+		t.Fatalf("owner put: status=%d body=%s", status, body)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodGet, quotaURL, nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("owner get: status=%d body=%s", status, body)
+	}
+
+	// The admin sets it through the admin API instead.
+	adminURL := fmt.Sprintf("%s/api/admin/projects/%d/quota", srv.HTTP.URL, proj.ID)
+	status, body = testkit.DoJSON(t, client, http.MethodPut, adminURL, map[string]any{"enabled": true, "max_daily_rows": 5}, headers)
+	if status != http.StatusForbidden {
+		t.Fatalf("owner admin put: status=%d body=%s", status, body)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodPut, adminURL, map[string]any{"enabled": true, "max_daily_rows": 5, "max_export_bytes": 30},
+		map[string]string{"Authorization": "Bearer " + boot.Token})
+	if status != http.StatusOK {
+		t.Fatalf("admin put: status=%d body=%s", status, body)
+	}
+	var q model.ProjectQuota
+	if err := srv.DB.Where("project_id = ?", proj.ID).First(&q).Error; err != nil || !q.Enabled || q.MaxDailyRows != 5 {
+		t.Fatalf("quota = %+v (%v)", q, err)
+	}
+
+	// Nor can the owner lift the export limit the admin set, even with the
+	// quota disabled.
+	status, body = testkit.DoJSON(t, client, http.MethodPut, quotaURL, map[string]any{"enabled": false, "max_export_bytes": 0}, headers)
+	if status != http.StatusForbidden {
+		t.Fatalf("owner export limit: status=%d body=%s", status, body)
+	}
+	if err := srv.DB.Where("project_id = ?", proj.ID).First(&q).Error; err != nil || q.MaxExportBytes != 30 {
+		t.Fatalf("quota after owner put = %+v (%v)", q, err)
+	}
+}
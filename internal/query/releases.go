@@ -0,0 +1,422 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// worseThreshold is how much higher a release's error rate may be than the
+// previous release's before the deploy is flagged as having made things worse.
+const worseThreshold = 1.2
+
+type releaseRequest struct {
+	Version   string     `json:"version"`
+	Ref       string     `json:"ref"`
+	URL       string     `json:"url"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+type deployRequest struct {
+	Environment string     `json:"environment"`
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// releaseWithDeploys is a release with the latest deploy to each environment.
+type releaseWithDeploys struct {
+	model.Release
+	Deploys []model.Deploy `json:"deploys"`
+}
+
+// ListReleasesHandler lists releases, newest first, each with its latest
+// deploy per environment. Query params: limit, offset.
+func ListReleasesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := releaseProject(c, db)
+		if !ok {
+			return
+		}
+		offset, _ := strconv.Atoi(strings.TrimSpace(c.Query("offset")))
+		if offset < 0 {
+			offset = 0
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		releases, err := store.ListReleases(ctx, db, projectID, parseLimit(c.Query("limit"), 50, 200), offset)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		ids := make([]int64, 0, len(releases))
+		for _, r := range releases {
+			ids = append(ids, r.ID)
+		}
+		var deploys []model.Deploy
+		if len(ids) > 0 {
+			if deploys, err = store.ListDeploys(ctx, db, projectID, store.DeployFilter{ReleaseIDs: ids}); err != nil {
+				respondErr(c, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+		}
+		latest := map[int64][]model.Deploy{}
+		seen := map[int64]map[string]bool{}
+		for _, d := range deploys {
+			if seen[d.ReleaseID] == nil {
+				seen[d.ReleaseID] = map[string]bool{}
+			}
+			if !seen[d.ReleaseID][d.Environment] {
+				seen[d.ReleaseID][d.Environment] = true
+				latest[d.ReleaseID] = append(latest[d.ReleaseID], d)
+			}
+		}
+		out := make([]releaseWithDeploys, 0, len(releases))
+		for _, r := range releases {
+			ds := latest[r.ID]
+			if ds == nil {
+				ds = []model.Deploy{}
+			}
+			out = append(out, releaseWithDeploys{Release: r, Deploys: ds})
+		}
+		respondOK(c, out)
+	}
+}
+
+// CreateReleaseHandler registers a release for CI. Body: version (required),
+// ref (e.g. the commit), url, created_at. Registering an existing version
+// updates its ref and url.
+func CreateReleaseHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := releaseProject(c, db)
+		if !ok {
+			return
+		}
+		var req releaseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		version, ok := validReleaseVersion(c, req.Version)
+		if !ok {
+			return
+		}
+		ref := strings.TrimSpace(req.Ref)
+		if len(ref) > 200 {
+			respondErr(c, http.StatusBadRequest, "ref too long (max 200)")
+			return
+		}
+		row := model.Release{ProjectID: projectID, Version: version, Ref: ref, URL: strings.TrimSpace(req.URL)}
+		if req.CreatedAt != nil {
+			row.CreatedAt = req.CreatedAt.UTC()
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		saved, err := store.UpsertRelease(ctx, db, row)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, saved)
+	}
+}
+
+// GetReleaseHandler returns a release with its deploys and its stats next to
+// the previous release's, to answer whether the release made things worse.
+// Query param environment scopes the deploys and stats to one environment.
+func GetReleaseHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := releaseProject(c, db)
+		if !ok {
+			return
+		}
+		version, ok := validReleaseVersion(c, c.Param("release"))
+		if !ok {
+			return
+		}
+		environment := strings.TrimSpace(c.Query("environment"))
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		rel, found, err := store.GetRelease(ctx, db, projectID, version)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if !found {
+			respondErr(c, http.StatusNotFound, "not found")
+			return
+		}
+		deploys, err := store.ListDeploys(ctx, db, projectID, store.DeployFilter{ReleaseIDs: []int64{rel.ID}, Environment: environment})
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		now := time.Now().UTC()
+		stats, err := releaseStats(ctx, db, rel, environment, now)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		resp := gin.H{
+			"release":    rel,
+			"deploys":    deploys,
+			"stats":      stats,
+			"previous":   nil,
+			"comparison": nil,
+		}
+		prev, found, err := store.AdjacentRelease(ctx, db, rel, false)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if found {
+			prevStats, err := releaseStats(ctx, db, prev, environment, now)
+			if err != nil {
+				respondErr(c, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			resp["previous"] = prevStats
+			resp["comparison"] = compareReleases(stats, prevStats)
+		}
+		respondOK(c, resp)
+	}
+}
+
+func releaseStats(ctx context.Context, db *gorm.DB, rel model.Release, environment string, now time.Time) (store.ReleaseStats, error) {
+	start, end, err := store.ReleaseWindow(ctx, db, rel, environment, now)
+	if err != nil {
+		return store.ReleaseStats{}, err
+	}
+	return store.GetReleaseStats(ctx, db, rel.ProjectID, rel.Version, environment, start, end)
+}
+
+// releaseComparison relates a release's stats to the previous release's.
+// ErrorRateChange is relative (0.5 is 50% more errors per hour) and nil when
+// the previous release had no errors.
+type releaseComparison struct {
+	ErrorRateChange *float64 `json:"error_rate_change"`
+	NewIssuesChange int64    `json:"new_issues_change"`
+	Worse           bool     `json:"worse"`
+}
+
+func compareReleases(cur, prev store.ReleaseStats) releaseComparison {
+	out := releaseComparison{NewIssuesChange: cur.NewIssues - prev.NewIssues}
+	if prev.ErrorRate > 0 {
+		change := cur.ErrorRate/prev.ErrorRate - 1
+		out.ErrorRateChange = &change
+		out.Worse = cur.ErrorRate > prev.ErrorRate*worseThreshold
+	} else {
+		out.Worse = cur.Errors > 0
+	}
+	return out
+}
+
+// ListReleaseDeploysHandler lists a release's deploys. Query param:
+// environment.
+func ListReleaseDeploysHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := releaseProject(c, db)
+		if !ok {
+			return
+		}
+		version, ok := validReleaseVersion(c, c.Param("release"))
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rel, found, err := store.GetRelease(ctx, db, projectID, version)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if !found {
+			respondErr(c, http.StatusNotFound, "not found")
+			return
+		}
+		rows, err := store.ListDeploys(ctx, db, projectID, store.DeployFilter{
+			ReleaseIDs:  []int64{rel.ID},
+			Environment: strings.TrimSpace(c.Query("environment")),
+		})
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, rows)
+	}
+}
+
+// CreateDeployHandler registers a deploy of the release for CI, creating the
+// release if needed. Body: environment (required), name, url, started_at,
+// finished_at (defaults to now).
+func CreateDeployHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := releaseProject(c, db)
+		if !ok {
+			return
+		}
+		version, ok := validReleaseVersion(c, c.Param("release"))
+		if !ok {
+			return
+		}
+		var req deployRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		env := strings.TrimSpace(req.Environment)
+		if env == "" || len(env) > 50 {
+			respondErr(c, http.StatusBadRequest, "environment is required (max 50 chars)")
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if len(name) > 200 {
+			respondErr(c, http.StatusBadRequest, "name too long (max 200)")
+			return
+		}
+		d := model.Deploy{
+			ProjectID:   projectID,
+			Version:     version,
+			Environment: env,
+			Name:        name,
+			URL:         strings.TrimSpace(req.URL),
+			FinishedAt:  time.Now().UTC(),
+		}
+		if req.FinishedAt != nil {
+			d.FinishedAt = req.FinishedAt.UTC()
+		}
+		if req.StartedAt != nil {
+			started := req.StartedAt.UTC()
+			if started.After(d.FinishedAt) {
+				respondErr(c, http.StatusBadRequest, "started_at is after finished_at")
+				return
+			}
+			d.StartedAt = &started
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		saved, err := store.CreateDeploy(ctx, db, d)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, saved)
+	}
+}
+
+// deployAnnotation marks a deploy on a time series chart.
+type deployAnnotation struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	Title       string    `json:"title"`
+	Release     string    `json:"release"`
+	Environment string    `json:"environment"`
+}
+
+// ListDeployAnnotationsHandler returns the deploys between start and end as
+// chart annotations. Query params: start, end (RFC3339; default the last 7
+// days), environment.
+func ListDeployAnnotationsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, ok := releaseProject(c, db)
+		if !ok {
+			return
+		}
+		end, okEnd := parseTime(c.Query("end"))
+		if !okEnd {
+			end = time.Now().UTC()
+		}
+		start, okStart := parseTime(c.Query("start"))
+		if !okStart {
+			start = end.AddDate(0, 0, -7)
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		rows, err := store.ListDeploys(ctx, db, projectID, store.DeployFilter{
+			Environment: strings.TrimSpace(c.Query("environment")),
+			Start:       start,
+			End:         end,
+			Limit:       maxAnnotations,
+		})
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, annotationsFromDeploys(rows))
+	}
+}
+
+// maxAnnotations caps the deploy markers returned for one chart.
+const maxAnnotations = 500
+
+// deployAnnotations returns the deploy markers for a time series response;
+// a failure only costs the markers.
+func deployAnnotations(ctx context.Context, db *gorm.DB, projectID int, start, end time.Time) []deployAnnotation {
+	if db == nil {
+		return []deployAnnotation{}
+	}
+	rows, err := store.ListDeploys(ctx, db, projectID, store.DeployFilter{Start: start, End: end, Limit: maxAnnotations})
+	if err != nil {
+		return []deployAnnotation{}
+	}
+	return annotationsFromDeploys(rows)
+}
+
+// annotationsFromDeploys orders the markers by time.
+func annotationsFromDeploys(rows []model.Deploy) []deployAnnotation {
+	out := make([]deployAnnotation, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		d := rows[i]
+		title := "Deployed " + d.Version + " to " + d.Environment
+		if d.Name != "" {
+			title += " (" + d.Name + ")"
+		}
+		out = append(out, deployAnnotation{Time: d.FinishedAt.UTC(), Kind: "deploy", Title: title, Release: d.Version, Environment: d.Environment})
+	}
+	return out
+}
+
+func releaseProject(c *gin.Context, db *gorm.DB) (int, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return 0, false
+	}
+	projectID, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	return projectID, true
+}
+
+// validReleaseVersion matches the release_tag events are stored with.
+func validReleaseVersion(c *gin.Context, version string) (string, bool) {
+	version = strings.TrimSpace(version)
+	if version == "" || len(version) > 100 || strings.Contains(version, "/") {
+		respondErr(c, http.StatusBadRequest, "invalid release version")
+		return "", false
+	}
+	return version, true
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/aak1247/logtap/internal/cursor"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,6 +22,31 @@ func respondOK(c *gin.Context, data any) {
 	})
 }
 
+// respondPage is respondOK for a page of a keyset-paged list; next, when not
+// empty, is passed back as cursor= for the following page:
+//
+//	{"code":0,"data":[...],"next_cursor":"..."}
+func respondPage(c *gin.Context, data any, next string) {
+	out := gin.H{
+		"code": 0,
+		"data": data,
+	}
+	if next != "" {
+		out["next_cursor"] = next
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// parseCursor reads the cursor parameter, responding 400 when it is invalid.
+func parseCursor(c *gin.Context) (*cursor.Cursor, bool) {
+	after, err := cursor.Parse(c.Query("cursor"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return after, true
+}
+
 func respondErr(c *gin.Context, status int, errMsg string) {
 	errMsg = strings.TrimSpace(errMsg)
 	if errMsg == "" {
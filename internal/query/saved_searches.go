@@ -0,0 +1,357 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/channel"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/savedsearch"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type savedSearchRequest struct {
+	Name              *string                  `json:"name"`
+	Description       *string                  `json:"description"`
+	Query             *string                  `json:"query"`
+	Sources           *string                  `json:"sources"`
+	Start             *string                  `json:"start"`
+	End               *string                  `json:"end"`
+	Columns           *[]string                `json:"columns"`
+	Sort              *string                  `json:"sort"`
+	Shared            *bool                    `json:"shared"`
+	ScheduleEnabled   *bool                    `json:"schedule_enabled"`
+	ScheduleFrequency *string                  `json:"schedule_frequency"`
+	ScheduleWeekday   *int                     `json:"schedule_weekday"`
+	ScheduleHourUTC   *int                     `json:"schedule_hour_utc"`
+	ScheduleMinuteUTC *int                     `json:"schedule_minute_utc"`
+	DeliveryFormat    *string                  `json:"delivery_format"`
+	DeliveryRows      *int                     `json:"delivery_rows"`
+	Channels          *[]channel.ChannelConfig `json:"channels"`
+}
+
+// apply sets the fields given in req on s and returns the changed columns,
+// and whether the change moves the next scheduled run.
+func (req savedSearchRequest) apply(s *model.SavedSearch) (map[string]any, bool) {
+	updates := map[string]any{}
+	reschedule := false
+	setString := func(dst *string, v *string, col string, lower bool) {
+		if v == nil {
+			return
+		}
+		next := strings.TrimSpace(*v)
+		if lower {
+			next = strings.ToLower(next)
+		}
+		if next != *dst {
+			*dst = next
+			updates[col] = next
+		}
+	}
+	setInt := func(dst *int, v *int, col string) {
+		if v != nil && *v != *dst {
+			*dst = *v
+			updates[col] = *v
+			reschedule = true
+		}
+	}
+	setString(&s.Name, req.Name, "name", false)
+	setString(&s.Description, req.Description, "description", false)
+	setString(&s.Query, req.Query, "query", false)
+	setString(&s.Sources, req.Sources, "sources", true)
+	setString(&s.Start, req.Start, "range_start", false)
+	setString(&s.End, req.End, "range_end", false)
+	setString(&s.Sort, req.Sort, "sort", true)
+	if req.Columns != nil {
+		columns := make([]string, 0, len(*req.Columns))
+		for _, col := range *req.Columns {
+			if col = strings.TrimSpace(col); col != "" {
+				columns = append(columns, col)
+			}
+		}
+		b, _ := json.Marshal(columns)
+		if string(b) != string(s.Columns) {
+			s.Columns = b
+			updates["columns"] = s.Columns
+		}
+	}
+	if req.Shared != nil && *req.Shared != s.Shared {
+		s.Shared = *req.Shared
+		updates["shared"] = s.Shared
+	}
+	if req.ScheduleEnabled != nil && *req.ScheduleEnabled != s.ScheduleEnabled {
+		s.ScheduleEnabled = *req.ScheduleEnabled
+		updates["schedule_enabled"] = s.ScheduleEnabled
+		reschedule = true
+	}
+	frequency := s.ScheduleFrequency
+	setString(&s.ScheduleFrequency, req.ScheduleFrequency, "schedule_frequency", true)
+	reschedule = reschedule || frequency != s.ScheduleFrequency
+	setInt(&s.ScheduleWeekday, req.ScheduleWeekday, "schedule_weekday")
+	setInt(&s.ScheduleHourUTC, req.ScheduleHourUTC, "schedule_hour_utc")
+	setInt(&s.ScheduleMinuteUTC, req.ScheduleMinuteUTC, "schedule_minute_utc")
+	setString(&s.DeliveryFormat, req.DeliveryFormat, "delivery_format", true)
+	if req.DeliveryRows != nil && *req.DeliveryRows != s.DeliveryRows {
+		s.DeliveryRows = *req.DeliveryRows
+		updates["delivery_rows"] = s.DeliveryRows
+	}
+	if req.Channels != nil {
+		b, _ := json.Marshal(*req.Channels)
+		if string(b) != string(s.Channels) {
+			s.Channels = b
+			updates["channels"] = s.Channels
+		}
+	}
+	return updates, reschedule
+}
+
+// ListSavedSearchesHandler lists the project's saved searches the caller
+// owns or that are shared; q filters them by name.
+func ListSavedSearchesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		uid := userIDFromGin(c)
+		if uid <= 0 {
+			respondErr(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		q := db.WithContext(ctx).
+			Where("project_id = ? AND (owner_user_id = ? OR shared = ?)", projectID, uid, true)
+		if name := strings.TrimSpace(c.Query("q")); name != "" {
+			q = q.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(name)+"%")
+		}
+		var items []model.SavedSearch
+		if err := q.Order("id DESC").Find(&items).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"items": items})
+	}
+}
+
+// CreateSavedSearchHandler saves a search owned by the caller. It is private
+// unless shared; sort defaults to desc and the schedule, when enabled, to
+// every Monday 09:00 UTC sending the hit count.
+func CreateSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		uid := userIDFromGin(c)
+		if uid <= 0 {
+			respondErr(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var req savedSearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		row := model.SavedSearch{
+			ProjectID:         projectID,
+			OwnerUserID:       uid,
+			Columns:           []byte("[]"),
+			Sort:              "desc",
+			ScheduleFrequency: savedsearch.Weekly,
+			ScheduleWeekday:   int(time.Monday),
+			ScheduleHourUTC:   9,
+			DeliveryFormat:    savedsearch.FormatCount,
+			DeliveryRows:      20,
+			Channels:          []byte("[]"),
+		}
+		req.apply(&row)
+		if err := savedsearch.Validate(row); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if row.ScheduleEnabled {
+			next := savedsearch.NextRun(row, time.Now())
+			row.NextRunAt = &next
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		if err := db.WithContext(ctx).Create(&row).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+// GetSavedSearchHandler returns a saved search the caller owns or that is
+// shared.
+func GetSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		row, ok := loadSavedSearch(ctx, c, db, false)
+		if !ok {
+			return
+		}
+		respondOK(c, row)
+	}
+}
+
+// UpdateSavedSearchHandler changes the fields given; only the owner can.
+// Changing the schedule moves its next run.
+func UpdateSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req savedSearchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		cur, ok := loadSavedSearch(ctx, c, db, true)
+		if !ok {
+			return
+		}
+		next := cur
+		updates, reschedule := req.apply(&next)
+		if len(updates) == 0 {
+			respondOK(c, cur)
+			return
+		}
+		if err := savedsearch.Validate(next); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if reschedule {
+			next.NextRunAt = nil
+			if next.ScheduleEnabled {
+				t := savedsearch.NextRun(next, time.Now())
+				next.NextRunAt = &t
+			}
+			updates["next_run_at"] = next.NextRunAt
+		}
+		if err := db.WithContext(ctx).Model(&model.SavedSearch{}).
+			Where("id = ?", cur.ID).
+			Updates(updates).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, next)
+	}
+}
+
+// DeleteSavedSearchHandler deletes a saved search; only the owner can.
+func DeleteSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		row, ok := loadSavedSearch(ctx, c, db, true)
+		if !ok {
+			return
+		}
+		if err := db.WithContext(ctx).Delete(&model.SavedSearch{}, row.ID).Error; err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, gin.H{"deleted": true})
+	}
+}
+
+// RunSavedSearchHandler runs a saved search now and returns the report its
+// schedule would send: {"report":{total,hits,title,content,...}}. With
+// deliver=1 the owner also queues it to the search's channels.
+func RunSavedSearchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		deliver := c.Query("deliver") == "1" || strings.EqualFold(c.Query("deliver"), "true")
+		row, ok := loadSavedSearch(ctx, c, db, deliver)
+		if !ok {
+			return
+		}
+		now := time.Now().UTC()
+		report, err := savedsearch.Run(ctx, db, row, now)
+		if err != nil {
+			if errors.Is(err, search.ErrInvalidQuery) {
+				respondErr(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		queued := 0
+		if deliver {
+			if queued, err = savedsearch.Deliver(ctx, db, row, report, now); err != nil {
+				respondErr(c, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+		}
+		respondOK(c, gin.H{"report": report, "queued": queued})
+	}
+}
+
+// loadSavedSearch loads the saved search of the route for the caller: one
+// they own, or with write unset one that is shared.
+func loadSavedSearch(ctx context.Context, c *gin.Context, db *gorm.DB, write bool) (model.SavedSearch, bool) {
+	if db == nil {
+		respondErr(c, http.StatusNotImplemented, "database not configured")
+		return model.SavedSearch{}, false
+	}
+	projectID, err := project.ParseID(c.Param("projectId"))
+	if err != nil {
+		respondErr(c, http.StatusBadRequest, err.Error())
+		return model.SavedSearch{}, false
+	}
+	uid := userIDFromGin(c)
+	if uid <= 0 {
+		respondErr(c, http.StatusUnauthorized, "unauthorized")
+		return model.SavedSearch{}, false
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(c.Param("searchId")))
+	if err != nil || id <= 0 {
+		respondErr(c, http.StatusBadRequest, "invalid searchId")
+		return model.SavedSearch{}, false
+	}
+	var row model.SavedSearch
+	if err := db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, id).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondErr(c, http.StatusNotFound, "not found")
+			return model.SavedSearch{}, false
+		}
+		respondErr(c, http.StatusServiceUnavailable, err.Error())
+		return model.SavedSearch{}, false
+	}
+	if row.OwnerUserID != uid {
+		if !row.Shared {
+			respondErr(c, http.StatusNotFound, "not found")
+			return model.SavedSearch{}, false
+		}
+		if write {
+			respondErr(c, http.StatusForbidden, "only the owner can change a saved search")
+			return model.SavedSearch{}, false
+		}
+	}
+	return row, true
+}
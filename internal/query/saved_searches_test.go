@@ -0,0 +1,144 @@
+package query_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func TestSavedSearches(t *testing.T) {
+	srv := testkit.NewServer(t)
+	client := srv.HTTP.Client()
+	boot := testkit.Bootstrap(t, client, srv.HTTP.URL)
+	headers := map[string]string{"Authorization": "Bearer " + boot.Token}
+	base := fmt.Sprintf("%s/api/%d/saved-searches", srv.HTTP.URL, boot.ProjectID)
+
+	now := time.Now().UTC()
+	logs := []model.Log{
+		{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Hour), Level: "error", Message: "first", Fields: []byte(`{"service":"api"}`)},
+		{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Minute), Level: "error", Message: "second", Fields: []byte(`{"service":"web"}`)},
+		{ProjectID: boot.ProjectID, Timestamp: now.Add(-time.Minute), Level: "info", Message: "fine", Fields: []byte(`{}`)},
+	}
+	if err := srv.DB.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	others := []model.SavedSearch{
+		{ProjectID: boot.ProjectID, OwnerUserID: 9999, Name: "shared", Shared: true, Sort: "desc", ScheduleFrequency: "weekly", DeliveryFormat: "count", DeliveryRows: 20, Columns: []byte("[]"), Channels: []byte("[]")},
+		{ProjectID: boot.ProjectID, OwnerUserID: 9999, Name: "private", Sort: "desc", ScheduleFrequency: "weekly", DeliveryFormat: "count", DeliveryRows: 20, Columns: []byte("[]"), Channels: []byte("[]")},
+	}
+	if err := srv.DB.Create(&others).Error; err != nil {
+		t.Fatalf("create searches: %v", err)
+	}
+
+	type savedSearch struct {
+		ID              int        `json:"id"`
+		Name            string     `json:"name"`
+		Sort            string     `json:"sort"`
+		ScheduleEnabled bool       `json:"schedule_enabled"`
+		NextRunAt       *time.Time `json:"next_run_at"`
+	}
+	decode := func(body []byte, out any) {
+		t.Helper()
+		if err := json.Unmarshal(testkit.DecodeEnvelope(t, body).Data, out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+
+	status, body := testkit.DoJSON(t, client, http.MethodPost, base, map[string]any{
+		"name":    "errors",
+		"query":   "level:error",
+		"start":   "now-1d",
+		"columns": []string{"message", "service"},
+		"sort":    "asc",
+	}, headers)
+	if status != http.StatusOK {
+		t.Fatalf("create: status=%d body=%s", status, body)
+	}
+	var mine savedSearch
+	decode(body, &mine)
+	if mine.Sort != "asc" || mine.ScheduleEnabled || mine.NextRunAt != nil {
+		t.Fatalf("created = %+v", mine)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodPost, base, map[string]any{"name": "bad", "sort": "up"}, headers)
+	if status != http.StatusBadRequest {
+		t.Fatalf("invalid: status=%d body=%s", status, body)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodGet, base, nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("list: status=%d body=%s", status, body)
+	}
+	var list struct {
+		Items []savedSearch `json:"items"`
+	}
+	decode(body, &list)
+	if len(list.Items) != 2 || list.Items[0].Name != "errors" || list.Items[1].Name != "shared" {
+		t.Fatalf("list = %+v", list.Items)
+	}
+
+	// Others' searches: shared ones can be read but not changed.
+	if status, _ = testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/%d", base, others[1].ID), nil, headers); status != http.StatusNotFound {
+		t.Fatalf("private: status=%d", status)
+	}
+	if status, _ = testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/%d", base, others[0].ID), nil, headers); status != http.StatusOK {
+		t.Fatalf("shared: status=%d", status)
+	}
+	if status, _ = testkit.DoJSON(t, client, http.MethodPut, fmt.Sprintf("%s/%d", base, others[0].ID), map[string]any{"name": "x"}, headers); status != http.StatusForbidden {
+		t.Fatalf("update shared: status=%d", status)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodPut, fmt.Sprintf("%s/%d", base, mine.ID), map[string]any{"schedule_enabled": true}, headers)
+	if status != http.StatusBadRequest {
+		t.Fatalf("schedule without channels: status=%d body=%s", status, body)
+	}
+	status, body = testkit.DoJSON(t, client, http.MethodPut, fmt.Sprintf("%s/%d", base, mine.ID), map[string]any{
+		"schedule_enabled":   true,
+		"schedule_frequency": "daily",
+		"schedule_hour_utc":  6,
+		"delivery_format":    "csv",
+		"channels":           []map[string]any{{"type": "webhook", "config": map[string]any{"url": "https://example.com/hook"}}},
+	}, headers)
+	if status != http.StatusOK {
+		t.Fatalf("schedule: status=%d body=%s", status, body)
+	}
+	decode(body, &mine)
+	if !mine.ScheduleEnabled || mine.NextRunAt == nil || mine.NextRunAt.Hour() != 6 || !mine.NextRunAt.After(now) {
+		t.Fatalf("scheduled = %+v", mine)
+	}
+
+	status, body = testkit.DoJSON(t, client, http.MethodPost, fmt.Sprintf("%s/%d/run?deliver=1", base, mine.ID), nil, headers)
+	if status != http.StatusOK {
+		t.Fatalf("run: status=%d body=%s", status, body)
+	}
+	var run struct {
+		Report struct {
+			Total int64 `json:"total"`
+			Hits  []struct {
+				Message string `json:"message"`
+			} `json:"hits"`
+			Content string `json:"content"`
+		} `json:"report"`
+		Queued int `json:"queued"`
+	}
+	decode(body, &run)
+	if run.Report.Total != 2 || len(run.Report.Hits) != 2 || run.Report.Hits[0].Message != "first" || run.Queued != 1 {
+		t.Fatalf("run = %+v", run)
+	}
+	var n int64
+	srv.DB.Model(&model.AlertDelivery{}).Where("project_id = ? AND channel_type = ?", boot.ProjectID, "webhook").Count(&n)
+	if n != 1 {
+		t.Fatalf("deliveries = %d", n)
+	}
+
+	if status, _ = testkit.DoJSON(t, client, http.MethodDelete, fmt.Sprintf("%s/%d", base, mine.ID), nil, headers); status != http.StatusOK {
+		t.Fatalf("delete: status=%d", status)
+	}
+	if status, _ = testkit.DoJSON(t, client, http.MethodGet, fmt.Sprintf("%s/%d", base, mine.ID), nil, headers); status != http.StatusNotFound {
+		t.Fatalf("deleted: status=%d", status)
+	}
+}
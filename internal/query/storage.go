@@ -7,6 +7,7 @@ import (
 
 	"github.com/aak1247/logtap/internal/project"
 	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/timescale"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -31,6 +32,14 @@ func StorageEstimateHandler(db *gorm.DB) gin.HandlerFunc {
 			respondErr(c, http.StatusServiceUnavailable, err.Error())
 			return
 		}
+		compression, err := timescale.Compression(ctx, db)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if len(compression) > 0 {
+			est.Compression = compression
+		}
 		respondOK(c, est)
 	}
 }
@@ -0,0 +1,87 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/timescale"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GetTimescaleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		status, err := timescale.GetStatus(ctx, db)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, status)
+	}
+}
+
+func UpdateTimescaleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil {
+			respondErr(c, http.StatusNotImplemented, "database not configured")
+			return
+		}
+		var req struct {
+			CompressAfterDays    *int  `json:"compress_after_days"`
+			RetentionEnabled     *bool `json:"retention_enabled"`
+			ContinuousAggregates *bool `json:"continuous_aggregates"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondErr(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Policy changes (compression setup, aggregate creation) can take a while.
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+
+		next, _, err := store.GetTimescaleSettings(ctx, db)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if req.CompressAfterDays != nil {
+			next.CompressAfterDays = *req.CompressAfterDays
+		}
+		if req.RetentionEnabled != nil {
+			next.RetentionEnabled = *req.RetentionEnabled
+		}
+		if req.ContinuousAggregates != nil {
+			next.ContinuousAggregates = *req.ContinuousAggregates
+		}
+		if next.CompressAfterDays < 0 || next.CompressAfterDays > 3650 {
+			respondErr(c, http.StatusBadRequest, "invalid compress_after_days (expected 0..3650)")
+			return
+		}
+
+		saved, err := store.UpsertTimescaleSettings(ctx, db, next)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err := timescale.Apply(ctx, db, saved); err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		status, err := timescale.GetStatus(ctx, db)
+		if err != nil {
+			respondErr(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondOK(c, status)
+	}
+}
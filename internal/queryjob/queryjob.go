@@ -0,0 +1,649 @@
+// Package queryjob runs long queries in the background. A submitted query
+// becomes a Job that waits in a bounded queue until one of a fixed number of
+// workers picks it up, at most PerProject at a time for one project. Jobs
+// report progress and partial results while they run, can be cancelled, and
+// their results are cached by query for CacheTTL so the same query submitted
+// again finishes at once.
+//
+// A job runs on the gateway it was submitted to, but its state is kept in
+// the query_jobs table as well, so behind several gateways any of them can
+// poll it, and cancel it by flagging the row for the gateway running it.
+package queryjob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotFound  = errors.New("queryjob: job not found")
+	ErrQueueFull = errors.New("queryjob: too many queued jobs")
+	ErrClosed    = errors.New("queryjob: manager closed")
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Done reports whether a job in status s has finished.
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+const (
+	DefaultWorkers    = 4
+	DefaultPerProject = 2
+	DefaultTimeout    = 10 * time.Minute
+	DefaultCacheTTL   = 5 * time.Minute
+	DefaultMaxQueued  = 100
+	// DefaultRetention is how long a finished job can still be polled.
+	DefaultRetention = 30 * time.Minute
+	// DefaultSyncInterval is how often job state is written to query_jobs
+	// and cancellations from other gateways are picked up.
+	DefaultSyncInterval = time.Second
+)
+
+// Job is a snapshot of a submitted query.
+type Job struct {
+	ID         string     `json:"id"`
+	ProjectID  int        `json:"project_id"`
+	Kind       string     `json:"kind"`
+	Status     Status     `json:"status"`
+	Progress   float64    `json:"progress"`
+	Partial    any        `json:"partial,omitempty"`
+	Result     any        `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Cached     bool       `json:"cached"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Func runs a job's query with db, which on PostgreSQL is pinned to the one
+// connection the job may be cancelled on. report publishes progress, in
+// 0..1, and the partial result so far.
+type Func func(ctx context.Context, db *gorm.DB, report func(progress float64, partial any)) (any, error)
+
+// Key identifies a query for the result cache: the hash of its kind, project
+// and normalized request. Requests should keep relative times (an empty end
+// meaning now) unresolved so reopening the same view hits the cache.
+func Key(kind string, projectID int, req any) string {
+	b, _ := json.Marshal(struct {
+		Kind    string `json:"k"`
+		Project int    `json:"p"`
+		Req     any    `json:"r"`
+	}{kind, projectID, req})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+type entry struct {
+	job    Job
+	key    string
+	run    Func
+	cancel context.CancelFunc
+
+	// pid is the PostgreSQL backend running the job. pidMu is held while
+	// the backend is cancelled so the connection cannot be released and
+	// handed to another query in between.
+	pidMu sync.Mutex
+	pid   int64
+}
+
+type cached struct {
+	result  any
+	expires time.Time
+}
+
+// Manager queues and runs jobs. The zero values of its fields are replaced
+// by the defaults when the first job is submitted.
+type Manager struct {
+	DB         *gorm.DB
+	Workers    int
+	PerProject int
+	Timeout    time.Duration
+	CacheTTL   time.Duration // 0 disables the cache
+	MaxQueued  int
+	Retention  time.Duration
+	// SyncInterval paces the writes to query_jobs; Instance names this
+	// gateway in them (a random id by default).
+	SyncInterval time.Duration
+	Instance     string
+
+	once    sync.Once
+	mu      sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	jobs    map[string]*entry
+	queue   []*entry
+	running map[int]int // project id -> running jobs
+	cache   map[string]cached
+	dirty   map[string]*entry // jobs changed since the last sync
+	stop    chan struct{}
+	synced  chan struct{}
+}
+
+// NewManager returns a manager with the default limits.
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{
+		DB:         db,
+		Workers:    DefaultWorkers,
+		PerProject: DefaultPerProject,
+		Timeout:    DefaultTimeout,
+		CacheTTL:   DefaultCacheTTL,
+		MaxQueued:  DefaultMaxQueued,
+		Retention:  DefaultRetention,
+
+		SyncInterval: DefaultSyncInterval,
+	}
+}
+
+func (m *Manager) start() {
+	m.once.Do(func() {
+		if m.Workers <= 0 {
+			m.Workers = DefaultWorkers
+		}
+		if m.PerProject <= 0 {
+			m.PerProject = DefaultPerProject
+		}
+		if m.Timeout <= 0 {
+			m.Timeout = DefaultTimeout
+		}
+		if m.MaxQueued <= 0 {
+			m.MaxQueued = DefaultMaxQueued
+		}
+		if m.Retention <= 0 {
+			m.Retention = DefaultRetention
+		}
+		if m.SyncInterval <= 0 {
+			m.SyncInterval = DefaultSyncInterval
+		}
+		if m.Instance == "" {
+			m.Instance = uuid.NewString()
+		}
+		m.cond = sync.NewCond(&m.mu)
+		m.jobs = map[string]*entry{}
+		m.running = map[int]int{}
+		m.cache = map[string]cached{}
+		m.dirty = map[string]*entry{}
+		m.stop = make(chan struct{})
+		m.synced = make(chan struct{})
+		for i := 0; i < m.Workers; i++ {
+			go m.work()
+		}
+		if m.DB != nil {
+			go m.sync()
+		} else {
+			close(m.synced)
+		}
+	})
+}
+
+// Submit queues run for projectID. When key's result is cached the returned
+// job has already succeeded; when a job for key is still queued or running
+// that job is returned instead of a new one.
+func (m *Manager) Submit(projectID int, kind, key string, run Func) (Job, error) {
+	m.start()
+	now := time.Now().UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Job{}, ErrClosed
+	}
+	m.sweep(now)
+	if c, ok := m.cache[key]; ok && key != "" {
+		e := &entry{key: key, job: Job{
+			ID: uuid.NewString(), ProjectID: projectID, Kind: kind,
+			Status: StatusSucceeded, Progress: 1, Result: c.result, Cached: true,
+			CreatedAt: now, StartedAt: &now, FinishedAt: &now,
+		}}
+		m.jobs[e.job.ID] = e
+		m.dirty[e.job.ID] = e
+		return e.job, nil
+	}
+	if key != "" {
+		for _, e := range m.jobs {
+			if e.key == key && e.job.ProjectID == projectID && !e.job.Status.Done() {
+				return e.job, nil
+			}
+		}
+	}
+	if len(m.queue) >= m.MaxQueued {
+		return Job{}, ErrQueueFull
+	}
+	e := &entry{key: key, run: run, job: Job{
+		ID: uuid.NewString(), ProjectID: projectID, Kind: kind,
+		Status: StatusQueued, CreatedAt: now,
+	}}
+	m.jobs[e.job.ID] = e
+	m.dirty[e.job.ID] = e
+	m.queue = append(m.queue, e)
+	m.cond.Signal()
+	return e.job, nil
+}
+
+// Get returns the job with id if it belongs to projectID, from query_jobs
+// when another gateway runs it.
+func (m *Manager) Get(ctx context.Context, projectID int, id string) (Job, error) {
+	m.start()
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	var job Job
+	if ok {
+		job = e.job
+	}
+	m.mu.Unlock()
+	if !ok {
+		return m.load(ctx, projectID, id)
+	}
+	if job.ProjectID != projectID {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+// Cancel stops the job with id. A queued job leaves the queue; a running one
+// has its context cancelled and, on PostgreSQL, its statement cancelled with
+// pg_cancel_backend. Cancelling a finished job changes nothing. A job another
+// gateway runs is flagged in query_jobs and cancelled by that gateway within
+// SyncInterval; the job is returned as it was.
+func (m *Manager) Cancel(ctx context.Context, projectID int, id string) (Job, error) {
+	m.start()
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return m.cancelRemote(ctx, projectID, id)
+	}
+	if e.job.ProjectID != projectID {
+		m.mu.Unlock()
+		return Job{}, ErrNotFound
+	}
+	m.mu.Unlock()
+	return m.cancel(ctx, e), nil
+}
+
+// cancel stops e, which this manager runs.
+func (m *Manager) cancel(ctx context.Context, e *entry) Job {
+	m.mu.Lock()
+	running := e.job.Status == StatusRunning
+	switch e.job.Status {
+	case StatusQueued:
+		for i, q := range m.queue {
+			if q == e {
+				m.queue = append(m.queue[:i], m.queue[i+1:]...)
+				break
+			}
+		}
+		m.finish(e, StatusCanceled, nil, "canceled")
+	case StatusRunning:
+		m.finish(e, StatusCanceled, nil, "canceled")
+	}
+	job := e.job
+	m.mu.Unlock()
+
+	if running {
+		e.pidMu.Lock()
+		if e.pid != 0 {
+			if err := m.DB.WithContext(ctx).Exec("SELECT pg_cancel_backend(?)", e.pid).Error; err != nil {
+				log.Printf("queryjob: cancel backend %d: %v", e.pid, err)
+			}
+		}
+		e.pidMu.Unlock()
+		e.cancel()
+	}
+	return job
+}
+
+// Close stops the workers once their current jobs end, cancels the queued
+// and running ones and records that in query_jobs.
+func (m *Manager) Close() {
+	m.start()
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	for _, e := range m.queue {
+		m.finish(e, StatusCanceled, nil, "canceled")
+	}
+	m.queue = nil
+	var running []*entry
+	for _, e := range m.jobs {
+		if e.job.Status == StatusRunning {
+			running = append(running, e)
+		}
+	}
+	m.cond.Broadcast()
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, e := range running {
+		m.cancel(ctx, e)
+	}
+	close(m.stop)
+	<-m.synced
+}
+
+func (m *Manager) work() {
+	for {
+		m.mu.Lock()
+		var e *entry
+		for !m.closed {
+			if e = m.next(); e != nil {
+				break
+			}
+			m.cond.Wait()
+		}
+		if m.closed {
+			m.mu.Unlock()
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+		now := time.Now().UTC()
+		e.cancel = cancel
+		e.job.Status = StatusRunning
+		e.job.StartedAt = &now
+		m.dirty[e.job.ID] = e
+		m.running[e.job.ProjectID]++
+		m.mu.Unlock()
+
+		result, err := m.exec(ctx, e)
+		cancel()
+
+		m.mu.Lock()
+		m.running[e.job.ProjectID]--
+		if m.running[e.job.ProjectID] <= 0 {
+			delete(m.running, e.job.ProjectID)
+		}
+		if e.job.Status == StatusRunning {
+			switch {
+			case err == nil:
+				m.finish(e, StatusSucceeded, result, "")
+				if m.CacheTTL > 0 && e.key != "" {
+					m.cache[e.key] = cached{result: result, expires: time.Now().Add(m.CacheTTL)}
+				}
+			case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+				m.finish(e, StatusFailed, nil, "query timed out after "+m.Timeout.String())
+			default:
+				m.finish(e, StatusFailed, nil, err.Error())
+			}
+		}
+		// A job finishing may let another of its project run.
+		m.cond.Broadcast()
+		m.mu.Unlock()
+	}
+}
+
+// next takes the oldest queued job whose project is below PerProject.
+func (m *Manager) next() *entry {
+	for i, e := range m.queue {
+		if m.running[e.job.ProjectID] < m.PerProject {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return e
+		}
+	}
+	return nil
+}
+
+func (m *Manager) exec(ctx context.Context, e *entry) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("query panicked")
+			log.Printf("queryjob: %s job %s panicked: %v", e.job.Kind, e.job.ID, r)
+		}
+	}()
+	report := func(progress float64, partial any) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if e.job.Status != StatusRunning {
+			return
+		}
+		if progress < 0 {
+			progress = 0
+		} else if progress > 1 {
+			progress = 1
+		}
+		e.job.Progress = progress
+		e.job.Partial = partial
+		m.dirty[e.job.ID] = e
+	}
+	db := m.DB.WithContext(ctx)
+	if !strings.EqualFold(db.Dialector.Name(), "postgres") {
+		return e.run(ctx, db, report)
+	}
+	// Pin one connection so the backend to cancel is known.
+	err = db.Connection(func(conn *gorm.DB) error {
+		var pid int64
+		if err := conn.Raw("SELECT pg_backend_pid()").Scan(&pid).Error; err != nil {
+			return err
+		}
+		e.pidMu.Lock()
+		e.pid = pid
+		e.pidMu.Unlock()
+		defer func() {
+			e.pidMu.Lock()
+			e.pid = 0
+			e.pidMu.Unlock()
+		}()
+		var runErr error
+		result, runErr = e.run(ctx, conn, report)
+		return runErr
+	})
+	return result, err
+}
+
+// finish records the end of e; callers hold m.mu.
+func (m *Manager) finish(e *entry, status Status, result any, errMsg string) {
+	now := time.Now().UTC()
+	e.job.Status = status
+	e.job.Result = result
+	e.job.Error = errMsg
+	e.job.FinishedAt = &now
+	if status == StatusSucceeded {
+		e.job.Progress = 1
+		e.job.Partial = nil
+	}
+	m.dirty[e.job.ID] = e
+}
+
+// sweep forgets expired cache entries and finished jobs past Retention;
+// callers hold m.mu.
+func (m *Manager) sweep(now time.Time) {
+	for k, c := range m.cache {
+		if now.After(c.expires) {
+			delete(m.cache, k)
+		}
+	}
+	for id, e := range m.jobs {
+		if e.job.FinishedAt != nil && now.Sub(*e.job.FinishedAt) > m.Retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// sync writes changed jobs to query_jobs every SyncInterval, keeps the
+// heartbeat of unfinished ones fresh, cancels those another gateway asked to
+// cancel and purges rows past Retention. It writes once more when the
+// manager closes.
+func (m *Manager) sync() {
+	defer close(m.synced)
+	ticker := time.NewTicker(m.SyncInterval)
+	defer ticker.Stop()
+	var purged time.Time
+	for {
+		select {
+		case <-m.stop:
+			m.flush()
+			return
+		case <-ticker.C:
+		}
+		live := m.flush()
+		if len(live) > 0 {
+			m.pollCancels(live)
+		}
+		if now := time.Now(); now.Sub(purged) > time.Minute {
+			purged = now
+			cutoff := now.UTC().Add(-m.Retention)
+			if err := m.DB.Where("finished_at < ? OR heartbeat_at < ?", cutoff, cutoff).
+				Delete(&model.QueryJob{}).Error; err != nil {
+				log.Printf("queryjob: purge: %v", err)
+			}
+		}
+	}
+}
+
+// flush writes the changed jobs and the heartbeat of the unfinished ones,
+// whose ids it returns.
+func (m *Manager) flush() []string {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	changed := make([]Job, 0, len(m.dirty))
+	for id, e := range m.dirty {
+		changed = append(changed, e.job)
+		delete(m.dirty, id)
+	}
+	var live []string
+	for id, e := range m.jobs {
+		if !e.job.Status.Done() {
+			live = append(live, id)
+		}
+	}
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db := m.DB.WithContext(ctx)
+	for _, job := range changed {
+		row := model.QueryJob{
+			ID: job.ID, ProjectID: job.ProjectID, Kind: job.Kind,
+			Status: string(job.Status), Progress: job.Progress, Error: job.Error,
+			Cached: job.Cached, Instance: m.Instance, HeartbeatAt: now,
+			CreatedAt: job.CreatedAt, StartedAt: job.StartedAt, FinishedAt: job.FinishedAt,
+		}
+		if job.Partial != nil {
+			row.Partial, _ = json.Marshal(job.Partial)
+		}
+		if job.Result != nil {
+			row.Result, _ = json.Marshal(job.Result)
+		}
+		// cancel_requested belongs to the other gateways.
+		err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"status", "progress", "partial", "result", "error", "heartbeat_at", "started_at", "finished_at",
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			log.Printf("queryjob: save job %s: %v", job.ID, err)
+			m.mu.Lock()
+			if e, ok := m.jobs[job.ID]; ok {
+				if _, again := m.dirty[job.ID]; !again {
+					m.dirty[job.ID] = e
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+	if len(live) > 0 {
+		if err := db.Model(&model.QueryJob{}).Where("id IN ?", live).
+			Update("heartbeat_at", now).Error; err != nil {
+			log.Printf("queryjob: heartbeat: %v", err)
+		}
+	}
+	return live
+}
+
+// pollCancels cancels the jobs among ids that another gateway flagged.
+func (m *Manager) pollCancels(ids []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var flagged []string
+	if err := m.DB.WithContext(ctx).Model(&model.QueryJob{}).
+		Where("id IN ? AND cancel_requested = ?", ids, true).
+		Pluck("id", &flagged).Error; err != nil {
+		log.Printf("queryjob: poll cancels: %v", err)
+		return
+	}
+	for _, id := range flagged {
+		m.mu.Lock()
+		e, ok := m.jobs[id]
+		m.mu.Unlock()
+		if ok {
+			m.cancel(ctx, e)
+		}
+	}
+}
+
+// staleAfter is how long an unfinished job's heartbeat may lag before its
+// gateway is taken to be gone.
+func (m *Manager) staleAfter() time.Duration {
+	return max(10*m.SyncInterval, 30*time.Second)
+}
+
+// load reads a job another gateway runs from query_jobs.
+func (m *Manager) load(ctx context.Context, projectID int, id string) (Job, error) {
+	if m.DB == nil {
+		return Job{}, ErrNotFound
+	}
+	var row model.QueryJob
+	err := m.DB.WithContext(ctx).Where("id = ? AND project_id = ?", id, projectID).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{
+		ID: row.ID, ProjectID: row.ProjectID, Kind: row.Kind,
+		Status: Status(row.Status), Progress: row.Progress, Error: row.Error,
+		Cached: row.Cached, CreatedAt: row.CreatedAt, StartedAt: row.StartedAt, FinishedAt: row.FinishedAt,
+	}
+	if len(row.Partial) > 0 {
+		job.Partial = json.RawMessage(row.Partial)
+	}
+	if len(row.Result) > 0 {
+		job.Result = json.RawMessage(row.Result)
+	}
+	if !job.Status.Done() && time.Since(row.HeartbeatAt) > m.staleAfter() {
+		job.Status = StatusFailed
+		job.Error = "the gateway running the job stopped"
+		job.Partial = nil
+		job.FinishedAt = &row.HeartbeatAt
+	}
+	return job, nil
+}
+
+// cancelRemote flags a job another gateway runs for cancellation.
+func (m *Manager) cancelRemote(ctx context.Context, projectID int, id string) (Job, error) {
+	if m.DB == nil {
+		return Job{}, ErrNotFound
+	}
+	if err := m.DB.WithContext(ctx).Model(&model.QueryJob{}).
+		Where("id = ? AND project_id = ? AND finished_at IS NULL", id, projectID).
+		Update("cancel_requested", true).Error; err != nil {
+		return Job{}, err
+	}
+	return m.load(ctx, projectID, id)
+}
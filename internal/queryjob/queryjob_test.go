@@ -0,0 +1,211 @@
+package queryjob_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/queryjob"
+	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/gorm"
+)
+
+func waitStatus(t *testing.T, m *queryjob.Manager, projectID int, id string, want queryjob.Status) queryjob.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(context.Background(), projectID, id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if job.Status == want {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s status=%s, want %s", id, job.Status, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// blocking returns a job func that runs until release is closed or its
+// context ends, and a channel that receives once it started.
+func blocking(release <-chan struct{}) (queryjob.Func, <-chan struct{}) {
+	started := make(chan struct{}, 1)
+	return func(ctx context.Context, _ *gorm.DB, report func(float64, any)) (any, error) {
+		started <- struct{}{}
+		report(0.5, []int{1})
+		select {
+		case <-release:
+			return "done", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}, started
+}
+
+func TestManager_RunAndCache(t *testing.T) {
+	m := queryjob.NewManager(testkit.OpenTestDB(t))
+	defer m.Close()
+
+	runs := 0
+	run := func(ctx context.Context, db *gorm.DB, _ func(float64, any)) (any, error) {
+		runs++
+		var n int64
+		if err := db.Raw("SELECT 1").Scan(&n).Error; err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	key := queryjob.Key("test", 1, map[string]any{"q": "x"})
+	job, err := m.Submit(1, "test", key, run)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	done := waitStatus(t, m, 1, job.ID, queryjob.StatusSucceeded)
+	if done.Result != int64(1) || done.Progress != 1 || done.Cached {
+		t.Fatalf("job=%+v", done)
+	}
+
+	again, err := m.Submit(1, "test", key, run)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if again.Status != queryjob.StatusSucceeded || !again.Cached || again.Result != int64(1) || again.ID == job.ID {
+		t.Fatalf("cached job=%+v", again)
+	}
+	if runs != 1 {
+		t.Fatalf("runs=%d, want 1", runs)
+	}
+
+	if _, err := m.Get(context.Background(), 2, job.ID); !errors.Is(err, queryjob.ErrNotFound) {
+		t.Fatalf("Get from another project: %v", err)
+	}
+	if queryjob.Key("test", 2, map[string]any{"q": "x"}) == key {
+		t.Fatalf("key should depend on the project")
+	}
+}
+
+func TestManager_PerProjectLimitAndProgress(t *testing.T) {
+	m := queryjob.NewManager(testkit.OpenTestDB(t))
+	m.PerProject = 1
+	defer m.Close()
+
+	release := make(chan struct{})
+	run, started := blocking(release)
+	first, _ := m.Submit(1, "test", "a", run)
+	<-started
+	second, _ := m.Submit(1, "test", "b", run)
+	other, _ := m.Submit(2, "test", "c", run)
+	<-started
+
+	waitStatus(t, m, 2, other.ID, queryjob.StatusRunning)
+	cur := waitStatus(t, m, 1, first.ID, queryjob.StatusRunning)
+	if cur.Progress != 0.5 || cur.Partial == nil {
+		t.Fatalf("progress=%v partial=%v", cur.Progress, cur.Partial)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if job, _ := m.Get(context.Background(), 1, second.ID); job.Status != queryjob.StatusQueued {
+		t.Fatalf("second job of project 1 status=%s, want queued", job.Status)
+	}
+
+	dup, _ := m.Submit(1, "test", "b", run)
+	if dup.ID != second.ID {
+		t.Fatalf("queued query submitted again should return the same job")
+	}
+
+	close(release)
+	waitStatus(t, m, 1, first.ID, queryjob.StatusSucceeded)
+	waitStatus(t, m, 1, second.ID, queryjob.StatusSucceeded)
+}
+
+func TestManager_Cancel(t *testing.T) {
+	m := queryjob.NewManager(testkit.OpenTestDB(t))
+	m.PerProject = 1
+	defer m.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	run, started := blocking(release)
+	running, _ := m.Submit(1, "test", "a", run)
+	<-started
+	queued, _ := m.Submit(1, "test", "b", run)
+
+	job, err := m.Cancel(context.Background(), 1, queued.ID)
+	if err != nil || job.Status != queryjob.StatusCanceled {
+		t.Fatalf("cancel queued: job=%+v err=%v", job, err)
+	}
+	job, err = m.Cancel(context.Background(), 1, running.ID)
+	if err != nil || job.Status != queryjob.StatusCanceled {
+		t.Fatalf("cancel running: job=%+v err=%v", job, err)
+	}
+	// The worker is freed for the project's next job.
+	next, _ := m.Submit(1, "test", "c", run)
+	<-started
+	waitStatus(t, m, 1, next.ID, queryjob.StatusRunning)
+	if job, _ := m.Get(context.Background(), 1, running.ID); job.Status != queryjob.StatusCanceled {
+		t.Fatalf("cancelled job status=%s", job.Status)
+	}
+	if _, err := m.Cancel(context.Background(), 1, "missing"); !errors.Is(err, queryjob.ErrNotFound) {
+		t.Fatalf("cancel missing: %v", err)
+	}
+}
+
+func TestManager_TimeoutAndQueueFull(t *testing.T) {
+	m := queryjob.NewManager(testkit.OpenTestDB(t))
+	m.Workers = 1
+	m.Timeout = 20 * time.Millisecond
+	m.MaxQueued = 1
+	defer m.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	run, started := blocking(release)
+	job, _ := m.Submit(1, "test", "a", run)
+	<-started
+	if _, err := m.Submit(1, "test", "b", run); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if _, err := m.Submit(1, "test", "c", run); !errors.Is(err, queryjob.ErrQueueFull) {
+		t.Fatalf("err=%v, want ErrQueueFull", err)
+	}
+	failed := waitStatus(t, m, 1, job.ID, queryjob.StatusFailed)
+	if failed.Error == "" {
+		t.Fatalf("timed out job has no error")
+	}
+}
+
+func TestManager_SharedAcrossGateways(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	a, b := queryjob.NewManager(db), queryjob.NewManager(db)
+	a.SyncInterval, b.SyncInterval = 10*time.Millisecond, 10*time.Millisecond
+	defer a.Close()
+	defer b.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	run, started := blocking(release)
+	job, _ := a.Submit(1, "test", "a", run)
+	<-started
+
+	// The other gateway sees the job and its progress once it is synced.
+	var seen queryjob.Job
+	for deadline := time.Now().Add(5 * time.Second); seen.Status != queryjob.StatusRunning || seen.Progress != 0.5; {
+		if time.Now().After(deadline) {
+			t.Fatalf("job not synced: %+v", seen)
+		}
+		time.Sleep(5 * time.Millisecond)
+		seen, _ = b.Get(context.Background(), 1, job.ID)
+	}
+	if _, err := b.Get(context.Background(), 2, job.ID); !errors.Is(err, queryjob.ErrNotFound) {
+		t.Fatalf("other project: %v", err)
+	}
+
+	// A cancel sent to it reaches the gateway running the job.
+	if _, err := b.Cancel(context.Background(), 1, job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	waitStatus(t, a, 1, job.ID, queryjob.StatusCanceled)
+	waitStatus(t, b, 1, job.ID, queryjob.StatusCanceled)
+}
@@ -0,0 +1,241 @@
+// Package quota enforces per-project storage and daily volume quotas. The
+// Enforcer answers ingest-time questions from a short-lived cache; the Worker
+// refreshes stored bytes, notifies at 80% and 100%, and runs early cleanup.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aak1247/logtap/internal/channel"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	ActionReject     = "reject"
+	ActionDownsample = "downsample"
+	ActionCleanup    = "cleanup"
+
+	// WarnPercent and FullPercent are the usage levels owners are notified at.
+	WarnPercent = 80
+	FullPercent = 100
+)
+
+// Normalize validates the user-editable settings of q.
+func Normalize(q model.ProjectQuota) (model.ProjectQuota, error) {
+	q.Action = strings.ToLower(strings.TrimSpace(q.Action))
+	if q.Action == "" {
+		q.Action = ActionReject
+	}
+	switch q.Action {
+	case ActionReject, ActionDownsample, ActionCleanup:
+	default:
+		return q, errors.New("invalid action (expected reject|downsample|cleanup)")
+	}
+	if q.MaxStorageBytes < 0 || q.MaxDailyBytes < 0 || q.MaxDailyRows < 0 || q.MaxExportBytes < 0 {
+		return q, errors.New("limits must be >= 0")
+	}
+	if q.SampleRate < 0 || q.SampleRate > 1 {
+		return q, errors.New("invalid sample_rate (expected 0..1)")
+	}
+	if len(q.Channels) == 0 {
+		q.Channels = datatypes.JSON("[]")
+	}
+	var chans []channel.ChannelConfig
+	if err := json.Unmarshal(q.Channels, &chans); err != nil {
+		return q, errors.New("invalid channels")
+	}
+	for _, ch := range chans {
+		if strings.TrimSpace(ch.Type) == "" || len(ch.Config) == 0 {
+			return q, errors.New("channels require type and config")
+		}
+	}
+	return q, nil
+}
+
+// Status is a project's quota usage at one point in time.
+type Status struct {
+	Quota          model.ProjectQuota      `json:"quota"`
+	Today          model.ProjectUsageDaily `json:"today"`
+	StoragePercent int                     `json:"storage_percent"`
+	VolumePercent  int                     `json:"volume_percent"`
+	OverStorage    bool                    `json:"over_storage"`
+	OverVolume     bool                    `json:"over_volume"`
+}
+
+// Evaluate compares q against today's usage and the last measured storage.
+// A disabled quota is never over.
+func Evaluate(q model.ProjectQuota, today model.ProjectUsageDaily) Status {
+	s := Status{Quota: q, Today: today}
+	if !q.Enabled {
+		return s
+	}
+	if q.MaxStorageBytes > 0 {
+		s.StoragePercent = percent(q.StorageBytes, q.MaxStorageBytes)
+	}
+	if q.MaxDailyBytes > 0 {
+		s.VolumePercent = percent(today.LogBytes+today.EventBytes, q.MaxDailyBytes)
+	}
+	if q.MaxDailyRows > 0 {
+		if p := percent(today.Logs+today.Events, q.MaxDailyRows); p > s.VolumePercent {
+			s.VolumePercent = p
+		}
+	}
+	s.OverStorage = s.StoragePercent >= FullPercent
+	s.OverVolume = s.VolumePercent >= FullPercent
+	return s
+}
+
+// Reject reports whether ingest is refused. The cleanup action frees old
+// storage but cannot bound today's volume, so it rejects past a daily limit.
+func (s Status) Reject() bool {
+	switch s.Quota.Action {
+	case ActionReject:
+		return s.OverStorage || s.OverVolume
+	case ActionCleanup:
+		return s.OverVolume
+	default:
+		return false
+	}
+}
+
+// Downsample reports whether new rows are sampled at Quota.SampleRate.
+func (s Status) Downsample() bool {
+	return s.Quota.Action == ActionDownsample && (s.OverStorage || s.OverVolume)
+}
+
+func percent(used, limit int64) int {
+	if limit <= 0 {
+		return 0
+	}
+	return int(used * 100 / limit)
+}
+
+// Load reads the project's quota and today's usage.
+func Load(ctx context.Context, db *gorm.DB, projectID int, now time.Time) (Status, error) {
+	q, _, err := store.GetProjectQuota(ctx, db, projectID)
+	if err != nil {
+		return Status{}, err
+	}
+	q.ProjectID = projectID
+	today, err := store.GetProjectUsageDay(ctx, db, projectID, Day(now))
+	if err != nil {
+		return Status{}, err
+	}
+	return Evaluate(q, today), nil
+}
+
+// Day is the usage day of t.
+func Day(t time.Time) string { return t.UTC().Format("2006-01-02") }
+
+type cachedStatus struct {
+	status    Status
+	expiresAt time.Time
+}
+
+// Enforcer caches quota status per project for ingest decisions and counts
+// rows dropped by downsampling until they are recorded with the next usage
+// flush. Lookup errors fail open: quotas never block ingest on a bad read.
+type Enforcer struct {
+	DB  *gorm.DB
+	TTL time.Duration
+
+	mu      sync.Mutex
+	cache   map[int]cachedStatus
+	dropped map[int]int64
+	rand    func() float64
+}
+
+func NewEnforcer(db *gorm.DB) *Enforcer {
+	return &Enforcer{
+		DB:      db,
+		TTL:     30 * time.Second,
+		cache:   map[int]cachedStatus{},
+		dropped: map[int]int64{},
+		rand:    rand.Float64,
+	}
+}
+
+// Status returns the cached status of the project.
+func (e *Enforcer) Status(ctx context.Context, projectID int) (Status, bool) {
+	if e == nil || e.DB == nil || projectID <= 0 {
+		return Status{}, false
+	}
+	now := time.Now()
+	e.mu.Lock()
+	c, ok := e.cache[projectID]
+	e.mu.Unlock()
+	if ok && now.Before(c.expiresAt) {
+		return c.status, true
+	}
+	st, err := Load(ctx, e.DB, projectID, now)
+	if err != nil {
+		return Status{}, false
+	}
+	e.mu.Lock()
+	if len(e.cache) > 10000 {
+		e.cache = map[int]cachedStatus{}
+	}
+	e.cache[projectID] = cachedStatus{status: st, expiresAt: now.Add(e.TTL)}
+	e.mu.Unlock()
+	return st, true
+}
+
+// Reject reports whether ingest for the project is refused.
+func (e *Enforcer) Reject(ctx context.Context, projectID int) bool {
+	st, ok := e.Status(ctx, projectID)
+	return ok && st.Reject()
+}
+
+// Keep decides whether a row of the given level is stored. Error-level rows
+// are always kept; others are sampled while the project is downsampled.
+func (e *Enforcer) Keep(ctx context.Context, projectID int, level string) bool {
+	st, ok := e.Status(ctx, projectID)
+	if !ok || !st.Downsample() {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "error", "fatal", "critical":
+		return true
+	}
+	if e.rand() < st.Quota.SampleRate {
+		return true
+	}
+	e.mu.Lock()
+	e.dropped[projectID]++
+	e.mu.Unlock()
+	return false
+}
+
+// Usage adds the dropped counts collected since the last call to rows.
+func (e *Enforcer) Usage(rows []model.ProjectUsageDaily) []model.ProjectUsageDaily {
+	if e == nil {
+		return rows
+	}
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = map[int]int64{}
+	e.mu.Unlock()
+	if len(dropped) == 0 {
+		return rows
+	}
+	day := Day(time.Now())
+	for i := range rows {
+		if n, ok := dropped[rows[i].ProjectID]; ok && rows[i].Day == day {
+			rows[i].Dropped += n
+			delete(dropped, rows[i].ProjectID)
+		}
+	}
+	for projectID, n := range dropped {
+		rows = append(rows, model.ProjectUsageDaily{ProjectID: projectID, Day: day, Dropped: n})
+	}
+	return rows
+}
@@ -0,0 +1,215 @@
+package quota_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/quota"
+	"github.com/aak1247/logtap/internal/store"
+	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testkit.OpenTestDB(t)
+	if err := db.AutoMigrate(&model.CleanupPolicy{}, &model.ProjectQuota{}, &model.ProjectUsageDaily{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	return db
+}
+
+func TestEvaluate(t *testing.T) {
+	q := model.ProjectQuota{Enabled: true, MaxStorageBytes: 1000, MaxDailyRows: 10, Action: quota.ActionReject, StorageBytes: 850}
+	st := quota.Evaluate(q, model.ProjectUsageDaily{Logs: 4, Events: 1})
+	if st.StoragePercent != 85 || st.VolumePercent != 50 || st.OverStorage || st.OverVolume || st.Reject() {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	st = quota.Evaluate(q, model.ProjectUsageDaily{Logs: 10})
+	if !st.OverVolume || !st.Reject() {
+		t.Fatalf("expected reject over daily rows, got %+v", st)
+	}
+
+	q.Action = quota.ActionDownsample
+	st = quota.Evaluate(q, model.ProjectUsageDaily{Logs: 10})
+	if st.Reject() || !st.Downsample() {
+		t.Fatalf("expected downsample, got %+v", st)
+	}
+
+	q.Action = quota.ActionCleanup
+	q.StorageBytes = 2000
+	st = quota.Evaluate(q, model.ProjectUsageDaily{})
+	if !st.OverStorage || st.Reject() {
+		t.Fatalf("cleanup action should not reject over storage, got %+v", st)
+	}
+
+	q.Enabled = false
+	if st := quota.Evaluate(q, model.ProjectUsageDaily{Logs: 100}); st.Reject() || st.OverStorage || st.OverVolume {
+		t.Fatalf("disabled quota must not enforce, got %+v", st)
+	}
+}
+
+func TestEnforcerDownsampleKeepsErrorsAndCountsDrops(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	if _, err := store.UpsertProjectQuota(ctx, db, model.ProjectQuota{
+		ProjectID: 1, Enabled: true, MaxDailyRows: 1, Action: quota.ActionDownsample, SampleRate: 0,
+	}); err != nil {
+		t.Fatalf("UpsertProjectQuota: %v", err)
+	}
+	if q, _, _ := store.GetProjectQuota(ctx, db, 1); q.SampleRate != 0 || q.NotifyOwner {
+		t.Fatalf("expected zero values saved, got %+v", q)
+	}
+	if err := store.UpsertProjectUsageDailyBatch(ctx, db, []model.ProjectUsageDaily{{ProjectID: 1, Day: quota.Day(time.Now()), Logs: 5}}); err != nil {
+		t.Fatalf("UpsertProjectUsageDailyBatch: %v", err)
+	}
+
+	e := quota.NewEnforcer(db)
+	if e.Reject(ctx, 1) {
+		t.Fatalf("downsample must not reject")
+	}
+	if !e.Keep(ctx, 1, "ERROR") {
+		t.Fatalf("expected error rows kept")
+	}
+	if e.Keep(ctx, 1, "info") || e.Keep(ctx, 1, "debug") {
+		t.Fatalf("expected non-error rows dropped at sample_rate=0")
+	}
+	if !e.Keep(ctx, 2, "info") {
+		t.Fatalf("project without quota must keep rows")
+	}
+
+	rows := e.Usage(store.UsageRowsFromLogs([]model.Log{{ProjectID: 1, Message: "hello", Fields: datatypes.JSON(`{}`)}}))
+	if err := store.UpsertProjectUsageDailyBatch(ctx, db, rows); err != nil {
+		t.Fatalf("UpsertProjectUsageDailyBatch: %v", err)
+	}
+	got, err := store.GetProjectUsageDay(ctx, db, 1, quota.Day(time.Now()))
+	if err != nil {
+		t.Fatalf("GetProjectUsageDay: %v", err)
+	}
+	if got.Logs != 6 || got.LogBytes != 7 || got.Dropped != 2 {
+		t.Fatalf("unexpected usage %+v", got)
+	}
+	if rows := e.Usage(nil); len(rows) != 0 {
+		t.Fatalf("expected drops reset after Usage, got %+v", rows)
+	}
+}
+
+func TestWorkerNotifiesOwnerOncePerLevel(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	uid, err := store.CreateUser(ctx, db, "owner@example.com", "x")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	p, err := store.CreateProject(ctx, db, uid, "p")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	if _, err := store.UpsertProjectQuota(ctx, db, model.ProjectQuota{
+		ProjectID: p.ID, Enabled: true, MaxDailyRows: 10, Action: quota.ActionReject, NotifyOwner: true,
+		Channels: datatypes.JSON(`[{"type":"webhook","config":{"url":"https://example.com/hook"}}]`),
+	}); err != nil {
+		t.Fatalf("UpsertProjectQuota: %v", err)
+	}
+	if err := store.UpsertProjectUsageDailyBatch(ctx, db, []model.ProjectUsageDaily{{ProjectID: p.ID, Day: quota.Day(time.Now()), Logs: 8}}); err != nil {
+		t.Fatalf("UpsertProjectUsageDailyBatch: %v", err)
+	}
+
+	w := quota.NewWorker(db)
+	for i := 0; i < 2; i++ {
+		if err := w.RunOnce(ctx); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+
+	var deliveries []model.AlertDelivery
+	if err := db.Order("id ASC").Find(&deliveries).Error; err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("expected webhook and owner email once, got %d", len(deliveries))
+	}
+	var email *model.AlertDelivery
+	for i := range deliveries {
+		if deliveries[i].ChannelType == "email" {
+			email = &deliveries[i]
+		}
+	}
+	if email == nil || !strings.Contains(email.Title, "80%") {
+		t.Fatalf("expected owner email at 80%%, got %+v", deliveries)
+	}
+	var cfg struct {
+		Recipients []string `json:"recipients"`
+	}
+	if err := json.Unmarshal([]byte(email.Target), &cfg); err != nil || len(cfg.Recipients) != 1 || cfg.Recipients[0] != "owner@example.com" {
+		t.Fatalf("unexpected email target %q", email.Target)
+	}
+
+	if err := store.UpsertProjectUsageDailyBatch(ctx, db, []model.ProjectUsageDaily{{ProjectID: p.ID, Day: quota.Day(time.Now()), Logs: 2}}); err != nil {
+		t.Fatalf("UpsertProjectUsageDailyBatch: %v", err)
+	}
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	var n int64
+	if err := db.Model(&model.AlertDelivery{}).Where("title LIKE ?", "%100%%").Count(&n).Error; err != nil {
+		t.Fatalf("count deliveries: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 100%% notifications, got %d", n)
+	}
+}
+
+func TestWorkerCleanupDeletesOldestRows(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for i := 0; i < 20; i++ {
+		if err := db.Create(&model.Log{
+			ProjectID: 1,
+			Timestamp: now.Add(-time.Duration(20-i) * time.Hour),
+			Level:     "info",
+			Message:   strings.Repeat("x", 100),
+			Fields:    datatypes.JSON(`{}`),
+		}).Error; err != nil {
+			t.Fatalf("insert log: %v", err)
+		}
+	}
+	est, err := store.EstimateProjectStorage(ctx, db, 1, 200)
+	if err != nil {
+		t.Fatalf("EstimateProjectStorage: %v", err)
+	}
+	if _, err := store.UpsertProjectQuota(ctx, db, model.ProjectQuota{
+		ProjectID: 1, Enabled: true, MaxStorageBytes: est.TotalBytes / 2, Action: quota.ActionCleanup,
+	}); err != nil {
+		t.Fatalf("UpsertProjectQuota: %v", err)
+	}
+
+	if err := quota.NewWorker(db).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	var left []model.Log
+	if err := db.Where("project_id = ?", 1).Order("timestamp ASC").Find(&left).Error; err != nil {
+		t.Fatalf("list logs: %v", err)
+	}
+	if len(left) == 0 || len(left) > 9 {
+		t.Fatalf("expected storage brought under 90%% of quota, %d rows left", len(left))
+	}
+	if !left[len(left)-1].Timestamp.After(now.Add(-2 * time.Hour)) {
+		t.Fatalf("expected newest rows kept")
+	}
+	q, _, err := store.GetProjectQuota(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("GetProjectQuota: %v", err)
+	}
+	if q.StorageBytes > q.MaxStorageBytes || q.StorageCheckedAt == nil {
+		t.Fatalf("expected refreshed storage under quota, got %+v", q)
+	}
+}
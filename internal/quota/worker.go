@@ -0,0 +1,234 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aak1247/logtap/internal/channel"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// Worker periodically measures the storage of projects with an enabled quota,
+// notifies owners when usage crosses WarnPercent or FullPercent, and frees
+// space for projects with the cleanup action.
+type Worker struct {
+	DB              *gorm.DB
+	Interval        time.Duration
+	SampleSize      int
+	DeleteBatchSize int
+	MaxBatches      int
+	Now             func() time.Time
+}
+
+func NewWorker(db *gorm.DB) *Worker {
+	return &Worker{
+		DB:              db,
+		Interval:        5 * time.Minute,
+		SampleSize:      200,
+		DeleteBatchSize: 5000,
+		MaxBatches:      50,
+		Now:             time.Now,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	if w == nil || w.DB == nil {
+		return
+	}
+	_ = w.RunOnce(ctx)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = w.RunOnce(ctx)
+		}
+	}
+}
+
+func (w *Worker) RunOnce(ctx context.Context) error {
+	quotas, err := store.ListEnabledProjectQuotas(ctx, w.DB)
+	if err != nil {
+		log.Printf("quota: list quotas: %v", err)
+		return err
+	}
+	for _, q := range quotas {
+		projectCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		err := w.check(projectCtx, q)
+		cancel()
+		if err != nil {
+			log.Printf("quota: project=%d: %v", q.ProjectID, err)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) check(ctx context.Context, q model.ProjectQuota) error {
+	now := w.Now().UTC()
+	est, err := store.EstimateProjectStorage(ctx, w.DB, q.ProjectID, w.SampleSize)
+	if err != nil {
+		return err
+	}
+	if q.Action == ActionCleanup && q.MaxStorageBytes > 0 && est.TotalBytes >= q.MaxStorageBytes {
+		if est, err = w.freeStorage(ctx, q, est); err != nil {
+			return err
+		}
+	}
+	q.StorageBytes = est.TotalBytes
+
+	today, err := store.GetProjectUsageDay(ctx, w.DB, q.ProjectID, Day(now))
+	if err != nil {
+		return err
+	}
+	st := Evaluate(q, today)
+
+	updates := map[string]any{
+		"storage_bytes":      q.StorageBytes,
+		"storage_checked_at": now,
+	}
+	if q.VolumeAlertDay != Day(now) {
+		// Volume quotas are daily: start each day without an alert level.
+		q.VolumeAlertPercent = 0
+		updates["volume_alert_day"] = Day(now)
+		updates["volume_alert_percent"] = 0
+	}
+	if level := alertLevel(st.StoragePercent); level != q.StorageAlertPercent {
+		if level > q.StorageAlertPercent {
+			title := fmt.Sprintf("[logtap] project %d storage at %d%% of quota", q.ProjectID, st.StoragePercent)
+			content := fmt.Sprintf("stored=%d bytes quota=%d bytes action=%s", q.StorageBytes, q.MaxStorageBytes, q.Action)
+			if err := w.notify(ctx, q, title, content, now); err != nil {
+				return err
+			}
+		}
+		updates["storage_alert_percent"] = level
+	}
+	if level := alertLevel(st.VolumePercent); level > q.VolumeAlertPercent {
+		title := fmt.Sprintf("[logtap] project %d daily volume at %d%% of quota", q.ProjectID, st.VolumePercent)
+		content := fmt.Sprintf("day=%s rows=%d bytes=%d dropped=%d max_daily_rows=%d max_daily_bytes=%d action=%s",
+			today.Day, today.Logs+today.Events, today.LogBytes+today.EventBytes, today.Dropped, q.MaxDailyRows, q.MaxDailyBytes, q.Action)
+		if err := w.notify(ctx, q, title, content, now); err != nil {
+			return err
+		}
+		updates["volume_alert_percent"] = level
+	}
+	return store.UpdateProjectQuotaState(ctx, w.DB, q.ProjectID, updates)
+}
+
+// alertLevel maps a usage percentage to the notification level it reached.
+func alertLevel(pct int) int {
+	switch {
+	case pct >= FullPercent:
+		return FullPercent
+	case pct >= WarnPercent:
+		return WarnPercent
+	default:
+		return 0
+	}
+}
+
+// notify queues the message for the project owner (email) and the quota's
+// channels; the alert worker delivers it.
+func (w *Worker) notify(ctx context.Context, q model.ProjectQuota, title, content string, now time.Time) error {
+	var chans []channel.ChannelConfig
+	if len(q.Channels) > 0 {
+		if err := json.Unmarshal(q.Channels, &chans); err != nil {
+			return fmt.Errorf("invalid channels: %w", err)
+		}
+	}
+	if q.NotifyOwner {
+		p, ok, err := store.GetProjectByID(ctx, w.DB, q.ProjectID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			u, ok, err := store.GetUserByID(ctx, w.DB, p.OwnerUserID)
+			if err != nil {
+				return err
+			}
+			if ok && u.Email != "" {
+				cfg, _ := json.Marshal(map[string]any{"recipients": []string{u.Email}})
+				chans = append(chans, channel.ChannelConfig{Type: "email", Config: cfg})
+			}
+		}
+	}
+	if len(chans) == 0 {
+		return nil
+	}
+	deliveries := make([]model.AlertDelivery, 0, len(chans))
+	for _, ch := range chans {
+		deliveries = append(deliveries, model.AlertDelivery{
+			ProjectID:     q.ProjectID,
+			RuleID:        0,
+			ChannelType:   ch.Type,
+			Target:        string(ch.Config),
+			Title:         title,
+			Content:       content,
+			Status:        "pending",
+			Attempts:      0,
+			NextAttemptAt: now,
+		})
+	}
+	return w.DB.WithContext(ctx).Create(&deliveries).Error
+}
+
+// freeStorage deletes the project's oldest logs and events, in proportion to
+// their share of the estimate, until storage is back under 90% of the quota.
+// Projects that archive before deleting only get their retention run early,
+// so nothing is deleted unarchived.
+func (w *Worker) freeStorage(ctx context.Context, q model.ProjectQuota, est store.StorageEstimate) (store.StorageEstimate, error) {
+	policy, ok, err := store.GetCleanupPolicy(ctx, w.DB, q.ProjectID)
+	if err != nil {
+		return est, err
+	}
+	if ok && policy.ArchiveEnabled {
+		return est, store.ScheduleCleanupPolicyNow(ctx, w.DB, q.ProjectID, w.Now())
+	}
+
+	excess := est.TotalBytes - q.MaxStorageBytes*9/10
+	if excess <= 0 || est.TotalBytes <= 0 {
+		return est, nil
+	}
+	for _, t := range []struct {
+		name string
+		est  store.StorageEstimateTable
+	}{{"logs", est.Logs}, {"events", est.Events}} {
+		if t.est.AvgRowBytes <= 0 || t.est.EstBytes <= 0 {
+			continue
+		}
+		share := excess * t.est.EstBytes / est.TotalBytes
+		rows := share/t.est.AvgRowBytes + 1
+		if err := w.deleteOldest(ctx, t.name, q.ProjectID, rows); err != nil {
+			return est, err
+		}
+	}
+	log.Printf("quota: project=%d: freed storage over quota (was %d bytes, quota %d)", q.ProjectID, est.TotalBytes, q.MaxStorageBytes)
+	return store.EstimateProjectStorage(ctx, w.DB, q.ProjectID, w.SampleSize)
+}
+
+func (w *Worker) deleteOldest(ctx context.Context, table string, projectID int, rows int64) error {
+	batchSize := int64(w.DeleteBatchSize)
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+	before := w.Now().UTC().Add(time.Minute)
+	for i := 0; i < w.MaxBatches && rows > 0; i++ {
+		n, err := store.DeleteRowsBeforeBatched(ctx, w.DB, table, projectID, before, "", nil, int(min(rows, batchSize)))
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		rows -= n
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+// Package retention resolves a cleanup policy into the time bounds below which
+// rows of each table expire. Without rules every table has one bound; with
+// RetentionRules the table is split into buckets, one per rule plus the rows
+// no rule matches, each with its own bound.
+package retention
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	TableLogs        = "logs"
+	TableEvents      = "events"
+	TableTrackEvents = "track_events"
+
+	MaxRules = 50
+	MaxDays  = 3650
+)
+
+var fieldKeyRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// Bucket is a set of rows sharing one retention: rows of the project that
+// match Where (every row when empty) expire before Before.
+type Bucket struct {
+	Where  string
+	Args   []any
+	Before time.Time
+}
+
+// Rules decodes the policy's ordered retention rules.
+func Rules(p model.CleanupPolicy) ([]model.RetentionRule, error) {
+	if len(p.RetentionRules) == 0 {
+		return nil, nil
+	}
+	var rules []model.RetentionRule
+	if err := json.Unmarshal(p.RetentionRules, &rules); err != nil {
+		return nil, fmt.Errorf("invalid retention_rules: %w", err)
+	}
+	return rules, nil
+}
+
+// Encode normalizes and validates rules and returns them in the form stored
+// on the policy.
+func Encode(rules []model.RetentionRule) (datatypes.JSON, error) {
+	if rules == nil {
+		rules = []model.RetentionRule{}
+	}
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("too many retention_rules (max %d)", MaxRules)
+	}
+	for i := range rules {
+		r, err := normalize(rules[i])
+		if err != nil {
+			return nil, fmt.Errorf("retention_rules[%d]: %w", i, err)
+		}
+		rules[i] = r
+	}
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(b), nil
+}
+
+func normalize(r model.RetentionRule) (model.RetentionRule, error) {
+	r.Table = strings.ToLower(strings.TrimSpace(r.Table))
+	if r.Table == "" {
+		r.Table = TableLogs
+	}
+	levels := r.Levels[:0]
+	for _, l := range r.Levels {
+		if l = strings.ToLower(strings.TrimSpace(l)); l != "" {
+			levels = append(levels, l)
+		}
+	}
+	r.Levels = levels
+	if len(r.Levels) == 0 {
+		r.Levels = nil
+	}
+	r.Field = strings.TrimSpace(r.Field)
+
+	switch r.Table {
+	case TableLogs:
+		r.Field = strings.TrimPrefix(r.Field, "fields.")
+	case TableEvents:
+		r.Field = strings.TrimPrefix(r.Field, "data.")
+	case TableTrackEvents:
+		// Track events carry no level or properties; rules key on the name.
+		if len(r.Levels) > 0 {
+			return r, errors.New("track_events rules cannot match on levels")
+		}
+		if r.Field != "" && r.Field != "name" {
+			return r, errors.New(`track_events rules can only match field "name"`)
+		}
+	default:
+		return r, errors.New("invalid table (expected logs|events|track_events)")
+	}
+	if len(r.Levels) == 0 && r.Field == "" {
+		return r, errors.New("levels or field is required")
+	}
+	if r.Field != "" && !fieldKeyRe.MatchString(r.Field) {
+		return r, fmt.Errorf("invalid field %q", r.Field)
+	}
+	if r.Field == "" {
+		r.Value = ""
+	}
+	if r.Days < 0 || r.Days > MaxDays {
+		return r, fmt.Errorf("invalid days (expected 0..%d)", MaxDays)
+	}
+	return r, nil
+}
+
+// BaseDays is the table's retention for rows no rule matches.
+func BaseDays(p model.CleanupPolicy, table string) int {
+	switch table {
+	case TableLogs:
+		return p.LogsRetentionDays
+	case TableEvents:
+		return p.EventsRetentionDays
+	case TableTrackEvents:
+		return p.TrackEventsRetentionDays
+	default:
+		return 0
+	}
+}
+
+// LongestDays is the longest any row of table is kept, or 0 when some rows
+// are kept forever. Whole-partition and chunk drops must not go below it.
+// Undecodable rules count as keeping data forever.
+func LongestDays(p model.CleanupPolicy, table string) int {
+	longest := BaseDays(p, table)
+	if longest <= 0 {
+		return 0
+	}
+	rules, err := Rules(p)
+	if err != nil {
+		return 0
+	}
+	for _, r := range rules {
+		if r.Table != table {
+			continue
+		}
+		if r.Days <= 0 {
+			return 0
+		}
+		if r.Days > longest {
+			longest = r.Days
+		}
+	}
+	return longest
+}
+
+// Buckets splits table into the row sets the policy expires at different
+// times. Rules are applied in order, each only to rows no earlier rule
+// matched; rows kept forever get no bucket. The predicates are rendered for
+// db's dialect and may be used on track_event_daily as well for track_events.
+func Buckets(db *gorm.DB, p model.CleanupPolicy, table string, now time.Time) ([]Bucket, error) {
+	all, err := Rules(p)
+	if err != nil {
+		return nil, err
+	}
+	sqlite := db != nil && strings.EqualFold(db.Dialector.Name(), "sqlite")
+	now = now.UTC()
+
+	var out []Bucket
+	var prev []string
+	var prevArgs []any
+	for _, r := range all {
+		if r.Table != table {
+			continue
+		}
+		match, args := matchExpr(r, sqlite)
+		if r.Days > 0 {
+			where, whereArgs := match, args
+			if len(prev) > 0 {
+				where = match + " AND NOT (" + strings.Join(prev, " OR ") + ")"
+				whereArgs = append(append([]any{}, args...), prevArgs...)
+			}
+			out = append(out, Bucket{Where: where, Args: whereArgs, Before: expiry(now, r.Days)})
+		}
+		prev = append(prev, match)
+		prevArgs = append(prevArgs, args...)
+	}
+	if days := BaseDays(p, table); days > 0 {
+		b := Bucket{Before: expiry(now, days)}
+		if len(prev) > 0 {
+			b.Where = "NOT (" + strings.Join(prev, " OR ") + ")"
+			b.Args = prevArgs
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// Latest returns the latest Before across buckets (zero when there are none).
+func Latest(buckets []Bucket) time.Time {
+	var latest time.Time
+	for _, b := range buckets {
+		if b.Before.After(latest) {
+			latest = b.Before
+		}
+	}
+	return latest
+}
+
+// Expired renders "the row has expired" for buckets as one predicate.
+func Expired(buckets []Bucket) (string, []any) {
+	parts := make([]string, 0, len(buckets))
+	var args []any
+	for _, b := range buckets {
+		if b.Where == "" {
+			parts = append(parts, "timestamp < ?")
+		} else {
+			parts = append(parts, "("+b.Where+") AND timestamp < ?")
+			args = append(args, b.Args...)
+		}
+		args = append(args, b.Before)
+	}
+	if len(parts) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(parts, ") OR (") + ")", args
+}
+
+func expiry(now time.Time, days int) time.Time {
+	return now.Add(-time.Duration(days) * 24 * time.Hour)
+}
+
+// matchExpr renders r as a predicate that is never NULL, so negating it for
+// later rules does not drop rows with a missing level or field.
+func matchExpr(r model.RetentionRule, sqlite bool) (string, []any) {
+	var parts []string
+	var args []any
+	if len(r.Levels) > 0 {
+		parts = append(parts, "LOWER(level) IN ?")
+		args = append(args, r.Levels)
+	}
+	if r.Field != "" {
+		parts = append(parts, fieldExpr(r.Table, r.Field, sqlite)+" = ?")
+		args = append(args, r.Value)
+	}
+	return "COALESCE(" + strings.Join(parts, " AND ") + ", FALSE)", args
+}
+
+// fieldExpr is the text value of a field; the key was validated against
+// fieldKeyRe.
+func fieldExpr(table, key string, sqlite bool) string {
+	if table == TableTrackEvents {
+		return "name"
+	}
+	col := "fields"
+	if table == TableEvents {
+		col = "data"
+	}
+	if sqlite {
+		path := fmt.Sprintf(`'$."%s"'`, key)
+		return fmt.Sprintf(
+			"(CASE json_type(%[1]s, %[2]s) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(json_extract(%[1]s, %[2]s) AS TEXT) END)",
+			col, path,
+		)
+	}
+	return fmt.Sprintf("%s->>'%s'", col, key)
+}
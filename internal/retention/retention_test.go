@@ -0,0 +1,78 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+)
+
+func TestEncodeValidates(t *testing.T) {
+	raw, err := Encode([]model.RetentionRule{
+		{Levels: []string{" ERROR ", "fatal"}, Days: 90},
+		{Table: "logs", Field: "fields.service", Value: "payments", Days: 365},
+	})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	rules, err := Rules(model.CleanupPolicy{RetentionRules: raw})
+	if err != nil {
+		t.Fatalf("Rules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Table != "logs" || rules[0].Levels[0] != "error" || rules[1].Field != "service" {
+		t.Fatalf("unexpected normalized rules: %+v", rules)
+	}
+
+	for _, bad := range []model.RetentionRule{
+		{Table: "logs", Days: 7},
+		{Table: "metrics", Levels: []string{"info"}, Days: 7},
+		{Table: "track_events", Levels: []string{"info"}, Days: 7},
+		{Table: "logs", Field: "a'b", Value: "x", Days: 7},
+		{Table: "logs", Levels: []string{"info"}, Days: -1},
+	} {
+		if _, err := Encode([]model.RetentionRule{bad}); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestBucketsAndLongestDays(t *testing.T) {
+	raw, err := Encode([]model.RetentionRule{
+		{Levels: []string{"error", "fatal"}, Days: 90},
+		{Levels: []string{"debug"}, Days: 2},
+		{Table: "events", Levels: []string{"info"}, Days: 0},
+	})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	p := model.CleanupPolicy{LogsRetentionDays: 14, EventsRetentionDays: 30, RetentionRules: raw}
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	buckets, err := Buckets(nil, p, TableLogs, now)
+	if err != nil {
+		t.Fatalf("Buckets: %v", err)
+	}
+	if len(buckets) != 3 {
+		t.Fatalf("expected error, debug and default buckets, got %+v", buckets)
+	}
+	if !buckets[0].Before.Equal(now.AddDate(0, 0, -90)) || !buckets[2].Before.Equal(now.AddDate(0, 0, -14)) {
+		t.Fatalf("unexpected bounds: %v / %v", buckets[0].Before, buckets[2].Before)
+	}
+	// The debug bucket excludes rows the error rule already matched.
+	if got := len(buckets[1].Args); got != 2 {
+		t.Fatalf("expected debug bucket to carry its own and the error rule's args, got %d", got)
+	}
+	if buckets[2].Where == "" {
+		t.Fatalf("default bucket must exclude rows matched by rules")
+	}
+
+	if got := LongestDays(p, TableLogs); got != 90 {
+		t.Fatalf("expected logs kept at most 90 days, got %d", got)
+	}
+	if got := LongestDays(p, TableEvents); got != 0 {
+		t.Fatalf("events info kept forever, got %d", got)
+	}
+	if buckets, _ := Buckets(nil, p, TableTrackEvents, now); len(buckets) != 0 {
+		t.Fatalf("track_events has no retention, got %+v", buckets)
+	}
+}
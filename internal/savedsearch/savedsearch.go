@@ -0,0 +1,352 @@
+// Package savedsearch keeps named log searches and runs the scheduled ones,
+// sending their hit count or a CSV of their hits through notification
+// channels.
+package savedsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/channel"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"gorm.io/gorm"
+)
+
+// Schedule frequencies.
+const (
+	Hourly = "hourly"
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// Delivery formats.
+const (
+	FormatCount = "count"
+	FormatCSV   = "csv"
+)
+
+const (
+	MaxColumns      = 20
+	MaxDeliveryRows = 500
+)
+
+var ErrInvalid = errors.New("savedsearch: invalid saved search")
+
+// DefaultColumns are the CSV columns of a saved search without columns.
+var DefaultColumns = []string{"timestamp", "level", "message"}
+
+// Hit attributes a column can name; anything else is read from fields.
+var hitColumns = map[string]bool{"timestamp": true, "type": true, "level": true, "message": true, "trace_id": true, "span_id": true}
+
+var fieldPath = regexp.MustCompile(`^[A-Za-z0-9_@-]+(\.[A-Za-z0-9_@-]+)*$`)
+
+// Columns decodes a saved search's columns.
+func Columns(s model.SavedSearch) []string {
+	var out []string
+	_ = json.Unmarshal(s.Columns, &out)
+	return out
+}
+
+// Channels decodes a saved search's channels.
+func Channels(s model.SavedSearch) ([]channel.ChannelConfig, error) {
+	var out []channel.ChannelConfig
+	if len(s.Channels) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(s.Channels, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Validate checks a saved search; errors wrap ErrInvalid.
+func Validate(s model.SavedSearch) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+	}
+	if strings.TrimSpace(s.Name) == "" || len(s.Name) > 255 {
+		return invalid("name is required (at most 255 characters)")
+	}
+	parsed, err := search.NewQueryParser().Parse(s.Query)
+	if err != nil {
+		return invalid("query: %v", err)
+	}
+	sources, err := search.ParseSources(s.Sources)
+	if err != nil {
+		return invalid("sources: %v", err)
+	}
+	if len(sources) == 1 && sources[0] == search.SourceLogs {
+		if err := postgres.Validate(parsed.Root); err != nil {
+			return invalid("query: %v", err)
+		}
+	}
+	now := time.Now().UTC()
+	for _, v := range []string{s.Start, s.End} {
+		if v == "" {
+			continue
+		}
+		if _, err := search.ParseTime(v, now); err != nil {
+			return invalid("time range: %q is neither a time nor relative to now (now-7d)", v)
+		}
+	}
+	if s.Sort != "desc" && s.Sort != "asc" {
+		return invalid("sort must be desc or asc")
+	}
+	var columns []string
+	if len(s.Columns) > 0 {
+		if err := json.Unmarshal(s.Columns, &columns); err != nil {
+			return invalid("columns must be a list of fields")
+		}
+	}
+	if len(columns) > MaxColumns {
+		return invalid("at most %d columns", MaxColumns)
+	}
+	for _, c := range columns {
+		if !hitColumns[c] && !fieldPath.MatchString(c) {
+			return invalid("column %q must be a log column or a field path", c)
+		}
+	}
+
+	switch s.ScheduleFrequency {
+	case Hourly, Daily, Weekly:
+	default:
+		return invalid("schedule_frequency must be hourly, daily or weekly")
+	}
+	if s.ScheduleWeekday < 0 || s.ScheduleWeekday > 6 {
+		return invalid("schedule_weekday must be between 0 (Sunday) and 6")
+	}
+	if s.ScheduleHourUTC < 0 || s.ScheduleHourUTC > 23 {
+		return invalid("schedule_hour_utc must be between 0 and 23")
+	}
+	if s.ScheduleMinuteUTC < 0 || s.ScheduleMinuteUTC > 59 {
+		return invalid("schedule_minute_utc must be between 0 and 59")
+	}
+	if s.DeliveryFormat != FormatCount && s.DeliveryFormat != FormatCSV {
+		return invalid("delivery_format must be count or csv")
+	}
+	if s.DeliveryRows < 1 || s.DeliveryRows > MaxDeliveryRows {
+		return invalid("delivery_rows must be between 1 and %d", MaxDeliveryRows)
+	}
+	chans, err := Channels(s)
+	if err != nil {
+		return invalid("channels must be a list of {type, config}")
+	}
+	for _, ch := range chans {
+		if strings.TrimSpace(ch.Type) == "" || len(ch.Config) == 0 {
+			return invalid("channels require type and config")
+		}
+	}
+	if s.ScheduleEnabled && len(chans) == 0 {
+		return invalid("a schedule requires at least one channel")
+	}
+	return nil
+}
+
+// NextRun is the first time after after that s is scheduled at.
+func NextRun(s model.SavedSearch, after time.Time) time.Time {
+	after = after.UTC()
+	if s.ScheduleFrequency == Hourly {
+		next := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), s.ScheduleMinuteUTC, 0, 0, time.UTC)
+		if !next.After(after) {
+			next = next.Add(time.Hour)
+		}
+		return next
+	}
+	next := time.Date(after.Year(), after.Month(), after.Day(), s.ScheduleHourUTC, s.ScheduleMinuteUTC, 0, 0, time.UTC)
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	if s.ScheduleFrequency == Weekly {
+		days := (s.ScheduleWeekday - int(next.Weekday()) + 7) % 7
+		next = next.AddDate(0, 0, days)
+	}
+	return next
+}
+
+// Report is the result of running a saved search.
+type Report struct {
+	Total         int64              `json:"total"`
+	TotalRelation string             `json:"total_relation"`
+	Start         *time.Time         `json:"start,omitempty"`
+	End           *time.Time         `json:"end,omitempty"`
+	Hits          []search.SearchHit `json:"hits,omitempty"`
+	Title         string             `json:"title"`
+	Content       string             `json:"content"`
+}
+
+// Run runs s with its time range resolved against now, counting every match,
+// and renders the message it delivers: the hit count, followed with the
+// csv format by the first DeliveryRows hits.
+func Run(ctx context.Context, db *gorm.DB, s model.SavedSearch, now time.Time) (Report, error) {
+	var r Report
+	var tr search.TimeRange
+	for _, b := range []struct {
+		v   string
+		dst *time.Time
+		out **time.Time
+	}{{s.Start, &tr.Start, &r.Start}, {s.End, &tr.End, &r.End}} {
+		if b.v == "" {
+			continue
+		}
+		t, err := search.ParseTime(b.v, now.UTC())
+		if err != nil {
+			return r, err
+		}
+		*b.dst, *b.out = t, &t
+	}
+	sources, err := search.ParseSources(s.Sources)
+	if err != nil {
+		return r, err
+	}
+	rows := 1
+	if s.DeliveryFormat == FormatCSV {
+		rows = s.DeliveryRows
+	}
+	res, err := search.NewEngine(postgres.NewAdapter(db)).Search(ctx, search.SearchRequest{
+		Query:     s.Query,
+		ProjectID: s.ProjectID,
+		Sources:   sources,
+		TimeRange: tr,
+		PageSize:  rows,
+		Order:     s.Sort,
+		Total:     search.TotalExact,
+	})
+	if err != nil {
+		return r, err
+	}
+	r.Total, r.TotalRelation, r.Hits = res.Total, res.TotalRelation, res.Hits
+	if s.DeliveryFormat != FormatCSV {
+		r.Hits = nil
+	}
+
+	r.Title = fmt.Sprintf("[logtap] saved search %q: %d hits", s.Name, r.Total)
+	var b strings.Builder
+	query := s.Query
+	if strings.TrimSpace(query) == "" {
+		query = "*"
+	}
+	fmt.Fprintf(&b, "query: %s\n", query)
+	fmt.Fprintf(&b, "range: %s - %s\n", bound(r.Start, "beginning"), bound(r.End, "now"))
+	fmt.Fprintf(&b, "hits: %d\n", r.Total)
+	if s.DeliveryFormat == FormatCSV && len(r.Hits) > 0 {
+		columns := Columns(s)
+		if len(columns) == 0 {
+			columns = DefaultColumns
+		}
+		out, err := CSV(r.Hits, columns)
+		if err != nil {
+			return r, err
+		}
+		fmt.Fprintf(&b, "\nfirst %d hits:\n%s", len(r.Hits), out)
+	}
+	r.Content = b.String()
+	return r, nil
+}
+
+func bound(t *time.Time, open string) string {
+	if t == nil {
+		return open
+	}
+	return t.Format(time.RFC3339)
+}
+
+// CSV renders hits as CSV with a header row of columns.
+func CSV(hits []search.SearchHit, columns []string) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return "", err
+	}
+	record := make([]string, len(columns))
+	for _, h := range hits {
+		for i, c := range columns {
+			record[i] = value(h, c)
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// value is column c of h; a field path first names a top-level key of the
+// fields, then nested objects.
+func value(h search.SearchHit, c string) string {
+	switch c {
+	case "timestamp":
+		return h.Timestamp.UTC().Format(time.RFC3339Nano)
+	case "type":
+		return h.Type
+	case "level":
+		return h.Level
+	case "message":
+		return h.Message
+	case "trace_id":
+		return h.TraceID
+	case "span_id":
+		return h.SpanID
+	}
+	path := strings.TrimPrefix(c, "fields.")
+	v, ok := h.Fields[path]
+	if !ok {
+		var cur any = h.Fields
+		for _, p := range strings.Split(path, ".") {
+			m, isMap := cur.(map[string]any)
+			if !isMap {
+				return ""
+			}
+			if cur, ok = m[p]; !ok {
+				return ""
+			}
+		}
+		v = cur
+	}
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Deliver queues r for each of s's channels; the alert worker delivers it.
+// It returns the number of deliveries queued.
+func Deliver(ctx context.Context, db *gorm.DB, s model.SavedSearch, r Report, now time.Time) (int, error) {
+	chans, err := Channels(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid channels: %w", err)
+	}
+	if len(chans) == 0 {
+		return 0, nil
+	}
+	deliveries := make([]model.AlertDelivery, 0, len(chans))
+	for _, ch := range chans {
+		deliveries = append(deliveries, model.AlertDelivery{
+			ProjectID:     s.ProjectID,
+			RuleID:        0,
+			ChannelType:   ch.Type,
+			Target:        string(ch.Config),
+			Title:         r.Title,
+			Content:       r.Content,
+			Status:        "pending",
+			Attempts:      0,
+			NextAttemptAt: now,
+		})
+	}
+	if err := db.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return 0, err
+	}
+	return len(deliveries), nil
+}
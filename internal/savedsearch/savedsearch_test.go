@@ -0,0 +1,146 @@
+package savedsearch_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/savedsearch"
+	"github.com/aak1247/logtap/internal/testkit"
+)
+
+func valid() model.SavedSearch {
+	return model.SavedSearch{
+		ProjectID:         1,
+		Name:              "top errors",
+		Query:             "level:error",
+		Columns:           []byte(`["timestamp","message","user.id"]`),
+		Sort:              "desc",
+		Start:             "now-7d",
+		ScheduleFrequency: savedsearch.Weekly,
+		ScheduleWeekday:   int(time.Monday),
+		ScheduleHourUTC:   9,
+		DeliveryFormat:    savedsearch.FormatCSV,
+		DeliveryRows:      2,
+		Channels:          []byte(`[{"type":"webhook","config":{"url":"https://example.com/hook"}}]`),
+		ScheduleEnabled:   true,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := savedsearch.Validate(valid()); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for name, mutate := range map[string]func(*model.SavedSearch){
+		"name":      func(s *model.SavedSearch) { s.Name = " " },
+		"query":     func(s *model.SavedSearch) { s.Query = "level:(error" },
+		"sources":   func(s *model.SavedSearch) { s.Sources = "metrics" },
+		"start":     func(s *model.SavedSearch) { s.Start = "last week" },
+		"sort":      func(s *model.SavedSearch) { s.Sort = "up" },
+		"column":    func(s *model.SavedSearch) { s.Columns = []byte(`["a b"]`) },
+		"frequency": func(s *model.SavedSearch) { s.ScheduleFrequency = "monthly" },
+		"weekday":   func(s *model.SavedSearch) { s.ScheduleWeekday = 7 },
+		"minute":    func(s *model.SavedSearch) { s.ScheduleMinuteUTC = 60 },
+		"format":    func(s *model.SavedSearch) { s.DeliveryFormat = "pdf" },
+		"rows":      func(s *model.SavedSearch) { s.DeliveryRows = savedsearch.MaxDeliveryRows + 1 },
+		"channel":   func(s *model.SavedSearch) { s.Channels = []byte(`[{"type":"webhook"}]`) },
+		"channels":  func(s *model.SavedSearch) { s.Channels = []byte(`[]`) },
+	} {
+		s := valid()
+		mutate(&s)
+		if err := savedsearch.Validate(s); !errors.Is(err, savedsearch.ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	// 2025-06-04 is a Wednesday.
+	at := time.Date(2025, 6, 4, 10, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		frequency string
+		weekday   int
+		hour      int
+		minute    int
+		after     time.Time
+		want      time.Time
+	}{
+		{savedsearch.Hourly, 0, 0, 45, at, time.Date(2025, 6, 4, 10, 45, 0, 0, time.UTC)},
+		{savedsearch.Hourly, 0, 0, 30, at, time.Date(2025, 6, 4, 11, 30, 0, 0, time.UTC)},
+		{savedsearch.Daily, 0, 11, 0, at, time.Date(2025, 6, 4, 11, 0, 0, 0, time.UTC)},
+		{savedsearch.Daily, 0, 9, 0, at, time.Date(2025, 6, 5, 9, 0, 0, 0, time.UTC)},
+		{savedsearch.Weekly, 1, 9, 0, at, time.Date(2025, 6, 9, 9, 0, 0, 0, time.UTC)},
+		{savedsearch.Weekly, 3, 11, 0, at, time.Date(2025, 6, 4, 11, 0, 0, 0, time.UTC)},
+		{savedsearch.Weekly, 3, 9, 0, at, time.Date(2025, 6, 11, 9, 0, 0, 0, time.UTC)},
+		{savedsearch.Weekly, 0, 0, 0, at, time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)},
+	} {
+		s := model.SavedSearch{ScheduleFrequency: tc.frequency, ScheduleWeekday: tc.weekday, ScheduleHourUTC: tc.hour, ScheduleMinuteUTC: tc.minute}
+		if got := savedsearch.NextRun(s, tc.after); !got.Equal(tc.want) {
+			t.Errorf("%s weekday=%d %02d:%02d: got %s, want %s", tc.frequency, tc.weekday, tc.hour, tc.minute, got, tc.want)
+		}
+	}
+}
+
+func TestWorker(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2025, 6, 9, 9, 0, 30, 0, time.UTC)
+	logs := []model.Log{
+		{ProjectID: 1, Timestamp: now.Add(-time.Hour), Level: "error", Message: "db down", Fields: []byte(`{"user":{"id":"u1"}}`)},
+		{ProjectID: 1, Timestamp: now.Add(-2 * time.Hour), Level: "error", Message: `quote "x", comma`, Fields: []byte(`{"user.id":7}`)},
+		{ProjectID: 1, Timestamp: now.Add(-3 * time.Hour), Level: "error", Message: "third", Fields: []byte(`{}`)},
+		{ProjectID: 1, Timestamp: now.Add(-10 * 24 * time.Hour), Level: "error", Message: "too old", Fields: []byte(`{}`)},
+		{ProjectID: 1, Timestamp: now.Add(-time.Hour), Level: "info", Message: "fine", Fields: []byte(`{}`)},
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	s := valid()
+	due := now.Add(-30 * time.Second)
+	s.NextRunAt = &due
+	if err := db.Create(&s).Error; err != nil {
+		t.Fatalf("create search: %v", err)
+	}
+
+	w := savedsearch.NewWorker(db)
+	w.Now = func() time.Time { return now }
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	// Not due any more: a second pass sends nothing.
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	var deliveries []model.AlertDelivery
+	if err := db.Find(&deliveries).Error; err != nil {
+		t.Fatalf("find deliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %d, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.ChannelType != "webhook" || d.Status != "pending" || d.Title != `[logtap] saved search "top errors": 3 hits` {
+		t.Fatalf("delivery = %+v", d)
+	}
+	wantCSV := "timestamp,message,user.id\n" +
+		now.Add(-time.Hour).Format(time.RFC3339Nano) + ",db down,u1\n" +
+		now.Add(-2*time.Hour).Format(time.RFC3339Nano) + ",\"quote \"\"x\"\", comma\",7\n"
+	if !strings.Contains(d.Content, "hits: 3\n") || !strings.HasSuffix(d.Content, "first 2 hits:\n"+wantCSV) {
+		t.Fatalf("content = %q", d.Content)
+	}
+
+	var got model.SavedSearch
+	if err := db.First(&got, s.ID).Error; err != nil {
+		t.Fatalf("find search: %v", err)
+	}
+	if got.LastRunAt == nil || got.LastHits != 3 || got.LastError != "" {
+		t.Fatalf("search = %+v", got)
+	}
+	if want := time.Date(2025, 6, 16, 9, 0, 0, 0, time.UTC); got.NextRunAt == nil || !got.NextRunAt.Equal(want) {
+		t.Fatalf("next run = %v, want %s", got.NextRunAt, want)
+	}
+}
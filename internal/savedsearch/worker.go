@@ -0,0 +1,113 @@
+package savedsearch
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+)
+
+// Worker runs the scheduled saved searches that are due and queues their
+// reports for delivery. A run is claimed by moving next_run_at on from the
+// value read, so only one of several gateways runs it. Runs missed while no
+// worker was up are made up for once.
+type Worker struct {
+	DB       *gorm.DB
+	Interval time.Duration
+	Limit    int // due searches per pass
+	Timeout  time.Duration
+	Now      func() time.Time
+}
+
+func NewWorker(db *gorm.DB) *Worker {
+	return &Worker{
+		DB:       db,
+		Interval: time.Minute,
+		Limit:    50,
+		Timeout:  2 * time.Minute,
+		Now:      time.Now,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	if w == nil || w.DB == nil {
+		return
+	}
+	_ = w.RunOnce(ctx)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = w.RunOnce(ctx)
+		}
+	}
+}
+
+func (w *Worker) RunOnce(ctx context.Context) error {
+	now := w.Now().UTC()
+	var due []model.SavedSearch
+	if err := w.DB.WithContext(ctx).
+		Where("schedule_enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Order("next_run_at ASC").
+		Limit(w.Limit).
+		Find(&due).Error; err != nil {
+		log.Printf("savedsearch: list due: %v", err)
+		return err
+	}
+	for _, s := range due {
+		claimed, err := w.claim(ctx, s, now)
+		if err != nil {
+			log.Printf("savedsearch: project=%d search=%d: claim: %v", s.ProjectID, s.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		runCtx, cancel := context.WithTimeout(ctx, w.Timeout)
+		err = w.run(runCtx, s, now)
+		cancel()
+		if err != nil {
+			log.Printf("savedsearch: project=%d search=%d: %v", s.ProjectID, s.ID, err)
+		}
+	}
+	return nil
+}
+
+// claim schedules s's next run, unless another worker did since s was read.
+func (w *Worker) claim(ctx context.Context, s model.SavedSearch, now time.Time) (bool, error) {
+	res := w.DB.WithContext(ctx).
+		Model(&model.SavedSearch{}).
+		Where("id = ? AND next_run_at = ?", s.ID, *s.NextRunAt).
+		Update("next_run_at", NextRun(s, now))
+	return res.RowsAffected == 1, res.Error
+}
+
+// run runs s and queues its report, recording the outcome on s.
+func (w *Worker) run(ctx context.Context, s model.SavedSearch, now time.Time) error {
+	r, err := Run(ctx, w.DB, s, now)
+	if err == nil {
+		_, err = Deliver(ctx, w.DB, s, r, now)
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if uerr := w.DB.WithContext(context.WithoutCancel(ctx)).
+		Model(&model.SavedSearch{}).
+		Where("id = ?", s.ID).
+		Updates(map[string]any{
+			"last_run_at": now,
+			"last_hits":   r.Total,
+			"last_error":  msg,
+		}).Error; uerr != nil && err == nil {
+		return uerr
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aak1247/logtap/internal/search"
+	"gorm.io/gorm"
+)
+
+// Above sampleAbove matches, facets and histograms of a source are counted
+// on a sample of about sampleSize of them, one in n, and the counts scaled
+// back up. On Postgres the sample is TABLESAMPLE SYSTEM, so only the sampled
+// pages are read; SQLite has no TABLESAMPLE and keeps the rows with
+// id % n = 0, which shrinks the grouping but still reads every match.
+const (
+	defaultSampleAbove = 1_000_000
+	defaultSampleSize  = 200_000
+)
+
+// SetSampling changes the thresholds of sampled counting; mainly for tests.
+func (a *PostgresAdapter) SetSampling(above, size int64) *PostgresAdapter {
+	a.sampleAbove, a.sampleSize = above, size
+	return a
+}
+
+// sampled is filtered over a sample of s's n matches, with the factor that
+// scales counts on the sample back up.
+func (a *PostgresAdapter) sampled(ctx context.Context, s *schema, q search.SearchQuery, n int64) (*gorm.DB, int64, error) {
+	if s == eventsSchema || n <= a.sampleAbove || a.sampleSize <= 0 {
+		qdb, err := a.filtered(ctx, s, q)
+		return qdb, 1, err // event ids are UUIDs
+	}
+	step := (n + a.sampleSize - 1) / a.sampleSize
+	if a.isSQLite() {
+		qdb, err := a.filtered(ctx, s, q)
+		if err != nil {
+			return nil, 0, err
+		}
+		return qdb.Where(fmt.Sprintf("id %% %d = 0", step)), step, nil
+	}
+	from := fmt.Sprintf("%s TABLESAMPLE SYSTEM (%g)", s.table, 100/float64(step))
+	qdb, err := a.filteredFrom(ctx, from, s, q)
+	return qdb, step, err
+}
+
+// facets computes the top values of q.Facets (level by default) over the
+// matches of each source, counts being the per-source matches. The source
+// facet is the counts themselves and is included whenever several sources
+// are searched.
+func (a *PostgresAdapter) facets(ctx context.Context, schemas []*schema, counts map[string]int64, q search.SearchQuery) (map[string]search.Facet, error) {
+	fields := q.Facets
+	if len(fields) == 0 {
+		fields = []string{"level"}
+	}
+	size := q.FacetSize
+	if size <= 0 {
+		size = search.DefaultFacetSize
+	}
+
+	out := make(map[string]search.Facet, len(fields)+1)
+	if len(schemas) > 1 {
+		out["source"] = search.Facet{Field: "source", Buckets: facetBuckets(counts, 0)}
+	}
+	for _, name := range fields {
+		if name == "source" {
+			out[name] = search.Facet{Field: name, Buckets: facetBuckets(counts, size)}
+			continue
+		}
+		values := map[string]int64{}
+		sampled := false
+		for _, s := range schemas {
+			t := a.translator(s)
+			f, err := t.field(name)
+			if err != nil {
+				return nil, err
+			}
+			if f.kind == kindTime {
+				return nil, fmt.Errorf("%w: cannot facet on %s, use the histogram", search.ErrInvalidQuery, name)
+			}
+			if f.kind == kindNone || counts[s.source] == 0 {
+				continue
+			}
+			qdb, step, err := a.sampled(ctx, s, q, counts[s.source])
+			if err != nil {
+				return nil, err
+			}
+			sampled = sampled || step > 1
+
+			var rows []struct {
+				BucketKey   string
+				BucketCount int64
+			}
+			if err := qdb.Select(t.text(f) + " AS bucket_key, COUNT(*) AS bucket_count").
+				Where(f.expr + " IS NOT NULL").
+				Group("bucket_key").
+				Order("bucket_count DESC").
+				Limit(size).
+				Find(&rows).Error; err != nil {
+				return nil, fmt.Errorf("search facet %s: %w", name, err)
+			}
+			for _, r := range rows {
+				values[r.BucketKey] += r.BucketCount * step
+			}
+		}
+		out[name] = search.Facet{Field: name, Buckets: facetBuckets(values, size), Sampled: sampled}
+	}
+	return out, nil
+}
+
+// histogram counts the matches per bucket over the query's time range, or
+// over the span of the matches when the range is open.
+func (a *PostgresAdapter) histogram(ctx context.Context, schemas []*schema, counts map[string]int64, q search.SearchQuery) (*search.Histogram, error) {
+	start, end := q.TimeRange.Start, q.TimeRange.End
+	if start.IsZero() || end.IsZero() {
+		first, last, err := a.span(ctx, schemas, counts, q)
+		if err != nil {
+			return nil, err
+		}
+		if start.IsZero() {
+			start = first
+		}
+		if end.IsZero() {
+			end = last
+			if !q.TimeRange.Start.IsZero() {
+				end = time.Now()
+			}
+		}
+	}
+	if start.IsZero() || end.Before(start) {
+		// Nothing matches an open range.
+		return &search.Histogram{IntervalSec: int64(q.Interval / time.Second), Buckets: []search.HistogramBucket{}}, nil
+	}
+	interval := q.Interval
+	if interval <= 0 {
+		interval = search.HistogramInterval(end.Sub(start))
+	}
+	sec := int64(interval / time.Second)
+	h := &search.Histogram{IntervalSec: sec, Buckets: []search.HistogramBucket{}}
+	first, last := floorDiv(start.Unix(), sec)*sec, floorDiv(end.Unix(), sec)*sec
+	if (last-first)/sec+1 > search.MaxHistogramBuckets {
+		return nil, fmt.Errorf("%w: interval %s gives more than %d buckets", search.ErrInvalidQuery, interval, search.MaxHistogramBuckets)
+	}
+
+	bucket := a.TimeBucket(sec)
+	totals := map[int64]int64{}
+	for _, s := range schemas {
+		if counts[s.source] == 0 {
+			continue
+		}
+		qdb, step, err := a.sampled(ctx, s, q, counts[s.source])
+		if err != nil {
+			return nil, err
+		}
+		h.Sampled = h.Sampled || step > 1
+
+		var rows []struct {
+			Bucket      int64
+			BucketCount int64
+		}
+		if err := qdb.Select(bucket + " AS bucket, COUNT(*) AS bucket_count").
+			Group("bucket").
+			Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("search histogram %s: %w", s.source, err)
+		}
+		for _, r := range rows {
+			totals[r.Bucket] += r.BucketCount * step
+		}
+	}
+	for b := first; b <= last; b += sec {
+		h.Buckets = append(h.Buckets, search.HistogramBucket{Time: time.Unix(b, 0).UTC(), Count: totals[b]})
+	}
+	return h, nil
+}
+
+// span returns the first and last timestamps of the matches; both are zero
+// when nothing matches.
+func (a *PostgresAdapter) span(ctx context.Context, schemas []*schema, counts map[string]int64, q search.SearchQuery) (time.Time, time.Time, error) {
+	var first, last time.Time
+	for _, s := range schemas {
+		if counts[s.source] == 0 {
+			continue
+		}
+		for _, order := range []string{"timestamp ASC", "timestamp DESC"} {
+			qdb, err := a.filtered(ctx, s, q)
+			if err != nil {
+				return first, last, err
+			}
+			var ts []time.Time
+			if err := qdb.Order(order).Limit(1).Pluck("timestamp", &ts).Error; err != nil {
+				return first, last, fmt.Errorf("search histogram %s: %w", s.source, err)
+			}
+			if len(ts) == 0 {
+				continue
+			}
+			if first.IsZero() || ts[0].Before(first) {
+				first = ts[0]
+			}
+			if ts[0].After(last) {
+				last = ts[0]
+			}
+		}
+	}
+	return first, last, nil
+}
+
+// facetBuckets orders counts by count, then key, keeping the first size
+// (all when size <= 0).
+func facetBuckets(counts map[string]int64, size int) []search.FacetBucket {
+	out := make([]search.FacetBucket, 0, len(counts))
+	for k, n := range counts {
+		out = append(out, search.FacetBucket{Key: k, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	if size > 0 && len(out) > size {
+		out = out[:size]
+	}
+	return out
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,39 @@
+package postgres
+
+import "fmt"
+
+// FieldExpr is a field of the logs table as SQL, for statements built
+// outside the adapter (see package pipeline).
+type FieldExpr struct {
+	Text   string // the value as text
+	Number string // the value as a number, NULL when it is not numeric
+	Time   bool   // the timestamp column; Text and Number are "timestamp"
+}
+
+// LogField resolves a field of the logs table the way queries do: a column,
+// timestamp, or a validated path in fields.
+func (a *PostgresAdapter) LogField(name string) (FieldExpr, error) {
+	t := a.translator(logsSchema)
+	f, err := t.field(name)
+	if err != nil {
+		return FieldExpr{}, err
+	}
+	if f.kind == kindTime {
+		return FieldExpr{Text: f.expr, Number: f.expr, Time: true}, nil
+	}
+	return FieldExpr{Text: t.text(f), Number: t.number(f)}, nil
+}
+
+// LogColumns selects the columns of a log, fields as JSON text.
+func (a *PostgresAdapter) LogColumns() string {
+	return "id, timestamp, level, trace_id, span_id, pattern_id, message, " + a.fieldsTextExpr() + " AS fields"
+}
+
+// TimeBucket is the start, in Unix seconds, of the sec-second bucket a
+// row's timestamp falls in.
+func (a *PostgresAdapter) TimeBucket(sec int64) string {
+	if a.isSQLite() {
+		return fmt.Sprintf("(CAST(strftime('%%s', timestamp) AS INTEGER) / %d) * %d", sec, sec)
+	}
+	return fmt.Sprintf("CAST(floor(extract(epoch from timestamp) / %d) AS BIGINT) * %d", sec, sec)
+}
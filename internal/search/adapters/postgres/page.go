@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aak1247/logtap/internal/cursor"
+	"github.com/aak1247/logtap/internal/search"
+	"gorm.io/gorm"
+)
+
+// hitSources maps SearchHit.Type to its source.
+var hitSources = map[string]string{
+	"log":   search.SourceLogs,
+	"event": search.SourceEvents,
+	"track": search.SourceTrack,
+}
+
+// SetCountCap changes where capped totals stop; mainly for tests.
+func (a *PostgresAdapter) SetCountCap(n int64) *PostgresAdapter {
+	a.countCap = n
+	return a
+}
+
+// count counts the matches of q in s as q.Total asks and returns how the
+// count relates to the true number.
+func (a *PostgresAdapter) count(ctx context.Context, s *schema, q search.SearchQuery) (int64, string, error) {
+	qdb, err := a.filtered(ctx, s, q)
+	if err != nil {
+		return 0, "", err
+	}
+	var n int64
+	switch {
+	case q.Total == search.TotalEstimate && !a.isSQLite():
+		if n, err = a.estimate(ctx, qdb); err != nil {
+			return 0, "", fmt.Errorf("search estimate %s: %w", s.source, err)
+		}
+		return n, search.RelationApprox, nil
+	case q.Total == search.TotalCapped || q.Total == search.TotalEstimate:
+		err = a.db.WithContext(ctx).Table("(?) AS capped", qdb.Select("1").Limit(int(a.countCap))).Count(&n).Error
+		if err != nil {
+			return 0, "", fmt.Errorf("search count %s: %w", s.source, err)
+		}
+		if n >= a.countCap {
+			return n, search.RelationGte, nil
+		}
+		return n, search.RelationEq, nil
+	default:
+		if err := qdb.Count(&n).Error; err != nil {
+			return 0, "", fmt.Errorf("search count %s: %w", s.source, err)
+		}
+		return n, search.RelationEq, nil
+	}
+}
+
+// size is the number of matches that facets and histograms sample by when
+// the total n is not exact: the planner's estimate on Postgres, n elsewhere.
+func (a *PostgresAdapter) size(ctx context.Context, s *schema, q search.SearchQuery, n int64) (int64, error) {
+	if a.isSQLite() {
+		return n, nil
+	}
+	qdb, err := a.filtered(ctx, s, q)
+	if err != nil {
+		return 0, err
+	}
+	est, err := a.estimate(ctx, qdb)
+	if err != nil {
+		return 0, fmt.Errorf("search estimate %s: %w", s.source, err)
+	}
+	return max(est, n), nil
+}
+
+// estimate returns the planner's row estimate for qdb.
+func (a *PostgresAdapter) estimate(ctx context.Context, qdb *gorm.DB) (int64, error) {
+	var rows []struct{ One int }
+	stmt := qdb.Session(&gorm.Session{DryRun: true}).Select("1 AS one").Find(&rows).Statement
+	var plan string
+	if err := a.db.WithContext(ctx).Raw("EXPLAIN (FORMAT JSON) "+stmt.SQL.String(), stmt.Vars...).Row().Scan(&plan); err != nil {
+		return 0, err
+	}
+	var out []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &out); err != nil || len(out) == 0 {
+		return 0, fmt.Errorf("unexpected plan %q", plan)
+	}
+	return int64(out[0].Plan.Rows), nil
+}
+
+// mergeRelation combines the relations of the per-source counts.
+func mergeRelation(a, b string) string {
+	if a == search.RelationApprox || b == search.RelationApprox {
+		return search.RelationApprox
+	}
+	if a == search.RelationGte || b == search.RelationGte {
+		return search.RelationGte
+	}
+	return search.RelationEq
+}
+
+// after narrows qdb to the rows of s that come after c. Hits are ordered by
+// timestamp, then source (search.SourceRank), then id.
+func after(qdb *gorm.DB, s *schema, c *cursor.Cursor, asc bool) *gorm.DB {
+	if c == nil {
+		return qdb
+	}
+	op := "<"
+	if asc {
+		op = ">"
+	}
+	switch r, rc := search.SourceRank(s.source), search.SourceRank(c.Source); {
+	case r < rc:
+		return qdb.Where("timestamp "+op+" ?", c.Time)
+	case r > rc:
+		return qdb.Where("timestamp "+op+"= ?", c.Time)
+	}
+	return c.Where(qdb, "timestamp", "id", asc)
+}
+
+// hitLess orders hits as after pages them.
+func hitLess(a, b search.SearchHit, asc bool) bool {
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp) == asc
+	}
+	if ra, rb := search.SourceRank(hitSources[a.Type]), search.SourceRank(hitSources[b.Type]); ra != rb {
+		return ra < rb
+	}
+	if ia, ok := a.ID.(int64); ok {
+		if ib, ok := b.ID.(int64); ok {
+			return (ia < ib) == asc
+		}
+	}
+	return (strings.Compare(fmt.Sprint(a.ID), fmt.Sprint(b.ID)) < 0) == asc
+}
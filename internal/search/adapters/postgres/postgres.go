@@ -2,22 +2,52 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/aak1247/logtap/internal/cursor"
 	"github.com/aak1247/logtap/internal/search"
 	"gorm.io/gorm"
 )
 
-// PostgresAdapter implements search.SearchAdapter by querying existing
-// logs and events tables directly. No storage changes in v1.
+// PostgresAdapter implements search.SearchAdapter by querying the existing
+// logs, events and track_events tables directly. No storage changes in v1.
+// It also serves SQLite installs: the few dialect-specific expressions
+// (case-insensitive LIKE, JSON-to-text casts) are switched on the dialector.
 type PostgresAdapter struct {
-	db *gorm.DB
+	db          *gorm.DB
+	sampleAbove int64
+	sampleSize  int64
+	countCap    int64
+	slowSearch  time.Duration
+	types       map[string]string // see WithTypes
+}
+
+func (a *PostgresAdapter) isSQLite() bool {
+	return a.db != nil && strings.EqualFold(a.db.Dialector.Name(), "sqlite")
+}
+
+// likeOp is the case-insensitive LIKE operator for the dialect
+// (SQLite LIKE is already case-insensitive for ASCII).
+func (a *PostgresAdapter) likeOp() string {
+	if a.isSQLite() {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
+
+func (a *PostgresAdapter) fieldsTextExpr() string {
+	if a.isSQLite() {
+		return "CAST(fields AS TEXT)"
+	}
+	return "fields::text"
 }
 
 func NewAdapter(db *gorm.DB) *PostgresAdapter {
-	return &PostgresAdapter{db: db}
+	return &PostgresAdapter{db: db, sampleAbove: defaultSampleAbove, sampleSize: defaultSampleSize, countCap: search.CountCap, slowSearch: DefaultSlowSearch}
 }
 
 func (a *PostgresAdapter) Type() string { return "postgres" }
@@ -48,168 +78,272 @@ func (a *PostgresAdapter) DeleteBefore(ctx context.Context, projectID int, befor
 		Delete(nil).Error // caller should use table-specific logic
 }
 
-// Search translates a SearchQuery into SQL against the logs table (v1).
+// Search runs q on each of its sources and merges the hits by timestamp,
+// source and id.
 func (a *PostgresAdapter) Search(ctx context.Context, q search.SearchQuery) (*search.SearchResult, error) {
-	// Build base query on logs table
-	qdb := a.db.WithContext(ctx).Table("logs").
-		Where("project_id = ?", q.ProjectID)
+	a, err := a.ForProject(ctx, q.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	defer func() { a.RecordSlow(ctx, q.ProjectID, q.Query, time.Since(started)) }()
 
-	// Time range
-	if !q.TimeRange.Start.IsZero() {
-		qdb = qdb.Where("timestamp >= ?", q.TimeRange.Start)
+	sources := q.Sources
+	if len(sources) == 0 {
+		sources = []string{search.SourceLogs}
 	}
-	if !q.TimeRange.End.IsZero() {
-		qdb = qdb.Where("timestamp <= ?", q.TimeRange.End)
+	schemas := make([]*schema, 0, len(sources))
+	for _, src := range sources {
+		s, ok := sourceSchemas[src]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown source %q", search.ErrInvalidQuery, src)
+		}
+		schemas = append(schemas, s)
 	}
+	asc := strings.EqualFold(q.Sort.Order, "asc")
+	// The page can come from any source: read offset+limit hits from each
+	// and cut the page out of the merge. One more tells whether a next page
+	// exists.
+	limit := q.Pagination.Offset + q.Pagination.Limit
+	keywords := search.FreeText(q.Query)
 
-	// Filters
-	for _, f := range q.Filters {
-		qdb = applyFilter(qdb, f)
+	var total int64
+	relation := search.RelationEq
+	var hits []search.SearchHit
+	counts := make(map[string]int64, len(schemas))
+	for _, s := range schemas {
+		n, rel, err := a.count(ctx, s, q)
+		if err != nil {
+			return nil, err
+		}
+		total += n
+		counts[s.source] = n
+		relation = mergeRelation(relation, rel)
+		if n == 0 {
+			continue
+		}
+		qdb, _ := a.filtered(ctx, s, q) // translated by count
+		found, err := a.fetch(after(qdb, s, q.After, asc), s, asc, limit+1)
+		if err != nil {
+			return nil, fmt.Errorf("search query %s: %w", s.source, err)
+		}
+		hits = append(hits, found...)
+		if rel != search.RelationEq {
+			// Sample facets and histograms by the size of the matches, not
+			// by the capped count.
+			if counts[s.source], err = a.size(ctx, s, q, n); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	// Keywords → ILIKE on message
-	for _, kw := range q.Keywords {
-		qdb = qdb.Where("message ILIKE ?", "%"+kw+"%")
+	sort.SliceStable(hits, func(i, j int) bool { return hitLess(hits[i], hits[j], asc) })
+	more := len(hits) > limit
+	if q.Pagination.Offset >= len(hits) {
+		hits = []search.SearchHit{}
+	} else {
+		hits = hits[q.Pagination.Offset:min(len(hits), limit)]
+	}
+	var next string
+	if more && len(hits) > 0 {
+		last := hits[len(hits)-1]
+		c := cursor.After(last.Timestamp, last.ID)
+		c.Source = hitSources[last.Type]
+		next = c.String()
+	}
+	if len(keywords) > 0 {
+		for i := range hits {
+			hits[i].Highlight = highlightFields(hits[i].Message, keywords)
+		}
 	}
 
-	// Count total
-	var total int64
-	if err := qdb.Count(&total).Error; err != nil {
-		return nil, fmt.Errorf("search count: %w", err)
-	}
-
-	// Order
-	order := "timestamp DESC"
-	if q.Sort.Field != "" {
-		dir := "DESC"
-		if strings.EqualFold(q.Sort.Order, "asc") {
-			dir = "ASC"
-		}
-		order = q.Sort.Field + " " + dir
-	}
-
-	// Fetch rows
-	type hitRow struct {
-		ID        int64
-		Timestamp time.Time
-		Level     string
-		TraceID   string
-		SpanID    string
-		Message   string
-		Fields    string // jsonb as string
-	}
-	var rows []hitRow
-	selectCols := "id, timestamp, level, trace_id, span_id, message, fields::text AS fields"
-	if err := qdb.Select(selectCols).
-		Order(order).
-		Offset(q.Pagination.Offset).
-		Limit(q.Pagination.Limit).
-		Find(&rows).Error; err != nil {
-		return nil, fmt.Errorf("search query: %w", err)
-	}
-
-	// Convert to SearchHit
-	hits := make([]search.SearchHit, 0, len(rows))
-	for _, r := range rows {
-		hit := search.SearchHit{
-			ID:        r.ID,
-			Type:      "log",
-			Timestamp: r.Timestamp,
-			Level:     r.Level,
-			Message:   r.Message,
-			Fields:    map[string]any{},
-		}
-		// Highlight: simple substring match for keywords
-		if len(q.Keywords) > 0 {
-			hit.Highlight = highlightFields(r.Message, q.Keywords)
-		}
-		hits = append(hits, hit)
-	}
-
-	// Facets: level distribution
-	facets := make(map[string]search.Facet)
-	if len(q.Filters) > 0 || len(q.Keywords) > 0 || !q.TimeRange.Start.IsZero() {
-		// Rebuild filtered query for facets
-		fdb := a.db.WithContext(ctx).Table("logs").
-			Where("project_id = ?", q.ProjectID)
-		if !q.TimeRange.Start.IsZero() {
-			fdb = fdb.Where("timestamp >= ?", q.TimeRange.Start)
-		}
-		if !q.TimeRange.End.IsZero() {
-			fdb = fdb.Where("timestamp <= ?", q.TimeRange.End)
-		}
-		for _, f := range q.Filters {
-			fdb = applyFilter(fdb, f)
-		}
-		for _, kw := range q.Keywords {
-			fdb = fdb.Where("message ILIKE ?", "%"+kw+"%")
-		}
-
-		type levelBucket struct {
-			Level string
-			Count int64
-		}
-		var buckets []levelBucket
-		if err := fdb.Select("level, COUNT(*) as count").
-			Group("level").
-			Find(&buckets).Error; err == nil {
-			fb := make([]search.FacetBucket, 0, len(buckets))
-			for _, b := range buckets {
-				fb = append(fb, search.FacetBucket{Key: b.Level, Count: b.Count})
-			}
-			facets["level"] = search.Facet{Field: "level", Buckets: fb}
+	facets, err := a.facets(ctx, schemas, counts, q)
+	if err != nil {
+		return nil, err
+	}
+	var histogram *search.Histogram
+	if q.Histogram {
+		if histogram, err = a.histogram(ctx, schemas, counts, q); err != nil {
+			return nil, err
 		}
 	}
 
 	return &search.SearchResult{
-		Total:  total,
-		Hits:   hits,
-		Facets: facets,
+		Total:         total,
+		TotalRelation: relation,
+		Hits:          hits,
+		NextCursor:    next,
+		Facets:        facets,
+		Histogram:     histogram,
 	}, nil
 }
 
-// applyFilter translates a Filter to a GORM where clause.
-func applyFilter(qdb *gorm.DB, f search.Filter) *gorm.DB {
-	col := f.Field
-	// Map common field names to DB columns
-	col = mapColumn(col)
-
-	switch strings.ToLower(f.Operator) {
-	case "eq", "":
-		return qdb.Where(col+" = ?", f.Value)
-	case "neq":
-		return qdb.Where(col+" != ?", f.Value)
-	case "contains":
-		return qdb.Where(col+" ILIKE ?", "%"+fmt.Sprint(f.Value)+"%")
-	case "in":
-		return qdb.Where(col+" IN ?", f.Value)
-	case "exists":
-		return qdb.Where(col+" IS NOT NULL AND " + col + " != ''")
-	case "not_exists":
-		return qdb.Where(col + " IS NULL OR " + col + " = ''")
+// filtered is the query on s's table narrowed to q's project, time range
+// and query.
+func (a *PostgresAdapter) filtered(ctx context.Context, s *schema, q search.SearchQuery) (*gorm.DB, error) {
+	return a.filteredFrom(ctx, s.table, s, q)
+}
+
+// filteredFrom is filtered reading from the given FROM item, s's table or a
+// sample of it.
+func (a *PostgresAdapter) filteredFrom(ctx context.Context, from string, s *schema, q search.SearchQuery) (*gorm.DB, error) {
+	qdb := a.db.WithContext(ctx).Table(from).
+		Where("project_id = ?", q.ProjectID)
+	if !q.TimeRange.Start.IsZero() {
+		qdb = qdb.Where("timestamp >= ?", q.TimeRange.Start)
+	}
+	if !q.TimeRange.End.IsZero() {
+		qdb = qdb.Where("timestamp <= ?", q.TimeRange.End)
+	}
+	return a.where(qdb, s, q.Query)
+}
+
+// fetch reads the first limit rows of qdb in (timestamp, id) order as hits.
+func (a *PostgresAdapter) fetch(qdb *gorm.DB, s *schema, asc bool, limit int) ([]search.SearchHit, error) {
+	qdb = qdb.Order(cursor.Order("timestamp", "id", asc)).Limit(limit)
+
+	switch s {
+	case eventsSchema:
+		var rows []struct {
+			ID          string
+			Timestamp   time.Time
+			Level       string
+			Title       string
+			ReleaseTag  string
+			Environment string
+			OS          string
+			Platform    string
+			UserID      string
+			DistinctID  string
+			DeviceID    string
+			Fingerprint string
+		}
+		if err := qdb.Select("id, timestamp, level, title, release_tag, environment, os, platform, user_id, distinct_id, device_id, fingerprint").
+			Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		hits := make([]search.SearchHit, 0, len(rows))
+		for _, r := range rows {
+			fields := map[string]any{}
+			for k, v := range map[string]string{
+				"release":     r.ReleaseTag,
+				"environment": r.Environment,
+				"os":          r.OS,
+				"platform":    r.Platform,
+				"user_id":     r.UserID,
+				"distinct_id": r.DistinctID,
+				"device_id":   r.DeviceID,
+				"fingerprint": r.Fingerprint,
+			} {
+				if v != "" {
+					fields[k] = v
+				}
+			}
+			hits = append(hits, search.SearchHit{
+				ID:        r.ID,
+				Type:      "event",
+				Timestamp: r.Timestamp,
+				Level:     r.Level,
+				Message:   r.Title,
+				Fields:    fields,
+			})
+		}
+		return hits, nil
+
+	case trackSchema:
+		var rows []struct {
+			ID         int64
+			Timestamp  time.Time
+			Name       string
+			DistinctID string
+			DeviceID   string
+		}
+		if err := qdb.Select("id, timestamp, name, distinct_id, device_id").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		hits := make([]search.SearchHit, 0, len(rows))
+		for _, r := range rows {
+			fields := map[string]any{"distinct_id": r.DistinctID}
+			if r.DeviceID != "" {
+				fields["device_id"] = r.DeviceID
+			}
+			hits = append(hits, search.SearchHit{
+				ID:        r.ID,
+				Type:      "track",
+				Timestamp: r.Timestamp,
+				Level:     "event",
+				Message:   r.Name,
+				Fields:    fields,
+			})
+		}
+		return hits, nil
+
 	default:
-		return qdb.Where(col+" = ?", f.Value)
+		var rows []struct {
+			ID        int64
+			Timestamp time.Time
+			Level     string
+			TraceID   string
+			SpanID    string
+			PatternID string
+			Message   string
+			Fields    string // jsonb as string
+		}
+		if err := qdb.Select(a.LogColumns()).
+			Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		hits := make([]search.SearchHit, 0, len(rows))
+		for _, r := range rows {
+			fields := map[string]any{}
+			_ = json.Unmarshal([]byte(r.Fields), &fields)
+			hits = append(hits, search.SearchHit{
+				ID:        r.ID,
+				Type:      "log",
+				Timestamp: r.Timestamp,
+				Level:     r.Level,
+				Message:   r.Message,
+				TraceID:   r.TraceID,
+				SpanID:    r.SpanID,
+				PatternID: r.PatternID,
+				Fields:    fields,
+			})
+		}
+		return hits, nil
 	}
 }
 
-// mapColumn maps DSL field names to actual DB columns.
-func mapColumn(field string) string {
-	m := map[string]string{
-		"level":       "level",
-		"trace_id":    "trace_id",
-		"traceid":     "trace_id",
-		"span_id":     "span_id",
-		"spanid":      "span_id",
-		"message":     "message",
-		"environment": "fields->>'environment'",
-		"service":     "fields->>'service'",
-		"tag":         "fields->>'tag'",
+// Where narrows a query on the logs table to the rows matching query; nil
+// matches everything.
+func (a *PostgresAdapter) Where(qdb *gorm.DB, query search.Node) (*gorm.DB, error) {
+	return a.where(qdb, logsSchema, query)
+}
+
+// Filtered is the query on source's table narrowed to q's project, time
+// range and query, comparing fields by the project's property types. Rows
+// are read as the table stores them; q's sort, pagination and aggregations
+// are ignored.
+func (a *PostgresAdapter) Filtered(ctx context.Context, source string, q search.SearchQuery) (*gorm.DB, error) {
+	s, ok := sourceSchemas[source]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown source %q", search.ErrInvalidQuery, source)
+	}
+	a, err := a.ForProject(ctx, q.ProjectID)
+	if err != nil {
+		return nil, err
 	}
-	if mapped, ok := m[strings.ToLower(field)]; ok {
-		return mapped
+	return a.filtered(ctx, s, q)
+}
+
+func (a *PostgresAdapter) where(qdb *gorm.DB, s *schema, query search.Node) (*gorm.DB, error) {
+	if query == nil {
+		return qdb, nil
+	}
+	sql, args, err := a.translator(s).translate(query)
+	if err != nil {
+		return nil, err
 	}
-	// Default: try as a direct column name
-	return field
+	return qdb.Where(sql, args...), nil
 }
 
 // highlightFields returns simple highlight snippets for keywords found in message.
@@ -0,0 +1,351 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/cursor"
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"github.com/aak1247/logtap/internal/testkit"
+	"github.com/google/uuid"
+)
+
+func TestSearchQueryLanguage(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	logs := []model.Log{
+		{ProjectID: 1, Timestamp: now.Add(-2 * time.Hour), Level: "error", Message: "payment failed", Fields: []byte(`{"service":"checkout","latency_ms":900,"http":{"route":"/pay"}}`)},
+		{ProjectID: 1, Timestamp: now.Add(-30 * time.Minute), Level: "error", Message: "disk full on node-1", Fields: []byte(`{"service":"storage","latency_ms":"120"}`)},
+		{ProjectID: 1, Timestamp: now.Add(-10 * time.Minute), Level: "error", Message: "connection timeout", Fields: []byte(`{}`)},
+		{ProjectID: 1, Timestamp: now.Add(-5 * time.Minute), Level: "info", Message: "payment ok", Fields: []byte(`{"service":"checkout","latency_ms":40,"user":{"id":"u1"}}`)},
+		{ProjectID: 2, Timestamp: now, Level: "error", Message: "payment failed", Fields: []byte(`{"service":"storage"}`)},
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	messages := func(q string) []string {
+		t.Helper()
+		parsed, err := search.NewQueryParser().Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		res, err := postgres.NewAdapter(db).Search(context.Background(), search.SearchQuery{
+			ProjectID:  1,
+			Query:      parsed.Root,
+			Pagination: search.Pagination{Limit: 50},
+		})
+		if err != nil {
+			t.Fatalf("Search(%q): %v", q, err)
+		}
+		out := make([]string, 0, len(res.Hits))
+		for _, h := range res.Hits {
+			out = append(out, h.Message)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	for q, want := range map[string][]string{
+		``:                              {"connection timeout", "disk full on node-1", "payment failed", "payment ok"},
+		`level:error -service:checkout`: {"connection timeout", "disk full on node-1"},
+		`level:error AND NOT fields.service:checkout`: {"connection timeout", "disk full on node-1"},
+		`payment OR timeout`:                          {"connection timeout", "payment failed", "payment ok"},
+		`service:(checkout OR storage) -level:info`:   {"disk full on node-1", "payment failed"},
+		`fields.latency_ms:>100`:                      {"disk full on node-1", "payment failed"},
+		`fields.latency_ms:[40 TO 120]`:               {"disk full on node-1", "payment ok"},
+		`latency_ms:<100`:                             {"payment ok"},
+		`timestamp:>now-1h`:                           {"connection timeout", "disk full on node-1", "payment ok"},
+		`timestamp:[now-3h TO now-20m]`:               {"disk full on node-1", "payment failed"},
+		`service:check*`:                              {"payment failed", "payment ok"},
+		`node-?`:                                      {"disk full on node-1"},
+		`"payment failed"`:                            {"payment failed"},
+		`user.id:*`:                                   {"payment ok"},
+		`http.route:/pay`:                             {"payment failed"},
+		`-service:*`:                                  {"connection timeout"},
+		`message:50%`:                                 {},
+	} {
+		got := messages(q)
+		if len(got) != len(want) {
+			t.Errorf("%q: got %v, want %v", q, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%q: got %v, want %v", q, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, q := range []string{`fields..a:1`, `timestamp:>yesterday`, `timestamp:ab*`} {
+		parsed, err := search.NewQueryParser().Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		if err := postgres.Validate(parsed.Root); !errors.Is(err, search.ErrInvalidQuery) {
+			t.Errorf("Validate(%q): expected an invalid query, got %v", q, err)
+		}
+	}
+}
+
+func TestSearchSources(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	logs := []model.Log{
+		{ProjectID: 1, Timestamp: now.Add(-4 * time.Minute), Level: "error", Message: "payment failed", Fields: []byte(`{"release":"1.2.0"}`)},
+		{ProjectID: 1, Timestamp: now.Add(-1 * time.Minute), Level: "info", Message: "payment retried", Fields: []byte(`{}`)},
+	}
+	events := []model.Event{
+		{ID: uuid.New(), ProjectID: 1, Timestamp: now.Add(-3 * time.Minute), Level: "error", Title: "PaymentError: card declined", ReleaseTag: "1.2.0", Environment: "production", OS: "iOS", Data: []byte(`{"contexts":{"os":{"name":"iOS","version":"17.1"}}}`)},
+		{ID: uuid.New(), ProjectID: 1, Timestamp: now.Add(-10 * time.Minute), Level: "warning", Title: "Slow frame", ReleaseTag: "1.1.0", OS: "Android", Data: []byte(`{}`)},
+	}
+	track := []model.TrackEvent{
+		{ProjectID: 1, Timestamp: now.Add(-2 * time.Minute), Name: "payment_submitted", DistinctID: "u1"},
+	}
+	for _, rows := range []any{&logs, &events, &track} {
+		if err := db.Create(rows).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	run := func(q string, sources []string, offset, limit int) *search.SearchResult {
+		t.Helper()
+		parsed, err := search.NewQueryParser().Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		res, err := postgres.NewAdapter(db).Search(context.Background(), search.SearchQuery{
+			ProjectID:  1,
+			Query:      parsed.Root,
+			Sources:    sources,
+			Sort:       search.SortSpec{Field: "timestamp", Order: "desc"},
+			Pagination: search.Pagination{Offset: offset, Limit: limit},
+		})
+		if err != nil {
+			t.Fatalf("Search(%q, %v): %v", q, sources, err)
+		}
+		return res
+	}
+	all := []string{search.SourceLogs, search.SourceEvents, search.SourceTrack}
+	hitsOf := func(res *search.SearchResult) []string {
+		out := make([]string, 0, len(res.Hits))
+		for _, h := range res.Hits {
+			out = append(out, h.Type+":"+h.Message)
+		}
+		return out
+	}
+	expect := func(name string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+				return
+			}
+		}
+	}
+
+	res := run("payment", all, 0, 10)
+	expect("merged", hitsOf(res), "log:payment retried", "track:payment_submitted", "event:PaymentError: card declined", "log:payment failed")
+	if res.Total != 4 {
+		t.Errorf("total = %d, want 4", res.Total)
+	}
+	if f := res.Facets["source"]; len(f.Buckets) != 3 || f.Buckets[0].Key != search.SourceLogs || f.Buckets[0].Count != 2 {
+		t.Errorf("source facet = %+v", f)
+	}
+	if h := res.Hits[2]; h.Fields["release"] != "1.2.0" || h.Fields["os"] != "iOS" || h.Level != "error" {
+		t.Errorf("event hit = %+v", h)
+	}
+
+	expect("page", hitsOf(run("payment", all, 1, 2)), "track:payment_submitted", "event:PaymentError: card declined")
+	expect("logs only", hitsOf(run("payment", nil, 0, 10)), "log:payment retried", "log:payment failed")
+	expect("release", hitsOf(run("release:1.2.0", all, 0, 10)), "event:PaymentError: card declined", "log:payment failed")
+	expect("data path", hitsOf(run("data.contexts.os.version:>=17 os:iOS", []string{search.SourceEvents}, 0, 10)), "event:PaymentError: card declined")
+	expect("environment", hitsOf(run("environment:production", []string{search.SourceEvents}, 0, 10)), "event:PaymentError: card declined")
+	expect("negation", hitsOf(run("-level:error", all, 0, 10)), "log:payment retried", "track:payment_submitted", "event:Slow frame")
+	expect("track fields", hitsOf(run("name:payment_* distinct_id:u1", all, 0, 10)), "track:payment_submitted")
+}
+
+func TestSearchFacetsAndHistogram(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	base := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	var logs []model.Log
+	for i := 0; i < 30; i++ {
+		service := []string{"checkout", "checkout", "storage"}[i%3]
+		logs = append(logs, model.Log{
+			ProjectID: 1,
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			Level:     []string{"error", "info"}[i%2],
+			Message:   "request",
+			Fields:    []byte(`{"service":"` + service + `","http":{"route":"/r` + string(rune('a'+i%4)) + `"}}`),
+		})
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	run := func(a *postgres.PostgresAdapter, q search.SearchQuery) *search.SearchResult {
+		t.Helper()
+		q.ProjectID = 1
+		q.Pagination = search.Pagination{Limit: 5}
+		res, err := a.Search(context.Background(), q)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		return res
+	}
+
+	res := run(postgres.NewAdapter(db), search.SearchQuery{Facets: []string{"fields.service", "http.route", "level", "missing"}, FacetSize: 3})
+	if f := res.Facets["fields.service"]; len(f.Buckets) != 2 || f.Buckets[0] != (search.FacetBucket{Key: "checkout", Count: 20}) || f.Buckets[1].Count != 10 || f.Sampled {
+		t.Errorf("service facet = %+v", f)
+	}
+	if f := res.Facets["http.route"]; len(f.Buckets) != 3 || f.Buckets[0] != (search.FacetBucket{Key: "/ra", Count: 8}) {
+		t.Errorf("route facet = %+v", f)
+	}
+	if f := res.Facets["level"]; len(f.Buckets) != 2 || f.Buckets[0].Count != 15 {
+		t.Errorf("level facet = %+v", f)
+	}
+	if f := res.Facets["missing"]; len(f.Buckets) != 0 {
+		t.Errorf("missing facet = %+v", f)
+	}
+	if res.Histogram != nil {
+		t.Errorf("histogram computed without being asked for")
+	}
+
+	// Automatic interval over the span of the matches: 29 minutes.
+	res = run(postgres.NewAdapter(db), search.SearchQuery{Histogram: true})
+	h := res.Histogram
+	if h == nil || h.IntervalSec != 30 || len(h.Buckets) != 59 || h.Buckets[0].Time != base || h.Buckets[0].Count != 1 || h.Buckets[1].Count != 0 {
+		t.Fatalf("histogram = %+v", h)
+	}
+
+	// Explicit range and interval, with empty buckets.
+	res = run(postgres.NewAdapter(db), search.SearchQuery{
+		TimeRange: search.TimeRange{Start: base.Add(-10 * time.Minute), End: base.Add(40*time.Minute - time.Second)},
+		Histogram: true,
+		Interval:  10 * time.Minute,
+	})
+	var counts []int64
+	for _, b := range res.Histogram.Buckets {
+		counts = append(counts, b.Count)
+	}
+	if want := []int64{0, 10, 10, 10, 0}; fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("histogram counts = %v, want %v", counts, want)
+	}
+
+	// Sampled counting reads every third log and scales the counts.
+	res = run(postgres.NewAdapter(db).SetSampling(10, 10), search.SearchQuery{Facets: []string{"service"}, Histogram: true, Interval: time.Hour})
+	if f := res.Facets["service"]; !f.Sampled || len(f.Buckets) == 0 || f.Buckets[0].Count%3 != 0 {
+		t.Errorf("sampled facet = %+v", f)
+	}
+	if h := res.Histogram; !h.Sampled || len(h.Buckets) != 1 || h.Buckets[0].Count != 30 {
+		t.Errorf("sampled histogram = %+v", h)
+	}
+	if res.Total != 30 {
+		t.Errorf("total = %d, want the exact count", res.Total)
+	}
+
+	for _, q := range []search.SearchQuery{
+		{Facets: []string{"timestamp"}},
+		{Facets: []string{"fields..x"}},
+		{Histogram: true, Interval: time.Second},
+	} {
+		q.ProjectID = 1
+		q.Pagination.Limit = 5
+		if _, err := postgres.NewAdapter(db).Search(context.Background(), q); !errors.Is(err, search.ErrInvalidQuery) {
+			t.Errorf("Search(%+v): expected an invalid query, got %v", q, err)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	var logs []model.Log
+	for i := 0; i < 5; i++ {
+		logs = append(logs, model.Log{ProjectID: 1, Timestamp: now.Add(-time.Duration(i/2) * time.Minute), Level: "info", Message: fmt.Sprintf("log %d", i), Fields: []byte(`{}`)})
+	}
+	var events []model.Event
+	for i := 0; i < 3; i++ {
+		events = append(events, model.Event{ID: uuid.New(), ProjectID: 1, Timestamp: now.Add(-time.Duration(i) * time.Minute), Level: "error", Title: fmt.Sprintf("event %d", i), Data: []byte(`{}`)})
+	}
+	track := []model.TrackEvent{
+		{ProjectID: 1, Timestamp: now, Name: "track 0", DistinctID: "u1"},
+		{ProjectID: 1, Timestamp: now.Add(-time.Minute), Name: "track 1", DistinctID: "u1"},
+	}
+	for _, rows := range []any{&logs, &events, &track} {
+		if err := db.Create(rows).Error; err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	sources := []string{search.SourceLogs, search.SourceEvents, search.SourceTrack}
+	run := func(a *postgres.PostgresAdapter, q search.SearchQuery) *search.SearchResult {
+		t.Helper()
+		q.ProjectID = 1
+		q.Sources = sources
+		q.Sort = search.SortSpec{Field: "timestamp", Order: "desc"}
+		res, err := a.Search(context.Background(), q)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		return res
+	}
+	messages := func(hits []search.SearchHit) []string {
+		out := make([]string, 0, len(hits))
+		for _, h := range hits {
+			out = append(out, h.Message)
+		}
+		return out
+	}
+
+	all := run(postgres.NewAdapter(db), search.SearchQuery{Pagination: search.Pagination{Limit: 50}})
+	if all.Total != 10 || all.TotalRelation != search.RelationEq || all.NextCursor != "" {
+		t.Fatalf("all: total %d %s, next %q", all.Total, all.TotalRelation, all.NextCursor)
+	}
+	want := messages(all.Hits)
+
+	var got []string
+	var after *cursor.Cursor
+	for page := 0; ; page++ {
+		res := run(postgres.NewAdapter(db), search.SearchQuery{Pagination: search.Pagination{Limit: 3}, After: after})
+		got = append(got, messages(res.Hits)...)
+		if page == 0 {
+			// Newer logs must not shift the following pages.
+			if err := db.Create(&model.Log{ProjectID: 1, Timestamp: now.Add(time.Minute), Level: "info", Message: "late", Fields: []byte(`{}`)}).Error; err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		var err error
+		if after, err = cursor.Parse(res.NextCursor); err != nil {
+			t.Fatalf("parse cursor: %v", err)
+		}
+		if page > 5 {
+			t.Fatalf("too many pages")
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("paged %v, want %v", got, want)
+	}
+
+	capped := run(postgres.NewAdapter(db).SetCountCap(4), search.SearchQuery{Pagination: search.Pagination{Limit: 2}, Total: search.TotalCapped})
+	if capped.Total != 4+3+2 || capped.TotalRelation != search.RelationGte {
+		// Only the logs reach the cap.
+		t.Fatalf("capped: total %d %s", capped.Total, capped.TotalRelation)
+	}
+	estimated := run(postgres.NewAdapter(db), search.SearchQuery{Pagination: search.Pagination{Limit: 2}, Total: search.TotalEstimate})
+	if estimated.Total != 11 || estimated.TotalRelation != search.RelationEq {
+		t.Fatalf("estimate on sqlite: total %d %s", estimated.Total, estimated.TotalRelation)
+	}
+}
@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/partition"
+	"github.com/aak1247/logtap/internal/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultSlowSearch is how long a search takes before the properties it
+// filters on are counted in model.SlowSearchField.
+const DefaultSlowSearch = time.Second
+
+// PropertyTypes reads the declared types of a project's properties
+// (model.PropertyDefinition), by path in fields.
+func (a *PostgresAdapter) PropertyTypes(ctx context.Context, projectID int) (map[string]string, error) {
+	var rows []struct {
+		Key  string
+		Type string
+	}
+	if err := a.db.WithContext(ctx).Model(&model.PropertyDefinition{}).
+		Select("key, type").
+		Where("project_id = ?", projectID).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(rows))
+	for _, r := range rows {
+		types[strings.TrimPrefix(r.Key, "fields.")] = strings.ToLower(r.Type)
+	}
+	return types, nil
+}
+
+// WithTypes returns a copy of the adapter that compares the properties in
+// types (path -> type, see PropertyTypes) as their type: numbers
+// numerically, booleans as booleans, datetimes as times.
+func (a *PostgresAdapter) WithTypes(types map[string]string) *PostgresAdapter {
+	c := *a
+	c.types = types
+	return &c
+}
+
+// ForProject is WithTypes with the types of projectID.
+func (a *PostgresAdapter) ForProject(ctx context.Context, projectID int) (*PostgresAdapter, error) {
+	types, err := a.PropertyTypes(ctx, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("property types: %w", err)
+	}
+	return a.WithTypes(types), nil
+}
+
+// PropertyIndexExpr is the expression searches compare property key of type
+// typ with; an index on it serves them. Datetimes cannot be indexed: their
+// cast to a time depends on the session's time zone.
+func (a *PostgresAdapter) PropertyIndexExpr(key, typ string) (string, error) {
+	t := a.translator(logsSchema)
+	f, err := t.field("fields." + strings.TrimPrefix(key, "fields."))
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case typeNumber:
+		return t.number(f), nil
+	case typeBoolean:
+		return t.boolean(f), nil
+	case typeDatetime:
+		return "", fmt.Errorf("%w: datetime properties cannot be indexed", search.ErrInvalidQuery)
+	}
+	return t.text(f), nil
+}
+
+// PropertyIndexName names the index on expr; the same expression always
+// gets the same name, so projects share it.
+func PropertyIndexName(expr string) string {
+	sum := sha256.Sum256([]byte(expr))
+	return "idx_logs_prop_" + hex.EncodeToString(sum[:8])
+}
+
+// CreatePropertyIndex builds index name on logs (project_id, expr). On
+// PostgreSQL it is built CONCURRENTLY unless logs is partitioned or a
+// hypertable, which do not support it; an invalid index left by an earlier
+// failed build is replaced.
+func (a *PostgresAdapter) CreatePropertyIndex(ctx context.Context, name, expr string) error {
+	db := a.db.WithContext(ctx)
+	def := name + " ON logs (project_id, (" + expr + "))"
+	if a.isSQLite() {
+		return db.Exec("CREATE INDEX IF NOT EXISTS " + def).Error
+	}
+	var valid []bool
+	if err := db.Raw("SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass(?)", name).Scan(&valid).Error; err != nil {
+		return err
+	}
+	if len(valid) == 1 && !valid[0] {
+		if err := a.DropPropertyIndex(ctx, name); err != nil {
+			return err
+		}
+	}
+	concurrent, err := a.concurrentIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	if !concurrent {
+		return db.Exec("CREATE INDEX IF NOT EXISTS " + def).Error
+	}
+	if err := db.Exec("CREATE INDEX CONCURRENTLY IF NOT EXISTS " + def).Error; err != nil {
+		// A failed concurrent build leaves an invalid index behind.
+		cleanup, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if derr := a.db.WithContext(cleanup).Exec("DROP INDEX IF EXISTS " + name).Error; derr != nil {
+			log.Printf("search: drop invalid index %s: %v", name, derr)
+		}
+		return err
+	}
+	return nil
+}
+
+// DropPropertyIndex drops index name, CONCURRENTLY where it was built so.
+func (a *PostgresAdapter) DropPropertyIndex(ctx context.Context, name string) error {
+	db := a.db.WithContext(ctx)
+	if a.isSQLite() {
+		return db.Exec("DROP INDEX IF EXISTS " + name).Error
+	}
+	concurrent, err := a.concurrentIndexes(ctx)
+	if err != nil {
+		return err
+	}
+	if concurrent {
+		return db.Exec("DROP INDEX CONCURRENTLY IF EXISTS " + name).Error
+	}
+	return db.Exec("DROP INDEX IF EXISTS " + name).Error
+}
+
+// concurrentIndexes reports whether logs is a plain table, on which indexes
+// can be built and dropped CONCURRENTLY.
+func (a *PostgresAdapter) concurrentIndexes(ctx context.Context) (bool, error) {
+	return partition.ConcurrentIndexes(ctx, a.db, "logs")
+}
+
+// RecordSlow counts, when a search of projectID took at least the slow
+// threshold, each property its query filters on in model.SlowSearchField.
+// Failing to do so is only logged.
+func (a *PostgresAdapter) RecordSlow(ctx context.Context, projectID int, query search.Node, took time.Duration) {
+	if took < a.slowSearch || query == nil {
+		return
+	}
+	t := a.translator(logsSchema)
+	now := time.Now().UTC()
+	ms := took.Milliseconds()
+	var rows []model.SlowSearchField
+	seen := map[string]bool{}
+	for _, name := range search.Fields(query) {
+		f, err := t.field(name)
+		path := strings.TrimPrefix(name, "fields.")
+		if err != nil || f.kind != kindJSON || seen[path] {
+			continue
+		}
+		seen[path] = true
+		rows = append(rows, model.SlowSearchField{ProjectID: projectID, Field: path, Count: 1, TotalMs: ms, MaxMs: ms, LastSeen: now})
+	}
+	if len(rows) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+	if err := a.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "project_id"}, {Name: "field"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count":     gorm.Expr("slow_search_fields.count + 1"),
+			"total_ms":  gorm.Expr("slow_search_fields.total_ms + EXCLUDED.total_ms"),
+			"max_ms":    gorm.Expr("CASE WHEN EXCLUDED.max_ms > slow_search_fields.max_ms THEN EXCLUDED.max_ms ELSE slow_search_fields.max_ms END"),
+			"last_seen": gorm.Expr("EXCLUDED.last_seen"),
+		}),
+	}).Create(&rows).Error; err != nil {
+		log.Printf("search: record slow search: %v", err)
+	}
+}
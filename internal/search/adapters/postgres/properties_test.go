@@ -0,0 +1,174 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/search/adapters/postgres"
+	"github.com/aak1247/logtap/internal/testkit"
+	"gorm.io/gorm"
+)
+
+func TestTypedProperties(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	now := time.Now().UTC()
+	logs := []model.Log{
+		{ProjectID: 1, Timestamp: now, Message: "a", Fields: []byte(`{"latency":"100.0","ok":true,"at":"2025-01-02T03:04:05Z","code":"007"}`)},
+		{ProjectID: 1, Timestamp: now, Message: "b", Fields: []byte(`{"latency":100,"ok":"yes","at":"2025-03-01T00:00:00+08:00","code":7}`)},
+		{ProjectID: 1, Timestamp: now, Message: "c", Fields: []byte(`{"latency":"slow","ok":false,"at":"soon"}`)},
+		{ProjectID: 1, Timestamp: now, Message: "d", Fields: []byte(`{"at":"2025-13-45"}`)},
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	for key, typ := range map[string]string{"latency": "number", "ok": "boolean", "at": "datetime", "code": "string"} {
+		if err := db.Create(&model.PropertyDefinition{ProjectID: 1, Key: key, DisplayName: key, Type: typ}).Error; err != nil {
+			t.Fatalf("create definition: %v", err)
+		}
+	}
+	search1 := func(q string) ([]string, error) {
+		parsed, err := search.NewQueryParser().Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", q, err)
+		}
+		res, err := postgres.NewAdapter(db).Search(context.Background(), search.SearchQuery{
+			ProjectID:  1,
+			Query:      parsed.Root,
+			Pagination: search.Pagination{Limit: 50},
+		})
+		if err != nil {
+			return nil, err
+		}
+		out := []string{}
+		for _, h := range res.Hits {
+			out = append(out, h.Message)
+		}
+		sort.Strings(out)
+		return out, nil
+	}
+
+	for q, want := range map[string]string{
+		`latency:100`:                          "a b",
+		`latency:[50 TO 150]`:                  "a b",
+		`-latency:100`:                         "c d",
+		`ok:true`:                              "a b",
+		`ok:no`:                                "c",
+		`at:>2025-01-01`:                       "a b",
+		`at:[2025-01-01 TO 2025-02-01}`:        "a",
+		`at:"2025-02-28T16:00:00Z"`:            "b",
+		`code:007`:                             "a",
+		`code:[0 TO 1]`:                        "a",
+		`latency:* AND NOT fields.latency:100`: "c",
+	} {
+		got, err := search1(q)
+		if err != nil {
+			t.Errorf("%q: %v", q, err)
+			continue
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("%q: got %v, want %s", q, got, want)
+		}
+	}
+	for _, q := range []string{`latency:fast`, `latency:[a TO b]`, `ok:maybe`, `ok:[true TO false]`, `at:[soon TO later]`, `at:2025-13-45`, `at:>2025-02-30`} {
+		if _, err := search1(q); !errors.Is(err, search.ErrInvalidQuery) {
+			t.Errorf("%q: expected an invalid query, got %v", q, err)
+		}
+	}
+}
+
+func TestPropertyIndex(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	ctx := context.Background()
+	a := postgres.NewAdapter(db)
+
+	if _, err := a.PropertyIndexExpr("at", "datetime"); !errors.Is(err, search.ErrInvalidQuery) {
+		t.Fatalf("datetime index: %v", err)
+	}
+	expr, err := a.PropertyIndexExpr("fields.latency", "number")
+	if err != nil {
+		t.Fatalf("PropertyIndexExpr: %v", err)
+	}
+	name := postgres.PropertyIndexName(expr)
+	if name != postgres.PropertyIndexName(expr) || !strings.HasPrefix(name, "idx_logs_prop_") {
+		t.Fatalf("name = %q", name)
+	}
+	if err := a.CreatePropertyIndex(ctx, name, expr); err != nil {
+		t.Fatalf("CreatePropertyIndex: %v", err)
+	}
+
+	// A typed search compares the indexed expression, so the index serves it.
+	explain := func(adapter *postgres.PostgresAdapter, q string) string {
+		t.Helper()
+		parsed, _ := search.NewQueryParser().Parse(q)
+		sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			q, err := adapter.Where(tx.Model(&model.Log{}).Where("project_id = ?", 1), parsed.Root)
+			if err != nil {
+				t.Fatalf("Where: %v", err)
+			}
+			var rows []model.Log
+			return q.Find(&rows)
+		})
+		var plan []struct{ Detail string }
+		if err := db.Raw("EXPLAIN QUERY PLAN " + sql).Scan(&plan).Error; err != nil {
+			t.Fatalf("explain: %v", err)
+		}
+		if len(plan) == 0 {
+			t.Fatalf("no plan for %q", q)
+		}
+		return plan[0].Detail
+	}
+	// Both columns of the index, not just project_id.
+	if plan := explain(a.WithTypes(map[string]string{"latency": "number"}), `latency:100`); !strings.Contains(plan, name) || !strings.Contains(plan, "AND ") {
+		t.Fatalf("plan %q does not use %s", plan, name)
+	}
+
+	// An undeclared key is indexed as a string, which its searches use too.
+	expr, err = a.PropertyIndexExpr("code", "string")
+	if err != nil {
+		t.Fatalf("PropertyIndexExpr: %v", err)
+	}
+	code := postgres.PropertyIndexName(expr)
+	if err := a.CreatePropertyIndex(ctx, code, expr); err != nil {
+		t.Fatalf("CreatePropertyIndex: %v", err)
+	}
+	if plan := explain(a, `code:007`); !strings.Contains(plan, code) || !strings.Contains(plan, "AND ") {
+		t.Fatalf("plan %q does not use %s", plan, code)
+	}
+
+	if err := a.DropPropertyIndex(ctx, name); err != nil {
+		t.Fatalf("DropPropertyIndex: %v", err)
+	}
+	var n int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", name).Scan(&n)
+	if n != 0 {
+		t.Fatalf("index %s still exists", name)
+	}
+}
+
+func TestRecordSlow(t *testing.T) {
+	db := testkit.OpenTestDB(t)
+	ctx := context.Background()
+	a := postgres.NewAdapter(db)
+	parsed, _ := search.NewQueryParser().Parse(`level:error fields.latency:>100 latency:<900 user.id:u1`)
+
+	a.RecordSlow(ctx, 1, parsed.Root, 10*time.Millisecond)
+	a.RecordSlow(ctx, 1, parsed.Root, 2*time.Second)
+	a.RecordSlow(ctx, 1, parsed.Root, 3*time.Second)
+
+	var rows []model.SlowSearchField
+	if err := db.Order("field").Find(&rows).Error; err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Field != "latency" || rows[1].Field != "user.id" {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if r := rows[0]; r.Count != 2 || r.TotalMs != 5000 || r.MaxMs != 3000 {
+		t.Fatalf("latency = %+v", r)
+	}
+}
@@ -0,0 +1,499 @@
+package postgres
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/search"
+)
+
+// translator turns a query tree into a WHERE clause on a source table.
+// Field names only reach the SQL once resolved to a known column or a
+// validated JSON path; values are always bound parameters.
+type translator struct {
+	sqlite bool
+	like   string
+	now    time.Time
+	schema *schema
+	types  map[string]string // JSON path -> property type, see typed
+}
+
+func (a *PostgresAdapter) translator(s *schema) translator {
+	t := translator{sqlite: a.isSQLite(), like: a.likeOp(), now: time.Now().UTC(), schema: s}
+	if s == logsSchema {
+		t.types = a.types
+	}
+	return t
+}
+
+// Validate reports whether query can be translated on the logs table, that
+// is whether its fields and bounds are valid.
+func Validate(query search.Node) error {
+	if query == nil {
+		return nil
+	}
+	_, _, err := translator{like: "ILIKE", now: time.Now().UTC(), schema: logsSchema}.translate(query)
+	return err
+}
+
+// schema describes how query fields map onto a searchable table.
+type schema struct {
+	source  string
+	table   string
+	columns map[string]string // query field -> column expression
+	text    string            // the column free text searches
+	json    string            // the JSON column other fields are read from; "" for none
+}
+
+var logsSchema = &schema{
+	source: search.SourceLogs,
+	table:  "logs",
+	columns: map[string]string{
+		"level":       "level",
+		"trace_id":    "trace_id",
+		"traceid":     "trace_id",
+		"span_id":     "span_id",
+		"spanid":      "span_id",
+		"message":     "message",
+		"distinct_id": "distinct_id",
+		"device_id":   "device_id",
+		"pattern_id":  "pattern_id",
+	},
+	text: "message",
+	json: "fields",
+}
+
+var eventsSchema = &schema{
+	source: search.SourceEvents,
+	table:  "events",
+	columns: map[string]string{
+		"level":       "level",
+		"title":       "title",
+		"message":     "title",
+		"release":     "release_tag",
+		"environment": "environment",
+		"env":         "environment",
+		"os":          "os",
+		"platform":    "platform",
+		"user_id":     "user_id",
+		"distinct_id": "distinct_id",
+		"device_id":   "device_id",
+		"fingerprint": "fingerprint",
+	},
+	text: "title",
+	json: "data",
+}
+
+// trackSchema has no JSON column; track events are logged at level event.
+var trackSchema = &schema{
+	source: search.SourceTrack,
+	table:  "track_events",
+	columns: map[string]string{
+		"level":       "'event'",
+		"name":        "name",
+		"message":     "name",
+		"distinct_id": "distinct_id",
+		"device_id":   "device_id",
+	},
+	text: "name",
+}
+
+var sourceSchemas = map[string]*schema{
+	search.SourceLogs:   logsSchema,
+	search.SourceEvents: eventsSchema,
+	search.SourceTrack:  trackSchema,
+}
+
+type fieldKind int
+
+const (
+	kindText fieldKind = iota // a text column
+	kindTime                  // the timestamp column
+	kindJSON                  // a path in the JSON column
+	kindNone                  // a field the table does not have
+)
+
+type field struct {
+	expr string
+	kind fieldKind
+	typ  string // the property type of a kindJSON field, "" when undeclared
+}
+
+// Property types (model.PropertyDefinition.Type) that change how a field
+// compares; enum and undeclared fields compare as strings.
+const (
+	typeString   = "string"
+	typeNumber   = "number"
+	typeBoolean  = "boolean"
+	typeDatetime = "datetime"
+)
+
+var pathSegment = regexp.MustCompile(`^[A-Za-z0-9_@-]+$`)
+
+// field resolves a query field: a column, timestamp, or a path in the JSON
+// column, with or without its prefix (service, fields.http.route,
+// data.contexts.os.name, ...).
+func (t translator) field(name string) (field, error) {
+	lower := strings.ToLower(name)
+	if col, ok := t.schema.columns[lower]; ok {
+		return field{expr: col, kind: kindText}, nil
+	}
+	if lower == "timestamp" || lower == "@timestamp" {
+		return field{expr: "timestamp", kind: kindTime}, nil
+	}
+	path := name
+	if t.schema.json != "" {
+		path = strings.TrimPrefix(name, t.schema.json+".")
+	}
+	segs := strings.Split(path, ".")
+	for _, s := range segs {
+		if !pathSegment.MatchString(s) {
+			return field{}, fmt.Errorf("%w: invalid field %q", search.ErrInvalidQuery, name)
+		}
+	}
+	if t.schema.json == "" {
+		return field{kind: kindNone}, nil
+	}
+	expr := t.schema.json
+	for i, s := range segs {
+		if i == len(segs)-1 {
+			expr += "->>'" + s + "'"
+		} else {
+			expr += "->'" + s + "'"
+		}
+	}
+	typ := t.types[path]
+	if typ == "enum" {
+		typ = typeString
+	}
+	return field{expr: expr, kind: kindJSON, typ: typ}, nil
+}
+
+// text is the field as text; SQLite's ->> keeps JSON numbers numeric.
+func (t translator) text(f field) string {
+	if f.kind == kindJSON && t.sqlite {
+		return "CAST(" + f.expr + " AS TEXT)"
+	}
+	return f.expr
+}
+
+// number is the field as a number, NULL when it is not numeric.
+func (t translator) number(f field) string {
+	e := f.expr
+	if t.sqlite {
+		return "(CASE WHEN typeof(" + e + ") IN ('integer', 'real') THEN " + e +
+			" WHEN CAST(CAST(" + e + " AS REAL) AS TEXT) = " + e + " OR CAST(CAST(" + e + " AS INTEGER) AS TEXT) = " + e +
+			" THEN CAST(" + e + " AS REAL) END)"
+	}
+	// No "?" in the pattern: gorm would take it for a placeholder.
+	return "(CASE WHEN " + e + ` ~ '^\s*-{0,1}[0-9]+(\.[0-9]+){0,1}([eE][-+]{0,1}[0-9]+){0,1}\s*$' THEN (` + e + ")::double precision END)"
+}
+
+// boolean is the field as a boolean, NULL when it is neither true/false,
+// 1/0 nor yes/no.
+func (t translator) boolean(f field) string {
+	e := "lower(" + t.text(f) + ")"
+	if t.sqlite {
+		return "(CASE WHEN " + e + " IN ('true', '1', 'yes') THEN 1 WHEN " + e + " IN ('false', '0', 'no') THEN 0 END)"
+	}
+	return "(CASE WHEN " + e + " IN ('true', '1', 'yes') THEN TRUE WHEN " + e + " IN ('false', '0', 'no') THEN FALSE END)"
+}
+
+// datetime is the field as a time, NULL when it does not hold one. On
+// SQLite it is the "YYYY-MM-DD HH:MM:SS" text of the UTC time, compared with
+// the bounds formatted by timeArg. On Postgres a stored value that only looks
+// like a date (2025-13-45) goes through logtap_try_timestamptz, which yields
+// NULL where a plain cast would fail the whole search.
+func (t translator) datetime(f field) string {
+	e := f.expr
+	if t.sqlite {
+		return "(CASE WHEN typeof(" + e + ") = 'text' THEN datetime(" + e + ") END)"
+	}
+	return "(CASE WHEN " + e + ` ~ '^[0-9]{4}-[0-9]{2}-[0-9]{2}' THEN logtap_try_timestamptz(` + e + ") END)"
+}
+
+func (t translator) timeArg(ts time.Time) any {
+	if t.sqlite {
+		return ts.UTC().Format("2006-01-02 15:04:05")
+	}
+	return ts
+}
+
+func (t translator) boolArg(b bool) any {
+	if t.sqlite {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return b
+}
+
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "true", "1", "yes":
+		return true, true
+	case "false", "0", "no":
+		return false, true
+	}
+	return false, false
+}
+
+// typed compares a declared field as its type: equality on the number,
+// boolean or time it holds, and for strings and undeclared fields on the
+// text itself so that an expression index on it applies.
+func (t translator) typed(f field, value string) (string, []any, error) {
+	switch f.typ {
+	case typeNumber:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: %q is not a number", search.ErrInvalidQuery, value)
+		}
+		return t.number(f) + " = ?", []any{v}, nil
+	case typeBoolean:
+		b, ok := parseBool(value)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %q is not a boolean", search.ErrInvalidQuery, value)
+		}
+		return t.boolean(f) + " = ?", []any{t.boolArg(b)}, nil
+	case typeDatetime:
+		ts, err := t.parseTime(value)
+		if err != nil {
+			return "", nil, err
+		}
+		return t.datetime(f) + " = ?", []any{t.timeArg(ts)}, nil
+	}
+	if value == "" {
+		return "COALESCE(" + t.text(f) + ", '') = ?", []any{value}, nil
+	}
+	return t.text(f) + " = ?", []any{value}, nil
+}
+
+func (t translator) translate(n search.Node) (string, []any, error) {
+	switch n := n.(type) {
+	case search.And:
+		return t.join(n.Nodes, " AND ", "1=1")
+	case search.Or:
+		return t.join(n.Nodes, " OR ", "1=0")
+	case search.Not:
+		sql, args, err := t.translate(n.Node)
+		if err != nil {
+			return "", nil, err
+		}
+		// A missing field makes the inner condition NULL, which NOT keeps
+		// NULL; count it as not matching so that -service:x keeps logs
+		// without a service.
+		return "NOT COALESCE((" + sql + "), FALSE)", args, nil
+	case search.Term:
+		return t.term(n)
+	case search.Wildcard:
+		return t.wildcard(n)
+	case search.Exists:
+		f, err := t.field(n.Field)
+		if err != nil {
+			return "", nil, err
+		}
+		switch f.kind {
+		case kindTime:
+			return "timestamp IS NOT NULL", nil, nil
+		case kindNone:
+			return none, nil, nil
+		}
+		return f.expr + " IS NOT NULL AND " + t.text(f) + " <> ''", nil, nil
+	case search.Range:
+		return t.rangeCond(n)
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported node %T", search.ErrInvalidQuery, n)
+	}
+}
+
+// none is the condition on a field the table does not have.
+const none = "1=0"
+
+func (t translator) join(nodes []search.Node, sep, empty string) (string, []any, error) {
+	if len(nodes) == 0 {
+		return empty, nil, nil
+	}
+	parts := make([]string, 0, len(nodes))
+	var args []any
+	for _, c := range nodes {
+		sql, a, err := t.translate(c)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "("+sql+")")
+		args = append(args, a...)
+	}
+	return strings.Join(parts, sep), args, nil
+}
+
+func (t translator) term(n search.Term) (string, []any, error) {
+	if n.Field == "" {
+		return t.schema.text + " " + t.like + ` ? ESCAPE '\'`, []any{"%" + escapeLike(n.Value) + "%"}, nil
+	}
+	f, err := t.field(n.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	switch f.kind {
+	case kindTime:
+		ts, err := t.parseTime(n.Value)
+		if err != nil {
+			return "", nil, err
+		}
+		return "timestamp = ?", []any{ts}, nil
+	case kindNone:
+		return none, nil, nil
+	case kindJSON:
+		// Undeclared properties compare as strings, so that the index the
+		// advisor builds on them applies.
+		return t.typed(f, n.Value)
+	default:
+		return f.expr + " = ?", []any{n.Value}, nil
+	}
+}
+
+func (t translator) wildcard(n search.Wildcard) (string, []any, error) {
+	pattern := likePattern(n.Pattern)
+	if n.Field == "" {
+		return t.schema.text + " " + t.like + ` ? ESCAPE '\'`, []any{"%" + pattern + "%"}, nil
+	}
+	f, err := t.field(n.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	switch f.kind {
+	case kindTime:
+		return "", nil, fmt.Errorf("%w: wildcards do not apply to %s", search.ErrInvalidQuery, n.Field)
+	case kindNone:
+		return none, nil, nil
+	}
+	return "COALESCE(" + t.text(f) + ", '') " + t.like + ` ? ESCAPE '\'`, []any{pattern}, nil
+}
+
+func (t translator) rangeCond(n search.Range) (string, []any, error) {
+	f, err := t.field(n.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	if f.kind == kindNone {
+		return none, nil, nil
+	}
+	expr := t.text(f)
+	var from, to any
+	switch {
+	case f.kind == kindTime:
+		if from, to, err = bounds(n, t.parseTime); err != nil {
+			return "", nil, err
+		}
+	case f.typ == typeNumber:
+		expr = t.number(f)
+		if from, to, err = bounds(n, func(s string) (any, error) { return strconv.ParseFloat(s, 64) }); err != nil {
+			return "", nil, fmt.Errorf("%w: %s is a number", search.ErrInvalidQuery, n.Field)
+		}
+	case f.typ == typeDatetime:
+		expr = t.datetime(f)
+		if from, to, err = bounds(n, func(s string) (any, error) {
+			ts, err := t.parseTime(s)
+			return t.timeArg(ts), err
+		}); err != nil {
+			return "", nil, err
+		}
+	case f.typ == typeBoolean:
+		return "", nil, fmt.Errorf("%w: ranges do not apply to boolean %s", search.ErrInvalidQuery, n.Field)
+	case f.typ == typeString:
+		from, to, _ = bounds(n, func(s string) (any, error) { return s, nil })
+	case numericBounds(n):
+		expr = t.number(f)
+		from, to, _ = bounds(n, func(s string) (any, error) { return strconv.ParseFloat(s, 64) })
+	default:
+		from, to, _ = bounds(n, func(s string) (any, error) { return s, nil })
+	}
+
+	var conds []string
+	var args []any
+	if from != nil {
+		op := " > ?"
+		if n.IncludeFrom {
+			op = " >= ?"
+		}
+		conds = append(conds, expr+op)
+		args = append(args, from)
+	}
+	if to != nil {
+		op := " < ?"
+		if n.IncludeTo {
+			op = " <= ?"
+		}
+		conds = append(conds, expr+op)
+		args = append(args, to)
+	}
+	if len(conds) == 0 {
+		return f.expr + " IS NOT NULL", nil, nil
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+func numericBounds(n search.Range) bool {
+	for _, b := range []string{n.From, n.To} {
+		if b == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(b, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// bounds parses the non-empty bounds of a range; open ones are nil.
+func bounds[T any](n search.Range, parse func(string) (T, error)) (any, any, error) {
+	var out [2]any
+	for i, b := range []string{n.From, n.To} {
+		if b == "" {
+			continue
+		}
+		v, err := parse(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		out[i] = v
+	}
+	return out[0], out[1], nil
+}
+
+func (t translator) parseTime(s string) (time.Time, error) {
+	return search.ParseTime(s, t.now)
+}
+
+// escapeLike escapes the LIKE metacharacters of a literal.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// likePattern turns a query wildcard pattern into a LIKE pattern.
+func likePattern(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '\\':
+			if i+1 < len(p) {
+				i++
+				b.WriteString(escapeLike(p[i : i+1]))
+			}
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidQuery is wrapped by the errors of queries that cannot be parsed
+// or translated; handlers answer them with 400.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// SyntaxError reports where a query failed to parse.
+type SyntaxError struct {
+	Pos int // byte offset in the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid query: %s at position %d", e.Msg, e.Pos)
+}
+
+func (e *SyntaxError) Unwrap() error { return ErrInvalidQuery }
+
+// Node is a node of a parsed query: And, Or, Not, Term, Wildcard, Exists or
+// Range. String renders it back in the query language.
+type Node interface {
+	String() string
+}
+
+// And matches when all Nodes match; an empty And matches everything.
+type And struct{ Nodes []Node }
+
+// Or matches when any of Nodes matches.
+type Or struct{ Nodes []Node }
+
+// Not matches when Node does not, including when its field is missing.
+type Not struct{ Node Node }
+
+// Term matches Field equal to Value. Without Field it is free text: the
+// message contains Value.
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool // quoted
+}
+
+// Wildcard matches Field against Pattern, where * matches any run of
+// characters, ? a single one and \ escapes the next character. Without Field
+// it matches anywhere in the message.
+type Wildcard struct {
+	Field   string
+	Pattern string
+}
+
+// Exists matches when Field is present and not empty.
+type Exists struct{ Field string }
+
+// Range matches Field between From and To; an empty bound is open. Bounds
+// are compared as numbers when they are numeric and as times on timestamp.
+type Range struct {
+	Field       string
+	From, To    string
+	IncludeFrom bool
+	IncludeTo   bool
+}
+
+func (n And) String() string { return join(n.Nodes, " AND ") }
+func (n Or) String() string  { return join(n.Nodes, " OR ") }
+func (n Not) String() string { return "NOT " + n.Node.String() }
+
+func (n Term) String() string {
+	v := n.Value
+	if n.Phrase || v == "" || strings.ContainsAny(v, " \t()\"") {
+		v = strconv.Quote(v)
+	}
+	return withField(n.Field, v)
+}
+
+func (n Wildcard) String() string { return withField(n.Field, n.Pattern) }
+func (n Exists) String() string   { return n.Field + ":*" }
+
+func (n Range) String() string {
+	open, close := "{", "}"
+	if n.IncludeFrom {
+		open = "["
+	}
+	if n.IncludeTo {
+		close = "]"
+	}
+	from, to := n.From, n.To
+	if from == "" {
+		from = "*"
+	}
+	if to == "" {
+		to = "*"
+	}
+	return fmt.Sprintf("%s:%s%s TO %s%s", n.Field, open, from, to, close)
+}
+
+func withField(field, v string) string {
+	if field == "" {
+		return v
+	}
+	return field + ":" + v
+}
+
+func join(nodes []Node, sep string) string {
+	if len(nodes) == 0 {
+		return "*"
+	}
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// FreeText returns the free-text terms and phrases of a query that are not
+// negated, for highlighting.
+func FreeText(n Node) []string {
+	var out []string
+	var walk func(Node)
+	walk = func(n Node) {
+		switch t := n.(type) {
+		case And:
+			for _, c := range t.Nodes {
+				walk(c)
+			}
+		case Or:
+			for _, c := range t.Nodes {
+				walk(c)
+			}
+		case Term:
+			if t.Field == "" {
+				out = append(out, t.Value)
+			}
+		}
+	}
+	if n != nil {
+		walk(n)
+	}
+	return out
+}
+
+// Fields returns the fields the query filters on, each once, in order of
+// appearance.
+func Fields(n Node) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(f string) {
+		if f != "" && !seen[f] {
+			seen[f] = true
+			out = append(out, f)
+		}
+	}
+	var walk func(Node)
+	walk = func(n Node) {
+		switch t := n.(type) {
+		case And:
+			for _, c := range t.Nodes {
+				walk(c)
+			}
+		case Or:
+			for _, c := range t.Nodes {
+				walk(c)
+			}
+		case Not:
+			walk(t.Node)
+		case Term:
+			add(t.Field)
+		case Wildcard:
+			add(t.Field)
+		case Exists:
+			add(t.Field)
+		case Range:
+			add(t.Field)
+		}
+	}
+	if n != nil {
+		walk(n)
+	}
+	return out
+}
@@ -1,6 +1,13 @@
 package search
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/cursor"
+)
 
 // SearchEngine is the unified search entry point. It parses raw query strings,
 // delegates to a SearchAdapter, and returns structured results.
@@ -25,14 +32,32 @@ func NewEngineWithParser(adapter SearchAdapter, parser QueryParser) *SearchEngin
 	}
 }
 
-// Search is the unified search entry point. It parses rawQuery, builds a
+// SearchRequest is a search as received from a caller.
+type SearchRequest struct {
+	Query     string
+	ProjectID int
+	Sources   []string // nil is logs only
+	TimeRange TimeRange
+	Page      int
+	PageSize  int
+	Cursor    string   // next_cursor of the previous page; replaces Page
+	Order     string   // timestamp order, desc or asc; "" is desc
+	Total     string   // "" is TotalCapped
+	Facets    []string // nil is level
+	FacetSize int
+	Histogram bool
+	Interval  time.Duration // 0 picks one
+}
+
+// Search is the unified search entry point. It parses the query, builds a
 // SearchQuery, and delegates to the adapter.
-func (e *SearchEngine) Search(ctx context.Context, rawQuery string, projectID int, timeRange TimeRange, page, pageSize int) (*SearchResult, error) {
-	parsed, err := e.parser.Parse(rawQuery)
+func (e *SearchEngine) Search(ctx context.Context, req SearchRequest) (*SearchResult, error) {
+	parsed, err := e.parser.Parse(req.Query)
 	if err != nil {
 		return nil, err
 	}
 
+	pageSize, page := req.PageSize, req.Page
 	if pageSize <= 0 {
 		pageSize = 50
 	}
@@ -42,21 +67,63 @@ func (e *SearchEngine) Search(ctx context.Context, rawQuery string, projectID in
 	if page <= 0 {
 		page = 1
 	}
+	facetSize := req.FacetSize
+	if facetSize <= 0 {
+		facetSize = DefaultFacetSize
+	}
+	if facetSize > MaxFacetSize {
+		facetSize = MaxFacetSize
+	}
+	if len(req.Facets) > MaxFacets {
+		return nil, fmt.Errorf("%w: at most %d facets", ErrInvalidQuery, MaxFacets)
+	}
+	if req.Interval < 0 || (req.Interval > 0 && req.Interval < time.Second) {
+		return nil, fmt.Errorf("%w: interval must be at least 1s", ErrInvalidQuery)
+	}
+	after, err := cursor.Parse(req.Cursor)
+	if err != nil || (after != nil && SourceRank(after.Source) < 0) {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidQuery)
+	}
+	if after != nil {
+		page = 1
+	}
+	total := req.Total
+	switch total {
+	case "":
+		total = TotalCapped
+	case TotalExact, TotalCapped, TotalEstimate:
+	default:
+		return nil, fmt.Errorf("%w: total must be exact, capped or estimate", ErrInvalidQuery)
+	}
+	order := strings.ToLower(req.Order)
+	switch order {
+	case "":
+		order = "desc"
+	case "asc", "desc":
+	default:
+		return nil, fmt.Errorf("%w: order must be asc or desc", ErrInvalidQuery)
+	}
 
 	sq := SearchQuery{
-		ProjectID: projectID,
-		TimeRange: timeRange,
-		Filters:   parsed.Filters,
-		Keywords:  parsed.Keywords,
+		ProjectID: req.ProjectID,
+		TimeRange: req.TimeRange,
+		Query:     parsed.Root,
+		Sources:   req.Sources,
 		Sort: SortSpec{
 			Field: "timestamp",
-			Order: "desc",
+			Order: order,
 		},
 		Pagination: Pagination{
 			Offset: (page - 1) * pageSize,
 			Limit:  pageSize,
 		},
-		RawQuery: rawQuery,
+		After:     after,
+		Total:     total,
+		RawQuery:  req.Query,
+		Facets:    req.Facets,
+		FacetSize: facetSize,
+		Histogram: req.Histogram || req.Interval > 0,
+		Interval:  req.Interval,
 	}
 
 	return e.adapter.Search(ctx, sq)
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -25,6 +26,11 @@ func SearchHandler(engine *SearchEngine) gin.HandlerFunc {
 		}
 
 		q := c.Query("q")
+		sources, err := ParseSources(c.Query("sources"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		start, _ := parseTimeQS(c.Query("start"))
 		end, _ := parseTimeQS(c.Query("end"))
 		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -40,12 +46,34 @@ func SearchHandler(engine *SearchEngine) gin.HandlerFunc {
 			pageSize = 500
 		}
 
-		result, err := engine.Search(c.Request.Context(), q, projectID, TimeRange{
-			Start: start,
-			End:   end,
-		}, page, pageSize)
+		req := SearchRequest{
+			Query:     q,
+			ProjectID: projectID,
+			Sources:   sources,
+			TimeRange: TimeRange{Start: start, End: end},
+			Page:      page,
+			PageSize:  pageSize,
+			Cursor:    c.Query("cursor"),
+			Order:     strings.TrimSpace(c.Query("order")),
+			Total:     strings.ToLower(strings.TrimSpace(c.Query("total"))),
+			Facets:    splitList(c.Query("facets")),
+			Histogram: c.Query("histogram") == "1" || strings.EqualFold(c.Query("histogram"), "true"),
+		}
+		req.FacetSize, _ = strconv.Atoi(c.Query("facetSize"))
+		if v := strings.TrimSpace(c.Query("interval")); v != "" {
+			if req.Interval, err = time.ParseDuration(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+				return
+			}
+		}
+
+		result, err := engine.Search(c.Request.Context(), req)
 		if err != nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			status := http.StatusServiceUnavailable
+			if errors.Is(err, ErrInvalidQuery) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -53,6 +81,20 @@ func SearchHandler(engine *SearchEngine) gin.HandlerFunc {
 	}
 }
 
+// splitList splits a comma-separated parameter, dropping empty and
+// repeated items.
+func splitList(s string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func parseTimeQS(s string) (time.Time, bool) {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -0,0 +1,308 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Doc is what a Matcher evaluates a query against.
+type Doc interface {
+	// Text is the text free-text terms search (the log message).
+	Text() string
+	// Field returns a field's value: a string, float64, bool, time.Time, or
+	// a decoded JSON object or array; ok is false when the field is missing.
+	Field(name string) (v any, ok bool)
+}
+
+// Matcher evaluates a query in memory with the semantics of the SQL
+// adapters: free text and wildcards ignore case, terms compare exactly,
+// ranges compare numbers when their bounds are numeric, and NOT matches
+// when the field is missing.
+type Matcher struct {
+	match func(Doc) bool
+}
+
+// NewMatcher compiles query; relative times (now-15m) are resolved against
+// now once. A nil query matches everything.
+func NewMatcher(query Node, now time.Time) (*Matcher, error) {
+	if query == nil {
+		return &Matcher{match: func(Doc) bool { return true }}, nil
+	}
+	fn, err := compile(query, now)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{match: fn}, nil
+}
+
+// Match reports whether d matches the query.
+func (m *Matcher) Match(d Doc) bool { return m.match(d) }
+
+func compile(n Node, now time.Time) (func(Doc) bool, error) {
+	switch n := n.(type) {
+	case And:
+		fns, err := compileAll(n.Nodes, now)
+		if err != nil {
+			return nil, err
+		}
+		return func(d Doc) bool {
+			for _, fn := range fns {
+				if !fn(d) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case Or:
+		fns, err := compileAll(n.Nodes, now)
+		if err != nil {
+			return nil, err
+		}
+		return func(d Doc) bool {
+			for _, fn := range fns {
+				if fn(d) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case Not:
+		fn, err := compile(n.Node, now)
+		if err != nil {
+			return nil, err
+		}
+		return func(d Doc) bool { return !fn(d) }, nil
+	case Term:
+		return compileTerm(n, now)
+	case Wildcard:
+		anchor := n.Field != ""
+		re, err := wildcardRegexp(n.Pattern, anchor)
+		if err != nil {
+			return nil, err
+		}
+		if n.Field == "" {
+			return func(d Doc) bool { return re.MatchString(d.Text()) }, nil
+		}
+		return func(d Doc) bool {
+			v, ok := d.Field(n.Field)
+			if !ok {
+				return false
+			}
+			if _, isTime := v.(time.Time); isTime {
+				return false
+			}
+			return re.MatchString(valueText(v))
+		}, nil
+	case Exists:
+		return func(d Doc) bool {
+			v, ok := d.Field(n.Field)
+			return ok && v != nil && valueText(v) != ""
+		}, nil
+	case Range:
+		return compileRange(n, now)
+	default:
+		return nil, fmt.Errorf("%w: unsupported node %T", ErrInvalidQuery, n)
+	}
+}
+
+func compileAll(nodes []Node, now time.Time) ([]func(Doc) bool, error) {
+	fns := make([]func(Doc) bool, 0, len(nodes))
+	for _, c := range nodes {
+		fn, err := compile(c, now)
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, fn)
+	}
+	return fns, nil
+}
+
+func compileTerm(n Term, now time.Time) (func(Doc) bool, error) {
+	if n.Field == "" {
+		needle := strings.ToLower(n.Value)
+		return func(d Doc) bool { return strings.Contains(strings.ToLower(d.Text()), needle) }, nil
+	}
+	var ts time.Time
+	var tsErr error
+	if isTimeField(n.Field) {
+		if ts, tsErr = ParseTime(n.Value, now); tsErr != nil {
+			return nil, tsErr
+		}
+	}
+	return func(d Doc) bool {
+		v, ok := d.Field(n.Field)
+		if !ok || v == nil {
+			return false
+		}
+		if t, isTime := v.(time.Time); isTime {
+			return t.Equal(ts)
+		}
+		return valueText(v) == n.Value
+	}, nil
+}
+
+func compileRange(n Range, now time.Time) (func(Doc) bool, error) {
+	cmp := func(c int, bound string, include, lower bool) bool {
+		if bound == "" {
+			return true
+		}
+		if lower {
+			return c > 0 || (include && c == 0)
+		}
+		return c < 0 || (include && c == 0)
+	}
+
+	if isTimeField(n.Field) {
+		var from, to time.Time
+		var err error
+		if n.From != "" {
+			if from, err = ParseTime(n.From, now); err != nil {
+				return nil, err
+			}
+		}
+		if n.To != "" {
+			if to, err = ParseTime(n.To, now); err != nil {
+				return nil, err
+			}
+		}
+		return func(d Doc) bool {
+			v, ok := d.Field(n.Field)
+			t, isTime := v.(time.Time)
+			if !ok || !isTime {
+				return false
+			}
+			return cmp(t.Compare(from), n.From, n.IncludeFrom, true) && cmp(t.Compare(to), n.To, n.IncludeTo, false)
+		}, nil
+	}
+
+	from, fromErr := strconv.ParseFloat(n.From, 64)
+	to, toErr := strconv.ParseFloat(n.To, 64)
+	if (n.From == "" || fromErr == nil) && (n.To == "" || toErr == nil) {
+		return func(d Doc) bool {
+			v, ok := d.Field(n.Field)
+			if !ok {
+				return false
+			}
+			f, isNum := valueNumber(v)
+			if !isNum {
+				return false
+			}
+			return cmp(compareFloat(f, from), n.From, n.IncludeFrom, true) && cmp(compareFloat(f, to), n.To, n.IncludeTo, false)
+		}, nil
+	}
+	return func(d Doc) bool {
+		v, ok := d.Field(n.Field)
+		if !ok || v == nil {
+			return false
+		}
+		s := valueText(v)
+		return cmp(strings.Compare(s, n.From), n.From, n.IncludeFrom, true) && cmp(strings.Compare(s, n.To), n.To, n.IncludeTo, false)
+	}, nil
+}
+
+func isTimeField(name string) bool {
+	name = strings.ToLower(name)
+	return name == "timestamp" || name == "@timestamp"
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// valueText is a field value as text, as JSON's ->> renders it.
+func valueText(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+func valueNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// wildcardRegexp compiles a wildcard pattern, case-insensitively; anchored
+// patterns must match the whole value.
+func wildcardRegexp(p string, anchor bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?is)")
+	if anchor {
+		b.WriteString("^")
+	}
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '\\':
+			if i+1 < len(p) {
+				i++
+				b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+			}
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	if anchor {
+		b.WriteString("$")
+	}
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid pattern %q", ErrInvalidQuery, p)
+	}
+	return re, nil
+}
+
+var relativeTime = regexp.MustCompile(`^now(?:([-+])(\d+)([smhdw]))?$`)
+
+// ParseTime parses a time bound: RFC 3339, a date, or now with an optional
+// offset such as now-15m or now-7d.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if m := relativeTime.FindStringSubmatch(s); m != nil {
+		if m[1] == "" {
+			return now, nil
+		}
+		n, _ := strconv.Atoi(m[2])
+		unit := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[3]]
+		d := time.Duration(n) * unit
+		if m[1] == "-" {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid time %q", ErrInvalidQuery, s)
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mapDoc map[string]any
+
+func (d mapDoc) Text() string { s, _ := d["message"].(string); return s }
+
+func (d mapDoc) Field(name string) (any, bool) {
+	v, ok := d[strings.TrimPrefix(name, "fields.")]
+	return v, ok
+}
+
+func TestMatcher(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	doc := mapDoc{
+		"message":   "Read TIMEOUT from upstream",
+		"level":     "error",
+		"service":   "checkout-api",
+		"latency":   float64(250),
+		"code":      "503",
+		"empty":     "",
+		"timestamp": now.Add(-30 * time.Minute),
+	}
+	cases := map[string]bool{
+		"":                               true,
+		"timeout":                        true,
+		`"read timeout"`:                 true,
+		"missing":                        false,
+		"level:error":                    true,
+		"level:ERROR":                    false,
+		"level:error timeout":            true,
+		"level:info OR timeout":          true,
+		"level:(info OR warn)":           false,
+		"-level:error":                   false,
+		"-region:eu":                     true,
+		"service:checkout*":              true,
+		"service:CHECKOUT-???":           true,
+		"service:check":                  false,
+		"time*":                          true,
+		"service:*":                      true,
+		"empty:*":                        false,
+		"region:*":                       false,
+		"latency:>200":                   true,
+		"latency:[100 TO 250}":           false,
+		"latency:[100 TO 250]":           true,
+		"code:>=500":                     true,
+		"code:[a TO z]":                  false,
+		"service:[a TO d]":               true,
+		"timestamp:>now-1h":              true,
+		"timestamp:<now-1h":              false,
+		"timestamp:[2025-05-01 TO now}":  true,
+		"timestamp:2025-05-01T11:30:00Z": true,
+	}
+	for q, want := range cases {
+		m, err := NewMatcher(parse(t, q), now)
+		if err != nil {
+			t.Fatalf("NewMatcher(%q): %v", q, err)
+		}
+		if got := m.Match(doc); got != want {
+			t.Errorf("Match(%q) = %v, want %v", q, got, want)
+		}
+	}
+}
+
+func TestMatcherInvalidTime(t *testing.T) {
+	_, err := NewMatcher(parse(t, "timestamp:>yesterday"), time.Now())
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("err = %v", err)
+	}
+}
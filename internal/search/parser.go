@@ -1,13 +1,19 @@
 package search
 
-// QueryParser parses a Kibana-style query string into structured filters and keywords.
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// QueryParser parses a query string into a query tree.
 type QueryParser interface {
 	Parse(raw string) (*ParsedQuery, error)
 }
 
+// ParsedQuery is a parsed query; a nil Root matches everything.
 type ParsedQuery struct {
-	Filters  []Filter
-	Keywords []string
+	Root Node
 }
 
 // defaultParser implements QueryParser.
@@ -18,130 +24,398 @@ func NewQueryParser() QueryParser {
 	return &defaultParser{}
 }
 
-// Parse parses queries like: level:error tag:api "some phrase" timeout
-// Rules:
-//   - key:value → filter (Field=key, Operator=eq)
-//   - key:"quoted value" → filter with quoted value
-//   - bare word → keyword (message ILIKE search)
-//   - empty string → no filters, no keywords
+// maxDepth bounds the nesting of parentheses and negations.
+const maxDepth = 64
+
+// Parse parses the Lucene-like language documented in docs/SEARCH.md:
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = unary { [ "AND" ] unary }        juxtaposition is AND
+//	unary   = ( "NOT" | "-" | "!" ) unary | primary
+//	primary = "(" or ")" | term
+//	term    = field ":" value | value          a value alone is free text
+//	value   = "(" values ")"                   field:(a OR b), the field applies inside
+//	        | ( "[" | "{" ) bound "TO" bound ( "]" | "}" )
+//	        | ( ">" | ">=" | "<" | "<=" ) bound
+//	        | "*"                              field:* – the field exists
+//	        | phrase | word                    words may contain * and ? wildcards
+//	bound   = "*" | phrase | word
+//
+// AND, OR, NOT and TO are operators only in upper case; \ escapes the next
+// character in words.
 func (p *defaultParser) Parse(raw string) (*ParsedQuery, error) {
-	result := &ParsedQuery{}
-	raw = trimSpace(raw)
-	if raw == "" {
-		return result, nil
+	ps := &parser{s: raw}
+	ps.skipSpace()
+	if ps.eof() {
+		return &ParsedQuery{}, nil
+	}
+	root, err := ps.parseOr("", 0)
+	if err != nil {
+		return nil, err
+	}
+	ps.skipSpace()
+	if !ps.eof() {
+		return nil, ps.errorf("unexpected %q", ps.s[ps.pos:ps.pos+1])
+	}
+	if a, ok := root.(And); ok && len(a.Nodes) == 0 {
+		root = nil
 	}
+	return &ParsedQuery{Root: root}, nil
+}
 
-	tokens := tokenize(raw)
-	for _, tok := range tokens {
-		if tok.isKV {
-			result.Filters = append(result.Filters, Filter{
-				Field:    tok.key,
-				Operator: "eq",
-				Value:    tok.value,
-			})
-		} else {
-			result.Keywords = append(result.Keywords, tok.text)
-		}
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(msg string, args ...any) error {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
 	}
+	return &SyntaxError{Pos: p.pos, Msg: msg}
+}
 
-	return result, nil
+func (p *parser) eof() bool { return p.pos >= len(p.s) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
 }
 
-type token struct {
-	isKV  bool
-	key   string
-	value string
-	text  string
+func (p *parser) skipSpace() {
+	for !p.eof() && isSpace(p.s[p.pos]) {
+		p.pos++
+	}
 }
 
-func tokenize(raw string) []token {
-	var tokens []token
-	i := 0
-	n := len(raw)
+// keyword reports whether an operator word starts at pos; it does not
+// consume it.
+func (p *parser) keyword(word string) bool {
+	if !strings.HasPrefix(p.s[p.pos:], word) {
+		return false
+	}
+	end := p.pos + len(word)
+	return end == len(p.s) || isSpace(p.s[end]) || p.s[end] == '(' || (word != "TO" && p.s[end] == '"')
+}
 
-	for i < n {
-		// skip whitespace
-		for i < n && raw[i] == ' ' {
-			i++
-		}
-		if i >= n {
+// parseOr parses an or-expression. field is the field of an enclosing
+// field:( ... ) group, whose terms must not name a field themselves.
+func (p *parser) parseOr(field string, depth int) (Node, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("query nested too deeply")
+	}
+	first, err := p.parseAnd(field, depth)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for {
+		p.skipSpace()
+		if !p.keyword("OR") {
 			break
 		}
+		p.pos += len("OR")
+		n, err := p.parseAnd(field, depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return Or{Nodes: flatten(nodes, false)}, nil
+}
 
-		// try to find key:value pattern
-		// scan until space or colon
-		j := i
-		hasColon := false
-		colonPos := -1
-		for j < n && raw[j] != ' ' {
-			if raw[j] == ':' && !hasColon {
-				hasColon = true
-				colonPos = j
+func (p *parser) parseAnd(field string, depth int) (Node, error) {
+	var nodes []Node
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek() == ')' || p.keyword("OR") {
+			break
+		}
+		if p.keyword("AND") {
+			if len(nodes) == 0 {
+				return nil, p.errorf("AND without a left operand")
 			}
-			j++
-		}
-
-		if hasColon && colonPos > i {
-			key := raw[i:colonPos]
-			valStart := colonPos + 1
-
-			if valStart < n && raw[valStart] == '"' {
-				// quoted value
-				endQuote := findClosingQuote(raw, valStart+1)
-				if endQuote != -1 {
-					tokens = append(tokens, token{isKV: true, key: key, value: raw[valStart+1 : endQuote]})
-					i = endQuote + 1
-					// skip trailing space
-					for i < n && raw[i] == ' ' {
-						i++
-					}
-					continue
-				}
+			p.pos += len("AND")
+			p.skipSpace()
+			if p.eof() || p.peek() == ')' || p.keyword("OR") || p.keyword("AND") {
+				return nil, p.errorf("AND without a right operand")
 			}
+			continue
+		}
+		n, err := p.parseUnary(field, depth)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	switch len(nodes) {
+	case 0:
+		if p.keyword("OR") {
+			return nil, p.errorf("OR without a left operand")
+		}
+		if !p.eof() && p.peek() == ')' {
+			return nil, p.errorf("empty parentheses")
+		}
+		return nil, p.errorf("expected a term")
+	case 1:
+		return nodes[0], nil
+	}
+	return And{Nodes: flatten(nodes, true)}, nil
+}
 
-			if valStart < j {
-				tokens = append(tokens, token{isKV: true, key: key, value: raw[valStart:j]})
-				i = j
-				continue
-			}
+func (p *parser) parseUnary(field string, depth int) (Node, error) {
+	if depth > maxDepth {
+		return nil, p.errorf("query nested too deeply")
+	}
+	p.skipSpace()
+	if p.keyword("NOT") {
+		p.pos += len("NOT")
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("NOT without an operand")
+		}
+		n, err := p.parseUnary(field, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	}
+	if c := p.peek(); (c == '-' || c == '!') && p.pos+1 < len(p.s) && !isSpace(p.s[p.pos+1]) {
+		p.pos++
+		n, err := p.parseUnary(field, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: n}, nil
+	}
+	if p.peek() == '(' {
+		p.pos++
+		n, err := p.parseOr(field, depth+1)
+		if err != nil {
+			return nil, err
 		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf(`expected ")"`)
+		}
+		p.pos++
+		return n, nil
+	}
+	return p.parseTerm(field, depth)
+}
 
-		// Check if current segment starts with a quote
-		if raw[i] == '"' {
-			endQuote := findClosingQuote(raw, i+1)
-			if endQuote != -1 {
-				tokens = append(tokens, token{text: raw[i+1 : endQuote]})
-				i = endQuote + 1
-				continue
-			}
+func (p *parser) parseTerm(field string, depth int) (Node, error) {
+	if field == "" {
+		if name, ok := p.fieldName(); ok {
+			return p.parseValue(name, depth)
 		}
+	}
+	return p.parseBareValue(field)
+}
 
-		// bare word
-		tokens = append(tokens, token{text: raw[i:j]})
-		i = j
+// fieldName consumes "name:" when it starts at pos.
+func (p *parser) fieldName() (string, bool) {
+	i := p.pos
+	for i < len(p.s) && isFieldChar(p.s[i]) {
+		i++
+	}
+	if i == p.pos || i >= len(p.s) || p.s[i] != ':' {
+		return "", false
 	}
+	name := p.s[p.pos:i]
+	p.pos = i + 1
+	return name, true
+}
 
-	return tokens
+func (p *parser) parseValue(field string, depth int) (Node, error) {
+	if p.eof() || isSpace(p.peek()) {
+		return nil, p.errorf("missing value for %s", field)
+	}
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		n, err := p.parseOr(field, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.peek() != ')' {
+			return nil, p.errorf(`expected ")"`)
+		}
+		p.pos++
+		return n, nil
+	case c == '[' || c == '{':
+		return p.parseRange(field)
+	case c == '>' || c == '<':
+		p.pos++
+		inclusive := p.peek() == '='
+		if inclusive {
+			p.pos++
+		}
+		p.skipSpace()
+		bound, err := p.bound()
+		if err != nil {
+			return nil, err
+		}
+		if bound == "" {
+			return nil, p.errorf("missing bound for %s", field)
+		}
+		if c == '>' {
+			return Range{Field: field, From: bound, IncludeFrom: inclusive}, nil
+		}
+		return Range{Field: field, To: bound, IncludeTo: inclusive}, nil
+	}
+	return p.parseBareValue(field)
 }
 
-func findClosingQuote(s string, start int) int {
-	for i := start; i < len(s); i++ {
-		if s[i] == '"' {
-			return i
+// parseBareValue parses a phrase or word, with field possibly empty.
+func (p *parser) parseBareValue(field string) (Node, error) {
+	if p.peek() == '"' {
+		v, err := p.phrase()
+		if err != nil {
+			return nil, err
 		}
-		if s[i] == '\\' && i+1 < len(s) {
-			i++ // skip escaped char
+		return Term{Field: field, Value: v, Phrase: true}, nil
+	}
+	raw, v, wild := p.word(false)
+	if raw == "" {
+		return nil, p.errorf("expected a term")
+	}
+	if raw == "*" {
+		if field == "" {
+			return And{}, nil
 		}
+		return Exists{Field: field}, nil
 	}
-	return -1
+	if wild {
+		return Wildcard{Field: field, Pattern: raw}, nil
+	}
+	return Term{Field: field, Value: v}, nil
 }
 
-func trimSpace(s string) string {
-	for len(s) > 0 && s[0] == ' ' {
-		s = s[1:]
+func (p *parser) parseRange(field string) (Node, error) {
+	r := Range{Field: field, IncludeFrom: p.peek() == '['}
+	p.pos++
+	p.skipSpace()
+	from, err := p.bound()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.keyword("TO") {
+		return nil, p.errorf(`expected "TO"`)
+	}
+	p.pos += len("TO")
+	p.skipSpace()
+	to, err := p.bound()
+	if err != nil {
+		return nil, err
 	}
-	for len(s) > 0 && s[len(s)-1] == ' ' {
-		s = s[:len(s)-1]
+	p.skipSpace()
+	switch p.peek() {
+	case ']':
+		r.IncludeTo = true
+	case '}':
+	default:
+		return nil, p.errorf(`expected "]" or "}"`)
 	}
-	return s
+	p.pos++
+	r.From, r.To = from, to
+	if r.From == "" && r.To == "" {
+		return Exists{Field: field}, nil
+	}
+	return r, nil
+}
+
+// bound parses a range bound; "*" is open and returned as "".
+func (p *parser) bound() (string, error) {
+	if p.peek() == '"' {
+		return p.phrase()
+	}
+	raw, v, _ := p.word(true)
+	if raw == "" {
+		return "", p.errorf("expected a bound")
+	}
+	if raw == "*" {
+		return "", nil
+	}
+	return v, nil
+}
+
+func (p *parser) phrase() (string, error) {
+	start := p.pos
+	p.pos++ // opening quote
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.s):
+			b.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated quote")
+}
+
+// word consumes a word and returns it raw (escapes kept, for wildcard
+// patterns) and unescaped, and whether it has unescaped wildcards. Inside
+// a range, ] and } end words too.
+func (p *parser) word(inRange bool) (raw, value string, wild bool) {
+	start := p.pos
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.pos]
+		if isSpace(c) || c == '(' || c == ')' || c == '"' || (inRange && (c == ']' || c == '}')) {
+			break
+		}
+		if c == '\\' && p.pos+1 < len(p.s) {
+			_, size := utf8.DecodeRuneInString(p.s[p.pos+1:])
+			b.WriteString(p.s[p.pos+1 : p.pos+1+size])
+			p.pos += 1 + size
+			continue
+		}
+		if c == '*' || c == '?' {
+			wild = true
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return p.s[start:p.pos], b.String(), wild
+}
+
+// flatten merges nested nodes of the same kind: (a AND (b AND c)).
+func flatten(nodes []Node, and bool) []Node {
+	out := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if a, ok := n.(And); ok && and {
+			out = append(out, a.Nodes...)
+			continue
+		}
+		if o, ok := n.(Or); ok && !and {
+			out = append(out, o.Nodes...)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+func isFieldChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c == '@' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
 }
@@ -1,89 +1,156 @@
 package search
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
-func TestParseEmpty(t *testing.T) {
-	p := NewQueryParser()
-	result, err := p.Parse("")
+func parse(t *testing.T, q string) Node {
+	t.Helper()
+	result, err := NewQueryParser().Parse(q)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("Parse(%q): %v", q, err)
 	}
-	if len(result.Filters) != 0 || len(result.Keywords) != 0 {
-		t.Fatalf("expected empty, got filters=%v keywords=%v", result.Filters, result.Keywords)
+	return result.Root
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, q := range []string{"", "   ", "*"} {
+		if root := parse(t, q); root != nil {
+			t.Fatalf("Parse(%q): expected no condition, got %v", q, root)
+		}
 	}
 }
 
 func TestParseKeyValues(t *testing.T) {
-	p := NewQueryParser()
-	result, err := p.Parse("level:error tag:api")
-	if err != nil {
-		t.Fatal(err)
-	}
-	if len(result.Filters) != 2 {
-		t.Fatalf("expected 2 filters, got %d", len(result.Filters))
-	}
-	if result.Filters[0].Field != "level" || result.Filters[0].Value != "error" {
-		t.Errorf("first filter: got %+v", result.Filters[0])
-	}
-	if result.Filters[1].Field != "tag" || result.Filters[1].Value != "api" {
-		t.Errorf("second filter: got %+v", result.Filters[1])
+	root := parse(t, "level:error tag:api")
+	want := And{Nodes: []Node{Term{Field: "level", Value: "error"}, Term{Field: "tag", Value: "api"}}}
+	if root.String() != want.String() {
+		t.Fatalf("got %v, want %v", root, want)
 	}
 }
 
 func TestParseKeywords(t *testing.T) {
-	p := NewQueryParser()
-	result, err := p.Parse("timeout connection_reset")
-	if err != nil {
-		t.Fatal(err)
+	root := parse(t, "timeout connection_reset")
+	if got := FreeText(root); len(got) != 2 || got[0] != "timeout" || got[1] != "connection_reset" {
+		t.Fatalf("got keywords %v", got)
 	}
-	if len(result.Keywords) != 2 {
-		t.Fatalf("expected 2 keywords, got %d: %v", len(result.Keywords), result.Keywords)
+}
+
+func TestParseQuotedValue(t *testing.T) {
+	root := parse(t, `level:error message:"connection timeout"`)
+	a, ok := root.(And)
+	if !ok || len(a.Nodes) != 2 {
+		t.Fatalf("expected 2 terms, got %v", root)
 	}
-	if result.Keywords[0] != "timeout" || result.Keywords[1] != "connection_reset" {
-		t.Errorf("got keywords %v", result.Keywords)
+	if term := a.Nodes[1].(Term); term.Value != "connection timeout" || !term.Phrase {
+		t.Errorf("expected 'connection timeout', got %+v", term)
 	}
 }
 
-func TestParseQuotedValue(t *testing.T) {
-	p := NewQueryParser()
-	result, err := p.Parse(`level:error message:"connection timeout"`)
-	if err != nil {
-		t.Fatal(err)
+func TestParseMixed(t *testing.T) {
+	root := parse(t, `level:error timeout tag:"user service" connection_reset`)
+	if got, want := root.String(), `(level:error AND timeout AND tag:"user service" AND connection_reset)`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
 	}
-	if len(result.Filters) != 2 {
-		t.Fatalf("expected 2 filters, got %d", len(result.Filters))
+}
+
+func TestParseWhitespace(t *testing.T) {
+	if got, want := parse(t, "  level:error   timeout  ").String(), "(level:error AND timeout)"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseBoolean(t *testing.T) {
+	for q, want := range map[string]string{
+		`level:error -service:checkout`:              `(level:error AND NOT service:checkout)`,
+		`level:error AND NOT service:checkout`:       `(level:error AND NOT service:checkout)`,
+		`a OR b c`:                                   `(a OR (b AND c))`,
+		`(a OR b) c`:                                 `((a OR b) AND c)`,
+		`a OR b OR (c OR d)`:                         `(a OR b OR c OR d)`,
+		`level:(error OR fatal) !timeout`:            `((level:error OR level:fatal) AND NOT timeout)`,
+		`NOT (service:a OR service:b)`:               `NOT (service:a OR service:b)`,
+		`ANDROID ORDER NOTE`:                         `(ANDROID AND ORDER AND NOTE)`,
+		`url:"https://x.io/a?b=1" message:a\:b`:      `(url:"https://x.io/a?b=1" AND message:a:b)`,
+		`timestamp:2025-05-01T10:00:00Z`:             `timestamp:2025-05-01T10:00:00Z`,
+		`fields.http.route:/pay fields.user.id:*`:    `(fields.http.route:/pay AND fields.user.id:*)`,
+		`fields.latency_ms:>500`:                     `fields.latency_ms:{500 TO *}`,
+		`fields.latency_ms:<=20`:                     `fields.latency_ms:{* TO 20]`,
+		`fields.latency_ms:[100 TO 200}`:             `fields.latency_ms:[100 TO 200}`,
+		`timestamp:[2025-01-01 TO now-1h]`:           `timestamp:[2025-01-01 TO now-1h]`,
+		`service:check* message:"disk full" time?ut`: `(service:check* AND message:"disk full" AND time?ut)`,
+		`service:\*`:                                 `service:*`,
+		`fields.user-agent:curl*`:                    `fields.user-agent:curl*`,
+	} {
+		if got := parse(t, q).String(); got != want {
+			t.Errorf("Parse(%q) = %s, want %s", q, got, want)
+		}
 	}
-	if result.Filters[1].Value != "connection timeout" {
-		t.Errorf("expected 'connection timeout', got '%s'", result.Filters[1].Value)
+
+	// An escaped star is a literal value, not existence.
+	if term, ok := parse(t, `service:\*`).(Term); !ok || term.Value != "*" {
+		t.Errorf("expected a literal * term")
 	}
 }
 
-func TestParseMixed(t *testing.T) {
-	p := NewQueryParser()
-	result, err := p.Parse(`level:error timeout tag:"user service" connection_reset`)
-	if err != nil {
-		t.Fatal(err)
+func TestParseErrors(t *testing.T) {
+	for _, q := range []string{
+		`(level:error`,
+		`level:error)`,
+		`level:`,
+		`AND level:error`,
+		`level:error AND`,
+		`a OR`,
+		`NOT`,
+		`"unterminated`,
+		`latency:[1 200]`,
+		`latency:[1 TO 200`,
+		`latency:>`,
+		`()`,
+	} {
+		_, err := NewQueryParser().Parse(q)
+		var se *SyntaxError
+		if !errors.As(err, &se) || !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Parse(%q): expected a syntax error, got %v", q, err)
+		}
 	}
-	if len(result.Filters) != 2 {
-		t.Fatalf("expected 2 filters, got %d", len(result.Filters))
+
+	deep := ""
+	for i := 0; i < 100; i++ {
+		deep += "("
 	}
-	if len(result.Keywords) != 2 {
-		t.Fatalf("expected 2 keywords, got %d", len(result.Keywords))
+	if _, err := NewQueryParser().Parse(deep + "a"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("expected deep nesting to be rejected, got %v", err)
 	}
 }
 
-func TestParseWhitespace(t *testing.T) {
-	p := NewQueryParser()
-	result, err := p.Parse("  level:error   timeout  ")
-	if err != nil {
-		t.Fatal(err)
+func TestParseSources(t *testing.T) {
+	got, err := ParseSources("")
+	if err != nil || len(got) != 1 || got[0] != SourceLogs {
+		t.Fatalf("ParseSources(\"\") = %v, %v", got, err)
 	}
-	if len(result.Filters) != 1 {
-		t.Fatalf("expected 1 filter, got %d", len(result.Filters))
+	got, err = ParseSources(" events,LOGS,, events,track")
+	if err != nil || len(got) != 3 || got[0] != SourceEvents || got[1] != SourceLogs || got[2] != SourceTrack {
+		t.Fatalf("got %v, %v", got, err)
 	}
-	if len(result.Keywords) != 1 {
-		t.Fatalf("expected 1 keyword, got %d", len(result.Keywords))
+	if _, err := ParseSources("logs,errors"); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected an invalid source, got %v", err)
+	}
+}
+
+func TestHistogramInterval(t *testing.T) {
+	for span, want := range map[time.Duration]time.Duration{
+		0:                        time.Second,
+		30 * time.Second:         time.Second,
+		15 * time.Minute:         30 * time.Second,
+		time.Hour:                5 * time.Minute,
+		24 * time.Hour:           30 * time.Minute,
+		30 * 24 * time.Hour:      24 * time.Hour,
+		2 * 365 * 24 * time.Hour: 14 * 24 * time.Hour,
+	} {
+		if got := HistogramInterval(span); got != want {
+			t.Errorf("HistogramInterval(%s) = %s, want %s", span, got, want)
+		}
 	}
 }
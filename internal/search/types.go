@@ -2,25 +2,102 @@ package search
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/aak1247/logtap/internal/cursor"
+)
+
+// Sources a search can read, in the sources parameter of /search.
+const (
+	SourceLogs   = "logs"   // structured logs
+	SourceEvents = "events" // Sentry events
+	SourceTrack  = "track"  // track events
 )
 
+// ParseSources parses a comma-separated list of sources; an empty list is
+// logs only.
+func ParseSources(raw string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		switch s {
+		case SourceLogs, SourceEvents, SourceTrack:
+		default:
+			return nil, fmt.Errorf("%w: unknown source %q (logs, events, track)", ErrInvalidQuery, s)
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		out = []string{SourceLogs}
+	}
+	return out, nil
+}
+
+// SourceRank orders hits of different sources that share a timestamp.
+func SourceRank(source string) int {
+	switch source {
+	case SourceLogs:
+		return 0
+	case SourceEvents:
+		return 1
+	case SourceTrack:
+		return 2
+	}
+	return -1
+}
+
 // SearchQuery is the universal query structure passed to adapters.
 type SearchQuery struct {
 	ProjectID  int
 	TimeRange  TimeRange
-	Filters    []Filter
-	Keywords   []string
+	Query      Node     // nil matches everything
+	Sources    []string // nil is logs only
 	Sort       SortSpec
 	Pagination Pagination
+	After      *cursor.Cursor // page after this hit instead of Pagination.Offset
+	Total      string         // TotalCapped, TotalEstimate or exact ("" or TotalExact)
 	RawQuery   string
+	Facets     []string // fields to facet on; nil is level
+	FacetSize  int      // values per facet
+	Histogram  bool
+	Interval   time.Duration // histogram bucket width; 0 picks one
 }
 
-type Filter struct {
-	Field    string
-	Operator string // eq, neq, contains, in, exists, not_exists
-	Value    any
-}
+// How Total is counted. Capped counts stop at CountCap matches; estimates
+// come from the database's query planner where it has one and are capped
+// counts elsewhere.
+const (
+	TotalExact    = "exact"
+	TotalCapped   = "capped"
+	TotalEstimate = "estimate"
+
+	CountCap = 10000
+)
+
+// Relations of SearchResult.Total to the true number of matches.
+const (
+	RelationEq     = "eq"     // exact
+	RelationGte    = "gte"    // at least Total
+	RelationApprox = "approx" // estimated
+)
+
+// Facet and histogram limits.
+const (
+	DefaultFacetSize = 10
+	MaxFacetSize     = 100
+	MaxFacets        = 20
+	// HistogramBuckets is the number of buckets an automatic interval aims
+	// for; MaxHistogramBuckets bounds explicit ones.
+	HistogramBuckets    = 60
+	MaxHistogramBuckets = 1000
+)
 
 type TimeRange struct {
 	Start time.Time
@@ -38,29 +115,73 @@ type Pagination struct {
 }
 
 type SearchResult struct {
-	Total  int64
-	Hits   []SearchHit
-	Facets map[string]Facet
+	Total         int64       `json:"total"`
+	TotalRelation string      `json:"total_relation"`
+	Hits          []SearchHit `json:"items"`
+	// NextCursor pages after the last hit; empty on the last page.
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Facets     map[string]Facet `json:"facets,omitempty"`
+	Histogram  *Histogram       `json:"histogram,omitempty"`
 }
 
+// SearchHit has the same shape for every source. Message is the log
+// message, the event title or the track event name; Fields holds the log
+// fields or the event's columns (release, environment, os, ...).
 type SearchHit struct {
-	ID        any
-	Type      string // "log" | "event" | "error"
-	Timestamp time.Time
-	Level     string
-	Message   string
-	Fields    map[string]any
-	Highlight map[string][]string
+	ID        any                 `json:"id"`
+	Type      string              `json:"type"` // "log" | "event" | "track"
+	Timestamp time.Time           `json:"timestamp"`
+	Level     string              `json:"level,omitempty"`
+	Message   string              `json:"message"`
+	TraceID   string              `json:"trace_id,omitempty"`
+	SpanID    string              `json:"span_id,omitempty"`
+	PatternID string              `json:"pattern_id,omitempty"`
+	Fields    map[string]any      `json:"fields,omitempty"`
+	Highlight map[string][]string `json:"highlight,omitempty"`
 }
 
+// Facet holds the most frequent values of Field among the matches. Sampled
+// counts are estimates extrapolated from a sample of the matches.
 type Facet struct {
-	Field   string
-	Buckets []FacetBucket
+	Field   string        `json:"field"`
+	Buckets []FacetBucket `json:"buckets"`
+	Sampled bool          `json:"sampled,omitempty"`
 }
 
 type FacetBucket struct {
-	Key   string
-	Count int64
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// Histogram counts the matches per time bucket, empty buckets included.
+type Histogram struct {
+	IntervalSec int64             `json:"interval_sec"`
+	Buckets     []HistogramBucket `json:"buckets"`
+	Sampled     bool              `json:"sampled,omitempty"`
+}
+
+type HistogramBucket struct {
+	Time  time.Time `json:"time"`
+	Count int64     `json:"count"`
+}
+
+// HistogramInterval picks a round bucket width giving at most
+// HistogramBuckets buckets over span.
+func HistogramInterval(span time.Duration) time.Duration {
+	for _, d := range []time.Duration{
+		time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+		time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+		time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+	} {
+		if span/d < HistogramBuckets {
+			return d
+		}
+	}
+	d := 7 * 24 * time.Hour
+	for span/d >= HistogramBuckets {
+		d *= 2
+	}
+	return d
 }
 
 // SearchAdapter is the core adapter interface. Implementations translate
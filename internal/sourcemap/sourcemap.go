@@ -0,0 +1,267 @@
+// Package sourcemap reads Source Map v3 files, including index maps with
+// sections, and maps generated positions back to original ones.
+package sourcemap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Map is a decoded source map. Positions are zero-based.
+type Map struct {
+	File           string
+	Sources        []string
+	SourcesContent []*string
+	Names          []string
+
+	lines [][]segment
+	// sections is set instead of lines for index maps.
+	sections []section
+}
+
+type segment struct {
+	genCol  int
+	source  int // -1 when the segment maps to no source
+	srcLine int
+	srcCol  int
+	name    int // -1 when unnamed
+}
+
+type section struct {
+	line, col int
+	m         *Map
+}
+
+// Position is an original location.
+type Position struct {
+	Source string
+	Line   int
+	Column int
+	// Name is the original identifier at the position, if recorded.
+	Name string
+	// Content is the source's text when the map embeds it (sourcesContent).
+	Content *string
+}
+
+type rawMap struct {
+	Version        int       `json:"version"`
+	File           string    `json:"file"`
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+	Names          []string  `json:"names"`
+	Mappings       string    `json:"mappings"`
+	Sections       []struct {
+		Offset struct {
+			Line   int `json:"line"`
+			Column int `json:"column"`
+		} `json:"offset"`
+		Map json.RawMessage `json:"map"`
+	} `json:"sections"`
+}
+
+// Parse decodes a source map. The optional ")]}'" XSSI prefix is skipped.
+func Parse(data []byte) (*Map, error) {
+	s := strings.TrimSpace(string(data))
+	if strings.HasPrefix(s, ")]}'") {
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[i+1:]
+		} else {
+			s = ""
+		}
+	}
+	var raw rawMap
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("sourcemap: %w", err)
+	}
+	return fromRaw(raw)
+}
+
+func fromRaw(raw rawMap) (*Map, error) {
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("sourcemap: unsupported version %d", raw.Version)
+	}
+	m := &Map{File: raw.File, Names: raw.Names, SourcesContent: raw.SourcesContent}
+	if len(raw.Sections) > 0 {
+		for _, sec := range raw.Sections {
+			if len(sec.Map) == 0 {
+				return nil, errors.New("sourcemap: sections referencing urls are not supported")
+			}
+			sub, err := Parse(sec.Map)
+			if err != nil {
+				return nil, err
+			}
+			m.sections = append(m.sections, section{line: sec.Offset.Line, col: sec.Offset.Column, m: sub})
+		}
+		return m, nil
+	}
+
+	root := raw.SourceRoot
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	m.Sources = make([]string, len(raw.Sources))
+	for i, src := range raw.Sources {
+		m.Sources[i] = root + src
+	}
+	lines, err := decodeMappings(raw.Mappings, len(m.Sources), len(m.Names))
+	if err != nil {
+		return nil, err
+	}
+	m.lines = lines
+	return m, nil
+}
+
+// Lookup returns the original position of the generated line and column.
+// The closest mapping at or before column on the same line wins.
+func (m *Map) Lookup(line, column int) (Position, bool) {
+	if len(m.sections) > 0 {
+		i := sort.Search(len(m.sections), func(i int) bool {
+			s := m.sections[i]
+			return s.line > line || (s.line == line && s.col > column)
+		}) - 1
+		if i < 0 {
+			return Position{}, false
+		}
+		s := m.sections[i]
+		if line == s.line {
+			column -= s.col
+		}
+		return s.m.Lookup(line-s.line, column)
+	}
+
+	if line < 0 || line >= len(m.lines) {
+		return Position{}, false
+	}
+	segs := m.lines[line]
+	i := sort.Search(len(segs), func(i int) bool { return segs[i].genCol > column }) - 1
+	if i < 0 || segs[i].source < 0 {
+		return Position{}, false
+	}
+	seg := segs[i]
+	pos := Position{Source: m.Sources[seg.source], Line: seg.srcLine, Column: seg.srcCol}
+	if seg.name >= 0 {
+		pos.Name = m.Names[seg.name]
+	}
+	if seg.source < len(m.SourcesContent) {
+		pos.Content = m.SourcesContent[seg.source]
+	}
+	return pos, true
+}
+
+func decodeMappings(s string, nSources, nNames int) ([][]segment, error) {
+	var (
+		lines                         [][]segment
+		cur                           []segment
+		source, srcLine, srcCol, name int
+		fields                        [5]int
+	)
+	for _, group := range strings.Split(s, ";") {
+		cur = nil
+		genCol := 0
+		for _, raw := range strings.Split(group, ",") {
+			if raw == "" {
+				continue
+			}
+			n, err := decodeVLQ(raw, fields[:])
+			if err != nil {
+				return nil, err
+			}
+			genCol += fields[0]
+			seg := segment{genCol: genCol, source: -1, name: -1}
+			switch n {
+			case 1:
+			case 4, 5:
+				source += fields[1]
+				srcLine += fields[2]
+				srcCol += fields[3]
+				if source < 0 || source >= nSources {
+					return nil, fmt.Errorf("sourcemap: source index %d out of range", source)
+				}
+				seg.source, seg.srcLine, seg.srcCol = source, srcLine, srcCol
+				if n == 5 {
+					name += fields[4]
+					if name < 0 || name >= nNames {
+						return nil, fmt.Errorf("sourcemap: name index %d out of range", name)
+					}
+					seg.name = name
+				}
+			default:
+				return nil, fmt.Errorf("sourcemap: invalid segment %q", raw)
+			}
+			cur = append(cur, seg)
+		}
+		sort.SliceStable(cur, func(i, j int) bool { return cur[i].genCol < cur[j].genCol })
+		lines = append(lines, cur)
+	}
+	return lines, nil
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+var base64Index = func() [256]int8 {
+	var t [256]int8
+	for i := range t {
+		t[i] = -1
+	}
+	for i := 0; i < len(base64Chars); i++ {
+		t[base64Chars[i]] = int8(i)
+	}
+	return t
+}()
+
+// decodeVLQ decodes the base64 VLQ values of one segment into out and
+// returns how many there were.
+func decodeVLQ(s string, out []int) (int, error) {
+	n := 0
+	value, shift := 0, 0
+	for i := 0; i < len(s); i++ {
+		d := base64Index[s[i]]
+		if d < 0 {
+			return 0, fmt.Errorf("sourcemap: invalid base64 %q", s[i])
+		}
+		value += int(d&31) << shift
+		if d&32 != 0 {
+			shift += 5
+			if shift > 30 {
+				return 0, errors.New("sourcemap: vlq overflow")
+			}
+			continue
+		}
+		if n == len(out) {
+			return 0, fmt.Errorf("sourcemap: invalid segment %q", s)
+		}
+		v := value >> 1
+		if value&1 != 0 {
+			v = -v
+		}
+		out[n] = v
+		n++
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return 0, fmt.Errorf("sourcemap: truncated segment %q", s)
+	}
+	return n, nil
+}
+
+// ContextLines splits content and returns up to n lines around line
+// (zero-based) plus the line itself.
+func ContextLines(content string, line, n int) (pre []string, cur string, post []string, ok bool) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if line < 0 || line >= len(lines) {
+		return nil, "", nil, false
+	}
+	start := line - n
+	if start < 0 {
+		start = 0
+	}
+	end := line + 1 + n
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return lines[start:line], lines[line], lines[line+1 : end], true
+}
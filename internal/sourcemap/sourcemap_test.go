@@ -0,0 +1,68 @@
+package sourcemap
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testMap maps the generated `function a(b){throw new Error(b)}` back to
+// src/app.js:
+//
+//	function greet(name) {
+//	  throw new Error(name);
+//	}
+const testMap = `{"version":3,"file":"app.min.js","sourceRoot":"webpack:///","sources":["./src/app.js"],` +
+	`"sourcesContent":["function greet(name) {\n  throw new Error(name);\n}\n"],"names":["greet"],` +
+	`"mappings":"AAAA,SAASA,KACP"}`
+
+func TestLookup(t *testing.T) {
+	m, err := Parse([]byte(")]}'\n" + testMap))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	pos, ok := m.Lookup(0, 10)
+	if !ok || pos.Source != "webpack:///./src/app.js" || pos.Line != 0 || pos.Column != 9 || pos.Name != "greet" {
+		t.Fatalf("Lookup(0,10) = %+v ok=%v", pos, ok)
+	}
+	pos, ok = m.Lookup(0, 20)
+	if !ok || pos.Line != 1 || pos.Column != 2 || pos.Name != "" || pos.Content == nil {
+		t.Fatalf("Lookup(0,20) = %+v ok=%v", pos, ok)
+	}
+	if _, ok := m.Lookup(1, 0); ok {
+		t.Fatalf("expected no mapping past the last line")
+	}
+
+	pre, cur, post, ok := ContextLines(*pos.Content, pos.Line, 5)
+	if !ok || len(pre) != 1 || cur != "  throw new Error(name);" || len(post) != 2 {
+		t.Fatalf("ContextLines = %q %q %q ok=%v", pre, cur, post, ok)
+	}
+}
+
+func TestLookupSections(t *testing.T) {
+	m, err := Parse([]byte(fmt.Sprintf(`{"version":3,"sections":[{"offset":{"line":1,"column":4},"map":%s}]}`, testMap)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, ok := m.Lookup(0, 20); ok {
+		t.Fatalf("expected no mapping before the first section")
+	}
+	pos, ok := m.Lookup(1, 24)
+	if !ok || pos.Line != 1 || pos.Column != 2 {
+		t.Fatalf("Lookup(1,24) = %+v ok=%v", pos, ok)
+	}
+}
+
+func TestDecodeVLQ(t *testing.T) {
+	var out [5]int
+	n, err := decodeVLQ("w+BP", out[:])
+	if err != nil || n != 2 || out[0] != 1000 || out[1] != -7 {
+		t.Fatalf("decodeVLQ = %v %v err=%v", n, out, err)
+	}
+	if _, err := decodeVLQ("w", out[:]); err == nil {
+		t.Fatalf("expected truncated segment error")
+	}
+	if _, err := Parse([]byte(`{"version":2,"mappings":""}`)); err == nil {
+		t.Fatalf("expected version error")
+	}
+}
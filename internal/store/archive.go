@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+)
+
+func CreateArchiveManifest(ctx context.Context, db *gorm.DB, row *model.ArchiveManifest) error {
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	if row == nil || row.ProjectID <= 0 {
+		return gorm.ErrInvalidData
+	}
+	return db.WithContext(ctx).Create(row).Error
+}
+
+// ListArchiveManifests returns manifests whose range overlaps [start, end).
+// A zero start/end leaves that side open; an empty kind matches every kind.
+func ListArchiveManifests(ctx context.Context, db *gorm.DB, projectID int, kind string, start, end time.Time, limit int) ([]model.ArchiveManifest, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	q := db.WithContext(ctx).Where("project_id = ?", projectID)
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	if !start.IsZero() {
+		q = q.Where("range_end > ?", start.UTC())
+	}
+	if !end.IsZero() {
+		q = q.Where("range_start < ?", end.UTC())
+	}
+	var rows []model.ArchiveManifest
+	if err := q.Order("range_start ASC, id ASC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ArchivedUntil returns the end of the latest archived range for a project
+// and kind; ok=false when nothing was archived yet.
+func ArchivedUntil(ctx context.Context, db *gorm.DB, projectID int, kind string) (time.Time, bool, error) {
+	if db == nil {
+		return time.Time{}, false, gorm.ErrInvalidDB
+	}
+	var row model.ArchiveManifest
+	err := db.WithContext(ctx).
+		Where("project_id = ? AND kind = ?", projectID, kind).
+		Order("range_end DESC").
+		First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, err
+	}
+	return row.RangeEnd.UTC(), true, nil
+}
+
+func MarkArchiveRehydrated(ctx context.Context, db *gorm.DB, id int64, at *time.Time) error {
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	return db.WithContext(ctx).
+		Model(&model.ArchiveManifest{}).
+		Where("id = ?", id).
+		Update("rehydrated_at", at).Error
+}
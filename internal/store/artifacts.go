@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertReleaseArtifact records an uploaded artifact, replacing the one with
+// the same release and name. It returns the object key the row pointed to
+// before, if any, so the caller can drop a blob nothing references anymore.
+func UpsertReleaseArtifact(ctx context.Context, db *gorm.DB, row model.ReleaseArtifact) (model.ReleaseArtifact, string, error) {
+	if db == nil || row.ProjectID <= 0 {
+		return model.ReleaseArtifact{}, "", gorm.ErrInvalidDB
+	}
+	var prevKey string
+	prev, found, err := GetReleaseArtifactByNames(ctx, db, row.ProjectID, row.Release, []string{row.Name})
+	if err != nil {
+		return model.ReleaseArtifact{}, "", err
+	}
+	if found && prev.ObjectKey != row.ObjectKey {
+		prevKey = prev.ObjectKey
+	}
+
+	now := time.Now().UTC()
+	row.ID = 0
+	row.CreatedAt = now
+	row.UpdatedAt = now
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "release"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "debug_id", "size", "sha1", "object_key", "updated_at"}),
+	}).Create(&row).Error; err != nil {
+		return model.ReleaseArtifact{}, "", err
+	}
+	saved, _, err := GetReleaseArtifactByNames(ctx, db, row.ProjectID, row.Release, []string{row.Name})
+	return saved, prevKey, err
+}
+
+// GetReleaseArtifactByNames returns the release's artifact matching the first
+// of names that exists.
+func GetReleaseArtifactByNames(ctx context.Context, db *gorm.DB, projectID int, release string, names []string) (model.ReleaseArtifact, bool, error) {
+	if db == nil {
+		return model.ReleaseArtifact{}, false, gorm.ErrInvalidDB
+	}
+	if len(names) == 0 {
+		return model.ReleaseArtifact{}, false, nil
+	}
+	var rows []model.ReleaseArtifact
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND release = ? AND name IN ?", projectID, release, names).
+		Find(&rows).Error; err != nil {
+		return model.ReleaseArtifact{}, false, err
+	}
+	for _, name := range names {
+		for _, r := range rows {
+			if r.Name == name {
+				return r, true, nil
+			}
+		}
+	}
+	return model.ReleaseArtifact{}, false, nil
+}
+
+// GetLatestReleaseArtifactOfType returns the release's most recently uploaded
+// artifact of type typ.
+func GetLatestReleaseArtifactOfType(ctx context.Context, db *gorm.DB, projectID int, release, typ string) (model.ReleaseArtifact, bool, error) {
+	if db == nil {
+		return model.ReleaseArtifact{}, false, gorm.ErrInvalidDB
+	}
+	return firstArtifact(db.WithContext(ctx).
+		Where("project_id = ? AND release = ? AND type = ?", projectID, release, typ).
+		Order("updated_at DESC").Order("id DESC"))
+}
+
+// GetArtifactByDebugID returns the project's most recently uploaded artifact
+// of type typ with the given debug id, in any release.
+func GetArtifactByDebugID(ctx context.Context, db *gorm.DB, projectID int, typ, debugID string) (model.ReleaseArtifact, bool, error) {
+	if db == nil {
+		return model.ReleaseArtifact{}, false, gorm.ErrInvalidDB
+	}
+	if debugID == "" {
+		return model.ReleaseArtifact{}, false, nil
+	}
+	return firstArtifact(db.WithContext(ctx).
+		Where("project_id = ? AND debug_id = ? AND type = ?", projectID, debugID, typ).
+		Order("updated_at DESC").Order("id DESC"))
+}
+
+func firstArtifact(q *gorm.DB) (model.ReleaseArtifact, bool, error) {
+	var row model.ReleaseArtifact
+	if err := q.First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ReleaseArtifact{}, false, nil
+		}
+		return model.ReleaseArtifact{}, false, err
+	}
+	return row, true, nil
+}
+
+func GetReleaseArtifact(ctx context.Context, db *gorm.DB, projectID int, id int64) (model.ReleaseArtifact, bool, error) {
+	if db == nil {
+		return model.ReleaseArtifact{}, false, gorm.ErrInvalidDB
+	}
+	var row model.ReleaseArtifact
+	err := db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, id).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ReleaseArtifact{}, false, nil
+		}
+		return model.ReleaseArtifact{}, false, err
+	}
+	return row, true, nil
+}
+
+func ListReleaseArtifacts(ctx context.Context, db *gorm.DB, projectID int, release string) ([]model.ReleaseArtifact, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.ReleaseArtifact
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND release = ?", projectID, release).
+		Order("name ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// DeleteReleaseArtifact removes the row and reports whether its object key is
+// still referenced by another artifact (identical content is stored once).
+func DeleteReleaseArtifact(ctx context.Context, db *gorm.DB, row model.ReleaseArtifact) (bool, error) {
+	if db == nil {
+		return false, gorm.ErrInvalidDB
+	}
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND id = ?", row.ProjectID, row.ID).
+		Delete(&model.ReleaseArtifact{}).Error; err != nil {
+		return false, err
+	}
+	return ArtifactObjectInUse(ctx, db, row.ObjectKey)
+}
+
+// ArtifactObjectInUse reports whether any artifact row points at key.
+func ArtifactObjectInUse(ctx context.Context, db *gorm.DB, key string) (bool, error) {
+	if db == nil {
+		return false, gorm.ErrInvalidDB
+	}
+	var n int64
+	if err := db.WithContext(ctx).Model(&model.ReleaseArtifact{}).Where("object_key = ?", key).Count(&n).Error; err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
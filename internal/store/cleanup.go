@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/aak1247/logtap/internal/model"
@@ -19,70 +20,60 @@ func DeleteLogsBefore(ctx context.Context, db *gorm.DB, projectID int, before ti
 }
 
 func DeleteLogsBeforeBatched(ctx context.Context, db *gorm.DB, projectID int, before time.Time, batchSize int) (int64, error) {
+	return DeleteRowsBeforeBatched(ctx, db, "logs", projectID, before, "", nil, batchSize)
+}
+
+func DeleteEventsBefore(ctx context.Context, db *gorm.DB, projectID int, before time.Time) (int64, error) {
 	if db == nil {
 		return 0, gorm.ErrInvalidDB
 	}
-	if projectID <= 0 {
-		return 0, gorm.ErrInvalidData
-	}
-	if batchSize <= 0 {
-		batchSize = 5000
-	}
-
-	before = before.UTC()
-	// Use a subquery to limit deletion size and keep transactions short.
-	// Works on Postgres/TimescaleDB and SQLite.
-	res := db.WithContext(ctx).Exec(`
-		WITH doomed AS (
-			SELECT id FROM logs
-			WHERE project_id = ? AND timestamp < ?
-			ORDER BY timestamp ASC
-			LIMIT ?
-		)
-		DELETE FROM logs WHERE id IN (SELECT id FROM doomed)
-	`, projectID, before, batchSize)
+	res := db.WithContext(ctx).
+		Where("project_id = ? AND timestamp < ?", projectID, before.UTC()).
+		Delete(&model.Event{})
 	return res.RowsAffected, res.Error
 }
 
-func DeleteEventsBefore(ctx context.Context, db *gorm.DB, projectID int, before time.Time) (int64, error) {
+func DeleteEventsBeforeBatched(ctx context.Context, db *gorm.DB, projectID int, before time.Time, batchSize int) (int64, error) {
+	return DeleteRowsBeforeBatched(ctx, db, "events", projectID, before, "", nil, batchSize)
+}
+
+func DeleteTrackEventsBeforeBatched(ctx context.Context, db *gorm.DB, projectID int, before time.Time, batchSize int) (int64, error) {
+	return DeleteRowsBeforeBatched(ctx, db, "track_events", projectID, before, "", nil, batchSize)
+}
+
+func DeleteTrackEventsBefore(ctx context.Context, db *gorm.DB, projectID int, before time.Time) (int64, error) {
 	if db == nil {
 		return 0, gorm.ErrInvalidDB
 	}
 	res := db.WithContext(ctx).
 		Where("project_id = ? AND timestamp < ?", projectID, before.UTC()).
-		Delete(&model.Event{})
+		Delete(&model.TrackEvent{})
 	return res.RowsAffected, res.Error
 }
 
-func DeleteEventsBeforeBatched(ctx context.Context, db *gorm.DB, projectID int, before time.Time, batchSize int) (int64, error) {
+// DeleteRowsBefore deletes the project's rows of table older than before that
+// also match where (a retention rule predicate; empty matches every row).
+func DeleteRowsBefore(ctx context.Context, db *gorm.DB, table string, projectID int, before time.Time, where string, args []any) (int64, error) {
 	if db == nil {
 		return 0, gorm.ErrInvalidDB
 	}
-	if projectID <= 0 {
+	if !retentionTables[table] {
 		return 0, gorm.ErrInvalidData
 	}
-	if batchSize <= 0 {
-		batchSize = 5000
+	q := db.WithContext(ctx).Table(table).Where("project_id = ? AND timestamp < ?", projectID, before.UTC())
+	if where != "" {
+		q = q.Where(where, args...)
 	}
-
-	before = before.UTC()
-	res := db.WithContext(ctx).Exec(`
-		WITH doomed AS (
-			SELECT id FROM events
-			WHERE project_id = ? AND timestamp < ?
-			ORDER BY timestamp ASC
-			LIMIT ?
-		)
-		DELETE FROM events WHERE id IN (SELECT id FROM doomed)
-	`, projectID, before, batchSize)
+	res := q.Delete(nil)
 	return res.RowsAffected, res.Error
 }
 
-func DeleteTrackEventsBeforeBatched(ctx context.Context, db *gorm.DB, projectID int, before time.Time, batchSize int) (int64, error) {
+// DeleteRowsBeforeBatched is DeleteRowsBefore limited to batchSize rows.
+func DeleteRowsBeforeBatched(ctx context.Context, db *gorm.DB, table string, projectID int, before time.Time, where string, args []any, batchSize int) (int64, error) {
 	if db == nil {
 		return 0, gorm.ErrInvalidDB
 	}
-	if projectID <= 0 {
+	if projectID <= 0 || !retentionTables[table] {
 		return 0, gorm.ErrInvalidData
 	}
 	if batchSize <= 0 {
@@ -90,24 +81,28 @@ func DeleteTrackEventsBeforeBatched(ctx context.Context, db *gorm.DB, projectID
 	}
 
 	before = before.UTC()
-	res := db.WithContext(ctx).Exec(`
+	match := ""
+	if where != "" {
+		match = " AND (" + where + ")"
+	}
+	// Use a subquery to limit deletion size and keep transactions short.
+	// Works on Postgres/TimescaleDB and SQLite. The repeated timestamp bound
+	// lets partitioned tables prune to the expired partitions.
+	q := fmt.Sprintf(`
 		WITH doomed AS (
-			SELECT id FROM track_events
-			WHERE project_id = ? AND timestamp < ?
+			SELECT id FROM %[1]s
+			WHERE project_id = ? AND timestamp < ?%[2]s
 			ORDER BY timestamp ASC
 			LIMIT ?
 		)
-		DELETE FROM track_events WHERE id IN (SELECT id FROM doomed)
-	`, projectID, before, batchSize)
+		DELETE FROM %[1]s WHERE id IN (SELECT id FROM doomed) AND timestamp < ?
+	`, table, match)
+	vars := make([]any, 0, len(args)+4)
+	vars = append(vars, projectID, before)
+	vars = append(vars, args...)
+	vars = append(vars, batchSize, before)
+	res := db.WithContext(ctx).Exec(q, vars...)
 	return res.RowsAffected, res.Error
 }
 
-func DeleteTrackEventsBefore(ctx context.Context, db *gorm.DB, projectID int, before time.Time) (int64, error) {
-	if db == nil {
-		return 0, gorm.ErrInvalidDB
-	}
-	res := db.WithContext(ctx).
-		Where("project_id = ? AND timestamp < ?", projectID, before.UTC()).
-		Delete(&model.TrackEvent{})
-	return res.RowsAffected, res.Error
-}
+var retentionTables = map[string]bool{"logs": true, "events": true, "track_events": true}
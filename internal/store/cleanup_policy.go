@@ -74,6 +74,20 @@ func ListCleanupPoliciesDue(ctx context.Context, db *gorm.DB, now time.Time, lim
 	return rows, nil
 }
 
+// ListEnabledCleanupPolicies returns every enabled policy regardless of schedule.
+// Partition retention needs the full picture to decide whether a shared
+// partition has expired for all projects in it.
+func ListEnabledCleanupPolicies(ctx context.Context, db *gorm.DB) ([]model.CleanupPolicy, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.CleanupPolicy
+	if err := db.WithContext(ctx).Where("enabled = true").Order("project_id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
 func MarkCleanupPolicyRun(ctx context.Context, db *gorm.DB, projectID int, lastRunAt time.Time, hourUTC, minuteUTC int) error {
 	if db == nil || projectID <= 0 {
 		return gorm.ErrInvalidDB
@@ -106,6 +120,21 @@ func MarkCleanupPolicyInProgress(ctx context.Context, db *gorm.DB, projectID int
 		}).Error
 }
 
+// ScheduleCleanupPolicyNow makes the policy due on the worker's next pass
+// without touching last_run_at.
+func ScheduleCleanupPolicyNow(ctx context.Context, db *gorm.DB, projectID int, now time.Time) error {
+	if db == nil || projectID <= 0 {
+		return gorm.ErrInvalidDB
+	}
+	return db.WithContext(ctx).
+		Model(&model.CleanupPolicy{}).
+		Where("project_id = ?", projectID).
+		Updates(map[string]any{
+			"next_run_at": now.UTC(),
+			"updated_at":  time.Now().UTC(),
+		}).Error
+}
+
 func ComputeNextRunAt(now time.Time, hourUTC, minuteUTC int) time.Time {
 	now = now.UTC()
 	if hourUTC < 0 {
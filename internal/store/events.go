@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/aak1247/logtap/internal/alert"
+	"github.com/aak1247/logtap/internal/grouping"
 	"github.com/aak1247/logtap/internal/identity"
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/aak1247/logtap/internal/project"
@@ -63,6 +64,7 @@ func EventRowFromMap(projectID string, event map[string]any) (model.Event, error
 	environment, _ := event["environment"].(string)
 	userID := extractUserID(event["user"])
 	title := extractTitle(event)
+	fingerprint := grouping.Compute(event).Fingerprint
 
 	data, _ := json.Marshal(event)
 
@@ -80,6 +82,7 @@ func EventRowFromMap(projectID string, event map[string]any) (model.Event, error
 		Environment: environment,
 		UserID:      userID,
 		Title:       title,
+		Fingerprint: fingerprint,
 		Data:        datatypes.JSON(data),
 	}
 	return row, nil
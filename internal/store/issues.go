@@ -0,0 +1,542 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/grouping"
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Issue triggers reported by UpsertIssuesFromEvents for alerting.
+const (
+	IssueTriggerNew        = "new_issue"
+	IssueTriggerRegression = "regression"
+)
+
+// IssueTrigger is an issue that was created or reopened by Event.
+type IssueTrigger struct {
+	Kind  string
+	Issue model.Issue
+	Event model.Event
+}
+
+// InsertEventsWithIssues stores rows and folds fresh, the rows among them
+// not stored before, into their issues in one transaction. When the issues
+// cannot be updated the events are not stored either, so the caller can
+// retry the batch instead of losing the counts for good.
+func InsertEventsWithIssues(ctx context.Context, db *gorm.DB, rows, fresh []model.Event) ([]IssueTrigger, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var triggers []IssueTrigger
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := InsertEventsBatch(ctx, tx, rows); err != nil {
+			return err
+		}
+		var err error
+		triggers, err = UpsertIssuesFromEvents(ctx, tx, fresh)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return triggers, nil
+}
+
+// UpsertIssuesFromEvents folds newly stored events into their issues and
+// applies the status lifecycle: resolved issues regress, ignored issues past
+// their threshold return to unresolved. It registers the events' releases
+// first, since an issue resolved in the next release regresses only on a
+// release created after the one it was resolved in. rows must not contain
+// redelivered events, or they would be counted twice.
+func UpsertIssuesFromEvents(ctx context.Context, db *gorm.DB, rows []model.Event) ([]IssueTrigger, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	type key struct {
+		projectID   int
+		fingerprint string
+	}
+	agg := map[key]*model.Issue{}
+	latest := map[key]model.Event{}
+	var order []key
+	users := map[key]map[string]bool{}
+	for _, r := range rows {
+		if r.ProjectID <= 0 || r.Fingerprint == "" {
+			continue
+		}
+		k := key{projectID: r.ProjectID, fingerprint: r.Fingerprint}
+		cur, ok := agg[k]
+		if !ok {
+			cur = &model.Issue{
+				ProjectID:    r.ProjectID,
+				Fingerprint:  r.Fingerprint,
+				FirstSeen:    r.Timestamp,
+				FirstRelease: truncate(r.ReleaseTag, 100),
+				LastSeen:     r.Timestamp,
+				Status:       model.IssueStatusUnresolved,
+			}
+			agg[k] = cur
+			order = append(order, k)
+		}
+		cur.TimesSeen++
+		if r.Timestamp.Before(cur.FirstSeen) {
+			cur.FirstSeen = r.Timestamp
+			cur.FirstRelease = truncate(r.ReleaseTag, 100)
+		}
+		if !r.Timestamp.Before(cur.LastSeen) {
+			cur.LastSeen = r.Timestamp
+			cur.LastEventID = r.ID
+			cur.Title = r.Title
+			cur.Level = r.Level
+			cur.Culprit = eventCulprit(r)
+			latest[k] = r
+		}
+		user := r.UserID
+		if user == "" {
+			user = r.DistinctID
+		}
+		if user != "" {
+			if users[k] == nil {
+				users[k] = map[string]bool{}
+			}
+			users[k][truncate(user, 255)] = true
+		}
+	}
+	if len(order) == 0 {
+		return nil, nil
+	}
+
+	issues := make([]model.Issue, 0, len(order))
+	var issueUsers []model.IssueUser
+	byProject := map[int][]string{}
+	for _, k := range order {
+		issues = append(issues, *agg[k])
+		for u := range users[k] {
+			issueUsers = append(issueUsers, model.IssueUser{ProjectID: k.projectID, Fingerprint: k.fingerprint, User: u})
+		}
+		byProject[k.projectID] = append(byProject[k.projectID], k.fingerprint)
+	}
+
+	now := time.Now().UTC()
+	newer := "EXCLUDED.last_seen >= issues.last_seen"
+	var triggers []IssueTrigger
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := EnsureReleasesFromEvents(ctx, tx, rows); err != nil {
+			return err
+		}
+		before := map[key]model.Issue{}
+		for projectID, fps := range byProject {
+			var prev []model.Issue
+			if err := tx.Where("project_id = ? AND fingerprint IN ?", projectID, fps).Find(&prev).Error; err != nil {
+				return err
+			}
+			for _, is := range prev {
+				before[key{projectID: is.ProjectID, fingerprint: is.Fingerprint}] = is
+			}
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "project_id"}, {Name: "fingerprint"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"times_seen":    gorm.Expr("issues.times_seen + EXCLUDED.times_seen"),
+				"first_seen":    gorm.Expr("CASE WHEN EXCLUDED.first_seen < issues.first_seen THEN EXCLUDED.first_seen ELSE issues.first_seen END"),
+				"last_seen":     gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.last_seen ELSE issues.last_seen END"),
+				"last_event_id": gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.last_event_id ELSE issues.last_event_id END"),
+				"title":         gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.title ELSE issues.title END"),
+				"culprit":       gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.culprit ELSE issues.culprit END"),
+				"level":         gorm.Expr("CASE WHEN " + newer + " THEN EXCLUDED.level ELSE issues.level END"),
+				"updated_at":    now,
+			}),
+		}).CreateInBatches(&issues, 200).Error; err != nil {
+			return err
+		}
+		if len(issueUsers) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&issueUsers, 500).Error; err != nil {
+				return err
+			}
+			for projectID, fps := range byProject {
+				if err := tx.Exec(`
+					UPDATE issues SET user_count = (
+						SELECT COUNT(1) FROM issue_users u
+						WHERE u.project_id = issues.project_id AND u.fingerprint = issues.fingerprint
+					)
+					WHERE project_id = ? AND fingerprint IN ?
+				`, projectID, fps).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		for projectID, fps := range byProject {
+			var cur []model.Issue
+			if err := tx.Where("project_id = ? AND fingerprint IN ?", projectID, fps).Find(&cur).Error; err != nil {
+				return err
+			}
+			for _, is := range cur {
+				k := key{projectID: is.ProjectID, fingerprint: is.Fingerprint}
+				ev := latest[k]
+				prev, existed := before[k]
+				if !existed {
+					if err := addIssueActivity(tx, is, "first_seen", 0, map[string]any{"event_id": ev.ID.String()}); err != nil {
+						return err
+					}
+					triggers = append(triggers, IssueTrigger{Kind: IssueTriggerNew, Issue: is, Event: ev})
+					continue
+				}
+				newer := false
+				if prev.Status == model.IssueStatusResolvedInNextRelease {
+					var err error
+					if newer, err = releaseNewer(tx, is.ProjectID, ev.ReleaseTag, prev.ResolvedInRelease); err != nil {
+						return err
+					}
+				}
+				next, kind, data := transition(prev, is, ev, newer, now)
+				if kind == "" {
+					continue
+				}
+				if err := tx.Model(&model.Issue{}).Where("id = ?", is.ID).Updates(issueStatusColumns(next, now)).Error; err != nil {
+					return err
+				}
+				if err := addIssueActivity(tx, next, kind, 0, data); err != nil {
+					return err
+				}
+				if kind == IssueTriggerRegression {
+					triggers = append(triggers, IssueTrigger{Kind: IssueTriggerRegression, Issue: next, Event: ev})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return triggers, nil
+}
+
+// transition applies the lifecycle to an issue that received ev; kind is
+// empty when its status does not change. newerRelease is whether ev's
+// release was created after the one the issue was resolved in.
+func transition(prev, is model.Issue, ev model.Event, newerRelease bool, now time.Time) (model.Issue, string, map[string]any) {
+	switch prev.Status {
+	case model.IssueStatusResolved, model.IssueStatusResolvedInNextRelease:
+		if prev.ResolvedAt != nil && !ev.Timestamp.After(*prev.ResolvedAt) {
+			// A late event from before the resolution.
+			return is, "", nil
+		}
+		if prev.Status == model.IssueStatusResolvedInNextRelease && !newerRelease {
+			// The same or an older release, still running on clients that
+			// have not upgraded.
+			return is, "", nil
+		}
+		data := map[string]any{"from": prev.Status, "event_id": ev.ID.String()}
+		if ev.ReleaseTag != "" {
+			data["release"] = ev.ReleaseTag
+		}
+		is = reopen(is)
+		is.Regressed = true
+		return is, IssueTriggerRegression, data
+	case model.IssueStatusIgnored:
+		var reason string
+		switch {
+		case is.IgnoreUntil != nil && !now.Before(*is.IgnoreUntil):
+			reason = "time"
+		case is.IgnoreUntilCount > 0 && is.TimesSeen >= is.IgnoreUntilCount:
+			reason = "count"
+		case is.IgnoreUntilUsers > 0 && is.UserCount >= is.IgnoreUntilUsers:
+			reason = "users"
+		default:
+			return is, "", nil
+		}
+		return reopen(is), "unignored", map[string]any{"reason": reason}
+	default:
+		return is, "", nil
+	}
+}
+
+// releaseNewer reports whether release was created after base, in the order
+// of the project's releases. It is false when either is not registered, so
+// an issue does not regress on a release it cannot place.
+func releaseNewer(tx *gorm.DB, projectID int, release, base string) (bool, error) {
+	release, base = truncate(strings.TrimSpace(release), 100), truncate(strings.TrimSpace(base), 100)
+	if release == "" || base == "" || release == base {
+		return false, nil
+	}
+	var rows []model.Release
+	if err := tx.Where("project_id = ? AND version IN ?", projectID, []string{release, base}).Find(&rows).Error; err != nil {
+		return false, err
+	}
+	if len(rows) != 2 {
+		return false, nil
+	}
+	r, b := rows[0], rows[1]
+	if r.Version != release {
+		r, b = b, r
+	}
+	return r.CreatedAt.After(b.CreatedAt) || r.CreatedAt.Equal(b.CreatedAt) && r.ID > b.ID, nil
+}
+
+func reopen(is model.Issue) model.Issue {
+	is.Status = model.IssueStatusUnresolved
+	is.ResolvedAt = nil
+	is.ResolvedInRelease = ""
+	is.IgnoreUntil = nil
+	is.IgnoreUntilCount = 0
+	is.IgnoreUntilUsers = 0
+	return is
+}
+
+func issueStatusColumns(is model.Issue, now time.Time) map[string]any {
+	return map[string]any{
+		"status":              is.Status,
+		"regressed":           is.Regressed,
+		"resolved_at":         is.ResolvedAt,
+		"resolved_in_release": is.ResolvedInRelease,
+		"ignore_until":        is.IgnoreUntil,
+		"ignore_until_count":  is.IgnoreUntilCount,
+		"ignore_until_users":  is.IgnoreUntilUsers,
+		"updated_at":          now,
+	}
+}
+
+func addIssueActivity(tx *gorm.DB, is model.Issue, kind string, userID int64, data map[string]any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.IssueActivity{
+		ProjectID: is.ProjectID,
+		IssueID:   is.ID,
+		Kind:      kind,
+		UserID:    userID,
+		Data:      datatypes.JSON(b),
+	}).Error
+}
+
+func eventCulprit(r model.Event) string {
+	var event map[string]any
+	if err := json.Unmarshal(r.Data, &event); err != nil {
+		return ""
+	}
+	return truncate(grouping.Compute(event).Culprit, 1000)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+type IssueFilter struct {
+	// Query matches the title or culprit (case-insensitive substring).
+	Query string
+	Level string
+	// Status limits to one status; empty lists all.
+	Status string
+	// AssigneeUserID limits to issues assigned to the user.
+	AssigneeUserID int64
+	// FirstRelease limits to issues introduced in the release.
+	FirstRelease string
+	// Sort is one of last_seen (default), first_seen, count or users.
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+var issueSorts = map[string]string{
+	"":           "last_seen DESC",
+	"last_seen":  "last_seen DESC",
+	"first_seen": "first_seen DESC",
+	"count":      "times_seen DESC",
+	"users":      "user_count DESC",
+}
+
+var ErrInvalidIssueSort = errors.New("invalid sort (expected last_seen|first_seen|count|users)")
+
+func ListIssues(ctx context.Context, db *gorm.DB, projectID int, f IssueFilter) ([]model.Issue, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	order, ok := issueSorts[f.Sort]
+	if !ok {
+		return nil, ErrInvalidIssueSort
+	}
+	q := db.WithContext(ctx).Where("project_id = ?", projectID)
+	if f.Level != "" {
+		q = q.Where("LOWER(level) = ?", strings.ToLower(f.Level))
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.AssigneeUserID > 0 {
+		q = q.Where("assignee_user_id = ?", f.AssigneeUserID)
+	}
+	if f.FirstRelease != "" {
+		q = q.Where("first_release = ?", f.FirstRelease)
+	}
+	if f.Query != "" {
+		like := "%" + strings.ToLower(f.Query) + "%"
+		q = q.Where("(LOWER(title) LIKE ? OR LOWER(culprit) LIKE ?)", like, like)
+	}
+	var rows []model.Issue
+	if err := q.Order(order).Order("id DESC").Limit(f.Limit).Offset(f.Offset).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func GetIssue(ctx context.Context, db *gorm.DB, projectID int, id int64) (model.Issue, bool, error) {
+	if db == nil {
+		return model.Issue{}, false, gorm.ErrInvalidDB
+	}
+	var row model.Issue
+	err := db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, id).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Issue{}, false, nil
+		}
+		return model.Issue{}, false, err
+	}
+	return row, true, nil
+}
+
+// ListIssueEvents returns the issue's events newest first, optionally only
+// those before a timestamp (for paging).
+func ListIssueEvents(ctx context.Context, db *gorm.DB, issue model.Issue, before time.Time, limit int) ([]model.Event, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	q := db.WithContext(ctx).Where("project_id = ? AND fingerprint = ?", issue.ProjectID, issue.Fingerprint)
+	if !before.IsZero() {
+		q = q.Where("timestamp < ?", before.UTC())
+	}
+	var rows []model.Event
+	if err := q.Order("timestamp DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// IssueUpdate is a user's change to an issue. Ignore thresholds are relative
+// to now and the issue's current counters; all zero ignores until changed
+// by hand.
+type IssueUpdate struct {
+	Status         *string
+	IgnoreDuration time.Duration
+	IgnoreCount    int64
+	IgnoreUsers    int64
+
+	// SetAssignee assigns AssigneeUserID (nil unassigns).
+	SetAssignee    bool
+	AssigneeUserID *int64
+}
+
+var ErrInvalidIssueStatus = errors.New("invalid status (expected unresolved|resolved|resolved_in_next_release|ignored|muted)")
+
+// UpdateIssue applies u on behalf of actorUserID and records it in the
+// issue's activity.
+func UpdateIssue(ctx context.Context, db *gorm.DB, is model.Issue, u IssueUpdate, actorUserID int64) (model.Issue, error) {
+	if db == nil {
+		return model.Issue{}, gorm.ErrInvalidDB
+	}
+	now := time.Now().UTC()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if u.Status != nil && *u.Status != is.Status {
+			from := is.Status
+			next := reopen(is)
+			next.Status = *u.Status
+			data := map[string]any{"from": from, "to": next.Status}
+			switch next.Status {
+			case model.IssueStatusUnresolved, model.IssueStatusMuted:
+			case model.IssueStatusResolved, model.IssueStatusResolvedInNextRelease:
+				next.ResolvedAt = &now
+				next.Regressed = false
+				if next.Status == model.IssueStatusResolvedInNextRelease {
+					var ev model.Event
+					if err := tx.Select("release_tag").
+						Where("project_id = ? AND id = ?", is.ProjectID, is.LastEventID).
+						Limit(1).Find(&ev).Error; err != nil {
+						return err
+					}
+					next.ResolvedInRelease = ev.ReleaseTag
+					data["release"] = ev.ReleaseTag
+				}
+			case model.IssueStatusIgnored:
+				if u.IgnoreDuration > 0 {
+					until := now.Add(u.IgnoreDuration)
+					next.IgnoreUntil = &until
+					data["until"] = until
+				}
+				if u.IgnoreCount > 0 {
+					next.IgnoreUntilCount = is.TimesSeen + u.IgnoreCount
+					data["count"] = u.IgnoreCount
+				}
+				if u.IgnoreUsers > 0 {
+					next.IgnoreUntilUsers = is.UserCount + u.IgnoreUsers
+					data["users"] = u.IgnoreUsers
+				}
+			default:
+				return ErrInvalidIssueStatus
+			}
+			if err := tx.Model(&model.Issue{}).Where("id = ?", is.ID).Updates(issueStatusColumns(next, now)).Error; err != nil {
+				return err
+			}
+			if err := addIssueActivity(tx, next, "status", actorUserID, data); err != nil {
+				return err
+			}
+			is = next
+		}
+		if u.SetAssignee && !sameAssignee(is.AssigneeUserID, u.AssigneeUserID) {
+			if err := tx.Model(&model.Issue{}).Where("id = ?", is.ID).Updates(map[string]any{
+				"assignee_user_id": u.AssigneeUserID,
+				"updated_at":       now,
+			}).Error; err != nil {
+				return err
+			}
+			kind, data := "unassigned", map[string]any{}
+			if u.AssigneeUserID != nil {
+				kind, data = "assigned", map[string]any{"assignee_user_id": *u.AssigneeUserID}
+			}
+			if err := addIssueActivity(tx, is, kind, actorUserID, data); err != nil {
+				return err
+			}
+			is.AssigneeUserID = u.AssigneeUserID
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Issue{}, err
+	}
+	out, _, err := GetIssue(ctx, db, is.ProjectID, is.ID)
+	return out, err
+}
+
+func sameAssignee(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// ListIssueActivity returns the issue's history, oldest first.
+func ListIssueActivity(ctx context.Context, db *gorm.DB, is model.Issue) ([]model.IssueActivity, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.IssueActivity
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND issue_id = ?", is.ProjectID, is.ID).
+		Order("created_at ASC").Order("id ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+)
+
+func TestUpsertIssuesFromEvents(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&model.Issue{}, &model.IssueUser{}, &model.IssueActivity{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	ctx := context.Background()
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mk := func(msg, user, level string, at time.Time) model.Event {
+		row, err := EventRowFromMap("1", map[string]any{
+			"message":   msg,
+			"level":     level,
+			"timestamp": at.Format(time.RFC3339Nano),
+			"user":      map[string]any{"id": user},
+		})
+		if err != nil {
+			t.Fatalf("EventRowFromMap: %v", err)
+		}
+		return row
+	}
+
+	first := []model.Event{
+		mk("timeout after 30s", "u1", "warning", ts.Add(time.Minute)),
+		mk("timeout after 45s", "u2", "error", ts.Add(2*time.Minute)),
+		mk("disk full", "u1", "fatal", ts),
+	}
+	if first[0].Fingerprint != first[1].Fingerprint || first[0].Fingerprint == first[2].Fingerprint {
+		t.Fatalf("unexpected fingerprints %q %q %q", first[0].Fingerprint, first[1].Fingerprint, first[2].Fingerprint)
+	}
+	triggers, err := UpsertIssuesFromEvents(ctx, db, first)
+	if err != nil {
+		t.Fatalf("UpsertIssuesFromEvents: %v", err)
+	}
+	if len(triggers) != 2 || triggers[0].Kind != IssueTriggerNew {
+		t.Fatalf("expected 2 new_issue triggers, got %+v", triggers)
+	}
+	// A later batch with an older occurrence and a repeat user.
+	if triggers, err := UpsertIssuesFromEvents(ctx, db, []model.Event{mk("timeout after 5s", "u2", "info", ts.Add(-time.Hour))}); err != nil || len(triggers) != 0 {
+		t.Fatalf("UpsertIssuesFromEvents: triggers=%+v err=%v", triggers, err)
+	}
+
+	issues, err := ListIssues(ctx, db, 1, IssueFilter{Sort: "count", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListIssues: %v", err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %d", len(issues))
+	}
+	got := issues[0]
+	if got.TimesSeen != 3 || got.UserCount != 2 {
+		t.Fatalf("unexpected counters %+v", got)
+	}
+	if !got.FirstSeen.Equal(ts.Add(-time.Hour)) || !got.LastSeen.Equal(ts.Add(2*time.Minute)) {
+		t.Fatalf("unexpected first/last seen %v %v", got.FirstSeen, got.LastSeen)
+	}
+	if got.Level != "error" || got.LastEventID != first[1].ID || got.Title != "timeout after 45s" {
+		t.Fatalf("expected latest event to win, got %+v", got)
+	}
+
+	if _, err := ListIssues(ctx, db, 1, IssueFilter{Sort: "bogus"}); err != ErrInvalidIssueSort {
+		t.Fatalf("expected ErrInvalidIssueSort, got %v", err)
+	}
+	filtered, err := ListIssues(ctx, db, 1, IssueFilter{Query: "DISK", Limit: 10})
+	if err != nil || len(filtered) != 1 || filtered[0].Level != "fatal" {
+		t.Fatalf("unexpected filtered issues %+v err=%v", filtered, err)
+	}
+}
+
+func TestIssueLifecycle(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&model.Issue{}, &model.IssueUser{}, &model.IssueActivity{}, &model.Release{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	ctx := context.Background()
+
+	mk := func(user, release string, at time.Time) model.Event {
+		row, err := EventRowFromMap("1", map[string]any{
+			"message":   "boom",
+			"level":     "error",
+			"release":   release,
+			"timestamp": at.Format(time.RFC3339Nano),
+			"user":      map[string]any{"id": user},
+		})
+		if err != nil {
+			t.Fatalf("EventRowFromMap: %v", err)
+		}
+		return row
+	}
+	ingest := func(ev model.Event) []IssueTrigger {
+		if err := db.Create(&ev).Error; err != nil {
+			t.Fatalf("Create event: %v", err)
+		}
+		triggers, err := UpsertIssuesFromEvents(ctx, db, []model.Event{ev})
+		if err != nil {
+			t.Fatalf("UpsertIssuesFromEvents: %v", err)
+		}
+		return triggers
+	}
+	status := func(s string) *string { return &s }
+	reload := func(id int64) model.Issue {
+		is, ok, err := GetIssue(ctx, db, 1, id)
+		if err != nil || !ok {
+			t.Fatalf("GetIssue: ok=%v err=%v", ok, err)
+		}
+		return is
+	}
+
+	now := time.Now().UTC()
+	tr := ingest(mk("u1", "1.0.0", now.Add(-time.Hour)))
+	if len(tr) != 1 || tr[0].Kind != IssueTriggerNew {
+		t.Fatalf("expected new_issue trigger, got %+v", tr)
+	}
+	issue := tr[0].Issue
+
+	// Resolved: a newer event regresses, an older one does not.
+	issue, err := UpdateIssue(ctx, db, issue, IssueUpdate{Status: status(model.IssueStatusResolved)}, 7)
+	if err != nil || issue.Status != model.IssueStatusResolved || issue.ResolvedAt == nil {
+		t.Fatalf("resolve: %+v err=%v", issue, err)
+	}
+	if tr := ingest(mk("u1", "1.0.0", now.Add(-time.Minute))); len(tr) != 0 {
+		t.Fatalf("late event should not regress, got %+v", tr)
+	}
+	tr = ingest(mk("u1", "1.0.0", time.Now().UTC().Add(time.Second)))
+	if len(tr) != 1 || tr[0].Kind != IssueTriggerRegression || tr[0].Issue.Status != model.IssueStatusUnresolved || !tr[0].Issue.Regressed {
+		t.Fatalf("expected regression, got %+v", tr)
+	}
+
+	// Resolved in next release: only a release created after it regresses,
+	// not clients still on the same or an older one.
+	if err := db.Create(&model.Release{ProjectID: 1, Version: "0.9.0", CreatedAt: now.Add(-2 * time.Hour), UpdatedAt: now}).Error; err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	issue, err = UpdateIssue(ctx, db, reload(issue.ID), IssueUpdate{Status: status(model.IssueStatusResolvedInNextRelease)}, 7)
+	if err != nil || issue.ResolvedInRelease != "1.0.0" {
+		t.Fatalf("resolve in next release: %+v err=%v", issue, err)
+	}
+	if tr := ingest(mk("u1", "1.0.0", time.Now().UTC().Add(2*time.Second))); len(tr) != 0 {
+		t.Fatalf("same release should not regress, got %+v", tr)
+	}
+	if tr := ingest(mk("u1", "0.9.0", time.Now().UTC().Add(2*time.Second))); len(tr) != 0 {
+		t.Fatalf("older release should not regress, got %+v", tr)
+	}
+	if tr := ingest(mk("u1", "", time.Now().UTC().Add(2*time.Second))); len(tr) != 0 {
+		t.Fatalf("unknown release should not regress, got %+v", tr)
+	}
+	if tr := ingest(mk("u1", "1.1.0", time.Now().UTC().Add(3*time.Second))); len(tr) != 1 || tr[0].Kind != IssueTriggerRegression {
+		t.Fatalf("new release should regress, got %+v", tr)
+	}
+
+	// Ignored until two more occurrences: no triggers, then back to unresolved.
+	issue, err = UpdateIssue(ctx, db, reload(issue.ID), IssueUpdate{Status: status(model.IssueStatusIgnored), IgnoreCount: 2}, 7)
+	if err != nil || issue.IgnoreUntilCount != issue.TimesSeen+2 {
+		t.Fatalf("ignore: %+v err=%v", issue, err)
+	}
+	ingest(mk("u2", "1.1.0", time.Now().UTC()))
+	if got := reload(issue.ID); got.Status != model.IssueStatusIgnored {
+		t.Fatalf("expected still ignored, got %q", got.Status)
+	}
+	ingest(mk("u3", "1.1.0", time.Now().UTC()))
+	if got := reload(issue.ID); got.Status != model.IssueStatusUnresolved || got.IgnoreUntilCount != 0 {
+		t.Fatalf("expected unignored, got %+v", got)
+	}
+
+	if _, err := UpdateIssue(ctx, db, reload(issue.ID), IssueUpdate{Status: status("bogus")}, 7); !errors.Is(err, ErrInvalidIssueStatus) {
+		t.Fatalf("expected ErrInvalidIssueStatus, got %v", err)
+	}
+
+	uid := int64(42)
+	issue, err = UpdateIssue(ctx, db, reload(issue.ID), IssueUpdate{SetAssignee: true, AssigneeUserID: &uid}, 7)
+	if err != nil || issue.AssigneeUserID == nil || *issue.AssigneeUserID != 42 {
+		t.Fatalf("assign: %+v err=%v", issue, err)
+	}
+	assigned, err := ListIssues(ctx, db, 1, IssueFilter{AssigneeUserID: 42, Status: model.IssueStatusUnresolved, Limit: 10})
+	if err != nil || len(assigned) != 1 {
+		t.Fatalf("ListIssues by assignee: %+v err=%v", assigned, err)
+	}
+
+	acts, err := ListIssueActivity(ctx, db, issue)
+	if err != nil {
+		t.Fatalf("ListIssueActivity: %v", err)
+	}
+	var kinds []string
+	for _, a := range acts {
+		kinds = append(kinds, a.Kind)
+	}
+	want := "first_seen,status,regression,status,regression,status,unignored,assigned"
+	if got := strings.Join(kinds, ","); got != want {
+		t.Fatalf("activity = %s, want %s", got, want)
+	}
+}
+
+func TestInsertEventsWithIssuesRollsBack(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	// Without issue_activities the new issue cannot be recorded.
+	if err := db.AutoMigrate(&model.Issue{}, &model.IssueUser{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	ctx := context.Background()
+	row, err := EventRowFromMap("1", map[string]any{"message": "boom", "level": "error", "timestamp": "2025-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatalf("EventRowFromMap: %v", err)
+	}
+	rows := []model.Event{row}
+	if _, err := InsertEventsWithIssues(ctx, db, rows, rows); err == nil {
+		t.Fatal("InsertEventsWithIssues: expected an error")
+	}
+	var n int64
+	db.Model(&model.Event{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("events = %d, want the batch rolled back", n)
+	}
+
+	if err := db.AutoMigrate(&model.IssueActivity{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	triggers, err := InsertEventsWithIssues(ctx, db, rows, rows)
+	if err != nil || len(triggers) != 1 || triggers[0].Kind != IssueTriggerNew {
+		t.Fatalf("retry: triggers=%+v err=%v", triggers, err)
+	}
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetLogMetric(ctx context.Context, db *gorm.DB, projectID int, id int64) (model.LogMetric, bool, error) {
+	if db == nil {
+		return model.LogMetric{}, false, gorm.ErrInvalidDB
+	}
+	return firstLogMetric(db.WithContext(ctx).Where("project_id = ? AND id = ?", projectID, id))
+}
+
+func GetLogMetricByName(ctx context.Context, db *gorm.DB, projectID int, name string) (model.LogMetric, bool, error) {
+	if db == nil {
+		return model.LogMetric{}, false, gorm.ErrInvalidDB
+	}
+	return firstLogMetric(db.WithContext(ctx).Where("project_id = ? AND name = ?", projectID, name))
+}
+
+func firstLogMetric(q *gorm.DB) (model.LogMetric, bool, error) {
+	var row model.LogMetric
+	if err := q.First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.LogMetric{}, false, nil
+		}
+		return model.LogMetric{}, false, err
+	}
+	return row, true, nil
+}
+
+func ListLogMetrics(ctx context.Context, db *gorm.DB, projectID int) ([]model.LogMetric, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.LogMetric
+	if err := db.WithContext(ctx).Where("project_id = ?", projectID).Order("name ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ListEnabledLogMetrics returns the metrics of every project the rollup
+// worker materializes.
+func ListEnabledLogMetrics(ctx context.Context, db *gorm.DB) ([]model.LogMetric, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.LogMetric
+	if err := db.WithContext(ctx).Where("enabled = ?", true).Order("id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateLogMetric applies updates to a metric. With reset, its points are
+// dropped and the series is rolled up again from scratch, for changes that
+// make the stored points mean something else (query, aggregation, ...).
+func UpdateLogMetric(ctx context.Context, db *gorm.DB, m model.LogMetric, updates map[string]any, reset bool) (model.LogMetric, error) {
+	if db == nil || m.ID <= 0 {
+		return model.LogMetric{}, gorm.ErrInvalidDB
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if reset {
+			updates["rolled_up_to"] = nil
+			if err := tx.Where("metric_id = ?", m.ID).Delete(&model.MetricPoint{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.LogMetric{}).Where("id = ?", m.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return model.LogMetric{}, err
+	}
+	saved, _, err := GetLogMetric(ctx, db, m.ProjectID, m.ID)
+	return saved, err
+}
+
+// DeleteLogMetric deletes a metric and its points.
+func DeleteLogMetric(ctx context.Context, db *gorm.DB, projectID int, id int64) (bool, error) {
+	if db == nil {
+		return false, gorm.ErrInvalidDB
+	}
+	deleted := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("project_id = ? AND id = ?", projectID, id).Delete(&model.LogMetric{})
+		if res.Error != nil {
+			return res.Error
+		}
+		deleted = res.RowsAffected > 0
+		return tx.Where("project_id = ? AND metric_id = ?", projectID, id).Delete(&model.MetricPoint{}).Error
+	})
+	return deleted, err
+}
+
+// SaveMetricRollup stores the points of a rollup, replacing the ones of the
+// same buckets, and advances the metric's rolled_up_to to to.
+func SaveMetricRollup(ctx context.Context, db *gorm.DB, metricID int64, points []model.MetricPoint, to time.Time) error {
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(points) > 0 {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "metric_id"}, {Name: "group_key"}, {Name: "bucket"}},
+				DoUpdates: clause.AssignmentColumns([]string{"labels", "value", "count"}),
+			}).CreateInBatches(&points, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.LogMetric{}).Where("id = ?", metricID).
+			UpdateColumn("rolled_up_to", to.UTC()).Error
+	})
+}
+
+// ListMetricPoints returns a metric's points with start <= bucket < end,
+// ordered by series then bucket.
+func ListMetricPoints(ctx context.Context, db *gorm.DB, metricID int64, start, end time.Time) ([]model.MetricPoint, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.MetricPoint
+	if err := db.WithContext(ctx).
+		Where("metric_id = ? AND bucket >= ? AND bucket < ?", metricID, start.UTC(), end.UTC()).
+		Order("group_key ASC").Order("bucket ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
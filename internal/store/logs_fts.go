@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// logsFTSTable is the SQLite FTS5 index over logs.message and logs.fields.
+// It is an external-content table (no duplicated payload) kept in sync by triggers.
+const logsFTSTable = "logs_fts"
+
+// logsFTSReady caches HasLogsFTS per database, keyed by the *gorm.Config
+// that every session of an opened database shares.
+var logsFTSReady sync.Map
+
+func isSQLite(db *gorm.DB) bool {
+	return db != nil && strings.EqualFold(db.Dialector.Name(), "sqlite")
+}
+
+// EnsureLogsFTS creates the FTS5 index and its sync triggers on SQLite.
+// It is a no-op on other dialects. When the index is created on a database
+// that already contains logs, it is rebuilt from the logs table.
+func EnsureLogsFTS(ctx context.Context, db *gorm.DB) error {
+	if !isSQLite(db) {
+		return nil
+	}
+	gdb := db.WithContext(ctx)
+	existed := gdb.Migrator().HasTable(logsFTSTable)
+
+	stmts := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS logs_fts USING fts5(
+			message, fields,
+			content='logs', content_rowid='id',
+			tokenize='unicode61'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS logs_fts_ai AFTER INSERT ON logs BEGIN
+			INSERT INTO logs_fts(rowid, message, fields) VALUES (new.id, new.message, new.fields);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS logs_fts_ad AFTER DELETE ON logs BEGIN
+			INSERT INTO logs_fts(logs_fts, rowid, message, fields) VALUES ('delete', old.id, old.message, old.fields);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS logs_fts_au AFTER UPDATE ON logs BEGIN
+			INSERT INTO logs_fts(logs_fts, rowid, message, fields) VALUES ('delete', old.id, old.message, old.fields);
+			INSERT INTO logs_fts(rowid, message, fields) VALUES (new.id, new.message, new.fields);
+		END`,
+	}
+	for _, stmt := range stmts {
+		if err := gdb.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	if !existed {
+		if err := gdb.Exec(`INSERT INTO logs_fts(logs_fts) VALUES ('rebuild')`).Error; err != nil {
+			return err
+		}
+	}
+	logsFTSReady.Store(db.Config, true)
+	return nil
+}
+
+// HasLogsFTS reports whether the SQLite FTS5 index is available. The table
+// is looked up once per database; EnsureLogsFTS records it when it creates it.
+func HasLogsFTS(db *gorm.DB) bool {
+	if !isSQLite(db) {
+		return false
+	}
+	if ok, found := logsFTSReady.Load(db.Config); found {
+		return ok.(bool)
+	}
+	ok := db.Migrator().HasTable(logsFTSTable)
+	logsFTSReady.Store(db.Config, ok)
+	return ok
+}
+
+// FTS5Query turns free text into a safe FTS5 MATCH expression: every
+// whitespace-separated term becomes a quoted string, and terms are ANDed
+// (same semantics as plainto_tsquery on Postgres).
+func FTS5Query(q string) string {
+	terms := strings.Fields(q)
+	out := make([]string, 0, len(terms))
+	for _, t := range terms {
+		t = strings.ReplaceAll(t, `"`, "")
+		if t == "" {
+			continue
+		}
+		out = append(out, `"`+t+`"`)
+	}
+	return strings.Join(out, " ")
+}
+
+// WhereLogText applies a free-text filter on logs.message/logs.fields using the
+// best available mechanism for the dialect: to_tsvector on Postgres, FTS5 on
+// SQLite, and a case-insensitive substring match otherwise (or when mode=like).
+func WhereLogText(qdb *gorm.DB, db *gorm.DB, q string, mode string) *gorm.DB {
+	q = strings.TrimSpace(q)
+	if q == "" || db == nil {
+		return qdb
+	}
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	useFTS := mode == "" || mode == "fts"
+	pat := "%" + q + "%"
+
+	switch {
+	case strings.EqualFold(db.Dialector.Name(), "postgres"):
+		if useFTS {
+			return qdb.Where(
+				"to_tsvector('simple', coalesce(message,'') || ' ' || coalesce(fields::text,'')) @@ plainto_tsquery('simple', ?)",
+				q,
+			)
+		}
+		return qdb.Where(db.Where("message ILIKE ?", pat).Or("fields::text ILIKE ?", pat))
+	case isSQLite(db):
+		if useFTS && HasLogsFTS(db) {
+			if match := FTS5Query(q); match != "" {
+				return qdb.Where("id IN (SELECT rowid FROM logs_fts WHERE logs_fts MATCH ?)", match)
+			}
+		}
+		// SQLite LIKE is case-insensitive for ASCII.
+		return qdb.Where(db.Where("message LIKE ?", pat).Or("CAST(fields AS TEXT) LIKE ?", pat))
+	default:
+		lower := "%" + strings.ToLower(q) + "%"
+		return qdb.Where(db.Where("LOWER(message) LIKE ?", lower).Or("LOWER(CAST(fields AS TEXT)) LIKE ?", lower))
+	}
+}
+
+// EnsureSQLiteAutoVacuum turns on incremental auto-vacuum, which the DSN
+// pragma only does for new files: an existing database needs a one-time
+// VACUUM, which rewrites the whole file, to change mode. It is a no-op on
+// other dialects.
+func EnsureSQLiteAutoVacuum(ctx context.Context, db *gorm.DB) error {
+	if !isSQLite(db) {
+		return nil
+	}
+	// The mode and the VACUUM that applies it must share a connection.
+	return db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		var mode int
+		if err := conn.Raw(`PRAGMA auto_vacuum`).Scan(&mode).Error; err != nil {
+			return err
+		}
+		if mode == 2 { // INCREMENTAL
+			return nil
+		}
+		if err := conn.Exec(`PRAGMA auto_vacuum = INCREMENTAL`).Error; err != nil {
+			return err
+		}
+		return conn.Exec(`VACUUM`).Error
+	})
+}
+
+// CompactSQLite returns free pages to the OS and truncates the WAL after
+// large retention deletes. Pages are freed 2000 at a time so that writers
+// get the lock in between. It is a no-op on other dialects.
+func CompactSQLite(ctx context.Context, db *gorm.DB) error {
+	if !isSQLite(db) {
+		return nil
+	}
+	gdb := db.WithContext(ctx)
+	prev := int64(-1)
+	for {
+		var free int64
+		if err := gdb.Raw(`PRAGMA freelist_count`).Scan(&free).Error; err != nil {
+			return err
+		}
+		// A freelist that does not shrink is a database without
+		// incremental auto-vacuum.
+		if free == 0 || free == prev {
+			break
+		}
+		if err := gdb.Exec(`PRAGMA incremental_vacuum(2000)`).Error; err != nil {
+			return err
+		}
+		prev = free
+	}
+	return gdb.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`).Error
+}
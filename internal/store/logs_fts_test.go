@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/datatypes"
+)
+
+func TestFTS5Query(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":                      "",
+		"timeout":               `"timeout"`,
+		`  db  "timeout" `:      `"db" "timeout"`,
+		`a"b OR NOT c*`:         `"ab" "OR" "NOT" "c*"`,
+		"payment-service error": `"payment-service" "error"`,
+	}
+	for in, want := range cases {
+		if got := FTS5Query(in); got != want {
+			t.Fatalf("FTS5Query(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestWhereLogText_SQLiteFTS(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	// Insert one row before the index exists to exercise the rebuild path.
+	if err := db.Create(&model.Log{ProjectID: 1, Timestamp: now, Level: "error", Message: "db timeout while charging", Fields: datatypes.JSON(`{"service":"payments"}`)}).Error; err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := EnsureLogsFTS(ctx, db); err != nil {
+		t.Fatalf("EnsureLogsFTS: %v", err)
+	}
+	if err := EnsureLogsFTS(ctx, db); err != nil {
+		t.Fatalf("EnsureLogsFTS (idempotent): %v", err)
+	}
+	if !HasLogsFTS(db) {
+		t.Fatalf("expected logs_fts to exist")
+	}
+	if err := db.Create(&model.Log{ProjectID: 1, Timestamp: now, Level: "info", Message: "user signed in", Fields: datatypes.JSON(`{"service":"auth"}`)}).Error; err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	count := func(q, mode string) int64 {
+		t.Helper()
+		var n int64
+		qdb := WhereLogText(db.Model(&model.Log{}).Where("project_id = ?", 1), db, q, mode)
+		if err := qdb.Count(&n).Error; err != nil {
+			t.Fatalf("count %q: %v", q, err)
+		}
+		return n
+	}
+
+	if n := count("timeout", ""); n != 1 {
+		t.Fatalf("fts timeout: expected 1, got %d", n)
+	}
+	if n := count("payments", "fts"); n != 1 {
+		t.Fatalf("fts fields: expected 1, got %d", n)
+	}
+	if n := count("SIGNED user", ""); n != 1 {
+		t.Fatalf("fts case-insensitive AND: expected 1, got %d", n)
+	}
+	if n := count("timeout signed", ""); n != 0 {
+		t.Fatalf("fts AND across rows: expected 0, got %d", n)
+	}
+	if n := count("charg", "like"); n != 1 {
+		t.Fatalf("like substring: expected 1, got %d", n)
+	}
+
+	// Deletes must keep the external-content index in sync.
+	if _, err := DeleteLogsBeforeBatched(ctx, db, 1, now.Add(time.Second), 1000); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if n := count("timeout", ""); n != 0 {
+		t.Fatalf("expected index entry removed, got %d", n)
+	}
+	if err := CompactSQLite(ctx, db); err != nil {
+		t.Fatalf("CompactSQLite: %v", err)
+	}
+}
+
+func TestCompactSQLiteExistingDatabase(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	ctx := context.Background()
+	pragma := func(name string) int64 {
+		t.Helper()
+		var n int64
+		if err := db.Raw("PRAGMA " + name).Scan(&n).Error; err != nil {
+			t.Fatalf("PRAGMA %s: %v", name, err)
+		}
+		return n
+	}
+
+	// A database created without the DSN pragma keeps its freed pages.
+	if mode := pragma("auto_vacuum"); mode != 0 {
+		t.Fatalf("auto_vacuum = %d before", mode)
+	}
+	if err := EnsureSQLiteAutoVacuum(ctx, db); err != nil {
+		t.Fatalf("EnsureSQLiteAutoVacuum: %v", err)
+	}
+	if mode := pragma("auto_vacuum"); mode != 2 {
+		t.Fatalf("auto_vacuum = %d after", mode)
+	}
+
+	now := time.Now().UTC()
+	logs := make([]model.Log, 3000)
+	for i := range logs {
+		logs[i] = model.Log{ProjectID: 1, Timestamp: now, Level: "info", Message: strings.Repeat("x", 4000), Fields: datatypes.JSON(`{}`)}
+	}
+	if err := db.CreateInBatches(logs, 500).Error; err != nil {
+		t.Fatalf("create logs: %v", err)
+	}
+	if err := db.Exec("DELETE FROM logs").Error; err != nil {
+		t.Fatalf("delete logs: %v", err)
+	}
+	if free := pragma("freelist_count"); free <= 2000 {
+		t.Fatalf("expected more than 2000 free pages, got %d", free)
+	}
+	if err := CompactSQLite(ctx, db); err != nil {
+		t.Fatalf("CompactSQLite: %v", err)
+	}
+	if free := pragma("freelist_count"); free != 0 {
+		t.Fatalf("freelist_count = %d after compaction", free)
+	}
+}
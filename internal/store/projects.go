@@ -95,6 +95,16 @@ func DeleteProject(ctx context.Context, db *gorm.DB, projectID int) (bool, error
 			"alert_deliveries",
 			"monitor_definitions",
 			"monitor_runs",
+			"project_quotas",
+			"project_usage_daily",
+			"issues",
+			"issue_users",
+			"issue_activities",
+			"release_artifacts",
+			"releases",
+			"deploys",
+			"log_metrics",
+			"metric_points",
 		} {
 			if err := deleteByProjectIDIfTableExists(tx, table, projectID); err != nil {
 				return err
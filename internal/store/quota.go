@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func GetProjectQuota(ctx context.Context, db *gorm.DB, projectID int) (model.ProjectQuota, bool, error) {
+	if db == nil || projectID <= 0 {
+		return model.ProjectQuota{}, false, gorm.ErrInvalidDB
+	}
+	var row model.ProjectQuota
+	err := db.WithContext(ctx).Where("project_id = ?", projectID).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ProjectQuota{}, false, nil
+		}
+		return model.ProjectQuota{}, false, err
+	}
+	return row, true, nil
+}
+
+// UpsertProjectQuota saves the user-editable settings and leaves the usage
+// and alert state kept by the quota worker alone.
+func UpsertProjectQuota(ctx context.Context, db *gorm.DB, row model.ProjectQuota) (model.ProjectQuota, error) {
+	if db == nil || row.ProjectID <= 0 {
+		return model.ProjectQuota{}, gorm.ErrInvalidDB
+	}
+	now := time.Now().UTC()
+	row.UpdatedAt = now
+	if row.CreatedAt.IsZero() {
+		row.CreatedAt = now
+	}
+	if len(row.Channels) == 0 {
+		row.Channels = []byte("[]")
+	}
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "project_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"enabled", "max_storage_bytes", "max_daily_bytes", "max_daily_rows", "max_export_bytes",
+			"action", "sample_rate", "notify_owner", "channels", "updated_at",
+		}),
+	}).Create(&row).Error; err != nil {
+		return model.ProjectQuota{}, err
+	}
+	saved, _, err := GetProjectQuota(ctx, db, row.ProjectID)
+	return saved, err
+}
+
+func ListEnabledProjectQuotas(ctx context.Context, db *gorm.DB) ([]model.ProjectQuota, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.ProjectQuota
+	if err := db.WithContext(ctx).Where("enabled = true").Order("project_id ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// UpdateProjectQuotaState stores worker-maintained columns (storage_bytes,
+// *_alert_*).
+func UpdateProjectQuotaState(ctx context.Context, db *gorm.DB, projectID int, updates map[string]any) error {
+	if db == nil || projectID <= 0 {
+		return gorm.ErrInvalidDB
+	}
+	return db.WithContext(ctx).
+		Model(&model.ProjectQuota{}).
+		Where("project_id = ?", projectID).
+		UpdateColumns(updates).Error
+}
@@ -0,0 +1,300 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertRelease registers a release. An existing release keeps its
+// created_at; ref and url are updated when given.
+func UpsertRelease(ctx context.Context, db *gorm.DB, row model.Release) (model.Release, error) {
+	if db == nil || row.ProjectID <= 0 || row.Version == "" {
+		return model.Release{}, gorm.ErrInvalidDB
+	}
+	now := time.Now().UTC()
+	row.ID = 0
+	if row.CreatedAt.IsZero() {
+		row.CreatedAt = now
+	}
+	row.UpdatedAt = now
+	updates := map[string]any{"updated_at": now}
+	if row.Ref != "" {
+		updates["ref"] = row.Ref
+	}
+	if row.URL != "" {
+		updates["url"] = row.URL
+	}
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "version"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(&row).Error; err != nil {
+		return model.Release{}, err
+	}
+	saved, _, err := GetRelease(ctx, db, row.ProjectID, row.Version)
+	return saved, err
+}
+
+// EnsureReleasesFromEvents creates the releases events refer to that are not
+// registered yet, dated by their earliest event in rows.
+func EnsureReleasesFromEvents(ctx context.Context, db *gorm.DB, rows []model.Event) error {
+	if db == nil {
+		return gorm.ErrInvalidDB
+	}
+	type key struct {
+		projectID int
+		version   string
+	}
+	first := map[key]time.Time{}
+	var order []key
+	for _, r := range rows {
+		v := strings.TrimSpace(r.ReleaseTag)
+		if r.ProjectID <= 0 || v == "" {
+			continue
+		}
+		k := key{projectID: r.ProjectID, version: truncate(v, 100)}
+		ts, ok := first[k]
+		if !ok {
+			order = append(order, k)
+		}
+		if !ok || r.Timestamp.Before(ts) {
+			first[k] = r.Timestamp
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	releases := make([]model.Release, 0, len(order))
+	for _, k := range order {
+		releases = append(releases, model.Release{ProjectID: k.projectID, Version: k.version, CreatedAt: first[k].UTC(), UpdatedAt: now})
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&releases, 200).Error
+}
+
+func GetRelease(ctx context.Context, db *gorm.DB, projectID int, version string) (model.Release, bool, error) {
+	if db == nil {
+		return model.Release{}, false, gorm.ErrInvalidDB
+	}
+	return firstRelease(db.WithContext(ctx).Where("project_id = ? AND version = ?", projectID, version))
+}
+
+// ListReleases returns the project's releases, newest first.
+func ListReleases(ctx context.Context, db *gorm.DB, projectID, limit, offset int) ([]model.Release, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.Release
+	if err := db.WithContext(ctx).
+		Where("project_id = ?", projectID).
+		Order("created_at DESC").Order("id DESC").
+		Limit(limit).Offset(offset).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// AdjacentRelease returns the release created right before (or, with next,
+// right after) r.
+func AdjacentRelease(ctx context.Context, db *gorm.DB, r model.Release, next bool) (model.Release, bool, error) {
+	if db == nil {
+		return model.Release{}, false, gorm.ErrInvalidDB
+	}
+	q := db.WithContext(ctx).Where("project_id = ?", r.ProjectID)
+	if next {
+		q = q.Where("(created_at > ? OR (created_at = ? AND id > ?))", r.CreatedAt, r.CreatedAt, r.ID).
+			Order("created_at ASC").Order("id ASC")
+	} else {
+		q = q.Where("(created_at < ? OR (created_at = ? AND id < ?))", r.CreatedAt, r.CreatedAt, r.ID).
+			Order("created_at DESC").Order("id DESC")
+	}
+	return firstRelease(q)
+}
+
+func firstRelease(q *gorm.DB) (model.Release, bool, error) {
+	var row model.Release
+	if err := q.First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Release{}, false, nil
+		}
+		return model.Release{}, false, err
+	}
+	return row, true, nil
+}
+
+// CreateDeploy records a deploy of d.Version, registering the release when
+// CI deploys a version it did not register first.
+func CreateDeploy(ctx context.Context, db *gorm.DB, d model.Deploy) (model.Deploy, error) {
+	if db == nil || d.ProjectID <= 0 || d.Version == "" {
+		return model.Deploy{}, gorm.ErrInvalidDB
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rel, found, err := GetRelease(ctx, tx, d.ProjectID, d.Version)
+		if err != nil {
+			return err
+		}
+		if !found {
+			created := d.FinishedAt
+			if d.StartedAt != nil {
+				created = *d.StartedAt
+			}
+			if rel, err = UpsertRelease(ctx, tx, model.Release{ProjectID: d.ProjectID, Version: d.Version, CreatedAt: created}); err != nil {
+				return err
+			}
+		}
+		d.ID = 0
+		d.ReleaseID = rel.ID
+		return tx.Create(&d).Error
+	})
+	if err != nil {
+		return model.Deploy{}, err
+	}
+	return d, nil
+}
+
+// DeployFilter selects deploys; zero fields do not filter.
+type DeployFilter struct {
+	ReleaseIDs  []int64
+	Environment string
+	Start, End  time.Time
+	Limit       int
+}
+
+// ListDeploys returns deploys, most recently finished first.
+func ListDeploys(ctx context.Context, db *gorm.DB, projectID int, f DeployFilter) ([]model.Deploy, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	q := db.WithContext(ctx).Where("project_id = ?", projectID)
+	if len(f.ReleaseIDs) > 0 {
+		q = q.Where("release_id IN ?", f.ReleaseIDs)
+	}
+	if f.Environment != "" {
+		q = q.Where("environment = ?", f.Environment)
+	}
+	if !f.Start.IsZero() {
+		q = q.Where("finished_at >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		q = q.Where("finished_at <= ?", f.End)
+	}
+	if f.Limit > 0 {
+		q = q.Limit(f.Limit)
+	}
+	var rows []model.Deploy
+	if err := q.Order("finished_at DESC").Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ReleaseStats summarizes a release's events between Start and End.
+// ErrorRate is errors per hour, which keeps releases that were live for
+// different lengths of time comparable; NewIssues counts the issues the
+// release introduced.
+type ReleaseStats struct {
+	Version   string    `json:"version"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Events    int64     `json:"events"`
+	Errors    int64     `json:"errors"`
+	Users     int64     `json:"users"`
+	NewIssues int64     `json:"new_issues"`
+	ErrorRate float64   `json:"error_rate"`
+}
+
+// ReleaseWindow is when r was live in environment (any when empty): from its
+// first deploy there, or its creation without one, until another version was
+// deployed there (without an environment: until the next release went out),
+// or now.
+func ReleaseWindow(ctx context.Context, db *gorm.DB, r model.Release, environment string, now time.Time) (time.Time, time.Time, error) {
+	start, err := releaseStart(ctx, db, r, environment)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	var end time.Time
+	if environment != "" {
+		var replaced model.Deploy
+		err := db.WithContext(ctx).
+			Where("project_id = ? AND environment = ? AND release_id <> ? AND finished_at > ?", r.ProjectID, environment, r.ID, start).
+			Order("finished_at ASC").First(&replaced).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, time.Time{}, err
+		}
+		end = replaced.FinishedAt.UTC()
+	} else {
+		next, found, err := AdjacentRelease(ctx, db, r, true)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if found {
+			if end, err = releaseStart(ctx, db, next, ""); err != nil {
+				return time.Time{}, time.Time{}, err
+			}
+		}
+	}
+	if end.IsZero() || !end.After(start) || end.After(now) {
+		end = now
+	}
+	return start, end, nil
+}
+
+func releaseStart(ctx context.Context, db *gorm.DB, r model.Release, environment string) (time.Time, error) {
+	q := db.WithContext(ctx).Model(&model.Deploy{}).Where("project_id = ? AND release_id = ?", r.ProjectID, r.ID)
+	if environment != "" {
+		q = q.Where("environment = ?", environment)
+	}
+	var first model.Deploy
+	err := q.Order("finished_at ASC").First(&first).Error
+	switch {
+	case err == nil:
+		return first.FinishedAt.UTC(), nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return r.CreatedAt.UTC(), nil
+	default:
+		return time.Time{}, err
+	}
+}
+
+// GetReleaseStats counts the events of version in environment (any when
+// empty) within [start, end).
+func GetReleaseStats(ctx context.Context, db *gorm.DB, projectID int, version, environment string, start, end time.Time) (ReleaseStats, error) {
+	if db == nil {
+		return ReleaseStats{}, gorm.ErrInvalidDB
+	}
+	st := ReleaseStats{Version: version, Start: start, End: end}
+	q := db.WithContext(ctx).Model(&model.Event{}).
+		Select(`COUNT(1) AS events,
+			COALESCE(SUM(CASE WHEN LOWER(level) IN ('error', 'fatal') THEN 1 ELSE 0 END), 0) AS errors,
+			COUNT(DISTINCT COALESCE(NULLIF(user_id, ''), NULLIF(distinct_id, ''))) AS users`).
+		Where("project_id = ? AND release_tag = ? AND timestamp >= ? AND timestamp < ?", projectID, version, start, end)
+	if environment != "" {
+		q = q.Where("environment = ?", environment)
+	}
+	var counts struct {
+		Events int64 `gorm:"column:events"`
+		Errors int64 `gorm:"column:errors"`
+		Users  int64 `gorm:"column:users"`
+	}
+	if err := q.Scan(&counts).Error; err != nil {
+		return ReleaseStats{}, err
+	}
+	st.Events, st.Errors, st.Users = counts.Events, counts.Errors, counts.Users
+	if err := db.WithContext(ctx).Model(&model.Issue{}).
+		Where("project_id = ? AND first_release = ?", projectID, version).
+		Count(&st.NewIssues).Error; err != nil {
+		return ReleaseStats{}, err
+	}
+	hours := end.Sub(start).Hours()
+	if hours < 1.0/60 {
+		hours = 1.0 / 60
+	}
+	st.ErrorRate = float64(st.Errors) / hours
+	return st, nil
+}
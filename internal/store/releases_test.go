@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+)
+
+func TestReleasesAndDeploys(t *testing.T) {
+	t.Parallel()
+
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&model.Issue{}, &model.IssueUser{}, &model.IssueActivity{}, &model.Release{}, &model.Deploy{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	ctx := context.Background()
+	ts := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mk := func(msg, release, level string, at time.Time) model.Event {
+		row, err := EventRowFromMap("1", map[string]any{
+			"message":     msg,
+			"level":       level,
+			"release":     release,
+			"environment": "production",
+			"timestamp":   at.Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			t.Fatalf("EventRowFromMap: %v", err)
+		}
+		return row
+	}
+	events := []model.Event{
+		mk("timeout", "app@1.0", "error", ts.Add(time.Hour)),
+		mk("timeout", "app@1.0", "info", ts.Add(2*time.Hour)),
+		mk("timeout", "app@2.0", "error", ts.Add(11*time.Hour)),
+		mk("disk full", "app@2.0", "fatal", ts.Add(12*time.Hour)),
+		mk("disk full", "app@2.0", "error", ts.Add(13*time.Hour)),
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+	if err := EnsureReleasesFromEvents(ctx, db, events); err != nil {
+		t.Fatalf("EnsureReleasesFromEvents: %v", err)
+	}
+	if _, err := UpsertIssuesFromEvents(ctx, db, events); err != nil {
+		t.Fatalf("UpsertIssuesFromEvents: %v", err)
+	}
+
+	// CI registers v1 explicitly; the auto-created row keeps its date.
+	v1, err := UpsertRelease(ctx, db, model.Release{ProjectID: 1, Version: "app@1.0", Ref: "abc123"})
+	if err != nil || v1.Ref != "abc123" || !v1.CreatedAt.Equal(ts.Add(time.Hour)) {
+		t.Fatalf("UpsertRelease = %+v err=%v", v1, err)
+	}
+	// v2 was deployed before its first event; v3 is deployed without being
+	// registered first.
+	if _, err := CreateDeploy(ctx, db, model.Deploy{ProjectID: 1, Version: "app@2.0", Environment: "production", FinishedAt: ts.Add(10 * time.Hour)}); err != nil {
+		t.Fatalf("CreateDeploy: %v", err)
+	}
+	if _, err := CreateDeploy(ctx, db, model.Deploy{ProjectID: 1, Version: "app@3.0", Environment: "staging", FinishedAt: ts.Add(20 * time.Hour)}); err != nil {
+		t.Fatalf("CreateDeploy: %v", err)
+	}
+
+	releases, err := ListReleases(ctx, db, 1, 10, 0)
+	if err != nil || len(releases) != 3 || releases[0].Version != "app@3.0" || releases[2].Version != "app@1.0" {
+		t.Fatalf("ListReleases = %+v err=%v", releases, err)
+	}
+	v2 := releases[1]
+	prev, found, err := AdjacentRelease(ctx, db, v2, false)
+	if err != nil || !found || prev.Version != "app@1.0" {
+		t.Fatalf("previous release = %+v found=%v err=%v", prev, found, err)
+	}
+
+	now := ts.Add(30 * time.Hour)
+	start, end, err := ReleaseWindow(ctx, db, v2, "production", now)
+	if err != nil || !start.Equal(ts.Add(10*time.Hour)) || !end.Equal(now) {
+		t.Fatalf("production window = %v..%v err=%v", start, end, err)
+	}
+	// Without an environment v3's staging deploy ends v2's window.
+	if _, end, _ := ReleaseWindow(ctx, db, v2, "", now); !end.Equal(ts.Add(20 * time.Hour)) {
+		t.Fatalf("window end = %v", end)
+	}
+	stats, err := GetReleaseStats(ctx, db, 1, "app@2.0", "production", start, end)
+	if err != nil {
+		t.Fatalf("GetReleaseStats: %v", err)
+	}
+	if stats.Events != 3 || stats.Errors != 3 || stats.NewIssues != 1 || stats.ErrorRate != 3.0/20 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	start, end, _ = ReleaseWindow(ctx, db, v1, "production", now)
+	if !start.Equal(ts.Add(time.Hour)) || !end.Equal(ts.Add(10*time.Hour)) {
+		t.Fatalf("v1 window = %v..%v", start, end)
+	}
+	if stats, _ := GetReleaseStats(ctx, db, 1, "app@1.0", "production", start, end); stats.Events != 2 || stats.Errors != 1 || stats.NewIssues != 1 {
+		t.Fatalf("unexpected v1 stats %+v", stats)
+	}
+
+	deploys, err := ListDeploys(ctx, db, 1, DeployFilter{Start: ts, End: ts.Add(15 * time.Hour)})
+	if err != nil || len(deploys) != 1 || deploys[0].Version != "app@2.0" || deploys[0].ReleaseID != v2.ID {
+		t.Fatalf("ListDeploys = %+v err=%v", deploys, err)
+	}
+	issues, err := ListIssues(ctx, db, 1, IssueFilter{FirstRelease: "app@2.0", Limit: 10})
+	if err != nil || len(issues) != 1 || issues[0].Title != "disk full" {
+		t.Fatalf("issues first seen in app@2.0 = %+v err=%v", issues, err)
+	}
+}
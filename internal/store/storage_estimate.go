@@ -8,22 +8,42 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/retention"
 	"gorm.io/gorm"
 )
 
+// StorageEstimateTable sizes one table of a project. ExpiredCount rows are
+// past the project's retention (rules included) and go on the next cleanup;
+// RetainedEstBytes is what stays.
 type StorageEstimateTable struct {
-	Count       int64 `json:"count"`
-	SampleSize  int   `json:"sample_size"`
-	AvgRowBytes int64 `json:"avg_row_bytes"`
-	EstBytes    int64 `json:"est_bytes"`
+	Count            int64 `json:"count"`
+	SampleSize       int   `json:"sample_size"`
+	AvgRowBytes      int64 `json:"avg_row_bytes"`
+	EstBytes         int64 `json:"est_bytes"`
+	ExpiredCount     int64 `json:"expired_count"`
+	RetainedEstBytes int64 `json:"retained_est_bytes"`
+}
+
+// StorageCompression is the table-wide (all projects) TimescaleDB columnstore
+// footprint: size before and after compression of the compressed chunks.
+type StorageCompression struct {
+	TotalChunks       int64   `json:"total_chunks"`
+	CompressedChunks  int64   `json:"compressed_chunks"`
+	UncompressedBytes int64   `json:"uncompressed_bytes"`
+	CompressedBytes   int64   `json:"compressed_bytes"`
+	Ratio             float64 `json:"ratio"`
 }
 
 type StorageEstimate struct {
-	ProjectID   int                  `json:"project_id"`
-	Logs        StorageEstimateTable `json:"logs"`
-	Events      StorageEstimateTable `json:"events"`
-	TotalBytes  int64                `json:"total_bytes"`
-	EstimatedAt time.Time            `json:"estimated_at"`
+	ProjectID          int                  `json:"project_id"`
+	Logs               StorageEstimateTable `json:"logs"`
+	Events             StorageEstimateTable `json:"events"`
+	TotalBytes         int64                `json:"total_bytes"`
+	RetainedTotalBytes int64                `json:"retained_total_bytes"`
+	EstimatedAt        time.Time            `json:"estimated_at"`
+	// Compression is keyed by table and only set on TimescaleDB installs.
+	Compression map[string]StorageCompression `json:"compression,omitempty"`
 }
 
 func EstimateProjectStorage(ctx context.Context, db *gorm.DB, projectID int, sampleSize int) (StorageEstimate, error) {
@@ -60,6 +80,22 @@ func EstimateProjectStorage(ctx context.Context, db *gorm.DB, projectID int, sam
 	logsEst := safeMul(logsCount, logsAvg)
 	eventsEst := safeMul(eventsCount, eventsAvg)
 
+	var logsExpired, eventsExpired int64
+	policy, ok, err := GetCleanupPolicy(ctx, db, projectID)
+	if err != nil {
+		return StorageEstimate{}, err
+	}
+	if ok && policy.Enabled {
+		if logsExpired, err = countExpired(ctx, db, policy, retention.TableLogs, now); err != nil {
+			return StorageEstimate{}, err
+		}
+		if eventsExpired, err = countExpired(ctx, db, policy, retention.TableEvents, now); err != nil {
+			return StorageEstimate{}, err
+		}
+	}
+	logsRetained := safeMul(logsCount-logsExpired, logsAvg)
+	eventsRetained := safeMul(eventsCount-eventsExpired, eventsAvg)
+
 	return StorageEstimate{
 		ProjectID: projectID,
 		Logs: StorageEstimateTable{
@@ -67,18 +103,40 @@ func EstimateProjectStorage(ctx context.Context, db *gorm.DB, projectID int, sam
 			SampleSize:  logsSample,
 			AvgRowBytes: logsAvg,
 			EstBytes:    logsEst,
+
+			ExpiredCount:     logsExpired,
+			RetainedEstBytes: logsRetained,
 		},
 		Events: StorageEstimateTable{
 			Count:       eventsCount,
 			SampleSize:  eventsSample,
 			AvgRowBytes: eventsAvg,
 			EstBytes:    eventsEst,
+
+			ExpiredCount:     eventsExpired,
+			RetainedEstBytes: eventsRetained,
 		},
-		TotalBytes:  logsEst + eventsEst,
-		EstimatedAt: now,
+		TotalBytes:         logsEst + eventsEst,
+		RetainedTotalBytes: logsRetained + eventsRetained,
+		EstimatedAt:        now,
 	}, nil
 }
 
+// countExpired counts rows of table the policy's retention buckets expire.
+func countExpired(ctx context.Context, db *gorm.DB, policy model.CleanupPolicy, table string, now time.Time) (int64, error) {
+	buckets, err := retention.Buckets(db, policy, table, now)
+	if err != nil || len(buckets) == 0 {
+		return 0, err
+	}
+	expired, args := retention.Expired(buckets)
+	var out int64
+	err = db.WithContext(ctx).Table(table).
+		Where("project_id = ?", policy.ProjectID).
+		Where(expired, args...).
+		Count(&out).Error
+	return out, err
+}
+
 func countByProject(ctx context.Context, db *gorm.DB, table string, projectID int) (int64, error) {
 	var out int64
 	err := db.WithContext(ctx).Raw(
@@ -79,6 +79,17 @@ func TestUsersCRUD(t *testing.T) {
 	if _, ok, err := GetUserByEmail(ctx, db, "missing@x"); err != nil || ok {
 		t.Fatalf("expected missing user to be (ok=false, err=nil), got ok=%v err=%v", ok, err)
 	}
+
+	uid2, err := CreateUser(ctx, db, "c@d.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if admin, err := IsAdminUser(ctx, db, uid); err != nil || !admin {
+		t.Fatalf("expected bootstrap user to be admin, got %v err=%v", admin, err)
+	}
+	if admin, err := IsAdminUser(ctx, db, uid2); err != nil || admin {
+		t.Fatalf("expected second user not to be admin, got %v err=%v", admin, err)
+	}
 }
 
 func TestProjectsAndKeys(t *testing.T) {
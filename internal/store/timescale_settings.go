@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const timescaleSettingsID = 1
+
+// GetTimescaleSettings returns the stored policy settings; ok=false when none were saved yet.
+func GetTimescaleSettings(ctx context.Context, db *gorm.DB) (model.TimescaleSettings, bool, error) {
+	if db == nil {
+		return model.TimescaleSettings{}, false, gorm.ErrInvalidDB
+	}
+	var row model.TimescaleSettings
+	err := db.WithContext(ctx).Where("id = ?", timescaleSettingsID).First(&row).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.TimescaleSettings{}, false, nil
+		}
+		return model.TimescaleSettings{}, false, err
+	}
+	return row, true, nil
+}
+
+func UpsertTimescaleSettings(ctx context.Context, db *gorm.DB, row model.TimescaleSettings) (model.TimescaleSettings, error) {
+	if db == nil {
+		return model.TimescaleSettings{}, gorm.ErrInvalidDB
+	}
+	if row.CompressAfterDays < 0 {
+		row.CompressAfterDays = 0
+	}
+	row.ID = timescaleSettingsID
+	row.UpdatedAt = time.Now().UTC()
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		UpdateAll: true,
+	}).Create(&row).Error; err != nil {
+		return model.TimescaleSettings{}, err
+	}
+	return row, nil
+}
+
+// EnsureTimescaleSettings seeds the settings row with defaults when it does
+// not exist and returns the effective settings.
+func EnsureTimescaleSettings(ctx context.Context, db *gorm.DB, defaults model.TimescaleSettings) (model.TimescaleSettings, error) {
+	row, ok, err := GetTimescaleSettings(ctx, db)
+	if err != nil {
+		return model.TimescaleSettings{}, err
+	}
+	if ok {
+		return row, nil
+	}
+	return UpsertTimescaleSettings(ctx, db, defaults)
+}
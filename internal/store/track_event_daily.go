@@ -70,7 +70,10 @@ func UpsertTrackEventDailyBatch(ctx context.Context, db *gorm.DB, rows []model.T
 		CreateInBatches(&rows, 200).Error
 }
 
-func PruneAndRebuildTrackEventDailyForRetention(ctx context.Context, db *gorm.DB, projectID int, before time.Time) error {
+// PruneAndRebuildTrackEventDailyForRetention brings the rollup in line with
+// track_events after a retention delete. where restricts it to the rows of one
+// retention bucket (it may only reference name, which both tables share).
+func PruneAndRebuildTrackEventDailyForRetention(ctx context.Context, db *gorm.DB, projectID int, before time.Time, where string, args []any) error {
 	if db == nil || projectID <= 0 {
 		return gorm.ErrInvalidData
 	}
@@ -83,20 +86,27 @@ func PruneAndRebuildTrackEventDailyForRetention(ctx context.Context, db *gorm.DB
 	dayStart := time.Date(before.Year(), before.Month(), before.Day(), 0, 0, 0, 0, time.UTC)
 	dayEnd := dayStart.Add(24 * time.Hour)
 	now := time.Now().UTC()
+	match := ""
+	if where != "" {
+		match = " AND (" + where + ")"
+	}
+	withArgs := func(head ...any) []any {
+		return append(head, args...)
+	}
 
 	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Prune fully expired days.
 		if err := tx.Exec(
-			`DELETE FROM track_event_daily WHERE project_id = ? AND day < ?`,
-			projectID, cutoffDay,
+			`DELETE FROM track_event_daily WHERE project_id = ? AND day < ?`+match,
+			withArgs(projectID, cutoffDay)...,
 		).Error; err != nil {
 			return err
 		}
 
 		// Rebuild the cutoff day (retention cutoff is time-of-day, so this day can be partial).
 		if err := tx.Exec(
-			`DELETE FROM track_event_daily WHERE project_id = ? AND day = ?`,
-			projectID, cutoffDay,
+			`DELETE FROM track_event_daily WHERE project_id = ? AND day = ?`+match,
+			withArgs(projectID, cutoffDay)...,
 		).Error; err != nil {
 			return err
 		}
@@ -113,8 +123,8 @@ func PruneAndRebuildTrackEventDailyForRetention(ctx context.Context, db *gorm.DB
 				?,
 				?
 			FROM track_events
-			WHERE project_id = ? AND timestamp >= ? AND timestamp < ?
+			WHERE project_id = ? AND timestamp >= ? AND timestamp < ?`+match+`
 			GROUP BY project_id, name, distinct_id
-		`, cutoffDay, now, now, projectID, dayStart, dayEnd).Error
+		`, withArgs(cutoffDay, now, now, projectID, dayStart, dayEnd)...).Error
 	})
 }
@@ -97,7 +97,7 @@ func TestPruneAndRebuildTrackEventDailyForRetention_PrunedAndRebuilt(t *testing.
 	}
 
 	before := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
-	if err := PruneAndRebuildTrackEventDailyForRetention(ctx, db, 1, before); err != nil {
+	if err := PruneAndRebuildTrackEventDailyForRetention(ctx, db, 1, before, "", nil); err != nil {
 		t.Fatalf("PruneAndRebuildTrackEventDailyForRetention: %v", err)
 	}
 
@@ -3,16 +3,69 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aak1247/logtap/internal/model"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// trackEventsPartitioned caches, per database, whether track_events is range
+// partitioned (PG_PARTITIONING). Its dedupe index then has to include the
+// partition key, (project_id, ingest_id, timestamp), so inserts cannot name
+// (project_id, ingest_id) as their conflict target; a redelivery is only
+// recognised when it carries the same timestamp, which it does when it is
+// the same queued message.
+var trackEventsPartitioned sync.Map
+
+func isTrackEventsPartitioned(ctx context.Context, db *gorm.DB) (bool, error) {
+	if !strings.EqualFold(db.Dialector.Name(), "postgres") {
+		return false, nil
+	}
+	if v, ok := trackEventsPartitioned.Load(db.Config); ok {
+		return v.(bool), nil
+	}
+	var partitioned bool
+	if err := db.WithContext(ctx).Raw(
+		`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass('track_events'))`,
+	).Scan(&partitioned).Error; err != nil {
+		return false, err
+	}
+	trackEventsPartitioned.Store(db.Config, partitioned)
+	return partitioned, nil
+}
+
+// trackEventsDedupe is the conflict clause that skips track events already
+// stored: targeted at the dedupe key, so other unique violations still fail,
+// except on partitioned tables (see trackEventsPartitioned).
+func trackEventsDedupe(ctx context.Context, db *gorm.DB) (clause.OnConflict, error) {
+	partitioned, err := isTrackEventsPartitioned(ctx, db)
+	if err != nil || partitioned {
+		return clause.OnConflict{DoNothing: true}, err
+	}
+	return clause.OnConflict{
+		Columns:   []clause.Column{{Name: "project_id"}, {Name: "ingest_id"}},
+		DoNothing: true,
+	}, nil
+}
+
+// forgetIfRepartitioned drops the cached lookup when an insert failed because
+// no unique index matches its conflict target: another process partitioned
+// track_events since. The redelivered batch then uses the new target.
+func forgetIfRepartitioned(db *gorm.DB, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P10" {
+		trackEventsPartitioned.Delete(db.Config)
+	}
+	return err
+}
+
 func TrackEventRowsFromLogs(logs []model.Log) []model.TrackEvent {
 	if len(logs) == 0 {
 		return nil
@@ -46,9 +99,13 @@ func InsertTrackEventsBatch(ctx context.Context, db *gorm.DB, rows []model.Track
 	if db == nil || len(rows) == 0 {
 		return nil
 	}
-	return db.WithContext(ctx).
-		Clauses(clause.OnConflict{DoNothing: true}).
-		CreateInBatches(&rows, 200).Error
+	dedupe, err := trackEventsDedupe(ctx, db)
+	if err != nil {
+		return err
+	}
+	return forgetIfRepartitioned(db, db.WithContext(ctx).
+		Clauses(dedupe).
+		CreateInBatches(&rows, 200).Error)
 }
 
 func InsertTrackEventsAndRollupBatch(ctx context.Context, db *gorm.DB, rows []model.TrackEvent) error {
@@ -115,7 +172,15 @@ func insertTrackEventsAndRollupPostgres(ctx context.Context, db *gorm.DB, rows [
 	}
 	// Insert track_events with idempotency, and roll up only the rows that were actually inserted.
 	// This keeps rollups exact under retries/concurrency (at-least-once delivery).
-	return db.WithContext(ctx).Exec(`
+	partitioned, err := isTrackEventsPartitioned(ctx, db)
+	if err != nil {
+		return err
+	}
+	onConflict := "ON CONFLICT (project_id, ingest_id) DO NOTHING"
+	if partitioned {
+		onConflict = "ON CONFLICT DO NOTHING"
+	}
+	return forgetIfRepartitioned(db, db.WithContext(ctx).Exec(fmt.Sprintf(`
 		WITH input AS (
 			SELECT *
 			FROM jsonb_to_recordset(?::jsonb)
@@ -132,7 +197,7 @@ func insertTrackEventsAndRollupPostgres(ctx context.Context, db *gorm.DB, rows [
 			INSERT INTO track_events (project_id, timestamp, ingest_id, name, distinct_id, device_id)
 			SELECT project_id, timestamp, ingest_id, name, distinct_id, device_id
 			FROM input
-			ON CONFLICT (project_id, ingest_id) DO NOTHING
+			%s
 			RETURNING project_id, timestamp, name, distinct_id
 		),
 		agg AS (
@@ -151,7 +216,7 @@ func insertTrackEventsAndRollupPostgres(ctx context.Context, db *gorm.DB, rows [
 		ON CONFLICT (project_id, day, name, distinct_id) DO UPDATE
 		SET events = track_event_daily.events + EXCLUDED.events,
 		    updated_at = NOW()
-	`, string(b)).Error
+	`, onConflict), string(b)).Error)
 }
 
 func insertTrackEventsAndRollupBestEffort(ctx context.Context, db *gorm.DB, rows []model.TrackEvent) error {
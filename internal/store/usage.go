@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageRowsFromLogs aggregates rows into per-project, per-day usage. Bytes
+// are the stored payload (message and fields), matching the storage estimate.
+func UsageRowsFromLogs(rows []model.Log) []model.ProjectUsageDaily {
+	return aggregateUsage(len(rows), func(add func(projectID int, u model.ProjectUsageDaily)) {
+		for _, r := range rows {
+			add(r.ProjectID, model.ProjectUsageDaily{Logs: 1, LogBytes: int64(len(r.Message) + len(r.Fields))})
+		}
+	})
+}
+
+// UsageRowsFromEvents aggregates event rows like UsageRowsFromLogs; bytes are
+// the stored event payload.
+func UsageRowsFromEvents(rows []model.Event) []model.ProjectUsageDaily {
+	return aggregateUsage(len(rows), func(add func(projectID int, u model.ProjectUsageDaily)) {
+		for _, r := range rows {
+			add(r.ProjectID, model.ProjectUsageDaily{Events: 1, EventBytes: int64(len(r.Data))})
+		}
+	})
+}
+
+// aggregateUsage buckets by the UTC day the rows are flushed, not their
+// timestamps: quotas limit what a project sends per day, and late or
+// backdated rows still cost space today.
+func aggregateUsage(n int, each func(add func(projectID int, u model.ProjectUsageDaily))) []model.ProjectUsageDaily {
+	if n == 0 {
+		return nil
+	}
+	type key struct {
+		projectID int
+		day       string
+	}
+	day := time.Now().UTC().Format("2006-01-02")
+	agg := map[key]*model.ProjectUsageDaily{}
+	var order []key
+	each(func(projectID int, u model.ProjectUsageDaily) {
+		if projectID <= 0 {
+			return
+		}
+		k := key{projectID: projectID, day: day}
+		cur, ok := agg[k]
+		if !ok {
+			cur = &model.ProjectUsageDaily{ProjectID: projectID, Day: day}
+			agg[k] = cur
+			order = append(order, k)
+		}
+		cur.Logs += u.Logs
+		cur.LogBytes += u.LogBytes
+		cur.Events += u.Events
+		cur.EventBytes += u.EventBytes
+	})
+	out := make([]model.ProjectUsageDaily, 0, len(order))
+	for _, k := range order {
+		out = append(out, *agg[k])
+	}
+	return out
+}
+
+func UpsertProjectUsageDailyBatch(ctx context.Context, db *gorm.DB, rows []model.ProjectUsageDaily) error {
+	if db == nil || len(rows) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	return db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "project_id"}, {Name: "day"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"logs":         gorm.Expr("project_usage_daily.logs + EXCLUDED.logs"),
+				"log_bytes":    gorm.Expr("project_usage_daily.log_bytes + EXCLUDED.log_bytes"),
+				"events":       gorm.Expr("project_usage_daily.events + EXCLUDED.events"),
+				"event_bytes":  gorm.Expr("project_usage_daily.event_bytes + EXCLUDED.event_bytes"),
+				"dropped":      gorm.Expr("project_usage_daily.dropped + EXCLUDED.dropped"),
+				"export_bytes": gorm.Expr("project_usage_daily.export_bytes + EXCLUDED.export_bytes"),
+				"updated_at":   now,
+			}),
+		}).
+		CreateInBatches(&rows, 200).Error
+}
+
+// GetProjectUsageDay returns the usage of one day; a day without ingest is
+// all zeros.
+func GetProjectUsageDay(ctx context.Context, db *gorm.DB, projectID int, day string) (model.ProjectUsageDaily, error) {
+	if db == nil {
+		return model.ProjectUsageDaily{}, gorm.ErrInvalidDB
+	}
+	var rows []model.ProjectUsageDaily
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND day = ?", projectID, day).
+		Limit(1).
+		Find(&rows).Error; err != nil {
+		return model.ProjectUsageDaily{}, err
+	}
+	if len(rows) == 0 {
+		return model.ProjectUsageDaily{ProjectID: projectID, Day: day}, nil
+	}
+	return rows[0], nil
+}
+
+// ListProjectUsageDaily returns usage from fromDay (YYYY-MM-DD) on, oldest
+// first.
+func ListProjectUsageDaily(ctx context.Context, db *gorm.DB, projectID int, fromDay string) ([]model.ProjectUsageDaily, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	var rows []model.ProjectUsageDaily
+	if err := db.WithContext(ctx).
+		Where("project_id = ? AND day >= ?", projectID, fromDay).
+		Order("day ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
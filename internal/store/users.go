@@ -66,3 +66,16 @@ func GetUserByID(ctx context.Context, db *gorm.DB, id int64) (UserRow, bool, err
 	}
 	return UserRow{ID: u.ID, Email: u.Email, PasswordHash: u.PasswordHash}, true, nil
 }
+
+// IsAdminUser reports whether uid is the instance admin, i.e. the account
+// created by /api/auth/bootstrap (the first user).
+func IsAdminUser(ctx context.Context, db *gorm.DB, uid int64) (bool, error) {
+	if db == nil || uid <= 0 {
+		return false, nil
+	}
+	var first int64
+	if err := db.WithContext(ctx).Model(&model.User{}).Select("COALESCE(MIN(id), 0)").Scan(&first).Error; err != nil {
+		return false, err
+	}
+	return first == uid, nil
+}
@@ -0,0 +1,101 @@
+package tail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aak1247/logtap/internal/project"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	statsInterval     = time.Second
+	heartbeatInterval = 15 * time.Second
+)
+
+// Handler streams the project's new logs matching q as Server-Sent Events:
+//
+//	event: log     one log (an Entry)
+//	event: stats   {"matched","sent","dropped","rate"}, every second while logs are dropped
+//
+// rate lowers the stream's cap below the hub's MaxRate. A comment line is
+// sent every 15s to keep proxies from closing an idle stream.
+func Handler(hub *Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, err := project.ParseID(c.Param("projectId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		parsed, err := search.NewQueryParser().Parse(c.Query("q"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rate, _ := strconv.Atoi(c.Query("rate"))
+
+		ctx := c.Request.Context()
+		sub, err := hub.Subscribe(ctx, projectID, parsed.Root, rate)
+		switch {
+		case errors.Is(err, search.ErrInvalidQuery):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ErrTooManyStreams):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		defer sub.Close()
+
+		w := c.Writer
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		w.Flush()
+
+		stats := time.NewTicker(statsInterval)
+		defer stats.Stop()
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		var reported int64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-sub.C():
+				writeEvent(w, "log", e)
+				// Drain what is already queued before flushing.
+				for n := len(sub.C()); n > 0; n-- {
+					writeEvent(w, "log", <-sub.C())
+				}
+				w.Flush()
+			case <-stats.C:
+				matched, sent, dropped := sub.Counts()
+				if dropped == reported {
+					continue
+				}
+				reported = dropped
+				writeEvent(w, "stats", gin.H{"matched": matched, "sent": sent, "dropped": dropped, "rate": sub.Rate})
+				w.Flush()
+			case <-heartbeat.C:
+				fmt.Fprintf(w, ": ping\n\n")
+				w.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(w gin.ResponseWriter, event string, v any) {
+	b, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
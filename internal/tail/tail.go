@@ -0,0 +1,352 @@
+// Package tail streams newly stored logs to live tails. The consumer
+// publishes each flushed batch to a Hub; the Hub fans it out to the
+// subscriptions of the log's project, in process or, when several gateways
+// run, through Redis pub/sub.
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrTooManyStreams = errors.New("tail: too many streams for this project")
+
+// Entry is a log as streamed to a tail.
+type Entry struct {
+	ID         int64           `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Level      string          `json:"level,omitempty"`
+	Message    string          `json:"message"`
+	TraceID    string          `json:"trace_id,omitempty"`
+	SpanID     string          `json:"span_id,omitempty"`
+	DistinctID string          `json:"distinct_id,omitempty"`
+	DeviceID   string          `json:"device_id,omitempty"`
+	PatternID  string          `json:"pattern_id,omitempty"`
+	Fields     json.RawMessage `json:"fields,omitempty"`
+
+	fields map[string]any // Fields decoded, for matching
+}
+
+// EntryFromLog converts a stored log.
+func EntryFromLog(l model.Log) Entry {
+	return Entry{
+		ID:         l.ID,
+		Timestamp:  l.Timestamp,
+		Level:      l.Level,
+		Message:    l.Message,
+		TraceID:    l.TraceID,
+		SpanID:     l.SpanID,
+		DistinctID: l.DistinctID,
+		DeviceID:   l.DeviceID,
+		PatternID:  l.PatternID,
+		Fields:     json.RawMessage(l.Fields),
+	}
+}
+
+// doc adapts an entry to search.Doc with the field names of log search.
+type doc struct{ e *Entry }
+
+func (d doc) Text() string { return d.e.Message }
+
+func (d doc) Field(name string) (any, bool) {
+	switch strings.ToLower(name) {
+	case "level":
+		return d.e.Level, true
+	case "message":
+		return d.e.Message, true
+	case "trace_id", "traceid":
+		return d.e.TraceID, true
+	case "span_id", "spanid":
+		return d.e.SpanID, true
+	case "distinct_id":
+		return d.e.DistinctID, true
+	case "device_id":
+		return d.e.DeviceID, true
+	case "pattern_id":
+		return d.e.PatternID, true
+	case "timestamp", "@timestamp":
+		return d.e.Timestamp, true
+	}
+	if d.e.fields == nil {
+		d.e.fields = map[string]any{}
+		_ = json.Unmarshal(d.e.Fields, &d.e.fields)
+	}
+	var cur any = d.e.fields
+	for _, p := range strings.Split(strings.TrimPrefix(name, "fields."), ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+// Subscription receives the logs of one project that match its query, at
+// most Rate per second; the others are counted as dropped.
+type Subscription struct {
+	ProjectID int
+	Rate      int
+
+	hub     *Hub
+	matcher *search.Matcher
+	ch      chan Entry
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	matched atomic.Int64
+	sent    atomic.Int64
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+// C delivers the matching logs.
+func (s *Subscription) C() <-chan Entry { return s.ch }
+
+// Counts returns how many logs matched, were sent and were dropped so far.
+func (s *Subscription) Counts() (matched, sent, dropped int64) {
+	return s.matched.Load(), s.sent.Load(), s.dropped.Load()
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() { s.hub.remove(s) })
+}
+
+// offer hands e to the subscriber unless the rate cap is reached or the
+// subscriber is behind.
+func (s *Subscription) offer(e Entry) {
+	s.matched.Add(1)
+	s.mu.Lock()
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * float64(s.Rate)
+	if s.tokens > float64(s.Rate) {
+		s.tokens = float64(s.Rate)
+	}
+	s.last = now
+	ok := s.tokens >= 1
+	if ok {
+		s.tokens--
+	}
+	s.mu.Unlock()
+	if ok {
+		select {
+		case s.ch <- e:
+			s.sent.Add(1)
+			return
+		default:
+		}
+	}
+	s.dropped.Add(1)
+}
+
+// Hub fans logs out to subscriptions. Without Redis it delivers in process;
+// with Redis every publish goes through a channel per project that the
+// gateways with subscribers of that project listen to.
+type Hub struct {
+	MaxStreams int // per project; 0 is unlimited
+	MaxRate    int // logs per second per subscription
+
+	mu   sync.Mutex
+	subs map[int]map[*Subscription]struct{}
+
+	rdb       *redis.Client
+	ps        *redis.PubSub
+	listeners sync.Map // project id -> listenerCount
+}
+
+type listenerCount struct {
+	n  int64
+	at time.Time
+}
+
+const (
+	channelPrefix = "logtap:tail:"
+	// listenerTTL bounds how long a gateway keeps publishing to a project
+	// nobody tails any more, and how late a new tail gets its first logs.
+	listenerTTL = time.Second
+	redisOpTTL  = 2 * time.Second
+)
+
+// NewHub returns an in-process hub.
+func NewHub() *Hub {
+	return &Hub{MaxStreams: 20, MaxRate: 100, subs: map[int]map[*Subscription]struct{}{}}
+}
+
+// NewRedisHub returns a hub that fans out through Redis until ctx is done.
+func NewRedisHub(ctx context.Context, rdb *redis.Client) *Hub {
+	h := NewHub()
+	h.rdb = rdb
+	h.ps = rdb.Subscribe(ctx)
+	go h.receive(ctx)
+	return h
+}
+
+func channelName(projectID int) string { return channelPrefix + strconv.Itoa(projectID) }
+
+func (h *Hub) receive(ctx context.Context) {
+	ch := h.ps.Channel()
+	defer h.ps.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			projectID, err := strconv.Atoi(strings.TrimPrefix(msg.Channel, channelPrefix))
+			if err != nil {
+				continue
+			}
+			var entries []Entry
+			if err := json.Unmarshal([]byte(msg.Payload), &entries); err != nil {
+				continue
+			}
+			h.deliver(projectID, entries)
+		}
+	}
+}
+
+// Subscribe starts a subscription to the logs of projectID matching
+// query, capped at rate logs per second (MaxRate when rate is 0 or above
+// it).
+func (h *Hub) Subscribe(ctx context.Context, projectID int, query search.Node, rate int) (*Subscription, error) {
+	matcher, err := search.NewMatcher(query, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if rate <= 0 || rate > h.MaxRate {
+		rate = h.MaxRate
+	}
+	s := &Subscription{
+		ProjectID: projectID,
+		Rate:      rate,
+		hub:       h,
+		matcher:   matcher,
+		ch:        make(chan Entry, max(rate, 64)),
+		tokens:    float64(rate),
+		last:      time.Now(),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[projectID]
+	if h.MaxStreams > 0 && len(subs) >= h.MaxStreams {
+		return nil, ErrTooManyStreams
+	}
+	if len(subs) == 0 && h.ps != nil {
+		rctx, cancel := context.WithTimeout(ctx, redisOpTTL)
+		err := h.ps.Subscribe(rctx, channelName(projectID))
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if subs == nil {
+		subs = map[*Subscription]struct{}{}
+		h.subs[projectID] = subs
+	}
+	subs[s] = struct{}{}
+	return s, nil
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[s.ProjectID]
+	delete(subs, s)
+	if len(subs) > 0 {
+		return
+	}
+	delete(h.subs, s.ProjectID)
+	if h.ps != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), redisOpTTL)
+		if err := h.ps.Unsubscribe(ctx, channelName(s.ProjectID)); err != nil {
+			log.Printf("tail: unsubscribe project %d: %v", s.ProjectID, err)
+		}
+		cancel()
+	}
+}
+
+// Publish streams freshly stored logs to the tails of their projects. It
+// never blocks on slow subscribers.
+func (h *Hub) Publish(ctx context.Context, logs []model.Log) {
+	if h == nil || len(logs) == 0 {
+		return
+	}
+	byProject := map[int][]Entry{}
+	for _, l := range logs {
+		byProject[l.ProjectID] = append(byProject[l.ProjectID], EntryFromLog(l))
+	}
+	for projectID, entries := range byProject {
+		if h.rdb == nil {
+			h.deliver(projectID, entries)
+			continue
+		}
+		if !h.hasListeners(ctx, projectID) {
+			continue
+		}
+		payload, err := json.Marshal(entries)
+		if err != nil {
+			continue
+		}
+		rctx, cancel := context.WithTimeout(ctx, redisOpTTL)
+		if err := h.rdb.Publish(rctx, channelName(projectID), payload).Err(); err != nil {
+			log.Printf("tail: publish project %d: %v", projectID, err)
+		}
+		cancel()
+	}
+}
+
+// hasListeners reports whether any gateway tails projectID, caching the
+// answer for listenerTTL so that untailed projects cost no publishes.
+func (h *Hub) hasListeners(ctx context.Context, projectID int) bool {
+	if v, ok := h.listeners.Load(projectID); ok {
+		if lc := v.(listenerCount); time.Since(lc.at) < listenerTTL {
+			return lc.n > 0
+		}
+	}
+	rctx, cancel := context.WithTimeout(ctx, redisOpTTL)
+	defer cancel()
+	name := channelName(projectID)
+	counts, err := h.rdb.PubSubNumSub(rctx, name).Result()
+	if err != nil {
+		return true // publish rather than lose logs
+	}
+	h.listeners.Store(projectID, listenerCount{n: counts[name], at: time.Now()})
+	return counts[name] > 0
+}
+
+func (h *Hub) deliver(projectID int, entries []Entry) {
+	h.mu.Lock()
+	subs := make([]*Subscription, 0, len(h.subs[projectID]))
+	for s := range h.subs[projectID] {
+		subs = append(subs, s)
+	}
+	h.mu.Unlock()
+	for i := range entries {
+		e := &entries[i]
+		d := doc{e: e}
+		for _, s := range subs {
+			if s.matcher.Match(d) {
+				s.offer(*e)
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tail_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/search"
+	"github.com/aak1247/logtap/internal/tail"
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/datatypes"
+)
+
+func query(t *testing.T, q string) search.Node {
+	t.Helper()
+	parsed, err := search.NewQueryParser().Parse(q)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", q, err)
+	}
+	return parsed.Root
+}
+
+func logRow(projectID int, id int64, level, msg, fields string) model.Log {
+	return model.Log{
+		ID:        id,
+		ProjectID: projectID,
+		Timestamp: time.Now().UTC(),
+		Level:     level,
+		Message:   msg,
+		Fields:    datatypes.JSON(fields),
+	}
+}
+
+func receive(t *testing.T, sub *tail.Subscription) tail.Entry {
+	t.Helper()
+	select {
+	case e := <-sub.C():
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no entry received")
+		return tail.Entry{}
+	}
+}
+
+func expectNothing(t *testing.T, sub *tail.Subscription) {
+	t.Helper()
+	select {
+	case e := <-sub.C():
+		t.Fatalf("unexpected entry %d %q", e.ID, e.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHubMatchesQuery(t *testing.T) {
+	hub := tail.NewHub()
+	sub, err := hub.Subscribe(context.Background(), 1, query(t, `level:error service:api -timeout`), 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	hub.Publish(context.Background(), []model.Log{
+		logRow(1, 1, "info", "boom", `{"service":"api"}`),
+		logRow(1, 2, "error", "boom", `{"service":"api"}`),
+		logRow(1, 3, "error", "read timeout", `{"service":"api"}`),
+		logRow(1, 4, "error", "boom", `{"service":"web"}`),
+		logRow(2, 5, "error", "boom", `{"service":"api"}`),
+	})
+	if e := receive(t, sub); e.ID != 2 || string(e.Fields) != `{"service":"api"}` {
+		t.Fatalf("got entry %+v", e)
+	}
+	expectNothing(t, sub)
+	if matched, sent, dropped := sub.Counts(); matched != 1 || sent != 1 || dropped != 0 {
+		t.Fatalf("counts = %d %d %d", matched, sent, dropped)
+	}
+}
+
+func TestHubRateCap(t *testing.T) {
+	hub := tail.NewHub()
+	sub, err := hub.Subscribe(context.Background(), 1, nil, 5)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+	if sub.Rate != 5 {
+		t.Fatalf("rate = %d", sub.Rate)
+	}
+
+	logs := make([]model.Log, 50)
+	for i := range logs {
+		logs[i] = logRow(1, int64(i+1), "info", "tick", `{}`)
+	}
+	hub.Publish(context.Background(), logs)
+
+	matched, sent, dropped := sub.Counts()
+	if matched != 50 || sent < 5 || sent > 6 || sent+dropped != 50 {
+		t.Fatalf("counts = %d %d %d", matched, sent, dropped)
+	}
+	if len(sub.C()) != int(sent) {
+		t.Fatalf("queued %d, sent %d", len(sub.C()), sent)
+	}
+}
+
+func TestHubMaxStreams(t *testing.T) {
+	hub := tail.NewHub()
+	hub.MaxStreams = 1
+	ctx := context.Background()
+	first, err := hub.Subscribe(ctx, 1, nil, 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if _, err := hub.Subscribe(ctx, 1, nil, 0); !errors.Is(err, tail.ErrTooManyStreams) {
+		t.Fatalf("second stream: err = %v", err)
+	}
+	other, err := hub.Subscribe(ctx, 2, nil, 0)
+	if err != nil {
+		t.Fatalf("other project: %v", err)
+	}
+	defer other.Close()
+	first.Close()
+	first.Close()
+	again, err := hub.Subscribe(ctx, 1, nil, 0)
+	if err != nil {
+		t.Fatalf("after close: %v", err)
+	}
+	again.Close()
+}
+
+func TestRedisHubFanOut(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newHub := func() *tail.Hub {
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = rdb.Close() })
+		return tail.NewRedisHub(ctx, rdb)
+	}
+	publisher, listener := newHub(), newHub()
+
+	sub, err := listener.Subscribe(ctx, 7, query(t, "level:error"), 0)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	publisher.Publish(ctx, []model.Log{
+		logRow(7, 1, "info", "ok", `{}`),
+		logRow(7, 2, "error", "failed", `{"a":{"b":1}}`),
+	})
+	if e := receive(t, sub); e.ID != 2 || e.Message != "failed" {
+		t.Fatalf("got entry %+v", e)
+	}
+	expectNothing(t, sub)
+}
+
+func TestHandlerStreamsLogs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := tail.NewHub()
+	r := gin.New()
+	r.GET("/api/:projectId/logs/tail", tail.Handler(hub))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/1/logs/tail?q=level:(")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid query: status = %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/1/logs/tail?q=level:error", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != "retry: 3000" {
+		t.Fatalf("first line = %q", lines.Text())
+	}
+	hub.Publish(ctx, []model.Log{
+		logRow(1, 1, "info", "ok", `{}`),
+		logRow(1, 2, "error", "failed", `{}`),
+	})
+	var got []string
+	for len(got) < 2 && lines.Scan() {
+		if line := lines.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+	if len(got) != 2 || got[0] != "event: log" || !strings.Contains(got[1], `"id":2`) || !strings.Contains(got[1], `"message":"failed"`) {
+		t.Fatalf("got %q", got)
+	}
+}
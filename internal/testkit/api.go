@@ -14,9 +14,10 @@ import (
 )
 
 type APIEnvelope struct {
-	Code int             `json:"code"`
-	Data json.RawMessage `json:"data"`
-	Err  string          `json:"err"`
+	Code       int             `json:"code"`
+	Data       json.RawMessage `json:"data"`
+	Err        string          `json:"err"`
+	NextCursor string          `json:"next_cursor"`
 }
 
 func DoJSON(t testing.TB, client *http.Client, method, rawURL string, body any, headers map[string]string) (int, []byte) {
@@ -36,6 +36,24 @@ func OpenTestDB(t testing.TB) *gorm.DB {
 		&model.Log{},
 		&model.TrackEvent{},
 		&model.TrackEventDaily{},
+		&model.Issue{},
+		&model.IssueUser{},
+		&model.IssueActivity{},
+		&model.ReleaseArtifact{},
+		&model.Release{},
+		&model.Deploy{},
+		&model.LogMetric{},
+		&model.MetricPoint{},
+		&model.LogPattern{},
+		&model.LogPatternCount{},
+		&model.ProjectQuota{},
+		&model.ProjectUsageDaily{},
+		&model.PropertyDefinition{},
+		&model.PropertyIndex{},
+		&model.SlowSearchField{},
+		&model.SavedSearch{},
+		&model.ImportJob{},
+		&model.QueryJob{},
 
 		&model.AlertContact{},
 		&model.AlertContactGroup{},
@@ -34,13 +34,14 @@ func NewServer(t testing.TB) *Server {
 		AuthTokenTTL: time.Hour,
 		// Allow httptest loopback webhooks in integration tests.
 		WebhookAllowLoopback: true,
+		QueryJobCacheTTL:     time.Minute,
 	}
 	publisher := &InlinePublisher{DB: db}
 	reg := detector.NewRegistry()
 	_ = reg.RegisterStatic(logbasic.New())
 	detectorService := detector.NewService(reg, nil)
 
-	srv := httpserver.New(cfg, publisher, db, nil, nil, detectorService, nil)
+	srv := httpserver.New(cfg, publisher, db, nil, nil, detectorService, nil, nil)
 	ts := httptest.NewServer(srv.Handler)
 	t.Cleanup(ts.Close)
 
@@ -0,0 +1,154 @@
+package timescale
+
+import (
+	"context"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// CompressionStats is the hypertable-wide columnstore footprint.
+type CompressionStats = store.StorageCompression
+
+type HypertableStatus struct {
+	Name          string           `json:"name"`
+	Compression   bool             `json:"compression_enabled"`
+	CompressAfter string           `json:"compress_after,omitempty"`
+	DropAfter     string           `json:"drop_after,omitempty"`
+	TotalBytes    int64            `json:"total_bytes"`
+	Stats         CompressionStats `json:"compression_stats"`
+}
+
+type ContinuousAggregateStatus struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Present bool   `json:"present"`
+}
+
+type Status struct {
+	Installed            bool                        `json:"installed"`
+	Version              string                      `json:"version,omitempty"`
+	Settings             model.TimescaleSettings     `json:"settings"`
+	Hypertables          []HypertableStatus          `json:"hypertables"`
+	ContinuousAggregates []ContinuousAggregateStatus `json:"continuous_aggregates"`
+}
+
+// GetStatus reports the stored settings together with what is actually
+// configured in TimescaleDB.
+func GetStatus(ctx context.Context, db *gorm.DB) (Status, error) {
+	if db == nil {
+		return Status{}, gorm.ErrInvalidDB
+	}
+	settings, _, err := store.GetTimescaleSettings(ctx, db)
+	if err != nil {
+		return Status{}, err
+	}
+	out := Status{
+		Settings:             settings,
+		Hypertables:          []HypertableStatus{},
+		ContinuousAggregates: []ContinuousAggregateStatus{},
+	}
+	if !Installed(ctx, db) {
+		return out, nil
+	}
+	out.Installed = true
+	gdb := db.WithContext(ctx)
+	if err := gdb.Raw(`SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'`).Scan(&out.Version).Error; err != nil {
+		return Status{}, err
+	}
+
+	for _, t := range Hypertables {
+		ok, err := isHypertable(ctx, db, t.Name)
+		if err != nil {
+			return Status{}, err
+		}
+		if !ok {
+			continue
+		}
+		hs := HypertableStatus{Name: t.Name}
+		if err := gdb.Raw(
+			`SELECT COALESCE(bool_or(compression_enabled), false) FROM timescaledb_information.hypertables WHERE hypertable_name = ?`, t.Name,
+		).Scan(&hs.Compression).Error; err != nil {
+			return Status{}, err
+		}
+		if hs.CompressAfter, err = jobInterval(ctx, db, t.Name, "policy_compression", "compress_after"); err != nil {
+			return Status{}, err
+		}
+		if hs.DropAfter, err = jobInterval(ctx, db, t.Name, "policy_retention", "drop_after"); err != nil {
+			return Status{}, err
+		}
+		if err := gdb.Raw(`SELECT COALESCE(hypertable_size(?::regclass), 0)`, t.Name).Scan(&hs.TotalBytes).Error; err != nil {
+			return Status{}, err
+		}
+		if hs.Stats, err = compressionStats(ctx, db, t.Name); err != nil {
+			return Status{}, err
+		}
+		out.Hypertables = append(out.Hypertables, hs)
+	}
+
+	for _, ca := range ContinuousAggregates {
+		var n int
+		if err := gdb.Raw(
+			`SELECT COUNT(*) FROM timescaledb_information.continuous_aggregates WHERE view_name = ?`, ca.Name,
+		).Scan(&n).Error; err != nil {
+			return Status{}, err
+		}
+		out.ContinuousAggregates = append(out.ContinuousAggregates, ContinuousAggregateStatus{Name: ca.Name, Source: ca.Source, Present: n > 0})
+	}
+	return out, nil
+}
+
+// Compression returns compression stats keyed by table for every managed
+// hypertable. It returns nil when TimescaleDB is not installed.
+func Compression(ctx context.Context, db *gorm.DB) (map[string]CompressionStats, error) {
+	if !Installed(ctx, db) {
+		return nil, nil
+	}
+	out := map[string]CompressionStats{}
+	for _, t := range Hypertables {
+		ok, err := isHypertable(ctx, db, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		stats, err := compressionStats(ctx, db, t.Name)
+		if err != nil {
+			return nil, err
+		}
+		out[t.Name] = stats
+	}
+	return out, nil
+}
+
+func compressionStats(ctx context.Context, db *gorm.DB, table string) (CompressionStats, error) {
+	var row struct {
+		TotalChunks       int64
+		CompressedChunks  int64
+		UncompressedBytes int64
+		CompressedBytes   int64
+	}
+	// Stats are NULL until the first chunk is compressed.
+	if err := db.WithContext(ctx).Raw(`
+		SELECT
+			COALESCE(SUM(total_chunks), 0) AS total_chunks,
+			COALESCE(SUM(number_compressed_chunks), 0) AS compressed_chunks,
+			COALESCE(SUM(before_compression_total_bytes), 0) AS uncompressed_bytes,
+			COALESCE(SUM(after_compression_total_bytes), 0) AS compressed_bytes
+		FROM hypertable_compression_stats(?::regclass)
+	`, table).Scan(&row).Error; err != nil {
+		return CompressionStats{}, err
+	}
+	stats := CompressionStats{
+		TotalChunks:       row.TotalChunks,
+		CompressedChunks:  row.CompressedChunks,
+		UncompressedBytes: row.UncompressedBytes,
+		CompressedBytes:   row.CompressedBytes,
+	}
+	if row.CompressedBytes > 0 {
+		stats.Ratio = float64(row.UncompressedBytes) / float64(row.CompressedBytes)
+	}
+	return stats, nil
+}
@@ -0,0 +1,270 @@
+// Package timescale manages TimescaleDB policies on top of the hypertables
+// created during migration: columnstore compression, native retention aligned
+// with per-project cleanup policies, and continuous aggregates.
+package timescale
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aak1247/logtap/internal/model"
+	"github.com/aak1247/logtap/internal/retention"
+	"github.com/aak1247/logtap/internal/store"
+	"gorm.io/gorm"
+)
+
+// Hypertable is a managed time-series table.
+type Hypertable struct {
+	Name string
+	// Retention is the longest a project's policy keeps rows of this table,
+	// retention rules included.
+	Retention func(model.CleanupPolicy) int
+}
+
+var Hypertables = []Hypertable{
+	{Name: "logs", Retention: func(p model.CleanupPolicy) int { return retention.LongestDays(p, retention.TableLogs) }},
+	{Name: "events", Retention: func(p model.CleanupPolicy) int { return retention.LongestDays(p, retention.TableEvents) }},
+	{Name: "track_events", Retention: func(p model.CleanupPolicy) int { return retention.LongestDays(p, retention.TableTrackEvents) }},
+	// Detector results have no policy of their own; they follow log retention.
+	{Name: "detector_results", Retention: func(p model.CleanupPolicy) int { return p.LogsRetentionDays }},
+}
+
+// ContinuousAggregate is a managed materialized view over a hypertable.
+type ContinuousAggregate struct {
+	Name   string
+	Source string
+	Query  string
+	// Refresh policy offsets/schedule as Postgres interval literals.
+	StartOffset string
+	EndOffset   string
+	Schedule    string
+}
+
+var ContinuousAggregates = []ContinuousAggregate{
+	{
+		Name:   "logs_level_1m",
+		Source: "logs",
+		Query: `SELECT project_id, time_bucket(INTERVAL '1 minute', timestamp) AS bucket, level, COUNT(*) AS count
+			FROM logs GROUP BY project_id, bucket, level`,
+		StartOffset: "2 hours",
+		EndOffset:   "1 minute",
+		Schedule:    "1 minute",
+	},
+	{
+		Name:   "events_1h",
+		Source: "events",
+		Query: `SELECT project_id, time_bucket(INTERVAL '1 hour', timestamp) AS bucket, COUNT(*) AS count
+			FROM events GROUP BY project_id, bucket`,
+		StartOffset: "2 days",
+		EndOffset:   "1 hour",
+		Schedule:    "30 minutes",
+	},
+}
+
+// Installed reports whether the timescaledb extension is active in this database.
+func Installed(ctx context.Context, db *gorm.DB) bool {
+	if db == nil || !strings.EqualFold(db.Dialector.Name(), "postgres") {
+		return false
+	}
+	var n int
+	if err := db.WithContext(ctx).Raw(`SELECT 1 FROM pg_extension WHERE extname = 'timescaledb' LIMIT 1`).Scan(&n).Error; err != nil {
+		return false
+	}
+	return n == 1
+}
+
+func isHypertable(ctx context.Context, db *gorm.DB, table string) (bool, error) {
+	var n int
+	err := db.WithContext(ctx).Raw(
+		`SELECT COUNT(*) FROM timescaledb_information.hypertables WHERE hypertable_name = ?`, table,
+	).Scan(&n).Error
+	return n > 0, err
+}
+
+// jobInterval returns the configured interval of a policy job (e.g. "7 days"), or "" when absent.
+func jobInterval(ctx context.Context, db *gorm.DB, table, proc, key string) (string, error) {
+	var v *string
+	err := db.WithContext(ctx).Raw(`
+		SELECT config->>? FROM timescaledb_information.jobs
+		WHERE hypertable_name = ? AND proc_name = ?
+		LIMIT 1
+	`, key, table, proc).Scan(&v).Error
+	if err != nil || v == nil {
+		return "", err
+	}
+	return *v, nil
+}
+
+func daysInterval(days int) string { return fmt.Sprintf("%d days", days) }
+
+// Apply brings compression, retention and continuous aggregates in line with s.
+// It is a no-op when TimescaleDB is not installed; tables that are not
+// hypertables are skipped.
+func Apply(ctx context.Context, db *gorm.DB, s model.TimescaleSettings) error {
+	if !Installed(ctx, db) {
+		return nil
+	}
+	gdb := db.WithContext(ctx)
+	for _, t := range Hypertables {
+		ok, err := isHypertable(ctx, db, t.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := applyCompression(ctx, gdb, t.Name, s.CompressAfterDays); err != nil {
+			return fmt.Errorf("%s compression: %w", t.Name, err)
+		}
+	}
+	for _, ca := range ContinuousAggregates {
+		if err := applyContinuousAggregate(ctx, gdb, ca, s.ContinuousAggregates); err != nil {
+			return fmt.Errorf("%s continuous aggregate: %w", ca.Name, err)
+		}
+	}
+	return SyncRetention(ctx, db)
+}
+
+func applyCompression(ctx context.Context, db *gorm.DB, table string, afterDays int) error {
+	if afterDays <= 0 {
+		// Already compressed chunks stay compressed; only stop compressing new ones.
+		return db.Exec(`SELECT remove_compression_policy(?, if_exists => TRUE)`, table).Error
+	}
+	var enabled bool
+	if err := db.Raw(
+		`SELECT COALESCE(bool_or(compression_enabled), false) FROM timescaledb_information.hypertables WHERE hypertable_name = ?`, table,
+	).Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if !enabled {
+		// Segment by project so per-project queries decompress only their own segments.
+		if err := db.Exec(fmt.Sprintf(
+			`ALTER TABLE %s SET (timescaledb.compress, timescaledb.compress_segmentby = 'project_id', timescaledb.compress_orderby = 'timestamp DESC')`,
+			table,
+		)).Error; err != nil {
+			return err
+		}
+	}
+	current, err := jobInterval(ctx, db, table, "policy_compression", "compress_after")
+	if err != nil {
+		return err
+	}
+	want := daysInterval(afterDays)
+	if current == want {
+		return nil
+	}
+	if current != "" {
+		if err := db.Exec(`SELECT remove_compression_policy(?, if_exists => TRUE)`, table).Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec(fmt.Sprintf(`SELECT add_compression_policy(?, INTERVAL '%s', if_not_exists => TRUE)`, want), table).Error
+}
+
+func applyContinuousAggregate(ctx context.Context, db *gorm.DB, ca ContinuousAggregate, enabled bool) error {
+	if !enabled {
+		return db.Exec(fmt.Sprintf(`DROP MATERIALIZED VIEW IF EXISTS %s`, ca.Name)).Error
+	}
+	ok, err := isHypertable(ctx, db, ca.Source)
+	if err != nil || !ok {
+		return err
+	}
+	if err := db.Exec(fmt.Sprintf(
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS %s WITH (timescaledb.continuous) AS %s WITH NO DATA`,
+		ca.Name, ca.Query,
+	)).Error; err != nil {
+		return err
+	}
+	return db.Exec(fmt.Sprintf(
+		`SELECT add_continuous_aggregate_policy(?, start_offset => INTERVAL '%s', end_offset => INTERVAL '%s', schedule_interval => INTERVAL '%s', if_not_exists => TRUE)`,
+		ca.StartOffset, ca.EndOffset, ca.Schedule,
+	), ca.Name).Error
+}
+
+// SyncRetention points each hypertable's native retention policy at the
+// longest retention any project asks for. Chunks hold rows of every project,
+// so a chunk may only be dropped once it is expired for all of them: if any
+// project has no enabled policy (keeps data forever), native retention is
+// removed and the per-project batched deletes remain the only cleanup.
+func SyncRetention(ctx context.Context, db *gorm.DB) error {
+	if !Installed(ctx, db) {
+		return nil
+	}
+	settings, _, err := store.GetTimescaleSettings(ctx, db)
+	if err != nil {
+		return err
+	}
+	policies, err := store.ListEnabledCleanupPolicies(ctx, db)
+	if err != nil {
+		return err
+	}
+	var projectIDs []int
+	if err := db.WithContext(ctx).Model(&model.Project{}).Pluck("id", &projectIDs).Error; err != nil {
+		return err
+	}
+
+	gdb := db.WithContext(ctx)
+	for _, t := range Hypertables {
+		ok, err := isHypertable(ctx, db, t.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		days := 0
+		if settings.RetentionEnabled {
+			days = alignedRetentionDays(projectIDs, policies, t.Retention)
+		}
+		current, err := jobInterval(ctx, db, t.Name, "policy_retention", "drop_after")
+		if err != nil {
+			return err
+		}
+		want := ""
+		if days > 0 {
+			want = daysInterval(days)
+		}
+		if current == want {
+			continue
+		}
+		if current != "" {
+			if err := gdb.Exec(`SELECT remove_retention_policy(?, if_exists => TRUE)`, t.Name).Error; err != nil {
+				return err
+			}
+		}
+		if want != "" {
+			if err := gdb.Exec(fmt.Sprintf(`SELECT add_retention_policy(?, INTERVAL '%s', if_not_exists => TRUE)`, want), t.Name).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// alignedRetentionDays returns the longest retention across all projects, or
+// 0 (no native retention) when any project keeps data forever or archives it.
+func alignedRetentionDays(projectIDs []int, policies []model.CleanupPolicy, pick func(model.CleanupPolicy) int) int {
+	if len(projectIDs) == 0 {
+		return 0
+	}
+	byProject := make(map[int]int, len(policies))
+	for _, p := range policies {
+		// Chunk drops bypass the archiver, so archive-enabled projects
+		// count as keeping data forever.
+		if p.Enabled && !p.ArchiveEnabled {
+			byProject[p.ProjectID] = pick(p)
+		}
+	}
+	longest := 0
+	for _, id := range projectIDs {
+		days, ok := byProject[id]
+		if !ok || days <= 0 {
+			return 0
+		}
+		if days > longest {
+			longest = days
+		}
+	}
+	return longest
+}
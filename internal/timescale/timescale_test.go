@@ -0,0 +1,37 @@
+package timescale
+
+import (
+	"testing"
+
+	"github.com/aak1247/logtap/internal/model"
+)
+
+func TestAlignedRetentionDays(t *testing.T) {
+	logs := func(p model.CleanupPolicy) int { return p.LogsRetentionDays }
+	policies := []model.CleanupPolicy{
+		{ProjectID: 1, Enabled: true, LogsRetentionDays: 7},
+		{ProjectID: 2, Enabled: true, LogsRetentionDays: 30},
+		{ProjectID: 3, Enabled: false, LogsRetentionDays: 1},
+	}
+
+	if got := alignedRetentionDays([]int{1, 2}, policies, logs); got != 30 {
+		t.Fatalf("expected longest policy (30), got %d", got)
+	}
+	if got := alignedRetentionDays([]int{1, 2, 3}, policies, logs); got != 0 {
+		t.Fatalf("disabled policy keeps data forever, got %d", got)
+	}
+	if got := alignedRetentionDays([]int{1, 4}, policies, logs); got != 0 {
+		t.Fatalf("project without policy keeps data forever, got %d", got)
+	}
+	if got := alignedRetentionDays(nil, policies, logs); got != 0 {
+		t.Fatalf("expected no retention without projects, got %d", got)
+	}
+	zero := []model.CleanupPolicy{{ProjectID: 1, Enabled: true, LogsRetentionDays: 0}}
+	if got := alignedRetentionDays([]int{1}, zero, logs); got != 0 {
+		t.Fatalf("0 days means keep forever, got %d", got)
+	}
+	archived := []model.CleanupPolicy{{ProjectID: 1, Enabled: true, LogsRetentionDays: 7, ArchiveEnabled: true}}
+	if got := alignedRetentionDays([]int{1}, archived, logs); got != 0 {
+		t.Fatalf("archive-enabled project must not lose chunks to native retention, got %d", got)
+	}
+}
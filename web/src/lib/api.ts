@@ -33,6 +33,8 @@ export type StorageEstimateTable = {
   sample_size: number;
   avg_row_bytes: number;
   est_bytes: number;
+  expired_count: number;
+  retained_est_bytes: number;
 };
 
 export type StorageEstimate = {
@@ -40,9 +42,19 @@ export type StorageEstimate = {
   logs: StorageEstimateTable;
   events: StorageEstimateTable;
   total_bytes: number;
+  retained_total_bytes: number;
   estimated_at: string;
 };
 
+// Ordered; the first rule matching a row sets its retention (0 = forever).
+export type RetentionRule = {
+  table: "logs" | "events" | "track_events";
+  levels?: string[];
+  field?: string;
+  value?: string;
+  days: number;
+};
+
 export type CleanupPolicy = {
   project_id: number;
   enabled: boolean;
@@ -51,12 +63,51 @@ export type CleanupPolicy = {
   track_events_retention_days: number;
   schedule_hour_utc: number;
   schedule_minute_utc: number;
+  archive_enabled: boolean;
+  retention_rules: RetentionRule[];
   last_run_at?: string;
   next_run_at?: string;
   created_at: string;
   updated_at: string;
 };
 
+export type ProjectQuota = {
+  project_id: number;
+  enabled: boolean;
+  max_storage_bytes: number;
+  max_daily_bytes: number;
+  max_daily_rows: number;
+  max_export_bytes: number;
+  action: "reject" | "downsample" | "cleanup";
+  sample_rate: number;
+  notify_owner: boolean;
+  channels: { type: string; config: unknown }[];
+  storage_bytes: number;
+  storage_checked_at?: string;
+  created_at: string;
+  updated_at: string;
+};
+
+export type ProjectUsageDay = {
+  project_id: number;
+  day: string;
+  logs: number;
+  log_bytes: number;
+  events: number;
+  event_bytes: number;
+  dropped: number;
+  export_bytes: number;
+};
+
+export type QuotaStatus = {
+  quota: ProjectQuota;
+  today: ProjectUsageDay;
+  storage_percent: number;
+  volume_percent: number;
+  over_storage: boolean;
+  over_volume: boolean;
+};
+
 export type User = { id: number; email: string };
 export type SelfLogConfig = { project_id: string | number; project_key: string };
 export type LoginResponse = { token: string; user: User; self_log?: SelfLogConfig };
@@ -131,7 +182,7 @@ export type AlertWebhookEndpoint = {
   updated_at: string;
 };
 
-export type AlertRuleSource = "logs" | "events" | "both";
+export type AlertRuleSource = "logs" | "events" | "both" | "issues" | "metrics";
 
 export type AlertRule = {
   id: number;
@@ -187,7 +238,7 @@ export type PropertyDefinition = {
   project_id: number;
   key: string;
   display_name: string;
-  type: "string" | "enum" | "number" | string;
+  type: "string" | "enum" | "number" | "boolean" | "datetime" | string;
   description: string;
   status: string;
   enum_values?: string[] | null;
@@ -266,6 +317,57 @@ export type MonitorUpsertRequest = {
   enabled?: boolean;
 };
 
+export type LogMetricAggregation =
+  | "count"
+  | "sum"
+  | "avg"
+  | "min"
+  | "max"
+  | "p50"
+  | "p90"
+  | "p95"
+  | "p99";
+
+export type LogMetric = {
+  id: number;
+  project_id: number;
+  name: string;
+  description?: string;
+  query: string;
+  aggregation: LogMetricAggregation;
+  field?: string;
+  group_by: string[];
+  interval_sec: number;
+  enabled: boolean;
+  rolled_up_to?: string;
+  created_at: string;
+  updated_at: string;
+};
+
+export type LogMetricUpsertRequest = {
+  name?: string;
+  description?: string;
+  query?: string;
+  aggregation?: LogMetricAggregation;
+  field?: string;
+  group_by?: string[];
+  interval_sec?: number;
+  enabled?: boolean;
+};
+
+export type LogMetricSeries = {
+  labels: Record<string, string>;
+  points: { bucket: string; value: number; count: number }[];
+};
+
+export type LogMetricSeriesResponse = {
+  metric: LogMetric;
+  start: string;
+  end: string;
+  interval_sec: number;
+  series: LogMetricSeries[];
+};
+
 export type MonitorTestSample = {
   source: string;
   sourceType: string;
@@ -298,10 +400,37 @@ export type AggregateResponse = {
   points: AggregatePoint[];
 };
 
+export type SearchSource = "logs" | "events" | "track";
+
+export type SearchHit = {
+  id: number | string;
+  type: "log" | "event" | "track";
+  timestamp: string;
+  level?: string;
+  message: string;
+  trace_id?: string;
+  span_id?: string;
+  pattern_id?: string;
+  fields?: Record<string, unknown>;
+  highlight?: Record<string, string[]>;
+};
+
 export type SearchResult = {
-  items: LogRow[];
+  items: SearchHit[];
   total: number;
-  facets?: Record<string, { key: string; count: number }[]>;
+  // eq: exact; gte: at least total (counting stopped); approx: estimated
+  total_relation: "eq" | "gte" | "approx";
+  // pass back as cursor for the next page; absent on the last page
+  next_cursor?: string;
+  facets?: Record<
+    string,
+    { field: string; buckets: { key: string; count: number }[]; sampled?: boolean }
+  >;
+  histogram?: {
+    interval_sec: number;
+    buckets: { time: string; count: number }[];
+    sampled?: boolean;
+  };
 };
 
 export async function listChannels(
@@ -340,14 +469,28 @@ export async function searchUnified(
   s: ApiSettings,
   params: {
     q?: string;
+    sources?: SearchSource[];
     start?: string;
     end?: string;
     page?: number;
     pageSize?: number;
+    cursor?: string;
+    total?: "exact" | "capped" | "estimate";
+    facets?: string[];
+    facetSize?: number;
+    histogram?: boolean;
+    interval?: string;
   },
 ): Promise<SearchResult> {
   const usp = new URLSearchParams();
+  if (params.cursor) usp.set("cursor", params.cursor);
+  if (params.total) usp.set("total", params.total);
   if (params.q) usp.set("q", params.q);
+  if (params.sources?.length) usp.set("sources", params.sources.join(","));
+  if (params.facets?.length) usp.set("facets", params.facets.join(","));
+  if (params.facetSize) usp.set("facetSize", String(params.facetSize));
+  if (params.histogram) usp.set("histogram", "true");
+  if (params.interval) usp.set("interval", params.interval);
   if (params.start) usp.set("start", params.start);
   if (params.end) usp.set("end", params.end);
   if (params.page) usp.set("page", String(params.page));
@@ -358,6 +501,63 @@ export async function searchUnified(
   );
 }
 
+export type TailEntry = {
+  id: number;
+  timestamp: string;
+  level?: string;
+  message: string;
+  trace_id?: string;
+  span_id?: string;
+  distinct_id?: string;
+  device_id?: string;
+  fields?: Record<string, unknown>;
+};
+
+export type TailStats = { matched: number; sent: number; dropped: number; rate: number };
+
+// tailLogs streams new logs matching q until signal aborts. It reads the
+// Server-Sent Events with fetch so the token goes in the Authorization header.
+export async function tailLogs(
+  s: ApiSettings,
+  params: { q?: string; rate?: number },
+  handlers: { onLog: (e: TailEntry) => void; onStats?: (st: TailStats) => void },
+  signal: AbortSignal,
+): Promise<void> {
+  const usp = new URLSearchParams();
+  if (params.q) usp.set("q", params.q);
+  if (params.rate) usp.set("rate", String(params.rate));
+  const headers: Record<string, string> = { Accept: "text/event-stream" };
+  if (s.token) headers.Authorization = `Bearer ${s.token}`;
+  const res = await fetch(`${s.apiBase}/api/${s.projectId}/logs/tail?${usp.toString()}`, { headers, signal });
+  if (res.status === 401 && s.token) handleUnauthorized();
+  if (!res.ok || !res.body) {
+    const body = (await res.json().catch(() => undefined)) as { error?: string } | undefined;
+    throw new Error(body?.error || `HTTP ${res.status}`);
+  }
+
+  const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+  let buf = "";
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) return;
+    buf += value;
+    let end: number;
+    while ((end = buf.indexOf("\n\n")) >= 0) {
+      const block = buf.slice(0, end);
+      buf = buf.slice(end + 2);
+      let event = "message";
+      let data = "";
+      for (const line of block.split("\n")) {
+        if (line.startsWith("event: ")) event = line.slice(7);
+        else if (line.startsWith("data: ")) data += line.slice(6);
+      }
+      if (!data) continue;
+      if (event === "log") handlers.onLog(JSON.parse(data) as TailEntry);
+      else if (event === "stats") handlers.onStats?.(JSON.parse(data) as TailStats);
+    }
+  }
+}
+
 export type MonitorTestResult = {
   monitorId: number;
   detectorType: string;
@@ -373,16 +573,69 @@ export type RecentEvent = {
   title?: string;
 };
 
+export type Issue = {
+  id: number;
+  project_id: number;
+  fingerprint: string;
+  title: string;
+  culprit: string;
+  level: string;
+  first_seen: string;
+  last_seen: string;
+  count: number;
+  users: number;
+  last_event_id: string;
+  first_release?: string;
+  status: IssueStatus;
+  regressed: boolean;
+  resolved_at?: string;
+  resolved_in_release?: string;
+  ignore_until?: string;
+  ignore_until_count?: number;
+  ignore_until_users?: number;
+  assignee_user_id?: number;
+  created_at: string;
+  updated_at: string;
+};
+
+export type IssueStatus =
+  | "unresolved"
+  | "resolved"
+  | "resolved_in_next_release"
+  | "ignored"
+  | "muted";
+
+export type IssueActivity = {
+  id: number;
+  project_id: number;
+  issue_id: number;
+  kind: string;
+  user_id: number;
+  data: Record<string, unknown>;
+  created_at: string;
+};
+
+export type IssueEvent = RecentEvent & { distinct_id?: string; release?: string };
+
 export type LogRow = {
   id: number;
   timestamp: string;
   level?: string;
   trace_id?: string;
   span_id?: string;
+  pattern_id?: string;
   message: string;
   fields?: Record<string, unknown>;
 };
 
+export type DeployAnnotation = {
+  time: string;
+  kind: "deploy";
+  title: string;
+  release: string;
+  environment: string;
+};
+
 export type BucketCount = { bucket: string; active: number };
 export type ActiveSeriesResponse = {
   project_id: number;
@@ -390,6 +643,7 @@ export type ActiveSeriesResponse = {
   start: string;
   end: string;
   series: BucketCount[];
+  annotations: DeployAnnotation[];
 };
 
 export type DistItem = { key: string; count: number };
@@ -444,6 +698,7 @@ export type UserGrowthResponse = {
   end: string;
   series: UserGrowthPoint[];
   total_users: number;
+  annotations: DeployAnnotation[];
 };
 
 export type CustomAnalyticsSeriesPoint = { time: string; value: number };
@@ -463,6 +718,7 @@ export type CustomAnalyticsResponse = {
   group_by: string[];
   property_key?: string;
   series: CustomAnalyticsSeries[];
+  annotations: DeployAnnotation[];
 };
 
 export type AnalysisView = {
@@ -629,6 +885,68 @@ export async function updatePropertyDefinition(
   );
 }
 
+export type PropertyIndex = {
+  id: number;
+  project_id: number;
+  key: string;
+  type: string;
+  index_name: string;
+  expression: string;
+  status: "building" | "ready" | "failed" | string;
+  error: string;
+  created_at: string;
+  updated_at: string;
+};
+
+export type PropertyIndexAdvice = {
+  key: string;
+  type: string;
+  declared: boolean;
+  slow_searches: number;
+  avg_ms: number;
+  max_ms: number;
+  last_seen: string;
+  indexable: boolean;
+  expression?: string;
+  status?: string;
+  reason: string;
+};
+
+export async function listPropertyIndexes(s: ApiSettings): Promise<{ items: PropertyIndex[] }> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/properties/indexes`, s.token);
+}
+
+// The index builds as a query job; its status turns ready or failed when the job ends.
+export async function createPropertyIndex(
+  s: ApiSettings,
+  key: string,
+): Promise<{ index: PropertyIndex; job?: QueryJob }> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/properties/indexes`, s.token, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ key }),
+  });
+}
+
+export async function deletePropertyIndex(
+  s: ApiSettings,
+  key: string,
+): Promise<{ deleted: boolean; dropped: boolean }> {
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/properties/indexes/${encodeURIComponent(key)}`,
+    s.token,
+    { method: "DELETE" },
+  );
+}
+
+export async function getPropertyIndexAdvice(
+  s: ApiSettings,
+  params?: { limit?: number },
+): Promise<{ items: PropertyIndexAdvice[] }> {
+  const qs = params?.limit ? `?limit=${params.limit}` : "";
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/properties/indexes/advice${qs}`, s.token);
+}
+
 export async function getMetricsToday(s: ApiSettings): Promise<MetricsToday> {
   return fetchJSON(`${s.apiBase}/api/${s.projectId}/metrics/today`, s.token);
 }
@@ -670,6 +988,8 @@ export async function upsertCleanupPolicy(
       | "track_events_retention_days"
       | "schedule_hour_utc"
       | "schedule_minute_utc"
+      | "archive_enabled"
+      | "retention_rules"
     >
   >,
 ): Promise<CleanupPolicy> {
@@ -680,6 +1000,42 @@ export async function upsertCleanupPolicy(
   });
 }
 
+export async function getQuota(s: ApiSettings): Promise<QuotaStatus> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/quota`, s.token);
+}
+
+// Only the instance admin may set quotas; project owners get 403.
+export async function upsertQuota(
+  s: ApiSettings,
+  req: Partial<
+    Pick<
+      ProjectQuota,
+      | "enabled"
+      | "max_storage_bytes"
+      | "max_daily_bytes"
+      | "max_daily_rows"
+      | "max_export_bytes"
+      | "action"
+      | "sample_rate"
+      | "notify_owner"
+      | "channels"
+    >
+  >,
+): Promise<ProjectQuota> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/quota`, s.token, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function listUsage(
+  s: ApiSettings,
+  days = 30,
+): Promise<{ days: number; items: ProjectUsageDay[] }> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/usage?days=${days}`, s.token);
+}
+
 export async function runCleanupPolicy(
   s: ApiSettings,
 ): Promise<{
@@ -729,6 +1085,242 @@ export async function getRecentEvents(
   );
 }
 
+export async function listIssues(
+  s: ApiSettings,
+  params?: {
+    q?: string;
+    level?: string;
+    status?: IssueStatus;
+    assignee?: number;
+    first_release?: string;
+    sort?: "last_seen" | "first_seen" | "count" | "users";
+    limit?: number;
+    offset?: number;
+  },
+): Promise<Issue[]> {
+  const usp = new URLSearchParams();
+  if (params?.q) usp.set("q", params.q);
+  if (params?.level) usp.set("level", params.level);
+  if (params?.status) usp.set("status", params.status);
+  if (params?.assignee) usp.set("assignee", String(params.assignee));
+  if (params?.first_release) usp.set("first_release", params.first_release);
+  if (params?.sort) usp.set("sort", params.sort);
+  if (params?.limit) usp.set("limit", String(params.limit));
+  if (params?.offset) usp.set("offset", String(params.offset));
+  const qs = usp.toString();
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/issues${qs ? `?${qs}` : ""}`, s.token);
+}
+
+export async function getIssue(
+  s: ApiSettings,
+  issueId: number,
+): Promise<{ issue: Issue; latest_event?: unknown }> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/issues/${issueId}`, s.token);
+}
+
+export async function updateIssue(
+  s: ApiSettings,
+  issueId: number,
+  req: {
+    status?: IssueStatus;
+    ignore_minutes?: number;
+    ignore_count?: number;
+    ignore_users?: number;
+    assignee_user_id?: number | null;
+  },
+): Promise<Issue> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/issues/${issueId}`, s.token, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function listIssueActivity(
+  s: ApiSettings,
+  issueId: number,
+): Promise<IssueActivity[]> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/issues/${issueId}/activity`, s.token);
+}
+
+export async function listIssueEvents(
+  s: ApiSettings,
+  issueId: number,
+  params?: { before?: string; limit?: number },
+): Promise<IssueEvent[]> {
+  const usp = new URLSearchParams();
+  if (params?.before) usp.set("before", params.before);
+  if (params?.limit) usp.set("limit", String(params.limit));
+  const qs = usp.toString();
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/issues/${issueId}/events${qs ? `?${qs}` : ""}`,
+    s.token,
+  );
+}
+
+export type Release = {
+  id: number;
+  project_id: number;
+  version: string;
+  ref?: string;
+  url?: string;
+  created_at: string;
+  updated_at: string;
+};
+
+export type Deploy = {
+  id: number;
+  project_id: number;
+  release_id: number;
+  version: string;
+  environment: string;
+  name?: string;
+  url?: string;
+  started_at?: string;
+  finished_at: string;
+  created_at: string;
+};
+
+export type ReleaseStats = {
+  version: string;
+  start: string;
+  end: string;
+  events: number;
+  errors: number;
+  users: number;
+  new_issues: number;
+  error_rate: number;
+};
+
+export type ReleaseDetail = {
+  release: Release;
+  deploys: Deploy[];
+  stats: ReleaseStats;
+  previous: ReleaseStats | null;
+  comparison: {
+    error_rate_change: number | null;
+    new_issues_change: number;
+    worse: boolean;
+  } | null;
+};
+
+export async function listReleases(
+  s: ApiSettings,
+  params?: { limit?: number; offset?: number },
+): Promise<(Release & { deploys: Deploy[] })[]> {
+  const usp = new URLSearchParams();
+  if (params?.limit) usp.set("limit", String(params.limit));
+  if (params?.offset) usp.set("offset", String(params.offset));
+  const qs = usp.toString();
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/releases${qs ? `?${qs}` : ""}`, s.token);
+}
+
+export async function createRelease(
+  s: ApiSettings,
+  req: { version: string; ref?: string; url?: string; created_at?: string },
+): Promise<Release> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/releases`, s.token, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function getRelease(
+  s: ApiSettings,
+  version: string,
+  environment?: string,
+): Promise<ReleaseDetail> {
+  const qs = environment ? `?environment=${encodeURIComponent(environment)}` : "";
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/releases/${encodeURIComponent(version)}${qs}`,
+    s.token,
+  );
+}
+
+export async function createDeploy(
+  s: ApiSettings,
+  version: string,
+  req: { environment: string; name?: string; url?: string; started_at?: string; finished_at?: string },
+): Promise<Deploy> {
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/releases/${encodeURIComponent(version)}/deploys`,
+    s.token,
+    {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(req),
+    },
+  );
+}
+
+export async function listDeployAnnotations(
+  s: ApiSettings,
+  params?: { start?: string; end?: string; environment?: string },
+): Promise<DeployAnnotation[]> {
+  const usp = new URLSearchParams();
+  if (params?.start) usp.set("start", params.start);
+  if (params?.end) usp.set("end", params.end);
+  if (params?.environment) usp.set("environment", params.environment);
+  const qs = usp.toString();
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/deploys/annotations${qs ? `?${qs}` : ""}`, s.token);
+}
+
+export type ReleaseArtifactType = "source" | "sourcemap" | "proguard" | "dart_symbols";
+
+export type ReleaseArtifact = {
+  id: number;
+  project_id: number;
+  release: string;
+  name: string;
+  type: ReleaseArtifactType;
+  debug_id?: string;
+  size: number;
+  sha1: string;
+  created_at: string;
+  updated_at: string;
+};
+
+export async function listReleaseArtifacts(
+  s: ApiSettings,
+  release: string,
+): Promise<ReleaseArtifact[]> {
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/releases/${encodeURIComponent(release)}/artifacts`,
+    s.token,
+  );
+}
+
+export async function uploadReleaseArtifact(
+  s: ApiSettings,
+  release: string,
+  file: File,
+  name?: string,
+  type?: ReleaseArtifactType,
+): Promise<ReleaseArtifact> {
+  const form = new FormData();
+  form.set("file", file);
+  if (name) form.set("name", name);
+  if (type) form.set("type", type);
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/releases/${encodeURIComponent(release)}/artifacts`,
+    s.token,
+    { method: "POST", body: form },
+  );
+}
+
+export async function deleteReleaseArtifact(
+  s: ApiSettings,
+  release: string,
+  artifactId: number,
+): Promise<{ deleted: boolean }> {
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/releases/${encodeURIComponent(release)}/artifacts/${artifactId}`,
+    s.token,
+    { method: "DELETE" },
+  );
+}
+
 export async function getEvent(
   s: ApiSettings,
   eventId: string,
@@ -849,6 +1441,51 @@ export async function searchLogs(
   );
 }
 
+export type LogContext = {
+  anchor: LogRow;
+  by: string;
+  value: string;
+  before: LogRow[]; // oldest first
+  after: LogRow[];
+  more_before: boolean;
+  more_after: boolean;
+};
+
+// by: device_id, trace_id, distinct_id or a field such as fields.host; empty
+// for all of the project's logs.
+export async function getLogContext(
+  s: ApiSettings,
+  logId: number,
+  params: { by?: string; before?: number; after?: number; window?: string },
+): Promise<LogContext> {
+  const usp = new URLSearchParams();
+  if (params.by) usp.set("by", params.by);
+  if (params.before !== undefined) usp.set("before", String(params.before));
+  if (params.after !== undefined) usp.set("after", String(params.after));
+  if (params.window) usp.set("window", params.window);
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/logs/${logId}/context?${usp.toString()}`,
+    s.token,
+  );
+}
+
+// Logs around a Sentry event; by defaults to the event's device_id, then
+// distinct_id ("none" for all of the project's logs).
+export async function getEventLogContext(
+  s: ApiSettings,
+  eventId: string,
+  params: { by?: "device_id" | "distinct_id" | "trace_id" | "none"; before?: number; after?: number },
+): Promise<Omit<LogContext, "anchor"> & { anchor: { id: string; timestamp: string; level?: string; title?: string } }> {
+  const usp = new URLSearchParams();
+  if (params.by) usp.set("by", params.by);
+  if (params.before !== undefined) usp.set("before", String(params.before));
+  if (params.after !== undefined) usp.set("after", String(params.after));
+  return fetchJSON(
+    `${s.apiBase}/api/${s.projectId}/events/${eventId}/context?${usp.toString()}`,
+    s.token,
+  );
+}
+
 export async function login(
   apiBase: string,
   email: string,
@@ -1295,6 +1932,378 @@ export async function listMonitorRuns(
   return fetchJSON(`${monitorsBase(s)}/${monitorId}/runs${qs ? `?${qs}` : ""}`, s.token);
 }
 
+function logMetricsBase(s: ApiSettings): string {
+  return `${s.apiBase}/api/${s.projectId}/log-metrics`;
+}
+
+export async function listLogMetrics(s: ApiSettings): Promise<{ items: LogMetric[] }> {
+  return fetchJSON(logMetricsBase(s), s.token);
+}
+
+export async function createLogMetric(
+  s: ApiSettings,
+  req: LogMetricUpsertRequest,
+): Promise<LogMetric> {
+  return fetchJSON(logMetricsBase(s), s.token, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function updateLogMetric(
+  s: ApiSettings,
+  metricId: number,
+  req: LogMetricUpsertRequest,
+): Promise<LogMetric> {
+  return fetchJSON(`${logMetricsBase(s)}/${metricId}`, s.token, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function deleteLogMetric(
+  s: ApiSettings,
+  metricId: number,
+): Promise<{ deleted: boolean }> {
+  return fetchJSON(`${logMetricsBase(s)}/${metricId}`, s.token, {
+    method: "DELETE",
+  });
+}
+
+export async function getLogMetricSeries(
+  s: ApiSettings,
+  metricId: number,
+  params?: { start?: string; end?: string; labels?: Record<string, string> },
+): Promise<LogMetricSeriesResponse> {
+  const usp = new URLSearchParams();
+  if (params?.start) usp.set("start", params.start);
+  if (params?.end) usp.set("end", params.end);
+  for (const [k, v] of Object.entries(params?.labels ?? {})) usp.append("label", `${k}=${v}`);
+  const qs = usp.toString();
+  return fetchJSON(`${logMetricsBase(s)}/${metricId}/series${qs ? `?${qs}` : ""}`, s.token);
+}
+
+export type SavedSearch = {
+  id: number;
+  project_id: number;
+  owner_user_id: number;
+  name: string;
+  description?: string;
+  query: string;
+  sources?: string;
+  start?: string;
+  end?: string;
+  columns: string[];
+  sort: "desc" | "asc";
+  shared: boolean;
+  schedule_enabled: boolean;
+  schedule_frequency: "hourly" | "daily" | "weekly";
+  schedule_weekday: number;
+  schedule_hour_utc: number;
+  schedule_minute_utc: number;
+  delivery_format: "count" | "csv";
+  delivery_rows: number;
+  channels: { type: string; config: unknown }[];
+  next_run_at?: string;
+  last_run_at?: string;
+  last_hits: number;
+  last_error?: string;
+  created_at: string;
+  updated_at: string;
+};
+
+export type SavedSearchUpsertRequest = Partial<
+  Omit<
+    SavedSearch,
+    | "id"
+    | "project_id"
+    | "owner_user_id"
+    | "next_run_at"
+    | "last_run_at"
+    | "last_hits"
+    | "last_error"
+    | "created_at"
+    | "updated_at"
+  >
+>;
+
+export type SavedSearchReport = {
+  total: number;
+  total_relation: string;
+  start?: string;
+  end?: string;
+  hits?: SearchHit[];
+  title: string;
+  content: string;
+};
+
+function savedSearchesBase(s: ApiSettings): string {
+  return `${s.apiBase}/api/${s.projectId}/saved-searches`;
+}
+
+// Lists the caller's saved searches and those shared in the project.
+export async function listSavedSearches(
+  s: ApiSettings,
+  params?: { q?: string },
+): Promise<{ items: SavedSearch[] }> {
+  const qs = params?.q ? `?q=${encodeURIComponent(params.q)}` : "";
+  return fetchJSON(`${savedSearchesBase(s)}${qs}`, s.token);
+}
+
+export async function createSavedSearch(
+  s: ApiSettings,
+  req: SavedSearchUpsertRequest,
+): Promise<SavedSearch> {
+  return fetchJSON(savedSearchesBase(s), s.token, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function updateSavedSearch(
+  s: ApiSettings,
+  searchId: number,
+  req: SavedSearchUpsertRequest,
+): Promise<SavedSearch> {
+  return fetchJSON(`${savedSearchesBase(s)}/${searchId}`, s.token, {
+    method: "PUT",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(req),
+  });
+}
+
+export async function deleteSavedSearch(
+  s: ApiSettings,
+  searchId: number,
+): Promise<{ deleted: boolean }> {
+  return fetchJSON(`${savedSearchesBase(s)}/${searchId}`, s.token, {
+    method: "DELETE",
+  });
+}
+
+// Runs a saved search now; with deliver the owner also sends it to its channels.
+export async function runSavedSearch(
+  s: ApiSettings,
+  searchId: number,
+  params?: { deliver?: boolean },
+): Promise<{ report: SavedSearchReport; queued: number }> {
+  const qs = params?.deliver ? "?deliver=1" : "";
+  return fetchJSON(`${savedSearchesBase(s)}/${searchId}/run${qs}`, s.token, {
+    method: "POST",
+  });
+}
+
+export type ExportParams = {
+  source?: "logs" | "events" | "track";
+  q?: string;
+  start?: string;
+  end?: string;
+  format?: "ndjson" | "csv" | "parquet";
+  columns?: string[];
+  gzip?: boolean;
+  cursor?: string;
+};
+
+// exportData downloads an export as a Blob with the server's file name. The
+// resume cursor of a truncated export is an HTTP trailer, which fetch cannot
+// read; resume large exports outside the browser.
+export async function exportData(
+  s: ApiSettings,
+  params: ExportParams,
+): Promise<{ blob: Blob; filename: string }> {
+  const usp = new URLSearchParams();
+  if (params.source) usp.set("source", params.source);
+  if (params.q) usp.set("q", params.q);
+  if (params.start) usp.set("start", params.start);
+  if (params.end) usp.set("end", params.end);
+  if (params.format) usp.set("format", params.format);
+  if (params.columns?.length) usp.set("columns", params.columns.join(","));
+  if (params.gzip) usp.set("gzip", "1");
+  if (params.cursor) usp.set("cursor", params.cursor);
+  const headers: Record<string, string> = {};
+  if (s.token) headers.Authorization = `Bearer ${s.token}`;
+  const res = await fetch(`${s.apiBase}/api/${s.projectId}/export?${usp.toString()}`, { headers });
+  if (res.status === 401 && s.token) handleUnauthorized();
+  if (!res.ok) {
+    const body = (await res.json().catch(() => undefined)) as { err?: string } | undefined;
+    throw new Error(body?.err || `HTTP ${res.status}`);
+  }
+  const disposition = res.headers.get("content-disposition") || "";
+  const filename = /filename="([^"]+)"/.exec(disposition)?.[1] || "export";
+  return { blob: await res.blob(), filename };
+}
+
+export type ImportKind = "logs" | "track" | "events";
+
+export type ImportJob = {
+  id: number;
+  project_id: number;
+  user_id: number;
+  kind: ImportKind;
+  status: "pending" | "running" | "done" | "failed";
+  parts: number;
+  bytes: number;
+  lines: number;
+  imported: number;
+  duplicates: number;
+  failed: number;
+  errors: Array<{ part: number; line: number; error: string }>;
+  error?: string;
+  started_at?: string;
+  finished_at?: string;
+  created_at: string;
+  updated_at: string;
+};
+
+function importsBase(s: ApiSettings): string {
+  return `${s.apiBase}/api/${s.projectId}/imports`;
+}
+
+export async function listImports(s: ApiSettings): Promise<{ items: ImportJob[] }> {
+  return fetchJSON(importsBase(s), s.token);
+}
+
+export async function createImport(s: ApiSettings, kind: ImportKind): Promise<ImportJob> {
+  return fetchJSON(importsBase(s), s.token, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ kind }),
+  });
+}
+
+export async function getImport(s: ApiSettings, importId: number): Promise<ImportJob> {
+  return fetchJSON(`${importsBase(s)}/${importId}`, s.token);
+}
+
+// Uploads an NDJSON file (gzip when its name ends in .gz) as the next part of
+// an import; resolves once the part is imported. Poll getImport meanwhile for
+// progress.
+export async function uploadImportData(
+  s: ApiSettings,
+  importId: number,
+  file: Blob & { name?: string },
+): Promise<ImportJob> {
+  const headers: Record<string, string> = { "Content-Type": "application/x-ndjson" };
+  if (file.name?.endsWith(".gz")) headers["Content-Encoding"] = "gzip";
+  return fetchJSON(`${importsBase(s)}/${importId}/data`, s.token, {
+    method: "POST",
+    headers,
+    body: file,
+  });
+}
+
+export type LogPattern = {
+  pattern_id: string;
+  template: string;
+  sample: string;
+  level?: string;
+  count: number;
+  first_seen: string;
+  last_seen: string;
+  matches: number;
+  expected?: number;
+  ratio?: number;
+};
+
+export type LogPatternDetail = {
+  pattern: Omit<LogPattern, "matches" | "expected" | "ratio">;
+  start: string;
+  end: string;
+  interval_sec: number;
+  series: Array<{ bucket: string; count: number }>;
+};
+
+function patternsBase(s: ApiSettings): string {
+  return `${s.apiBase}/api/${s.projectId}/patterns`;
+}
+
+function rangeQuery(params?: Record<string, string | number | undefined>): string {
+  const usp = new URLSearchParams();
+  for (const [k, v] of Object.entries(params ?? {})) {
+    if (v !== undefined && v !== "") usp.set(k, String(v));
+  }
+  const qs = usp.toString();
+  return qs ? `?${qs}` : "";
+}
+
+export async function listPatterns(
+  s: ApiSettings,
+  params?: { start?: string; end?: string; limit?: number },
+): Promise<LogPattern[]> {
+  return fetchJSON(`${patternsBase(s)}${rangeQuery(params)}`, s.token);
+}
+
+export async function listNewPatterns(
+  s: ApiSettings,
+  params?: { start?: string; end?: string; limit?: number },
+): Promise<LogPattern[]> {
+  return fetchJSON(`${patternsBase(s)}/new${rangeQuery(params)}`, s.token);
+}
+
+export async function listPatternSpikes(
+  s: ApiSettings,
+  params?: { start?: string; end?: string; baseline?: string; minCount?: number; minRatio?: number; limit?: number },
+): Promise<{ start: string; end: string; baseline: string; items: LogPattern[] }> {
+  return fetchJSON(`${patternsBase(s)}/spikes${rangeQuery(params)}`, s.token);
+}
+
+export async function getPattern(
+  s: ApiSettings,
+  patternId: string,
+  params?: { start?: string; end?: string },
+): Promise<LogPatternDetail> {
+  return fetchJSON(`${patternsBase(s)}/${encodeURIComponent(patternId)}${rangeQuery(params)}`, s.token);
+}
+
+export type PipelineResult = {
+  start: string;
+  end: string;
+  columns: string[];
+  groups?: string[];
+  interval_sec: number;
+  rows: Array<Record<string, unknown>>;
+};
+
+// runQuery runs a piped analytics query (docs/SEARCH.md), e.g.
+// `level:error | stats count() as n by fields.service | sort -n | head 10`.
+export async function runQuery(
+  s: ApiSettings,
+  q: string,
+  params?: { start?: string; end?: string },
+): Promise<PipelineResult> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/query${rangeQuery({ q, ...params })}`, s.token);
+}
+
+export type QueryJob<T = unknown> = {
+  id: string;
+  project_id: number;
+  kind: string;
+  status: "queued" | "running" | "succeeded" | "failed" | "canceled";
+  progress: number;
+  partial?: unknown;
+  result?: T;
+  error?: string;
+  cached: boolean;
+  created_at: string;
+  started_at?: string;
+  finished_at?: string;
+};
+
+// Query jobs run searches and analytics submitted with async=1 in the
+// background (docs/SEARCH.md); poll until status is no longer queued/running.
+export async function getQueryJob<T = unknown>(s: ApiSettings, jobId: string): Promise<QueryJob<T>> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/jobs/${encodeURIComponent(jobId)}`, s.token);
+}
+
+export async function cancelQueryJob(s: ApiSettings, jobId: string): Promise<QueryJob> {
+  return fetchJSON(`${s.apiBase}/api/${s.projectId}/jobs/${encodeURIComponent(jobId)}`, s.token, {
+    method: "DELETE",
+  });
+}
+
 function normalizeDetectorDescriptor(raw: unknown): DetectorDescriptor | null {
   if (!raw || typeof raw !== "object" || Array.isArray(raw)) return null;
   const rec = raw as Record<string, unknown>;
@@ -63,6 +63,7 @@ type RuleFormState = {
   levels: string;
   eventNames: string;
   messageKeywords: string;
+  patternIds: string;
   fieldsAll: RuleFieldMatchForm[];
   windowSec: string;
   threshold: string;
@@ -87,6 +88,7 @@ function createDefaultRuleForm(): RuleFormState {
     levels: "",
     eventNames: "",
     messageKeywords: "",
+    patternIds: "",
     fieldsAll: [],
     windowSec: "60",
     threshold: "1",
@@ -1458,6 +1460,12 @@ function RuleFormEditor(props: {
             onChange={(v) => set({ messageKeywords: v })}
             placeholder="boom,timeout"
           />
+          <InputField
+            label="Pattern IDs（逗号分隔，仅日志）"
+            value={f.patternIds}
+            onChange={(v) => set({ patternIds: v })}
+            placeholder="3f9a0c2e71d4b685"
+          />
         </div>
 
         <div className="mt-3">
@@ -1765,6 +1773,8 @@ function buildRulePayloadFromForm(form: RuleFormState): {
   if (levels.length > 0) match.levels = levels;
   if (eventNames.length > 0) match.eventNames = eventNames;
   if (messageKeywords.length > 0) match.messageKeywords = messageKeywords;
+  const patternIds = splitCSV(form.patternIds);
+  if (patternIds.length > 0) match.patternIds = patternIds;
 
   const fieldsAll: Array<Record<string, unknown>> = [];
   for (const f of form.fieldsAll) {
@@ -1841,6 +1851,7 @@ function ruleToForm(rule: AlertRule): RuleFormState {
     levels: toCSV(asArray(match.levels).map((v) => toText(v)).filter((v) => v !== "")),
     eventNames: toCSV(asArray(match.eventNames).map((v) => toText(v)).filter((v) => v !== "")),
     messageKeywords: toCSV(asArray(match.messageKeywords).map((v) => toText(v)).filter((v) => v !== "")),
+    patternIds: toCSV(asArray(match.patternIds).map((v) => toText(v)).filter((v) => v !== "")),
     fieldsAll,
     windowSec: String(intFromUnknown(repeat.windowSec, 60)),
     threshold: String(intFromUnknown(repeat.threshold, 1)),
@@ -1,7 +1,17 @@
-import { useEffect, useMemo, useRef, useState } from "react";
+import { Fragment, useEffect, useMemo, useRef, useState } from "react";
 import { loadSettings } from "../../lib/storage";
-import { searchLogs, searchUnified, type LogRow } from "../../lib/api";
+import {
+  getLogContext,
+  searchLogs,
+  searchUnified,
+  tailLogs,
+  type LogContext,
+  type LogRow,
+  type SearchResult,
+  type TailStats,
+} from "../../lib/api";
 import { Panel } from "../components/Panel";
+import { Sparkline } from "../components/Sparkline";
 import { TimeRangePicker } from "../components/DateTimePicker";
 import { useNavigate, useSearchParams } from "react-router-dom";
 
@@ -35,6 +45,15 @@ export function LogsPage() {
   const [showHelp, setShowHelp] = useState(false);
   const [savedQueries, setSavedQueries] = useState<SavedQuery[]>(loadSavedQueries);
   const [facets, setFacets] = useState<Record<string, { key: string; count: number }[]> | null>(null);
+  const [histogram, setHistogram] = useState<SearchResult["histogram"] | null>(null);
+  const [total, setTotal] = useState<{ n: number; relation: SearchResult["total_relation"] } | null>(null);
+  const [nextCursor, setNextCursor] = useState("");
+  const [context, setContext] = useState<{ id: number; by: string; data?: LogContext } | null>(null);
+  const tail = useRef<AbortController | null>(null);
+  const [tailing, setTailing] = useState(false);
+  const [tailStats, setTailStats] = useState<TailStats | null>(null);
+
+  useEffect(() => () => tail.current?.abort(), []);
 
   useEffect(() => {
     if (settings.token) {
@@ -53,11 +72,17 @@ export function LogsPage() {
     void run();
   }, [settings.token, settings.projectId]);
 
-  async function run() {
+  // run searches from the first page, or appends the next page when more.
+  async function run(more = false) {
     try {
       setLoading(true);
       setErr("");
-      setFacets(null);
+      if (!more) {
+        setFacets(null);
+        setHistogram(null);
+        setTotal(null);
+        setNextCursor("");
+      }
       if (!settings.token || !settings.projectId) return;
 
       // Try unified search first (returns facets), fall back to legacy
@@ -66,11 +91,30 @@ export function LogsPage() {
           q: q.trim() || undefined,
           start: start.trim() || undefined,
           end: end.trim() || undefined,
-          page: 1,
           pageSize: 200,
+          cursor: more ? nextCursor : undefined,
+          facets: ["level", "service"],
+          histogram: !more,
         });
-        setRows(result.items || []);
-        setFacets(result.facets || null);
+        const page = (result.items || []).map((h) => ({
+          id: Number(h.id),
+          timestamp: h.timestamp,
+          level: h.level,
+          trace_id: h.trace_id,
+          span_id: h.span_id,
+          message: h.message,
+          fields: h.fields,
+        }));
+        setRows((prev) => (more ? [...prev, ...page] : page));
+        setNextCursor(result.next_cursor || "");
+        setTotal({ n: result.total, relation: result.total_relation });
+        if (more) return;
+        setFacets(
+          result.facets
+            ? Object.fromEntries(Object.entries(result.facets).map(([k, f]) => [k, f.buckets]))
+            : null,
+        );
+        setHistogram(result.histogram || null);
       } catch {
         // fallback to legacy API
         const data = await searchLogs(settings, {
@@ -88,6 +132,47 @@ export function LogsPage() {
     }
   }
 
+  function stopTail() {
+    tail.current?.abort();
+    tail.current = null;
+    setTailing(false);
+  }
+
+  function startTail() {
+    stopTail();
+    const ctrl = new AbortController();
+    tail.current = ctrl;
+    setTailing(true);
+    setTailStats(null);
+    setErr("");
+    tailLogs(
+      settings,
+      { q: q.trim() || undefined },
+      {
+        onLog: (e) => setRows((prev) => [e, ...prev].slice(0, 500)),
+        onStats: setTailStats,
+      },
+      ctrl.signal,
+    )
+      .catch((e) => {
+        if (!ctrl.signal.aborted) setErr(e instanceof Error ? e.message : String(e));
+      })
+      .finally(() => {
+        if (tail.current === ctrl) stopTail();
+      });
+  }
+
+  async function showContext(id: number, by: string) {
+    setContext({ id, by });
+    try {
+      const data = await getLogContext(settings, id, { by: by || undefined, before: 20, after: 20 });
+      setContext((cur) => (cur && cur.id === id && cur.by === by ? { id, by, data } : cur));
+    } catch (e) {
+      setContext(null);
+      setErr(e instanceof Error ? e.message : String(e));
+    }
+  }
+
   function handleSaveQuery() {
     const name = q.trim().slice(0, 40);
     if (!name) return;
@@ -164,9 +249,16 @@ export function LogsPage() {
               >
                 ?
               </button>
+              <button
+                className="btn btn-md btn-outline"
+                onClick={tailing ? stopTail : startTail}
+                title="实时跟踪新日志"
+              >
+                {tailing ? "停止跟踪" : "实时跟踪"}
+              </button>
               <button
                 className="btn btn-md btn-primary"
-                onClick={run}
+                onClick={() => run()}
                 disabled={loading}
               >
                 {loading ? "查询中..." : "查询"}
@@ -182,7 +274,7 @@ export function LogsPage() {
                 onChange={(e) => setQ(e.target.value)}
                 placeholder="level:error tag:api message:timeout"
                 className="mt-1 w-full rounded-md border border-zinc-800 bg-zinc-950 px-3 py-2 text-sm text-zinc-100 outline-none focus:border-indigo-500"
-                onKeyDown={(e) => e.key === "Enter" && run()}
+                onKeyDown={(e) => e.key === "Enter" && void run()}
               />
             </div>
             <div className="grid grid-cols-1 gap-3 md:grid-cols-2">
@@ -204,10 +296,34 @@ export function LogsPage() {
               >
                 保存查询
               </button>
+              {tailing && tailStats && tailStats.dropped > 0 ? (
+                <span className="text-xs text-amber-400">
+                  超过 {tailStats.rate}/s，已跳过 {tailStats.dropped} 条（共匹配 {tailStats.matched} 条）
+                </span>
+              ) : null}
             </div>
           </div>
         </Panel>
 
+        {histogram && histogram.buckets.length > 0 && (
+          <Panel
+            title={`日志量（每 ${histogram.interval_sec}s${histogram.sampled ? "，抽样估算" : ""}）`}
+          >
+            <Sparkline
+              values={histogram.buckets.map((b) => b.count)}
+              width={800}
+              height={80}
+              variant="column"
+            />
+            <div className="mt-1 flex justify-between text-xs text-zinc-500">
+              <span>{new Date(histogram.buckets[0].time).toLocaleString()}</span>
+              <span>
+                {new Date(histogram.buckets[histogram.buckets.length - 1].time).toLocaleString()}
+              </span>
+            </div>
+          </Panel>
+        )}
+
         {showHelp && (
           <Panel title="搜索语法帮助">
             <div className="space-y-2 text-xs text-zinc-300">
@@ -258,7 +374,20 @@ export function LogsPage() {
           </Panel>
         )}
 
-        <Panel title={`结果（${rows.length}）`}>
+        <Panel
+          title={
+            total && !tailing
+              ? `结果（${rows.length} / ${total.relation === "eq" ? "" : total.relation === "gte" ? "≥ " : "约 "}${total.n}）`
+              : `结果（${rows.length}）`
+          }
+          right={
+            nextCursor && !tailing ? (
+              <button className="btn btn-sm btn-outline" onClick={() => run(true)} disabled={loading}>
+                {loading ? "加载中..." : "加载更多"}
+              </button>
+            ) : null
+          }
+        >
           <div className="overflow-x-auto">
             <table className="w-full text-left text-xs">
               <thead className="text-xs text-zinc-500">
@@ -271,7 +400,8 @@ export function LogsPage() {
               </thead>
               <tbody className="divide-y divide-zinc-900">
                 {rows.map((r) => (
-                  <tr key={r.id} className="align-top hover:bg-zinc-900/40">
+                  <Fragment key={r.id}>
+                  <tr className="align-top hover:bg-zinc-900/40">
                     <td className="py-1.5 pr-4 font-mono text-[11px] text-zinc-400">
                       {new Date(r.timestamp).toLocaleString()}
                     </td>
@@ -302,8 +432,43 @@ export function LogsPage() {
                           </pre>
                         </details>
                       ) : null}
+                      <button
+                        className="mt-1 text-[11px] text-indigo-400 hover:text-indigo-300"
+                        onClick={() => (context?.id === r.id ? setContext(null) : void showContext(r.id, ""))}
+                      >
+                        {context?.id === r.id ? "收起上下文" : "上下文"}
+                      </button>
                     </td>
                   </tr>
+                  {context?.id === r.id ? (
+                    <tr>
+                      <td colSpan={4} className="bg-zinc-950/60 px-3 py-2">
+                        <div className="mb-2 flex items-center gap-2 text-[11px] text-zinc-400">
+                          <span>同一</span>
+                          {[
+                            ["", "项目"],
+                            ["device_id", "设备"],
+                            ["trace_id", "trace"],
+                            ["distinct_id", "用户"],
+                          ].map(([by, label]) => (
+                            <button
+                              key={by}
+                              className={`btn btn-xs ${context.by === by ? "btn-primary" : "btn-outline"}`}
+                              onClick={() => void showContext(r.id, by)}
+                            >
+                              {label}
+                            </button>
+                          ))}
+                        </div>
+                        {context.data ? (
+                          <ContextLines ctx={context.data} />
+                        ) : (
+                          <div className="text-xs text-zinc-500">加载中...</div>
+                        )}
+                      </td>
+                    </tr>
+                  ) : null}
+                  </Fragment>
                 ))}
                 {rows.length === 0 ? (
                   <tr>
@@ -321,6 +486,26 @@ export function LogsPage() {
   );
 }
 
+function ContextLines(props: { ctx: LogContext }) {
+  const { ctx } = props;
+  const line = (r: LogRow, anchor: boolean) => (
+    <div key={r.id} className={`flex gap-3 ${anchor ? "bg-indigo-950/60 text-zinc-100" : "text-zinc-400"}`}>
+      <span className="shrink-0 text-zinc-500">{new Date(r.timestamp).toLocaleTimeString()}</span>
+      <span className="w-12 shrink-0">{r.level ?? ""}</span>
+      <span className="whitespace-pre-wrap break-all">{r.message}</span>
+    </div>
+  );
+  return (
+    <div className="max-h-96 overflow-auto font-mono text-[11px] leading-5">
+      {ctx.more_before ? <div className="text-zinc-600">…</div> : null}
+      {ctx.before.map((r) => line(r, false))}
+      {line(ctx.anchor, true)}
+      {ctx.after.map((r) => line(r, false))}
+      {ctx.more_after ? <div className="text-zinc-600">…</div> : null}
+    </div>
+  );
+}
+
 function highlightText(text: string, terms: string[]): string {
   if (!terms.length || !text) return escapeHtml(text);
   let result = escapeHtml(text);
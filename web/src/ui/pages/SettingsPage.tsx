@@ -779,7 +779,7 @@ function PropertySchemaPanel(props: { settings: ApiSettings }) {
 
   const [keyName, setKeyName] = useState("");
   const [displayName, setDisplayName] = useState("");
-  const [type, setType] = useState<"string" | "enum" | "number">("string");
+  const [type, setType] = useState<"string" | "enum" | "number" | "boolean" | "datetime">("string");
   const [description, setDescription] = useState("");
   const [enumValues, setEnumValues] = useState("");
 
@@ -853,12 +853,14 @@ function PropertySchemaPanel(props: { settings: ApiSettings }) {
           <div className="text-xs text-zinc-400">类型</div>
           <select
             value={type}
-            onChange={(e) => setType(e.target.value as "string" | "enum" | "number")}
+            onChange={(e) => setType(e.target.value as "string" | "enum" | "number" | "boolean" | "datetime")}
             className="mt-1 w-full rounded-md border border-zinc-800 bg-zinc-950 px-3 py-2 text-sm text-zinc-100 outline-none focus:border-indigo-500"
           >
             <option value="string">string</option>
             <option value="enum">enum</option>
             <option value="number">number</option>
+            <option value="boolean">boolean</option>
+            <option value="datetime">datetime</option>
           </select>
         </div>
         {type === "enum" ? (